@@ -12,11 +12,16 @@ estudiantes: 	Esther Adeyemi y Sebastián Hernández
 package main
 
 import (
+	"bytes"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	"prac/pkg/client"
+	"prac/pkg/crypto"
 	"prac/pkg/server"
 	"prac/pkg/ui"
 )
@@ -27,10 +32,300 @@ func main() {
 	// los mensajes en la consola.
 	log := log.New(os.Stdout, "[main] ", log.LstdFlags)
 
+	// Opciones de línea de comandos para tareas de administración.
+	verifyAudit := flag.Bool("verify-audit", false, "verifica la cadena de auditoría y termina")
+	verifyDB := flag.Bool("verify-db", false, "verifica la integridad de todos los registros de la base de datos y termina")
+	migrateUsers := flag.Bool("migrate-user-keys", false, "sustituye los nombres de usuario del store por su HMAC y termina")
+	splitKey := flag.Bool("split-key", false, "reparte la clave maestra en fragmentos de Shamir y termina")
+	shares := flag.Int("shares", 5, "número de fragmentos para -split-key")
+	threshold := flag.Int("threshold", 3, "fragmentos necesarios para desellar (con -split-key)")
+	backup := flag.String("backup", "", "escribe una copia de la base de datos cifrada con age en el fichero indicado y termina")
+	backupTo := flag.String("backup-to", "", "destinatarios age de la copia (claves age1... o ficheros, separados por comas)")
+	restore := flag.String("restore", "", "restaura una copia age de la base de datos y termina")
+	restoreTo := flag.String("restore-to", "", "destino de -restore (por defecto, la ruta de la base de datos)")
+	exportJSON := flag.String("export-json", "", "exporta todo el contenido de la base de datos en JSON al fichero indicado y termina")
+	importJSON := flag.String("import-json", "", "importa un fichero de -export-json en la base de datos (vacía) configurada y termina")
+	dump := flag.Bool("dump", false, "muestra el contenido de la base de datos (sin los valores sensibles) y termina")
+	dumpNS := flag.String("dump-ns", "", "namespaces que muestra -dump, separados por comas (por defecto, todos)")
+	compact := flag.Bool("compact", false, "reescribe el fichero de la base de datos (bbolt) sin el espacio libre y termina")
+	tlsPin := flag.Bool("tls-pin", false, "muestra el pin del certificado TLS del servidor (para PRAC_CLIENT_PIN) y termina")
+	clientCert := flag.String("client-cert", "", "emite con la CA de PRAC_TLS_DIR un certificado de cliente (mTLS) para el usuario indicado y termina")
+	stats := flag.Bool("stats", false, "muestra cuántas entradas y bytes ocupa cada namespace de la base de datos y termina")
+	reencrypt := flag.String("reencrypt", "", "recifra con la versión actual de su clave (PRAC_KEY_VERSIONS) los namespaces indicados, separados por comas, y termina")
+	rotateKMS := flag.Bool("rotate-kms", false, "rota la clave de Vault que protege la clave maestra y termina")
+	identity := flag.String("identity", "", "fichero de identidad age para -restore (si no, se usa frase de paso)")
+	calibrate := flag.Bool("calibrate", false, "mide esta máquina, propone parámetros Argon2 y los guarda")
+	calibrateTarget := flag.Duration("calibrate-target", crypto.DefaultArgon2Target, "tiempo objetivo por hash para -calibrate")
+	calibrateMem := flag.Uint("calibrate-max-mem", 256, "memoria máxima por hash en MiB para -calibrate (cuenta una vez por login simultáneo)")
+	flag.Parse()
+
+	// Antes de tocar ninguna clave comprobamos que las primitivas
+	// criptográficas del binario dan los resultados esperados.
+	if err := crypto.SelfTest(); err != nil {
+		log.Fatalf("Error: %v\n", err)
+	}
+
+	// Cargamos la configuración del servidor y desbloqueamos la clave
+	// maestra antes de lanzar la goroutine, para que la petición de la
+	// frase de paso no se mezcle con la salida del arranque.
+	cfg, err := server.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error de configuración: %v\n", err)
+	}
+	var prompt func(string) []byte
+	if ui.IsInteractive() {
+		prompt = ui.ReadPassword
+	}
+
+	// Calibración de Argon2: tampoco necesita la clave maestra
+	if *calibrate {
+		fmt.Printf("Calibrando Argon2id (objetivo %v, hasta %d MiB)...\n", *calibrateTarget, *calibrateMem)
+		c := crypto.CalibrateArgon2(*calibrateTarget, uint32(*calibrateMem)*1024)
+		p := c.Params
+		fmt.Printf("Actuales:     m=%d MiB, t=%d, p=%d\n", cfg.Argon2.Memory/1024, cfg.Argon2.Time, cfg.Argon2.Threads)
+		fmt.Printf("Recomendados: m=%d MiB, t=%d, p=%d (%v por hash)\n", p.Memory/1024, p.Time, p.Threads, c.Duration.Round(time.Millisecond))
+		if c.Floor {
+			fmt.Println("Aviso: esta máquina no llega al objetivo ni con los parámetros mínimos; se mantienen éstos.")
+		}
+		if ui.IsInteractive() && !ui.Confirm("¿Guardar en "+cfg.Argon2File+"?") {
+			return
+		}
+		if err := crypto.SaveArgon2Params(cfg.Argon2File, p); err != nil {
+			log.Fatalf("Error guardando los parámetros: %v\n", err)
+		}
+		fmt.Printf("Parámetros guardados en %s; los hashes existentes se actualizan en el siguiente login.\n", cfg.Argon2File)
+		return
+	}
+
+	// Copias de seguridad en formato age. No necesitan la clave maestra, así
+	// que van antes de desbloquearla (en una máquina nueva se crearía otra).
+	if *backup != "" {
+		if *backupTo != "" {
+			cfg.BackupRecipients = strings.Split(*backupTo, ",")
+		}
+		if len(cfg.BackupRecipients) == 0 && len(cfg.BackupPassphrase) == 0 && prompt != nil {
+			cfg.BackupPassphrase = prompt("Frase de paso de la copia")
+			again := prompt("Repite la frase de paso")
+			match := bytes.Equal(cfg.BackupPassphrase, again)
+			crypto.Wipe(again)
+			if !match {
+				log.Fatalf("Las frases de paso no coinciden\n")
+			}
+		}
+		err := server.BackupDatabase(cfg, *backup)
+		crypto.Wipe(cfg.BackupPassphrase)
+		if err != nil {
+			log.Fatalf("Error creando la copia de seguridad: %v\n", err)
+		}
+		fmt.Printf("Copia cifrada escrita en %s (se descifra con \"age -d\").\n", *backup)
+		fmt.Printf("Recuerda guardar aparte %s: sin la clave maestra la copia no sirve.\n", cfg.KeyFile)
+		return
+	}
+	if *restore != "" {
+		dst := *restoreTo
+		if dst == "" {
+			dst = cfg.DBPath
+		}
+		pass := cfg.BackupPassphrase
+		if *identity == "" && len(pass) == 0 && prompt != nil {
+			pass = prompt("Frase de paso de la copia")
+		}
+		err := server.RestoreDatabase(cfg.DBEngine, *restore, dst, *identity, pass)
+		crypto.Wipe(pass)
+		if err != nil {
+			log.Fatalf("Error restaurando la copia de seguridad: %v\n", err)
+		}
+		fmt.Printf("Copia restaurada en %s.\n", dst)
+		return
+	}
+
+	// Compactación: los valores no se descifran, así que tampoco hace falta
+	if *compact {
+		before, after, err := server.CompactDatabase(cfg)
+		if err != nil {
+			log.Fatalf("Error compactando la base de datos: %v\n", err)
+		}
+		fmt.Printf("Base de datos compactada: %d -> %d bytes\n", before, after)
+		return
+	}
+	if *stats {
+		st, err := server.DatabaseStats(cfg)
+		if err != nil {
+			log.Fatalf("Error calculando la ocupación de la base de datos: %v\n", err)
+		}
+		for _, ns := range st.Namespaces {
+			fmt.Printf("%-32s %8d entradas %12d bytes", ns.Namespace, ns.Keys, ns.Bytes)
+			if ns.Pages > 0 {
+				fmt.Printf(" %6d páginas (%d bytes usados de %d)", ns.Pages, ns.Inuse, ns.Alloc)
+			}
+			fmt.Println()
+		}
+		fmt.Printf("Total: %d entradas, %d bytes\n", st.Keys, st.Bytes)
+		if st.FileSize > 0 {
+			fmt.Printf("Tamaño en disco: %d bytes\n", st.FileSize)
+		}
+		if st.PageSize > 0 {
+			fmt.Printf("Espacio libre: %d páginas de %d bytes (se recupera con -compact)\n", st.FreePages, st.PageSize)
+		}
+		return
+	}
+
+	// Pin del certificado TLS: tampoco necesita la clave maestra
+	if *tlsPin {
+		pin, err := server.TLSPin(cfg)
+		if err != nil {
+			log.Fatalf("Error leyendo el certificado TLS: %v\n", err)
+		}
+		fmt.Println(pin)
+		return
+	}
+
+	// Certificado de cliente para mTLS: tampoco necesita la clave maestra
+	if *clientCert != "" {
+		cert, key, err := server.IssueClientCertificate(cfg, *clientCert)
+		if err != nil {
+			log.Fatalf("Error emitiendo el certificado de cliente: %v\n", err)
+		}
+		fmt.Printf("Certificado de %s en %s (clave en %s)\n", *clientCert, cert, key)
+		return
+	}
+
+	// Volcado de depuración: tampoco necesita la clave maestra
+	if *dump {
+		var namespaces []string
+		if *dumpNS != "" {
+			namespaces = strings.Split(*dumpNS, ",")
+		}
+		if err := server.DumpDatabase(cfg, os.Stdout, namespaces); err != nil {
+			log.Fatalf("Error volcando la base de datos: %v\n", err)
+		}
+		return
+	}
+
+	// Exportación e importación en JSON, para cambiar de motor: los valores
+	// siguen cifrados, así que tampoco hace falta la clave maestra
+	if *exportJSON != "" {
+		n, err := server.ExportDatabase(cfg, *exportJSON)
+		if err != nil {
+			log.Fatalf("Error exportando la base de datos: %v\n", err)
+		}
+		fmt.Printf("Entradas exportadas a %s: %d\n", *exportJSON, n)
+		return
+	}
+	if *importJSON != "" {
+		n, err := server.ImportDatabase(cfg, *importJSON)
+		if err != nil {
+			log.Fatalf("Error importando la base de datos: %v\n", err)
+		}
+		fmt.Printf("Entradas importadas en %s: %d\n", cfg.DBPath, n)
+		return
+	}
+
+	if err := cfg.UnlockMasterKey(prompt); err != nil {
+		log.Fatalf("Error desbloqueando la clave maestra: %v\n", err)
+	}
+	// Con HSM o KMS, el fichero de clave por frase de paso es una segunda vía de acceso
+	if cfg.PKCS11.Module != "" || cfg.Vault.Addr != "" {
+		if _, err := os.Stat(cfg.KeyFile); err == nil {
+			log.Printf("Aviso: la clave maestra está protegida por el HSM/KMS; elimina %s para que la frase de paso no baste.\n", cfg.KeyFile)
+		}
+	}
+
+	// Rotación de la clave del KMS (la clave maestra y los datos no cambian)
+	if *rotateKMS {
+		if err := server.RotateKMSKey(cfg); err != nil {
+			log.Fatalf("Error rotando la clave del KMS: %v\n", err)
+		}
+		fmt.Println("Clave del KMS rotada y clave maestra recifrada.")
+		return
+	}
+
+	// Modo verificación: comprobamos la auditoría y salimos
+	// con código distinto de cero si se han detectado manipulaciones.
+	if *verifyAudit {
+		rep, err := server.VerifyAudit(cfg)
+		if err != nil {
+			log.Fatalf("Error verificando auditoría: %v\n", err)
+		}
+		fmt.Printf("Entradas verificadas: %d\n", rep.Entries)
+		for _, p := range rep.Problems {
+			fmt.Printf("  [%s] %s\n", p.Key, p.Reason)
+		}
+		if !rep.OK() {
+			fmt.Println("¡La cadena de auditoría ha sido manipulada!")
+			os.Exit(1)
+		}
+		fmt.Println("Cadena de auditoría íntegra.")
+		return
+	}
+
+	// Verificación completa: todos los registros de todos los namespaces
+	if *verifyDB {
+		rep, err := server.VerifyDatabase(cfg)
+		if err != nil {
+			log.Fatalf("Error verificando la base de datos: %v\n", err)
+		}
+		fmt.Printf("Namespaces: %d, registros verificados: %d (%d aún sin cifrar, %d con una clave anterior, %d sin suma de comprobación)\n", rep.Namespaces, rep.Records, rep.Plaintext, rep.Stale, rep.Unchecked)
+		for _, p := range rep.Problems {
+			fmt.Printf("  [%s/%s] %s\n", p.Namespace, p.Key, p.Reason)
+		}
+		if !rep.OK() {
+			fmt.Printf("¡%d registros corruptos o manipulados!\n", len(rep.Problems))
+			os.Exit(1)
+		}
+		fmt.Println("Base de datos íntegra.")
+		return
+	}
+
+	// Recifrado de los namespaces cuya clave ha cambiado de versión
+	if *reencrypt != "" {
+		n, err := server.ReencryptDatabase(cfg, strings.Split(*reencrypt, ","))
+		if err != nil {
+			log.Fatalf("Error recifrando la base de datos: %v\n", err)
+		}
+		fmt.Printf("Registros recifrados: %d\n", n)
+		return
+	}
+
+	// Migración de claves de usuario en claro a claves HMAC
+	if *migrateUsers {
+		n, err := server.MigrateUserKeys(cfg)
+		if err != nil {
+			log.Fatalf("Error migrando las claves de usuario: %v\n", err)
+		}
+		fmt.Printf("Claves de usuario migradas: %d\n", n)
+		return
+	}
+
+	// Modo reparto: a partir de ahora el servidor arrancará sellado y
+	// hará falta reunir 'threshold' fragmentos para abrir la clave maestra.
+	if *splitKey {
+		parts, err := server.SplitMasterKey(cfg, *shares, *threshold)
+		if err != nil {
+			log.Fatalf("Error repartiendo la clave maestra: %v\n", err)
+		}
+		fmt.Printf("Clave maestra repartida en %d fragmentos (umbral %d).\n", *shares, *threshold)
+		fmt.Println("Entrega cada fragmento a una persona distinta; no se volverán a mostrar:")
+		for i, p := range parts {
+			fmt.Printf("  %d: %s\n", i+1, p)
+		}
+		// Mientras exista el fichero de clave, bastaría la frase de paso
+		if _, err := os.Stat(cfg.KeyFile); err == nil {
+			if ui.IsInteractive() && ui.Confirm("¿Eliminar el fichero de clave "+cfg.KeyFile+" (recomendado)?") {
+				if err := os.Remove(cfg.KeyFile); err != nil {
+					log.Fatalf("Error eliminando el fichero de clave: %v\n", err)
+				}
+			} else {
+				fmt.Printf("Aviso: elimina %s para que la frase de paso no baste por sí sola.\n", cfg.KeyFile)
+			}
+		}
+		return
+	}
+
 	// Inicia servidor en goroutine.
 	log.Println("Iniciando servidor...")
 	go func() {
-		if err := server.Run(); err != nil {
+		if err := server.Run(cfg); err != nil {
 			log.Fatalf("Error del servidor: %v\n", err)
 		}
 	}()
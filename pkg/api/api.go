@@ -2,26 +2,543 @@
 // para la comunicación entre servidor y cliente.
 package api
 
+import (
+	"encoding/json"
+	"time"
+)
+
 const (
 	ActionRegister   = "register"
 	ActionLogin      = "login"
 	ActionFetchData  = "fetchData"
 	ActionUpdateData = "updateData"
 	ActionLogout     = "logout"
+
+	// Renovación de la sesión: el token de sesión (de acceso) dura poco
+	// (ver Config.SessionTTL del servidor) y, antes o después de que
+	// caduque, el cliente pide otro con el token de refresco que recibió
+	// al iniciar sesión (RefreshToken), sin volver a pedir la contraseña.
+	// La respuesta trae un token de sesión, su clave de sesión y otro token
+	// de refresco: cada uno sirve una sola vez, y volver a usar uno ya
+	// gastado (señal de que lo han robado) cierra la sesión.
+	ActionRefresh = "refresh"
+
+	// Sesiones abiertas del usuario: cada login abre una nueva sin cerrar
+	// las demás (otros equipos, otros clientes). listSessions las devuelve
+	// en Sessions, con el equipo (el User-Agent del cliente), la IP y la
+	// última actividad de cada una, y logoutAll las cierra todas, incluida
+	// la de la petición.
+	ActionListSessions = "listSessions"
+	ActionLogoutAll    = "logoutAll"
+
+	// Cambio de contraseña con la sesión abierta. Con contraseña clásica se
+	// envían Password (la actual) y NewPassword; con SRP, tras un srpBegin
+	// con la contraseña actual, SRP lleva M1 y la nueva sal y verificador.
+	ActionChangePassword = "changePassword"
+
+	// Baja del usuario de la sesión: borra sus credenciales, sus datos y
+	// todo lo demás que guarda el servidor de él. Como en changePassword,
+	// hay que volver a demostrar la contraseña: Password, o SRP.M1 tras un
+	// srpBegin.
+	ActionDeleteAccount = "deleteAccount"
+
+	// Espera (hasta un tiempo máximo) a que cambien los datos del usuario,
+	// para no tener que pedirlos con fetchData cada poco. Si han cambiado,
+	// responde con Success y hay que llamar a fetchData; si no, con
+	// Success=false y el mensaje "Sin cambios".
+	ActionWaitData = "waitData"
+
+	// Historial de los datos del usuario: cada updateData guarda una
+	// versión nueva. listDataVersions devuelve las guardadas en Versions (la
+	// última es la actual) y fetchDataVersion, la de Request.Version, como
+	// fetchData pero sin firma. Para deshacer un cambio, el cliente vuelve a
+	// enviar con updateData la versión anterior.
+	ActionListDataVersions = "listDataVersions"
+	ActionFetchDataVersion = "fetchDataVersion"
+
+	// Mensajes entre usuarios del servidor. sendMessage deja Data en el
+	// buzón del usuario To; fetchMessages devuelve en Messages los del
+	// buzón propio, del más antiguo al más reciente y por páginas (Limit,
+	// Cursor), y deleteMessage borra el de identificador Data. El servidor
+	// no mira el cuerpo: el cifrado de extremo a extremo es cosa de los
+	// clientes.
+	ActionSendMessage   = "sendMessage"
+	ActionFetchMessages = "fetchMessages"
+	ActionDeleteMessage = "deleteMessage"
+
+	// Grupos de usuarios con unos datos en común. createGroup crea el grupo
+	// Group con el usuario como dueño y primer miembro; el dueño añade y
+	// quita miembros (Member) con addGroupMember y removeGroupMember, y
+	// cualquier miembro puede quitarse a sí mismo. listGroups devuelve en
+	// Groups los grupos del usuario. Sólo los miembros pueden leer
+	// (fetchGroupData) y cambiar (updateGroupData) los datos del grupo, que
+	// van en Data; como en los mensajes, el servidor no mira lo que son.
+	ActionCreateGroup       = "createGroup"
+	ActionAddGroupMember    = "addGroupMember"
+	ActionRemoveGroupMember = "removeGroupMember"
+	ActionListGroups        = "listGroups"
+	ActionFetchGroupData    = "fetchGroupData"
+	ActionUpdateGroupData   = "updateGroupData"
+
+	// Ficheros del usuario, por trozos para que ninguna petición tenga que
+	// llevar uno entero. uploadFileChunk envía el trozo Chunk (desde 0, en
+	// orden; repetir el último ya enviado no es un error) en Data, en
+	// base64, con File (nombre, tamaño, SHA-256 y número de trozos; el
+	// trozo 0 empieza de nuevo el fichero de ese nombre). Al llegar el
+	// último, el servidor comprueba el tamaño y el hash del fichero entero
+	// y responde con File.Complete. downloadFileChunk devuelve el trozo
+	// Chunk del fichero File.Name en Data, con File completo. Como en los
+	// mensajes, el servidor no mira el contenido.
+	ActionUploadFileChunk   = "uploadFileChunk"
+	ActionDownloadFileChunk = "downloadFileChunk"
+
+	// Ficheros compartidos entre usuarios. Cada usuario publica con
+	// setShareKey su clave de compartición (ShareKey, firmada con su clave
+	// de firma) y getShareKey devuelve la de To, con su clave de firma en
+	// PublicKey para comprobarla. shareData da a To acceso de lectura al
+	// fichero File.Name del usuario, con la clave del fichero envuelta para
+	// To en Data (ver crypto.WrapShareKey), y unshareData se lo quita.
+	// listShared devuelve en Shared lo que otros han compartido con el
+	// usuario, que lo descarga con downloadFileChunk y Owner.
+	ActionSetShareKey = "setShareKey"
+	ActionGetShareKey = "getShareKey"
+	ActionShareData   = "shareData"
+	ActionUnshareData = "unshareData"
+	ActionListShared  = "listShared"
+
+	// Directorio de claves públicas. publishKey publica las claves del
+	// usuario (Keys): la de firma, que tiene que ser la de la cuenta (o
+	// pasa a serlo si aún no tiene), y la de cifrado, firmada con ella.
+	// getKey devuelve en Keys las de To (o las propias, sin To) con su
+	// huella (ver crypto.KeyFingerprint), que los usuarios pueden comparar
+	// por otro canal antes de fiarse de ellas: así el servidor no puede
+	// dar unas suyas sin que se note. La clave de cifrado es la misma que
+	// la de compartición: setShareKey y getShareKey siguen para los
+	// clientes que ya las usan.
+	ActionPublishKey = "publishKey"
+	ActionGetKey     = "getKey"
+
+	// Información del servidor, sin sesión: su versión, cuánto lleva en
+	// marcha, las versiones del protocolo que acepta y las funciones que
+	// tiene activas (Server), para que el cliente ofrezca sólo lo que se
+	// puede usar. Sirve también de comprobación de salud: si la base de
+	// datos no responde, falla con ErrInternal.
+	ActionServerInfo = "serverInfo"
+
+	// Últimos inicios de sesión del usuario (con cualquier método), del
+	// más reciente al más antiguo, en Logins.
+	ActionListLogins = "listLogins"
+
+	// enable2FA activa el doble factor. Si ya estaba activado, genera un
+	// secreto y unos códigos nuevos, y hay que confirmarlo con Password o
+	// con un Code TOTP actual (si no, ErrTwoFactorRequired).
+	ActionEnable2FA     = "enable2FA"
+	ActionLoginRecovery = "loginRecovery"
+
+	// Login con el certificado de cliente de la conexión TLS (servidor con
+	// PRAC_MTLS), sin contraseña: el usuario es el CN del certificado. Si
+	// tiene 2FA, Code lleva el código como en login.
+	ActionCertLogin = "certLogin"
+
+	// Ceremonias WebAuthn (passkeys / llaves FIDO2): Data lleva el JSON
+	// de opciones (respuesta a *Begin) o de la credencial (petición *Finish).
+	ActionWebAuthnRegisterBegin  = "webauthnRegisterBegin"
+	ActionWebAuthnRegisterFinish = "webauthnRegisterFinish"
+	ActionWebAuthnLoginBegin     = "webauthnLoginBegin"
+	ActionWebAuthnLoginFinish    = "webauthnLoginFinish"
+
+	// Login SRP-6a: la contraseña nunca sale del cliente.
+	ActionSRPRegister = "srpRegister" // envía sal y verificador
+	ActionSRPBegin    = "srpBegin"    // envía A, recibe sal y B
+	ActionSRPVerify   = "srpVerify"   // envía M1, recibe M2 y token
+
+	// Registro y login OPAQUE (opcional, ver PRAC_ENABLE_OPAQUE): Data lleva
+	// el JSON del mensaje del protocolo en cada sentido. Al terminar el login
+	// el token llega en Data, cifrado con la clave de sesión OPAQUE.
+	ActionOPAQUERegisterInit   = "opaqueRegisterInit"
+	ActionOPAQUERegisterFinish = "opaqueRegisterFinish"
+	ActionOPAQUELoginInit      = "opaqueLoginInit"
+	ActionOPAQUELoginFinish    = "opaqueLoginFinish"
+
+	// Acciones de administración (sesión de un usuario de PRAC_ADMINS).
+	// adminBackup guarda una instantánea de la base de datos en el servidor
+	// y devuelve su nombre en Data; adminRestore recibe ese nombre en Data
+	// y sustituye la base de datos por la instantánea sin parar el servidor.
+	// adminCompact reescribe el fichero de la base de datos sin el espacio
+	// libre (sólo con bbolt). adminStats devuelve en Stats lo que ocupa
+	// cada namespace. listUsers devuelve en Users las cuentas registradas,
+	// por orden de nombre y por páginas (Limit, Cursor); con Prefix, sólo
+	// las que empiezan por él.
+	ActionAdminBackup  = "adminBackup"
+	ActionAdminRestore = "adminRestore"
+	ActionAdminCompact = "adminCompact"
+	ActionAdminStats   = "adminStats"
+	ActionListUsers    = "listUsers"
 )
 
+// Versiones del protocolo (Request.APIVersion). El cliente pide la más
+// alta que conoce y el servidor contesta con la que usa (ver
+// Response.APIVersion): la pedida, o la más alta que conoce él si el
+// cliente es más nuevo. Una petición sin APIVersion es de la 1, la de los
+// clientes de antes de versionar el protocolo.
+//
+//   - 1: cada acción lee y escribe los campos sueltos de Request y
+//     Response; Payload es opcional.
+//   - 2: lo propio de cada acción va siempre en Payload (ver
+//     RegisterPayload y los demás) y los campos sueltos se ignoran, salvo
+//     los de la envoltura (ver Request.Envelope).
+const (
+	APIVersion1 = 1
+	APIVersion2 = 2
+
+	MinAPIVersion     = APIVersion1 // la más antigua que se sigue aceptando
+	CurrentAPIVersion = APIVersion2
+)
+
+// APIPathV2 es el endpoint de la versión 2: como /api, pero sin
+// APIVersion la petición es de la 2.
+const APIPathV2 = "/api/v2"
+
+// Route es la ruta REST de una acción. El token de sesión va en la
+// cabecera "Authorization: Bearer <token>" y el usuario se saca de él; el
+// resto de la Request va en el cuerpo JSON, salvo con GET, que sólo lleva
+// Sealed y Format en la query ("?sealed=true&format=jwe"), y "payload=true"
+// para recibir la respuesta con Payload. La respuesta es la misma Response,
+// con un código de estado HTTP acorde.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Routes son las acciones que tienen ruta REST propia. Mientras dure la
+// transición, también se pueden enviar por POST a /api con Action, como
+// todas las demás.
+var Routes = map[string]Route{
+	ActionRegister:   {"POST", "/api/v1/register"},
+	ActionLogin:      {"POST", "/api/v1/login"},
+	ActionFetchData:  {"GET", "/api/v1/data"},
+	ActionUpdateData: {"PUT", "/api/v1/data"},
+	ActionLogout:     {"POST", "/api/v1/logout"},
+	ActionRefresh:    {"POST", "/api/v1/refresh"},
+	ActionServerInfo: {"GET", "/api/v1/info"},
+}
+
+// EventsPath es el canal de avisos del servidor: un WebSocket que el
+// cliente abre con la sesión iniciada (token en "Authorization: Bearer") y
+// por el que recibe un Event en JSON por mensaje. Al cerrarse la sesión,
+// el último aviso es EventLogout y el servidor cierra la conexión.
+const EventsPath = "/api/v1/events"
+
+// RequestIDHeader es la cabecera HTTP (y la clave de metadatos gRPC, en
+// minúsculas) con el identificador de la petición. El cliente puede
+// mandarlo; si no, el servidor lo genera (o lo toma del traceparent de W3C
+// Trace Context). Va en la respuesta y en cada línea del log del servidor
+// sobre la petición, para encontrarlas a partir de un fallo del cliente.
+const RequestIDHeader = "X-Request-ID"
+
+// Protección CSRF de doble envío, para los clientes de navegador (servidor
+// con PRAC_ENABLE_CSRF): el servidor pone la cookie CSRFCookie con un token
+// aleatorio y las peticiones que no son GET, HEAD ni OPTIONS tienen que
+// repetirlo en la cabecera CSRFHeader. Otra web puede hacer que el
+// navegador mande la cookie, pero no leerla para poner la cabecera. Si
+// falta o no coincide, la respuesta es ErrCSRF (con la cookie, si no la
+// tenía, para reintentar).
+const (
+	CSRFCookie = "prac_csrf"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// Tipos de Event.
+const (
+	EventDataChanged = "dataChanged" // otra sesión ha cambiado los datos del usuario
+	EventLogout      = "logout"      // la sesión ya no vale: se ha cerrado (logout, logoutAll, cambio de contraseña) o ha caducado
+	EventMessage     = "message"     // ha llegado un mensaje nuevo
+	EventGroup       = "group"       // cambios en un grupo del usuario: ha entrado, ha salido o han cambiado sus datos
+	EventShared      = "shared"      // otro usuario ha compartido un fichero con el usuario
+)
+
+// Event es un aviso del servidor por EventsPath.
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message,omitempty"` // texto para mostrar al usuario
+}
+
 // Request y Response como antes
 type Request struct {
-	Action   string `json:"action"`
-	Username string `json:"username"`
-	Password string `json:"password,omitempty"`
-	Token    string `json:"token,omitempty"`
-	Data     string `json:"data,omitempty"`
+	APIVersion int    `json:"apiVersion,omitempty"` // versión del protocolo (ver CurrentAPIVersion)
+	Action     string `json:"action"`
+	Username   string `json:"username"`
+	Password   string `json:"password,omitempty"`
+	Token      string `json:"token,omitempty"`
+	Data       string `json:"data,omitempty"`
+	Code       string `json:"code,omitempty"` // código TOTP o de recuperación
+
+	RefreshToken string `json:"refreshToken,omitempty"` // token de refresco, en refresh
+
+	NewPassword string `json:"newPassword,omitempty"` // contraseña nueva en changePassword
+	DataKey     string `json:"dataKey,omitempty"`     // clave de datos envuelta con la contraseña (la primera vez y al cambiarla)
+
+	PublicKey string `json:"publicKey,omitempty"` // clave pública Ed25519 (base64), al registrarse
+	Signature string `json:"signature,omitempty"` // firma Ed25519 (base64) de Data en updateData
+
+	SRP *SRPParams `json:"srp,omitempty"` // mensajes del protocolo SRP
+
+	Sealed bool   `json:"sealed,omitempty"` // Data va cifrado con la clave de sesión
+	Format string `json:"format,omitempty"` // formato de Data cifrado: "" (propio) o "jwe"; vale también para la respuesta
+
+	Version uint64 `json:"version,omitempty"` // versión de los datos en fetchDataVersion
+
+	To string `json:"to,omitempty"` // destinatario en sendMessage
+
+	Group  string `json:"group,omitempty"`  // nombre del grupo en las acciones de grupos
+	Member string `json:"member,omitempty"` // miembro que se añade o se quita del grupo
+
+	File  *FileInfo `json:"file,omitempty"`  // fichero en uploadFileChunk y downloadFileChunk
+	Chunk int       `json:"chunk,omitempty"` // número de trozo del fichero
+	Owner string    `json:"owner,omitempty"` // en downloadFileChunk, dueño de un fichero compartido (vacío: el usuario)
+
+	ShareKey *ShareKey `json:"shareKey,omitempty"` // clave de compartición del usuario, en setShareKey
+
+	Keys *PublicKeys `json:"keys,omitempty"` // claves públicas del usuario, en publishKey
+
+	// Expected, en updateData, son los datos tal como los devolvió fetchData
+	// (sin el cifrado de sesión): si ya no son los guardados, porque otro
+	// cliente los ha cambiado entre tanto, no se escribe nada y la
+	// respuesta lo dice. Sin Expected, updateData sobrescribe siempre.
+	Expected *string `json:"expected,omitempty"`
+
+	// Limit y Cursor paginan las acciones de listado (listDataVersions,
+	// listLogins): Limit es el máximo de elementos por página (0: lo que
+	// decida el servidor, que además pone un tope) y Cursor, el NextCursor
+	// de la respuesta anterior (vacío: desde el principio).
+	Limit  int    `json:"limit,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+
+	Prefix string `json:"prefix,omitempty"` // en listUsers, sólo los usuarios cuyo nombre empieza por él
+
+	// Payload lleva los campos propios de la acción con su tipo (ver
+	// RegisterPayload y los demás); con él, se ignoran los sueltos.
+	Payload json.RawMessage `json:"payload,omitempty"`
 }
 
+// ErrorCode dice por qué ha fallado una acción (Response.Code), para que el
+// cliente pueda actuar según el error sin interpretar Message, que es sólo
+// para mostrarlo.
+type ErrorCode string
+
+const (
+	ErrBadRequest         ErrorCode = "badRequest"         // faltan campos o tienen un formato no válido
+	ErrUnknownAction      ErrorCode = "unknownAction"      // Action no existe (o no está habilitada)
+	ErrInvalidCredentials ErrorCode = "invalidCredentials" // contraseña, credencial o código de recuperación incorrectos
+	ErrWeakPassword       ErrorCode = "weakPassword"       // la contraseña nueva no es lo bastante robusta
+	ErrTwoFactorRequired  ErrorCode = "twoFactorRequired"  // falta el código 2FA (ver TwoFactorRequired)
+	ErrInvalidTwoFactor   ErrorCode = "invalidTwoFactor"   // el código 2FA es incorrecto
+	ErrTokenExpired       ErrorCode = "tokenExpired"       // el token no vale: caducado, revocado o de otra sesión
+	ErrForbidden          ErrorCode = "forbidden"          // la sesión (o el certificado) no permite la acción
+	ErrUserNotFound       ErrorCode = "userNotFound"
+	ErrUserExists         ErrorCode = "userExists"
+	ErrNotFound           ErrorCode = "notFound"           // no existe lo pedido (versión, instantánea, ceremonia en curso...)
+	ErrConflict           ErrorCode = "conflict"           // los datos han cambiado desde que se leyeron (ver Request.Expected)
+	ErrQuotaExceeded      ErrorCode = "quotaExceeded"      // se ha superado el tamaño o la cantidad permitidos
+	ErrNotSupported       ErrorCode = "notSupported"       // el servidor no ofrece esa función con su configuración
+	ErrNoChanges          ErrorCode = "noChanges"          // waitData: no ha habido cambios antes del tiempo máximo
+	ErrCanceled           ErrorCode = "canceled"           // el cliente ha cancelado la petición
+	ErrCorrupted          ErrorCode = "corrupted"          // los datos guardados en el servidor están dañados
+	ErrInternal           ErrorCode = "internal"           // fallo del servidor; se puede reintentar más tarde
+	ErrUnsupportedVersion ErrorCode = "unsupportedVersion" // el servidor ya no acepta esa versión del protocolo
+	ErrCSRF               ErrorCode = "csrf"               // falta el token CSRF o no es el de la cookie (ver CSRFHeader)
+	ErrRateLimited        ErrorCode = "rateLimited"        // demasiadas peticiones: hay que esperar Response.RetryAfter
+)
+
 type Response struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Token   string `json:"token,omitempty"`
-	Data    string `json:"data,omitempty"`
+	APIVersion int       `json:"apiVersion,omitempty"` // versión del protocolo con la que se ha atendido la petición
+	Success    bool      `json:"success"`
+	Code       ErrorCode `json:"code,omitempty"` // por qué ha fallado, si Success es false
+	Message    string    `json:"message"`
+	Token      string    `json:"token,omitempty"`
+	Data       string    `json:"data,omitempty"`
+
+	TwoFactorRequired  bool     `json:"twoFactorRequired,omitempty"`  // el login necesita un código 2FA
+	RecoveryCodes      []string `json:"recoveryCodes,omitempty"`      // sólo se envían una vez, al activar 2FA
+	MustChangePassword bool     `json:"mustChangePassword,omitempty"` // la contraseña ha caducado: hay que cambiarla antes de seguir
+
+	PublicKey string `json:"publicKey,omitempty"` // clave pública del autor de Data (base64); en getShareKey, la de firma de To
+	Signature string `json:"signature,omitempty"` // firma de Data por su autor (base64)
+
+	SRP *SRPParams `json:"srp,omitempty"` // mensajes del protocolo SRP
+
+	SessionKey string `json:"sessionKey,omitempty"` // clave de sesión (base64), al iniciar sesión
+
+	RefreshToken string `json:"refreshToken,omitempty"` // token de refresco (ver ActionRefresh), al iniciar o renovar la sesión
+	DataKey      string `json:"dataKey,omitempty"`      // clave de datos envuelta, al iniciar sesión (ver crypto.WrapDataKey)
+	Sealed       bool   `json:"sealed,omitempty"`       // Data va cifrado con la clave de sesión
+	Format       string `json:"format,omitempty"`       // formato de Data cifrado (ver Request.Format)
+
+	Versions []DataVersion `json:"versions,omitempty"` // versiones guardadas de los datos, en listDataVersions
+	Logins   []LoginRecord `json:"logins,omitempty"`   // últimos inicios de sesión, en listLogins
+	Sessions []SessionInfo `json:"sessions,omitempty"` // sesiones abiertas, en listSessions
+
+	Stats    *DBStats   `json:"stats,omitempty"`    // ocupación de la base de datos, en adminStats
+	Users    []UserInfo `json:"users,omitempty"`    // cuentas registradas, en listUsers
+	Messages []Message  `json:"messages,omitempty"` // mensajes del buzón, en fetchMessages
+	Groups   []Group    `json:"groups,omitempty"`   // grupos del usuario, en listGroups
+
+	File *FileInfo `json:"file,omitempty"` // fichero en uploadFileChunk y downloadFileChunk
+
+	ShareKey *ShareKey    `json:"shareKey,omitempty"` // clave de compartición de To, en getShareKey
+	Shared   []SharedItem `json:"shared,omitempty"`   // ficheros compartidos con el usuario, en listShared
+
+	Keys *PublicKeys `json:"keys,omitempty"` // claves públicas de To, en getKey
+
+	Server *ServerInfo `json:"server,omitempty"` // en serverInfo
+
+	Payload json.RawMessage `json:"payload,omitempty"` // si la petición llevaba Payload, los campos propios de la acción
+
+	NextCursor string `json:"nextCursor,omitempty"` // en los listados, el Cursor de la página siguiente; vacío si no hay más
+
+	RequestID string `json:"requestId,omitempty"` // identificador de la petición (ver RequestIDHeader)
+
+	RetryAfter int `json:"retryAfter,omitempty"` // con ErrRateLimited, segundos que hay que esperar antes de repetir la petición
+}
+
+// DBStats describe lo que ocupa la base de datos del servidor. Los campos
+// de páginas y espacio libre sólo los rellena bbolt.
+type DBStats struct {
+	Keys       int64            `json:"keys"`
+	Bytes      int64            `json:"bytes"`              // claves y valores, tal cual están guardados
+	FileSize   int64            `json:"fileSize,omitempty"` // tamaño en disco, si el motor lo sabe
+	PageSize   int              `json:"pageSize,omitempty"`
+	FreePages  int              `json:"freePages,omitempty"` // incluye las pendientes de liberar
+	FreeBytes  int              `json:"freeBytes,omitempty"`
+	Namespaces []NamespaceStats `json:"namespaces"`
+}
+
+// NamespaceStats describe lo que ocupa un namespace. Pages, Alloc e Inuse
+// incluyen sus namespaces anidados; Keys y Bytes, no.
+type NamespaceStats struct {
+	Namespace string `json:"namespace"`
+	Keys      int64  `json:"keys"`
+	Bytes     int64  `json:"bytes"`
+	Pages     int    `json:"pages,omitempty"`
+	Alloc     int    `json:"alloc,omitempty"` // bytes reservados en sus páginas
+	Inuse     int    `json:"inuse,omitempty"` // bytes usados de verdad
+}
+
+// Message es un mensaje del buzón de un usuario.
+type Message struct {
+	ID   string    `json:"id"` // para deleteMessage
+	From string    `json:"from"`
+	Time time.Time `json:"time"`
+	Body string    `json:"body"`
+}
+
+// FileInfo describe un fichero subido por trozos.
+type FileInfo struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`               // bytes del fichero entero
+	Hash     string `json:"hash"`               // SHA-256 del fichero entero, en hexadecimal
+	Chunks   int    `json:"chunks"`             // número de trozos
+	Complete bool   `json:"complete,omitempty"` // han llegado todos los trozos y el hash es correcto
+}
+
+// ShareKey es la clave pública de compartición (X25519) de un usuario,
+// firmada con su clave de firma (ver crypto.SignShareKey). Las dos, en
+// base64.
+type ShareKey struct {
+	Key       string `json:"key"`
+	Signature string `json:"signature"`
+}
+
+// PublicKeys son las claves públicas de un usuario en el directorio, en
+// base64.
+type PublicKeys struct {
+	Signing     string    `json:"signing"`               // Ed25519: la de firma de la cuenta
+	Encryption  string    `json:"encryption"`            // X25519: para cifrar para el usuario (ver crypto.WrapShareKey)
+	Signature   string    `json:"signature"`             // firma de Encryption con Signing (ver crypto.SignShareKey)
+	Fingerprint string    `json:"fingerprint,omitempty"` // huella de Signing, en getKey; el cliente tiene que calcularla él
+	Updated     time.Time `json:"updated"`               // cuándo se publicó Encryption, en getKey (cero si no consta)
+}
+
+// ServerInfo es la información del servidor de serverInfo.
+type ServerInfo struct {
+	Version       string    `json:"version"`       // versión del servidor (ver server.Version)
+	Started       time.Time `json:"started"`       // cuándo arrancó
+	Uptime        int64     `json:"uptime"`        // segundos desde Started
+	MinAPIVersion int       `json:"minApiVersion"` // versiones del protocolo que acepta, de ésta...
+	MaxAPIVersion int       `json:"maxApiVersion"` // ...a ésta (ver CurrentAPIVersion)
+	Features      []string  `json:"features"`      // funciones activas (Feature*), por orden alfabético
+}
+
+// Funciones del servidor (ServerInfo.Features). Las que no dependen de la
+// configuración están siempre.
+const (
+	Feature2FA      = "2fa"      // TOTP y códigos de recuperación (enable2FA)
+	FeatureCSRF     = "csrf"     // token CSRF obligatorio por HTTP (PRAC_ENABLE_CSRF, ver CSRFHeader)
+	FeatureE2E      = "e2e"      // cifrado de extremo a extremo: mensajes, grupos, compartir y directorio de claves
+	FeatureGRPC     = "grpc"     // servicio gRPC (PRAC_GRPC_ADDR)
+	FeatureMTLS     = "mtls"     // certificados de cliente y certLogin (PRAC_MTLS)
+	FeatureOPAQUE   = "opaque"   // registro y login OPAQUE (PRAC_ENABLE_OPAQUE)
+	FeatureSRP      = "srp"      // login SRP-6a
+	FeatureTLS      = "tls"      // HTTPS
+	FeatureWebAuthn = "webauthn" // passkeys y llaves FIDO2
+)
+
+// SharedItem es un fichero que otro usuario ha compartido con el de la
+// sesión.
+type SharedItem struct {
+	Owner string    `json:"owner"`
+	File  string    `json:"file"`
+	Key   string    `json:"key"` // clave del fichero envuelta para el usuario (base64)
+	Time  time.Time `json:"time"`
+}
+
+// Group describe un grupo de usuarios.
+type Group struct {
+	Name    string   `json:"name"`
+	Owner   string   `json:"owner"`
+	Members []string `json:"members"` // incluye al dueño
+}
+
+// UserInfo describe una cuenta registrada.
+type UserInfo struct {
+	Username        string    `json:"username"`
+	Created         time.Time `json:"created"`         // cero si se registró antes de guardarse la fecha
+	LastLogin       time.Time `json:"lastLogin"`       // cero si no consta ninguno (el historial caduca)
+	Method          string    `json:"method"`          // credencial de la cuenta: "password", "srp" u "opaque"
+	PasswordExpired bool      `json:"passwordExpired"` // no puede seguir hasta cambiar la contraseña (ver MustChangePassword)
+	Locked          bool      `json:"locked"`          // se rechazan sus inicios de sesión por haber agotado los intentos (ErrRateLimited)
+}
+
+// LoginRecord describe un inicio de sesión.
+type LoginRecord struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"` // acción con la que se abrió la sesión (login, srpVerify...)
+}
+
+// SessionInfo describe una sesión abierta del usuario.
+type SessionInfo struct {
+	Device   string    `json:"device"` // equipo o cliente, según su User-Agent
+	IP       string    `json:"ip"`     // desde la que se abrió
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"lastSeen"`          // última petición (con un minuto de margen)
+	Current  bool      `json:"current,omitempty"` // es la de la petición
+}
+
+// DataVersion describe una versión guardada de los datos del usuario.
+type DataVersion struct {
+	Version uint64    `json:"version"`
+	Time    time.Time `json:"time"` // cero si se guardó antes de haber historial
+	Size    int       `json:"size"`
+}
+
+// SRPParams transporta los valores del protocolo SRP-6a (todos en base64).
+// Cada acción sólo rellena los campos que le corresponden.
+type SRPParams struct {
+	Salt     string `json:"salt,omitempty"`
+	Verifier string `json:"verifier,omitempty"`
+	A        string `json:"a,omitempty"`
+	B        string `json:"b,omitempty"`
+	M1       string `json:"m1,omitempty"`
+	M2       string `json:"m2,omitempty"`
 }
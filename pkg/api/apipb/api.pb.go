@@ -0,0 +1,1897 @@
+// Contrato de la API en protobuf, para el servicio gRPC que el servidor
+// ofrece junto a la API JSON. Los mensajes son los de pkg/api, campo a
+// campo (ver convert.go); si se añade un campo allí, hay que añadirlo aquí
+// y volver a generar con "go generate ./pkg/api/apipb".
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: api.proto
+
+package apipb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Request es api.Request.
+type Request struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Action        string                 `protobuf:"bytes,1,opt,name=action,proto3" json:"action,omitempty"`
+	Username      string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	Password      string                 `protobuf:"bytes,3,opt,name=password,proto3" json:"password,omitempty"`
+	Token         string                 `protobuf:"bytes,4,opt,name=token,proto3" json:"token,omitempty"`
+	Data          string                 `protobuf:"bytes,5,opt,name=data,proto3" json:"data,omitempty"`
+	Code          string                 `protobuf:"bytes,6,opt,name=code,proto3" json:"code,omitempty"`
+	NewPassword   string                 `protobuf:"bytes,7,opt,name=new_password,json=newPassword,proto3" json:"new_password,omitempty"`
+	DataKey       string                 `protobuf:"bytes,8,opt,name=data_key,json=dataKey,proto3" json:"data_key,omitempty"`
+	PublicKey     string                 `protobuf:"bytes,9,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	Signature     string                 `protobuf:"bytes,10,opt,name=signature,proto3" json:"signature,omitempty"`
+	Srp           *SRPParams             `protobuf:"bytes,11,opt,name=srp,proto3" json:"srp,omitempty"`
+	Sealed        bool                   `protobuf:"varint,12,opt,name=sealed,proto3" json:"sealed,omitempty"`
+	Format        string                 `protobuf:"bytes,13,opt,name=format,proto3" json:"format,omitempty"`
+	Version       uint64                 `protobuf:"varint,14,opt,name=version,proto3" json:"version,omitempty"`
+	Expected      *string                `protobuf:"bytes,15,opt,name=expected,proto3,oneof" json:"expected,omitempty"`
+	Payload       []byte                 `protobuf:"bytes,16,opt,name=payload,proto3" json:"payload,omitempty"`                          // JSON del payload de la acción (api.Request.Payload)
+	ApiVersion    int32                  `protobuf:"varint,17,opt,name=api_version,json=apiVersion,proto3" json:"api_version,omitempty"` // versión del protocolo (api.CurrentAPIVersion)
+	Limit         int32                  `protobuf:"varint,18,opt,name=limit,proto3" json:"limit,omitempty"`
+	Cursor        string                 `protobuf:"bytes,19,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	To            string                 `protobuf:"bytes,20,opt,name=to,proto3" json:"to,omitempty"`
+	Group         string                 `protobuf:"bytes,21,opt,name=group,proto3" json:"group,omitempty"`
+	Member        string                 `protobuf:"bytes,22,opt,name=member,proto3" json:"member,omitempty"`
+	File          *FileInfo              `protobuf:"bytes,23,opt,name=file,proto3" json:"file,omitempty"`
+	Chunk         int32                  `protobuf:"varint,24,opt,name=chunk,proto3" json:"chunk,omitempty"`
+	Owner         string                 `protobuf:"bytes,25,opt,name=owner,proto3" json:"owner,omitempty"`
+	ShareKey      *ShareKey              `protobuf:"bytes,26,opt,name=share_key,json=shareKey,proto3" json:"share_key,omitempty"`
+	RefreshToken  string                 `protobuf:"bytes,27,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
+	Keys          *PublicKeys            `protobuf:"bytes,28,opt,name=keys,proto3" json:"keys,omitempty"`
+	Prefix        string                 `protobuf:"bytes,29,opt,name=prefix,proto3" json:"prefix,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Request) Reset() {
+	*x = Request{}
+	mi := &file_api_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Request) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Request) ProtoMessage() {}
+
+func (x *Request) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Request.ProtoReflect.Descriptor instead.
+func (*Request) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Request) GetAction() string {
+	if x != nil {
+		return x.Action
+	}
+	return ""
+}
+
+func (x *Request) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *Request) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+func (x *Request) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Request) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+func (x *Request) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Request) GetNewPassword() string {
+	if x != nil {
+		return x.NewPassword
+	}
+	return ""
+}
+
+func (x *Request) GetDataKey() string {
+	if x != nil {
+		return x.DataKey
+	}
+	return ""
+}
+
+func (x *Request) GetPublicKey() string {
+	if x != nil {
+		return x.PublicKey
+	}
+	return ""
+}
+
+func (x *Request) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *Request) GetSrp() *SRPParams {
+	if x != nil {
+		return x.Srp
+	}
+	return nil
+}
+
+func (x *Request) GetSealed() bool {
+	if x != nil {
+		return x.Sealed
+	}
+	return false
+}
+
+func (x *Request) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *Request) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Request) GetExpected() string {
+	if x != nil && x.Expected != nil {
+		return *x.Expected
+	}
+	return ""
+}
+
+func (x *Request) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Request) GetApiVersion() int32 {
+	if x != nil {
+		return x.ApiVersion
+	}
+	return 0
+}
+
+func (x *Request) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *Request) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *Request) GetTo() string {
+	if x != nil {
+		return x.To
+	}
+	return ""
+}
+
+func (x *Request) GetGroup() string {
+	if x != nil {
+		return x.Group
+	}
+	return ""
+}
+
+func (x *Request) GetMember() string {
+	if x != nil {
+		return x.Member
+	}
+	return ""
+}
+
+func (x *Request) GetFile() *FileInfo {
+	if x != nil {
+		return x.File
+	}
+	return nil
+}
+
+func (x *Request) GetChunk() int32 {
+	if x != nil {
+		return x.Chunk
+	}
+	return 0
+}
+
+func (x *Request) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Request) GetShareKey() *ShareKey {
+	if x != nil {
+		return x.ShareKey
+	}
+	return nil
+}
+
+func (x *Request) GetRefreshToken() string {
+	if x != nil {
+		return x.RefreshToken
+	}
+	return ""
+}
+
+func (x *Request) GetKeys() *PublicKeys {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *Request) GetPrefix() string {
+	if x != nil {
+		return x.Prefix
+	}
+	return ""
+}
+
+// Response es api.Response.
+type Response struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	Success            bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
+	Message            string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Token              string                 `protobuf:"bytes,3,opt,name=token,proto3" json:"token,omitempty"`
+	Data               string                 `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	TwoFactorRequired  bool                   `protobuf:"varint,5,opt,name=two_factor_required,json=twoFactorRequired,proto3" json:"two_factor_required,omitempty"`
+	RecoveryCodes      []string               `protobuf:"bytes,6,rep,name=recovery_codes,json=recoveryCodes,proto3" json:"recovery_codes,omitempty"`
+	MustChangePassword bool                   `protobuf:"varint,7,opt,name=must_change_password,json=mustChangePassword,proto3" json:"must_change_password,omitempty"`
+	PublicKey          string                 `protobuf:"bytes,8,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	Signature          string                 `protobuf:"bytes,9,opt,name=signature,proto3" json:"signature,omitempty"`
+	Srp                *SRPParams             `protobuf:"bytes,10,opt,name=srp,proto3" json:"srp,omitempty"`
+	SessionKey         string                 `protobuf:"bytes,11,opt,name=session_key,json=sessionKey,proto3" json:"session_key,omitempty"`
+	DataKey            string                 `protobuf:"bytes,12,opt,name=data_key,json=dataKey,proto3" json:"data_key,omitempty"`
+	Sealed             bool                   `protobuf:"varint,13,opt,name=sealed,proto3" json:"sealed,omitempty"`
+	Format             string                 `protobuf:"bytes,14,opt,name=format,proto3" json:"format,omitempty"`
+	Versions           []*DataVersion         `protobuf:"bytes,15,rep,name=versions,proto3" json:"versions,omitempty"`
+	Logins             []*LoginRecord         `protobuf:"bytes,16,rep,name=logins,proto3" json:"logins,omitempty"`
+	Stats              *DBStats               `protobuf:"bytes,17,opt,name=stats,proto3" json:"stats,omitempty"`
+	Code               string                 `protobuf:"bytes,18,opt,name=code,proto3" json:"code,omitempty"`                                // api.ErrorCode
+	Payload            []byte                 `protobuf:"bytes,19,opt,name=payload,proto3" json:"payload,omitempty"`                          // JSON del payload de la acción (api.Response.Payload)
+	ApiVersion         int32                  `protobuf:"varint,20,opt,name=api_version,json=apiVersion,proto3" json:"api_version,omitempty"` // versión con la que se ha atendido la petición
+	RequestId          string                 `protobuf:"bytes,21,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`     // api.Response.RequestID
+	NextCursor         string                 `protobuf:"bytes,22,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+	Users              []*UserInfo            `protobuf:"bytes,23,rep,name=users,proto3" json:"users,omitempty"`
+	Messages           []*Message             `protobuf:"bytes,24,rep,name=messages,proto3" json:"messages,omitempty"`
+	Groups             []*Group               `protobuf:"bytes,25,rep,name=groups,proto3" json:"groups,omitempty"`
+	File               *FileInfo              `protobuf:"bytes,26,opt,name=file,proto3" json:"file,omitempty"`
+	ShareKey           *ShareKey              `protobuf:"bytes,27,opt,name=share_key,json=shareKey,proto3" json:"share_key,omitempty"`
+	Shared             []*SharedItem          `protobuf:"bytes,28,rep,name=shared,proto3" json:"shared,omitempty"`
+	RefreshToken       string                 `protobuf:"bytes,29,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
+	Sessions           []*SessionInfo         `protobuf:"bytes,30,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	Keys               *PublicKeys            `protobuf:"bytes,31,opt,name=keys,proto3" json:"keys,omitempty"`
+	Server             *ServerInfo            `protobuf:"bytes,32,opt,name=server,proto3" json:"server,omitempty"`
+	RetryAfter         int32                  `protobuf:"varint,33,opt,name=retry_after,json=retryAfter,proto3" json:"retry_after,omitempty"` // segundos, con api.ErrRateLimited
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *Response) Reset() {
+	*x = Response{}
+	mi := &file_api_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Response) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Response) ProtoMessage() {}
+
+func (x *Response) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Response.ProtoReflect.Descriptor instead.
+func (*Response) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Response) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
+func (x *Response) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Response) GetToken() string {
+	if x != nil {
+		return x.Token
+	}
+	return ""
+}
+
+func (x *Response) GetData() string {
+	if x != nil {
+		return x.Data
+	}
+	return ""
+}
+
+func (x *Response) GetTwoFactorRequired() bool {
+	if x != nil {
+		return x.TwoFactorRequired
+	}
+	return false
+}
+
+func (x *Response) GetRecoveryCodes() []string {
+	if x != nil {
+		return x.RecoveryCodes
+	}
+	return nil
+}
+
+func (x *Response) GetMustChangePassword() bool {
+	if x != nil {
+		return x.MustChangePassword
+	}
+	return false
+}
+
+func (x *Response) GetPublicKey() string {
+	if x != nil {
+		return x.PublicKey
+	}
+	return ""
+}
+
+func (x *Response) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *Response) GetSrp() *SRPParams {
+	if x != nil {
+		return x.Srp
+	}
+	return nil
+}
+
+func (x *Response) GetSessionKey() string {
+	if x != nil {
+		return x.SessionKey
+	}
+	return ""
+}
+
+func (x *Response) GetDataKey() string {
+	if x != nil {
+		return x.DataKey
+	}
+	return ""
+}
+
+func (x *Response) GetSealed() bool {
+	if x != nil {
+		return x.Sealed
+	}
+	return false
+}
+
+func (x *Response) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+func (x *Response) GetVersions() []*DataVersion {
+	if x != nil {
+		return x.Versions
+	}
+	return nil
+}
+
+func (x *Response) GetLogins() []*LoginRecord {
+	if x != nil {
+		return x.Logins
+	}
+	return nil
+}
+
+func (x *Response) GetStats() *DBStats {
+	if x != nil {
+		return x.Stats
+	}
+	return nil
+}
+
+func (x *Response) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Response) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Response) GetApiVersion() int32 {
+	if x != nil {
+		return x.ApiVersion
+	}
+	return 0
+}
+
+func (x *Response) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+func (x *Response) GetNextCursor() string {
+	if x != nil {
+		return x.NextCursor
+	}
+	return ""
+}
+
+func (x *Response) GetUsers() []*UserInfo {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+func (x *Response) GetMessages() []*Message {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+func (x *Response) GetGroups() []*Group {
+	if x != nil {
+		return x.Groups
+	}
+	return nil
+}
+
+func (x *Response) GetFile() *FileInfo {
+	if x != nil {
+		return x.File
+	}
+	return nil
+}
+
+func (x *Response) GetShareKey() *ShareKey {
+	if x != nil {
+		return x.ShareKey
+	}
+	return nil
+}
+
+func (x *Response) GetShared() []*SharedItem {
+	if x != nil {
+		return x.Shared
+	}
+	return nil
+}
+
+func (x *Response) GetRefreshToken() string {
+	if x != nil {
+		return x.RefreshToken
+	}
+	return ""
+}
+
+func (x *Response) GetSessions() []*SessionInfo {
+	if x != nil {
+		return x.Sessions
+	}
+	return nil
+}
+
+func (x *Response) GetKeys() *PublicKeys {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+func (x *Response) GetServer() *ServerInfo {
+	if x != nil {
+		return x.Server
+	}
+	return nil
+}
+
+func (x *Response) GetRetryAfter() int32 {
+	if x != nil {
+		return x.RetryAfter
+	}
+	return 0
+}
+
+// SRPParams es api.SRPParams.
+type SRPParams struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Salt          string                 `protobuf:"bytes,1,opt,name=salt,proto3" json:"salt,omitempty"`
+	Verifier      string                 `protobuf:"bytes,2,opt,name=verifier,proto3" json:"verifier,omitempty"`
+	A             string                 `protobuf:"bytes,3,opt,name=a,proto3" json:"a,omitempty"`
+	B             string                 `protobuf:"bytes,4,opt,name=b,proto3" json:"b,omitempty"`
+	M1            string                 `protobuf:"bytes,5,opt,name=m1,proto3" json:"m1,omitempty"`
+	M2            string                 `protobuf:"bytes,6,opt,name=m2,proto3" json:"m2,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SRPParams) Reset() {
+	*x = SRPParams{}
+	mi := &file_api_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SRPParams) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SRPParams) ProtoMessage() {}
+
+func (x *SRPParams) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SRPParams.ProtoReflect.Descriptor instead.
+func (*SRPParams) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SRPParams) GetSalt() string {
+	if x != nil {
+		return x.Salt
+	}
+	return ""
+}
+
+func (x *SRPParams) GetVerifier() string {
+	if x != nil {
+		return x.Verifier
+	}
+	return ""
+}
+
+func (x *SRPParams) GetA() string {
+	if x != nil {
+		return x.A
+	}
+	return ""
+}
+
+func (x *SRPParams) GetB() string {
+	if x != nil {
+		return x.B
+	}
+	return ""
+}
+
+func (x *SRPParams) GetM1() string {
+	if x != nil {
+		return x.M1
+	}
+	return ""
+}
+
+func (x *SRPParams) GetM2() string {
+	if x != nil {
+		return x.M2
+	}
+	return ""
+}
+
+// DataVersion es api.DataVersion.
+type DataVersion struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       uint64                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=time,proto3" json:"time,omitempty"`
+	Size          int64                  `protobuf:"varint,3,opt,name=size,proto3" json:"size,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DataVersion) Reset() {
+	*x = DataVersion{}
+	mi := &file_api_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DataVersion) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DataVersion) ProtoMessage() {}
+
+func (x *DataVersion) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DataVersion.ProtoReflect.Descriptor instead.
+func (*DataVersion) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *DataVersion) GetVersion() uint64 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *DataVersion) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *DataVersion) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+// LoginRecord es api.LoginRecord.
+type LoginRecord struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=time,proto3" json:"time,omitempty"`
+	Method        string                 `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LoginRecord) Reset() {
+	*x = LoginRecord{}
+	mi := &file_api_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LoginRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LoginRecord) ProtoMessage() {}
+
+func (x *LoginRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LoginRecord.ProtoReflect.Descriptor instead.
+func (*LoginRecord) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *LoginRecord) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *LoginRecord) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+// SessionInfo es api.SessionInfo.
+type SessionInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Device        string                 `protobuf:"bytes,1,opt,name=device,proto3" json:"device,omitempty"`
+	Ip            string                 `protobuf:"bytes,2,opt,name=ip,proto3" json:"ip,omitempty"`
+	Created       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=created,proto3" json:"created,omitempty"`
+	LastSeen      *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	Current       bool                   `protobuf:"varint,5,opt,name=current,proto3" json:"current,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SessionInfo) Reset() {
+	*x = SessionInfo{}
+	mi := &file_api_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SessionInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionInfo) ProtoMessage() {}
+
+func (x *SessionInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionInfo.ProtoReflect.Descriptor instead.
+func (*SessionInfo) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *SessionInfo) GetDevice() string {
+	if x != nil {
+		return x.Device
+	}
+	return ""
+}
+
+func (x *SessionInfo) GetIp() string {
+	if x != nil {
+		return x.Ip
+	}
+	return ""
+}
+
+func (x *SessionInfo) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *SessionInfo) GetLastSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeen
+	}
+	return nil
+}
+
+func (x *SessionInfo) GetCurrent() bool {
+	if x != nil {
+		return x.Current
+	}
+	return false
+}
+
+// FileInfo es api.FileInfo.
+type FileInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Hash          string                 `protobuf:"bytes,3,opt,name=hash,proto3" json:"hash,omitempty"`
+	Chunks        int32                  `protobuf:"varint,4,opt,name=chunks,proto3" json:"chunks,omitempty"`
+	Complete      bool                   `protobuf:"varint,5,opt,name=complete,proto3" json:"complete,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileInfo) Reset() {
+	*x = FileInfo{}
+	mi := &file_api_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileInfo) ProtoMessage() {}
+
+func (x *FileInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileInfo.ProtoReflect.Descriptor instead.
+func (*FileInfo) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *FileInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *FileInfo) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *FileInfo) GetHash() string {
+	if x != nil {
+		return x.Hash
+	}
+	return ""
+}
+
+func (x *FileInfo) GetChunks() int32 {
+	if x != nil {
+		return x.Chunks
+	}
+	return 0
+}
+
+func (x *FileInfo) GetComplete() bool {
+	if x != nil {
+		return x.Complete
+	}
+	return false
+}
+
+// ShareKey es api.ShareKey.
+type ShareKey struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Signature     string                 `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ShareKey) Reset() {
+	*x = ShareKey{}
+	mi := &file_api_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ShareKey) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ShareKey) ProtoMessage() {}
+
+func (x *ShareKey) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ShareKey.ProtoReflect.Descriptor instead.
+func (*ShareKey) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ShareKey) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *ShareKey) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+// PublicKeys es api.PublicKeys.
+type PublicKeys struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Signing       string                 `protobuf:"bytes,1,opt,name=signing,proto3" json:"signing,omitempty"`
+	Encryption    string                 `protobuf:"bytes,2,opt,name=encryption,proto3" json:"encryption,omitempty"`
+	Signature     string                 `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	Fingerprint   string                 `protobuf:"bytes,4,opt,name=fingerprint,proto3" json:"fingerprint,omitempty"`
+	Updated       *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=updated,proto3" json:"updated,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PublicKeys) Reset() {
+	*x = PublicKeys{}
+	mi := &file_api_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PublicKeys) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublicKeys) ProtoMessage() {}
+
+func (x *PublicKeys) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublicKeys.ProtoReflect.Descriptor instead.
+func (*PublicKeys) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *PublicKeys) GetSigning() string {
+	if x != nil {
+		return x.Signing
+	}
+	return ""
+}
+
+func (x *PublicKeys) GetEncryption() string {
+	if x != nil {
+		return x.Encryption
+	}
+	return ""
+}
+
+func (x *PublicKeys) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *PublicKeys) GetFingerprint() string {
+	if x != nil {
+		return x.Fingerprint
+	}
+	return ""
+}
+
+func (x *PublicKeys) GetUpdated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Updated
+	}
+	return nil
+}
+
+// ServerInfo es api.ServerInfo.
+type ServerInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Version       string                 `protobuf:"bytes,1,opt,name=version,proto3" json:"version,omitempty"`
+	Started       *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=started,proto3" json:"started,omitempty"`
+	Uptime        int64                  `protobuf:"varint,3,opt,name=uptime,proto3" json:"uptime,omitempty"`
+	MinApiVersion int32                  `protobuf:"varint,4,opt,name=min_api_version,json=minApiVersion,proto3" json:"min_api_version,omitempty"`
+	MaxApiVersion int32                  `protobuf:"varint,5,opt,name=max_api_version,json=maxApiVersion,proto3" json:"max_api_version,omitempty"`
+	Features      []string               `protobuf:"bytes,6,rep,name=features,proto3" json:"features,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerInfo) Reset() {
+	*x = ServerInfo{}
+	mi := &file_api_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerInfo) ProtoMessage() {}
+
+func (x *ServerInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerInfo.ProtoReflect.Descriptor instead.
+func (*ServerInfo) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ServerInfo) GetVersion() string {
+	if x != nil {
+		return x.Version
+	}
+	return ""
+}
+
+func (x *ServerInfo) GetStarted() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Started
+	}
+	return nil
+}
+
+func (x *ServerInfo) GetUptime() int64 {
+	if x != nil {
+		return x.Uptime
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetMinApiVersion() int32 {
+	if x != nil {
+		return x.MinApiVersion
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetMaxApiVersion() int32 {
+	if x != nil {
+		return x.MaxApiVersion
+	}
+	return 0
+}
+
+func (x *ServerInfo) GetFeatures() []string {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+// SharedItem es api.SharedItem.
+type SharedItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Owner         string                 `protobuf:"bytes,1,opt,name=owner,proto3" json:"owner,omitempty"`
+	File          string                 `protobuf:"bytes,2,opt,name=file,proto3" json:"file,omitempty"`
+	Key           string                 `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=time,proto3" json:"time,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SharedItem) Reset() {
+	*x = SharedItem{}
+	mi := &file_api_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SharedItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SharedItem) ProtoMessage() {}
+
+func (x *SharedItem) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SharedItem.ProtoReflect.Descriptor instead.
+func (*SharedItem) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *SharedItem) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *SharedItem) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *SharedItem) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *SharedItem) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+// Group es api.Group.
+type Group struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Owner         string                 `protobuf:"bytes,2,opt,name=owner,proto3" json:"owner,omitempty"`
+	Members       []string               `protobuf:"bytes,3,rep,name=members,proto3" json:"members,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Group) Reset() {
+	*x = Group{}
+	mi := &file_api_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Group) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Group) ProtoMessage() {}
+
+func (x *Group) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Group.ProtoReflect.Descriptor instead.
+func (*Group) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Group) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Group) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Group) GetMembers() []string {
+	if x != nil {
+		return x.Members
+	}
+	return nil
+}
+
+// UserInfo es api.UserInfo.
+type UserInfo struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Username        string                 `protobuf:"bytes,1,opt,name=username,proto3" json:"username,omitempty"`
+	Created         *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=created,proto3" json:"created,omitempty"`
+	LastLogin       *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=last_login,json=lastLogin,proto3" json:"last_login,omitempty"`
+	Method          string                 `protobuf:"bytes,4,opt,name=method,proto3" json:"method,omitempty"`
+	PasswordExpired bool                   `protobuf:"varint,5,opt,name=password_expired,json=passwordExpired,proto3" json:"password_expired,omitempty"`
+	Locked          bool                   `protobuf:"varint,6,opt,name=locked,proto3" json:"locked,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *UserInfo) Reset() {
+	*x = UserInfo{}
+	mi := &file_api_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserInfo) ProtoMessage() {}
+
+func (x *UserInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserInfo.ProtoReflect.Descriptor instead.
+func (*UserInfo) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *UserInfo) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *UserInfo) GetCreated() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Created
+	}
+	return nil
+}
+
+func (x *UserInfo) GetLastLogin() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastLogin
+	}
+	return nil
+}
+
+func (x *UserInfo) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *UserInfo) GetPasswordExpired() bool {
+	if x != nil {
+		return x.PasswordExpired
+	}
+	return false
+}
+
+func (x *UserInfo) GetLocked() bool {
+	if x != nil {
+		return x.Locked
+	}
+	return false
+}
+
+// Message es api.Message.
+type Message struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	From          string                 `protobuf:"bytes,2,opt,name=from,proto3" json:"from,omitempty"`
+	Time          *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=time,proto3" json:"time,omitempty"`
+	Body          string                 `protobuf:"bytes,4,opt,name=body,proto3" json:"body,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_api_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Message) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Message) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *Message) GetTime() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Time
+	}
+	return nil
+}
+
+func (x *Message) GetBody() string {
+	if x != nil {
+		return x.Body
+	}
+	return ""
+}
+
+// DBStats es api.DBStats.
+type DBStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keys          int64                  `protobuf:"varint,1,opt,name=keys,proto3" json:"keys,omitempty"`
+	Bytes         int64                  `protobuf:"varint,2,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	FileSize      int64                  `protobuf:"varint,3,opt,name=file_size,json=fileSize,proto3" json:"file_size,omitempty"`
+	PageSize      int64                  `protobuf:"varint,4,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	FreePages     int64                  `protobuf:"varint,5,opt,name=free_pages,json=freePages,proto3" json:"free_pages,omitempty"`
+	FreeBytes     int64                  `protobuf:"varint,6,opt,name=free_bytes,json=freeBytes,proto3" json:"free_bytes,omitempty"`
+	Namespaces    []*NamespaceStats      `protobuf:"bytes,7,rep,name=namespaces,proto3" json:"namespaces,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DBStats) Reset() {
+	*x = DBStats{}
+	mi := &file_api_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DBStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DBStats) ProtoMessage() {}
+
+func (x *DBStats) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DBStats.ProtoReflect.Descriptor instead.
+func (*DBStats) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *DBStats) GetKeys() int64 {
+	if x != nil {
+		return x.Keys
+	}
+	return 0
+}
+
+func (x *DBStats) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *DBStats) GetFileSize() int64 {
+	if x != nil {
+		return x.FileSize
+	}
+	return 0
+}
+
+func (x *DBStats) GetPageSize() int64 {
+	if x != nil {
+		return x.PageSize
+	}
+	return 0
+}
+
+func (x *DBStats) GetFreePages() int64 {
+	if x != nil {
+		return x.FreePages
+	}
+	return 0
+}
+
+func (x *DBStats) GetFreeBytes() int64 {
+	if x != nil {
+		return x.FreeBytes
+	}
+	return 0
+}
+
+func (x *DBStats) GetNamespaces() []*NamespaceStats {
+	if x != nil {
+		return x.Namespaces
+	}
+	return nil
+}
+
+// NamespaceStats es api.NamespaceStats.
+type NamespaceStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Namespace     string                 `protobuf:"bytes,1,opt,name=namespace,proto3" json:"namespace,omitempty"`
+	Keys          int64                  `protobuf:"varint,2,opt,name=keys,proto3" json:"keys,omitempty"`
+	Bytes         int64                  `protobuf:"varint,3,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Pages         int64                  `protobuf:"varint,4,opt,name=pages,proto3" json:"pages,omitempty"`
+	Alloc         int64                  `protobuf:"varint,5,opt,name=alloc,proto3" json:"alloc,omitempty"`
+	Inuse         int64                  `protobuf:"varint,6,opt,name=inuse,proto3" json:"inuse,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NamespaceStats) Reset() {
+	*x = NamespaceStats{}
+	mi := &file_api_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NamespaceStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NamespaceStats) ProtoMessage() {}
+
+func (x *NamespaceStats) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NamespaceStats.ProtoReflect.Descriptor instead.
+func (*NamespaceStats) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *NamespaceStats) GetNamespace() string {
+	if x != nil {
+		return x.Namespace
+	}
+	return ""
+}
+
+func (x *NamespaceStats) GetKeys() int64 {
+	if x != nil {
+		return x.Keys
+	}
+	return 0
+}
+
+func (x *NamespaceStats) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *NamespaceStats) GetPages() int64 {
+	if x != nil {
+		return x.Pages
+	}
+	return 0
+}
+
+func (x *NamespaceStats) GetAlloc() int64 {
+	if x != nil {
+		return x.Alloc
+	}
+	return 0
+}
+
+func (x *NamespaceStats) GetInuse() int64 {
+	if x != nil {
+		return x.Inuse
+	}
+	return 0
+}
+
+var File_api_proto protoreflect.FileDescriptor
+
+const file_api_proto_rawDesc = "" +
+	"\n" +
+	"\tapi.proto\x12\bprac.api\x1a\x1fgoogle/protobuf/timestamp.proto\"\xc4\x06\n" +
+	"\aRequest\x12\x16\n" +
+	"\x06action\x18\x01 \x01(\tR\x06action\x12\x1a\n" +
+	"\busername\x18\x02 \x01(\tR\busername\x12\x1a\n" +
+	"\bpassword\x18\x03 \x01(\tR\bpassword\x12\x14\n" +
+	"\x05token\x18\x04 \x01(\tR\x05token\x12\x12\n" +
+	"\x04data\x18\x05 \x01(\tR\x04data\x12\x12\n" +
+	"\x04code\x18\x06 \x01(\tR\x04code\x12!\n" +
+	"\fnew_password\x18\a \x01(\tR\vnewPassword\x12\x19\n" +
+	"\bdata_key\x18\b \x01(\tR\adataKey\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\t \x01(\tR\tpublicKey\x12\x1c\n" +
+	"\tsignature\x18\n" +
+	" \x01(\tR\tsignature\x12%\n" +
+	"\x03srp\x18\v \x01(\v2\x13.prac.api.SRPParamsR\x03srp\x12\x16\n" +
+	"\x06sealed\x18\f \x01(\bR\x06sealed\x12\x16\n" +
+	"\x06format\x18\r \x01(\tR\x06format\x12\x18\n" +
+	"\aversion\x18\x0e \x01(\x04R\aversion\x12\x1f\n" +
+	"\bexpected\x18\x0f \x01(\tH\x00R\bexpected\x88\x01\x01\x12\x18\n" +
+	"\apayload\x18\x10 \x01(\fR\apayload\x12\x1f\n" +
+	"\vapi_version\x18\x11 \x01(\x05R\n" +
+	"apiVersion\x12\x14\n" +
+	"\x05limit\x18\x12 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06cursor\x18\x13 \x01(\tR\x06cursor\x12\x0e\n" +
+	"\x02to\x18\x14 \x01(\tR\x02to\x12\x14\n" +
+	"\x05group\x18\x15 \x01(\tR\x05group\x12\x16\n" +
+	"\x06member\x18\x16 \x01(\tR\x06member\x12&\n" +
+	"\x04file\x18\x17 \x01(\v2\x12.prac.api.FileInfoR\x04file\x12\x14\n" +
+	"\x05chunk\x18\x18 \x01(\x05R\x05chunk\x12\x14\n" +
+	"\x05owner\x18\x19 \x01(\tR\x05owner\x12/\n" +
+	"\tshare_key\x18\x1a \x01(\v2\x12.prac.api.ShareKeyR\bshareKey\x12#\n" +
+	"\rrefresh_token\x18\x1b \x01(\tR\frefreshToken\x12(\n" +
+	"\x04keys\x18\x1c \x01(\v2\x14.prac.api.PublicKeysR\x04keys\x12\x16\n" +
+	"\x06prefix\x18\x1d \x01(\tR\x06prefixB\v\n" +
+	"\t_expected\"\xb5\t\n" +
+	"\bResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x14\n" +
+	"\x05token\x18\x03 \x01(\tR\x05token\x12\x12\n" +
+	"\x04data\x18\x04 \x01(\tR\x04data\x12.\n" +
+	"\x13two_factor_required\x18\x05 \x01(\bR\x11twoFactorRequired\x12%\n" +
+	"\x0erecovery_codes\x18\x06 \x03(\tR\rrecoveryCodes\x120\n" +
+	"\x14must_change_password\x18\a \x01(\bR\x12mustChangePassword\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\b \x01(\tR\tpublicKey\x12\x1c\n" +
+	"\tsignature\x18\t \x01(\tR\tsignature\x12%\n" +
+	"\x03srp\x18\n" +
+	" \x01(\v2\x13.prac.api.SRPParamsR\x03srp\x12\x1f\n" +
+	"\vsession_key\x18\v \x01(\tR\n" +
+	"sessionKey\x12\x19\n" +
+	"\bdata_key\x18\f \x01(\tR\adataKey\x12\x16\n" +
+	"\x06sealed\x18\r \x01(\bR\x06sealed\x12\x16\n" +
+	"\x06format\x18\x0e \x01(\tR\x06format\x121\n" +
+	"\bversions\x18\x0f \x03(\v2\x15.prac.api.DataVersionR\bversions\x12-\n" +
+	"\x06logins\x18\x10 \x03(\v2\x15.prac.api.LoginRecordR\x06logins\x12'\n" +
+	"\x05stats\x18\x11 \x01(\v2\x11.prac.api.DBStatsR\x05stats\x12\x12\n" +
+	"\x04code\x18\x12 \x01(\tR\x04code\x12\x18\n" +
+	"\apayload\x18\x13 \x01(\fR\apayload\x12\x1f\n" +
+	"\vapi_version\x18\x14 \x01(\x05R\n" +
+	"apiVersion\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x15 \x01(\tR\trequestId\x12\x1f\n" +
+	"\vnext_cursor\x18\x16 \x01(\tR\n" +
+	"nextCursor\x12(\n" +
+	"\x05users\x18\x17 \x03(\v2\x12.prac.api.UserInfoR\x05users\x12-\n" +
+	"\bmessages\x18\x18 \x03(\v2\x11.prac.api.MessageR\bmessages\x12'\n" +
+	"\x06groups\x18\x19 \x03(\v2\x0f.prac.api.GroupR\x06groups\x12&\n" +
+	"\x04file\x18\x1a \x01(\v2\x12.prac.api.FileInfoR\x04file\x12/\n" +
+	"\tshare_key\x18\x1b \x01(\v2\x12.prac.api.ShareKeyR\bshareKey\x12,\n" +
+	"\x06shared\x18\x1c \x03(\v2\x14.prac.api.SharedItemR\x06shared\x12#\n" +
+	"\rrefresh_token\x18\x1d \x01(\tR\frefreshToken\x121\n" +
+	"\bsessions\x18\x1e \x03(\v2\x15.prac.api.SessionInfoR\bsessions\x12(\n" +
+	"\x04keys\x18\x1f \x01(\v2\x14.prac.api.PublicKeysR\x04keys\x12,\n" +
+	"\x06server\x18  \x01(\v2\x14.prac.api.ServerInfoR\x06server\x12\x1f\n" +
+	"\vretry_after\x18! \x01(\x05R\n" +
+	"retryAfter\"w\n" +
+	"\tSRPParams\x12\x12\n" +
+	"\x04salt\x18\x01 \x01(\tR\x04salt\x12\x1a\n" +
+	"\bverifier\x18\x02 \x01(\tR\bverifier\x12\f\n" +
+	"\x01a\x18\x03 \x01(\tR\x01a\x12\f\n" +
+	"\x01b\x18\x04 \x01(\tR\x01b\x12\x0e\n" +
+	"\x02m1\x18\x05 \x01(\tR\x02m1\x12\x0e\n" +
+	"\x02m2\x18\x06 \x01(\tR\x02m2\"k\n" +
+	"\vDataVersion\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\x04R\aversion\x12.\n" +
+	"\x04time\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x12\n" +
+	"\x04size\x18\x03 \x01(\x03R\x04size\"U\n" +
+	"\vLoginRecord\x12.\n" +
+	"\x04time\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x16\n" +
+	"\x06method\x18\x02 \x01(\tR\x06method\"\xbe\x01\n" +
+	"\vSessionInfo\x12\x16\n" +
+	"\x06device\x18\x01 \x01(\tR\x06device\x12\x0e\n" +
+	"\x02ip\x18\x02 \x01(\tR\x02ip\x124\n" +
+	"\acreated\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x127\n" +
+	"\tlast_seen\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\blastSeen\x12\x18\n" +
+	"\acurrent\x18\x05 \x01(\bR\acurrent\"z\n" +
+	"\bFileInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x12\n" +
+	"\x04hash\x18\x03 \x01(\tR\x04hash\x12\x16\n" +
+	"\x06chunks\x18\x04 \x01(\x05R\x06chunks\x12\x1a\n" +
+	"\bcomplete\x18\x05 \x01(\bR\bcomplete\":\n" +
+	"\bShareKey\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1c\n" +
+	"\tsignature\x18\x02 \x01(\tR\tsignature\"\xbc\x01\n" +
+	"\n" +
+	"PublicKeys\x12\x18\n" +
+	"\asigning\x18\x01 \x01(\tR\asigning\x12\x1e\n" +
+	"\n" +
+	"encryption\x18\x02 \x01(\tR\n" +
+	"encryption\x12\x1c\n" +
+	"\tsignature\x18\x03 \x01(\tR\tsignature\x12 \n" +
+	"\vfingerprint\x18\x04 \x01(\tR\vfingerprint\x124\n" +
+	"\aupdated\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\aupdated\"\xe0\x01\n" +
+	"\n" +
+	"ServerInfo\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\tR\aversion\x124\n" +
+	"\astarted\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\astarted\x12\x16\n" +
+	"\x06uptime\x18\x03 \x01(\x03R\x06uptime\x12&\n" +
+	"\x0fmin_api_version\x18\x04 \x01(\x05R\rminApiVersion\x12&\n" +
+	"\x0fmax_api_version\x18\x05 \x01(\x05R\rmaxApiVersion\x12\x1a\n" +
+	"\bfeatures\x18\x06 \x03(\tR\bfeatures\"x\n" +
+	"\n" +
+	"SharedItem\x12\x14\n" +
+	"\x05owner\x18\x01 \x01(\tR\x05owner\x12\x12\n" +
+	"\x04file\x18\x02 \x01(\tR\x04file\x12\x10\n" +
+	"\x03key\x18\x03 \x01(\tR\x03key\x12.\n" +
+	"\x04time\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\"K\n" +
+	"\x05Group\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05owner\x18\x02 \x01(\tR\x05owner\x12\x18\n" +
+	"\amembers\x18\x03 \x03(\tR\amembers\"\xf2\x01\n" +
+	"\bUserInfo\x12\x1a\n" +
+	"\busername\x18\x01 \x01(\tR\busername\x124\n" +
+	"\acreated\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x129\n" +
+	"\n" +
+	"last_login\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tlastLogin\x12\x16\n" +
+	"\x06method\x18\x04 \x01(\tR\x06method\x12)\n" +
+	"\x10password_expired\x18\x05 \x01(\bR\x0fpasswordExpired\x12\x16\n" +
+	"\x06locked\x18\x06 \x01(\bR\x06locked\"q\n" +
+	"\aMessage\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\tR\x04from\x12.\n" +
+	"\x04time\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\x04time\x12\x12\n" +
+	"\x04body\x18\x04 \x01(\tR\x04body\"\xe5\x01\n" +
+	"\aDBStats\x12\x12\n" +
+	"\x04keys\x18\x01 \x01(\x03R\x04keys\x12\x14\n" +
+	"\x05bytes\x18\x02 \x01(\x03R\x05bytes\x12\x1b\n" +
+	"\tfile_size\x18\x03 \x01(\x03R\bfileSize\x12\x1b\n" +
+	"\tpage_size\x18\x04 \x01(\x03R\bpageSize\x12\x1d\n" +
+	"\n" +
+	"free_pages\x18\x05 \x01(\x03R\tfreePages\x12\x1d\n" +
+	"\n" +
+	"free_bytes\x18\x06 \x01(\x03R\tfreeBytes\x128\n" +
+	"\n" +
+	"namespaces\x18\a \x03(\v2\x18.prac.api.NamespaceStatsR\n" +
+	"namespaces\"\x9a\x01\n" +
+	"\x0eNamespaceStats\x12\x1c\n" +
+	"\tnamespace\x18\x01 \x01(\tR\tnamespace\x12\x12\n" +
+	"\x04keys\x18\x02 \x01(\x03R\x04keys\x12\x14\n" +
+	"\x05bytes\x18\x03 \x01(\x03R\x05bytes\x12\x14\n" +
+	"\x05pages\x18\x04 \x01(\x03R\x05pages\x12\x14\n" +
+	"\x05alloc\x18\x05 \x01(\x03R\x05alloc\x12\x14\n" +
+	"\x05inuse\x18\x06 \x01(\x03R\x05inuse2k\n" +
+	"\x04Prac\x12-\n" +
+	"\x04Call\x12\x11.prac.api.Request\x1a\x12.prac.api.Response\x124\n" +
+	"\tWatchData\x12\x11.prac.api.Request\x1a\x12.prac.api.Response0\x01B\x14Z\x12prac/pkg/api/apipbb\x06proto3"
+
+var (
+	file_api_proto_rawDescOnce sync.Once
+	file_api_proto_rawDescData []byte
+)
+
+func file_api_proto_rawDescGZIP() []byte {
+	file_api_proto_rawDescOnce.Do(func() {
+		file_api_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_api_proto_rawDesc), len(file_api_proto_rawDesc)))
+	})
+	return file_api_proto_rawDescData
+}
+
+var file_api_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_api_proto_goTypes = []any{
+	(*Request)(nil),               // 0: prac.api.Request
+	(*Response)(nil),              // 1: prac.api.Response
+	(*SRPParams)(nil),             // 2: prac.api.SRPParams
+	(*DataVersion)(nil),           // 3: prac.api.DataVersion
+	(*LoginRecord)(nil),           // 4: prac.api.LoginRecord
+	(*SessionInfo)(nil),           // 5: prac.api.SessionInfo
+	(*FileInfo)(nil),              // 6: prac.api.FileInfo
+	(*ShareKey)(nil),              // 7: prac.api.ShareKey
+	(*PublicKeys)(nil),            // 8: prac.api.PublicKeys
+	(*ServerInfo)(nil),            // 9: prac.api.ServerInfo
+	(*SharedItem)(nil),            // 10: prac.api.SharedItem
+	(*Group)(nil),                 // 11: prac.api.Group
+	(*UserInfo)(nil),              // 12: prac.api.UserInfo
+	(*Message)(nil),               // 13: prac.api.Message
+	(*DBStats)(nil),               // 14: prac.api.DBStats
+	(*NamespaceStats)(nil),        // 15: prac.api.NamespaceStats
+	(*timestamppb.Timestamp)(nil), // 16: google.protobuf.Timestamp
+}
+var file_api_proto_depIdxs = []int32{
+	2,  // 0: prac.api.Request.srp:type_name -> prac.api.SRPParams
+	6,  // 1: prac.api.Request.file:type_name -> prac.api.FileInfo
+	7,  // 2: prac.api.Request.share_key:type_name -> prac.api.ShareKey
+	8,  // 3: prac.api.Request.keys:type_name -> prac.api.PublicKeys
+	2,  // 4: prac.api.Response.srp:type_name -> prac.api.SRPParams
+	3,  // 5: prac.api.Response.versions:type_name -> prac.api.DataVersion
+	4,  // 6: prac.api.Response.logins:type_name -> prac.api.LoginRecord
+	14, // 7: prac.api.Response.stats:type_name -> prac.api.DBStats
+	12, // 8: prac.api.Response.users:type_name -> prac.api.UserInfo
+	13, // 9: prac.api.Response.messages:type_name -> prac.api.Message
+	11, // 10: prac.api.Response.groups:type_name -> prac.api.Group
+	6,  // 11: prac.api.Response.file:type_name -> prac.api.FileInfo
+	7,  // 12: prac.api.Response.share_key:type_name -> prac.api.ShareKey
+	10, // 13: prac.api.Response.shared:type_name -> prac.api.SharedItem
+	5,  // 14: prac.api.Response.sessions:type_name -> prac.api.SessionInfo
+	8,  // 15: prac.api.Response.keys:type_name -> prac.api.PublicKeys
+	9,  // 16: prac.api.Response.server:type_name -> prac.api.ServerInfo
+	16, // 17: prac.api.DataVersion.time:type_name -> google.protobuf.Timestamp
+	16, // 18: prac.api.LoginRecord.time:type_name -> google.protobuf.Timestamp
+	16, // 19: prac.api.SessionInfo.created:type_name -> google.protobuf.Timestamp
+	16, // 20: prac.api.SessionInfo.last_seen:type_name -> google.protobuf.Timestamp
+	16, // 21: prac.api.PublicKeys.updated:type_name -> google.protobuf.Timestamp
+	16, // 22: prac.api.ServerInfo.started:type_name -> google.protobuf.Timestamp
+	16, // 23: prac.api.SharedItem.time:type_name -> google.protobuf.Timestamp
+	16, // 24: prac.api.UserInfo.created:type_name -> google.protobuf.Timestamp
+	16, // 25: prac.api.UserInfo.last_login:type_name -> google.protobuf.Timestamp
+	16, // 26: prac.api.Message.time:type_name -> google.protobuf.Timestamp
+	15, // 27: prac.api.DBStats.namespaces:type_name -> prac.api.NamespaceStats
+	0,  // 28: prac.api.Prac.Call:input_type -> prac.api.Request
+	0,  // 29: prac.api.Prac.WatchData:input_type -> prac.api.Request
+	1,  // 30: prac.api.Prac.Call:output_type -> prac.api.Response
+	1,  // 31: prac.api.Prac.WatchData:output_type -> prac.api.Response
+	30, // [30:32] is the sub-list for method output_type
+	28, // [28:30] is the sub-list for method input_type
+	28, // [28:28] is the sub-list for extension type_name
+	28, // [28:28] is the sub-list for extension extendee
+	0,  // [0:28] is the sub-list for field type_name
+}
+
+func init() { file_api_proto_init() }
+func file_api_proto_init() {
+	if File_api_proto != nil {
+		return
+	}
+	file_api_proto_msgTypes[0].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_proto_rawDesc), len(file_api_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_api_proto_goTypes,
+		DependencyIndexes: file_api_proto_depIdxs,
+		MessageInfos:      file_api_proto_msgTypes,
+	}.Build()
+	File_api_proto = out.File
+	file_api_proto_goTypes = nil
+	file_api_proto_depIdxs = nil
+}
@@ -0,0 +1,180 @@
+// Contrato de la API en protobuf, para el servicio gRPC que el servidor
+// ofrece junto a la API JSON. Los mensajes son los de pkg/api, campo a
+// campo (ver convert.go); si se añade un campo allí, hay que añadirlo aquí
+// y volver a generar con "go generate ./pkg/api/apipb".
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: api.proto
+
+package apipb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Prac_Call_FullMethodName      = "/prac.api.Prac/Call"
+	Prac_WatchData_FullMethodName = "/prac.api.Prac/WatchData"
+)
+
+// PracClient is the client API for Prac service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Prac es el servicio gRPC del servidor.
+type PracClient interface {
+	// Call ejecuta una acción, igual que un POST a /api.
+	Call(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error)
+	// WatchData es waitData sin esperas ni repeticiones: envía una Response
+	// cada vez que cambian los datos del usuario, hasta que el cliente corta.
+	// La Request necesita sesión (Username y Token).
+	WatchData(ctx context.Context, in *Request, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Response], error)
+}
+
+type pracClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPracClient(cc grpc.ClientConnInterface) PracClient {
+	return &pracClient{cc}
+}
+
+func (c *pracClient) Call(ctx context.Context, in *Request, opts ...grpc.CallOption) (*Response, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Response)
+	err := c.cc.Invoke(ctx, Prac_Call_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pracClient) WatchData(ctx context.Context, in *Request, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Response], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Prac_ServiceDesc.Streams[0], Prac_WatchData_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Request, Response]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Prac_WatchDataClient = grpc.ServerStreamingClient[Response]
+
+// PracServer is the server API for Prac service.
+// All implementations must embed UnimplementedPracServer
+// for forward compatibility.
+//
+// Prac es el servicio gRPC del servidor.
+type PracServer interface {
+	// Call ejecuta una acción, igual que un POST a /api.
+	Call(context.Context, *Request) (*Response, error)
+	// WatchData es waitData sin esperas ni repeticiones: envía una Response
+	// cada vez que cambian los datos del usuario, hasta que el cliente corta.
+	// La Request necesita sesión (Username y Token).
+	WatchData(*Request, grpc.ServerStreamingServer[Response]) error
+	mustEmbedUnimplementedPracServer()
+}
+
+// UnimplementedPracServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPracServer struct{}
+
+func (UnimplementedPracServer) Call(context.Context, *Request) (*Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Call not implemented")
+}
+func (UnimplementedPracServer) WatchData(*Request, grpc.ServerStreamingServer[Response]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchData not implemented")
+}
+func (UnimplementedPracServer) mustEmbedUnimplementedPracServer() {}
+func (UnimplementedPracServer) testEmbeddedByValue()              {}
+
+// UnsafePracServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PracServer will
+// result in compilation errors.
+type UnsafePracServer interface {
+	mustEmbedUnimplementedPracServer()
+}
+
+func RegisterPracServer(s grpc.ServiceRegistrar, srv PracServer) {
+	// If the following call pancis, it indicates UnimplementedPracServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Prac_ServiceDesc, srv)
+}
+
+func _Prac_Call_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PracServer).Call(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Prac_Call_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PracServer).Call(ctx, req.(*Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Prac_WatchData_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Request)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(PracServer).WatchData(m, &grpc.GenericServerStream[Request, Response]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Prac_WatchDataServer = grpc.ServerStreamingServer[Response]
+
+// Prac_ServiceDesc is the grpc.ServiceDesc for Prac service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Prac_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "prac.api.Prac",
+	HandlerType: (*PracServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Call",
+			Handler:    _Prac_Call_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchData",
+			Handler:       _Prac_WatchData_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "api.proto",
+}
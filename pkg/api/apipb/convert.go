@@ -0,0 +1,351 @@
+package apipb
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"prac/pkg/api"
+)
+
+// FromRequest pasa 'req' a protobuf.
+func FromRequest(req api.Request) *Request {
+	return &Request{
+		ApiVersion:   int32(req.APIVersion),
+		Action:       req.Action,
+		Username:     req.Username,
+		Password:     req.Password,
+		Token:        req.Token,
+		Data:         req.Data,
+		Code:         req.Code,
+		NewPassword:  req.NewPassword,
+		DataKey:      req.DataKey,
+		PublicKey:    req.PublicKey,
+		Signature:    req.Signature,
+		Srp:          fromSRP(req.SRP),
+		Sealed:       req.Sealed,
+		Format:       req.Format,
+		Version:      req.Version,
+		Expected:     req.Expected,
+		Payload:      req.Payload,
+		Limit:        int32(req.Limit),
+		Cursor:       req.Cursor,
+		Prefix:       req.Prefix,
+		To:           req.To,
+		Group:        req.Group,
+		Member:       req.Member,
+		File:         fromFile(req.File),
+		Chunk:        int32(req.Chunk),
+		Owner:        req.Owner,
+		ShareKey:     fromShareKey(req.ShareKey),
+		Keys:         fromKeys(req.Keys),
+		RefreshToken: req.RefreshToken,
+	}
+}
+
+// API devuelve la api.Request de 'r'.
+func (r *Request) API() api.Request {
+	return api.Request{
+		APIVersion:   int(r.GetApiVersion()),
+		Action:       r.GetAction(),
+		Username:     r.GetUsername(),
+		Password:     r.GetPassword(),
+		Token:        r.GetToken(),
+		Data:         r.GetData(),
+		Code:         r.GetCode(),
+		NewPassword:  r.GetNewPassword(),
+		DataKey:      r.GetDataKey(),
+		PublicKey:    r.GetPublicKey(),
+		Signature:    r.GetSignature(),
+		SRP:          r.GetSrp().api(),
+		Sealed:       r.GetSealed(),
+		Format:       r.GetFormat(),
+		Version:      r.GetVersion(),
+		Expected:     r.Expected,
+		Payload:      r.GetPayload(),
+		Limit:        int(r.GetLimit()),
+		Cursor:       r.GetCursor(),
+		Prefix:       r.GetPrefix(),
+		To:           r.GetTo(),
+		Group:        r.GetGroup(),
+		Member:       r.GetMember(),
+		File:         r.GetFile().api(),
+		Chunk:        int(r.GetChunk()),
+		Owner:        r.GetOwner(),
+		ShareKey:     r.GetShareKey().api(),
+		Keys:         r.GetKeys().api(),
+		RefreshToken: r.GetRefreshToken(),
+	}
+}
+
+// FromResponse pasa 'res' a protobuf.
+func FromResponse(res api.Response) *Response {
+	out := &Response{
+		ApiVersion:         int32(res.APIVersion),
+		Success:            res.Success,
+		Code:               string(res.Code),
+		Message:            res.Message,
+		Token:              res.Token,
+		Data:               res.Data,
+		TwoFactorRequired:  res.TwoFactorRequired,
+		RecoveryCodes:      res.RecoveryCodes,
+		MustChangePassword: res.MustChangePassword,
+		PublicKey:          res.PublicKey,
+		Signature:          res.Signature,
+		Srp:                fromSRP(res.SRP),
+		SessionKey:         res.SessionKey,
+		DataKey:            res.DataKey,
+		Sealed:             res.Sealed,
+		Format:             res.Format,
+		Stats:              fromStats(res.Stats),
+		Payload:            res.Payload,
+		RequestId:          res.RequestID,
+		RetryAfter:         int32(res.RetryAfter),
+		NextCursor:         res.NextCursor,
+		File:               fromFile(res.File),
+		ShareKey:           fromShareKey(res.ShareKey),
+		Keys:               fromKeys(res.Keys),
+		Server:             fromServerInfo(res.Server),
+		RefreshToken:       res.RefreshToken,
+	}
+	for _, v := range res.Versions {
+		out.Versions = append(out.Versions, &DataVersion{Version: v.Version, Time: fromTime(v.Time), Size: int64(v.Size)})
+	}
+	for _, l := range res.Logins {
+		out.Logins = append(out.Logins, &LoginRecord{Time: fromTime(l.Time), Method: l.Method})
+	}
+	for _, se := range res.Sessions {
+		out.Sessions = append(out.Sessions, &SessionInfo{Device: se.Device, Ip: se.IP, Created: fromTime(se.Created), LastSeen: fromTime(se.LastSeen), Current: se.Current})
+	}
+	for _, m := range res.Messages {
+		out.Messages = append(out.Messages, &Message{Id: m.ID, From: m.From, Time: fromTime(m.Time), Body: m.Body})
+	}
+	for _, g := range res.Groups {
+		out.Groups = append(out.Groups, &Group{Name: g.Name, Owner: g.Owner, Members: g.Members})
+	}
+	for _, sh := range res.Shared {
+		out.Shared = append(out.Shared, &SharedItem{Owner: sh.Owner, File: sh.File, Key: sh.Key, Time: fromTime(sh.Time)})
+	}
+	for _, u := range res.Users {
+		out.Users = append(out.Users, &UserInfo{
+			Username:        u.Username,
+			Created:         fromTime(u.Created),
+			LastLogin:       fromTime(u.LastLogin),
+			Method:          u.Method,
+			PasswordExpired: u.PasswordExpired,
+			Locked:          u.Locked,
+		})
+	}
+	return out
+}
+
+// API devuelve la api.Response de 'r'.
+func (r *Response) API() api.Response {
+	res := api.Response{
+		APIVersion:         int(r.GetApiVersion()),
+		Success:            r.GetSuccess(),
+		Code:               api.ErrorCode(r.GetCode()),
+		Message:            r.GetMessage(),
+		Token:              r.GetToken(),
+		Data:               r.GetData(),
+		TwoFactorRequired:  r.GetTwoFactorRequired(),
+		RecoveryCodes:      r.GetRecoveryCodes(),
+		MustChangePassword: r.GetMustChangePassword(),
+		PublicKey:          r.GetPublicKey(),
+		Signature:          r.GetSignature(),
+		SRP:                r.GetSrp().api(),
+		SessionKey:         r.GetSessionKey(),
+		DataKey:            r.GetDataKey(),
+		Sealed:             r.GetSealed(),
+		Format:             r.GetFormat(),
+		Stats:              r.GetStats().api(),
+		Payload:            r.GetPayload(),
+		RequestID:          r.GetRequestId(),
+		RetryAfter:         int(r.GetRetryAfter()),
+		NextCursor:         r.GetNextCursor(),
+		File:               r.GetFile().api(),
+		ShareKey:           r.GetShareKey().api(),
+		Keys:               r.GetKeys().api(),
+		Server:             r.GetServer().api(),
+		RefreshToken:       r.GetRefreshToken(),
+	}
+	for _, v := range r.GetVersions() {
+		res.Versions = append(res.Versions, api.DataVersion{Version: v.GetVersion(), Time: apiTime(v.GetTime()), Size: int(v.GetSize())})
+	}
+	for _, l := range r.GetLogins() {
+		res.Logins = append(res.Logins, api.LoginRecord{Time: apiTime(l.GetTime()), Method: l.GetMethod()})
+	}
+	for _, se := range r.GetSessions() {
+		res.Sessions = append(res.Sessions, api.SessionInfo{Device: se.GetDevice(), IP: se.GetIp(), Created: apiTime(se.GetCreated()), LastSeen: apiTime(se.GetLastSeen()), Current: se.GetCurrent()})
+	}
+	for _, m := range r.GetMessages() {
+		res.Messages = append(res.Messages, api.Message{ID: m.GetId(), From: m.GetFrom(), Time: apiTime(m.GetTime()), Body: m.GetBody()})
+	}
+	for _, g := range r.GetGroups() {
+		res.Groups = append(res.Groups, api.Group{Name: g.GetName(), Owner: g.GetOwner(), Members: g.GetMembers()})
+	}
+	for _, sh := range r.GetShared() {
+		res.Shared = append(res.Shared, api.SharedItem{Owner: sh.GetOwner(), File: sh.GetFile(), Key: sh.GetKey(), Time: apiTime(sh.GetTime())})
+	}
+	for _, u := range r.GetUsers() {
+		res.Users = append(res.Users, api.UserInfo{
+			Username:        u.GetUsername(),
+			Created:         apiTime(u.GetCreated()),
+			LastLogin:       apiTime(u.GetLastLogin()),
+			Method:          u.GetMethod(),
+			PasswordExpired: u.GetPasswordExpired(),
+			Locked:          u.GetLocked(),
+		})
+	}
+	return res
+}
+
+func fromSRP(p *api.SRPParams) *SRPParams {
+	if p == nil {
+		return nil
+	}
+	return &SRPParams{Salt: p.Salt, Verifier: p.Verifier, A: p.A, B: p.B, M1: p.M1, M2: p.M2}
+}
+
+func (p *SRPParams) api() *api.SRPParams {
+	if p == nil {
+		return nil
+	}
+	return &api.SRPParams{Salt: p.Salt, Verifier: p.Verifier, A: p.A, B: p.B, M1: p.M1, M2: p.M2}
+}
+
+func fromShareKey(k *api.ShareKey) *ShareKey {
+	if k == nil {
+		return nil
+	}
+	return &ShareKey{Key: k.Key, Signature: k.Signature}
+}
+
+func (k *ShareKey) api() *api.ShareKey {
+	if k == nil {
+		return nil
+	}
+	return &api.ShareKey{Key: k.Key, Signature: k.Signature}
+}
+
+func fromKeys(k *api.PublicKeys) *PublicKeys {
+	if k == nil {
+		return nil
+	}
+	return &PublicKeys{Signing: k.Signing, Encryption: k.Encryption, Signature: k.Signature, Fingerprint: k.Fingerprint, Updated: fromTime(k.Updated)}
+}
+
+func (k *PublicKeys) api() *api.PublicKeys {
+	if k == nil {
+		return nil
+	}
+	return &api.PublicKeys{Signing: k.Signing, Encryption: k.Encryption, Signature: k.Signature, Fingerprint: k.Fingerprint, Updated: apiTime(k.Updated)}
+}
+
+func fromServerInfo(i *api.ServerInfo) *ServerInfo {
+	if i == nil {
+		return nil
+	}
+	return &ServerInfo{
+		Version:       i.Version,
+		Started:       fromTime(i.Started),
+		Uptime:        i.Uptime,
+		MinApiVersion: int32(i.MinAPIVersion),
+		MaxApiVersion: int32(i.MaxAPIVersion),
+		Features:      i.Features,
+	}
+}
+
+func (i *ServerInfo) api() *api.ServerInfo {
+	if i == nil {
+		return nil
+	}
+	return &api.ServerInfo{
+		Version:       i.Version,
+		Started:       apiTime(i.Started),
+		Uptime:        i.Uptime,
+		MinAPIVersion: int(i.MinApiVersion),
+		MaxAPIVersion: int(i.MaxApiVersion),
+		Features:      i.Features,
+	}
+}
+
+func fromFile(f *api.FileInfo) *FileInfo {
+	if f == nil {
+		return nil
+	}
+	return &FileInfo{Name: f.Name, Size: f.Size, Hash: f.Hash, Chunks: int32(f.Chunks), Complete: f.Complete}
+}
+
+func (f *FileInfo) api() *api.FileInfo {
+	if f == nil {
+		return nil
+	}
+	return &api.FileInfo{Name: f.Name, Size: f.Size, Hash: f.Hash, Chunks: int(f.Chunks), Complete: f.Complete}
+}
+
+func fromStats(st *api.DBStats) *DBStats {
+	if st == nil {
+		return nil
+	}
+	out := &DBStats{
+		Keys:      st.Keys,
+		Bytes:     st.Bytes,
+		FileSize:  st.FileSize,
+		PageSize:  int64(st.PageSize),
+		FreePages: int64(st.FreePages),
+		FreeBytes: int64(st.FreeBytes),
+	}
+	for _, ns := range st.Namespaces {
+		out.Namespaces = append(out.Namespaces, &NamespaceStats{
+			Namespace: ns.Namespace,
+			Keys:      ns.Keys,
+			Bytes:     ns.Bytes,
+			Pages:     int64(ns.Pages),
+			Alloc:     int64(ns.Alloc),
+			Inuse:     int64(ns.Inuse),
+		})
+	}
+	return out
+}
+
+func (st *DBStats) api() *api.DBStats {
+	if st == nil {
+		return nil
+	}
+	out := &api.DBStats{
+		Keys:      st.Keys,
+		Bytes:     st.Bytes,
+		FileSize:  st.FileSize,
+		PageSize:  int(st.PageSize),
+		FreePages: int(st.FreePages),
+		FreeBytes: int(st.FreeBytes),
+	}
+	for _, ns := range st.Namespaces {
+		out.Namespaces = append(out.Namespaces, api.NamespaceStats{
+			Namespace: ns.Namespace,
+			Keys:      ns.Keys,
+			Bytes:     ns.Bytes,
+			Pages:     int(ns.Pages),
+			Alloc:     int(ns.Alloc),
+			Inuse:     int(ns.Inuse),
+		})
+	}
+	return out
+}
+
+// fromTime deja sin fecha la hora cero ("no se sabe", en DataVersion y
+// UserInfo).
+func fromTime(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func apiTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
@@ -0,0 +1,7 @@
+// El paquete apipb contiene el contrato de la API en protobuf (api.proto),
+// el código generado a partir de él para el servicio gRPC y la conversión
+// con los tipos de pkg/api, que siguen siendo los que usan servidor y
+// cliente.
+package apipb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative api.proto
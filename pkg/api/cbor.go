@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Formatos de Request y Response en HTTP, por Content-Type y Accept. JSON
+// es el de siempre; con CBOR (RFC 8949), los textos en base64 estándar
+// (Data cifrado con la clave de sesión, firmas, claves) viajan como bytes
+// y ocupan un 25 % menos. Los que llevan otra cosa delante, como los de
+// crypto.SealUserData, siguen siendo texto.
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeCBOR = "application/cbor"
+)
+
+// tagBase64 es la etiqueta CBOR "se espera en base64" (RFC 8949, 3.4.5.2):
+// marca los bytes que en JSON son un texto en base64 estándar.
+const tagBase64 = 22
+
+// minBase64 es la longitud mínima de un texto para pasarlo a bytes: en los
+// cortos no se gana nada y se tomarían por base64 palabras sueltas.
+const minBase64 = 16
+
+var (
+	cborEnc cbor.EncMode
+	cborDec cbor.DecMode
+)
+
+func init() {
+	var err error
+	if cborEnc, err = (cbor.EncOptions{Sort: cbor.SortCanonical}).EncMode(); err != nil {
+		panic(err)
+	}
+	if cborDec, err = (cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}).DecMode(); err != nil {
+		panic(err)
+	}
+}
+
+// MarshalCBOR codifica 'v' (Request, Response) en CBOR con la misma
+// estructura que en JSON, Payload incluido. Los textos que son base64
+// estándar (canónico) pasan a bytes con la etiqueta tagBase64, y
+// UnmarshalCBOR los devuelve a texto tal cual, así que nada cambia para
+// quien los usa.
+func MarshalCBOR(v any) ([]byte, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	tree, err = toCBOR(tree)
+	if err != nil {
+		return nil, err
+	}
+	return cborEnc.Marshal(tree)
+}
+
+// UnmarshalCBOR descodifica en 'v' lo codificado con MarshalCBOR, con las
+// mismas reglas que encoding/json.
+func UnmarshalCBOR(data []byte, v any) error {
+	var tree any
+	if err := cborDec.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	tree, err := fromCBOR(tree)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// toCBOR prepara para CBOR un valor descodificado de JSON.
+func toCBOR(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			c, err := toCBOR(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = c
+		}
+	case []any:
+		for i, e := range v {
+			c, err := toCBOR(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = c
+		}
+	case string:
+		if raw, ok := base64Bytes(v); ok {
+			return cbor.Tag{Number: tagBase64, Content: raw}, nil
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u, nil
+		}
+		return v.Float64()
+	}
+	return v, nil
+}
+
+// fromCBOR es lo contrario de toCBOR: deja un valor que encoding/json sabe
+// codificar igual que el original. Los bytes sin etiqueta ya salen en
+// base64, como cualquier []byte.
+func fromCBOR(v any) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			c, err := fromCBOR(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = c
+		}
+	case []any:
+		for i, e := range v {
+			c, err := fromCBOR(e)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = c
+		}
+	case cbor.Tag:
+		raw, ok := v.Content.([]byte)
+		if v.Number != tagBase64 || !ok {
+			return nil, fmt.Errorf("etiqueta CBOR no admitida: %d", v.Number)
+		}
+		return base64.StdEncoding.EncodeToString(raw), nil
+	}
+	return v, nil
+}
+
+// base64Bytes devuelve los bytes de 's' si es base64 estándar canónico (el
+// que se obtiene al volver a codificarlos) y no es demasiado corto.
+func base64Bytes(s string) ([]byte, bool) {
+	if len(s) < minBase64 {
+		return nil, false
+	}
+	raw, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || base64.StdEncoding.EncodeToString(raw) != s {
+		return nil, false
+	}
+	return raw, true
+}
@@ -0,0 +1,662 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Payload de las peticiones y respuestas: en lugar de repartir lo propio de
+// cada acción entre los campos sueltos de Request y Response (y de meter en
+// Data cosas tan distintas como los datos del usuario, el JSON de WebAuthn
+// o el nombre de una instantánea), va en Payload con el tipo de la acción:
+// RegisterPayload, UpdateDataPayload... En la envoltura quedan sólo Action,
+// Username, Token, Sealed, Format y la paginación (Limit, Cursor) en la
+// petición, y Success, Code, Message, TwoFactorRequired, Sealed, Format,
+// los listados ya tipados (Versions, Logins, Sessions, Stats, Users,
+// Messages, Groups, Shared) y NextCursor en la respuesta.
+//
+// Los campos sueltos se mantienen para los clientes que aún los usan. Una
+// petición con Payload (aunque sea "{}" en las acciones sin payload) recibe
+// la respuesta también con Payload; sin él, todo sigue como antes.
+
+// RegisterPayload es el payload de register.
+type RegisterPayload struct {
+	Password  string `json:"password"`
+	PublicKey string `json:"publicKey,omitempty"` // ver Request.PublicKey
+}
+
+// LoginPayload es el payload de login, loginRecovery y certLogin (que no
+// lleva Password), y de enable2FA con 2FA ya activado (Password o Code).
+type LoginPayload struct {
+	Password string `json:"password,omitempty"`
+	Code     string `json:"code,omitempty"` // código TOTP o de recuperación
+}
+
+// SessionPayload es el payload de la respuesta de los logins, de refresh y
+// de changePassword, que renueva la sesión.
+type SessionPayload struct {
+	Token              string     `json:"token,omitempty"`
+	SessionKey         string     `json:"sessionKey,omitempty"`
+	RefreshToken       string     `json:"refreshToken,omitempty"` // con OPAQUE, cifrado como Token
+	DataKey            string     `json:"dataKey,omitempty"`
+	MustChangePassword bool       `json:"mustChangePassword,omitempty"`
+	SealedToken        string     `json:"sealedToken,omitempty"` // con OPAQUE, el token cifrado (y Token vacío)
+	SRP                *SRPParams `json:"srp,omitempty"`         // con SRP, la prueba del servidor (M2)
+}
+
+// RefreshPayload es el payload de refresh.
+type RefreshPayload struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// UpdateDataPayload es el payload de updateData.
+type UpdateDataPayload struct {
+	Data      string  `json:"data"`
+	Signature string  `json:"signature,omitempty"`
+	DataKey   string  `json:"dataKey,omitempty"`
+	Expected  *string `json:"expected,omitempty"` // ver Request.Expected
+}
+
+// DataPayload es el payload de la respuesta de fetchData, fetchDataVersion
+// y fetchGroupData.
+type DataPayload struct {
+	Data      string `json:"data"`
+	PublicKey string `json:"publicKey,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// VersionPayload es el payload de fetchDataVersion.
+type VersionPayload struct {
+	Version uint64 `json:"version"`
+}
+
+// ChangePasswordPayload es el payload de changePassword.
+type ChangePasswordPayload struct {
+	Password    string     `json:"password,omitempty"`
+	NewPassword string     `json:"newPassword,omitempty"`
+	DataKey     string     `json:"dataKey,omitempty"`
+	SRP         *SRPParams `json:"srp,omitempty"`
+}
+
+// DeleteAccountPayload es el payload de deleteAccount.
+type DeleteAccountPayload struct {
+	Password string     `json:"password,omitempty"`
+	SRP      *SRPParams `json:"srp,omitempty"`
+}
+
+// TwoFactorPayload es el payload de la respuesta de enable2FA.
+type TwoFactorPayload struct {
+	URI           string   `json:"uri"` // otpauth:// para la app de autenticación
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// SRPPayload es el payload de srpRegister, srpBegin y srpVerify, y de la
+// respuesta de srpBegin.
+type SRPPayload struct {
+	SRP       *SRPParams `json:"srp"`
+	PublicKey string     `json:"publicKey,omitempty"` // en srpRegister
+	Code      string     `json:"code,omitempty"`      // código 2FA en srpVerify
+}
+
+// WebAuthnPayload es el payload de las ceremonias WebAuthn: Options en la
+// respuesta de los *Begin y Credential en la petición de los *Finish, como
+// JSON de verdad en lugar de texto dentro de Data.
+type WebAuthnPayload struct {
+	Options    json.RawMessage `json:"options,omitempty"`
+	Credential json.RawMessage `json:"credential,omitempty"`
+}
+
+// OPAQUEPayload es el payload de las acciones OPAQUE y de la respuesta de
+// los *Init.
+type OPAQUEPayload struct {
+	Message   json.RawMessage `json:"message,omitempty"`
+	PublicKey string          `json:"publicKey,omitempty"` // en opaqueRegisterFinish
+	Code      string          `json:"code,omitempty"`      // código 2FA en opaqueLoginFinish
+}
+
+// SnapshotPayload es el payload de adminRestore y de la respuesta de
+// adminBackup.
+type SnapshotPayload struct {
+	Name string `json:"name"`
+}
+
+// ListUsersPayload es el payload de listUsers.
+type ListUsersPayload struct {
+	Prefix string `json:"prefix,omitempty"` // sólo los usuarios cuyo nombre empieza por él
+}
+
+// SendMessagePayload es el payload de sendMessage.
+type SendMessagePayload struct {
+	To   string `json:"to"`
+	Body string `json:"body"`
+}
+
+// MessagePayload es el payload de deleteMessage.
+type MessagePayload struct {
+	ID string `json:"id"`
+}
+
+// GroupPayload es el payload de las acciones de grupos: cada una usa los
+// campos que le corresponden (Member al añadir o quitar miembros, Data en
+// updateGroupData).
+type GroupPayload struct {
+	Group  string `json:"group"`
+	Member string `json:"member,omitempty"`
+	Data   string `json:"data,omitempty"`
+}
+
+// FileChunkPayload es el payload de uploadFileChunk y downloadFileChunk, y
+// de sus respuestas (sin Chunk ni Owner).
+type FileChunkPayload struct {
+	File  *FileInfo `json:"file"`
+	Chunk int       `json:"chunk,omitempty"`
+	Owner string    `json:"owner,omitempty"` // en downloadFileChunk
+	Data  string    `json:"data,omitempty"`  // el trozo, en base64
+}
+
+// ShareKeyPayload es el payload de setShareKey y de la respuesta de
+// getShareKey (con la clave de firma del destinatario en PublicKey).
+type ShareKeyPayload struct {
+	ShareKey  *ShareKey `json:"shareKey"`
+	PublicKey string    `json:"publicKey,omitempty"`
+}
+
+// ShareDataPayload es el payload de shareData, unshareData (sin Key) y
+// getShareKey (sólo To).
+type ShareDataPayload struct {
+	To   string    `json:"to"`
+	File *FileInfo `json:"file,omitempty"`
+	Key  string    `json:"key,omitempty"` // la clave del fichero envuelta para To
+}
+
+// KeysPayload es el payload de publishKey (Keys) y getKey (To), y de la
+// respuesta de getKey.
+type KeysPayload struct {
+	To   string      `json:"to,omitempty"`
+	Keys *PublicKeys `json:"keys,omitempty"`
+}
+
+// ServerInfoPayload es el payload de la respuesta de serverInfo.
+type ServerInfoPayload struct {
+	Server *ServerInfo `json:"server"`
+}
+
+// requestPayload es el payload de una petición: sabe tomar sus campos de
+// la Request (dejándolos vacíos) y devolverlos.
+type requestPayload interface {
+	fromRequest(r *Request)
+	toRequest(r *Request)
+}
+
+// responsePayload es lo mismo para la Response.
+type responsePayload interface {
+	fromResponse(r *Response)
+	toResponse(r *Response)
+}
+
+// requestPayloads son los tipos de payload de las peticiones por acción.
+var requestPayloads = map[string]func() requestPayload{
+	ActionRegister:               func() requestPayload { return &RegisterPayload{} },
+	ActionLogin:                  func() requestPayload { return &LoginPayload{} },
+	ActionRefresh:                func() requestPayload { return &RefreshPayload{} },
+	ActionLoginRecovery:          func() requestPayload { return &LoginPayload{} },
+	ActionCertLogin:              func() requestPayload { return &LoginPayload{} },
+	ActionEnable2FA:              func() requestPayload { return &LoginPayload{} },
+	ActionUpdateData:             func() requestPayload { return &UpdateDataPayload{} },
+	ActionFetchDataVersion:       func() requestPayload { return &VersionPayload{} },
+	ActionChangePassword:         func() requestPayload { return &ChangePasswordPayload{} },
+	ActionDeleteAccount:          func() requestPayload { return &DeleteAccountPayload{} },
+	ActionSRPRegister:            func() requestPayload { return &SRPPayload{} },
+	ActionSRPBegin:               func() requestPayload { return &SRPPayload{} },
+	ActionSRPVerify:              func() requestPayload { return &SRPPayload{} },
+	ActionWebAuthnRegisterFinish: func() requestPayload { return &WebAuthnPayload{} },
+	ActionWebAuthnLoginFinish:    func() requestPayload { return &WebAuthnPayload{} },
+	ActionOPAQUERegisterInit:     func() requestPayload { return &OPAQUEPayload{} },
+	ActionOPAQUERegisterFinish:   func() requestPayload { return &OPAQUEPayload{} },
+	ActionOPAQUELoginInit:        func() requestPayload { return &OPAQUEPayload{} },
+	ActionOPAQUELoginFinish:      func() requestPayload { return &OPAQUEPayload{} },
+	ActionAdminRestore:           func() requestPayload { return &SnapshotPayload{} },
+	ActionListUsers:              func() requestPayload { return &ListUsersPayload{} },
+	ActionSendMessage:            func() requestPayload { return &SendMessagePayload{} },
+	ActionDeleteMessage:          func() requestPayload { return &MessagePayload{} },
+	ActionCreateGroup:            func() requestPayload { return &GroupPayload{} },
+	ActionAddGroupMember:         func() requestPayload { return &GroupPayload{} },
+	ActionRemoveGroupMember:      func() requestPayload { return &GroupPayload{} },
+	ActionFetchGroupData:         func() requestPayload { return &GroupPayload{} },
+	ActionUpdateGroupData:        func() requestPayload { return &GroupPayload{} },
+	ActionUploadFileChunk:        func() requestPayload { return &FileChunkPayload{} },
+	ActionDownloadFileChunk:      func() requestPayload { return &FileChunkPayload{} },
+	ActionSetShareKey:            func() requestPayload { return &ShareKeyPayload{} },
+	ActionGetShareKey:            func() requestPayload { return &ShareDataPayload{} },
+	ActionShareData:              func() requestPayload { return &ShareDataPayload{} },
+	ActionUnshareData:            func() requestPayload { return &ShareDataPayload{} },
+	ActionPublishKey:             func() requestPayload { return &KeysPayload{} },
+	ActionGetKey:                 func() requestPayload { return &KeysPayload{} },
+}
+
+// responsePayloads son los tipos de payload de las respuestas por acción.
+var responsePayloads = map[string]func() responsePayload{
+	ActionLogin:                 func() responsePayload { return &SessionPayload{} },
+	ActionLoginRecovery:         func() responsePayload { return &SessionPayload{} },
+	ActionCertLogin:             func() responsePayload { return &SessionPayload{} },
+	ActionSRPVerify:             func() responsePayload { return &SessionPayload{} },
+	ActionWebAuthnLoginFinish:   func() responsePayload { return &SessionPayload{} },
+	ActionOPAQUELoginFinish:     func() responsePayload { return &SessionPayload{} },
+	ActionChangePassword:        func() responsePayload { return &SessionPayload{} },
+	ActionRefresh:               func() responsePayload { return &SessionPayload{} },
+	ActionFetchData:             func() responsePayload { return &DataPayload{} },
+	ActionFetchDataVersion:      func() responsePayload { return &DataPayload{} },
+	ActionFetchGroupData:        func() responsePayload { return &DataPayload{} },
+	ActionUploadFileChunk:       func() responsePayload { return &FileChunkPayload{} },
+	ActionDownloadFileChunk:     func() responsePayload { return &FileChunkPayload{} },
+	ActionGetShareKey:           func() responsePayload { return &ShareKeyPayload{} },
+	ActionGetKey:                func() responsePayload { return &KeysPayload{} },
+	ActionServerInfo:            func() responsePayload { return &ServerInfoPayload{} },
+	ActionEnable2FA:             func() responsePayload { return &TwoFactorPayload{} },
+	ActionSRPBegin:              func() responsePayload { return &SRPPayload{} },
+	ActionWebAuthnRegisterBegin: func() responsePayload { return &WebAuthnPayload{} },
+	ActionWebAuthnLoginBegin:    func() responsePayload { return &WebAuthnPayload{} },
+	ActionOPAQUERegisterInit:    func() responsePayload { return &OPAQUEPayload{} },
+	ActionOPAQUELoginInit:       func() responsePayload { return &OPAQUEPayload{} },
+	ActionAdminBackup:           func() responsePayload { return &SnapshotPayload{} },
+}
+
+// emptyPayload es el Payload de las acciones que no tienen: indica que el
+// cliente quiere la respuesta con Payload.
+var emptyPayload = json.RawMessage("{}")
+
+// PackPayload devuelve 'r' con los campos propios de su acción pasados a
+// Payload. Falla si alguno que debe ser JSON (WebAuthn, OPAQUE) no lo es.
+func (r Request) PackPayload() (Request, error) {
+	newPayload, ok := requestPayloads[r.Action]
+	if !ok {
+		r.Payload = emptyPayload
+		return r, nil
+	}
+	p := newPayload()
+	p.fromRequest(&r)
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return r, fmt.Errorf("payload de %s no válido: %v", r.Action, err)
+	}
+	r.Payload = raw
+	return r, nil
+}
+
+// UnpackPayload devuelve 'r' con el contenido de Payload en los campos
+// sueltos, que son los que usan los manejadores, y sin Payload. Los campos
+// desconocidos son un error: el payload tiene un tipo fijo por acción.
+func (r Request) UnpackPayload() (Request, error) {
+	raw := r.Payload
+	r.Payload = nil
+	newPayload, ok := requestPayloads[r.Action]
+	if !ok {
+		if isEmptyPayload(raw) {
+			return r, nil
+		}
+		return r, fmt.Errorf("la acción %q no lleva payload", r.Action)
+	}
+	p := newPayload()
+	if err := decodePayload(raw, p); err != nil {
+		return r, err
+	}
+	p.toRequest(&r)
+	return r, nil
+}
+
+// Envelope devuelve sólo la envoltura de 'r' (APIVersion, Action, Username,
+// Token, Sealed, Format y la paginación) y su Payload, sin los campos
+// sueltos: es lo que se atiende en la versión 2 del protocolo.
+func (r Request) Envelope() Request {
+	return Request{
+		APIVersion: r.APIVersion,
+		Action:     r.Action,
+		Username:   r.Username,
+		Token:      r.Token,
+		Sealed:     r.Sealed,
+		Format:     r.Format,
+		Limit:      r.Limit,
+		Cursor:     r.Cursor,
+		Payload:    r.Payload,
+	}
+}
+
+// PackPayload devuelve 'r', la respuesta a 'action', con sus campos propios
+// pasados a Payload.
+func (r Response) PackPayload(action string) (Response, error) {
+	newPayload, ok := responsePayloads[action]
+	if !ok {
+		return r, nil
+	}
+	p := newPayload()
+	p.fromResponse(&r)
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return r, fmt.Errorf("payload de la respuesta a %s no válido: %v", action, err)
+	}
+	r.Payload = raw
+	return r, nil
+}
+
+// UnpackPayload devuelve 'r', la respuesta a 'action', con el contenido de
+// Payload en los campos sueltos.
+func (r Response) UnpackPayload(action string) (Response, error) {
+	raw := r.Payload
+	r.Payload = nil
+	newPayload, ok := responsePayloads[action]
+	if !ok || isEmptyPayload(raw) {
+		return r, nil
+	}
+	p := newPayload()
+	if err := decodePayload(raw, p); err != nil {
+		return r, err
+	}
+	p.toResponse(&r)
+	return r, nil
+}
+
+// decodePayload descodifica 'raw' en 'p' sin admitir campos desconocidos
+// (el error es el de encoding/json).
+// Un payload vacío deja 'p' sin rellenar.
+func decodePayload(raw json.RawMessage, p any) error {
+	if isEmptyPayload(raw) {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(p); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("hay datos después del objeto")
+	}
+	return nil
+}
+
+// isEmptyPayload indica si 'raw' no lleva nada: vacío, null o "{}".
+func isEmptyPayload(raw json.RawMessage) bool {
+	raw = bytes.TrimSpace(raw)
+	return len(raw) == 0 || bytes.Equal(raw, []byte("null")) || bytes.Equal(bytes.Join(bytes.Fields(raw), nil), []byte("{}"))
+}
+
+// rawJSON pasa a json.RawMessage un texto que debe ser JSON ("" es nada).
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+// jsonText es lo contrario de rawJSON.
+func jsonText(raw json.RawMessage) string {
+	if t := bytes.TrimSpace(raw); len(t) == 0 || bytes.Equal(t, []byte("null")) {
+		return ""
+	}
+	return string(raw)
+}
+
+func (p *RegisterPayload) fromRequest(r *Request) {
+	p.Password, p.PublicKey = r.Password, r.PublicKey
+	r.Password, r.PublicKey = "", ""
+}
+
+func (p *RegisterPayload) toRequest(r *Request) {
+	r.Password, r.PublicKey = p.Password, p.PublicKey
+}
+
+func (p *LoginPayload) fromRequest(r *Request) {
+	p.Password, p.Code = r.Password, r.Code
+	r.Password, r.Code = "", ""
+}
+
+func (p *LoginPayload) toRequest(r *Request) {
+	r.Password, r.Code = p.Password, p.Code
+}
+
+func (p *SessionPayload) fromResponse(r *Response) {
+	p.Token, p.SessionKey, p.DataKey, p.MustChangePassword, p.SRP = r.Token, r.SessionKey, r.DataKey, r.MustChangePassword, r.SRP
+	r.Token, r.SessionKey, r.DataKey, r.MustChangePassword, r.SRP = "", "", "", false, nil
+	p.RefreshToken, r.RefreshToken = r.RefreshToken, ""
+	// Con OPAQUE, el token cifrado va en Data
+	p.SealedToken, r.Data = r.Data, ""
+}
+
+func (p *SessionPayload) toResponse(r *Response) {
+	r.Token, r.SessionKey, r.DataKey, r.MustChangePassword, r.SRP = p.Token, p.SessionKey, p.DataKey, p.MustChangePassword, p.SRP
+	r.RefreshToken = p.RefreshToken
+	r.Data = p.SealedToken
+}
+
+func (p *RefreshPayload) fromRequest(r *Request) {
+	p.RefreshToken = r.RefreshToken
+	r.RefreshToken = ""
+}
+
+func (p *RefreshPayload) toRequest(r *Request) {
+	r.RefreshToken = p.RefreshToken
+}
+
+func (p *UpdateDataPayload) fromRequest(r *Request) {
+	p.Data, p.Signature, p.DataKey, p.Expected = r.Data, r.Signature, r.DataKey, r.Expected
+	r.Data, r.Signature, r.DataKey, r.Expected = "", "", "", nil
+}
+
+func (p *UpdateDataPayload) toRequest(r *Request) {
+	r.Data, r.Signature, r.DataKey, r.Expected = p.Data, p.Signature, p.DataKey, p.Expected
+}
+
+func (p *DataPayload) fromResponse(r *Response) {
+	p.Data, p.PublicKey, p.Signature = r.Data, r.PublicKey, r.Signature
+	r.Data, r.PublicKey, r.Signature = "", "", ""
+}
+
+func (p *DataPayload) toResponse(r *Response) {
+	r.Data, r.PublicKey, r.Signature = p.Data, p.PublicKey, p.Signature
+}
+
+func (p *VersionPayload) fromRequest(r *Request) {
+	p.Version, r.Version = r.Version, 0
+}
+
+func (p *VersionPayload) toRequest(r *Request) {
+	r.Version = p.Version
+}
+
+func (p *ChangePasswordPayload) fromRequest(r *Request) {
+	p.Password, p.NewPassword, p.DataKey, p.SRP = r.Password, r.NewPassword, r.DataKey, r.SRP
+	r.Password, r.NewPassword, r.DataKey, r.SRP = "", "", "", nil
+}
+
+func (p *ChangePasswordPayload) toRequest(r *Request) {
+	r.Password, r.NewPassword, r.DataKey, r.SRP = p.Password, p.NewPassword, p.DataKey, p.SRP
+}
+
+func (p *DeleteAccountPayload) fromRequest(r *Request) {
+	p.Password, p.SRP = r.Password, r.SRP
+	r.Password, r.SRP = "", nil
+}
+
+func (p *DeleteAccountPayload) toRequest(r *Request) {
+	r.Password, r.SRP = p.Password, p.SRP
+}
+
+func (p *TwoFactorPayload) fromResponse(r *Response) {
+	p.URI, p.RecoveryCodes = r.Data, r.RecoveryCodes
+	r.Data, r.RecoveryCodes = "", nil
+}
+
+func (p *TwoFactorPayload) toResponse(r *Response) {
+	r.Data, r.RecoveryCodes = p.URI, p.RecoveryCodes
+}
+
+func (p *SRPPayload) fromRequest(r *Request) {
+	p.SRP, p.PublicKey, p.Code = r.SRP, r.PublicKey, r.Code
+	r.SRP, r.PublicKey, r.Code = nil, "", ""
+}
+
+func (p *SRPPayload) toRequest(r *Request) {
+	r.SRP, r.PublicKey, r.Code = p.SRP, p.PublicKey, p.Code
+}
+
+func (p *SRPPayload) fromResponse(r *Response) {
+	p.SRP, r.SRP = r.SRP, nil
+}
+
+func (p *SRPPayload) toResponse(r *Response) {
+	r.SRP = p.SRP
+}
+
+func (p *WebAuthnPayload) fromRequest(r *Request) {
+	p.Credential, r.Data = rawJSON(r.Data), ""
+}
+
+func (p *WebAuthnPayload) toRequest(r *Request) {
+	r.Data = jsonText(p.Credential)
+}
+
+func (p *WebAuthnPayload) fromResponse(r *Response) {
+	p.Options, r.Data = rawJSON(r.Data), ""
+}
+
+func (p *WebAuthnPayload) toResponse(r *Response) {
+	r.Data = jsonText(p.Options)
+}
+
+func (p *OPAQUEPayload) fromRequest(r *Request) {
+	p.Message, p.PublicKey, p.Code = rawJSON(r.Data), r.PublicKey, r.Code
+	r.Data, r.PublicKey, r.Code = "", "", ""
+}
+
+func (p *OPAQUEPayload) toRequest(r *Request) {
+	r.Data, r.PublicKey, r.Code = jsonText(p.Message), p.PublicKey, p.Code
+}
+
+func (p *OPAQUEPayload) fromResponse(r *Response) {
+	p.Message, r.Data = rawJSON(r.Data), ""
+}
+
+func (p *OPAQUEPayload) toResponse(r *Response) {
+	r.Data = jsonText(p.Message)
+}
+
+func (p *SnapshotPayload) fromRequest(r *Request) {
+	p.Name, r.Data = r.Data, ""
+}
+
+func (p *SnapshotPayload) toRequest(r *Request) {
+	r.Data = p.Name
+}
+
+func (p *SnapshotPayload) fromResponse(r *Response) {
+	p.Name, r.Data = r.Data, ""
+}
+
+func (p *SnapshotPayload) toResponse(r *Response) {
+	r.Data = p.Name
+}
+
+func (p *ListUsersPayload) fromRequest(r *Request) {
+	p.Prefix, r.Prefix = r.Prefix, ""
+}
+
+func (p *ListUsersPayload) toRequest(r *Request) {
+	r.Prefix = p.Prefix
+}
+
+func (p *SendMessagePayload) fromRequest(r *Request) {
+	p.To, p.Body = r.To, r.Data
+	r.To, r.Data = "", ""
+}
+
+func (p *SendMessagePayload) toRequest(r *Request) {
+	r.To, r.Data = p.To, p.Body
+}
+
+func (p *MessagePayload) fromRequest(r *Request) {
+	p.ID, r.Data = r.Data, ""
+}
+
+func (p *MessagePayload) toRequest(r *Request) {
+	r.Data = p.ID
+}
+
+func (p *GroupPayload) fromRequest(r *Request) {
+	p.Group, p.Member, p.Data = r.Group, r.Member, r.Data
+	r.Group, r.Member, r.Data = "", "", ""
+}
+
+func (p *GroupPayload) toRequest(r *Request) {
+	r.Group, r.Member, r.Data = p.Group, p.Member, p.Data
+}
+
+func (p *FileChunkPayload) fromRequest(r *Request) {
+	p.File, p.Chunk, p.Owner, p.Data = r.File, r.Chunk, r.Owner, r.Data
+	r.File, r.Chunk, r.Owner, r.Data = nil, 0, "", ""
+}
+
+func (p *FileChunkPayload) toRequest(r *Request) {
+	r.File, r.Chunk, r.Owner, r.Data = p.File, p.Chunk, p.Owner, p.Data
+}
+
+func (p *FileChunkPayload) fromResponse(r *Response) {
+	p.File, p.Data = r.File, r.Data
+	r.File, r.Data = nil, ""
+}
+
+func (p *FileChunkPayload) toResponse(r *Response) {
+	r.File, r.Data = p.File, p.Data
+}
+
+func (p *ShareKeyPayload) fromRequest(r *Request) {
+	p.ShareKey = r.ShareKey
+	r.ShareKey = nil
+}
+
+func (p *ShareKeyPayload) toRequest(r *Request) {
+	r.ShareKey = p.ShareKey
+}
+
+func (p *ShareKeyPayload) fromResponse(r *Response) {
+	p.ShareKey, p.PublicKey = r.ShareKey, r.PublicKey
+	r.ShareKey, r.PublicKey = nil, ""
+}
+
+func (p *ShareKeyPayload) toResponse(r *Response) {
+	r.ShareKey, r.PublicKey = p.ShareKey, p.PublicKey
+}
+
+func (p *ShareDataPayload) fromRequest(r *Request) {
+	p.To, p.File, p.Key = r.To, r.File, r.Data
+	r.To, r.File, r.Data = "", nil, ""
+}
+
+func (p *ShareDataPayload) toRequest(r *Request) {
+	r.To, r.File, r.Data = p.To, p.File, p.Key
+}
+
+func (p *KeysPayload) fromRequest(r *Request) {
+	p.To, p.Keys = r.To, r.Keys
+	r.To, r.Keys = "", nil
+}
+
+func (p *KeysPayload) toRequest(r *Request) {
+	r.To, r.Keys = p.To, p.Keys
+}
+
+func (p *KeysPayload) fromResponse(r *Response) {
+	p.Keys, r.Keys = r.Keys, nil
+}
+
+func (p *KeysPayload) toResponse(r *Response) {
+	r.Keys = p.Keys
+}
+
+func (p *ServerInfoPayload) fromResponse(r *Response) {
+	p.Server, r.Server = r.Server, nil
+}
+
+func (p *ServerInfoPayload) toResponse(r *Response) {
+	r.Server = p.Server
+}
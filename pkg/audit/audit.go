@@ -0,0 +1,210 @@
+// El paquete audit implementa un registro de auditoría de sólo adición y
+// evidente ante manipulaciones: cada entrada incluye el hash (HMAC) de la
+// anterior, de modo que modificar, borrar o reordenar entradas antiguas
+// rompe la cadena y Verify lo detecta.
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"prac/pkg/store"
+)
+
+// Namespace es el bucket donde se guardan las entradas.
+const Namespace = "audit"
+
+// genesisHash es el "hash anterior" de la primera entrada.
+var genesisHash = hex.EncodeToString(make([]byte, sha256.Size))
+
+// Entry es una entrada del registro.
+type Entry struct {
+	Seq      uint64    `json:"seq"`
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Action   string    `json:"action"`
+	Detail   string    `json:"detail,omitempty"`
+	PrevHash string    `json:"prevHash"`
+	Hash     string    `json:"hash"`
+}
+
+// Log es el registro encadenado sobre un store.AppendLog.
+type Log struct {
+	mu       sync.Mutex
+	events   *store.AppendLog
+	key      []byte // clave HMAC: sin ella no se puede recalcular la cadena
+	lastHash string
+}
+
+// New abre el registro sobre 'events' (el AppendLog de Namespace) y
+// localiza el final de la cadena. Para que las entradas no se puedan
+// tocar con Put o Delete, 'events' debe venir de un store.AppendOnlyStore.
+func New(ctx context.Context, events *store.AppendLog, key []byte) (*Log, error) {
+	l := &Log{events: events, key: key}
+	if err := l.findEnd(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Open abre en 'db', sin protegerlo, el registro de Namespace (para
+// verificarlo, por ejemplo, desde una base de datos en sólo lectura).
+func Open(ctx context.Context, db store.Store, key []byte) (*Log, error) {
+	events, err := store.NewAppendLog(ctx, db, Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo la última entrada de auditoría: %v", err)
+	}
+	return New(ctx, events, key)
+}
+
+// Reload vuelve a localizar el final de la cadena, por ejemplo después de
+// restaurar la base de datos: las entradas nuevas siguen a las de la copia.
+func (l *Log) Reload(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.events.Reload(ctx); err != nil {
+		return fmt.Errorf("error leyendo la última entrada de auditoría: %v", err)
+	}
+	return l.findEnd(ctx)
+}
+
+// findEnd coloca lastHash en el de la última entrada guardada.
+func (l *Log) findEnd(ctx context.Context) error {
+	l.lastHash = genesisHash
+	last := l.events.Last()
+	if last == 0 {
+		return nil // registro vacío (el bucket aún no existe)
+	}
+	list, err := l.events.Range(ctx, last, last, 1)
+	if err == nil && len(list) == 0 {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error leyendo la última entrada de auditoría: %v", err)
+	}
+	var e Entry
+	if err := json.Unmarshal(list[0].Value, &e); err != nil {
+		return fmt.Errorf("error leyendo la última entrada de auditoría: %v", err)
+	}
+	l.lastHash = e.Hash
+	return nil
+}
+
+// Append añade una entrada al final de la cadena.
+func (l *Log) Append(ctx context.Context, user, action, detail string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var hash string
+	_, err := l.events.AppendFunc(ctx, func(seq uint64) ([]byte, error) {
+		e := Entry{
+			Seq:      seq,
+			Time:     time.Now().UTC(),
+			User:     user,
+			Action:   action,
+			Detail:   detail,
+			PrevHash: l.lastHash,
+		}
+		e.Hash = l.hash(e)
+		hash = e.Hash
+		return json.Marshal(e)
+	})
+	if err != nil {
+		return fmt.Errorf("error guardando entrada de auditoría: %v", err)
+	}
+	l.lastHash = hash
+	return nil
+}
+
+// Problem describe una anomalía encontrada al verificar.
+type Problem struct {
+	Key    string
+	Reason string
+}
+
+// Report es el resultado de Verify.
+type Report struct {
+	Entries  int
+	Problems []Problem
+}
+
+// OK indica si la cadena está íntegra.
+func (r Report) OK() bool { return len(r.Problems) == 0 }
+
+// Verify recorre todas las entradas y comprueba secuencia, enlace con la
+// anterior y hash de cada una.
+func (l *Log) Verify(ctx context.Context) (Report, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var rep Report
+	prev, expected := genesisHash, uint64(1)
+	err := l.events.ForEach(ctx, func(seq uint64, raw []byte) error {
+		rep.Entries++
+		k := string(seqKey(seq))
+		var e Entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			rep.Problems = append(rep.Problems, Problem{k, "entrada ilegible: " + err.Error()})
+			return nil
+		}
+		if seq != e.Seq || e.Seq != expected {
+			rep.Problems = append(rep.Problems, Problem{k,
+				fmt.Sprintf("secuencia %d, se esperaba %d", e.Seq, expected)})
+		}
+		if e.PrevHash != prev {
+			rep.Problems = append(rep.Problems, Problem{k, "no enlaza con la entrada anterior"})
+		}
+		if !hmac.Equal([]byte(e.Hash), []byte(l.hash(e))) {
+			rep.Problems = append(rep.Problems, Problem{k, "hash incorrecto (contenido modificado)"})
+		}
+		prev, expected = e.Hash, e.Seq+1
+		return nil
+	})
+	if err != nil {
+		// El motor no ha podido seguir (por ejemplo, una entrada que no se
+		// descifra o una clave que no es una secuencia): el resto de la
+		// cadena queda sin verificar
+		rep.Problems = append(rep.Problems, Problem{string(seqKey(expected)), "entrada ilegible: " + err.Error()})
+	}
+	return rep, nil
+}
+
+// Range devuelve, en orden, hasta 'limit' entradas con secuencia entre
+// 'from' y 'to' (ambas incluidas; 'to' 0 para llegar a la última), sin
+// comprobar la cadena (para eso está Verify).
+func (l *Log) Range(ctx context.Context, from, to uint64, limit int) ([]Entry, error) {
+	list, err := l.events.Range(ctx, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(list))
+	for _, kv := range list {
+		var e Entry
+		if err := json.Unmarshal(kv.Value, &e); err != nil {
+			return nil, fmt.Errorf("entrada de auditoría ilegible %s: %v", seqKey(kv.Seq), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// hash calcula el HMAC-SHA256 de la entrada (sin el propio campo Hash).
+func (l *Log) hash(e Entry) string {
+	e.Hash = ""
+	raw, _ := json.Marshal(e)
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write(raw)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// seqKey es la clave con la que store.AppendLog guarda la entrada 'seq'
+// (con ceros a la izquierda), para los informes de Verify.
+func seqKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("%020d", seq))
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/ui"
+)
+
+// deleteAccount es la opción del menú para eliminar la cuenta. No tiene
+// vuelta atrás, así que se confirma dos veces (la segunda, escribiendo el
+// nombre de usuario) antes de pedir la contraseña.
+func (c *client) deleteAccount() {
+	ui.ClearScreen()
+	fmt.Println("** Eliminar cuenta **")
+
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado.")
+		return
+	}
+	if c.authMethod == authOPAQUE {
+		fmt.Println("La eliminación de la cuenta no está disponible para cuentas OPAQUE.")
+		return
+	}
+	fmt.Println("Se borrarán del servidor tus credenciales, tus datos y su historial. No se puede deshacer.")
+	if !ui.Confirm("¿Seguro que quieres eliminar la cuenta?") {
+		fmt.Println("Cancelado.")
+		return
+	}
+	if ui.ReadInput("Escribe tu nombre de usuario para confirmarlo") != c.currentUser {
+		fmt.Println("El nombre no coincide. Cancelado.")
+		return
+	}
+	password := ui.ReadPassword("Contraseña")
+	defer crypto.Wipe(password)
+
+	// Al borrarse la sesión se cerraría el canal de avisos con un aviso
+	// de logout: lo cerramos antes
+	c.stopEvents()
+	var res api.Response
+	if c.authMethod == authSRP {
+		res = c.deleteAccountSRP(password)
+	} else {
+		res = c.sendRequest(api.Request{
+			Action:   api.ActionDeleteAccount,
+			Username: c.currentUser,
+			Token:    c.authToken,
+			Password: string(password),
+		})
+	}
+
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+	if !res.Success {
+		if res.Code == api.ErrTokenExpired {
+			c.wipeSession()
+		} else {
+			c.startEvents()
+		}
+		return
+	}
+
+	// Las claves locales del usuario ya no sirven para nada
+	username := c.currentUser
+	c.wipeSession()
+	if err := os.Remove(signKeyPath(username)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Println("Aviso: no se ha podido borrar la clave de firma local:", err)
+	}
+	if err := os.RemoveAll(ratchetDir(username)); err != nil {
+		fmt.Println("Aviso: no se han podido borrar las conversaciones locales:", err)
+	}
+}
+
+// deleteAccountSRP demuestra conocer la contraseña con una ronda SRP y
+// envía la prueba M1 con la petición de baja.
+func (c *client) deleteAccountSRP(password []byte) api.Response {
+	srp, err := crypto.NewSRPClient(c.currentUser, password)
+	if err != nil {
+		return api.Response{Success: false, Message: "Error iniciando SRP: " + err.Error()}
+	}
+	defer srp.Wipe()
+
+	m1, res := c.srpChallenge(srp, c.currentUser)
+	if !res.Success {
+		return res
+	}
+	return c.sendRequest(api.Request{
+		Action:   api.ActionDeleteAccount,
+		Username: c.currentUser,
+		Token:    c.authToken,
+		SRP:      &api.SRPParams{M1: base64.StdEncoding.EncodeToString(m1)},
+	})
+}
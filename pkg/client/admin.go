@@ -0,0 +1,64 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/ui"
+)
+
+// usersPage es cuántos usuarios se muestran de cada vez en listUsers.
+const usersPage = 20
+
+// listUsers muestra las cuentas registradas en el servidor (sólo para los
+// administradores), filtradas por el principio del nombre y de usersPage
+// en usersPage.
+func (c *client) listUsers() {
+	ui.ClearScreen()
+	fmt.Println("** Usuarios registrados (administración) **")
+
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+	prefix := ui.ReadInput("Empiezan por (vacío: todos)")
+
+	cursor := ""
+	for {
+		res := c.sendRequest(api.Request{
+			Action:   api.ActionListUsers,
+			Username: c.currentUser,
+			Token:    c.authToken,
+			Prefix:   prefix,
+			Limit:    usersPage,
+			Cursor:   cursor,
+		})
+		if !res.Success {
+			fmt.Println("Mensaje:", res.Message)
+			return
+		}
+		for _, u := range res.Users {
+			fmt.Printf("  %-20s %-8s alta: %s  último acceso: %s", u.Username, u.Method, formatDate(u.Created), formatDate(u.LastLogin))
+			if u.PasswordExpired {
+				fmt.Print("  [contraseña caducada]")
+			}
+			if u.Locked {
+				fmt.Print("  [bloqueada]")
+			}
+			fmt.Println()
+		}
+		if res.NextCursor == "" || !ui.Confirm("¿Ver más?") {
+			return
+		}
+		cursor = res.NextCursor
+	}
+}
+
+// formatDate da formato a 't' para mostrarla, o "no consta" si es cero.
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "no consta"
+	}
+	return t.Local().Format("02/01/2006 15:04")
+}
@@ -4,33 +4,185 @@ package client
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	grpcgzip "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
 
 	"prac/pkg/api"
+	"prac/pkg/api/apipb"
+	"prac/pkg/crypto"
+	"prac/pkg/tlsutil"
 	"prac/pkg/ui"
 )
 
 // client estructura interna no exportada que controla
-// el estado de la sesión (usuario, token) y logger.
+// el estado de la sesión (usuario, token, clave de firma) y logger.
 type client struct {
-	log         *log.Logger
-	currentUser string
-	authToken   string
+	log          *log.Logger
+	currentUser  string
+	authToken    string
+	refreshToken string             // token de refresco de la sesión (ver refreshSession)
+	signKey      ed25519.PrivateKey // clave privada local para firmar los datos
+	sessionKey   []byte             // clave de sesión para cifrar Data (si el servidor la envía)
+	dataFormat   string             // formato de Data cifrado (ver envDataFormat)
+	authMethod   string             // cómo se ha iniciado la sesión (authPassword, authSRP, authOPAQUE)
+	dataKey      []byte             // clave de datos (ver crypto.SealUserData); nunca sale del cliente en claro
+	pendingKey   string             // clave de datos envuelta que aún no tiene el servidor
+	seenData     *string            // datos guardados según la última lectura o escritura (Request.Expected)
+	rpc          apipb.PracClient   // cliente gRPC (ver envGRPC); nil si se usa la API JSON
+	events       *websocket.Conn    // canal de avisos del servidor mientras hay sesión (ver startEvents)
+	baseURL      string             // dirección del servidor, http o https (ver envCA y envPin)
+	tls          *tls.Config        // configuración TLS; nil si el servidor va sin TLS
+	http         *http.Client       // cliente HTTP con esa configuración
+	cbor         bool               // peticiones y respuestas HTTP en CBOR (ver envWire)
+	gzipMin      int                // tamaño mínimo de las peticiones que se comprimen (ver envGzipMin)
+	userAgent    string             // cómo se presenta al servidor, que lo muestra en listSessions (ver envDevice)
+	server       *api.ServerInfo    // versión y funciones del servidor (ver fetchServerInfo); nil si no se sabe
+	csrfToken    string             // token CSRF de la cookie del servidor, si la manda (ver api.CSRFCookie)
 }
 
+// envDataFormat elige el formato de Data cifrado con la clave de sesión:
+// vacío para el propio o "jwe" para JWE compacto (interoperable con JOSE).
+const envDataFormat = "PRAC_DATA_FORMAT"
+
+// envGRPC es la dirección del servicio gRPC del servidor ("localhost:9090",
+// ver PRAC_GRPC_ADDR). Si se define, las peticiones van por gRPC en lugar
+// de por la API JSON.
+const envGRPC = "PRAC_CLIENT_GRPC"
+
+// envWire elige el formato de la API por HTTP: "json" (o vacío) o "cbor",
+// más compacto con los datos cifrados (ver api.ContentTypeCBOR).
+const envWire = "PRAC_CLIENT_WIRE"
+
+// envGzipMin son los bytes a partir de los que las peticiones van
+// comprimidas con gzip (0: nunca; por defecto, defaultGzipMin). Las
+// respuestas, el servidor las comprime según PRAC_GZIP_MIN.
+const envGzipMin = "PRAC_CLIENT_GZIP_MIN"
+
+// defaultGzipMin deja sin comprimir las peticiones pequeñas, como un login.
+const defaultGzipMin = 1024
+
+// gzipLevel es el nivel de compresión: con datos cifrados en base64, basta
+// Huffman (y el nivel por defecto ni los comprime).
+const gzipLevel = gzip.HuffmanOnly
+
+// Con TLS en el servidor (PRAC_TLS_CERT o PRAC_TLS_DIR), el cliente tiene
+// que saber en qué confiar: en la CA del proyecto (envCA, el ca.pem de
+// PRAC_TLS_DIR), en la clave del certificado (envPin, ver "-tls-pin") o
+// en las dos. Con cualquiera de ellas, el cliente usa https.
+const (
+	envCA  = "PRAC_CLIENT_CA"
+	envPin = "PRAC_CLIENT_PIN"
+)
+
+// Certificado de cliente para los servidores con mTLS (PRAC_MTLS; se emite
+// con "-client-cert"). Necesita TLS (envCA o envPin).
+const (
+	envCert = "PRAC_CLIENT_CERT"
+	envKey  = "PRAC_CLIENT_KEY"
+)
+
+// envDevice es el nombre del equipo en el User-Agent, que el servidor
+// muestra en la lista de sesiones abiertas. Por defecto, el de la máquina.
+const envDevice = "PRAC_CLIENT_DEVICE"
+
+// Con ErrRateLimited, el cliente espera RetryAfter y repite la petición,
+// hasta maxRateRetries veces, si no tiene que esperar más de maxBackoff.
+const (
+	maxRateRetries = 3
+	maxBackoff     = 30 * time.Second
+)
+
+// serverHost es la dirección del servidor.
+const serverHost = "localhost:8080"
+
 // Run es la única función exportada de este paquete.
 // Crea un client interno y ejecuta el bucle principal.
 func Run() {
 	// Creamos un logger con prefijo 'cli' para identificar
 	// los mensajes en la consola.
 	c := &client{
-		log: log.New(os.Stdout, "[cli] ", log.LstdFlags),
+		log:        log.New(os.Stdout, "[cli] ", log.LstdFlags),
+		dataFormat: os.Getenv(envDataFormat),
+	}
+	if c.dataFormat != crypto.FormatNative && c.dataFormat != crypto.FormatJWE {
+		c.log.Printf("%s=%q no soportado; se usa el formato propio\n", envDataFormat, c.dataFormat)
+		c.dataFormat = crypto.FormatNative
+	}
+	switch wire := os.Getenv(envWire); wire {
+	case "", "json":
+	case "cbor":
+		c.cbor = true
+	default:
+		c.log.Printf("%s=%q no soportado; se usa JSON\n", envWire, wire)
+	}
+	c.gzipMin = defaultGzipMin
+	if v := os.Getenv(envGzipMin); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			c.gzipMin = n
+		} else {
+			c.log.Printf("%s=%q no válido; se comprime a partir de %d bytes\n", envGzipMin, v, defaultGzipMin)
+		}
+	}
+	c.userAgent = userAgent(os.Getenv(envDevice))
+	c.baseURL = "http://" + serverHost
+	if ca, pin := os.Getenv(envCA), os.Getenv(envPin); ca != "" || pin != "" {
+		// Mejor no arrancar que hablar en claro con un servidor con TLS
+		tlsCfg, err := tlsutil.ClientConfig(ca, pin)
+		if err != nil {
+			c.log.Fatalf("Error en la configuración TLS (%s, %s): %v\n", envCA, envPin, err)
+		}
+		c.tls = tlsCfg
+		c.baseURL = "https://" + serverHost
+	}
+	if cert, key := os.Getenv(envCert), os.Getenv(envKey); cert != "" || key != "" {
+		if c.tls == nil {
+			c.log.Fatalf("%s necesita TLS (%s o %s)\n", envCert, envCA, envPin)
+		}
+		if err := tlsutil.LoadClientCertificate(c.tls, cert, key); err != nil {
+			c.log.Fatalf("Error en el certificado de cliente (%s, %s): %v\n", envCert, envKey, err)
+		}
+	}
+	c.http = &http.Client{Transport: &http.Transport{TLSClientConfig: c.tls}}
+	if addr := os.Getenv(envGRPC); addr != "" {
+		creds := insecure.NewCredentials()
+		if c.tls != nil {
+			creds = credentials.NewTLS(c.tls)
+		}
+		conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds), grpc.WithUserAgent(c.userAgent))
+		if err != nil {
+			c.log.Printf("%s=%q no válido (%v); se usa la API JSON\n", envGRPC, addr, err)
+		} else {
+			defer conn.Close()
+			c.rpc = apipb.NewPracClient(conn)
+			c.log.Printf("Usando el servicio gRPC de %s\n", addr)
+		}
 	}
+	c.fetchServerInfo()
 	c.runLoop()
 }
 
@@ -51,18 +203,27 @@ func (c *client) runLoop() {
 
 		// Generamos las opciones dinámicamente, según si hay un login activo.
 		var options []string
+		var actions []func() // sin sesión, lo que hace cada opción (nil: salir)
 		if c.currentUser == "" {
-			// Usuario NO logueado: Registro, Login, Salir
-			options = []string{
-				"Registrar usuario",
-				"Iniciar sesión",
-				"Salir",
-			}
+			// Usuario NO logueado: las opciones dependen del servidor (ver loginOptions)
+			options, actions = c.loginOptions()
 		} else {
-			// Usuario logueado: Ver datos, Actualizar datos, Logout, Salir
+			// Usuario logueado: Ver datos, Actualizar datos, Deshacer, Exportar/Importar (OpenPGP), Activar 2FA, Cambiar contraseña, Sesiones, Mensajes, Grupos, Ficheros, Claves públicas, Eliminar cuenta, Usuarios (admin), Logout, Salir
 			options = []string{
 				"Ver datos",
 				"Actualizar datos",
+				"Deshacer último cambio",
+				"Exportar datos (OpenPGP)",
+				"Importar datos (OpenPGP)",
+				"Activar 2FA",
+				"Cambiar contraseña",
+				"Sesiones",
+				"Mensajes",
+				"Grupos",
+				"Ficheros",
+				"Claves públicas",
+				"Eliminar cuenta",
+				"Ver usuarios (administración)",
 				"Cerrar sesión",
 				"Salir",
 			}
@@ -74,15 +235,13 @@ func (c *client) runLoop() {
 		// Hay que mapear la opción elegida según si está logueado o no.
 		if c.currentUser == "" {
 			// Caso NO logueado
-			switch choice {
-			case 1:
-				c.registerUser()
-			case 2:
-				c.loginUser()
-			case 3:
-				// Opción Salir
-				c.log.Println("Saliendo del cliente...")
-				return
+			if choice >= 1 && choice <= len(actions) {
+				if actions[choice-1] == nil {
+					// Opción Salir
+					c.log.Println("Saliendo del cliente...")
+					return
+				}
+				actions[choice-1]()
 			}
 		} else {
 			// Caso logueado
@@ -92,8 +251,32 @@ func (c *client) runLoop() {
 			case 2:
 				c.updateData()
 			case 3:
-				c.logoutUser()
+				c.undoData()
 			case 4:
+				c.exportPGP()
+			case 5:
+				c.importPGP()
+			case 6:
+				c.enable2FA()
+			case 7:
+				c.changePassword()
+			case 8:
+				c.sessions()
+			case 9:
+				c.messages()
+			case 10:
+				c.groups()
+			case 11:
+				c.files()
+			case 12:
+				c.publicKeys()
+			case 13:
+				c.deleteAccount()
+			case 14:
+				c.listUsers()
+			case 15:
+				c.logoutUser()
+			case 16:
 				// Opción Salir
 				c.log.Println("Saliendo del cliente...")
 				return
@@ -105,21 +288,74 @@ func (c *client) runLoop() {
 	}
 }
 
+// loginOptions son las opciones del menú sin sesión y lo que hace cada
+// una (nil: salir). El login OPAQUE y el de certificado sólo se ofrecen si
+// el servidor los tiene activos; si no se sabe (ver fetchServerInfo),
+// salen todas.
+func (c *client) loginOptions() ([]string, []func()) {
+	options := []string{"Registrar usuario", "Iniciar sesión", "Iniciar sesión con SRP"}
+	actions := []func(){c.registerUser, c.loginUser, c.loginSRP}
+	if c.serverHas(api.FeatureOPAQUE) {
+		options = append(options, "Iniciar sesión con OPAQUE")
+		actions = append(actions, c.loginOPAQUE)
+	}
+	options = append(options, "Iniciar sesión con código de recuperación")
+	actions = append(actions, c.loginRecovery)
+	if c.serverHas(api.FeatureMTLS) {
+		options = append(options, "Iniciar sesión con certificado")
+		actions = append(actions, c.loginCert)
+	}
+	return append(options, "Salir"), append(actions, nil)
+}
+
 // registerUser pide credenciales y las envía al servidor para un registro.
+// Genera además el par de claves de firma del usuario: la privada se queda
+// en este equipo (cifrada con la contraseña) y la pública viaja al servidor.
 // Si el registro es exitoso, se intenta el login automático.
 func (c *client) registerUser() {
 	ui.ClearScreen()
 	fmt.Println("** Registro de usuario **")
 
 	username := ui.ReadInput("Nombre de usuario")
-	password := ui.ReadInput("Contraseña")
+	password := c.readNewPassword(username)
+	defer crypto.Wipe(password)
 
-	// Enviamos la acción al servidor
-	res := c.sendRequest(api.Request{
-		Action:   api.ActionRegister,
-		Username: username,
-		Password: password,
-	})
+	tmpKey, pub, err := newSigningKey(username, password)
+	if err != nil {
+		fmt.Println("Error generando la clave de firma:", err)
+		return
+	}
+	defer os.Remove(tmpKey) // no-op si se ha confirmado el registro
+
+	// Con SRP sólo enviamos sal y verificador: la contraseña no sale del equipo
+	req := api.Request{
+		Action:    api.ActionRegister,
+		Username:  username,
+		Password:  string(password),
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+	}
+	useSRP := ui.Confirm("¿Registrar con SRP (la contraseña no se envía al servidor)?")
+	useOPAQUE := !useSRP && ui.Confirm("¿Registrar con OPAQUE (requiere que el servidor lo tenga habilitado)?")
+	if useSRP {
+		salt, verifier, err := crypto.NewSRPVerifier(username, password)
+		if err != nil {
+			fmt.Println("Error generando el verificador SRP:", err)
+			return
+		}
+		req.Action, req.Password = api.ActionSRPRegister, ""
+		req.SRP = &api.SRPParams{
+			Salt:     base64.StdEncoding.EncodeToString(salt),
+			Verifier: base64.StdEncoding.EncodeToString(verifier),
+		}
+	}
+
+	// Enviamos la acción al servidor (OPAQUE necesita dos rondas)
+	var res api.Response
+	if useOPAQUE {
+		res = c.doRegisterOPAQUE(username, password, req.PublicKey)
+	} else {
+		res = c.sendRequest(req)
+	}
 
 	// Mostramos resultado
 	fmt.Println("Éxito:", res.Success)
@@ -127,16 +363,27 @@ func (c *client) registerUser() {
 
 	// Si fue exitoso, probamos loguear automáticamente.
 	if res.Success {
+		if err := commitSigningKey(username, tmpKey); err != nil {
+			fmt.Println("Error guardando la clave de firma:", err)
+		}
 		c.log.Println("Registro exitoso; intentando login automático...")
 
-		loginRes := c.sendRequest(api.Request{
-			Action:   api.ActionLogin,
-			Username: username,
-			Password: password,
-		})
+		var loginRes api.Response
+		method := authPassword
+		switch {
+		case useSRP:
+			loginRes, method = c.doLoginSRP(username, password), authSRP
+		case useOPAQUE:
+			loginRes, method = c.doLoginOPAQUE(username, password), authOPAQUE
+		default:
+			loginRes = c.sendRequest(api.Request{
+				Action:   api.ActionLogin,
+				Username: username,
+				Password: string(password),
+			})
+		}
 		if loginRes.Success {
-			c.currentUser = username
-			c.authToken = loginRes.Token
+			c.startSession(username, method, password, loginRes)
 			fmt.Println("Login automático exitoso. Token guardado.")
 		} else {
 			fmt.Println("No se ha podido hacer login automático:", loginRes.Message)
@@ -144,27 +391,279 @@ func (c *client) registerUser() {
 	}
 }
 
+// readNewPassword pide una contraseña nueva y muestra su robustez estimada
+// antes de enviarla, ofreciendo elegir otra si el servidor la rechazaría.
+// El llamante debe borrar el resultado con crypto.Wipe.
+func (c *client) readNewPassword(username string) []byte {
+	for {
+		password := ui.ReadPassword("Contraseña")
+		st := crypto.EstimatePasswordStrength(string(password), username)
+
+		fmt.Printf("Robustez: [%s%s] %s (%d/4), tiempo estimado de ruptura: %s\n",
+			strings.Repeat("#", st.Score), strings.Repeat("-", 4-st.Score),
+			st.Label(), st.Score, st.CrackTime)
+		for _, hint := range st.Hints {
+			fmt.Println("  -", hint)
+		}
+
+		if st.Acceptable() || !ui.Confirm("La contraseña es demasiado débil y será rechazada. ¿Probar otra?") {
+			return password
+		}
+		crypto.Wipe(password)
+	}
+}
+
 // loginUser pide credenciales y realiza un login en el servidor.
 func (c *client) loginUser() {
 	ui.ClearScreen()
 	fmt.Println("** Inicio de sesión **")
 
 	username := ui.ReadInput("Nombre de usuario")
-	password := ui.ReadInput("Contraseña")
+	password := ui.ReadPassword("Contraseña")
+	defer crypto.Wipe(password)
 
 	res := c.sendRequest(api.Request{
 		Action:   api.ActionLogin,
 		Username: username,
-		Password: password,
+		Password: string(password),
 	})
 
+	// Si el usuario tiene 2FA activado, pedimos el código y repetimos el login.
+	if res.TwoFactorRequired {
+		code := ui.ReadInput("Código 2FA")
+		res = c.sendRequest(api.Request{
+			Action:   api.ActionLogin,
+			Username: username,
+			Password: string(password),
+			Code:     code,
+		})
+	}
+
 	fmt.Println("Éxito:", res.Success)
 	fmt.Println("Mensaje:", res.Message)
 
 	// Si login fue exitoso, guardamos currentUser y el token.
 	if res.Success {
-		c.currentUser = username
-		c.authToken = res.Token
+		c.startSession(username, authPassword, password, res)
+		fmt.Println("Sesión iniciada con éxito. Token guardado.")
+	}
+}
+
+// startSession guarda el estado de la sesión (a partir de la respuesta de
+// un login correcto) y desbloquea la clave de firma local. Si el servidor
+// dice que la contraseña ha caducado, obliga a cambiarla antes de volver al
+// menú (o cierra la sesión si no se cambia).
+func (c *client) startSession(username, method string, password []byte, res api.Response) {
+	c.wipeSession()
+	c.currentUser = username
+	c.authToken = res.Token
+	c.refreshToken = res.RefreshToken
+	c.authMethod = method
+	c.startEvents()
+	c.setSessionKey(res.SessionKey)
+
+	c.openDataKey(password, res.DataKey)
+
+	key, err := loadSigningKey(username, password)
+	switch {
+	case err != nil:
+		fmt.Println("Aviso: no se ha podido abrir la clave de firma:", err)
+	case key == nil:
+		fmt.Println("Aviso: este equipo no tiene la clave de firma de", username)
+	}
+	c.signKey = key
+	if key != nil {
+		c.publishKeys()
+	}
+
+	if res.MustChangePassword {
+		c.forcePasswordChange(password)
+	}
+}
+
+// setSessionKey guarda la clave de sesión 'encoded' (base64) que manda el
+// servidor, en lugar de la que hubiera. Sin ella, Data viaja sin cifrar.
+func (c *client) setSessionKey(encoded string) {
+	crypto.Wipe(c.sessionKey)
+	c.sessionKey = nil
+	if encoded == "" {
+		return
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != crypto.KeySize {
+		fmt.Println("Aviso: clave de sesión no válida; los datos viajarán sin cifrar")
+		return
+	}
+	c.sessionKey = key
+}
+
+// openDataKey desenvuelve con la contraseña la clave de datos que manda el
+// servidor al iniciar sesión. Si el usuario aún no tiene, genera una nueva
+// que se enviará envuelta con el primer updateData.
+func (c *client) openDataKey(password []byte, wrapped string) {
+	if wrapped != "" {
+		key, err := crypto.UnwrapDataKey(wrapped, password)
+		if err != nil {
+			fmt.Println("Aviso: no se ha podido abrir la clave de datos:", err)
+			return
+		}
+		c.dataKey = key
+		return
+	}
+	key, err := crypto.NewDataKey()
+	if err == nil {
+		c.pendingKey, err = crypto.WrapDataKey(key, password)
+	}
+	if err != nil {
+		crypto.Wipe(key)
+		fmt.Println("Aviso: no se ha podido generar la clave de datos:", err)
+		return
+	}
+	c.dataKey = key
+}
+
+// loginSRP realiza un login con SRP-6a: se demuestra conocer la contraseña
+// sin enviarla y se comprueba a su vez que el servidor conoce el verificador.
+func (c *client) loginSRP() {
+	ui.ClearScreen()
+	fmt.Println("** Inicio de sesión con SRP **")
+
+	username := ui.ReadInput("Nombre de usuario")
+	password := ui.ReadPassword("Contraseña")
+	defer crypto.Wipe(password)
+
+	res := c.doLoginSRP(username, password)
+
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+
+	if res.Success {
+		c.startSession(username, authSRP, password, res)
+		fmt.Println("Sesión iniciada con éxito. Servidor autenticado. Token guardado.")
+	}
+}
+
+// doLoginSRP ejecuta las dos rondas del protocolo SRP contra el servidor.
+func (c *client) doLoginSRP(username string, password []byte) api.Response {
+	srp, err := crypto.NewSRPClient(username, password)
+	if err != nil {
+		return api.Response{Success: false, Message: "Error iniciando SRP: " + err.Error()}
+	}
+	defer srp.Wipe()
+
+	// Ronda 1: enviamos A y recibimos la sal y B
+	m1, res := c.srpChallenge(srp, username)
+	if !res.Success {
+		return res
+	}
+
+	var code string
+	if res.TwoFactorRequired {
+		code = ui.ReadInput("Código 2FA")
+	}
+
+	// Ronda 2: enviamos M1 y comprobamos la M2 del servidor
+	res = c.sendRequest(api.Request{
+		Action:   api.ActionSRPVerify,
+		Username: username,
+		Code:     code,
+		SRP:      &api.SRPParams{M1: base64.StdEncoding.EncodeToString(m1)},
+	})
+	if !res.Success {
+		return res
+	}
+	var m2 []byte
+	if res.SRP != nil {
+		m2, _ = base64.StdEncoding.DecodeString(res.SRP.M2)
+	}
+	if !srp.VerifyServer(m2) {
+		return api.Response{Success: false, Message: "El servidor no ha demostrado conocer el verificador"}
+	}
+	return res
+}
+
+// srpChallenge ejecuta la primera ronda de SRP (envía A, recibe la sal y B)
+// y calcula la prueba M1. Devuelve también la respuesta del servidor, que
+// indica si hace falta el código 2FA; si no tiene éxito, M1 es nil.
+func (c *client) srpChallenge(srp *crypto.SRPClient, username string) ([]byte, api.Response) {
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionSRPBegin,
+		Username: username,
+		SRP:      &api.SRPParams{A: base64.StdEncoding.EncodeToString(srp.A())},
+	})
+	if !res.Success {
+		return nil, res
+	}
+	if res.SRP == nil {
+		return nil, api.Response{Success: false, Message: "Respuesta SRP mal formada"}
+	}
+	salt, err1 := base64.StdEncoding.DecodeString(res.SRP.Salt)
+	B, err2 := base64.StdEncoding.DecodeString(res.SRP.B)
+	if err1 != nil || err2 != nil {
+		return nil, api.Response{Success: false, Message: "Respuesta SRP mal formada"}
+	}
+	m1, err := srp.ProcessChallenge(salt, B)
+	if err != nil {
+		return nil, api.Response{Success: false, Message: "Reto SRP no válido: " + err.Error()}
+	}
+	return m1, res
+}
+
+// loginRecovery inicia sesión usando un código de recuperación
+// en lugar del código 2FA (por ejemplo, si se ha perdido el móvil).
+func (c *client) loginRecovery() {
+	ui.ClearScreen()
+	fmt.Println("** Inicio de sesión con código de recuperación **")
+
+	username := ui.ReadInput("Nombre de usuario")
+	password := ui.ReadPassword("Contraseña")
+	defer crypto.Wipe(password)
+	code := ui.ReadInput("Código de recuperación")
+
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionLoginRecovery,
+		Username: username,
+		Password: string(password),
+		Code:     code,
+	})
+
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+
+	if res.Success {
+		c.startSession(username, authPassword, password, res)
+		fmt.Println("Sesión iniciada con éxito. Token guardado.")
+	}
+}
+
+// loginCert inicia sesión con el certificado de cliente (envCert) en lugar
+// de la contraseña, que sólo se pide para abrir la clave de datos y la de
+// firma, que siguen cifradas con ella; no se envía al servidor.
+func (c *client) loginCert() {
+	ui.ClearScreen()
+	fmt.Println("** Inicio de sesión con certificado **")
+
+	if c.tls == nil || len(c.tls.Certificates) == 0 || c.tls.Certificates[0].Leaf == nil {
+		fmt.Printf("No hay certificado de cliente (%s y %s).\n", envCert, envKey)
+		return
+	}
+	username := c.tls.Certificates[0].Leaf.Subject.CommonName
+	fmt.Println("Usuario del certificado:", username)
+	password := ui.ReadPassword("Contraseña (sólo para abrir tus claves en este equipo)")
+	defer crypto.Wipe(password)
+
+	req := api.Request{Action: api.ActionCertLogin, Username: username}
+	res := c.sendRequest(req)
+	if res.TwoFactorRequired {
+		req.Code = ui.ReadInput("Código 2FA")
+		res = c.sendRequest(req)
+	}
+
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+
+	if res.Success {
+		c.startSession(username, authPassword, password, res)
 		fmt.Println("Sesión iniciada con éxito. Token guardado.")
 	}
 }
@@ -181,20 +680,77 @@ func (c *client) fetchData() {
 		return
 	}
 
-	// Hacemos la request con ActionFetchData
+	res, sig, err := c.requestData()
+	if err != nil {
+		fmt.Println("Error descifrando los datos:", err)
+		return
+	}
+
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+
+	// Si fue exitoso, mostramos la data recibida y el resultado de su firma
+	if res.Success {
+		fmt.Println("Tus datos:", res.Data)
+		fmt.Println("Firma:", sig)
+	}
+}
+
+// requestData pide los datos del usuario con ActionFetchData, quita el
+// cifrado de sesión, verifica la firma (hecha sobre el texto cifrado) y los
+// descifra con la clave de datos en res.Data. Devuelve también el resultado
+// de verifySignature.
+func (c *client) requestData() (api.Response, string, error) {
 	res := c.sendRequest(api.Request{
 		Action:   api.ActionFetchData,
 		Username: c.currentUser,
 		Token:    c.authToken,
+		Sealed:   c.sessionKey != nil,
+		Format:   c.dataFormat,
 	})
+	if res.Success && res.Sealed {
+		data, err := crypto.OpenSessionAs(res.Format, c.sessionKey, crypto.ToClient, c.currentUser, api.ActionFetchData, res.Data)
+		if err != nil {
+			return res, "", err
+		}
+		res.Data = string(data)
+	}
+	if !res.Success {
+		return res, "", nil
+	}
+	seen := res.Data
+	c.seenData = &seen
 
-	fmt.Println("Éxito:", res.Success)
-	fmt.Println("Mensaje:", res.Message)
+	sig := verifySignature(c.currentUser, res)
+	if !crypto.IsSealedUserData(res.Data) {
+		if res.Data != "" {
+			fmt.Println("Aviso: estos datos se guardaron antes del cifrado en el cliente; se cifrarán al actualizarlos.")
+		}
+		return res, sig, nil
+	}
+	if c.dataKey == nil {
+		return res, sig, errors.New("no hay clave de datos en esta sesión")
+	}
+	plain, err := crypto.OpenUserData(c.dataKey, c.currentUser, res.Data)
+	if err != nil {
+		return res, sig, err
+	}
+	res.Data = string(plain)
+	crypto.Wipe(plain)
+	return res, sig, nil
+}
 
-	// Si fue exitoso, mostramos la data recibida
-	if res.Success {
-		fmt.Println("Tus datos:", res.Data)
+// verifySignature describe el resultado de verificar la firma de res.Data.
+func verifySignature(username string, res api.Response) string {
+	if res.Signature == "" {
+		return "sin firmar"
+	}
+	pub, err1 := base64.StdEncoding.DecodeString(res.PublicKey)
+	sig, err2 := base64.StdEncoding.DecodeString(res.Signature)
+	if err1 != nil || err2 != nil || !crypto.VerifyUserData(pub, username, []byte(res.Data), sig) {
+		return "INVÁLIDA"
 	}
+	return "válida (autor " + username + ")"
 }
 
 // updateData pide nuevo texto y lo envía al servidor con ActionUpdateData.
@@ -210,16 +766,105 @@ func (c *client) updateData() {
 	// Leemos la nueva Data
 	newData := ui.ReadInput("Introduce el contenido que desees almacenar")
 
-	// Enviamos la solicitud de actualización
-	res := c.sendRequest(api.Request{
-		Action:   api.ActionUpdateData,
+	res, err := c.storeData(newData)
+	if err != nil {
+		fmt.Println("Error cifrando los datos:", err)
+		return
+	}
+
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+}
+
+// storeData cifra 'newData' con la clave de datos, firma el resultado con la
+// clave local (si la tenemos) y lo envía con ActionUpdateData, cifrado además
+// con la clave de sesión. Si ya hemos leído o escrito los datos en esta
+// sesión, el servidor sólo los acepta si nadie los ha cambiado desde
+// entonces (Request.Expected).
+func (c *client) storeData(newData string) (api.Response, error) {
+	if c.dataKey == nil {
+		return api.Response{}, errors.New("no hay clave de datos en esta sesión")
+	}
+	data, err := crypto.SealUserData(c.dataKey, c.currentUser, []byte(newData))
+	if err != nil {
+		return api.Response{}, err
+	}
+
+	var sig string
+	if c.signKey != nil {
+		sig = base64.StdEncoding.EncodeToString(crypto.SignUserData(c.signKey, c.currentUser, []byte(data)))
+	}
+
+	req := api.Request{
+		Action:    api.ActionUpdateData,
+		Username:  c.currentUser,
+		Token:     c.authToken,
+		Data:      data,
+		Signature: sig,
+		DataKey:   c.pendingKey,
+		Expected:  c.seenData,
+	}
+	if c.sessionKey != nil {
+		sealed, err := crypto.SealSessionAs(c.dataFormat, c.sessionKey, crypto.ToServer, c.currentUser, api.ActionUpdateData, []byte(data))
+		if err != nil {
+			return api.Response{}, err
+		}
+		req.Data, req.Sealed, req.Format = sealed, true, c.dataFormat
+	}
+	res := c.sendRequest(req)
+	// Data va cifrado con la clave de la sesión del token caducado:
+	// sendRequest no lo puede reenviar, así que se cifra otra vez
+	if res.Code == api.ErrTokenExpired && req.Sealed && req.Token == c.authToken && c.refreshSession() {
+		return c.storeData(newData)
+	}
+	if res.Success {
+		c.pendingKey = ""
+		c.seenData = &data
+	}
+	return res, nil
+}
+
+// enable2FA activa el doble factor y muestra (una única vez)
+// el secreto TOTP y los códigos de recuperación.
+func (c *client) enable2FA() {
+	ui.ClearScreen()
+	fmt.Println("** Activar 2FA **")
+
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+
+	req := api.Request{
+		Action:   api.ActionEnable2FA,
 		Username: c.currentUser,
 		Token:    c.authToken,
-		Data:     newData,
-	})
+	}
+	res := c.sendRequest(req)
+	if res.Code == api.ErrTwoFactorRequired {
+		// Ya estaba activado: cambiarlo hay que confirmarlo
+		fmt.Println("Ya tienes 2FA activado; se generarán un secreto y unos códigos nuevos.")
+		if code := ui.ReadInput("Código 2FA actual (vacío para usar la contraseña)"); code != "" {
+			req.Code = code
+		} else {
+			password := ui.ReadPassword("Contraseña")
+			defer crypto.Wipe(password)
+			req.Password = string(password)
+		}
+		res = c.sendRequest(req)
+	}
 
 	fmt.Println("Éxito:", res.Success)
 	fmt.Println("Mensaje:", res.Message)
+
+	if res.Success {
+		fmt.Println("Añade esta URI a tu app de autenticación:")
+		fmt.Println(" ", res.Data)
+		fmt.Println("Códigos de recuperación (de un solo uso):")
+		for _, code := range res.RecoveryCodes {
+			fmt.Println(" ", code)
+		}
+	}
 }
 
 // logoutUser llama a la acción logout en el servidor, y si es exitosa,
@@ -233,7 +878,9 @@ func (c *client) logoutUser() {
 		return
 	}
 
-	// Llamamos al servidor con la acción ActionLogout
+	// Llamamos al servidor con la acción ActionLogout, cerrando antes el
+	// canal de avisos para que no nos avise de nuestro propio logout
+	c.stopEvents()
 	res := c.sendRequest(api.Request{
 		Action:   api.ActionLogout,
 		Username: c.currentUser,
@@ -243,27 +890,269 @@ func (c *client) logoutUser() {
 	fmt.Println("Éxito:", res.Success)
 	fmt.Println("Mensaje:", res.Message)
 
-	// Si fue exitoso, limpiamos la sesión local.
-	if res.Success {
-		c.currentUser = ""
-		c.authToken = ""
+	// Si fue exitoso, limpiamos la sesión local; si no, sigue abierta,
+	// salvo que el servidor ya la diera por cerrada
+	if res.Success || res.Code == api.ErrTokenExpired {
+		c.wipeSession()
+	} else {
+		c.startEvents()
 	}
 }
 
-// sendRequest envía un POST JSON a la URL del servidor y
-// devuelve la respuesta decodificada. Se usa para todas las acciones.
+// wipeSession borra las claves de firma, sesión y datos y olvida la sesión,
+// con su canal de avisos.
+func (c *client) wipeSession() {
+	c.stopEvents()
+	crypto.Wipe(c.signKey, c.sessionKey, c.dataKey)
+	c.currentUser = ""
+	c.authToken = ""
+	c.refreshToken = ""
+	c.authMethod = ""
+	c.signKey = nil
+	c.sessionKey = nil
+	c.dataKey = nil
+	c.pendingKey = ""
+	c.seenData = nil
+}
+
+// sendRequest envía la petición al servidor y devuelve la respuesta
+// decodificada. Con gRPC, todas van por Call; si no, las acciones con ruta
+// REST (api.Routes) van por ella y las demás, por POST JSON a /api/v2, con
+// la versión más reciente del protocolo. Los campos propios de la acción
+// viajan en Payload (ver api.RegisterPayload y los demás), pero quien llama
+// sólo ve los sueltos.
 func (c *client) sendRequest(req api.Request) api.Response {
-	jsonData, _ := json.Marshal(req)
-	resp, err := http.Post("http://localhost:8080/api", "application/json", bytes.NewBuffer(jsonData))
+	res := c.send(req)
+	// Token caducado: se renueva con el de refresco y se repite la
+	// petición, salvo si lleva Data cifrado con la clave de la sesión
+	// anterior (ver storeData). Si sólo pide la respuesta cifrada, quien
+	// llama la abre después con la clave nueva.
+	sealedData := req.Sealed && req.Data != ""
+	if res.Code == api.ErrTokenExpired && req.Token != "" && req.Token == c.authToken && !sealedData && c.refreshSession() {
+		req.Token = c.authToken
+		res = c.send(req)
+	}
+	if !res.Success && res.RequestID != "" {
+		// Con él, el administrador encuentra la petición en el log del servidor
+		fmt.Println("Identificador de la petición:", res.RequestID)
+	}
+	return res
+}
+
+// send empaqueta 'req' (ver api.Request.PackPayload), la envía y
+// desempaqueta la respuesta.
+func (c *client) send(req api.Request) api.Response {
+	req.APIVersion = api.CurrentAPIVersion
+	req, err := req.PackPayload()
+	if err != nil {
+		fmt.Println("Error al preparar la petición:", err)
+		return api.Response{Success: false, Message: "Error de conexión"}
+	}
+	res := c.roundTrip(req)
+	// Si el servidor pide frenar, se espera lo que diga y se repite, salvo
+	// que sea demasiado: entonces se muestra el error al usuario
+	for i := 0; i < maxRateRetries && res.Code == api.ErrRateLimited; i++ {
+		wait := time.Duration(res.RetryAfter) * time.Second
+		if wait <= 0 || wait > maxBackoff {
+			break
+		}
+		fmt.Printf("El servidor pide esperar %d s; se reintenta...\n", res.RetryAfter)
+		time.Sleep(wait)
+		res = c.roundTrip(req)
+	}
+	res, err = res.UnpackPayload(req.Action)
+	if err != nil {
+		fmt.Println("Respuesta del servidor no válida:", err)
+		return api.Response{Success: false, Message: "Error de conexión"}
+	}
+	return res
+}
+
+// refreshSession cambia el token de refresco por un token de sesión nuevo
+// (y otro token de refresco), con su clave de sesión. Devuelve false si no
+// se ha podido: la sesión se ha cerrado o ha caducado.
+func (c *client) refreshSession() bool {
+	if c.currentUser == "" || c.refreshToken == "" {
+		return false
+	}
+	res := c.send(api.Request{
+		Action:       api.ActionRefresh,
+		Username:     c.currentUser,
+		RefreshToken: c.refreshToken,
+	})
+	if !res.Success || res.Token == "" {
+		// El token de refresco no vuelve a servir
+		c.refreshToken = ""
+		return false
+	}
+	c.authToken = res.Token
+	c.refreshToken = res.RefreshToken
+	c.setSessionKey(res.SessionKey)
+	return true
+}
+
+// newRequestID genera un identificador de petición: 128 bits aleatorios en
+// hexadecimal.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// roundTrip envía 'req' tal cual por gRPC o HTTP, con un identificador de
+// petición nuevo (api.RequestIDHeader), y devuelve la respuesta.
+func (c *client) roundTrip(req api.Request) api.Response {
+	id := newRequestID()
+	if c.rpc != nil {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), strings.ToLower(api.RequestIDHeader), id)
+		msg := apipb.FromRequest(req)
+		var opts []grpc.CallOption
+		if c.gzipMin > 0 && proto.Size(msg) >= c.gzipMin {
+			opts = append(opts, grpc.UseCompressor(grpcgzip.Name))
+		}
+		res, err := c.rpc.Call(ctx, msg, opts...)
+		if err != nil {
+			fmt.Println("Error al contactar con el servidor:", err)
+			return api.Response{Success: false, Message: "Error de conexión"}
+		}
+		return res.API()
+	}
+	// Con PRAC_ENABLE_CSRF en el servidor, la primera petición sin token
+	// falla, pero trae la cookie: se repite con él
+	sent := c.csrfToken
+	res := c.httpRoundTrip(req, id)
+	if res.Code == api.ErrCSRF && c.csrfToken != "" && c.csrfToken != sent {
+		res = c.httpRoundTrip(req, id)
+	}
+	return res
+}
+
+// httpRoundTrip envía 'req' por HTTP con el identificador 'id' y, si el
+// servidor lo pide, el token CSRF, que se devuelve como cookie y cabecera
+// (doble envío, ver api.CSRFCookie).
+func (c *client) httpRoundTrip(req api.Request, id string) api.Response {
+	httpReq, err := c.newHTTPRequest(req)
+	if err != nil {
+		fmt.Println("Error al preparar la petición:", err)
+		return api.Response{Success: false, Message: "Error de conexión"}
+	}
+	httpReq.Header.Set(api.RequestIDHeader, id)
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	if c.csrfToken != "" {
+		httpReq.AddCookie(&http.Cookie{Name: api.CSRFCookie, Value: c.csrfToken})
+		httpReq.Header.Set(api.CSRFHeader, c.csrfToken)
+	}
+	resp, err := c.http.Do(httpReq)
 	if err != nil {
 		fmt.Println("Error al contactar con el servidor:", err)
 		return api.Response{Success: false, Message: "Error de conexión"}
 	}
 	defer resp.Body.Close()
+	for _, ck := range resp.Cookies() {
+		if ck.Name == api.CSRFCookie && ck.Value != "" {
+			c.csrfToken = ck.Value
+		}
+	}
 
-	// Leemos el body de respuesta y lo desempaquetamos en un api.Response
+	// Leemos el body de respuesta y lo desempaquetamos en un api.Response.
+	// Con las rutas REST, el estado HTTP no aporta nada que no diga ya.
 	body, _ := io.ReadAll(resp.Body)
 	var res api.Response
-	_ = json.Unmarshal(body, &res)
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt == api.ContentTypeCBOR {
+		_ = api.UnmarshalCBOR(body, &res)
+	} else {
+		_ = json.Unmarshal(body, &res)
+	}
 	return res
 }
+
+// contentType es el formato de las peticiones HTTP (ver envWire).
+func (c *client) contentType() string {
+	if c.cbor {
+		return api.ContentTypeCBOR
+	}
+	return api.ContentTypeJSON
+}
+
+// setBody pone 'data' como cuerpo de 'httpReq', en el formato de
+// contentType y comprimido con gzip si ocupa al menos gzipMin.
+func (c *client) setBody(httpReq *http.Request, data []byte) {
+	httpReq.Header.Set("Content-Type", c.contentType())
+	if c.gzipMin > 0 && len(data) >= c.gzipMin {
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzipLevel)
+		zw.Write(data)
+		if zw.Close() == nil {
+			httpReq.Header.Set("Content-Encoding", "gzip")
+			data = buf.Bytes()
+		}
+	}
+	httpReq.Body = io.NopCloser(bytes.NewReader(data))
+	httpReq.ContentLength = int64(len(data))
+	httpReq.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(data)), nil }
+}
+
+// marshal codifica 'req' en el formato de contentType.
+func (c *client) marshal(req api.Request) ([]byte, error) {
+	if c.cbor {
+		return api.MarshalCBOR(req)
+	}
+	return json.Marshal(req)
+}
+
+// newHTTPRequest monta la petición HTTP de 'req': la de su ruta REST, con
+// el token en Authorization, o un POST a /api/v2 con todo en el cuerpo (en
+// JSON o en CBOR, ver envWire).
+func (c *client) newHTTPRequest(req api.Request) (*http.Request, error) {
+	rt, ok := api.Routes[req.Action]
+	if !ok {
+		data, err := c.marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		httpReq, err := http.NewRequest(http.MethodPost, c.baseURL+api.APIPathV2, nil)
+		if err != nil {
+			return nil, err
+		}
+		c.setBody(httpReq, data)
+		httpReq.Header.Set("Accept", c.contentType())
+		return httpReq, nil
+	}
+	token := req.Token
+	var body []byte
+	target := c.baseURL + rt.Path
+	if rt.Method == http.MethodGet {
+		q := url.Values{}
+		if req.Sealed {
+			q.Set("sealed", "true")
+		}
+		if req.Format != "" {
+			q.Set("format", req.Format)
+		}
+		if len(req.Payload) > 0 {
+			q.Set("payload", "true")
+		}
+		if len(q) > 0 {
+			target += "?" + q.Encode()
+		}
+	} else {
+		req.Token = ""
+		data, err := c.marshal(req)
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	httpReq, err := http.NewRequest(rt.Method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		c.setBody(httpReq, body)
+	}
+	httpReq.Header.Set("Accept", c.contentType())
+	if token != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	return httpReq, nil
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"prac/pkg/api"
+)
+
+// startEvents abre el canal de avisos del servidor (api.EventsPath) con la
+// sesión actual y los va mostrando mientras dure. Si no se puede abrir, el
+// cliente funciona igual, sin avisos.
+func (c *client) startEvents() {
+	c.stopEvents()
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.authToken)
+	url := "ws" + strings.TrimPrefix(c.baseURL, "http") + api.EventsPath
+	dialer := websocket.Dialer{TLSClientConfig: c.tls, HandshakeTimeout: websocket.DefaultDialer.HandshakeTimeout}
+	conn, _, err := dialer.Dial(url, header)
+	if err != nil {
+		c.log.Printf("Sin avisos del servidor: %v\n", err)
+		return
+	}
+	c.events = conn
+	go showEvents(conn)
+}
+
+// stopEvents cierra el canal de avisos, si está abierto.
+func (c *client) stopEvents() {
+	if c.events != nil {
+		c.events.Close()
+		c.events = nil
+	}
+}
+
+// showEvents muestra los avisos de 'conn' hasta que se cierra. Sólo
+// escribe en pantalla: el estado de la sesión lo cambia el menú, que se
+// enterará de un EventLogout en la siguiente petición.
+func showEvents(conn *websocket.Conn) {
+	for {
+		var ev api.Event
+		if err := conn.ReadJSON(&ev); err != nil {
+			return
+		}
+		switch ev.Type {
+		case api.EventDataChanged, api.EventMessage, api.EventGroup, api.EventShared:
+			fmt.Printf("\n[aviso] %s\n", ev.Message)
+		case api.EventLogout:
+			fmt.Printf("\n[aviso] %s; vuelve a iniciar sesión.\n", ev.Message)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package client
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/ui"
+)
+
+const (
+	fileChunkSize = 256 << 10 // bytes en claro de cada trozo que se sube
+	maxUploadSize = 63 << 20  // el servidor admite 64 MiB ya cifrados (con las cabeceras de crypto.NewEncryptWriter)
+)
+
+// files es la opción del menú de los ficheros: subir uno desde el disco,
+// descargar uno ya subido, compartirlo con otro usuario (o dejar de
+// hacerlo) y descargar los que otros han compartido.
+func (c *client) files() {
+	ui.ClearScreen()
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+	options := []string{
+		"Subir fichero",
+		"Descargar fichero",
+		"Compartir fichero",
+		"Dejar de compartir fichero",
+		"Ficheros compartidos conmigo",
+		"Volver",
+	}
+	var err error
+	switch ui.PrintMenu("** Ficheros **", options) {
+	case 1:
+		err = c.uploadFile(ui.ReadInput("Ruta del fichero"))
+	case 2:
+		err = c.downloadOwnFile(ui.ReadInput("Nombre del fichero"), ui.ReadInput("Guardar en"))
+	case 3:
+		name := ui.ReadInput("Nombre del fichero")
+		err = c.shareFile(name, ui.ReadInput("Compartir con"))
+	case 4:
+		name := ui.ReadInput("Nombre del fichero")
+		res := c.sendRequest(api.Request{
+			Action:   api.ActionUnshareData,
+			Username: c.currentUser,
+			Token:    c.authToken,
+			To:       ui.ReadInput("Usuario"),
+			File:     &api.FileInfo{Name: name},
+		})
+		fmt.Println("Mensaje:", res.Message)
+	case 5:
+		err = c.sharedFiles()
+	}
+	if err != nil {
+		fmt.Println("Error:", err)
+	}
+}
+
+// fileKey deriva de la clave de datos la clave del fichero 'name'. Cada
+// fichero tiene la suya para poder compartirlo sin dar acceso a los demás.
+func (c *client) fileKey(name string) []byte {
+	return crypto.DeriveKey(c.dataKey, "file\x00"+name)
+}
+
+// uploadFile sube el fichero de 'path', con su nombre base. Se cifra con
+// la clave del fichero (ver fileKey) como un flujo STREAM (ver
+// crypto.NewEncryptWriter), que lleva marcado su último bloque: si el
+// servidor quita trozos del final, el descifrado falla en lugar de dar un
+// fichero recortado. El flujo cifrado se escribe antes en un fichero
+// temporal, porque cada trozo lleva ya el tamaño y el hash del total (que
+// son los del fichero cifrado), y de ahí se sube por trozos de
+// fileChunkSize: nunca está entero en memoria.
+func (c *client) uploadFile(path string) error {
+	if c.dataKey == nil {
+		return errors.New("no hay clave de datos en esta sesión")
+	}
+	// Sin la clave de datos en el servidor, en el siguiente login se
+	// generaría otra y el fichero ya no se podría descifrar
+	if c.pendingKey != "" {
+		return errors.New("guarda antes tus datos (Actualizar datos) para que el servidor tenga tu clave de datos")
+	}
+	if path == "" {
+		return errors.New("falta la ruta del fichero")
+	}
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	st, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Size() > maxUploadSize {
+		return fmt.Errorf("el fichero supera el tamaño máximo (%d bytes)", maxUploadSize)
+	}
+	name := filepath.Base(path)
+	key := c.fileKey(name)
+	defer crypto.Wipe(key)
+
+	tmp, err := os.CreateTemp("", "prac-upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	h := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(tmp, h))
+	if err := crypto.EncryptStream(w, src, key, crypto.DefaultStreamChunk); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	info := &api.FileInfo{
+		Name:   name,
+		Size:   size,
+		Hash:   hex.EncodeToString(h.Sum(nil)),
+		Chunks: int((size + fileChunkSize - 1) / fileChunkSize),
+	}
+
+	chunk := make([]byte, fileChunkSize)
+	for i := 0; i < info.Chunks; i++ {
+		n, err := tmp.ReadAt(chunk, int64(i)*fileChunkSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			fmt.Println()
+			return err
+		}
+		res := c.sendRequest(api.Request{
+			Action:   api.ActionUploadFileChunk,
+			Username: c.currentUser,
+			Token:    c.authToken,
+			File:     info,
+			Chunk:    i,
+			Data:     base64.StdEncoding.EncodeToString(chunk[:n]),
+		})
+		if !res.Success {
+			fmt.Println()
+			return errors.New(res.Message)
+		}
+		ui.PrintProgressBar(i+1, info.Chunks, 40)
+	}
+	fmt.Printf("Fichero %q subido (%d bytes).\n", name, st.Size())
+	return nil
+}
+
+// downloadOwnFile descarga el fichero 'name' del usuario en 'path'.
+func (c *client) downloadOwnFile(name, path string) error {
+	if c.dataKey == nil {
+		return errors.New("no hay clave de datos en esta sesión")
+	}
+	if name == "" {
+		return errors.New("falta el nombre del fichero")
+	}
+	key := c.fileKey(name)
+	defer crypto.Wipe(key)
+	return c.downloadFile(c.currentUser, name, path, key)
+}
+
+// downloadFile descarga el fichero 'name' de 'owner', lo descifra con
+// 'key' según van llegando los trozos y lo guarda en 'path' (por defecto,
+// con su nombre en el directorio actual). Lo descifrado va a un fichero
+// temporal junto a 'path', que sólo ocupa su lugar si el flujo termina en
+// su último bloque y el hash es el del fichero: si algo falla, no se
+// escribe nada.
+func (c *client) downloadFile(owner, name, path string, key []byte) error {
+	if path == "" {
+		path = filepath.Base(name)
+	}
+	req := api.Request{
+		Action:   api.ActionDownloadFileChunk,
+		Username: c.currentUser,
+		Token:    c.authToken,
+		File:     &api.FileInfo{Name: name},
+	}
+	if owner != c.currentUser {
+		req.Owner = owner
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".prac-download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // tras el Rename, ya no existe
+	defer tmp.Close()
+	chunks := &chunkReader{c: c, req: req, hash: sha256.New()}
+	w := bufio.NewWriter(tmp)
+	if err := crypto.DecryptStream(w, chunks, key); err != nil {
+		if chunks.err != nil {
+			return chunks.err
+		}
+		return fmt.Errorf("no se puede descifrar el fichero: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(chunks.hash.Sum(nil)) != chunks.info.Hash {
+		return errors.New("el fichero descargado no coincide con su hash")
+	}
+	size, err := tmp.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	fmt.Printf("Fichero guardado en %s (%d bytes).\n", path, size)
+	return nil
+}
+
+// chunkReader lee el fichero cifrado de 'req' pidiendo al servidor un
+// trozo cada vez que se acaba el anterior, y va calculando su hash.
+type chunkReader struct {
+	c    *client
+	req  api.Request
+	info *api.FileInfo // el del primer trozo; los demás tienen que traer el mismo
+	next int           // siguiente trozo que se pide
+	buf  []byte        // lo que queda del trozo actual
+	hash hash.Hash
+	err  error // por qué ha fallado la descarga (no el descifrado)
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.info != nil && r.next >= r.info.Chunks {
+			return 0, io.EOF
+		}
+		r.err = r.fetch()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// fetch descarga el trozo r.next.
+func (r *chunkReader) fetch() error {
+	r.req.Chunk = r.next
+	res := r.c.sendRequest(r.req)
+	if !res.Success {
+		return errors.New(res.Message)
+	}
+	if res.File == nil || (r.info != nil && *res.File != *r.info) {
+		return errors.New("el fichero ha cambiado durante la descarga")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(res.Data)
+	if err != nil {
+		return fmt.Errorf("trozo %d no válido: %v", r.next, err)
+	}
+	r.info = res.File
+	r.hash.Write(sealed)
+	r.buf = sealed
+	r.next++
+	ui.PrintProgressBar(r.next, r.info.Chunks, 40)
+	return nil
+}
@@ -0,0 +1,81 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"prac/pkg/api"
+	"prac/pkg/ui"
+)
+
+// groups es la opción del menú de los grupos: crearlos, ver los propios,
+// gestionar sus miembros y leer o cambiar sus datos.
+func (c *client) groups() {
+	ui.ClearScreen()
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+	options := []string{
+		"Mis grupos",
+		"Crear grupo",
+		"Añadir miembro",
+		"Quitar miembro (o salir de un grupo)",
+		"Ver datos de un grupo",
+		"Cambiar datos de un grupo",
+		"Volver",
+	}
+	switch ui.PrintMenu("** Grupos **", options) {
+	case 1:
+		c.listGroups()
+	case 2:
+		c.groupRequest(api.Request{Action: api.ActionCreateGroup, Group: ui.ReadInput("Nombre del grupo")})
+	case 3:
+		group := ui.ReadInput("Grupo")
+		c.groupRequest(api.Request{Action: api.ActionAddGroupMember, Group: group, Member: ui.ReadInput("Usuario")})
+	case 4:
+		group := ui.ReadInput("Grupo")
+		member := ui.ReadInput("Usuario (vacío: tú)")
+		if member == "" {
+			member = c.currentUser
+		}
+		c.groupRequest(api.Request{Action: api.ActionRemoveGroupMember, Group: group, Member: member})
+	case 5:
+		res := c.groupRequest(api.Request{Action: api.ActionFetchGroupData, Group: ui.ReadInput("Grupo")})
+		if res.Success {
+			fmt.Println("Datos:", res.Data)
+		}
+	case 6:
+		group := ui.ReadInput("Grupo")
+		c.groupRequest(api.Request{Action: api.ActionUpdateGroupData, Group: group, Data: ui.ReadInput("Datos nuevos")})
+	}
+}
+
+// groupRequest envía 'req' con la sesión actual y muestra el resultado.
+func (c *client) groupRequest(req api.Request) api.Response {
+	req.Username, req.Token = c.currentUser, c.authToken
+	res := c.sendRequest(req)
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+	return res
+}
+
+// listGroups muestra los grupos del usuario con sus miembros.
+func (c *client) listGroups() {
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionListGroups,
+		Username: c.currentUser,
+		Token:    c.authToken,
+	})
+	if !res.Success {
+		fmt.Println("Mensaje:", res.Message)
+		return
+	}
+	if len(res.Groups) == 0 {
+		fmt.Println("No perteneces a ningún grupo.")
+		return
+	}
+	for _, g := range res.Groups {
+		fmt.Printf("  %s (dueño: %s): %s\n", g.Name, g.Owner, strings.Join(g.Members, ", "))
+	}
+}
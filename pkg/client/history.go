@@ -0,0 +1,133 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/ui"
+)
+
+// undoData deshace el último cambio de los datos: pide al servidor la
+// versión anterior a la actual, la muestra y, si el usuario confirma, la
+// vuelve a guardar con storeData (cifrada y firmada de nuevo, como una
+// versión más, así que también se puede deshacer).
+func (c *client) undoData() {
+	ui.ClearScreen()
+	fmt.Println("** Deshacer último cambio **")
+
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+
+	// Las versiones llegan por páginas, de la más antigua a la actual: las
+	// que interesan son las de la última
+	req := api.Request{
+		Action:   api.ActionListDataVersions,
+		Username: c.currentUser,
+		Token:    c.authToken,
+	}
+	var versions []api.DataVersion
+	for {
+		res := c.sendRequest(req)
+		if !res.Success {
+			fmt.Println("Mensaje:", res.Message)
+			return
+		}
+		versions = append(versions, res.Versions...)
+		if res.NextCursor == "" {
+			break
+		}
+		req.Cursor = res.NextCursor
+	}
+	if len(versions) < 2 {
+		fmt.Println("No hay cambios que deshacer.")
+		return
+	}
+	prev := versions[len(versions)-2]
+
+	data, err := c.requestVersion(prev.Version)
+	if err != nil {
+		fmt.Println("Error recuperando la versión anterior:", err)
+		return
+	}
+	when := "fecha desconocida"
+	if !prev.Time.IsZero() {
+		when = prev.Time.Local().Format("02/01/2006 15:04:05")
+	}
+	fmt.Printf("Versión %d (%s):\n%s\n", prev.Version, when, data)
+	if !ui.Confirm("¿Restaurar esta versión de tus datos?") {
+		return
+	}
+
+	res, err := c.storeData(data)
+	if err != nil {
+		fmt.Println("Error cifrando los datos:", err)
+		return
+	}
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+}
+
+// requestVersion pide la versión 'n' de los datos con
+// ActionFetchDataVersion y la descifra como requestData.
+func (c *client) requestVersion(n uint64) (string, error) {
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionFetchDataVersion,
+		Username: c.currentUser,
+		Token:    c.authToken,
+		Sealed:   c.sessionKey != nil,
+		Format:   c.dataFormat,
+		Version:  n,
+	})
+	if !res.Success {
+		return "", errors.New(res.Message)
+	}
+	if res.Sealed {
+		data, err := crypto.OpenSessionAs(res.Format, c.sessionKey, crypto.ToClient, c.currentUser, api.ActionFetchDataVersion, res.Data)
+		if err != nil {
+			return "", err
+		}
+		res.Data = string(data)
+	}
+	// Versiones anteriores al cifrado en el cliente (o vacías)
+	if !crypto.IsSealedUserData(res.Data) {
+		return res.Data, nil
+	}
+	if c.dataKey == nil {
+		return "", errors.New("no hay clave de datos en esta sesión")
+	}
+	plain, err := crypto.OpenUserData(c.dataKey, c.currentUser, res.Data)
+	if err != nil {
+		return "", err
+	}
+	defer crypto.Wipe(plain)
+	return string(plain), nil
+}
+
+// listLogins muestra los últimos inicios de sesión de la cuenta, para que
+// el usuario vea si alguien más ha entrado en ella.
+func (c *client) listLogins() {
+	ui.ClearScreen()
+	fmt.Println("** Últimos inicios de sesión **")
+
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionListLogins,
+		Username: c.currentUser,
+		Token:    c.authToken,
+	})
+	if !res.Success {
+		fmt.Println("Mensaje:", res.Message)
+		return
+	}
+	for _, l := range res.Logins {
+		fmt.Printf("  %s  %s\n", l.Time.Local().Format("02/01/2006 15:04:05"), l.Method)
+	}
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"fmt"
+	"slices"
+
+	"prac/pkg/api"
+)
+
+// fetchServerInfo pregunta al servidor su versión y sus funciones, para
+// ofrecer en los menús sólo lo que se puede usar. Si no contesta, se
+// sigue sin saberlo: quizá arranque después.
+func (c *client) fetchServerInfo() {
+	res := c.sendRequest(api.Request{Action: api.ActionServerInfo})
+	if !res.Success || res.Server == nil {
+		c.log.Printf("No se ha podido obtener la información del servidor: %s\n", res.Message)
+		return
+	}
+	c.server = res.Server
+	c.log.Printf("Servidor %s (protocolo %d-%d, en marcha desde %s): %v\n",
+		res.Server.Version, res.Server.MinAPIVersion, res.Server.MaxAPIVersion, formatDate(res.Server.Started), res.Server.Features)
+	if api.CurrentAPIVersion > res.Server.MaxAPIVersion {
+		fmt.Printf("Aviso: el servidor sólo conoce hasta la versión %d del protocolo.\n", res.Server.MaxAPIVersion)
+	}
+}
+
+// serverHas indica si el servidor tiene activa 'feature' (api.Feature*).
+// Si no se sabe, se supone que sí, y será el servidor el que diga que no.
+func (c *client) serverHas(feature string) bool {
+	return c.server == nil || slices.Contains(c.server.Features, feature)
+}
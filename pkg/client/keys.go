@@ -0,0 +1,64 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"prac/pkg/crypto"
+)
+
+// keyDir es el directorio local donde el cliente guarda las claves privadas
+// de cada usuario, cifradas con su contraseña. Nunca salen de esta máquina.
+const keyDir = "keys"
+
+// signKeyPath devuelve la ruta del fichero de clave de firma de 'username'.
+func signKeyPath(username string) string {
+	return filepath.Join(keyDir, username+".sign.key")
+}
+
+// newSigningKey genera una clave Ed25519 protegida con 'password' en un
+// fichero temporal. Devuelve la ruta temporal y la clave pública; el fichero
+// sólo se da por bueno (commitSigningKey) si el servidor acepta el registro.
+func newSigningKey(username string, password []byte) (string, ed25519.PublicKey, error) {
+	if err := os.MkdirAll(keyDir, 0700); err != nil {
+		return "", nil, fmt.Errorf("error creando %s: %v", keyDir, err)
+	}
+	tmp := signKeyPath(username) + ".tmp"
+	os.Remove(tmp) // restos de un registro anterior fallido
+
+	seed, err := crypto.CreateKeyFile(tmp, password)
+	if err != nil {
+		return "", nil, err
+	}
+	priv, err := crypto.SigningKeyFromSeed(seed)
+	crypto.Wipe(seed)
+	if err != nil {
+		os.Remove(tmp)
+		return "", nil, err
+	}
+	pub := priv.Public().(ed25519.PublicKey)
+	crypto.Wipe(priv)
+	return tmp, pub, nil
+}
+
+// commitSigningKey mueve el fichero temporal a su ruta definitiva.
+func commitSigningKey(username, tmp string) error {
+	return os.Rename(tmp, signKeyPath(username))
+}
+
+// loadSigningKey descifra la clave de firma local de 'username'.
+// Devuelve (nil, nil) si este equipo no tiene clave para ese usuario.
+func loadSigningKey(username string, password []byte) (ed25519.PrivateKey, error) {
+	seed, err := crypto.OpenKeyFile(signKeyPath(username), password)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(seed)
+	return crypto.SigningKeyFromSeed(seed)
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"fmt"
+
+	"prac/pkg/api"
+	"prac/pkg/ui"
+)
+
+// messages es la opción del menú de los mensajes entre usuarios: enviar
+// uno, o leer el buzón y borrar los ya leídos.
+func (c *client) messages() {
+	ui.ClearScreen()
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+	switch ui.PrintMenu("** Mensajes **", []string{"Enviar mensaje", "Ver buzón", "Volver"}) {
+	case 1:
+		c.sendMessage()
+	case 2:
+		c.readInbox()
+	}
+}
+
+// sendMessage pide el destinatario y el texto y lo envía.
+func (c *client) sendMessage() {
+	to := ui.ReadInput("Destinatario")
+	body := ui.ReadInput("Mensaje")
+	if to == "" || body == "" {
+		fmt.Println("Cancelado.")
+		return
+	}
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionSendMessage,
+		Username: c.currentUser,
+		Token:    c.authToken,
+		To:       to,
+		Data:     body,
+	})
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+}
+
+// readInbox muestra los mensajes del buzón, página a página, y deja
+// borrar los de cada página por su número.
+func (c *client) readInbox() {
+	cursor := ""
+	for {
+		res := c.sendRequest(api.Request{
+			Action:   api.ActionFetchMessages,
+			Username: c.currentUser,
+			Token:    c.authToken,
+			Cursor:   cursor,
+		})
+		if !res.Success {
+			fmt.Println("Mensaje:", res.Message)
+			return
+		}
+		if len(res.Messages) == 0 && cursor == "" {
+			fmt.Println("No tienes mensajes.")
+			return
+		}
+		for i, m := range res.Messages {
+			fmt.Printf("%d. [%s] %s:\n   %s\n", i+1, m.Time.Local().Format("02/01/2006 15:04:05"), m.From, m.Body)
+		}
+		for ui.Confirm("¿Borrar alguno de estos mensajes?") {
+			n := ui.ReadInt("Número del mensaje")
+			if n < 1 || n > len(res.Messages) {
+				fmt.Println("Número no válido.")
+				continue
+			}
+			del := c.sendRequest(api.Request{
+				Action:   api.ActionDeleteMessage,
+				Username: c.currentUser,
+				Token:    c.authToken,
+				Data:     res.Messages[n-1].ID,
+			})
+			fmt.Println("Mensaje:", del.Message)
+		}
+		if res.NextCursor == "" || !ui.Confirm("¿Ver más?") {
+			return
+		}
+		cursor = res.NextCursor
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/ui"
+)
+
+// loginOPAQUE realiza un login con OPAQUE: la contraseña no sale del equipo,
+// ambas partes se autentican y el token llega cifrado con la clave de sesión.
+func (c *client) loginOPAQUE() {
+	ui.ClearScreen()
+	fmt.Println("** Inicio de sesión con OPAQUE **")
+
+	username := ui.ReadInput("Nombre de usuario")
+	password := ui.ReadPassword("Contraseña")
+	defer crypto.Wipe(password)
+
+	res := c.doLoginOPAQUE(username, password)
+
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+
+	if res.Success {
+		c.startSession(username, authOPAQUE, password, res)
+		fmt.Println("Sesión iniciada con éxito. Servidor autenticado. Token guardado.")
+	}
+}
+
+// doRegisterOPAQUE ejecuta las dos rondas del registro OPAQUE.
+func (c *client) doRegisterOPAQUE(username string, password []byte, publicKey string) api.Response {
+	oc := crypto.NewOPAQUEClient(username, password)
+	defer oc.Wipe()
+	regReq, err := oc.RegistrationRequest()
+	if err != nil {
+		return api.Response{Success: false, Message: "Error iniciando OPAQUE: " + err.Error()}
+	}
+
+	// Ronda 1: contraseña cegada -> evaluación OPRF y clave pública del servidor
+	var regResp crypto.OPAQUERegistrationResponse
+	res := c.sendOPAQUE(api.ActionOPAQUERegisterInit, username, "", regReq, &regResp)
+	if !res.Success {
+		return res
+	}
+	record, _, err := oc.FinalizeRegistration(&regResp)
+	if err != nil {
+		return api.Response{Success: false, Message: "Respuesta OPAQUE no válida: " + err.Error()}
+	}
+
+	// Ronda 2: enviamos el registro junto con la clave pública de firma
+	raw, err := json.Marshal(record)
+	if err != nil {
+		return api.Response{Success: false, Message: "Error serializando el registro OPAQUE"}
+	}
+	return c.sendRequest(api.Request{
+		Action:    api.ActionOPAQUERegisterFinish,
+		Username:  username,
+		Data:      string(raw),
+		PublicKey: publicKey,
+	})
+}
+
+// doLoginOPAQUE ejecuta las dos rondas del login OPAQUE y descifra el token.
+func (c *client) doLoginOPAQUE(username string, password []byte) api.Response {
+	oc := crypto.NewOPAQUEClient(username, password)
+	defer oc.Wipe()
+	ke1, err := oc.LoginStart()
+	if err != nil {
+		return api.Response{Success: false, Message: "Error iniciando OPAQUE: " + err.Error()}
+	}
+
+	// Ronda 1: KE1 -> KE2
+	var ke2 crypto.OPAQUEKE2
+	res := c.sendOPAQUE(api.ActionOPAQUELoginInit, username, "", ke1, &ke2)
+	if !res.Success {
+		return res
+	}
+	ke3, sessionKey, _, err := oc.LoginFinish(&ke2)
+	if err != nil {
+		// Contraseña incorrecta o servidor que no conoce nuestro registro
+		return api.Response{Success: false, Message: "Credenciales inválidas o servidor no autenticado"}
+	}
+
+	var code string
+	if res.TwoFactorRequired {
+		code = ui.ReadInput("Código 2FA")
+	}
+
+	// Ronda 2: KE3 -> token cifrado con la clave de sesión
+	res = c.sendOPAQUE(api.ActionOPAQUELoginFinish, username, code, ke3, nil)
+	if !res.Success {
+		return res
+	}
+	sealed, err1 := base64.StdEncoding.DecodeString(res.Data)
+	sealedKey, err2 := base64.StdEncoding.DecodeString(res.SessionKey)
+	sealedRefresh, err3 := base64.StdEncoding.DecodeString(res.RefreshToken)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return api.Response{Success: false, Message: "Respuesta OPAQUE mal formada"}
+	}
+	tokenKey := crypto.OPAQUETokenKey(sessionKey)
+	defer crypto.Wipe(sessionKey, tokenKey)
+	token, err1 := crypto.Open(tokenKey, sealed, []byte(username))
+	dataKey, err2 := crypto.Open(tokenKey, sealedKey, []byte(username+"\x00sessionKey"))
+	refresh, err3 := crypto.Open(tokenKey, sealedRefresh, []byte(username+"\x00refreshToken"))
+	if err1 != nil || err2 != nil || err3 != nil {
+		return api.Response{Success: false, Message: "No se ha podido descifrar el token de sesión"}
+	}
+	res.Token, res.Data, res.RefreshToken = string(token), "", string(refresh)
+	res.SessionKey = base64.StdEncoding.EncodeToString(dataKey)
+	crypto.Wipe(dataKey)
+	return res
+}
+
+// sendOPAQUE envía 'msg' como JSON en Data y, si 'out' no es nil,
+// descodifica en él el mensaje OPAQUE de la respuesta.
+func (c *client) sendOPAQUE(action, username, code string, msg, out any) api.Response {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return api.Response{Success: false, Message: "Error serializando el mensaje OPAQUE"}
+	}
+	res := c.sendRequest(api.Request{
+		Action:   action,
+		Username: username,
+		Code:     code,
+		Data:     string(raw),
+	})
+	if res.Success && out != nil {
+		if err := json.Unmarshal([]byte(res.Data), out); err != nil {
+			return api.Response{Success: false, Message: "Respuesta OPAQUE mal formada"}
+		}
+	}
+	return res
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/ui"
+)
+
+// Métodos con los que se puede haber iniciado la sesión (client.authMethod).
+// Determinan cómo se cambia la contraseña.
+const (
+	authPassword = "password"
+	authSRP      = "srp"
+	authOPAQUE   = "opaque"
+)
+
+// changePassword es la opción del menú para cambiar la contraseña.
+func (c *client) changePassword() {
+	ui.ClearScreen()
+	fmt.Println("** Cambiar contraseña **")
+
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado.")
+		return
+	}
+	current := ui.ReadPassword("Contraseña actual")
+	defer crypto.Wipe(current)
+	c.doChangePassword(current)
+}
+
+// forcePasswordChange se ejecuta tras un login con la contraseña caducada:
+// no se vuelve al menú hasta que se cambia y, si el usuario desiste, se
+// cierra la sesión.
+func (c *client) forcePasswordChange(current []byte) {
+	fmt.Println("Tu contraseña ha caducado: tienes que cambiarla para continuar.")
+	for !c.doChangePassword(current) {
+		if !ui.Confirm("¿Intentarlo de nuevo?") {
+			c.sendRequest(api.Request{Action: api.ActionLogout, Username: c.currentUser, Token: c.authToken})
+			c.wipeSession()
+			fmt.Println("Sesión cerrada: la contraseña sigue caducada.")
+			return
+		}
+	}
+}
+
+// doChangePassword pide la contraseña nueva, la cambia en el servidor y
+// vuelve a cifrar con ella la clave de firma local. Devuelve si se ha cambiado.
+func (c *client) doChangePassword(current []byte) bool {
+	if c.authMethod == authOPAQUE {
+		fmt.Println("El cambio de contraseña no está disponible para cuentas OPAQUE.")
+		return false
+	}
+
+	fmt.Println("Contraseña nueva:")
+	newPassword := c.readNewPassword(c.currentUser)
+	defer crypto.Wipe(newPassword)
+	again := ui.ReadPassword("Repite la contraseña")
+	match := bytes.Equal(newPassword, again)
+	crypto.Wipe(again)
+	if !match {
+		fmt.Println("Las contraseñas no coinciden.")
+		return false
+	}
+
+	// La clave de datos no cambia: basta con envolverla con la contraseña nueva
+	var wrapped string
+	if c.dataKey != nil {
+		var err error
+		if wrapped, err = crypto.WrapDataKey(c.dataKey, newPassword); err != nil {
+			fmt.Println("Error envolviendo la clave de datos:", err)
+			return false
+		}
+	}
+
+	// El cambio renueva la sesión y cierra el canal de avisos de la actual:
+	// lo cerramos antes para que no nos avise de ello
+	c.stopEvents()
+	defer c.startEvents()
+	var res api.Response
+	if c.authMethod == authSRP {
+		res = c.changePasswordSRP(current, newPassword, wrapped)
+	} else {
+		res = c.sendRequest(api.Request{
+			Action:      api.ActionChangePassword,
+			Username:    c.currentUser,
+			Token:       c.authToken,
+			Password:    string(current),
+			NewPassword: string(newPassword),
+			DataKey:     wrapped,
+		})
+	}
+
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+	if !res.Success {
+		return false
+	}
+	c.pendingKey = ""
+	if res.Token != "" {
+		c.authToken = res.Token
+		c.refreshToken = res.RefreshToken
+		c.setSessionKey(res.SessionKey)
+	}
+
+	// La clave de firma local estaba protegida con la contraseña antigua
+	err := crypto.ChangeKeyFilePassphrase(signKeyPath(c.currentUser), current, newPassword)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Println("Aviso: no se ha podido volver a cifrar la clave de firma local:", err)
+		fmt.Println("Seguirá abriéndose con la contraseña antigua.")
+	}
+	return true
+}
+
+// changePasswordSRP demuestra conocer la contraseña actual con una ronda
+// SRP y envía, junto con la prueba M1, la sal y el verificador nuevos y la
+// clave de datos envuelta con la contraseña nueva.
+func (c *client) changePasswordSRP(current, newPassword []byte, wrapped string) api.Response {
+	srp, err := crypto.NewSRPClient(c.currentUser, current)
+	if err != nil {
+		return api.Response{Success: false, Message: "Error iniciando SRP: " + err.Error()}
+	}
+	defer srp.Wipe()
+
+	m1, res := c.srpChallenge(srp, c.currentUser)
+	if !res.Success {
+		return res
+	}
+	salt, verifier, err := crypto.NewSRPVerifier(c.currentUser, newPassword)
+	if err != nil {
+		return api.Response{Success: false, Message: "Error generando el verificador SRP: " + err.Error()}
+	}
+
+	res = c.sendRequest(api.Request{
+		Action:   api.ActionChangePassword,
+		Username: c.currentUser,
+		Token:    c.authToken,
+		DataKey:  wrapped,
+		SRP: &api.SRPParams{
+			M1:       base64.StdEncoding.EncodeToString(m1),
+			Salt:     base64.StdEncoding.EncodeToString(salt),
+			Verifier: base64.StdEncoding.EncodeToString(verifier),
+		},
+	})
+	if !res.Success {
+		return res
+	}
+	var m2 []byte
+	if res.SRP != nil {
+		m2, _ = base64.StdEncoding.DecodeString(res.SRP.M2)
+	}
+	if !srp.VerifyServer(m2) {
+		return api.Response{Success: false, Message: "El servidor no ha demostrado conocer el verificador"}
+	}
+	return res
+}
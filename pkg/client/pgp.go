@@ -0,0 +1,141 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"prac/pkg/crypto"
+	"prac/pkg/ui"
+)
+
+// exportPGP descarga los datos del usuario y los guarda en un fichero
+// OpenPGP armado, cifrado con una frase de paso o para una clave pública,
+// de forma que se puedan abrir con GnuPG ("gpg -d fichero.asc").
+func (c *client) exportPGP() {
+	ui.ClearScreen()
+	fmt.Println("** Exportar datos (OpenPGP) **")
+
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+
+	res, sig, err := c.requestData()
+	if err != nil {
+		fmt.Println("Error descifrando los datos:", err)
+		return
+	}
+	if !res.Success {
+		fmt.Println("Mensaje:", res.Message)
+		return
+	}
+	if sig == "INVÁLIDA" &&
+		!ui.Confirm("La firma de los datos es INVÁLIDA. ¿Exportarlos de todos modos?") {
+		return
+	}
+
+	path := ui.ReadInput("Fichero de salida (.asc)")
+	if path == "" {
+		fmt.Println("Ruta vacía, exportación cancelada.")
+		return
+	}
+
+	var out bytes.Buffer
+	name := c.currentUser + ".txt"
+	if pubPath := ui.ReadInput("Clave pública OpenPGP del destinatario (vacío para usar frase de paso)"); pubPath != "" {
+		pub, err := os.Open(pubPath)
+		if err != nil {
+			fmt.Println("Error abriendo la clave pública:", err)
+			return
+		}
+		err = crypto.PGPEncryptTo(&out, []byte(res.Data), pub, name)
+		pub.Close()
+		if err != nil {
+			fmt.Println("Error cifrando los datos:", err)
+			return
+		}
+	} else {
+		pass := ui.ReadPassword("Frase de paso")
+		defer crypto.Wipe(pass)
+		if len(pass) == 0 {
+			fmt.Println("Frase de paso vacía, exportación cancelada.")
+			return
+		}
+		again := ui.ReadPassword("Repite la frase de paso")
+		match := bytes.Equal(pass, again)
+		crypto.Wipe(again)
+		if !match {
+			fmt.Println("Las frases de paso no coinciden.")
+			return
+		}
+		if err := crypto.PGPEncryptSymmetric(&out, []byte(res.Data), pass, name); err != nil {
+			fmt.Println("Error cifrando los datos:", err)
+			return
+		}
+	}
+
+	if err := os.WriteFile(filepath.Clean(path), out.Bytes(), 0600); err != nil {
+		fmt.Println("Error escribiendo el fichero:", err)
+		return
+	}
+	fmt.Println("Datos exportados en", path)
+}
+
+// importPGP lee un fichero OpenPGP armado (p. ej. de "gpg -c -a" o
+// "gpg -e -a"), lo descifra y sustituye con su contenido los datos del
+// usuario en el servidor, firmados y cifrados igual que en updateData.
+func (c *client) importPGP() {
+	ui.ClearScreen()
+	fmt.Println("** Importar datos (OpenPGP) **")
+
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+
+	path := ui.ReadInput("Fichero a importar (.asc)")
+	in, err := os.Open(path)
+	if err != nil {
+		fmt.Println("Error abriendo el fichero:", err)
+		return
+	}
+	defer in.Close()
+
+	var data []byte
+	if privPath := ui.ReadInput("Clave privada OpenPGP (vacío si se cifró con frase de paso)"); privPath != "" {
+		priv, err := os.Open(privPath)
+		if err != nil {
+			fmt.Println("Error abriendo la clave privada:", err)
+			return
+		}
+		defer priv.Close()
+		pass := ui.ReadPassword("Frase de paso de la clave privada")
+		defer crypto.Wipe(pass)
+		data, err = crypto.PGPDecrypt(in, priv, pass)
+		if err != nil {
+			fmt.Println("Error descifrando el fichero:", err)
+			return
+		}
+	} else {
+		pass := ui.ReadPassword("Frase de paso")
+		defer crypto.Wipe(pass)
+		data, err = crypto.PGPDecrypt(in, nil, pass)
+		if err != nil {
+			fmt.Println("Error descifrando el fichero:", err)
+			return
+		}
+	}
+
+	if !ui.Confirm(fmt.Sprintf("Se sustituirán tus datos actuales por %d bytes importados. ¿Continuar?", len(data))) {
+		return
+	}
+	res, err := c.storeData(string(data))
+	if err != nil {
+		fmt.Println("Error cifrando los datos:", err)
+		return
+	}
+	fmt.Println("Éxito:", res.Success)
+	fmt.Println("Mensaje:", res.Message)
+}
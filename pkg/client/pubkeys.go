@@ -0,0 +1,106 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/ui"
+)
+
+// publishKeys publica en el directorio las claves públicas del usuario (la
+// de firma y la de compartición, firmada) para que otros puedan comprobar
+// sus mensajes y compartir cosas con él. Se hace en cada login: son
+// siempre las mismas, así que repetirlo no cambia nada.
+func (c *client) publishKeys() {
+	priv, err := c.shareKey()
+	if err != nil {
+		return
+	}
+	pub := priv.PublicKey().Bytes()
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionPublishKey,
+		Username: c.currentUser,
+		Token:    c.authToken,
+		Keys: &api.PublicKeys{
+			Signing:    base64.StdEncoding.EncodeToString(c.signKey.Public().(ed25519.PublicKey)),
+			Encryption: base64.StdEncoding.EncodeToString(pub),
+			Signature:  base64.StdEncoding.EncodeToString(crypto.SignShareKey(c.signKey, c.currentUser, pub)),
+		},
+	})
+	if !res.Success {
+		fmt.Println("Aviso: no se han podido publicar las claves públicas:", res.Message)
+	}
+}
+
+// peerKeys pide al directorio las claves públicas de 'user' y las comprueba:
+// que la de cifrado la ha firmado su clave de firma y que la huella es la
+// de esa clave. Devuelve la clave de firma, la de cifrado y la huella, que
+// es lo que hay que comparar con 'user' por otro canal: si el servidor
+// miente desde el registro de 'user', sólo así se nota.
+func (c *client) peerKeys(user string) (signPub ed25519.PublicKey, encPub []byte, fingerprint string, err error) {
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionGetKey,
+		Username: c.currentUser,
+		Token:    c.authToken,
+		To:       user,
+	})
+	if !res.Success {
+		return nil, nil, "", errors.New(res.Message)
+	}
+	if res.Keys == nil || res.Keys.Encryption == "" {
+		return nil, nil, "", fmt.Errorf("%s no ha publicado su clave de cifrado", user)
+	}
+	rawSign, err1 := base64.StdEncoding.DecodeString(res.Keys.Signing)
+	encPub, err2 := base64.StdEncoding.DecodeString(res.Keys.Encryption)
+	sig, err3 := base64.StdEncoding.DecodeString(res.Keys.Signature)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, nil, "", fmt.Errorf("claves públicas mal codificadas: %v", err)
+	}
+	if signPub, err = crypto.ParsePublicKey(rawSign); err != nil {
+		return nil, nil, "", err
+	}
+	if !crypto.VerifyShareKey(signPub, user, encPub, sig) {
+		return nil, nil, "", errors.New("la firma de la clave de cifrado no es válida")
+	}
+	fingerprint = crypto.KeyFingerprint(user, signPub)
+	if res.Keys.Fingerprint != fingerprint {
+		return nil, nil, "", errors.New("la huella que da el servidor no corresponde a la clave")
+	}
+	return signPub, encPub, fingerprint, nil
+}
+
+// publicKeys es la opción del menú de las claves públicas: ver la huella
+// propia, para dársela a otros, o la de otro usuario, para compararla con
+// la que él diga.
+func (c *client) publicKeys() {
+	ui.ClearScreen()
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+	options := []string{
+		"Mi huella",
+		"Huella de otro usuario",
+		"Volver",
+	}
+	switch ui.PrintMenu("** Claves públicas **", options) {
+	case 1:
+		if c.signKey == nil {
+			fmt.Println("Este equipo no tiene la clave de firma del usuario.")
+			return
+		}
+		fmt.Println("Tu huella:", crypto.KeyFingerprint(c.currentUser, c.signKey.Public().(ed25519.PublicKey)))
+	case 2:
+		user := ui.ReadInput("Usuario")
+		if _, _, fp, err := c.peerKeys(user); err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Printf("Huella de %s: %s\n", user, fp)
+			fmt.Println("Compárala con la que te dé por otro medio antes de fiarte de ella.")
+		}
+	}
+}
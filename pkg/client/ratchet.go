@@ -0,0 +1,210 @@
+package client
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"prac/pkg/crypto"
+)
+
+// Mensajería entre usuarios con secreto hacia delante: el primer mensaje a
+// un usuario arranca una conversación X3DH con su bundle publicado y, a
+// partir de ahí, cada mensaje avanza el double ratchet. El estado de cada
+// conversación se guarda en este equipo cifrado con una clave derivada de la
+// clave de firma local (que a su vez está protegida por la contraseña).
+
+// ratchetEnvelope es lo que viaja por el servidor para cada mensaje.
+type ratchetEnvelope struct {
+	Init    *crypto.X3DHInit       `json:"init,omitempty"` // sólo hasta recibir la primera respuesta
+	Message *crypto.RatchetMessage `json:"message"`
+}
+
+// ratchetFile es el contenido (descifrado) del estado de una conversación.
+type ratchetFile struct {
+	State       *crypto.Ratchet  `json:"state"`
+	PendingInit *crypto.X3DHInit `json:"pendingInit,omitempty"`
+}
+
+// ratchetDir devuelve el directorio de las conversaciones de 'username'
+// (el nombre va en hexadecimal para que sea un nombre de fichero válido).
+func ratchetDir(username string) string {
+	return filepath.Join(keyDir, "ratchets", hex.EncodeToString([]byte(username)))
+}
+
+// ratchetPath devuelve dónde se guarda la conversación de 'username' con
+// 'peer' (también en hexadecimal).
+func ratchetPath(username, peer string) string {
+	return filepath.Join(ratchetDir(username), hex.EncodeToString([]byte(peer))+".json")
+}
+
+// ratchetStoreKey es la clave con la que se cifran los estados en disco.
+func (c *client) ratchetStoreKey() ([]byte, error) {
+	if c.signKey == nil {
+		return nil, errors.New("este equipo no tiene la clave de firma del usuario")
+	}
+	seed := c.signKey.Seed()
+	defer crypto.Wipe(seed)
+	return crypto.DeriveKey(seed, "ratchet-store"), nil
+}
+
+// x3dhKeys deriva las claves X25519 del usuario a partir de su clave de firma.
+func (c *client) x3dhKeys() (*crypto.X3DHKeys, error) {
+	if c.signKey == nil {
+		return nil, errors.New("este equipo no tiene la clave de firma del usuario")
+	}
+	seed := c.signKey.Seed()
+	defer crypto.Wipe(seed)
+	return crypto.NewX3DHKeys(seed)
+}
+
+// preKeyBundle devuelve el bundle que otros usuarios necesitan para
+// escribirnos (se publica en el servidor).
+func (c *client) preKeyBundle() (crypto.PreKeyBundle, error) {
+	keys, err := c.x3dhKeys()
+	if err != nil {
+		return crypto.PreKeyBundle{}, err
+	}
+	return keys.Bundle(c.signKey), nil
+}
+
+// sealMessage cifra un mensaje para 'peer'. Si aún no hay conversación, la
+// inicia con su bundle, cuya firma se comprueba con 'peerSignPub'.
+func (c *client) sealMessage(peer string, bundle *crypto.PreKeyBundle, peerSignPub ed25519.PublicKey, plaintext []byte) (string, error) {
+	rf, err := c.loadRatchet(peer)
+	if err != nil {
+		return "", err
+	}
+	if rf == nil {
+		if bundle == nil {
+			return "", fmt.Errorf("no hay conversación con %s ni bundle para iniciarla", peer)
+		}
+		keys, err := c.x3dhKeys()
+		if err != nil {
+			return "", err
+		}
+		sk, ad, init, err := crypto.X3DHInitiate(keys, *bundle, peerSignPub)
+		if err != nil {
+			return "", err
+		}
+		state, err := crypto.NewRatchetInitiator(sk, ad, bundle.SignedPreKey)
+		if err != nil {
+			return "", err
+		}
+		rf = &ratchetFile{State: state, PendingInit: init}
+	}
+
+	msg, err := rf.State.Encrypt(plaintext)
+	if err != nil {
+		return "", err
+	}
+	// Guardamos antes de enviar: una clave de mensaje nunca debe reutilizarse
+	if err := c.saveRatchet(peer, rf); err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(ratchetEnvelope{Init: rf.PendingInit, Message: msg})
+	if err != nil {
+		return "", err
+	}
+	return string(raw), nil
+}
+
+// openMessage descifra un mensaje recibido de 'peer'.
+func (c *client) openMessage(peer, raw string) ([]byte, error) {
+	var env ratchetEnvelope
+	if err := json.Unmarshal([]byte(raw), &env); err != nil || env.Message == nil {
+		return nil, errors.New("mensaje mal formado")
+	}
+	rf, err := c.loadRatchet(peer)
+	if err != nil {
+		return nil, err
+	}
+	if rf == nil {
+		// Primer mensaje de una conversación iniciada por el otro
+		if env.Init == nil {
+			return nil, fmt.Errorf("no hay conversación con %s", peer)
+		}
+		keys, err := c.x3dhKeys()
+		if err != nil {
+			return nil, err
+		}
+		sk, ad, err := crypto.X3DHRespond(keys, env.Init)
+		if err != nil {
+			return nil, err
+		}
+		state, err := crypto.NewRatchetResponder(sk, ad, keys.PreKeyPrivate())
+		if err != nil {
+			return nil, err
+		}
+		rf = &ratchetFile{State: state}
+	}
+
+	plaintext, err := rf.State.Decrypt(env.Message)
+	if err != nil {
+		return nil, err
+	}
+	// El otro ya tiene la conversación: dejamos de mandar el X3DHInit
+	rf.PendingInit = nil
+	if err := c.saveRatchet(peer, rf); err != nil {
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+// loadRatchet lee el estado de la conversación con 'peer' (nil si no existe).
+func (c *client) loadRatchet(peer string) (*ratchetFile, error) {
+	key, err := c.ratchetStoreKey()
+	if err != nil {
+		return nil, err
+	}
+	defer crypto.Wipe(key)
+	sealed, err := os.ReadFile(ratchetPath(c.currentUser, peer))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, err := crypto.Open(key, sealed, []byte(c.currentUser+"\x00"+peer))
+	if err != nil {
+		return nil, fmt.Errorf("estado de la conversación con %s corrupto: %v", peer, err)
+	}
+	defer crypto.Wipe(raw)
+	var rf ratchetFile
+	if err := json.Unmarshal(raw, &rf); err != nil || rf.State == nil {
+		return nil, fmt.Errorf("estado de la conversación con %s corrupto", peer)
+	}
+	return &rf, nil
+}
+
+// saveRatchet guarda de forma atómica el estado de la conversación con 'peer'.
+func (c *client) saveRatchet(peer string, rf *ratchetFile) error {
+	key, err := c.ratchetStoreKey()
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(key)
+	raw, err := json.Marshal(rf)
+	if err != nil {
+		return err
+	}
+	sealed, err := crypto.Seal(key, raw, []byte(c.currentUser+"\x00"+peer))
+	crypto.Wipe(raw)
+	if err != nil {
+		return err
+	}
+
+	path := ratchetPath(c.currentUser, peer)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("error creando %s: %v", filepath.Dir(path), err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, sealed, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"prac/pkg/api"
+	"prac/pkg/ui"
+)
+
+// userAgent es el User-Agent del cliente: el nombre del equipo ('device' o,
+// si está vacío, el de la máquina) y su sistema, para que el usuario
+// reconozca cada sesión en la lista de sesiones abiertas.
+func userAgent(device string) string {
+	if device == "" {
+		device, _ = os.Hostname()
+	}
+	if device == "" {
+		device = "equipo sin nombre"
+	}
+	return fmt.Sprintf("prac-cli (%s; %s/%s)", device, runtime.GOOS, runtime.GOARCH)
+}
+
+// sessions es la opción del menú de las sesiones: ver las que están
+// abiertas, los últimos inicios de sesión, o cerrarlas todas (por ejemplo,
+// si alguna no es del usuario).
+func (c *client) sessions() {
+	ui.ClearScreen()
+	if c.currentUser == "" || c.authToken == "" {
+		fmt.Println("No estás logueado. Inicia sesión primero.")
+		return
+	}
+	options := []string{
+		"Sesiones abiertas",
+		"Últimos inicios de sesión",
+		"Cerrar todas las sesiones",
+		"Volver",
+	}
+	switch ui.PrintMenu("** Sesiones **", options) {
+	case 1:
+		c.listSessions()
+	case 2:
+		c.listLogins()
+	case 3:
+		c.logoutAll()
+	}
+}
+
+// listSessions muestra las sesiones abiertas de la cuenta, marcando la de
+// este cliente.
+func (c *client) listSessions() {
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionListSessions,
+		Username: c.currentUser,
+		Token:    c.authToken,
+	})
+	fmt.Println("Mensaje:", res.Message)
+	for _, se := range res.Sessions {
+		current := ""
+		if se.Current {
+			current = " (esta)"
+		}
+		fmt.Printf("  %s%s\n    IP %s, abierta el %s, última actividad el %s\n",
+			se.Device, current, se.IP, formatDate(se.Created), formatDate(se.LastSeen))
+	}
+}
+
+// logoutAll cierra todas las sesiones de la cuenta, también esta.
+func (c *client) logoutAll() {
+	if !ui.Confirm("Se cerrarán todas las sesiones, también esta. ¿Continuar?") {
+		return
+	}
+	// Como en logoutUser, sin que nos avise de nuestro propio logout
+	c.stopEvents()
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionLogoutAll,
+		Username: c.currentUser,
+		Token:    c.authToken,
+	})
+	fmt.Println("Mensaje:", res.Message)
+	if res.Success || res.Code == api.ErrTokenExpired {
+		c.wipeSession()
+	} else {
+		c.startEvents()
+	}
+}
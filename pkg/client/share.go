@@ -0,0 +1,121 @@
+package client
+
+import (
+	"crypto/ecdh"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/ui"
+)
+
+// shareKey deriva la clave de compartición del usuario a partir de su
+// clave de firma, como x3dhKeys.
+func (c *client) shareKey() (*ecdh.PrivateKey, error) {
+	if c.signKey == nil {
+		return nil, errors.New("este equipo no tiene la clave de firma del usuario")
+	}
+	seed := c.signKey.Seed()
+	defer crypto.Wipe(seed)
+	return crypto.ShareKeyFromSeed(seed)
+}
+
+// shareAD son los datos asociados de la clave del fichero 'name' de 'owner'
+// envuelta para 'recipient': el servidor no puede dársela a otro usuario ni
+// hacerla pasar por la de otro fichero.
+func shareAD(owner, recipient, name string) []byte {
+	return []byte("prac-share\x00" + owner + "\x00" + recipient + "\x00" + name)
+}
+
+// shareFile comparte el fichero 'name' con 'to': envuelve la clave del
+// fichero para su clave de cifrado del directorio, después de comprobarla
+// (ver peerKeys). La huella de 'to' se muestra para que el usuario pueda
+// compararla con la que él le dé.
+func (c *client) shareFile(name, to string) error {
+	if c.dataKey == nil {
+		return errors.New("no hay clave de datos en esta sesión")
+	}
+	if name == "" || to == "" {
+		return errors.New("faltan el fichero o el destinatario")
+	}
+	_, pub, fp, err := c.peerKeys(to)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Huella de %s: %s\n", to, fp)
+
+	key := c.fileKey(name)
+	defer crypto.Wipe(key)
+	wrapped, err := crypto.WrapShareKey(pub, key, shareAD(c.currentUser, to, name))
+	if err != nil {
+		return err
+	}
+	res := c.sendRequest(api.Request{
+		Action:   api.ActionShareData,
+		Username: c.currentUser,
+		Token:    c.authToken,
+		To:       to,
+		File:     &api.FileInfo{Name: name},
+		Data:     base64.StdEncoding.EncodeToString(wrapped),
+	})
+	fmt.Println("Mensaje:", res.Message)
+	return nil
+}
+
+// sharedFiles muestra los ficheros que otros han compartido con el usuario,
+// página a página, y deja descargar los de cada página por su número.
+func (c *client) sharedFiles() error {
+	cursor := ""
+	for {
+		res := c.sendRequest(api.Request{
+			Action:   api.ActionListShared,
+			Username: c.currentUser,
+			Token:    c.authToken,
+			Cursor:   cursor,
+		})
+		if !res.Success {
+			return errors.New(res.Message)
+		}
+		if len(res.Shared) == 0 && cursor == "" {
+			fmt.Println("Nadie ha compartido ficheros contigo.")
+			return nil
+		}
+		for i, it := range res.Shared {
+			fmt.Printf("%d. %s (de %s, %s)\n", i+1, it.File, it.Owner, formatDate(it.Time))
+		}
+		for ui.Confirm("¿Descargar alguno de estos ficheros?") {
+			n := ui.ReadInt("Número del fichero")
+			if n < 1 || n > len(res.Shared) {
+				fmt.Println("Número no válido.")
+				continue
+			}
+			if err := c.downloadShared(res.Shared[n-1], ui.ReadInput("Guardar en")); err != nil {
+				fmt.Println("Error:", err)
+			}
+		}
+		if res.NextCursor == "" || !ui.Confirm("¿Ver más?") {
+			return nil
+		}
+		cursor = res.NextCursor
+	}
+}
+
+// downloadShared abre la clave envuelta de 'it' y descarga el fichero.
+func (c *client) downloadShared(it api.SharedItem, path string) error {
+	priv, err := c.shareKey()
+	if err != nil {
+		return err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(it.Key)
+	if err != nil {
+		return fmt.Errorf("clave envuelta mal codificada: %v", err)
+	}
+	key, err := crypto.UnwrapShareKey(priv, wrapped, shareAD(it.Owner, c.currentUser, it.File))
+	if err != nil {
+		return fmt.Errorf("no se puede abrir la clave del fichero: %v", err)
+	}
+	defer crypto.Wipe(key)
+	return c.downloadFile(it.Owner, it.File, path, key)
+}
@@ -0,0 +1,139 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize es el tamaño de las claves simétricas (AES-256).
+const KeySize = 32
+
+// ErrDecrypt se devuelve cuando un texto cifrado no supera la autenticación
+// (clave incorrecta, datos manipulados o truncados).
+var ErrDecrypt = errors.New("error de descifrado: datos corruptos o clave incorrecta")
+
+// Cipher identifica un algoritmo AEAD soportado.
+type Cipher string
+
+const (
+	// CipherAESGCM es el algoritmo por defecto (AES-256-GCM).
+	CipherAESGCM Cipher = "aes-gcm"
+	// CipherAESGCMSIV (AES-256-GCM-SIV) tolera la repetición de nonces; es
+	// la opción para registros que se cifran de forma masiva o automatizada
+	// (p. ej. copias de seguridad) donde un fallo del RNG es más probable.
+	CipherAESGCMSIV Cipher = "aes-gcm-siv"
+)
+
+// ParseCipher valida el nombre de un algoritmo.
+func ParseCipher(name string) (Cipher, error) {
+	switch c := Cipher(strings.ToLower(strings.TrimSpace(name))); c {
+	case CipherAESGCM, CipherAESGCMSIV:
+		return c, nil
+	default:
+		return "", fmt.Errorf("algoritmo de cifrado desconocido: %q", name)
+	}
+}
+
+// newAEAD crea el AEAD del algoritmo 'c' para la clave dada.
+func newAEAD(c Cipher, key []byte) (cipher.AEAD, error) {
+	switch c {
+	case CipherAESGCM:
+		return newGCM(key)
+	case CipherAESGCMSIV:
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("clave AES no válida: %d bytes", len(key))
+		}
+		return NewGCMSIV(key)
+	default:
+		return nil, fmt.Errorf("algoritmo de cifrado desconocido: %q", c)
+	}
+}
+
+// newGCM crea un AEAD AES-GCM para la clave dada.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("clave AES no válida: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal cifra y autentica 'plaintext' con AES-256-GCM. El nonce aleatorio se
+// antepone al resultado: nonce || ciphertext || tag. 'ad' son datos
+// asociados que se autentican pero no se cifran (pueden ser nil).
+func Seal(key, plaintext, ad []byte) ([]byte, error) {
+	return SealWith(CipherAESGCM, key, plaintext, ad)
+}
+
+// Open descifra un mensaje producido por Seal.
+func Open(key, sealed, ad []byte) ([]byte, error) {
+	return OpenWith(CipherAESGCM, key, sealed, ad)
+}
+
+// SealWith es como Seal pero con el algoritmo 'c'. El formato de salida es
+// el mismo para todos (nonce || ciphertext || tag), así que quien descifra
+// tiene que saber qué algoritmo se usó.
+func SealWith(c Cipher, key, plaintext, ad []byte) ([]byte, error) {
+	aead, err := newAEAD(c, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := RandomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, ad), nil
+}
+
+// OpenWith descifra un mensaje producido por SealWith con el mismo algoritmo.
+func OpenWith(c Cipher, key, sealed, ad []byte) ([]byte, error) {
+	aead, err := newAEAD(c, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// CipherPolicy asigna un algoritmo a cada namespace; los que no aparecen
+// usan AES-GCM.
+type CipherPolicy map[string]Cipher
+
+// For devuelve el algoritmo que corresponde al namespace 'ns'.
+func (p CipherPolicy) For(ns string) Cipher {
+	if c, ok := p[ns]; ok {
+		return c
+	}
+	return CipherAESGCM
+}
+
+// ParseCipherPolicy interpreta una lista "ns=algoritmo,ns=algoritmo".
+func ParseCipherPolicy(spec string) (CipherPolicy, error) {
+	p := CipherPolicy{}
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		ns, name, ok := strings.Cut(item, "=")
+		ns = strings.TrimSpace(ns)
+		if !ok || ns == "" {
+			return nil, fmt.Errorf("entrada no válida en la política de cifrado: %q", item)
+		}
+		c, err := ParseCipher(name)
+		if err != nil {
+			return nil, err
+		}
+		p[ns] = c
+	}
+	return p, nil
+}
@@ -0,0 +1,112 @@
+package crypto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Cifrado en formato age (https://age-encryption.org/v1), para que las
+// copias de seguridad se puedan abrir con la herramienta estándar:
+//
+//	age -d -i clave.txt copia.age > server.db     (destinatarios X25519)
+//	age -d copia.age > server.db                   (frase de paso, scrypt)
+
+// AgeRecipient es un destinatario age ya interpretado (ver ParseAgeRecipients).
+type AgeRecipient = age.Recipient
+
+// ErrAgeNoRecipients indica que no se indicó ni destinatario ni frase de paso.
+var ErrAgeNoRecipients = errors.New("se necesita al menos un destinatario age o una frase de paso")
+
+// ParseAgeRecipients interpreta cada elemento como una clave pública
+// X25519 ("age1...") o, si no lo es, como la ruta de un fichero de
+// destinatarios (una clave por línea, como "age -R").
+func ParseAgeRecipients(specs []string) ([]AgeRecipient, error) {
+	var out []AgeRecipient
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		if strings.HasPrefix(spec, "age1") {
+			r, err := age.ParseX25519Recipient(spec)
+			if err != nil {
+				return nil, fmt.Errorf("destinatario age no válido %q: %v", spec, err)
+			}
+			out = append(out, r)
+			continue
+		}
+		f, err := os.Open(spec)
+		if err != nil {
+			return nil, fmt.Errorf("error abriendo el fichero de destinatarios: %v", err)
+		}
+		rs, err := age.ParseRecipients(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("fichero de destinatarios %s no válido: %v", spec, err)
+		}
+		out = append(out, rs...)
+	}
+	return out, nil
+}
+
+// NewAgeEncryptWriter devuelve un io.WriteCloser que escribe en 'dst' un
+// fichero age binario. Con destinatarios se cifra para ellos; si no hay
+// ninguno se usa 'passphrase' (scrypt), que en age no puede combinarse con
+// otros destinatarios. Como con NewEncryptWriter, hay que llamar a Close.
+func NewAgeEncryptWriter(dst io.Writer, recipients []AgeRecipient, passphrase []byte) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		if len(passphrase) == 0 {
+			return nil, ErrAgeNoRecipients
+		}
+		r, err := age.NewScryptRecipient(string(passphrase))
+		if err != nil {
+			return nil, err
+		}
+		recipients = []AgeRecipient{r}
+	}
+	return age.Encrypt(dst, recipients...)
+}
+
+// NewAgeDecryptReader devuelve el contenido en claro del fichero age 'src'
+// (binario o armado). Si 'identities' no es nil se leen de él las claves
+// privadas (formato de age-keygen); si no, se usa 'passphrase'. Como con
+// NewDecryptReader, si Read falla hay que descartar lo leído.
+func NewAgeDecryptReader(src io.Reader, identities io.Reader, passphrase []byte) (io.Reader, error) {
+	var ids []age.Identity
+	if identities != nil {
+		parsed, err := age.ParseIdentities(identities)
+		if err != nil {
+			return nil, fmt.Errorf("fichero de identidades age no válido: %v", err)
+		}
+		ids = parsed
+	} else {
+		if len(passphrase) == 0 {
+			return nil, errors.New("se necesita una identidad age o una frase de paso")
+		}
+		id, err := age.NewScryptIdentity(string(passphrase))
+		if err != nil {
+			return nil, err
+		}
+		ids = []age.Identity{id}
+	}
+
+	// Igual que el CLI, aceptamos también la armadura PEM de "age -a"
+	br := bufio.NewReader(src)
+	in := io.Reader(br)
+	if head, _ := br.Peek(len(armor.Header)); bytes.Equal(head, []byte(armor.Header)) {
+		in = armor.NewReader(br)
+	}
+	r, err := age.Decrypt(in, ids...)
+	if err != nil {
+		return nil, fmt.Errorf("error descifrando el fichero age: %v", err)
+	}
+	return r, nil
+}
@@ -0,0 +1,66 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// DefaultBlindIndexBits es el tamaño por defecto de un índice ciego. Con 32
+// bits hay colisiones ocasionales a partir de decenas de miles de valores,
+// lo que dificulta confirmar valores concretos en un volcado de la base de
+// datos a cambio de tener que filtrar algún candidato de más al buscar.
+const DefaultBlindIndexBits = 32
+
+// BlindIndex calcula índices ciegos: un HMAC truncado de un campo
+// normalizado, que permite buscar por igualdad sobre registros cifrados
+// sin guardar el valor en claro. Como el índice está truncado, varios
+// valores pueden compartirlo y quien busca debe comprobar cada candidato
+// (ver store.FieldIndex).
+type BlindIndex struct {
+	key       []byte
+	bytes     int
+	normalize func(string) string
+}
+
+// NewBlindIndex crea el índice del campo 'field' con 'bits' bits (múltiplo
+// de 8, entre 16 y 256). Cada campo usa su propia clave derivada de 'master',
+// así que los índices de campos distintos no se pueden correlacionar.
+func NewBlindIndex(master []byte, field string, bits int) (*BlindIndex, error) {
+	if bits%8 != 0 || bits < 16 || bits > 256 {
+		return nil, fmt.Errorf("tamaño de índice ciego no válido: %d bits", bits)
+	}
+	return &BlindIndex{
+		key:       DeriveKey(master, "blind-index:"+field),
+		bytes:     bits / 8,
+		normalize: NormalizeField,
+	}, nil
+}
+
+// WithNormalizer cambia la normalización aplicada antes de calcular el índice.
+func (b *BlindIndex) WithNormalizer(fn func(string) string) *BlindIndex {
+	b.normalize = fn
+	return b
+}
+
+// Compute devuelve el índice (en hexadecimal) del valor 'value'.
+func (b *BlindIndex) Compute(value string) []byte {
+	m := hmac.New(sha256.New, b.key)
+	m.Write([]byte(b.normalize(value)))
+	return []byte(hex.EncodeToString(m.Sum(nil)[:b.bytes]))
+}
+
+// Matches indica si dos valores son iguales tras normalizarlos; sirve para
+// descartar las colisiones una vez descifrado el candidato.
+func (b *BlindIndex) Matches(a, c string) bool {
+	return ConstantTimeEqualString(b.normalize(a), b.normalize(c))
+}
+
+// NormalizeField es la normalización por defecto: sin espacios al principio
+// ni al final, espacios internos colapsados y en minúsculas (adecuada para
+// correos electrónicos o nombres).
+func NormalizeField(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
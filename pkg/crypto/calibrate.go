@@ -0,0 +1,132 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// DefaultArgon2Target es el tiempo por hash que busca la calibración.
+const DefaultArgon2Target = 250 * time.Millisecond
+
+// maxCalibrationThreads limita el paralelismo: con más hilos el hash es más
+// rápido en el servidor, pero también baja el coste para un atacante con
+// hardware paralelo, y varios logins a la vez se reparten los núcleos.
+const maxCalibrationThreads = 4
+
+// Argon2Calibration es el resultado de CalibrateArgon2.
+type Argon2Calibration struct {
+	Params   Argon2Params
+	Duration time.Duration // lo que tarda un hash con Params en esta máquina
+	Floor    bool          // ni siquiera los parámetros mínimos caben en el objetivo
+}
+
+// CalibrateArgon2 mide esta máquina y propone parámetros Argon2id que tarden
+// alrededor de 'target' por hash, siguiendo el procedimiento de la RFC 9106
+// (sección 4): se fijan los hilos, se toma la mayor memoria, hasta
+// 'maxMemory' KiB, en la que una pasada cabe en el objetivo y después se
+// suben las pasadas. Nunca propone menos coste que DefaultArgon2Params (ver
+// minArgon2Time): en una máquina lenta el resultado son esos parámetros y
+// Floor indica que se pasan del objetivo.
+func CalibrateArgon2(target time.Duration, maxMemory uint32) Argon2Calibration {
+	p := DefaultArgon2Params
+	if n := runtime.NumCPU(); n > int(p.Threads) {
+		p.Threads = uint8(min(n, maxCalibrationThreads))
+	}
+
+	// Memoria: partimos de la máxima y la reducimos a la mitad mientras una
+	// sola pasada tarde más que el objetivo
+	p.Memory = max(maxMemory, DefaultArgon2Params.Memory)
+	p.Time = 1
+	d := measureArgon2(p)
+	for d > target && p.Memory/2 >= DefaultArgon2Params.Memory {
+		p.Memory /= 2
+		d = measureArgon2(p)
+	}
+
+	// Pasadas: el coste crece de forma lineal con ellas
+	if d > 0 {
+		p.Time = uint32(target / d)
+	}
+	p.Time = max(p.Time, minArgon2Time(p.Memory))
+	d = measureArgon2(p)
+	for d > target+target/10 && p.Time > minArgon2Time(p.Memory) {
+		p.Time--
+		d = measureArgon2(p)
+	}
+
+	floor := p.Memory == DefaultArgon2Params.Memory && p.Time == minArgon2Time(p.Memory)
+	return Argon2Calibration{Params: p, Duration: d, Floor: floor && d > target}
+}
+
+// minArgon2Time es el mínimo de pasadas con 'memory' KiB para que el coste
+// (memoria × pasadas) no baje del de DefaultArgon2Params.
+func minArgon2Time(memory uint32) uint32 {
+	d := DefaultArgon2Params
+	total := uint64(d.Memory) * uint64(d.Time)
+	return uint32(max((total+uint64(memory)-1)/uint64(memory), 1))
+}
+
+// measureArgon2 devuelve el mejor de tres tiempos de un hash con 'p' (el
+// mínimo es el menos afectado por otros procesos).
+func measureArgon2(p Argon2Params) time.Duration {
+	password, salt := []byte("calibración"), make([]byte, p.SaltLen)
+	best := time.Duration(0)
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		argon2.IDKey(password, salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+		if d := time.Since(start); best == 0 || d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+// argon2File es el formato en disco de los parámetros calibrados.
+type argon2File struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // KiB
+	Threads uint8  `json:"threads"`
+}
+
+// SaveArgon2Params guarda los parámetros de coste en 'path' (permisos 0600).
+func SaveArgon2Params(path string, p Argon2Params) error {
+	raw, err := json.MarshalIndent(argon2File{Time: p.Time, Memory: p.Memory, Threads: p.Threads}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("error escribiendo %s: %v", path, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// LoadArgon2Params lee los parámetros guardados por SaveArgon2Params. Si el
+// fichero no existe devuelve DefaultArgon2Params; si pide menos coste que
+// ellos, lo rechaza (un fichero manipulado no debe poder debilitar los hashes).
+func LoadArgon2Params(path string) (Argon2Params, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultArgon2Params, nil
+	}
+	if err != nil {
+		return DefaultArgon2Params, fmt.Errorf("error leyendo %s: %v", path, err)
+	}
+	var f argon2File
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return DefaultArgon2Params, fmt.Errorf("%s mal formado: %v", path, err)
+	}
+	d := DefaultArgon2Params
+	if f.Memory < d.Memory || f.Threads < 1 || f.Time < minArgon2Time(f.Memory) {
+		return d, fmt.Errorf("%s: parámetros Argon2 por debajo del mínimo (m=%d, t=%d)", path, d.Memory, d.Time)
+	}
+	p := d
+	p.Time, p.Memory, p.Threads = f.Time, f.Memory, f.Threads
+	return p, nil
+}
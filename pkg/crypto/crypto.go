@@ -0,0 +1,51 @@
+// El paquete crypto agrupa las utilidades criptográficas del proyecto
+// (generación de tokens, comparaciones seguras, etc.) para que el resto
+// de paquetes no tenga que tratar directamente con las primitivas.
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+)
+
+// TokenSize es el tamaño en bytes de los tokens generados (256 bits).
+const TokenSize = 32
+
+// RandomBytes devuelve 'n' bytes aleatorios obtenidos del generador
+// criptográficamente seguro del sistema.
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("error al generar bytes aleatorios: %v", err)
+	}
+	return b, nil
+}
+
+// GenerateToken crea un token aleatorio de 256 bits codificado en base64url
+// (sin relleno), apto para usarse en URLs y cabeceras HTTP.
+func GenerateToken() (string, error) {
+	b, err := RandomBytes(TokenSize)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ConstantTimeEqual compara dos secretos en tiempo constante, de forma que
+// el tiempo de respuesta no revele cuántos bytes coinciden.
+// Si las longitudes difieren devuelve false (la longitud sí puede filtrarse).
+func ConstantTimeEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+// ConstantTimeEqualString es la variante de ConstantTimeEqual para cadenas.
+func ConstantTimeEqualString(a, b string) bool {
+	return ConstantTimeEqual([]byte(a), []byte(b))
+}
+
+// TokensEqual compara dos tokens en tiempo constante.
+func TokensEqual(a, b string) bool {
+	return ConstantTimeEqualString(a, b)
+}
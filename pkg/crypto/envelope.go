@@ -0,0 +1,186 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Formato de sobre para los datos cifrados que se almacenan:
+//
+//	magic(4) || versión(1) || algoritmo(1) || len(keyID)(1) || keyID || len(nonce)(1) || nonce || ciphertext || tag
+//
+// La cabecera completa se autentica como dato asociado (junto con el 'ad'
+// del llamante), así que no se puede cambiar el algoritmo ni el keyID de
+// un registro sin que falle el descifrado. Gracias a ella, OpenEnvelope
+// elige solo el algoritmo y la versión de clave, y los registros antiguos
+// siguen siendo legibles cuando se cambia de algoritmo o se rota la clave.
+const (
+	envelopeMagic   = "PRCE"
+	envelopeVersion = 1
+	maxKeyIDLen     = 255
+)
+
+// Identificadores de algoritmo en la cabecera. Son parte del formato: no
+// se pueden reutilizar ni renumerar.
+const (
+	algAESGCM    byte = 1
+	algAESGCMSIV byte = 2
+)
+
+var (
+	// ErrNotEnvelope indica que los datos no empiezan por una cabecera válida.
+	ErrNotEnvelope = errors.New("los datos no tienen una cabecera de cifrado válida")
+
+	// ErrUnknownKey indica que no hay clave para el keyID de la cabecera.
+	ErrUnknownKey = errors.New("clave de cifrado desconocida")
+)
+
+// EnvelopeHeader son los metadatos de un sobre.
+type EnvelopeHeader struct {
+	Version int
+	Cipher  Cipher
+	KeyID   string
+	Nonce   []byte
+}
+
+// KeyLookup devuelve la clave correspondiente a un keyID (o ErrUnknownKey).
+type KeyLookup func(keyID string) ([]byte, error)
+
+// cipherID traduce entre Cipher y su identificador en la cabecera.
+func cipherID(c Cipher) (byte, error) {
+	switch c {
+	case CipherAESGCM:
+		return algAESGCM, nil
+	case CipherAESGCMSIV:
+		return algAESGCMSIV, nil
+	default:
+		return 0, fmt.Errorf("algoritmo de cifrado desconocido: %q", c)
+	}
+}
+
+func cipherFromID(id byte) (Cipher, error) {
+	switch id {
+	case algAESGCM:
+		return CipherAESGCM, nil
+	case algAESGCMSIV:
+		return CipherAESGCMSIV, nil
+	default:
+		return "", fmt.Errorf("identificador de algoritmo desconocido: %d", id)
+	}
+}
+
+// SealEnvelope cifra 'plaintext' con el algoritmo 'c' y la clave 'key'
+// (identificada por 'keyID') y antepone la cabecera.
+func SealEnvelope(c Cipher, keyID string, key, plaintext, ad []byte) ([]byte, error) {
+	if len(keyID) > maxKeyIDLen {
+		return nil, errors.New("identificador de clave demasiado largo")
+	}
+	id, err := cipherID(c)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(c, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := RandomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, len(envelopeMagic)+4+len(keyID)+len(nonce))
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion, id, byte(len(keyID)))
+	header = append(header, keyID...)
+	header = append(header, byte(len(nonce)))
+	header = append(header, nonce...)
+
+	return aead.Seal(header, nonce, plaintext, envelopeAD(header, ad)), nil
+}
+
+// ParseEnvelopeHeader lee la cabecera de un sobre sin descifrarlo y
+// devuelve también su longitud en bytes.
+func ParseEnvelopeHeader(sealed []byte) (EnvelopeHeader, int, error) {
+	var h EnvelopeHeader
+	if len(sealed) < len(envelopeMagic)+3 || !bytes.HasPrefix(sealed, []byte(envelopeMagic)) {
+		return h, 0, ErrNotEnvelope
+	}
+	p := len(envelopeMagic)
+	if sealed[p] != envelopeVersion {
+		return h, 0, fmt.Errorf("versión de cabecera no soportada: %d", sealed[p])
+	}
+	h.Version = int(sealed[p])
+	c, err := cipherFromID(sealed[p+1])
+	if err != nil {
+		return h, 0, err
+	}
+	h.Cipher = c
+
+	p += 2
+	keyLen := int(sealed[p])
+	p++
+	if len(sealed) < p+keyLen+1 {
+		return h, 0, ErrNotEnvelope
+	}
+	h.KeyID = string(sealed[p : p+keyLen])
+	p += keyLen
+
+	nonceLen := int(sealed[p])
+	p++
+	if len(sealed) < p+nonceLen {
+		return h, 0, ErrNotEnvelope
+	}
+	h.Nonce = sealed[p : p+nonceLen]
+	return h, p + nonceLen, nil
+}
+
+// IsEnvelope indica si 'data' parece un sobre (por ejemplo, para distinguir
+// registros cifrados de registros antiguos en claro durante una migración).
+func IsEnvelope(data []byte) bool {
+	_, _, err := ParseEnvelopeHeader(data)
+	return err == nil
+}
+
+// OpenEnvelope descifra un sobre eligiendo el algoritmo según la cabecera y
+// la clave mediante 'keys'.
+func OpenEnvelope(keys KeyLookup, sealed, ad []byte) ([]byte, error) {
+	h, n, err := ParseEnvelopeHeader(sealed)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keys(h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(h.Cipher, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(h.Nonce) != aead.NonceSize() || len(sealed)-n < aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, h.Nonce, sealed[n:], envelopeAD(sealed[:n], ad))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// envelopeAD combina la cabecera y el dato asociado del llamante sin
+// ambigüedad (la cabecera ya lleva sus propias longitudes).
+func envelopeAD(header, ad []byte) []byte {
+	out := make([]byte, 0, len(header)+len(ad))
+	out = append(out, header...)
+	return append(out, ad...)
+}
+
+// StaticKeys es un KeyLookup con un conjunto fijo de claves por keyID.
+func StaticKeys(keys map[string][]byte) KeyLookup {
+	return func(keyID string) ([]byte, error) {
+		if k, ok := keys[keyID]; ok {
+			return k, nil
+		}
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+}
@@ -0,0 +1,234 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// AES-GCM-SIV (RFC 8452): AEAD resistente al mal uso del nonce. Si se repite
+// un nonce con la misma clave sólo se revela si dos mensajes son idénticos,
+// en lugar de romper la confidencialidad y la autenticidad como en GCM.
+// El precio es que cifrar requiere dos pasadas sobre los datos.
+
+const (
+	gcmsivNonceSize = 12
+	gcmsivTagSize   = 16
+	gcmsivMaxInput  = 1 << 36 // límite de la RFC para texto y datos asociados
+)
+
+type gcmsiv struct {
+	key []byte // clave de derivación (16 o 32 bytes)
+}
+
+// NewGCMSIV crea un AEAD AES-GCM-SIV con una clave de 16 o 32 bytes.
+func NewGCMSIV(key []byte) (cipher.AEAD, error) {
+	if len(key) != 16 && len(key) != 32 {
+		return nil, fmt.Errorf("clave AES-GCM-SIV no válida: %d bytes", len(key))
+	}
+	return &gcmsiv{key: append([]byte(nil), key...)}, nil
+}
+
+func (g *gcmsiv) NonceSize() int { return gcmsivNonceSize }
+func (g *gcmsiv) Overhead() int  { return gcmsivTagSize }
+
+func (g *gcmsiv) Seal(dst, nonce, plaintext, ad []byte) []byte {
+	if len(nonce) != gcmsivNonceSize {
+		panic("crypto: tamaño de nonce incorrecto para AES-GCM-SIV")
+	}
+	if uint64(len(plaintext)) > gcmsivMaxInput || uint64(len(ad)) > gcmsivMaxInput {
+		panic("crypto: mensaje demasiado largo para AES-GCM-SIV")
+	}
+	authKey, block := g.deriveKeys(nonce)
+	tag := gcmsivTag(authKey, block, nonce, plaintext, ad)
+
+	ret, out := sliceForAppend(dst, len(plaintext)+gcmsivTagSize)
+	gcmsivCTR(block, tag, out[:len(plaintext)], plaintext)
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+func (g *gcmsiv) Open(dst, nonce, ciphertext, ad []byte) ([]byte, error) {
+	if len(nonce) != gcmsivNonceSize {
+		panic("crypto: tamaño de nonce incorrecto para AES-GCM-SIV")
+	}
+	if len(ciphertext) < gcmsivTagSize || uint64(len(ciphertext)) > gcmsivMaxInput+gcmsivTagSize {
+		return nil, errGCMSIVOpen
+	}
+	ct, tag := ciphertext[:len(ciphertext)-gcmsivTagSize], ciphertext[len(ciphertext)-gcmsivTagSize:]
+	authKey, block := g.deriveKeys(nonce)
+
+	var tagBlock [16]byte
+	copy(tagBlock[:], tag)
+	ret, out := sliceForAppend(dst, len(ct))
+	gcmsivCTR(block, tagBlock, out, ct)
+
+	expected := gcmsivTag(authKey, block, nonce, out, ad)
+	if subtle.ConstantTimeCompare(expected[:], tag) != 1 {
+		clear(out)
+		return nil, errGCMSIVOpen
+	}
+	return ret, nil
+}
+
+var errGCMSIVOpen = errors.New("crypto: fallo de autenticación AES-GCM-SIV")
+
+// deriveKeys obtiene la clave POLYVAL y el cifrador AES del mensaje a partir
+// de la clave de derivación y el nonce (sección 4 de la RFC).
+func (g *gcmsiv) deriveKeys(nonce []byte) ([16]byte, cipher.Block) {
+	kdf, err := aes.NewCipher(g.key)
+	if err != nil {
+		panic(err) // el tamaño de clave ya se ha validado
+	}
+	var in, out [16]byte
+	copy(in[4:], nonce)
+	derived := make([]byte, 0, 16+len(g.key))
+	for i := uint32(0); len(derived) < cap(derived); i++ {
+		binary.LittleEndian.PutUint32(in[:4], i)
+		kdf.Encrypt(out[:], in[:])
+		derived = append(derived, out[:8]...)
+	}
+	var authKey [16]byte
+	copy(authKey[:], derived[:16])
+	block, err := aes.NewCipher(derived[16:])
+	if err != nil {
+		panic(err)
+	}
+	return authKey, block
+}
+
+// gcmsivTag calcula la etiqueta: AES(POLYVAL(ad, pt, longitudes) ^ nonce).
+func gcmsivTag(authKey [16]byte, block cipher.Block, nonce, plaintext, ad []byte) [16]byte {
+	p := newPolyval(authKey)
+	p.update(ad)
+	p.update(plaintext)
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[:8], uint64(len(ad))*8)
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(plaintext))*8)
+	p.update(lengths[:])
+
+	s := p.sum()
+	for i := range nonce {
+		s[i] ^= nonce[i]
+	}
+	s[15] &= 0x7f
+	block.Encrypt(s[:], s[:])
+	return s
+}
+
+// gcmsivCTR cifra en modo contador partiendo de la etiqueta con el bit
+// más alto a 1; el contador son los 32 primeros bits en little-endian.
+func gcmsivCTR(block cipher.Block, tag [16]byte, dst, src []byte) {
+	ctr := tag
+	ctr[15] |= 0x80
+	var ks [16]byte
+	for len(src) > 0 {
+		block.Encrypt(ks[:], ctr[:])
+		n := subtle.XORBytes(dst, src, ks[:])
+		dst, src = dst[n:], src[n:]
+		binary.LittleEndian.PutUint32(ctr[:4], binary.LittleEndian.Uint32(ctr[:4])+1)
+	}
+}
+
+// polyval implementa la función POLYVAL de la RFC 8452 sobre
+// GF(2^128) con el polinomio x^128 + x^127 + x^126 + x^121 + 1, con los
+// elementos en little-endian (lo = bits 0..63, hi = bits 64..127).
+type polyval struct {
+	h      fieldElement // H·x^-128, para que cada paso sea un único producto
+	s      fieldElement
+	buf    [16]byte
+	bufLen int
+}
+
+type fieldElement struct{ lo, hi uint64 }
+
+func newPolyval(key [16]byte) *polyval {
+	h := loadElement(key[:])
+	// dot(a, b) = a·b·x^-128; precalculamos H·x^-128
+	for i := 0; i < 128; i++ {
+		h = h.divX()
+	}
+	return &polyval{h: h}
+}
+
+// update procesa 'data' rellenando con ceros el último bloque incompleto.
+// Sólo se llama una vez por campo, así que el relleno es el de la RFC.
+func (p *polyval) update(data []byte) {
+	for len(data) >= 16 {
+		p.block(data[:16])
+		data = data[16:]
+	}
+	if len(data) > 0 {
+		var last [16]byte
+		copy(last[:], data)
+		p.block(last[:])
+	}
+}
+
+func (p *polyval) block(b []byte) {
+	x := loadElement(b)
+	p.s = fieldElement{p.s.lo ^ x.lo, p.s.hi ^ x.hi}.mul(p.h)
+}
+
+func (p *polyval) sum() [16]byte {
+	var out [16]byte
+	binary.LittleEndian.PutUint64(out[:8], p.s.lo)
+	binary.LittleEndian.PutUint64(out[8:], p.s.hi)
+	return out
+}
+
+func loadElement(b []byte) fieldElement {
+	return fieldElement{binary.LittleEndian.Uint64(b[:8]), binary.LittleEndian.Uint64(b[8:16])}
+}
+
+// mulX multiplica por x reduciendo módulo el polinomio (sin ramas).
+func (a fieldElement) mulX() fieldElement {
+	carry := -(a.hi >> 63)
+	r := fieldElement{a.lo << 1, a.hi<<1 | a.lo>>63}
+	r.lo ^= carry & 1
+	r.hi ^= carry & (1<<63 | 1<<62 | 1<<57)
+	return r
+}
+
+// divX multiplica por x^-1: si el término independiente es 1 se suma el
+// polinomio (incluido x^128) antes de desplazar.
+func (a fieldElement) divX() fieldElement {
+	odd := -(a.lo & 1)
+	a.lo ^= odd & 1
+	a.hi ^= odd & (1<<63 | 1<<62 | 1<<57)
+	return fieldElement{a.lo>>1 | a.hi<<63, a.hi>>1 | odd&(1<<63)}
+}
+
+// mul multiplica dos elementos módulo el polinomio (desplazar y sumar, sin
+// ramas dependientes de los datos).
+func (a fieldElement) mul(b fieldElement) fieldElement {
+	var r fieldElement
+	for i := 127; i >= 0; i-- {
+		r = r.mulX()
+		var bit uint64
+		if i >= 64 {
+			bit = (b.hi >> (i - 64)) & 1
+		} else {
+			bit = (b.lo >> i) & 1
+		}
+		mask := -bit
+		r.lo ^= a.lo & mask
+		r.hi ^= a.hi & mask
+	}
+	return r
+}
+
+// sliceForAppend amplía 'in' en n bytes y devuelve el total y la parte nueva.
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
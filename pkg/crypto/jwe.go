@@ -0,0 +1,101 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// JWE compacto (RFC 7516) con "alg":"dir" y "enc":"A256GCM": la clave de
+// sesión se usa directamente como CEK, de modo que cualquier biblioteca JOSE
+// (jose4j, python-jose, node-jose...) puede abrir los datos con ella.
+//
+//	BASE64URL(cabecera) . "" . BASE64URL(iv) . BASE64URL(texto cifrado) . BASE64URL(tag)
+//
+// El sentido, el usuario y la acción, que en SealSessionData van como datos
+// asociados, viajan aquí en la cabecera protegida, que GCM autentica.
+
+// jweHeader es la cabecera protegida de los JWE de sesión.
+type jweHeader struct {
+	Alg       string `json:"alg"`
+	Enc       string `json:"enc"`
+	Typ       string `json:"typ,omitempty"`
+	Zip       string `json:"zip,omitempty"`
+	Crit      []any  `json:"crit,omitempty"`
+	Direction string `json:"prac_dir"`
+	Subject   string `json:"sub"`
+	Action    string `json:"prac_act"`
+}
+
+const jweType = "prac-session+jwe"
+
+var b64url = base64.RawURLEncoding
+
+// SealSessionJWE es como SealSessionData pero produce un JWE compacto.
+func SealSessionJWE(key []byte, direction, username, action string, data []byte) (string, error) {
+	hdr, err := json.Marshal(jweHeader{
+		Alg:       "dir",
+		Enc:       "A256GCM",
+		Typ:       jweType,
+		Direction: direction,
+		Subject:   username,
+		Action:    action,
+	})
+	if err != nil {
+		return "", err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	iv, err := RandomBytes(aead.NonceSize())
+	if err != nil {
+		return "", err
+	}
+	protected := b64url.EncodeToString(hdr)
+	sealed := aead.Seal(nil, iv, data, []byte(protected))
+	ct, tag := sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+	return protected + ".." + b64url.EncodeToString(iv) + "." +
+		b64url.EncodeToString(ct) + "." + b64url.EncodeToString(tag), nil
+}
+
+// OpenSessionJWE descifra un JWE compacto producido por SealSessionJWE (o
+// por otra implementación JOSE con la misma cabecera). Rechaza cualquier
+// algoritmo que no sea dir/A256GCM, la compresión y las extensiones críticas.
+func OpenSessionJWE(key []byte, direction, username, action, token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 || parts[1] != "" {
+		return nil, ErrDecrypt
+	}
+	raw, err := b64url.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	var hdr jweHeader
+	if err := json.Unmarshal(raw, &hdr); err != nil {
+		return nil, ErrDecrypt
+	}
+	if hdr.Alg != "dir" || hdr.Enc != "A256GCM" || hdr.Zip != "" || len(hdr.Crit) > 0 ||
+		hdr.Direction != direction || hdr.Subject != username || hdr.Action != action {
+		return nil, ErrDecrypt
+	}
+
+	iv, err1 := b64url.DecodeString(parts[2])
+	ct, err2 := b64url.DecodeString(parts[3])
+	tag, err3 := b64url.DecodeString(parts[4])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return nil, ErrDecrypt
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aead.NonceSize() || len(tag) != aead.Overhead() {
+		return nil, ErrDecrypt
+	}
+	plain, err := aead.Open(nil, iv, append(ct, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plain, nil
+}
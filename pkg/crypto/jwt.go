@@ -0,0 +1,231 @@
+package crypto
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Tokens de sesión JWT compactos (RFC 7519) firmados con HS256 (HMAC con
+// una clave del servidor) o RS256 (RSA PKCS#1 v1.5): con RS256 cualquier
+// otro servicio puede validar los tokens con la clave pública.
+//
+//	BASE64URL(cabecera) . BASE64URL(claims) . BASE64URL(firma)
+//
+// El algoritmo lo fija quien verifica, nunca la cabecera del token: se
+// rechaza cualquier "alg" distinto del configurado (incluido "none").
+
+// Algoritmos de firma de JWT soportados.
+const (
+	JWTHS256 = "HS256"
+	JWTRS256 = "RS256"
+)
+
+// jwtType es el "typ" de la cabecera de los tokens de sesión.
+const jwtType = "JWT"
+
+// jwtLeeway es la tolerancia de reloj al comprobar exp e iat.
+const jwtLeeway = 30 * time.Second
+
+// ErrJWT indica un token mal formado, con firma inválida o caducado.
+var ErrJWT = errors.New("token JWT no válido")
+
+// JWTClaims son los claims de un token de sesión.
+type JWTClaims struct {
+	Issuer   string `json:"iss,omitempty"`
+	Subject  string `json:"sub"`            // nombre de usuario
+	Role     string `json:"role,omitempty"` // rol del usuario
+	IssuedAt int64  `json:"iat"`
+	Expiry   int64  `json:"exp"`
+	ID       string `json:"jti"` // identifica la sesión (permite revocarla)
+}
+
+// jwtHeader es la cabecera de los tokens.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// JWTSigner firma y verifica tokens con un algoritmo fijo. Construido con
+// NewRS256Verifier sólo puede verificar.
+type JWTSigner struct {
+	alg  string
+	kid  string
+	hmac []byte
+	priv *rsa.PrivateKey
+	pub  *rsa.PublicKey
+}
+
+// NewHS256Signer crea un JWTSigner HS256 con la clave 'key' (al menos 32 bytes).
+func NewHS256Signer(key []byte) (*JWTSigner, error) {
+	if len(key) < KeySize {
+		return nil, fmt.Errorf("clave HS256 demasiado corta: %d bytes", len(key))
+	}
+	return &JWTSigner{alg: JWTHS256, hmac: append([]byte(nil), key...)}, nil
+}
+
+// NewRS256Signer crea un JWTSigner RS256 con la clave privada 'priv'.
+func NewRS256Signer(priv *rsa.PrivateKey) (*JWTSigner, error) {
+	if priv.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("clave RSA demasiado corta: %d bits", priv.N.BitLen())
+	}
+	return &JWTSigner{alg: JWTRS256, kid: rsaKeyID(&priv.PublicKey), priv: priv, pub: &priv.PublicKey}, nil
+}
+
+// NewRS256Verifier crea un JWTSigner que sólo verifica tokens RS256 (para
+// servicios que reciben los tokens pero no los emiten).
+func NewRS256Verifier(pub *rsa.PublicKey) (*JWTSigner, error) {
+	if pub.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("clave RSA demasiado corta: %d bits", pub.N.BitLen())
+	}
+	return &JWTSigner{alg: JWTRS256, kid: rsaKeyID(pub), pub: pub}, nil
+}
+
+// Algorithm devuelve el algoritmo del JWTSigner (JWTHS256 o JWTRS256).
+func (j *JWTSigner) Algorithm() string { return j.alg }
+
+// rsaKeyID identifica la clave pública en el "kid" de la cabecera: los
+// primeros 8 bytes, en hexadecimal, del SHA-256 de su forma PKIX.
+func rsaKeyID(pub *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// Sign devuelve el token compacto con los claims 'c'.
+func (j *JWTSigner) Sign(c JWTClaims) (string, error) {
+	if j.hmac == nil && j.priv == nil {
+		return "", errors.New("el JWTSigner sólo puede verificar")
+	}
+	hdr, err := json.Marshal(jwtHeader{Alg: j.alg, Typ: jwtType, Kid: j.kid})
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	signing := b64url.EncodeToString(hdr) + "." + b64url.EncodeToString(body)
+	sig, err := j.sign([]byte(signing))
+	if err != nil {
+		return "", err
+	}
+	return signing + "." + b64url.EncodeToString(sig), nil
+}
+
+func (j *JWTSigner) sign(signing []byte) ([]byte, error) {
+	if j.alg == JWTHS256 {
+		m := hmac.New(sha256.New, j.hmac)
+		m.Write(signing)
+		return m.Sum(nil), nil
+	}
+	sum := sha256.Sum256(signing)
+	return rsa.SignPKCS1v15(rand.Reader, j.priv, crypto.SHA256, sum[:])
+}
+
+// Verify comprueba la firma y la caducidad de 'token' en el instante 'now'
+// y devuelve sus claims. Cualquier fallo devuelve ErrJWT.
+func (j *JWTSigner) Verify(token string, now time.Time) (JWTClaims, error) {
+	var c JWTClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return c, ErrJWT
+	}
+	rawHdr, err1 := b64url.DecodeString(parts[0])
+	rawBody, err2 := b64url.DecodeString(parts[1])
+	sig, err3 := b64url.DecodeString(parts[2])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return c, ErrJWT
+	}
+	var hdr jwtHeader
+	if err := json.Unmarshal(rawHdr, &hdr); err != nil || hdr.Alg != j.alg {
+		return c, ErrJWT
+	}
+
+	signing := []byte(parts[0] + "." + parts[1])
+	if j.alg == JWTHS256 {
+		want, _ := j.sign(signing)
+		if !hmac.Equal(want, sig) {
+			return c, ErrJWT
+		}
+	} else {
+		sum := sha256.Sum256(signing)
+		if rsa.VerifyPKCS1v15(j.pub, crypto.SHA256, sum[:], sig) != nil {
+			return c, ErrJWT
+		}
+	}
+
+	if err := json.Unmarshal(rawBody, &c); err != nil {
+		return JWTClaims{}, ErrJWT
+	}
+	if c.Subject == "" || c.Expiry == 0 ||
+		now.After(time.Unix(c.Expiry, 0).Add(jwtLeeway)) ||
+		time.Unix(c.IssuedAt, 0).After(now.Add(jwtLeeway)) {
+		return JWTClaims{}, ErrJWT
+	}
+	return c, nil
+}
+
+// LoadOrCreateRSAKey lee la clave privada RSA PKCS#8 de 'path' o, si no
+// existe, genera una de 3072 bits y la guarda (0600) junto con su clave
+// pública PKIX en path+".pub" (0644), que es la que se reparte a los
+// servicios que validan los tokens.
+func LoadOrCreateRSAKey(path string) (*rsa.PrivateKey, error) {
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(raw)
+		if block == nil || block.Type != "PRIVATE KEY" {
+			return nil, fmt.Errorf("%s no contiene una clave privada PEM", path)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo %s: %v", path, err)
+		}
+		priv, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s no contiene una clave RSA", path)
+		}
+		return priv, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error leyendo %s: %v", path, err)
+	}
+
+	priv, err := rsa.GenerateKey(rand.Reader, 3072)
+	if err != nil {
+		return nil, err
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		return nil, fmt.Errorf("error escribiendo %s: %v", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		return nil, fmt.Errorf("error escribiendo %s.pub: %v", path, err)
+	}
+	return priv, nil
+}
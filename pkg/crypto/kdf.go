@@ -0,0 +1,33 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// DeriveKey obtiene con HKDF-SHA256 una subclave de KeySize bytes para el
+// propósito 'info' a partir de una clave maestra. Claves con distinto 'info'
+// son independientes, así que comprometer una no revela las demás.
+func DeriveKey(master []byte, info string) []byte {
+	key := make([]byte, KeySize)
+	r := hkdf.New(sha256.New, master, nil, []byte(info))
+	if _, err := io.ReadFull(r, key); err != nil {
+		// HKDF sólo falla si se piden más de 255*32 bytes
+		panic(err)
+	}
+	return key
+}
+
+// SessionKey deriva la clave simétrica de una sesión a partir del secreto
+// del servidor y del token de sesión. Cada login produce un token nuevo y,
+// por tanto, una clave distinta: lo cifrado en una sesión no sirve en otra.
+func SessionKey(secret []byte, token string) []byte {
+	key := make([]byte, KeySize)
+	r := hkdf.New(sha256.New, secret, []byte(token), []byte("prac-session-data"))
+	if _, err := io.ReadFull(r, key); err != nil {
+		panic(err)
+	}
+	return key
+}
@@ -0,0 +1,149 @@
+package crypto
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// keyFileVersion es la versión actual del formato de fichero de clave.
+const keyFileVersion = 1
+
+// keyFileAD es el dato asociado de los ficheros de clave en disco.
+const keyFileAD = "prac-keyfile"
+
+// Límites de los parámetros Argon2 que se aceptan al abrir un fichero.
+const (
+	maxKeyFileTime   = 64
+	maxKeyFileMemory = 4 * 1024 * 1024 // KiB (4 GiB)
+)
+
+// ErrWrongPassphrase indica que la frase de paso no abre el fichero de clave.
+var ErrWrongPassphrase = errors.New("frase de paso incorrecta o fichero de clave dañado")
+
+// keyFile es el contenido (JSON) del fichero que protege la clave maestra.
+// La clave se cifra con AES-256-GCM bajo una clave derivada de la frase de
+// paso con Argon2id; los parámetros se guardan para poder endurecerlos sin
+// invalidar ficheros antiguos.
+type keyFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    []byte `json:"salt"`
+	Key     []byte `json:"key"` // clave maestra cifrada (nonce || ct || tag)
+}
+
+// CreateKeyFile genera una clave maestra aleatoria, la protege con la frase
+// de paso y la escribe en 'path' (permisos 0600). Falla si el fichero ya existe.
+func CreateKeyFile(path string, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("la frase de paso no puede estar vacía")
+	}
+	master, err := RandomBytes(KeySize)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := sealKeyFile(master, passphrase, keyFileAD)
+	if err != nil {
+		Wipe(master)
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		Wipe(master)
+		return nil, fmt.Errorf("error creando fichero de clave: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(raw); err != nil {
+		Wipe(master)
+		return nil, fmt.Errorf("error escribiendo fichero de clave: %v", err)
+	}
+	return master, nil
+}
+
+// sealKeyFile protege 'key' con la frase de paso y devuelve el JSON del
+// fichero. 'ad' separa los distintos usos del formato (ver keyFileAD).
+func sealKeyFile(key, passphrase []byte, ad string) ([]byte, error) {
+	salt, err := RandomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+
+	p := DefaultArgon2Params
+	kf := keyFile{
+		Version: keyFileVersion,
+		KDF:     "argon2id",
+		Time:    p.Time,
+		Memory:  p.Memory,
+		Threads: p.Threads,
+		Salt:    salt,
+	}
+	kek := argon2.IDKey(passphrase, salt, kf.Time, kf.Memory, kf.Threads, KeySize)
+	kf.Key, err = Seal(kek, key, []byte(ad))
+	Wipe(kek)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(kf, "", "  ")
+}
+
+// ChangeKeyFilePassphrase vuelve a proteger la clave de 'path' con una frase
+// de paso nueva (y sal y parámetros Argon2 actuales). La clave no cambia. El
+// fichero se reemplaza de forma atómica: si algo falla, sigue valiendo la
+// frase de paso antigua.
+func ChangeKeyFilePassphrase(path string, oldPassphrase, newPassphrase []byte) error {
+	if len(newPassphrase) == 0 {
+		return errors.New("la frase de paso no puede estar vacía")
+	}
+	key, err := OpenKeyFile(path, oldPassphrase)
+	if err != nil {
+		return err
+	}
+	defer Wipe(key)
+	raw, err := sealKeyFile(key, newPassphrase, keyFileAD)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("error escribiendo fichero de clave: %v", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// OpenKeyFile lee el fichero de clave y descifra la clave maestra.
+func OpenKeyFile(path string, passphrase []byte) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo fichero de clave: %w", err)
+	}
+	return openKeyFile(raw, passphrase, keyFileAD)
+}
+
+// openKeyFile descifra la clave de un fichero (ya leído) de sealKeyFile.
+func openKeyFile(raw, passphrase []byte, ad string) ([]byte, error) {
+	var kf keyFile
+	if err := json.Unmarshal(raw, &kf); err != nil {
+		return nil, fmt.Errorf("fichero de clave mal formado: %v", err)
+	}
+	if kf.Version != keyFileVersion || kf.KDF != "argon2id" {
+		return nil, fmt.Errorf("formato de fichero de clave no soportado (versión %d, kdf %s)", kf.Version, kf.KDF)
+	}
+	// Los parámetros vienen del fichero: unos absurdos bloquearían el proceso
+	if kf.Time == 0 || kf.Time > maxKeyFileTime || kf.Memory > maxKeyFileMemory || kf.Threads == 0 {
+		return nil, fmt.Errorf("parámetros Argon2 del fichero de clave fuera de rango (m=%d, t=%d, p=%d)", kf.Memory, kf.Time, kf.Threads)
+	}
+
+	kek := argon2.IDKey(passphrase, kf.Salt, kf.Time, kf.Memory, kf.Threads, KeySize)
+	master, err := Open(kek, kf.Key, []byte(ad))
+	Wipe(kek)
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+	return master, nil
+}
@@ -0,0 +1,465 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/cloudflare/circl/group"
+	"github.com/cloudflare/circl/oprf"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+// OPAQUE-3DH (RFC 9807) sobre ristretto255 con SHA-512. El servidor nunca
+// ve la contraseña ni guarda nada que permita un ataque de diccionario
+// offline sin su clave OPRF; al final ambas partes comparten una clave de
+// sesión autenticada mutuamente.
+//
+// Diferencias con la RFC: la identidad del cliente es su nombre de usuario,
+// la función de endurecimiento es Argon2id y no se generan registros falsos
+// para usuarios inexistentes.
+
+const (
+	opaqueNonceSize = 32
+	opaqueHashSize  = sha512.Size
+	opaqueElemSize  = 32 // elemento ristretto255 comprimido
+	opaqueContext   = "prac-opaque-v1"
+)
+
+var (
+	opaqueSuite = oprf.SuiteRistretto255
+	opaqueGroup = group.Ristretto255
+
+	// ErrOPAQUEAuth indica que la contraseña es incorrecta o que alguna de las
+	// partes no ha superado la autenticación.
+	ErrOPAQUEAuth = errors.New("autenticación OPAQUE fallida")
+
+	// ErrOPAQUEMessage indica un mensaje OPAQUE mal formado.
+	ErrOPAQUEMessage = errors.New("mensaje OPAQUE mal formado")
+)
+
+// Mensajes del protocolo. Viajan serializados en JSON (los []byte en base64).
+type (
+	// OPAQUERegistrationRequest es la primera ronda del registro (cliente).
+	OPAQUERegistrationRequest struct {
+		BlindedMessage []byte `json:"blindedMessage"`
+	}
+	// OPAQUERegistrationResponse es la respuesta del servidor al registro.
+	OPAQUERegistrationResponse struct {
+		EvaluatedMessage []byte `json:"evaluatedMessage"`
+		ServerPublicKey  []byte `json:"serverPublicKey"`
+	}
+	// OPAQUERecord es lo que el servidor almacena por usuario.
+	OPAQUERecord struct {
+		ClientPublicKey []byte `json:"clientPublicKey"`
+		MaskingKey      []byte `json:"maskingKey"`
+		Envelope        []byte `json:"envelope"`
+	}
+	// OPAQUEKE1 es el primer mensaje del login (cliente).
+	OPAQUEKE1 struct {
+		BlindedMessage []byte `json:"blindedMessage"`
+		ClientNonce    []byte `json:"clientNonce"`
+		ClientKeyshare []byte `json:"clientKeyshare"`
+	}
+	// OPAQUEKE2 es la respuesta del servidor al login.
+	OPAQUEKE2 struct {
+		EvaluatedMessage []byte `json:"evaluatedMessage"`
+		MaskingNonce     []byte `json:"maskingNonce"`
+		MaskedResponse   []byte `json:"maskedResponse"`
+		ServerNonce      []byte `json:"serverNonce"`
+		ServerKeyshare   []byte `json:"serverKeyshare"`
+		ServerMAC        []byte `json:"serverMAC"`
+	}
+	// OPAQUEKE3 es el mensaje final del cliente.
+	OPAQUEKE3 struct {
+		ClientMAC []byte `json:"clientMAC"`
+	}
+)
+
+// ---------------------------------------------------------------------------
+// Servidor
+
+// OPAQUEServer contiene las claves de larga duración del servidor.
+type OPAQUEServer struct {
+	oprfSeed []byte
+	sk       group.Scalar
+	pk       group.Element
+}
+
+// NewOPAQUEServer deriva la semilla OPRF y la clave estática AKE a partir
+// de la clave maestra del servidor.
+func NewOPAQUEServer(master []byte) *OPAQUEServer {
+	sk := opaqueGroup.HashToScalar(DeriveKey(master, "opaque-ake"), []byte("OPAQUE-DeriveDiffieHellmanKeyPair"))
+	return &OPAQUEServer{
+		oprfSeed: DeriveKey(master, "opaque-oprf"),
+		sk:       sk,
+		pk:       opaqueGroup.NewElement().MulGen(sk),
+	}
+}
+
+// oprfServer devuelve el evaluador OPRF con la clave propia de 'username'.
+func (s *OPAQUEServer) oprfServer(username string) (oprf.Server, error) {
+	key, err := oprf.DeriveKey(opaqueSuite, oprf.BaseMode, s.oprfSeed, []byte("OPAQUE-DeriveKeyPair"+username))
+	if err != nil {
+		return oprf.Server{}, err
+	}
+	return oprf.NewServer(opaqueSuite, key), nil
+}
+
+// RegistrationResponse evalúa el OPRF sobre el mensaje cegado del cliente.
+func (s *OPAQUEServer) RegistrationResponse(username string, req *OPAQUERegistrationRequest) (*OPAQUERegistrationResponse, error) {
+	evaluated, err := s.evaluate(username, req.BlindedMessage)
+	if err != nil {
+		return nil, err
+	}
+	return &OPAQUERegistrationResponse{EvaluatedMessage: evaluated, ServerPublicKey: mustMarshal(s.pk)}, nil
+}
+
+// OPAQUEServerSession es el estado del servidor entre KE2 y KE3.
+type OPAQUEServerSession struct {
+	expectedMAC []byte
+	sessionKey  []byte
+}
+
+// LoginStart procesa KE1 con el registro almacenado y genera KE2.
+func (s *OPAQUEServer) LoginStart(username string, rec *OPAQUERecord, ke1 *OPAQUEKE1) (*OPAQUEKE2, *OPAQUEServerSession, error) {
+	epkU, err1 := unmarshalElement(ke1.ClientKeyshare)
+	pkU, err2 := unmarshalElement(rec.ClientPublicKey)
+	if err1 != nil || err2 != nil || len(ke1.ClientNonce) != opaqueNonceSize {
+		return nil, nil, ErrOPAQUEMessage
+	}
+	evaluated, err := s.evaluate(username, ke1.BlindedMessage)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Respuesta de credenciales enmascarada: sólo quien conozca la
+	// contraseña puede recuperar la clave pública del servidor y el sobre.
+	ke2 := &OPAQUEKE2{EvaluatedMessage: evaluated}
+	if ke2.MaskingNonce, err = RandomBytes(opaqueNonceSize); err != nil {
+		return nil, nil, err
+	}
+	plain := append(mustMarshal(s.pk), rec.Envelope...)
+	pad := opaqueExpand(rec.MaskingKey, append(append([]byte{}, ke2.MaskingNonce...), "CredentialResponsePad"...), len(plain))
+	ke2.MaskedResponse = xorBytes(pad, plain)
+
+	// 3DH
+	eskS := opaqueGroup.RandomNonZeroScalar(rand.Reader)
+	ke2.ServerKeyshare = mustMarshal(opaqueGroup.NewElement().MulGen(eskS))
+	if ke2.ServerNonce, err = RandomBytes(opaqueNonceSize); err != nil {
+		return nil, nil, err
+	}
+	ikm := concat(
+		dh(eskS, epkU),
+		dh(s.sk, epkU),
+		dh(eskS, pkU),
+	)
+	preamble := opaquePreamble(username, ke1, ke2, mustMarshal(s.pk))
+	km2, km3, sessionKey := opaqueKeySchedule(ikm, preamble)
+	defer Wipe(ikm, km2, km3)
+
+	ke2.ServerMAC = opaqueMAC(km2, opaqueHash(preamble))
+	return ke2, &OPAQUEServerSession{
+		expectedMAC: opaqueMAC(km3, opaqueHash(preamble, ke2.ServerMAC)),
+		sessionKey:  sessionKey,
+	}, nil
+}
+
+// Finish comprueba el MAC del cliente (KE3). Si es correcto, el cliente ha
+// demostrado conocer la contraseña y se devuelve la clave de sesión.
+func (ss *OPAQUEServerSession) Finish(ke3 *OPAQUEKE3) ([]byte, error) {
+	if !hmac.Equal(ke3.ClientMAC, ss.expectedMAC) {
+		return nil, ErrOPAQUEAuth
+	}
+	return ss.sessionKey, nil
+}
+
+// evaluate aplica el OPRF del usuario a un elemento cegado serializado.
+func (s *OPAQUEServer) evaluate(username string, blinded []byte) ([]byte, error) {
+	elem, err := unmarshalElement(blinded)
+	if err != nil {
+		return nil, ErrOPAQUEMessage
+	}
+	srv, err := s.oprfServer(username)
+	if err != nil {
+		return nil, err
+	}
+	ev, err := srv.Evaluate(&oprf.EvaluationRequest{Elements: []oprf.Blinded{elem}})
+	if err != nil {
+		return nil, ErrOPAQUEMessage
+	}
+	return mustMarshal(ev.Elements[0]), nil
+}
+
+// ---------------------------------------------------------------------------
+// Cliente
+
+// OPAQUEClient mantiene el estado del cliente durante registro o login.
+type OPAQUEClient struct {
+	username string
+	password []byte // copia propia, se borra con Wipe
+	fin      *oprf.FinalizeData
+	eskU     group.Scalar
+	ke1      *OPAQUEKE1
+}
+
+// NewOPAQUEClient prepara un cliente para 'username' y 'password'. Guarda
+// una copia de 'password', así que el llamante puede borrar la suya.
+func NewOPAQUEClient(username string, password []byte) *OPAQUEClient {
+	return &OPAQUEClient{username: username, password: append([]byte(nil), password...)}
+}
+
+// Wipe borra la contraseña. Hay que llamarlo al terminar con el cliente.
+func (c *OPAQUEClient) Wipe() {
+	Wipe(c.password)
+}
+
+// RegistrationRequest ciega la contraseña para la primera ronda del registro.
+func (c *OPAQUEClient) RegistrationRequest() (*OPAQUERegistrationRequest, error) {
+	blinded, err := c.blind()
+	if err != nil {
+		return nil, err
+	}
+	return &OPAQUERegistrationRequest{BlindedMessage: blinded}, nil
+}
+
+// FinalizeRegistration construye el registro que se envía al servidor.
+// Devuelve también la export key, una clave que sólo conoce el cliente.
+func (c *OPAQUEClient) FinalizeRegistration(resp *OPAQUERegistrationResponse) (*OPAQUERecord, []byte, error) {
+	rwd, err := c.randomizedPassword(resp.EvaluatedMessage)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := RandomBytes(opaqueNonceSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer Wipe(rwd)
+	pkU, authTag, exportKey := c.envelopeKeys(rwd, nonce, resp.ServerPublicKey)
+	return &OPAQUERecord{
+		ClientPublicKey: mustMarshal(opaqueGroup.NewElement().MulGen(pkU)),
+		MaskingKey:      opaqueExpand(rwd, []byte("MaskingKey"), opaqueHashSize),
+		Envelope:        append(nonce, authTag...),
+	}, exportKey, nil
+}
+
+// LoginStart genera KE1.
+func (c *OPAQUEClient) LoginStart() (*OPAQUEKE1, error) {
+	blinded, err := c.blind()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := RandomBytes(opaqueNonceSize)
+	if err != nil {
+		return nil, err
+	}
+	c.eskU = opaqueGroup.RandomNonZeroScalar(rand.Reader)
+	c.ke1 = &OPAQUEKE1{
+		BlindedMessage: blinded,
+		ClientNonce:    nonce,
+		ClientKeyshare: mustMarshal(opaqueGroup.NewElement().MulGen(c.eskU)),
+	}
+	return c.ke1, nil
+}
+
+// LoginFinish procesa KE2: recupera las credenciales, autentica al
+// servidor y genera KE3. Devuelve además la clave de sesión y la export key.
+func (c *OPAQUEClient) LoginFinish(ke2 *OPAQUEKE2) (ke3 *OPAQUEKE3, sessionKey, exportKey []byte, err error) {
+	if c.ke1 == nil {
+		return nil, nil, nil, errors.New("LoginStart no se ha llamado")
+	}
+	rwd, err := c.randomizedPassword(ke2.EvaluatedMessage)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer Wipe(rwd)
+
+	// Quitamos la máscara y comprobamos el sobre (falla si la contraseña es incorrecta)
+	expectedLen := opaqueElemSize + opaqueNonceSize + opaqueHashSize
+	if len(ke2.MaskedResponse) != expectedLen || len(ke2.MaskingNonce) != opaqueNonceSize {
+		return nil, nil, nil, ErrOPAQUEMessage
+	}
+	maskingKey := opaqueExpand(rwd, []byte("MaskingKey"), opaqueHashSize)
+	pad := opaqueExpand(maskingKey, append(append([]byte{}, ke2.MaskingNonce...), "CredentialResponsePad"...), expectedLen)
+	plain := xorBytes(pad, ke2.MaskedResponse)
+	pkSBytes, envelope := plain[:opaqueElemSize], plain[opaqueElemSize:]
+	nonce, tag := envelope[:opaqueNonceSize], envelope[opaqueNonceSize:]
+
+	skU, expectedTag, exportKey := c.envelopeKeys(rwd, nonce, pkSBytes)
+	if !hmac.Equal(tag, expectedTag) {
+		return nil, nil, nil, ErrOPAQUEAuth
+	}
+
+	pkS, err1 := unmarshalElement(pkSBytes)
+	epkS, err2 := unmarshalElement(ke2.ServerKeyshare)
+	if err1 != nil || err2 != nil {
+		return nil, nil, nil, ErrOPAQUEMessage
+	}
+	ikm := concat(
+		dh(c.eskU, epkS),
+		dh(c.eskU, pkS),
+		dh(skU, epkS),
+	)
+	preamble := opaquePreamble(c.username, c.ke1, ke2, pkSBytes)
+	km2, km3, sessionKey := opaqueKeySchedule(ikm, preamble)
+	defer Wipe(ikm, km2, km3)
+
+	if !hmac.Equal(ke2.ServerMAC, opaqueMAC(km2, opaqueHash(preamble))) {
+		return nil, nil, nil, ErrOPAQUEAuth
+	}
+	return &OPAQUEKE3{ClientMAC: opaqueMAC(km3, opaqueHash(preamble, ke2.ServerMAC))}, sessionKey, exportKey, nil
+}
+
+// blind ciega la contraseña con un factor aleatorio nuevo.
+func (c *OPAQUEClient) blind() ([]byte, error) {
+	fin, req, err := oprf.NewClient(opaqueSuite).Blind([][]byte{c.password})
+	if err != nil {
+		return nil, err
+	}
+	c.fin = fin
+	return mustMarshal(req.Elements[0]), nil
+}
+
+// randomizedPassword deshace el cegado y endurece la salida del OPRF.
+func (c *OPAQUEClient) randomizedPassword(evaluated []byte) ([]byte, error) {
+	elem, err := unmarshalElement(evaluated)
+	if err != nil || c.fin == nil {
+		return nil, ErrOPAQUEMessage
+	}
+	out, err := oprf.NewClient(opaqueSuite).Finalize(c.fin, &oprf.Evaluation{Elements: []oprf.Evaluated{elem}})
+	if err != nil {
+		return nil, ErrOPAQUEMessage
+	}
+	p := DefaultArgon2Params
+	stretched := argon2.IDKey(out[0], make([]byte, 16), p.Time, p.Memory, p.Threads, opaqueHashSize)
+	ikm := concat(out[0], stretched)
+	defer Wipe(out[0], stretched, ikm)
+	return hkdf.Extract(sha512.New, ikm, nil), nil
+}
+
+// envelopeKeys deriva del sobre la clave privada del cliente, el tag
+// esperado (que liga la clave pública del servidor y las identidades)
+// y la export key.
+func (c *OPAQUEClient) envelopeKeys(rwd, nonce, pkS []byte) (skU group.Scalar, authTag, exportKey []byte) {
+	label := func(l string) []byte { return append(append([]byte{}, nonce...), l...) }
+	authKey := opaqueExpand(rwd, label("AuthKey"), opaqueHashSize)
+	exportKey = opaqueExpand(rwd, label("ExportKey"), opaqueHashSize)
+	seed := opaqueExpand(rwd, label("PrivateKey"), 32)
+	skU = opaqueGroup.HashToScalar(seed, []byte("OPAQUE-DeriveDiffieHellmanKeyPair"))
+	defer Wipe(authKey, seed)
+
+	creds := concat(pkS, lp(pkS), lp([]byte(c.username)))
+	authTag = opaqueMAC(authKey, concat(nonce, creds))
+	return skU, authTag, exportKey
+}
+
+// ---------------------------------------------------------------------------
+// Utilidades comunes
+
+// opaquePreamble liga el intercambio completo a las identidades y mensajes.
+func opaquePreamble(username string, ke1 *OPAQUEKE1, ke2 *OPAQUEKE2, pkS []byte) []byte {
+	return concat(
+		[]byte("OPAQUEv1-"), lp([]byte(opaqueContext)),
+		lp([]byte(username)),
+		ke1.BlindedMessage, ke1.ClientNonce, ke1.ClientKeyshare,
+		lp(pkS),
+		ke2.EvaluatedMessage, ke2.MaskingNonce, ke2.MaskedResponse,
+		ke2.ServerNonce, ke2.ServerKeyshare,
+	)
+}
+
+// opaqueKeySchedule deriva las claves MAC de ambas partes y la de sesión.
+func opaqueKeySchedule(ikm, preamble []byte) (km2, km3, sessionKey []byte) {
+	prk := hkdf.Extract(sha512.New, ikm, nil)
+	th := opaqueHash(preamble)
+	handshake := expandLabel(prk, "HandshakeSecret", th)
+	sessionKey = expandLabel(prk, "SessionKey", th)
+	return expandLabel(handshake, "ServerMAC", nil), expandLabel(handshake, "ClientMAC", nil), sessionKey
+}
+
+// expandLabel implementa Expand-Label de la RFC 9807.
+func expandLabel(secret []byte, label string, context []byte) []byte {
+	full := "OPAQUE-" + label
+	info := binary.BigEndian.AppendUint16(nil, opaqueHashSize)
+	info = append(info, byte(len(full)))
+	info = append(info, full...)
+	info = append(info, byte(len(context)))
+	info = append(info, context...)
+	return opaqueExpand(secret, info, opaqueHashSize)
+}
+
+func opaqueExpand(prk, info []byte, n int) []byte {
+	out := make([]byte, n)
+	if _, err := io.ReadFull(hkdf.Expand(sha512.New, prk, info), out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+func opaqueMAC(key, msg []byte) []byte {
+	m := hmac.New(sha512.New, key)
+	m.Write(msg)
+	return m.Sum(nil)
+}
+
+func opaqueHash(parts ...[]byte) []byte {
+	h := sha512.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
+
+func dh(s group.Scalar, p group.Element) []byte {
+	return mustMarshal(opaqueGroup.NewElement().Mul(p, s))
+}
+
+func unmarshalElement(b []byte) (group.Element, error) {
+	e := opaqueGroup.NewElement()
+	if err := e.UnmarshalBinary(b); err != nil {
+		return nil, err
+	}
+	if e.IsIdentity() {
+		return nil, ErrOPAQUEMessage
+	}
+	return e, nil
+}
+
+func mustMarshal(e group.Element) []byte {
+	b, err := e.MarshalBinaryCompress()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// lp antepone la longitud (2 bytes) a 'b'.
+func lp(b []byte) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(b))), b...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, p := range parts {
+		out = append(out, p...)
+	}
+	return out
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
+
+// OPAQUETokenKey deriva de la clave de sesión OPAQUE la clave AEAD con la
+// que el servidor cifra el token de sesión para el cliente.
+func OPAQUETokenKey(sessionKey []byte) []byte {
+	return DeriveKey(sessionKey, "opaque-token")
+}
@@ -0,0 +1,121 @@
+package crypto
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Exportación e importación en formato OpenPGP (RFC 4880, armadura ASCII),
+// compatible con GnuPG: lo exportado se descifra con "gpg -d" y se pueden
+// importar ficheros creados con "gpg -c -a" (frase de paso) o
+// "gpg -e -a -r <usuario>" (clave pública).
+
+// pgpConfig fuerza AES-256 en lugar del AES-128 por defecto.
+var pgpConfig = &packet.Config{DefaultCipher: packet.CipherAES256}
+
+// ErrPGPPassphrase indica que la frase de paso (del mensaje o de la clave
+// privada) no es correcta.
+var ErrPGPPassphrase = errors.New("frase de paso OpenPGP incorrecta")
+
+// PGPEncryptSymmetric escribe en 'w' un mensaje OpenPGP armado con 'data'
+// cifrado con 'passphrase' (equivalente a "gpg -c -a").
+func PGPEncryptSymmetric(w io.Writer, data, passphrase []byte, filename string) error {
+	return pgpArmor(w, func(out io.Writer) (io.WriteCloser, error) {
+		return openpgp.SymmetricallyEncrypt(out, passphrase, &openpgp.FileHints{FileName: filename}, pgpConfig)
+	}, data)
+}
+
+// PGPEncryptTo escribe en 'w' un mensaje OpenPGP armado con 'data' cifrado
+// para las claves públicas armadas de 'publicKeys' (equivalente a "gpg -e -a").
+func PGPEncryptTo(w io.Writer, data []byte, publicKeys io.Reader, filename string) error {
+	to, err := openpgp.ReadArmoredKeyRing(publicKeys)
+	if err != nil {
+		return fmt.Errorf("clave pública OpenPGP no válida: %v", err)
+	}
+	return pgpArmor(w, func(out io.Writer) (io.WriteCloser, error) {
+		return openpgp.Encrypt(out, to, nil, &openpgp.FileHints{FileName: filename}, pgpConfig)
+	}, data)
+}
+
+// pgpArmor aplica la armadura ASCII alrededor del cifrado 'encrypt'.
+func pgpArmor(w io.Writer, encrypt func(io.Writer) (io.WriteCloser, error), data []byte) error {
+	aw, err := armor.Encode(w, "PGP MESSAGE", nil)
+	if err != nil {
+		return err
+	}
+	pw, err := encrypt(aw)
+	if err != nil {
+		return err
+	}
+	if _, err := pw.Write(data); err != nil {
+		return err
+	}
+	if err := pw.Close(); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+// PGPDecrypt lee un mensaje OpenPGP armado y devuelve su contenido. Si
+// 'privateKeys' no es nil (claves privadas armadas), 'passphrase' se usa
+// para desbloquearlas; si no, como frase de paso del mensaje. La integridad
+// (MDC/AEAD) se comprueba al leer todo el contenido.
+func PGPDecrypt(r io.Reader, privateKeys io.Reader, passphrase []byte) ([]byte, error) {
+	block, err := armor.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("no es un fichero OpenPGP armado: %v", err)
+	}
+	if block.Type != "PGP MESSAGE" {
+		return nil, fmt.Errorf("tipo de bloque OpenPGP inesperado: %s", block.Type)
+	}
+
+	var keyring openpgp.EntityList
+	if privateKeys != nil {
+		if keyring, err = openpgp.ReadArmoredKeyRing(privateKeys); err != nil {
+			return nil, fmt.Errorf("clave privada OpenPGP no válida: %v", err)
+		}
+	}
+
+	// La biblioteca vuelve a llamar a 'prompt' mientras no acierte: sólo
+	// tenemos una frase de paso, así que al segundo intento abandonamos.
+	tried := false
+	prompt := func(keys []openpgp.Key, symmetric bool) ([]byte, error) {
+		if tried {
+			return nil, ErrPGPPassphrase
+		}
+		tried = true
+		if symmetric && keyring == nil {
+			return passphrase, nil
+		}
+		for _, k := range keys {
+			if k.PrivateKey != nil && k.PrivateKey.Encrypted {
+				if err := k.PrivateKey.Decrypt(passphrase); err != nil {
+					return nil, ErrPGPPassphrase
+				}
+			}
+		}
+		return nil, nil
+	}
+
+	md, err := openpgp.ReadMessage(block.Body, keyring, prompt, pgpConfig)
+	if err != nil {
+		if errors.Is(err, ErrPGPPassphrase) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error descifrando el mensaje OpenPGP: %v", err)
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, md.UnverifiedBody); err != nil {
+		return nil, fmt.Errorf("mensaje OpenPGP corrupto o manipulado: %v", err)
+	}
+	if md.IsSigned && md.SignatureError != nil {
+		return nil, fmt.Errorf("firma OpenPGP no válida: %v", md.SignatureError)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,190 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Argon2Params recoge los parámetros de coste de Argon2id.
+type Argon2Params struct {
+	Time    uint32 // número de pasadas sobre la memoria
+	Memory  uint32 // memoria en KiB
+	Threads uint8  // grado de paralelismo
+	KeyLen  uint32 // longitud del hash resultante en bytes
+	SaltLen uint32 // longitud de la sal en bytes
+}
+
+// DefaultArgon2Params son los parámetros recomendados por la RFC 9106
+// para entornos con memoria limitada.
+var DefaultArgon2Params = Argon2Params{
+	Time:    3,
+	Memory:  64 * 1024,
+	Threads: 2,
+	KeyLen:  32,
+	SaltLen: 16,
+}
+
+var (
+	// ErrInvalidHash indica que la cadena almacenada no tiene el formato esperado.
+	ErrInvalidHash = errors.New("formato de hash de contraseña no válido")
+
+	// ErrPepperRequired indica que el hash se generó con pepper pero no hay ninguno configurado.
+	ErrPepperRequired = errors.New("el hash requiere un pepper y no hay ninguno configurado")
+)
+
+// PasswordHasher deriva y verifica hashes de contraseña con Argon2id.
+// Si Pepper no está vacío, la contraseña se mezcla primero con
+// HMAC-SHA256(pepper, contraseña); el pepper nunca se guarda junto al hash,
+// de modo que robar sólo la base de datos no basta para un ataque offline.
+type PasswordHasher struct {
+	Params Argon2Params
+	Pepper []byte
+}
+
+// NewPasswordHasher crea un hasher con los parámetros y pepper (opcional) dados.
+func NewPasswordHasher(params Argon2Params, pepper []byte) *PasswordHasher {
+	return &PasswordHasher{Params: params, Pepper: pepper}
+}
+
+// Hash deriva un hash Argon2id de la contraseña con una sal aleatoria
+// y lo devuelve codificado en formato PHC:
+//
+//	$argon2id$v=19$m=65536,t=3,p=2[,k=1]$<sal>$<hash>
+//
+// donde k=1 marca que se usó pepper.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+	p := h.Params
+	salt, err := RandomBytes(int(p.SaltLen))
+	if err != nil {
+		return "", err
+	}
+	peppered := len(h.Pepper) > 0
+	input := h.prepare(password, peppered)
+	hash := argon2.IDKey(input, salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	Wipe(input)
+
+	params := fmt.Sprintf("m=%d,t=%d,p=%d", p.Memory, p.Time, p.Threads)
+	if peppered {
+		params += ",k=1"
+	}
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", argon2.Version, params,
+		b64.EncodeToString(salt), b64.EncodeToString(hash)), nil
+}
+
+// Verify recalcula el hash de 'password' con la sal y parámetros
+// contenidos en 'encoded' y lo compara en tiempo constante.
+func (h *PasswordHasher) Verify(password, encoded string) (bool, error) {
+	ph, err := decodeHash(encoded)
+	if err != nil {
+		return false, err
+	}
+	if ph.peppered && len(h.Pepper) == 0 {
+		return false, ErrPepperRequired
+	}
+	p := ph.params
+	input := h.prepare(password, ph.peppered)
+	other := argon2.IDKey(input, ph.salt, p.Time, p.Memory, p.Threads, p.KeyLen)
+	Wipe(input)
+	return ConstantTimeEqual(ph.hash, other), nil
+}
+
+// NeedsRehash indica si 'encoded' se generó con parámetros distintos
+// de los actuales (o sin el pepper configurado) y conviene regenerarlo
+// la próxima vez que se disponga de la contraseña en claro.
+func (h *PasswordHasher) NeedsRehash(encoded string) bool {
+	ph, err := decodeHash(encoded)
+	if err != nil {
+		return true
+	}
+	p := ph.params
+	return p.Time != h.Params.Time || p.Memory != h.Params.Memory ||
+		p.Threads != h.Params.Threads || p.KeyLen != h.Params.KeyLen ||
+		ph.peppered != (len(h.Pepper) > 0)
+}
+
+// prepare aplica el pepper (si procede) a la contraseña. El resultado es
+// una copia que el llamante debe borrar con Wipe.
+func (h *PasswordHasher) prepare(password string, peppered bool) []byte {
+	raw := []byte(password)
+	if !peppered {
+		return raw
+	}
+	mac := hmac.New(sha256.New, h.Pepper)
+	mac.Write(raw)
+	Wipe(raw)
+	return mac.Sum(nil)
+}
+
+// HashPassword deriva un hash Argon2id sin pepper (ver PasswordHasher.Hash).
+func HashPassword(password string, p Argon2Params) (string, error) {
+	return NewPasswordHasher(p, nil).Hash(password)
+}
+
+// VerifyPassword verifica un hash sin pepper (ver PasswordHasher.Verify).
+func VerifyPassword(password, encoded string) (bool, error) {
+	return NewPasswordHasher(DefaultArgon2Params, nil).Verify(password, encoded)
+}
+
+// parsedHash es el resultado de descomponer una cadena PHC.
+type parsedHash struct {
+	params   Argon2Params
+	peppered bool
+	salt     []byte
+	hash     []byte
+}
+
+// decodeHash descompone una cadena PHC de Argon2id en sus parámetros, sal y hash.
+func decodeHash(encoded string) (parsedHash, error) {
+	var ph parsedHash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return ph, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return ph, ErrInvalidHash
+	}
+	for _, kv := range strings.Split(parts[3], ",") {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			return ph, ErrInvalidHash
+		}
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return ph, ErrInvalidHash
+		}
+		switch name {
+		case "m":
+			ph.params.Memory = uint32(n)
+		case "t":
+			ph.params.Time = uint32(n)
+		case "p":
+			ph.params.Threads = uint8(n)
+		case "k":
+			ph.peppered = n == 1
+		default:
+			return ph, ErrInvalidHash
+		}
+	}
+
+	b64 := base64.RawStdEncoding
+	var err error
+	if ph.salt, err = b64.DecodeString(parts[4]); err != nil {
+		return ph, ErrInvalidHash
+	}
+	if ph.hash, err = b64.DecodeString(parts[5]); err != nil {
+		return ph, ErrInvalidHash
+	}
+	ph.params.SaltLen = uint32(len(ph.salt))
+	ph.params.KeyLen = uint32(len(ph.hash))
+	return ph, nil
+}
@@ -0,0 +1,261 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Double ratchet (especificación de Signal) con X25519, HKDF-SHA256,
+// HMAC-SHA256 y AES-256-GCM. Cada mensaje se cifra con una clave distinta
+// que se borra tras usarla (secreto hacia delante) y cada respuesta
+// introduce un nuevo intercambio Diffie-Hellman, de modo que filtrar el
+// estado actual no compromete los mensajes anteriores y la conversación se
+// recupera en cuanto llega un mensaje nuevo del otro lado.
+
+// maxSkip limita cuántas claves de mensajes perdidos o desordenados se
+// guardan, para que un atacante no pueda agotar la memoria.
+const maxSkip = 1000
+
+var randReader io.Reader = rand.Reader
+
+// ErrRatchetDecrypt indica que un mensaje no se ha podido descifrar. El
+// estado del ratchet no cambia en ese caso.
+var ErrRatchetDecrypt = errors.New("no se ha podido descifrar el mensaje")
+
+// RatchetHeader viaja en claro con cada mensaje (autenticado como dato asociado).
+type RatchetHeader struct {
+	DH []byte `json:"dh"` // clave pública de ratchet actual del emisor
+	PN uint32 `json:"pn"` // mensajes de la cadena de envío anterior
+	N  uint32 `json:"n"`  // número de mensaje en la cadena actual
+}
+
+// RatchetMessage es un mensaje cifrado listo para enviar.
+type RatchetMessage struct {
+	Header     RatchetHeader `json:"header"`
+	Ciphertext []byte        `json:"ciphertext"`
+}
+
+// Ratchet es el estado de una conversación. Se serializa en JSON para
+// guardarlo entre ejecuciones y contiene secretos: debe almacenarse cifrado.
+type Ratchet struct {
+	DHs     []byte            `json:"dhs"`           // clave privada de ratchet propia
+	DHr     []byte            `json:"dhr,omitempty"` // clave pública de ratchet del otro
+	RK      []byte            `json:"rk"`            // clave raíz
+	CKs     []byte            `json:"cks,omitempty"` // clave de cadena de envío
+	CKr     []byte            `json:"ckr,omitempty"` // clave de cadena de recepción
+	Ns      uint32            `json:"ns"`
+	Nr      uint32            `json:"nr"`
+	PN      uint32            `json:"pn"`
+	Skipped map[string][]byte `json:"skipped,omitempty"` // claves de mensajes saltados
+	AD      []byte            `json:"ad"`                // datos asociados de la conversación (X3DH)
+}
+
+// NewRatchetInitiator crea el estado de quien envía el primer mensaje, a
+// partir del secreto compartido 'sk' y la clave de ratchet inicial del otro
+// (su prekey firmada).
+func NewRatchetInitiator(sk, ad, remotePub []byte) (*Ratchet, error) {
+	pub, err := ecdh.X25519().NewPublicKey(remotePub)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	priv, err := ecdh.X25519().GenerateKey(randReader)
+	if err != nil {
+		return nil, err
+	}
+	dh, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	rk, cks := kdfRK(sk, dh)
+	return &Ratchet{DHs: priv.Bytes(), DHr: remotePub, RK: rk, CKs: cks, AD: ad}, nil
+}
+
+// NewRatchetResponder crea el estado de quien recibe el primer mensaje, con
+// la clave privada correspondiente a la prekey publicada.
+func NewRatchetResponder(sk, ad, localPriv []byte) (*Ratchet, error) {
+	if _, err := ecdh.X25519().NewPrivateKey(localPriv); err != nil {
+		return nil, err
+	}
+	return &Ratchet{DHs: append([]byte(nil), localPriv...), RK: sk, AD: ad}, nil
+}
+
+// Encrypt cifra 'plaintext' con la siguiente clave de la cadena de envío.
+func (r *Ratchet) Encrypt(plaintext []byte) (*RatchetMessage, error) {
+	if r.CKs == nil {
+		return nil, errors.New("el ratchet aún no puede enviar (falta recibir un mensaje)")
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(r.DHs)
+	if err != nil {
+		return nil, err
+	}
+	var mk []byte
+	r.CKs, mk = kdfCK(r.CKs)
+	defer Wipe(mk)
+
+	h := RatchetHeader{DH: priv.PublicKey().Bytes(), PN: r.PN, N: r.Ns}
+	r.Ns++
+	ct, err := Seal(mk, plaintext, r.headerAD(h))
+	if err != nil {
+		return nil, err
+	}
+	return &RatchetMessage{Header: h, Ciphertext: ct}, nil
+}
+
+// Decrypt descifra un mensaje, avanzando el ratchet si trae una clave DH
+// nueva. Es transaccional: si falla, el estado queda como estaba.
+func (r *Ratchet) Decrypt(m *RatchetMessage) ([]byte, error) {
+	next := r.clone()
+	pt, err := next.decrypt(m)
+	if err != nil {
+		return nil, err
+	}
+	*r = *next
+	return pt, nil
+}
+
+func (r *Ratchet) decrypt(m *RatchetMessage) ([]byte, error) {
+	// ¿Es un mensaje que nos saltamos antes?
+	id := skippedID(m.Header.DH, m.Header.N)
+	if mk, ok := r.Skipped[id]; ok {
+		pt, err := Open(mk, m.Ciphertext, r.headerAD(m.Header))
+		if err != nil {
+			return nil, ErrRatchetDecrypt
+		}
+		Wipe(mk)
+		delete(r.Skipped, id)
+		return pt, nil
+	}
+
+	if !hmac.Equal(m.Header.DH, r.DHr) {
+		if err := r.skipUntil(m.Header.PN); err != nil {
+			return nil, err
+		}
+		if err := r.dhRatchet(m.Header.DH); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.skipUntil(m.Header.N); err != nil {
+		return nil, err
+	}
+
+	var mk []byte
+	r.CKr, mk = kdfCK(r.CKr)
+	defer Wipe(mk)
+	r.Nr++
+	pt, err := Open(mk, m.Ciphertext, r.headerAD(m.Header))
+	if err != nil {
+		return nil, ErrRatchetDecrypt
+	}
+	return pt, nil
+}
+
+// skipUntil guarda las claves de los mensajes de la cadena de recepción
+// actual hasta 'until' (sin incluirlo).
+func (r *Ratchet) skipUntil(until uint32) error {
+	if r.CKr == nil {
+		return nil
+	}
+	if until < r.Nr {
+		return ErrRatchetDecrypt // mensaje ya recibido (o repetido)
+	}
+	if until-r.Nr > maxSkip || len(r.Skipped)+int(until-r.Nr) > maxSkip {
+		return fmt.Errorf("%w: demasiados mensajes saltados", ErrRatchetDecrypt)
+	}
+	if r.Skipped == nil {
+		r.Skipped = make(map[string][]byte)
+	}
+	for r.Nr < until {
+		var mk []byte
+		r.CKr, mk = kdfCK(r.CKr)
+		r.Skipped[skippedID(r.DHr, r.Nr)] = mk
+		r.Nr++
+	}
+	return nil
+}
+
+// dhRatchet avanza el ratchet con la nueva clave pública del otro extremo.
+func (r *Ratchet) dhRatchet(remotePub []byte) error {
+	pub, err := ecdh.X25519().NewPublicKey(remotePub)
+	if err != nil {
+		return ErrRatchetDecrypt
+	}
+	r.PN, r.Ns, r.Nr = r.Ns, 0, 0
+	r.DHr = remotePub
+
+	priv, err := ecdh.X25519().NewPrivateKey(r.DHs)
+	if err != nil {
+		return err
+	}
+	dh, err := priv.ECDH(pub)
+	if err != nil {
+		return ErrRatchetDecrypt
+	}
+	r.RK, r.CKr = kdfRK(r.RK, dh)
+
+	// Nuevo par propio: la clave privada anterior se olvida
+	next, err := ecdh.X25519().GenerateKey(randReader)
+	if err != nil {
+		return err
+	}
+	Wipe(r.DHs)
+	r.DHs = next.Bytes()
+	if dh, err = next.ECDH(pub); err != nil {
+		return ErrRatchetDecrypt
+	}
+	r.RK, r.CKs = kdfRK(r.RK, dh)
+	return nil
+}
+
+// headerAD autentica la cabecera junto con los datos de la conversación.
+func (r *Ratchet) headerAD(h RatchetHeader) []byte {
+	ad := append([]byte(nil), r.AD...)
+	ad = append(ad, h.DH...)
+	ad = binary.BigEndian.AppendUint32(ad, h.PN)
+	return binary.BigEndian.AppendUint32(ad, h.N)
+}
+
+// clone hace una copia profunda del estado (vía JSON, que es como se guarda).
+func (r *Ratchet) clone() *Ratchet {
+	raw, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+	var c Ratchet
+	if err := json.Unmarshal(raw, &c); err != nil {
+		panic(err)
+	}
+	return &c
+}
+
+func skippedID(dh []byte, n uint32) string {
+	return fmt.Sprintf("%s:%d", hex.EncodeToString(dh), n)
+}
+
+// kdfRK deriva la nueva clave raíz y una clave de cadena.
+func kdfRK(rk, dh []byte) (newRK, ck []byte) {
+	out := make([]byte, 2*KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, dh, rk, []byte("prac-ratchet")), out); err != nil {
+		panic(err)
+	}
+	return out[:KeySize], out[KeySize:]
+}
+
+// kdfCK avanza una cadena y devuelve la clave del mensaje.
+func kdfCK(ck []byte) (next, mk []byte) {
+	m := hmac.New(sha256.New, ck)
+	m.Write([]byte{0x02})
+	next = m.Sum(nil)
+	m = hmac.New(sha256.New, ck)
+	m.Write([]byte{0x01})
+	return next, m.Sum(nil)
+}
@@ -0,0 +1,117 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Autocomprobación de arranque: vectores de prueba conocidos (KAT) de las
+// primitivas en las que se apoya todo lo demás. Si alguno falla, el binario
+// está mal compilado o manipulado y no debe tocar claves ni datos.
+
+// ErrSelfTest indica que ha fallado la autocomprobación criptográfica.
+var ErrSelfTest = errors.New("autocomprobación criptográfica fallida")
+
+// SelfTest ejecuta los vectores conocidos de AES-256-GCM, Argon2id,
+// HMAC-SHA256 y Ed25519, incluidos los casos en los que un dato alterado
+// debe rechazarse. Devuelve un error envolviendo ErrSelfTest con la
+// primitiva que ha fallado.
+func SelfTest() error {
+	tests := []struct {
+		name string
+		fn   func() bool
+	}{
+		{"AES-256-GCM", katAESGCM},
+		{"Argon2id", katArgon2id},
+		{"HMAC-SHA256", katHMAC},
+		{"Ed25519", katEd25519},
+	}
+	for _, t := range tests {
+		if !t.fn() {
+			return fmt.Errorf("%w: %s", ErrSelfTest, t.name)
+		}
+	}
+	return nil
+}
+
+// mustHex descodifica los vectores de prueba (constantes del código).
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// katAESGCM: caso de prueba 16 de la especificación de GCM (McGrew y Viega).
+func katAESGCM() bool {
+	key := mustHex("feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308")
+	nonce := mustHex("cafebabefacedbaddecaf888")
+	plaintext := mustHex("d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a72" +
+		"1c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39")
+	ad := mustHex("feedfacedeadbeeffeedfacedeadbeefabaddad2")
+	want := mustHex("522dc1f099567d07f47f37a32a84427d643a8cdcbfe5c0c97598a2bd2555d1aa" +
+		"8cb08e48590dbb3da7b08b1056828838c5f61e6393ba7a0abcc9f662" +
+		"76fc6ece0f4e1768cddf8853bb2d551b")
+
+	aead, err := newGCM(key)
+	if err != nil {
+		return false
+	}
+	if !bytes.Equal(aead.Seal(nil, nonce, plaintext, ad), want) {
+		return false
+	}
+	got, err := aead.Open(nil, nonce, want, ad)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		return false
+	}
+	// Un tag alterado tiene que rechazarse
+	bad := bytes.Clone(want)
+	bad[len(bad)-1] ^= 1
+	_, err = aead.Open(nil, nonce, bad, ad)
+	return err != nil
+}
+
+// katArgon2id: vector de la implementación de referencia (password/somesalt,
+// t=2, m=64 KiB, p=1). Coste mínimo para no retrasar el arranque.
+func katArgon2id() bool {
+	want := mustHex("068d62b26455936aa6ebe60060b0a65870dbfa3ddf8d41f7")
+	got := argon2.IDKey([]byte("password"), []byte("somesalt"), 2, 64, 1, uint32(len(want)))
+	return bytes.Equal(got, want)
+}
+
+// katHMAC: caso de prueba 2 de la RFC 4231.
+func katHMAC() bool {
+	want := mustHex("5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843")
+	mac := hmac.New(sha256.New, []byte("Jefe"))
+	mac.Write([]byte("what do ya want for nothing?"))
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// katEd25519: prueba 1 de la RFC 8032 (mensaje vacío).
+func katEd25519() bool {
+	seed := mustHex("9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60")
+	wantPub := mustHex("d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a")
+	wantSig := mustHex("e5564300c360ac729086e2cc806e828a84877f1eb8e5d974d873e065" +
+		"224901555fb8821590a33bacc61e39701cf9b46bd25bf5f0595bbe24655141438e7a100b")
+
+	priv := ed25519.NewKeyFromSeed(seed)
+	pub := priv.Public().(ed25519.PublicKey)
+	if !bytes.Equal(pub, wantPub) {
+		return false
+	}
+	if !bytes.Equal(ed25519.Sign(priv, nil), wantSig) || !ed25519.Verify(pub, nil, wantSig) {
+		return false
+	}
+	// Una firma alterada tiene que rechazarse
+	bad := bytes.Clone(wantSig)
+	bad[0] ^= 1
+	return !ed25519.Verify(pub, nil, bad)
+}
@@ -0,0 +1,70 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+// Sentido de un mensaje protegido con la clave de sesión. Forma parte de los
+// datos asociados, así que una respuesta del servidor no se puede reenviar
+// como si fuera una petición del cliente (ni al revés).
+const (
+	ToServer = "c2s"
+	ToClient = "s2c"
+)
+
+// Formatos del campo Data cifrado con la clave de sesión: el propio
+// (SealSessionData) o JWE compacto (SealSessionJWE).
+const (
+	FormatNative = ""
+	FormatJWE    = "jwe"
+)
+
+// ErrSessionFormat indica un formato de datos de sesión desconocido.
+var ErrSessionFormat = errors.New("formato de datos cifrados no soportado")
+
+// SealSessionAs cifra 'data' en el formato indicado.
+func SealSessionAs(format string, key []byte, direction, username, action string, data []byte) (string, error) {
+	switch format {
+	case FormatNative:
+		return SealSessionData(key, direction, username, action, data)
+	case FormatJWE:
+		return SealSessionJWE(key, direction, username, action, data)
+	}
+	return "", ErrSessionFormat
+}
+
+// OpenSessionAs descifra un valor producido por SealSessionAs.
+func OpenSessionAs(format string, key []byte, direction, username, action, sealed string) ([]byte, error) {
+	switch format {
+	case FormatNative:
+		return OpenSessionData(key, direction, username, action, sealed)
+	case FormatJWE:
+		return OpenSessionJWE(key, direction, username, action, sealed)
+	}
+	return nil, ErrSessionFormat
+}
+
+// SealSessionData cifra 'data' con la clave de sesión y devuelve el
+// resultado en base64, listo para el campo Data. El mensaje queda ligado al
+// usuario, la acción y el sentido.
+func SealSessionData(key []byte, direction, username, action string, data []byte) (string, error) {
+	sealed, err := Seal(key, data, sessionAD(direction, username, action))
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenSessionData descifra un valor producido por SealSessionData.
+func OpenSessionData(key []byte, direction, username, action, sealed string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return Open(key, raw, sessionAD(direction, username, action))
+}
+
+func sessionAD(direction, username, action string) []byte {
+	return []byte("prac-session-v1\x00" + direction + "\x00" + username + "\x00" + action)
+}
@@ -0,0 +1,131 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+// Reparto de secretos de Shamir sobre GF(2^8), byte a byte (como Vault).
+// Cada fragmento tiene la longitud del secreto más un byte final con su
+// coordenada x (1..255); el secreto es el término independiente de un
+// polinomio aleatorio de grado threshold-1.
+
+// MaxShares es el número máximo de fragmentos (valores x distintos de cero).
+const MaxShares = 255
+
+var (
+	// ErrShamirShares indica fragmentos insuficientes, repetidos o mal formados.
+	ErrShamirShares = errors.New("fragmentos de Shamir no válidos")
+)
+
+// SplitSecret divide 'secret' en 'shares' fragmentos de forma que con
+// 'threshold' cualesquiera se reconstruye y con menos no se obtiene
+// información alguna.
+func SplitSecret(secret []byte, shares, threshold int) ([][]byte, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("el secreto está vacío")
+	case threshold < 2:
+		return nil, errors.New("el umbral debe ser al menos 2")
+	case shares < threshold:
+		return nil, errors.New("el número de fragmentos no puede ser menor que el umbral")
+	case shares > MaxShares:
+		return nil, fmt.Errorf("como máximo %d fragmentos", MaxShares)
+	}
+
+	out := make([][]byte, shares)
+	for i := range out {
+		out[i] = make([]byte, len(secret)+1)
+		out[i][len(secret)] = byte(i + 1)
+	}
+
+	coeffs := make([]byte, threshold)
+	for j, s := range secret {
+		// Polinomio propio para cada byte: coeffs[0] = secreto
+		coeffs[0] = s
+		if _, err := rand.Read(coeffs[1:]); err != nil {
+			return nil, err
+		}
+		for i := range out {
+			out[i][j] = gfEval(coeffs, byte(i+1))
+		}
+	}
+	return out, nil
+}
+
+// CombineShares reconstruye el secreto a partir de al menos 'threshold'
+// fragmentos distintos generados por SplitSecret. Con menos fragmentos (o
+// de otro reparto) devuelve un valor arbitrario: quien llame debe
+// comprobar el resultado por su cuenta.
+func CombineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, ErrShamirShares
+	}
+	n := len(shares[0])
+	if n < 2 {
+		return nil, ErrShamirShares
+	}
+	xs := make([]byte, len(shares))
+	seen := make(map[byte]bool)
+	for i, sh := range shares {
+		if len(sh) != n {
+			return nil, ErrShamirShares
+		}
+		x := sh[n-1]
+		if x == 0 || seen[x] {
+			return nil, ErrShamirShares
+		}
+		seen[x] = true
+		xs[i] = x
+	}
+
+	// Interpolación de Lagrange en x = 0
+	secret := make([]byte, n-1)
+	for i := range shares {
+		num, den := byte(1), byte(1)
+		for k := range shares {
+			if k == i {
+				continue
+			}
+			num = gfMul(num, xs[k])
+			den = gfMul(den, xs[i]^xs[k])
+		}
+		li := gfDiv(num, den)
+		for j := range secret {
+			secret[j] ^= gfMul(shares[i][j], li)
+		}
+	}
+	return secret, nil
+}
+
+// gfEval evalúa el polinomio 'coeffs' en 'x' (regla de Horner).
+func gfEval(coeffs []byte, x byte) byte {
+	var y byte
+	for i := len(coeffs) - 1; i >= 0; i-- {
+		y = gfMul(y, x) ^ coeffs[i]
+	}
+	return y
+}
+
+// gfMul multiplica en GF(2^8) con el polinomio de AES (x^8+x^4+x^3+x+1),
+// sin ramas dependientes de los datos.
+func gfMul(a, b byte) byte {
+	var p byte
+	for i := 0; i < 8; i++ {
+		p ^= -(b & 1) & a
+		hi := -(a >> 7)
+		a = (a << 1) ^ (hi & 0x1b)
+		b >>= 1
+	}
+	return p
+}
+
+// gfDiv divide en GF(2^8) calculando el inverso como b^254.
+func gfDiv(a, b byte) byte {
+	inv := byte(1)
+	for i := 0; i < 254; i++ {
+		inv = gfMul(inv, b)
+	}
+	return gfMul(a, inv)
+}
@@ -0,0 +1,119 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Compartir datos entre usuarios sin que el servidor los vea: cada usuario
+// publica una clave X25519 de compartición, firmada con su clave Ed25519, y
+// quien comparte algo envuelve para ella la clave de lo compartido (ECIES:
+// X25519 efímera, HKDF-SHA256 y AES-256-GCM). El servidor guarda la clave
+// envuelta, pero sólo el destinatario puede abrirla.
+//
+// Una clave envuelta es:
+//
+//	clave pública efímera (32 bytes) || nonce || ciphertext || tag
+
+const (
+	shareKeyContext = "prac-share-key-v1"
+	shareWrapInfo   = "prac-share-wrap-v1"
+)
+
+// ErrInvalidShareKey indica que la clave de compartición no es X25519 válida.
+var ErrInvalidShareKey = errors.New("clave de compartición no válida")
+
+// ShareKeyFromSeed deriva de forma determinista la clave de compartición
+// a partir de una semilla secreta (la de la clave de firma), como
+// NewX3DHKeys, así no hay que guardar otro fichero de clave.
+func ShareKeyFromSeed(seed []byte) (*ecdh.PrivateKey, error) {
+	raw := DeriveKey(seed, "share-key")
+	defer Wipe(raw)
+	return ecdh.X25519().NewPrivateKey(raw)
+}
+
+// SignShareKey firma la clave pública de compartición de 'username', para
+// que el servidor no pueda cambiarla por otra suya.
+func SignShareKey(priv ed25519.PrivateKey, username string, pub []byte) []byte {
+	return ed25519.Sign(priv, shareKeyMessage(username, pub))
+}
+
+// VerifyShareKey comprueba una firma producida por SignShareKey.
+func VerifyShareKey(signPub ed25519.PublicKey, username string, pub, sig []byte) bool {
+	if len(signPub) != ed25519.PublicKeySize || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(signPub, shareKeyMessage(username, pub), sig)
+}
+
+// shareKeyMessage construye contexto || 0 || usuario || 0 || clave.
+func shareKeyMessage(username string, pub []byte) []byte {
+	msg := make([]byte, 0, len(shareKeyContext)+len(username)+len(pub)+2)
+	msg = append(msg, shareKeyContext...)
+	msg = append(msg, 0)
+	msg = append(msg, username...)
+	msg = append(msg, 0)
+	return append(msg, pub...)
+}
+
+// WrapShareKey envuelve 'key' para la clave pública de compartición 'pub'.
+// 'ad' tiene que ser el mismo al abrirla: sirve para atar la clave envuelta
+// a quién la comparte, con quién y qué.
+func WrapShareKey(pub, key, ad []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(pub)
+	if err != nil {
+		return nil, ErrInvalidShareKey
+	}
+	eph, err := ecdh.X25519().GenerateKey(randReader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := eph.ECDH(recipient)
+	if err != nil {
+		return nil, err
+	}
+	ephPub := eph.PublicKey().Bytes()
+	kek := shareKEK(shared, ephPub, pub)
+	defer Wipe(shared, kek)
+	sealed, err := Seal(kek, key, ad)
+	if err != nil {
+		return nil, err
+	}
+	return append(ephPub, sealed...), nil
+}
+
+// UnwrapShareKey abre una clave envuelta por WrapShareKey con la clave
+// privada de compartición del destinatario.
+func UnwrapShareKey(priv *ecdh.PrivateKey, wrapped, ad []byte) ([]byte, error) {
+	if len(wrapped) < 32 {
+		return nil, ErrDecrypt
+	}
+	eph, err := ecdh.X25519().NewPublicKey(wrapped[:32])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	shared, err := priv.ECDH(eph)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	kek := shareKEK(shared, wrapped[:32], priv.PublicKey().Bytes())
+	defer Wipe(shared, kek)
+	return Open(kek, wrapped[32:], ad)
+}
+
+// shareKEK deriva la clave con la que se envuelve a partir del secreto
+// X25519, con las dos claves públicas como sal.
+func shareKEK(shared, ephPub, pub []byte) []byte {
+	kek := make([]byte, KeySize)
+	salt := append(bytes.Clone(ephPub), pub...)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, []byte(shareWrapInfo)), kek); err != nil {
+		panic(err)
+	}
+	return kek
+}
@@ -0,0 +1,83 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// fingerprintContext separa las huellas de cualquier otro hash de la clave.
+const fingerprintContext = "prac-fingerprint-v1"
+
+// fingerprintSize son los bytes del hash que se muestran (160 bits).
+const fingerprintSize = 20
+
+// signContext separa las firmas de datos de usuario de cualquier otro uso
+// de la misma clave.
+const signContext = "prac-userdata-v1"
+
+// ErrInvalidPublicKey indica que la clave pública no es Ed25519 válida.
+var ErrInvalidPublicKey = errors.New("clave pública Ed25519 no válida")
+
+// SigningKeyFromSeed reconstruye la clave privada Ed25519 a partir de su
+// semilla de 32 bytes (lo que se guarda en el fichero de clave del cliente).
+func SigningKeyFromSeed(seed []byte) (ed25519.PrivateKey, error) {
+	if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("semilla Ed25519 no válida")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ParsePublicKey valida y convierte una clave pública Ed25519 en bruto.
+func ParsePublicKey(raw []byte) (ed25519.PublicKey, error) {
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// SignUserData firma los datos de 'username'. Se firma también el nombre
+// para que la firma no pueda reutilizarse como si fuera de otro usuario.
+func SignUserData(priv ed25519.PrivateKey, username string, data []byte) []byte {
+	return ed25519.Sign(priv, signedMessage(username, data))
+}
+
+// VerifyUserData comprueba una firma producida por SignUserData.
+func VerifyUserData(pub ed25519.PublicKey, username string, data, sig []byte) bool {
+	if len(pub) != ed25519.PublicKeySize || len(sig) != ed25519.SignatureSize {
+		return false
+	}
+	return ed25519.Verify(pub, signedMessage(username, data), sig)
+}
+
+// signedMessage construye contexto || 0 || usuario || 0 || datos.
+func signedMessage(username string, data []byte) []byte {
+	msg := make([]byte, 0, len(signContext)+len(username)+len(data)+2)
+	msg = append(msg, signContext...)
+	msg = append(msg, 0)
+	msg = append(msg, username...)
+	msg = append(msg, 0)
+	return append(msg, data...)
+}
+
+// KeyFingerprint es la huella de la clave de firma 'pub' de 'username':
+// SHA-256 de contexto || 0 || usuario || 0 || clave, truncado a 160 bits y
+// en grupos de cuatro caracteres hexadecimales ("1A2B 3C4D ..."), para
+// leerla en voz alta o compararla a ojo. Las demás claves del usuario van
+// firmadas con esta, así que basta con comprobar la huella de ella.
+func KeyFingerprint(username string, pub ed25519.PublicKey) string {
+	h := sha256.New()
+	h.Write([]byte(fingerprintContext))
+	h.Write([]byte{0})
+	h.Write([]byte(username))
+	h.Write([]byte{0})
+	h.Write(pub)
+	digits := strings.ToUpper(hex.EncodeToString(h.Sum(nil)[:fingerprintSize]))
+	groups := make([]string, 0, len(digits)/4)
+	for i := 0; i < len(digits); i += 4 {
+		groups = append(groups, digits[i:i+4])
+	}
+	return strings.Join(groups, " ")
+}
@@ -0,0 +1,158 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Cifrado determinista con AES-SIV (RFC 5297). A diferencia de Seal, el
+// mismo texto con la misma clave y datos asociados produce siempre el mismo
+// resultado, así que el servidor puede buscar por el valor cifrado (p. ej.,
+// como clave del store) sin descifrar nada. El precio es que revela qué
+// valores son iguales: sólo debe usarse para identificadores que haya que
+// buscar exactamente, nunca para el contenido de los registros.
+
+const sivTagSize = 16
+
+// DeterministicCipher cifra de forma determinista. Se mantiene como un tipo
+// aparte, sin funciones compartidas con Seal/Open, para que no se pueda usar
+// por error donde hace falta cifrado aleatorio.
+type DeterministicCipher struct {
+	mac cipher.Block // K1: S2V (CMAC)
+	ctr cipher.Block // K2: cifrado en modo contador
+}
+
+// NewDeterministicCipher crea un cifrador AES-SIV a partir de una clave de
+// KeySize bytes, que se expande con HKDF a las dos claves AES-256 de SIV.
+func NewDeterministicCipher(key []byte) (*DeterministicCipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("clave no válida: %d bytes", len(key))
+	}
+	sivKey := make([]byte, 2*KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, nil, []byte("prac-aes-siv")), sivKey); err != nil {
+		panic(err)
+	}
+	return newSIV(sivKey)
+}
+
+// newSIV crea el cifrador con una clave SIV de 32 o 64 bytes (AES-128 o
+// AES-256 para cada mitad), tal y como la define la RFC.
+func newSIV(sivKey []byte) (*DeterministicCipher, error) {
+	if len(sivKey) != 32 && len(sivKey) != 64 {
+		return nil, fmt.Errorf("clave AES-SIV no válida: %d bytes", len(sivKey))
+	}
+	half := len(sivKey) / 2
+	mac, err := aes.NewCipher(sivKey[:half])
+	if err != nil {
+		return nil, err
+	}
+	ctr, err := aes.NewCipher(sivKey[half:])
+	if err != nil {
+		return nil, err
+	}
+	return &DeterministicCipher{mac: mac, ctr: ctr}, nil
+}
+
+// Seal cifra 'plaintext' autenticando 'ad'. El resultado es V(16) || C.
+func (d *DeterministicCipher) Seal(plaintext, ad []byte) []byte {
+	v := d.s2v(ad, plaintext)
+	out := make([]byte, sivTagSize+len(plaintext))
+	copy(out, v[:])
+	d.xorCTR(v, out[sivTagSize:], plaintext)
+	return out
+}
+
+// Open descifra un valor producido por Seal con los mismos datos asociados.
+func (d *DeterministicCipher) Open(sealed, ad []byte) ([]byte, error) {
+	if len(sealed) < sivTagSize {
+		return nil, ErrDecrypt
+	}
+	var v [16]byte
+	copy(v[:], sealed[:sivTagSize])
+	plaintext := make([]byte, len(sealed)-sivTagSize)
+	d.xorCTR(v, plaintext, sealed[sivTagSize:])
+
+	expected := d.s2v(ad, plaintext)
+	if subtle.ConstantTimeCompare(expected[:], v[:]) != 1 {
+		clear(plaintext)
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// xorCTR aplica AES-CTR usando V como contador inicial, con los bits 31 y
+// 63 (contando desde la derecha) a cero como exige la RFC.
+func (d *DeterministicCipher) xorCTR(v [16]byte, dst, src []byte) {
+	v[8] &= 0x7f
+	v[12] &= 0x7f
+	cipher.NewCTR(d.ctr, v[:]).XORKeyStream(dst, src)
+}
+
+// s2v es la función S2V de la RFC con un único componente de datos asociados.
+func (d *DeterministicCipher) s2v(ad, plaintext []byte) [16]byte {
+	var zero [16]byte
+	acc := d.cmac(zero[:])
+	acc = dbl(acc)
+	xorInto(acc[:], d.cmac(ad))
+
+	var t []byte
+	if len(plaintext) >= 16 {
+		t = append([]byte(nil), plaintext...)
+		xorInto(t[len(t)-16:], acc)
+	} else {
+		acc = dbl(acc)
+		var padded [16]byte
+		copy(padded[:], plaintext)
+		padded[len(plaintext)] = 0x80
+		xorInto(acc[:], padded)
+		t = acc[:]
+	}
+	return d.cmac(t)
+}
+
+// cmac calcula AES-CMAC (RFC 4493) con la clave K1.
+func (d *DeterministicCipher) cmac(msg []byte) [16]byte {
+	var l [16]byte
+	d.mac.Encrypt(l[:], l[:])
+	k1 := dbl(l)
+	k2 := dbl(k1)
+
+	var x [16]byte
+	for len(msg) > 16 {
+		subtle.XORBytes(x[:], x[:], msg[:16])
+		d.mac.Encrypt(x[:], x[:])
+		msg = msg[16:]
+	}
+	var last [16]byte
+	copy(last[:], msg)
+	if len(msg) == 16 {
+		xorInto(last[:], k1)
+	} else {
+		last[len(msg)] = 0x80
+		xorInto(last[:], k2)
+	}
+	subtle.XORBytes(x[:], x[:], last[:])
+	d.mac.Encrypt(x[:], x[:])
+	return x
+}
+
+// dbl multiplica por x en GF(2^128) (big-endian, polinomio x^128+x^7+x^2+x+1).
+func dbl(b [16]byte) [16]byte {
+	var out [16]byte
+	carry := b[0] >> 7
+	for i := 0; i < 15; i++ {
+		out[i] = b[i]<<1 | b[i+1]>>7
+	}
+	out[15] = b[15]<<1 ^ (-carry & 0x87)
+	return out
+}
+
+func xorInto(dst []byte, src [16]byte) {
+	subtle.XORBytes(dst, dst, src[:])
+}
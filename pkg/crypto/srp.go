@@ -0,0 +1,220 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// Implementación de SRP-6a (RFC 2945 / RFC 5054) con el grupo de 2048 bits
+// de la RFC 5054 y SHA-256. El cliente demuestra conocer la contraseña sin
+// enviarla nunca; el servidor sólo guarda un verificador v = g^x mod N, que
+// no sirve para suplantar al usuario.
+
+// srpGroupHex es el primo seguro de 2048 bits (RFC 5054, apéndice A).
+const srpGroupHex = "AC6BDB41324A9A9BF166DE5E1389582FAF72B6651987EE07FC3192943DB56050" +
+	"A37329CBB4A099ED8193E0757767A13DD52312AB4B03310DCD7F48A9DA04FD50" +
+	"E8083969EDB767B0CF6095179A163AB3661A05FBD5FAAAE82918A9962F0B93B8" +
+	"55F97993EC975EEAA80D740ADBF4FF747359D041D5C33EA71D281E446B14773B" +
+	"CA97B43A23FB801676BD207A436C6481F1D2B9078717461A5B9D32E688F87748" +
+	"544523B524B0D57D5EA77A2775D2ECFA032CFBDBF52FB3786160279004E57AE6" +
+	"AF874E7303CE53299CCC041C7BC308D82A5698F3A8D0C38271AE35F8E9DBFBB6" +
+	"94B5C803D89F7AE435DE236D525F54759B65E372FCD68EF20FA7111F9E4AFF73"
+
+var (
+	srpN, _ = new(big.Int).SetString(srpGroupHex, 16)
+	srpG    = big.NewInt(2)
+	srpK    = new(big.Int).SetBytes(srpHash(srpPad(srpN), srpPad(srpG)))
+)
+
+// ErrSRPBadValue indica un valor público ilegal (p.ej. A ≡ 0 mod N),
+// que un atacante podría usar para saltarse la autenticación.
+var ErrSRPBadValue = errors.New("valor SRP no válido")
+
+// SRPSaltSize es el tamaño de la sal SRP en bytes.
+const SRPSaltSize = 16
+
+// NewSRPVerifier genera una sal aleatoria y el verificador de 'password'.
+// Es lo único que el cliente envía al servidor al registrarse.
+func NewSRPVerifier(username string, password []byte) (salt, verifier []byte, err error) {
+	salt, err = RandomBytes(SRPSaltSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	x := srpX(salt, username, password)
+	defer WipeInt(x)
+	return salt, new(big.Int).Exp(srpG, x, srpN).Bytes(), nil
+}
+
+// SRPClient mantiene el estado del cliente durante un login SRP.
+type SRPClient struct {
+	username string
+	password []byte // copia propia, se borra en ProcessChallenge o Wipe
+	a, pubA  *big.Int
+	m1, key  []byte
+}
+
+// NewSRPClient genera el valor efímero A del cliente (primera ronda).
+// Guarda una copia de 'password', así que el llamante puede borrar la suya.
+func NewSRPClient(username string, password []byte) (*SRPClient, error) {
+	a, err := srpEphemeral()
+	if err != nil {
+		return nil, err
+	}
+	return &SRPClient{
+		username: username,
+		password: append([]byte(nil), password...),
+		a:        a,
+		pubA:     new(big.Int).Exp(srpG, a, srpN),
+	}, nil
+}
+
+// Wipe borra la contraseña, el exponente secreto y la clave de sesión.
+// Hay que llamarlo al terminar con el cliente, haya ido bien o no.
+func (c *SRPClient) Wipe() {
+	Wipe(c.password, c.key)
+	WipeInt(c.a)
+}
+
+// A devuelve el valor público A que se envía al servidor.
+func (c *SRPClient) A() []byte { return c.pubA.Bytes() }
+
+// ProcessChallenge recibe la sal y B del servidor y calcula la prueba M1.
+func (c *SRPClient) ProcessChallenge(salt, bBytes []byte) ([]byte, error) {
+	B := new(big.Int).SetBytes(bBytes)
+	if new(big.Int).Mod(B, srpN).Sign() == 0 {
+		return nil, ErrSRPBadValue
+	}
+	u := srpU(c.pubA, B)
+	if u.Sign() == 0 {
+		return nil, ErrSRPBadValue
+	}
+	x := srpX(salt, c.username, c.password)
+	// La contraseña ya no hace falta: sólo se usa para calcular x
+	Wipe(c.password)
+
+	// S = (B - k·g^x) ^ (a + u·x) mod N
+	kgx := new(big.Int).Mul(srpK, new(big.Int).Exp(srpG, x, srpN))
+	base := new(big.Int).Sub(B, kgx)
+	base.Mod(base, srpN)
+	ux := new(big.Int).Mul(u, x)
+	exp := new(big.Int).Add(c.a, ux)
+	S := new(big.Int).Exp(base, exp, srpN)
+
+	sBytes := S.Bytes()
+	c.key = srpHash(sBytes)
+	Wipe(sBytes)
+	WipeInt(x, kgx, ux, exp, S)
+	c.m1 = srpM1(c.username, salt, c.pubA, B, c.key)
+	return c.m1, nil
+}
+
+// VerifyServer comprueba la prueba M2 del servidor (autenticación mutua).
+func (c *SRPClient) VerifyServer(m2 []byte) bool {
+	if c.m1 == nil {
+		return false
+	}
+	return ConstantTimeEqual(m2, srpHash(c.pubA.Bytes(), c.m1, c.key))
+}
+
+// Key devuelve la clave de sesión compartida K (tras ProcessChallenge).
+func (c *SRPClient) Key() []byte { return c.key }
+
+// SRPServer mantiene el estado del servidor durante un login SRP.
+type SRPServer struct {
+	username string
+	salt     []byte
+	v, pubA  *big.Int
+	b, pubB  *big.Int
+}
+
+// NewSRPServer valida A y genera el valor efímero B (respuesta a la primera ronda).
+func NewSRPServer(username string, salt, verifier, aBytes []byte) (*SRPServer, error) {
+	A := new(big.Int).SetBytes(aBytes)
+	if new(big.Int).Mod(A, srpN).Sign() == 0 {
+		return nil, ErrSRPBadValue
+	}
+	b, err := srpEphemeral()
+	if err != nil {
+		return nil, err
+	}
+	v := new(big.Int).SetBytes(verifier)
+
+	// B = (k·v + g^b) mod N
+	B := new(big.Int).Mul(srpK, v)
+	B.Add(B, new(big.Int).Exp(srpG, b, srpN))
+	B.Mod(B, srpN)
+
+	return &SRPServer{username: username, salt: salt, v: v, pubA: A, b: b, pubB: B}, nil
+}
+
+// B devuelve el valor público B que se envía al cliente junto con la sal.
+func (s *SRPServer) B() []byte { return s.pubB.Bytes() }
+
+// VerifyClient comprueba M1 y, si es correcta, devuelve la prueba M2 del
+// servidor y la clave de sesión compartida.
+func (s *SRPServer) VerifyClient(m1 []byte) (m2, key []byte, ok bool) {
+	u := srpU(s.pubA, s.pubB)
+	if u.Sign() == 0 {
+		return nil, nil, false
+	}
+	// S = (A · v^u) ^ b mod N
+	base := new(big.Int).Mul(s.pubA, new(big.Int).Exp(s.v, u, srpN))
+	base.Mod(base, srpN)
+	S := new(big.Int).Exp(base, s.b, srpN)
+
+	key = srpHash(S.Bytes())
+	expected := srpM1(s.username, s.salt, s.pubA, s.pubB, key)
+	if !ConstantTimeEqual(m1, expected) {
+		return nil, nil, false
+	}
+	return srpHash(s.pubA.Bytes(), m1, key), key, true
+}
+
+// srpX calcula x = H(s | H(I ":" P)).
+func srpX(salt []byte, username string, password []byte) *big.Int {
+	id := append([]byte(strings.ToLower(username)+":"), password...)
+	inner := srpHash(id)
+	outer := srpHash(salt, inner)
+	x := new(big.Int).SetBytes(outer)
+	Wipe(id, inner, outer)
+	return x
+}
+
+// srpU calcula u = H(PAD(A) | PAD(B)).
+func srpU(A, B *big.Int) *big.Int {
+	return new(big.Int).SetBytes(srpHash(srpPad(A), srpPad(B)))
+}
+
+// srpM1 calcula M1 = H(H(N) xor H(g) | H(I) | s | A | B | K).
+func srpM1(username string, salt []byte, A, B *big.Int, key []byte) []byte {
+	hn, hg := srpHash(srpN.Bytes()), srpHash(srpG.Bytes())
+	for i := range hn {
+		hn[i] ^= hg[i]
+	}
+	return srpHash(hn, srpHash([]byte(strings.ToLower(username))), salt, A.Bytes(), B.Bytes(), key)
+}
+
+// srpEphemeral genera un exponente secreto aleatorio de 256 bits.
+func srpEphemeral() (*big.Int, error) {
+	b, err := RandomBytes(32)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// srpPad rellena con ceros a la izquierda hasta la longitud de N.
+func srpPad(x *big.Int) []byte {
+	return x.FillBytes(make([]byte, (srpN.BitLen()+7)/8))
+}
+
+// srpHash es SHA-256 de la concatenación de sus argumentos.
+func srpHash(parts ...[]byte) []byte {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return h.Sum(nil)
+}
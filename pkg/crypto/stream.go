@@ -0,0 +1,332 @@
+package crypto
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Formato de flujo cifrado (construcción STREAM, similar a age/Tink):
+//
+//	cabecera: magic(8) || tamaño de bloque(4, big endian) || sal(16) || prefijo de nonce(7)
+//	bloques:  AES-256-GCM(bloque_i), cada uno con su tag de 16 bytes
+//
+// Cada flujo se cifra con una subclave HKDF(clave, sal), así que el límite de
+// mensajes por clave de GCM se aplica por flujo y no al total de flujos.
+// El nonce de cada bloque es prefijo(7) || contador(4) || último(1), de modo
+// que no se pueden reordenar, duplicar ni truncar bloques sin que falle la
+// autenticación. La cabecera entera se autentica como dato asociado.
+//
+// Los flujos de la versión 1 (sin sal, clave usada directamente) se
+// siguen pudiendo descifrar.
+const (
+	streamMagic        = "PRACSTR2"
+	streamMagicV1      = "PRACSTR1"
+	streamSaltSize     = 16
+	streamPrefixSize   = 7
+	streamHeaderSize   = len(streamMagic) + 4 + streamSaltSize + streamPrefixSize
+	streamHeaderSizeV1 = len(streamMagicV1) + 4 + streamPrefixSize
+	streamTagSize      = 16
+	DefaultStreamChunk = 64 * 1024 // tamaño de bloque por defecto (64 KiB)
+	maxStreamChunk     = 16 * 1024 * 1024
+)
+
+// ErrStreamTruncated indica que el flujo cifrado terminó antes del bloque final.
+var ErrStreamTruncated = errors.New("flujo cifrado truncado")
+
+// streamKey deriva la subclave de un flujo a partir de su sal.
+func streamKey(key, salt []byte) []byte {
+	out := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte("prac-stream")), out); err != nil {
+		panic(err)
+	}
+	return out
+}
+
+// streamWriter cifra lo que se escribe en él por bloques; ver NewEncryptWriter.
+type streamWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte // datos pendientes (como mucho un bloque)
+	out     []byte
+	err     error // primer error, se repite en todas las llamadas siguientes
+}
+
+// NewEncryptWriter devuelve un io.WriteCloser que escribe en 'dst' el flujo
+// cifrado de lo que recibe. La memoria usada es de un bloque. Es obligatorio
+// llamar a Close: escribe el bloque final, sin el cual el flujo se
+// considera truncado. Close no cierra 'dst'.
+func NewEncryptWriter(dst io.Writer, key []byte, chunkSize int) (io.WriteCloser, error) {
+	if chunkSize <= 0 || chunkSize > maxStreamChunk {
+		return nil, fmt.Errorf("tamaño de bloque no válido: %d", chunkSize)
+	}
+	salt, err := RandomBytes(streamSaltSize)
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := RandomBytes(streamPrefixSize)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(streamKey(key, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, streamHeaderSize)
+	header = append(header, streamMagic...)
+	header = binary.BigEndian.AppendUint32(header, uint32(chunkSize))
+	header = append(header, salt...)
+	header = append(header, prefix...)
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+	return &streamWriter{
+		dst:    dst,
+		aead:   aead,
+		header: header,
+		prefix: prefix,
+		buf:    make([]byte, 0, chunkSize),
+		out:    make([]byte, 0, chunkSize+streamTagSize),
+	}, nil
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	written := 0
+	for len(p) > 0 {
+		// Sólo sellamos un bloque lleno cuando llegan más datos: hasta
+		// entonces no sabemos si es el último.
+		if len(w.buf) == cap(w.buf) {
+			if err := w.flush(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// Close sella el último bloque (que puede estar vacío).
+func (w *streamWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.flush(true); err != nil {
+		return err
+	}
+	w.err = errors.New("escritura en un flujo cifrado ya cerrado")
+	return nil
+}
+
+func (w *streamWriter) flush(last bool) error {
+	w.out = w.aead.Seal(w.out[:0], streamNonce(w.prefix, w.counter, last), w.buf, w.header)
+	if _, err := w.dst.Write(w.out); err != nil {
+		w.err = err
+		return err
+	}
+	w.buf = w.buf[:0]
+	if !last {
+		if w.counter == ^uint32(0) {
+			w.err = errors.New("flujo demasiado largo para el tamaño de bloque")
+			return w.err
+		}
+		w.counter++
+	}
+	return nil
+}
+
+// streamReader descifra un flujo bloque a bloque; ver NewDecryptReader.
+type streamReader struct {
+	in      *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte // bloque cifrado leído
+	out     []byte // bloque descifrado (memoria reutilizada)
+	plain   []byte // parte de 'out' aún no entregada
+	done    bool   // se ha verificado el bloque final
+	err     error
+}
+
+// NewDecryptReader devuelve un io.Reader con los datos en claro del flujo
+// 'src'. Cada bloque se entrega sólo después de verificar su tag, pero si
+// Read devuelve un error distinto de io.EOF todo lo leído antes debe
+// descartarse: el flujo podría estar truncado o manipulado.
+func NewDecryptReader(src io.Reader, key []byte) (io.Reader, error) {
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(src, magic); err != nil {
+		return nil, ErrStreamTruncated
+	}
+	var header []byte
+	switch string(magic) {
+	case streamMagic:
+		header = make([]byte, streamHeaderSize)
+	case streamMagicV1:
+		header = make([]byte, streamHeaderSizeV1)
+	default:
+		return nil, errors.New("no es un flujo cifrado reconocido")
+	}
+	copy(header, magic)
+	if _, err := io.ReadFull(src, header[len(magic):]); err != nil {
+		return nil, ErrStreamTruncated
+	}
+	chunkSize := int(binary.BigEndian.Uint32(header[len(magic):]))
+	if chunkSize <= 0 || chunkSize > maxStreamChunk {
+		return nil, fmt.Errorf("tamaño de bloque no válido: %d", chunkSize)
+	}
+
+	streamKeyBytes := key
+	if string(magic) == streamMagic {
+		salt := header[len(magic)+4 : len(magic)+4+streamSaltSize]
+		streamKeyBytes = streamKey(key, salt)
+	}
+	aead, err := newGCM(streamKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		in:     bufio.NewReaderSize(src, chunkSize+streamTagSize),
+		aead:   aead,
+		header: header,
+		prefix: header[len(header)-streamPrefixSize:],
+		buf:    make([]byte, chunkSize+streamTagSize),
+		out:    make([]byte, 0, chunkSize),
+	}, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		r.err = r.next()
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// next lee y verifica el siguiente bloque.
+func (r *streamReader) next() error {
+	n, err := io.ReadFull(r.in, r.buf)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		if err == io.EOF {
+			return ErrStreamTruncated
+		}
+		return err
+	}
+	// Es el último bloque si no se llenó o si no queda nada detrás
+	last := n < len(r.buf)
+	if !last {
+		if _, perr := r.in.Peek(1); perr == io.EOF {
+			last = true
+		}
+	}
+
+	r.out, err = r.aead.Open(r.out[:0], streamNonce(r.prefix, r.counter, last), r.buf[:n], r.header)
+	if err != nil {
+		return ErrDecrypt
+	}
+	r.plain = r.out
+	r.counter++
+	r.done = last
+	return nil
+}
+
+// EncryptStream cifra todo 'src' en 'dst' por bloques de 'chunkSize' bytes,
+// de forma que la memoria usada no depende del tamaño de los datos.
+func EncryptStream(dst io.Writer, src io.Reader, key []byte, chunkSize int) error {
+	w, err := NewEncryptWriter(dst, key, chunkSize)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// DecryptStream descifra en 'dst' un flujo producido por EncryptStream.
+// Los datos de cada bloque sólo se escriben tras verificar su tag, pero un
+// error a mitad de flujo deja en 'dst' los bloques anteriores: el llamante
+// debe descartar la salida si se devuelve error.
+func DecryptStream(dst io.Writer, src io.Reader, key []byte) error {
+	r, err := NewDecryptReader(src, key)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, r)
+	return err
+}
+
+// streamNonce construye el nonce del bloque 'counter'.
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 0, 12)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if last {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// EncryptFile cifra el fichero 'srcPath' en 'dstPath' (permisos 0600).
+func EncryptFile(srcPath, dstPath string, key []byte) error {
+	return transformFile(srcPath, dstPath, func(dst io.Writer, src io.Reader) error {
+		return EncryptStream(dst, src, key, DefaultStreamChunk)
+	})
+}
+
+// DecryptFile descifra 'srcPath' en 'dstPath'. Si el descifrado falla,
+// el fichero de destino se elimina para no dejar datos a medias.
+func DecryptFile(srcPath, dstPath string, key []byte) error {
+	return transformFile(srcPath, dstPath, func(dst io.Writer, src io.Reader) error {
+		return DecryptStream(dst, src, key)
+	})
+}
+
+// transformFile abre origen y destino y aplica 'fn', borrando el destino si falla.
+func transformFile(srcPath, dstPath string, fn func(io.Writer, io.Reader) error) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("error abriendo %s: %v", srcPath, err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("error creando %s: %v", dstPath, err)
+	}
+	w := bufio.NewWriter(dst)
+	err = fn(w, src)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dstPath)
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package crypto
+
+import (
+	"strings"
+
+	"github.com/nbutton23/zxcvbn-go"
+)
+
+// MinPasswordScore es la puntuación zxcvbn mínima (0-4) que se exige al registrarse.
+const MinPasswordScore = 3
+
+// PasswordStrength resume la estimación de robustez de una contraseña.
+type PasswordStrength struct {
+	Score     int      // 0 (muy débil) a 4 (muy robusta)
+	CrackTime string   // tiempo estimado de ruptura (texto legible)
+	Hints     []string // sugerencias para mejorarla
+}
+
+// Acceptable indica si la contraseña alcanza la puntuación mínima.
+func (p PasswordStrength) Acceptable() bool {
+	return p.Score >= MinPasswordScore
+}
+
+// scoreLabels traduce la puntuación a una etiqueta para mostrar al usuario.
+var scoreLabels = [...]string{"muy débil", "débil", "aceptable", "robusta", "muy robusta"}
+
+// Label devuelve la puntuación en texto.
+func (p PasswordStrength) Label() string {
+	return scoreLabels[p.Score]
+}
+
+// patternHints asocia cada patrón detectado por zxcvbn con una sugerencia.
+var patternHints = map[string]string{
+	"dictionary": "evita palabras de diccionario o contraseñas comunes",
+	"spatial":    "evita secuencias de teclado como 'qwerty'",
+	"repeat":     "evita caracteres o bloques repetidos",
+	"sequence":   "evita secuencias como 'abcd' o '1234'",
+	"date":       "evita fechas y años",
+}
+
+// EstimatePasswordStrength estima la robustez de 'password' con zxcvbn.
+// 'userInputs' (nombre de usuario, etc.) se penalizan si aparecen en ella.
+func EstimatePasswordStrength(password string, userInputs ...string) PasswordStrength {
+	res := zxcvbn.PasswordStrength(password, userInputs)
+	strength := PasswordStrength{Score: res.Score, CrackTime: res.CrackTimeDisplay}
+
+	seen := map[string]bool{}
+	for _, m := range res.MatchSequence {
+		for _, in := range userInputs {
+			if in != "" && strings.Contains(strings.ToLower(m.Token), strings.ToLower(in)) && !seen["user"] {
+				seen["user"] = true
+				strength.Hints = append(strength.Hints, "no incluyas tu nombre de usuario")
+			}
+		}
+		if hint, ok := patternHints[m.Pattern]; ok && !seen[m.Pattern] {
+			seen[m.Pattern] = true
+			strength.Hints = append(strength.Hints, hint)
+		}
+	}
+	if len(password) < 12 {
+		strength.Hints = append(strength.Hints, "usa al menos 12 caracteres")
+	}
+	return strength
+}
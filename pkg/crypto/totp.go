@@ -0,0 +1,108 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpDigits = 6                // dígitos del código TOTP
+	totpPeriod = 30 * time.Second // duración de cada ventana (RFC 6238)
+	totpSkew   = 1                // ventanas de tolerancia antes/después
+
+	// RecoveryCodeCount es el número de códigos de recuperación por usuario.
+	RecoveryCodeCount = 10
+)
+
+// b32 es la codificación base32 sin relleno que usan las apps de autenticación.
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret crea un secreto aleatorio de 160 bits codificado en base32.
+func GenerateTOTPSecret() (string, error) {
+	b, err := RandomBytes(20)
+	if err != nil {
+		return "", err
+	}
+	return b32.EncodeToString(b), nil
+}
+
+// TOTPURI construye la URI otpauth:// que las apps (Google Authenticator,
+// FreeOTP...) pueden importar, normalmente a partir de un código QR.
+func TOTPURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// TOTPCode calcula el código TOTP (HMAC-SHA1, 6 dígitos) para el instante 't'.
+func TOTPCode(secret string, t time.Time) (string, error) {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", fmt.Errorf("secreto TOTP no válido: %v", err)
+	}
+	return hotp(key, uint64(t.Unix()/int64(totpPeriod.Seconds()))), nil
+}
+
+// VerifyTOTP comprueba 'code' contra las ventanas adyacentes a 't'
+// para tolerar pequeñas desviaciones de reloj.
+func VerifyTOTP(secret, code string, t time.Time) bool {
+	key, err := b32.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return false
+	}
+	counter := t.Unix() / int64(totpPeriod.Seconds())
+	valid := false
+	for i := int64(-totpSkew); i <= totpSkew; i++ {
+		// No cortamos el bucle al acertar para no filtrar la ventana por tiempo.
+		if ConstantTimeEqualString(hotp(key, uint64(counter+i)), code) {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// hotp implementa el algoritmo HOTP de la RFC 4226.
+func hotp(key []byte, counter uint64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCodes crea 'n' códigos de recuperación de un solo uso
+// con el formato xxxxx-xxxxx (50 bits de entropía cada uno).
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		b, err := RandomBytes(7)
+		if err != nil {
+			return nil, err
+		}
+		s := strings.ToLower(b32.EncodeToString(b))[:10]
+		codes[i] = s[:5] + "-" + s[5:]
+	}
+	return codes, nil
+}
+
+// HashRecoveryCode devuelve el SHA-256 (hex) de un código de recuperación
+// normalizado. Al ser códigos aleatorios de alta entropía no hace falta un KDF lento.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,90 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// Cifrado de los datos de usuario en el cliente (conocimiento cero): los
+// datos se cifran con una clave de datos aleatoria que sólo existe en claro
+// en el cliente. En el servidor se guarda esa clave envuelta con la
+// contraseña del usuario (mismo formato que los ficheros de clave, con su
+// propio dato asociado), así que cambiar la contraseña sólo exige volver a
+// envolverla y no volver a cifrar los datos.
+//
+// Los datos cifrados se representan como texto:
+//
+//	"prac-zk1." || base64url(nonce || ciphertext || tag)
+//
+// con el nombre de usuario como dato asociado, para que el servidor no
+// pueda presentar a un usuario los datos de otro.
+const (
+	userDataPrefix = "prac-zk1."
+	userDataAD     = "prac-userdata-zk\x00"
+	dataKeyAD      = "prac-datakey"
+)
+
+// ErrNotUserData indica que los datos no están cifrados en el cliente.
+var ErrNotUserData = errors.New("los datos no están cifrados por el cliente")
+
+// NewDataKey genera una clave de datos aleatoria.
+func NewDataKey() ([]byte, error) {
+	return RandomBytes(KeySize)
+}
+
+// WrapDataKey envuelve la clave de datos con la contraseña del usuario
+// (Argon2id con DefaultArgon2Params y AES-256-GCM) y la codifica en base64.
+func WrapDataKey(dataKey, password []byte) (string, error) {
+	if len(password) == 0 {
+		return "", errors.New("la contraseña no puede estar vacía")
+	}
+	raw, err := sealKeyFile(dataKey, password, dataKeyAD)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// UnwrapDataKey recupera la clave de datos envuelta por WrapDataKey.
+func UnwrapDataKey(wrapped string, password []byte) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, errors.New("clave de datos mal codificada")
+	}
+	key, err := openKeyFile(raw, password, dataKeyAD)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != KeySize {
+		Wipe(key)
+		return nil, errors.New("clave de datos no válida")
+	}
+	return key, nil
+}
+
+// IsSealedUserData indica si 'data' tiene el formato de SealUserData.
+func IsSealedUserData(data string) bool {
+	return strings.HasPrefix(data, userDataPrefix)
+}
+
+// SealUserData cifra los datos de 'username' con su clave de datos.
+func SealUserData(dataKey []byte, username string, plaintext []byte) (string, error) {
+	sealed, err := Seal(dataKey, plaintext, []byte(userDataAD+username))
+	if err != nil {
+		return "", err
+	}
+	return userDataPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// OpenUserData descifra datos producidos por SealUserData.
+func OpenUserData(dataKey []byte, username, data string) ([]byte, error) {
+	if !IsSealedUserData(data) {
+		return nil, ErrNotUserData
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(data[len(userDataPrefix):])
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return Open(dataKey, sealed, []byte(userDataAD+username))
+}
@@ -0,0 +1,29 @@
+package crypto
+
+import (
+	"math/big"
+	"runtime"
+)
+
+// Wipe sobrescribe con ceros los buffers indicados. Se usa con contraseñas,
+// claves derivadas y semillas en cuanto dejan de hacer falta, para acortar
+// el tiempo que pasan en memoria. No es una garantía absoluta: el runtime
+// puede haber copiado el contenido antes (al hacer crecer un slice, por
+// ejemplo) y las conversiones a string crean copias que no se pueden borrar.
+func Wipe(bufs ...[]byte) {
+	for _, b := range bufs {
+		clear(b)
+	}
+	runtime.KeepAlive(bufs)
+}
+
+// WipeInt pone a cero los dígitos internos de los big.Int indicados
+// (exponentes secretos de SRP y similares).
+func WipeInt(xs ...*big.Int) {
+	for _, x := range xs {
+		if x != nil {
+			clear(x.Bits())
+			x.SetInt64(0)
+		}
+	}
+}
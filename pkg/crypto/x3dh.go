@@ -0,0 +1,134 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// Acuerdo inicial X3DH simplificado (sin prekeys de un solo uso): establece
+// el secreto compartido con el que arranca el double ratchet entre dos
+// usuarios que no están conectados a la vez. Cada usuario publica un
+// "bundle" con su clave de identidad X25519 y una prekey firmada con su
+// clave Ed25519, de modo que el servidor no puede sustituirlas.
+
+var x3dhSPKContext = []byte("prac-x3dh-spk-v1\x00")
+
+// ErrPreKeySignature indica que la firma de la prekey no es válida.
+var ErrPreKeySignature = errors.New("firma de la prekey no válida")
+
+// PreKeyBundle es lo que un usuario publica para que otros le escriban.
+type PreKeyBundle struct {
+	IdentityKey  []byte `json:"identityKey"`  // X25519
+	SignedPreKey []byte `json:"signedPreKey"` // X25519, también clave inicial del ratchet
+	Signature    []byte `json:"signature"`    // Ed25519 sobre SignedPreKey
+}
+
+// X3DHInit acompaña al primer mensaje para que el destinatario pueda
+// calcular el mismo secreto.
+type X3DHInit struct {
+	IdentityKey  []byte `json:"identityKey"`
+	EphemeralKey []byte `json:"ephemeralKey"`
+}
+
+// X3DHKeys son las claves X25519 de larga duración de un usuario.
+type X3DHKeys struct {
+	identity *ecdh.PrivateKey
+	preKey   *ecdh.PrivateKey
+}
+
+// NewX3DHKeys deriva las claves X25519 de forma determinista a partir de
+// una semilla secreta (la de la clave de firma), así no hay que guardar
+// ficheros de clave adicionales.
+func NewX3DHKeys(seed []byte) (*X3DHKeys, error) {
+	ikRaw, spkRaw := DeriveKey(seed, "x3dh-identity"), DeriveKey(seed, "x3dh-prekey-v1")
+	defer Wipe(ikRaw, spkRaw)
+	ik, err := ecdh.X25519().NewPrivateKey(ikRaw)
+	if err != nil {
+		return nil, err
+	}
+	spk, err := ecdh.X25519().NewPrivateKey(spkRaw)
+	if err != nil {
+		return nil, err
+	}
+	return &X3DHKeys{identity: ik, preKey: spk}, nil
+}
+
+// Bundle devuelve el bundle público firmado con 'signKey'.
+func (k *X3DHKeys) Bundle(signKey ed25519.PrivateKey) PreKeyBundle {
+	spk := k.preKey.PublicKey().Bytes()
+	return PreKeyBundle{
+		IdentityKey:  k.identity.PublicKey().Bytes(),
+		SignedPreKey: spk,
+		Signature:    ed25519.Sign(signKey, append(bytes.Clone(x3dhSPKContext), spk...)),
+	}
+}
+
+// X3DHInitiate calcula, del lado de quien escribe primero, el secreto
+// compartido y los datos asociados de la conversación a partir del bundle
+// del destinatario, cuya firma se comprueba con su clave pública 'signPub'.
+func X3DHInitiate(local *X3DHKeys, bundle PreKeyBundle, signPub ed25519.PublicKey) (sk, ad []byte, init *X3DHInit, err error) {
+	if len(signPub) != ed25519.PublicKeySize ||
+		!ed25519.Verify(signPub, append(bytes.Clone(x3dhSPKContext), bundle.SignedPreKey...), bundle.Signature) {
+		return nil, nil, nil, ErrPreKeySignature
+	}
+	ikB, err1 := ecdh.X25519().NewPublicKey(bundle.IdentityKey)
+	spkB, err2 := ecdh.X25519().NewPublicKey(bundle.SignedPreKey)
+	if err1 != nil || err2 != nil {
+		return nil, nil, nil, ErrInvalidPublicKey
+	}
+	ek, err := ecdh.X25519().GenerateKey(randReader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	dh1, err1 := local.identity.ECDH(spkB)
+	dh2, err2 := ek.ECDH(ikB)
+	dh3, err3 := ek.ECDH(spkB)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, nil, nil, err
+	}
+	ikA := local.identity.PublicKey().Bytes()
+	return x3dhKDF(dh1, dh2, dh3), append(bytes.Clone(ikA), bundle.IdentityKey...),
+		&X3DHInit{IdentityKey: ikA, EphemeralKey: ek.PublicKey().Bytes()}, nil
+}
+
+// X3DHRespond calcula el mismo secreto del lado del destinatario.
+func X3DHRespond(local *X3DHKeys, init *X3DHInit) (sk, ad []byte, err error) {
+	ikA, err1 := ecdh.X25519().NewPublicKey(init.IdentityKey)
+	ekA, err2 := ecdh.X25519().NewPublicKey(init.EphemeralKey)
+	if err1 != nil || err2 != nil {
+		return nil, nil, ErrInvalidPublicKey
+	}
+	dh1, err1 := local.preKey.ECDH(ikA)
+	dh2, err2 := local.identity.ECDH(ekA)
+	dh3, err3 := local.preKey.ECDH(ekA)
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return nil, nil, err
+	}
+	ikB := local.identity.PublicKey().Bytes()
+	return x3dhKDF(dh1, dh2, dh3), append(bytes.Clone(init.IdentityKey), ikB...), nil
+}
+
+// PreKeyPrivate devuelve la prekey privada, que es la clave inicial del
+// ratchet del destinatario (ver NewRatchetResponder).
+func (k *X3DHKeys) PreKeyPrivate() []byte {
+	return k.preKey.Bytes()
+}
+
+func x3dhKDF(dhs ...[]byte) []byte {
+	ikm := bytes.Repeat([]byte{0xff}, 32)
+	for _, dh := range dhs {
+		ikm = append(ikm, dh...)
+	}
+	sk := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, make([]byte, 32), []byte("prac-x3dh")), sk); err != nil {
+		panic(err)
+	}
+	return sk
+}
@@ -0,0 +1,152 @@
+package keyprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"prac/pkg/crypto"
+)
+
+// KeyManager es un KMS externo que custodia la clave de cifrado de claves
+// (KEK) y sólo entrega claves de datos: en disco se guarda la clave maestra
+// cifrada por el KMS y en claro sólo existe en memoria (cifrado de sobre).
+type KeyManager interface {
+	// Name identifica el KMS y la clave (p. ej. "vault:transit/prac-master").
+	Name() string
+
+	// GetDataKey genera una clave de datos de 32 bytes y la devuelve en
+	// claro y cifrada con la KEK.
+	GetDataKey() (plaintext, wrapped []byte, err error)
+
+	// Decrypt descifra una clave de datos cifrada con la KEK.
+	Decrypt(wrapped []byte) ([]byte, error)
+
+	// Rotate crea una nueva versión de la KEK y devuelve 'wrapped' recifrado
+	// con ella, sin que la clave de datos salga en claro del KMS.
+	Rotate(wrapped []byte) ([]byte, error)
+}
+
+// Encrypter lo implementan los KeyManager capaces de cifrar una clave ya
+// existente, necesario para pasar al KMS una clave maestra anterior.
+type Encrypter interface {
+	Encrypt(plaintext []byte) ([]byte, error)
+}
+
+// kmsFileVersion es la versión del formato del fichero de clave del KMS.
+const kmsFileVersion = 1
+
+// kmsFile es el contenido (JSON) del fichero con la clave maestra cifrada
+// por el KMS. Sin acceso al KMS no sirve para nada.
+type kmsFile struct {
+	Version int    `json:"version"`
+	KMS     string `json:"kms"`
+	Key     []byte `json:"key"`
+}
+
+// CreateKMSKey pide al KMS una clave de datos nueva, guarda su versión
+// cifrada en 'path' (0600, falla si existe) y devuelve la clave en claro.
+func CreateKMSKey(path string, km KeyManager) ([]byte, error) {
+	master, wrapped, err := km.GetDataKey()
+	if err != nil {
+		return nil, err
+	}
+	if len(master) != crypto.KeySize {
+		return nil, fmt.Errorf("el KMS devolvió una clave de %d bytes", len(master))
+	}
+	if err := writeKMSFile(path, km, wrapped, true); err != nil {
+		crypto.Wipe(master)
+		return nil, err
+	}
+	return master, nil
+}
+
+// ImportKMSKey cifra con el KMS una clave maestra ya existente y la guarda
+// en 'path' (falla si existe). El KMS debe implementar Encrypter.
+func ImportKMSKey(path string, km KeyManager, master []byte) error {
+	enc, ok := km.(Encrypter)
+	if !ok {
+		return fmt.Errorf("el KMS %s no permite importar una clave existente", km.Name())
+	}
+	wrapped, err := enc.Encrypt(master)
+	if err != nil {
+		return err
+	}
+	return writeKMSFile(path, km, wrapped, true)
+}
+
+// OpenKMSKey lee 'path' y descifra la clave maestra con el KMS.
+func OpenKMSKey(path string, km KeyManager) ([]byte, error) {
+	kf, err := readKMSFile(path)
+	if err != nil {
+		return nil, err
+	}
+	master, err := km.Decrypt(kf.Key)
+	if err != nil {
+		return nil, err
+	}
+	if len(master) != crypto.KeySize {
+		return nil, ErrUnwrap
+	}
+	return master, nil
+}
+
+// RotateKMSKey rota la KEK en el KMS y reescribe 'path' con la clave maestra
+// recifrada. La clave maestra no cambia, así que los datos siguen valiendo.
+func RotateKMSKey(path string, km KeyManager) error {
+	kf, err := readKMSFile(path)
+	if err != nil {
+		return err
+	}
+	wrapped, err := km.Rotate(kf.Key)
+	if err != nil {
+		return err
+	}
+	return writeKMSFile(path, km, wrapped, false)
+}
+
+func readKMSFile(path string) (*kmsFile, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kf kmsFile
+	if err := json.Unmarshal(raw, &kf); err != nil {
+		return nil, fmt.Errorf("fichero de clave del KMS no válido: %v", err)
+	}
+	if kf.Version != kmsFileVersion {
+		return nil, fmt.Errorf("versión de clave del KMS no soportada: %d", kf.Version)
+	}
+	if len(kf.Key) == 0 {
+		return nil, errors.New("fichero de clave del KMS vacío")
+	}
+	return &kf, nil
+}
+
+// writeKMSFile escribe el fichero de forma atómica; con 'exclusive' falla
+// si ya existe, para no perder nunca una clave maestra.
+func writeKMSFile(path string, km KeyManager, wrapped []byte, exclusive bool) error {
+	raw, err := json.MarshalIndent(kmsFile{Version: kmsFileVersion, KMS: km.Name(), Key: wrapped}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if exclusive {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s ya existe", path)
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creando el directorio de la clave: %v", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return fmt.Errorf("error escribiendo la clave del KMS: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error escribiendo la clave del KMS: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+//go:build cgo
+
+package keyprovider
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/miekg/pkcs11"
+
+	"prac/pkg/crypto"
+)
+
+// PKCS11Config indica dónde está la clave en el HSM.
+type PKCS11Config struct {
+	Module   string // biblioteca PKCS#11 (p. ej. /usr/lib/softhsm/libsofthsm2.so)
+	Token    string // etiqueta del token
+	PIN      string // PIN de usuario
+	KeyLabel string // etiqueta de la clave AES-256 en el token
+	Create   bool   // genera la clave en el token si no existe
+}
+
+// PKCS11 es un Provider cuya clave AES-256 vive en un token PKCS#11 y no es
+// extraíble: Wrap/Unwrap usan CKM_AES_GCM y Sign CKM_AES_CMAC dentro del HSM.
+type PKCS11 struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	key     pkcs11.ObjectHandle
+	name    string
+}
+
+// OpenPKCS11 carga el módulo, inicia sesión en el token y localiza (o crea,
+// si cfg.Create) la clave. Hay que llamar a Close al terminar.
+func OpenPKCS11(cfg PKCS11Config) (*PKCS11, error) {
+	if cfg.Module == "" || cfg.Token == "" || cfg.KeyLabel == "" {
+		return nil, errors.New("faltan el módulo, el token o la etiqueta de la clave PKCS#11")
+	}
+	ctx := pkcs11.New(cfg.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("no se pudo cargar el módulo PKCS#11 %s", cfg.Module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("error inicializando PKCS#11: %v", err)
+	}
+	p := &PKCS11{ctx: ctx, name: "pkcs11:" + cfg.Token + "/" + cfg.KeyLabel}
+	if err := p.open(cfg); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *PKCS11) open(cfg PKCS11Config) error {
+	slot, err := p.findSlot(cfg.Token)
+	if err != nil {
+		return err
+	}
+	if p.session, err = p.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION); err != nil {
+		return fmt.Errorf("error abriendo sesión PKCS#11: %v", err)
+	}
+	if err := p.ctx.Login(p.session, pkcs11.CKU_USER, cfg.PIN); err != nil {
+		return fmt.Errorf("error de login en el token (¿PIN incorrecto?): %v", err)
+	}
+	p.key, err = p.findKey(cfg.KeyLabel)
+	if errors.Is(err, errKeyNotFound) && cfg.Create {
+		p.key, err = p.generateKey(cfg.KeyLabel)
+	}
+	return err
+}
+
+// findSlot devuelve la ranura del token con etiqueta 'label'.
+func (p *PKCS11) findSlot(label string) (uint, error) {
+	slots, err := p.ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("error listando ranuras PKCS#11: %v", err)
+	}
+	for _, s := range slots {
+		info, err := p.ctx.GetTokenInfo(s)
+		if err == nil && info.Label == label {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("token PKCS#11 no encontrado: %s", label)
+}
+
+var errKeyNotFound = errors.New("clave no encontrada en el token")
+
+// findKey busca la clave secreta AES con etiqueta 'label'.
+func (p *PKCS11) findKey(label string) (pkcs11.ObjectHandle, error) {
+	tmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := p.ctx.FindObjectsInit(p.session, tmpl); err != nil {
+		return 0, fmt.Errorf("error buscando la clave en el token: %v", err)
+	}
+	objs, _, err := p.ctx.FindObjects(p.session, 2)
+	p.ctx.FindObjectsFinal(p.session)
+	switch {
+	case err != nil:
+		return 0, fmt.Errorf("error buscando la clave en el token: %v", err)
+	case len(objs) == 0:
+		return 0, fmt.Errorf("%w: %s", errKeyNotFound, label)
+	case len(objs) > 1:
+		return 0, fmt.Errorf("hay varias claves con la etiqueta %s en el token", label)
+	}
+	return objs[0], nil
+}
+
+// generateKey crea en el token una clave AES-256 persistente, sensible y
+// no extraíble, usable sólo para cifrar/descifrar y firmar.
+func (p *PKCS11) generateKey(label string) (pkcs11.ObjectHandle, error) {
+	tmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_SECRET_KEY),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_AES),
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE_LEN, crypto.KeySize),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_PRIVATE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+		pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+		pkcs11.NewAttribute(pkcs11.CKA_ENCRYPT, true),
+		pkcs11.NewAttribute(pkcs11.CKA_DECRYPT, true),
+		pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+		pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+	}
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_KEY_GEN, nil)}
+	h, err := p.ctx.GenerateKey(p.session, mech, tmpl)
+	if err != nil {
+		return 0, fmt.Errorf("error generando la clave en el token: %v", err)
+	}
+	return h, nil
+}
+
+func (p *PKCS11) Name() string { return p.name }
+
+// Wrap cifra con AES-GCM en el HSM; el resultado es iv(12) || ct || tag.
+func (p *PKCS11) Wrap(key, ad []byte) ([]byte, error) {
+	iv, err := crypto.RandomBytes(12)
+	if err != nil {
+		return nil, err
+	}
+	params := pkcs11.NewGCMParams(iv, ad, 128)
+	defer params.Free()
+	if err := p.ctx.EncryptInit(p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}, p.key); err != nil {
+		return nil, fmt.Errorf("error iniciando el cifrado PKCS#11: %v", err)
+	}
+	ct, err := p.ctx.Encrypt(p.session, key)
+	if err != nil {
+		return nil, fmt.Errorf("error cifrando con PKCS#11: %v", err)
+	}
+	// Algunos HSM ignoran el IV recibido y usan uno propio
+	if hsmIV := params.IV(); len(hsmIV) == len(iv) {
+		iv = hsmIV
+	}
+	return append(iv, ct...), nil
+}
+
+func (p *PKCS11) Unwrap(wrapped, ad []byte) ([]byte, error) {
+	if len(wrapped) < 12+16 {
+		return nil, ErrUnwrap
+	}
+	params := pkcs11.NewGCMParams(wrapped[:12], ad, 128)
+	defer params.Free()
+	if err := p.ctx.DecryptInit(p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_GCM, params)}, p.key); err != nil {
+		return nil, fmt.Errorf("error iniciando el descifrado PKCS#11: %v", err)
+	}
+	key, err := p.ctx.Decrypt(p.session, wrapped[12:])
+	if err != nil {
+		return nil, ErrUnwrap
+	}
+	return key, nil
+}
+
+// Sign calcula AES-CMAC de 'msg' en el HSM.
+func (p *PKCS11) Sign(msg []byte) ([]byte, error) {
+	if err := p.ctx.SignInit(p.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_AES_CMAC, nil)}, p.key); err != nil {
+		return nil, fmt.Errorf("error iniciando la firma PKCS#11: %v", err)
+	}
+	return p.ctx.Sign(p.session, msg)
+}
+
+func (p *PKCS11) Close() error {
+	if p.session != 0 {
+		p.ctx.Logout(p.session)
+		p.ctx.CloseSession(p.session)
+	}
+	p.ctx.Finalize()
+	p.ctx.Destroy()
+	return nil
+}
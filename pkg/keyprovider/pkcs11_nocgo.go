@@ -0,0 +1,22 @@
+//go:build !cgo
+
+package keyprovider
+
+import "errors"
+
+// PKCS11Config indica dónde está la clave en el HSM.
+type PKCS11Config struct {
+	Module   string
+	Token    string
+	PIN      string
+	KeyLabel string
+	Create   bool
+}
+
+// PKCS11 no está disponible sin cgo (la biblioteca PKCS#11 se carga en C).
+type PKCS11 struct{ Provider }
+
+// OpenPKCS11 siempre falla en los binarios compilados sin cgo.
+func OpenPKCS11(cfg PKCS11Config) (*PKCS11, error) {
+	return nil, errors.New("soporte PKCS#11 no disponible: compila con CGO_ENABLED=1")
+}
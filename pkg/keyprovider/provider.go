@@ -0,0 +1,81 @@
+// El paquete keyprovider abstrae las operaciones con la clave que protege
+// la clave maestra del servidor (envolver, desenvolver y firmar), de forma
+// que esa clave pueda vivir fuera del disco, por ejemplo en un HSM PKCS#11.
+//
+// La clave maestra sigue siendo una clave de datos de 32 bytes de la que se
+// derivan las demás (crypto.DeriveKey); lo que cambia es que en disco sólo
+// se guarda envuelta por el proveedor (ver WrappedKey).
+package keyprovider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+
+	"prac/pkg/crypto"
+)
+
+// Provider realiza operaciones con una clave que nunca sale de él.
+type Provider interface {
+	// Name identifica el proveedor y la clave (p. ej. "pkcs11:token/etiqueta").
+	Name() string
+
+	// Wrap cifra y autentica 'key' (y 'ad', que no se cifra).
+	Wrap(key, ad []byte) ([]byte, error)
+
+	// Unwrap deshace Wrap; falla si 'wrapped' o 'ad' se han modificado.
+	Unwrap(wrapped, ad []byte) ([]byte, error)
+
+	// Sign calcula un MAC de 'msg' con la clave del proveedor.
+	Sign(msg []byte) ([]byte, error)
+
+	// Close libera la sesión con el proveedor.
+	Close() error
+}
+
+// ErrUnwrap indica que la clave envuelta no se pudo abrir con este proveedor.
+var ErrUnwrap = errors.New("no se pudo desenvolver la clave con el proveedor")
+
+// Local es un Provider en software con la clave en memoria (AES-256-GCM y
+// HMAC-SHA256). Sirve como referencia y para desarrollo, no protege nada
+// que no proteja ya quien guarde 'kek'.
+type Local struct {
+	kek []byte
+	mac []byte
+}
+
+// NewLocal crea un proveedor local con la clave 'kek' (32 bytes).
+func NewLocal(kek []byte) (*Local, error) {
+	if len(kek) != crypto.KeySize {
+		return nil, errors.New("la clave del proveedor local debe tener 32 bytes")
+	}
+	return &Local{
+		kek: crypto.DeriveKey(kek, "keyprovider-wrap"),
+		mac: crypto.DeriveKey(kek, "keyprovider-sign"),
+	}, nil
+}
+
+func (l *Local) Name() string { return "local" }
+
+func (l *Local) Wrap(key, ad []byte) ([]byte, error) {
+	return crypto.Seal(l.kek, key, ad)
+}
+
+func (l *Local) Unwrap(wrapped, ad []byte) ([]byte, error) {
+	key, err := crypto.Open(l.kek, wrapped, ad)
+	if err != nil {
+		return nil, ErrUnwrap
+	}
+	return key, nil
+}
+
+func (l *Local) Sign(msg []byte) ([]byte, error) {
+	m := hmac.New(sha256.New, l.mac)
+	m.Write(msg)
+	return m.Sum(nil), nil
+}
+
+func (l *Local) Close() error {
+	crypto.Wipe(l.kek, l.mac)
+	return nil
+}
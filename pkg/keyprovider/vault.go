@@ -0,0 +1,180 @@
+package keyprovider
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// VaultConfig indica cómo llegar al motor transit de HashiCorp Vault.
+type VaultConfig struct {
+	Addr      string // p. ej. https://vault.example:8200
+	Token     string // token con permiso sobre transit/{datakey,decrypt,encrypt,rewrap,keys/<key>/rotate}
+	Namespace string // namespace de Vault Enterprise (opcional)
+	Mount     string // punto de montaje del motor transit
+	Key       string // nombre de la clave en transit (tipo aes256-gcm96)
+	CACert    string // CA en PEM para verificar el servidor (opcional)
+}
+
+// Vault es un KeyManager sobre el motor transit de Vault: la KEK no sale
+// nunca de Vault y las claves de datos se cifran como "vault:vN:...".
+// La clave debe existir: vault write -f transit/keys/<Key>
+type Vault struct {
+	cfg  VaultConfig
+	http *http.Client
+}
+
+// NewVault prepara el cliente de Vault (no contacta con el servidor).
+func NewVault(cfg VaultConfig) (*Vault, error) {
+	if cfg.Addr == "" || cfg.Token == "" || cfg.Key == "" {
+		return nil, errors.New("faltan la dirección, el token o la clave de Vault")
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "transit"
+	}
+	cfg.Addr = strings.TrimRight(cfg.Addr, "/")
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo la CA de Vault: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("la CA de Vault %s no contiene certificados", cfg.CACert)
+		}
+		tr.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+	return &Vault{cfg: cfg, http: &http.Client{Transport: tr, Timeout: 15 * time.Second}}, nil
+}
+
+func (v *Vault) Name() string { return "vault:" + v.cfg.Mount + "/" + v.cfg.Key }
+
+func (v *Vault) GetDataKey() ([]byte, []byte, error) {
+	var out struct {
+		Plaintext  string `json:"plaintext"`
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := v.call("datakey/plaintext/"+url.PathEscape(v.cfg.Key), map[string]any{"bits": 256}, &out); err != nil {
+		return nil, nil, err
+	}
+	plain, err := base64.StdEncoding.DecodeString(out.Plaintext)
+	if err != nil || out.Ciphertext == "" {
+		return nil, nil, errors.New("respuesta de Vault no válida en datakey")
+	}
+	return plain, []byte(out.Ciphertext), nil
+}
+
+func (v *Vault) Decrypt(wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := v.call("decrypt/"+url.PathEscape(v.cfg.Key), map[string]any{"ciphertext": string(wrapped)}, &out); err != nil {
+		return nil, err
+	}
+	plain, err := base64.StdEncoding.DecodeString(out.Plaintext)
+	if err != nil {
+		return nil, errors.New("respuesta de Vault no válida en decrypt")
+	}
+	return plain, nil
+}
+
+// Encrypt cifra una clave existente con la KEK (ver Encrypter).
+func (v *Vault) Encrypt(plaintext []byte) ([]byte, error) {
+	var out struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := v.call("encrypt/"+url.PathEscape(v.cfg.Key), map[string]any{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}, &out); err != nil {
+		return nil, err
+	}
+	if out.Ciphertext == "" {
+		return nil, errors.New("respuesta de Vault no válida en encrypt")
+	}
+	return []byte(out.Ciphertext), nil
+}
+
+// Rotate rota la clave de transit y recifra 'wrapped' con rewrap, que
+// descifra y vuelve a cifrar dentro de Vault.
+func (v *Vault) Rotate(wrapped []byte) ([]byte, error) {
+	if err := v.call("keys/"+url.PathEscape(v.cfg.Key)+"/rotate", nil, nil); err != nil {
+		return nil, err
+	}
+	var out struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := v.call("rewrap/"+url.PathEscape(v.cfg.Key), map[string]any{"ciphertext": string(wrapped)}, &out); err != nil {
+		return nil, err
+	}
+	if out.Ciphertext == "" {
+		return nil, errors.New("respuesta de Vault no válida en rewrap")
+	}
+	return []byte(out.Ciphertext), nil
+}
+
+// call hace un POST a /v1/<mount>/<path> y decodifica el campo "data" de
+// la respuesta en 'out' (si no es nil).
+func (v *Vault) call(path string, body any, out any) error {
+	var payload io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequest(http.MethodPost, v.cfg.Addr+"/v1/"+v.cfg.Mount+"/"+path, payload)
+	if err != nil {
+		return fmt.Errorf("dirección de Vault no válida: %v", err)
+	}
+	req.Header.Set("X-Vault-Token", v.cfg.Token)
+	req.Header.Set("X-Vault-Request", "true")
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("error contactando con Vault: %v", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("error leyendo la respuesta de Vault: %v", err)
+	}
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &envelope); err != nil {
+			return fmt.Errorf("respuesta de Vault no válida (HTTP %d)", resp.StatusCode)
+		}
+	}
+	if resp.StatusCode/100 != 2 {
+		if len(envelope.Errors) > 0 {
+			return fmt.Errorf("Vault (%s): %s", path, strings.Join(envelope.Errors, "; "))
+		}
+		return fmt.Errorf("Vault (%s): HTTP %d", path, resp.StatusCode)
+	}
+	if out == nil {
+		return nil
+	}
+	if len(envelope.Data) == 0 {
+		return fmt.Errorf("Vault (%s): respuesta sin datos", path)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
@@ -0,0 +1,104 @@
+package keyprovider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"prac/pkg/crypto"
+)
+
+// wrappedFileVersion es la versión del formato del fichero de clave envuelta.
+const wrappedFileVersion = 1
+
+// wrapAD liga la clave envuelta a su uso, para que no se pueda hacer pasar
+// por otra clave envuelta con el mismo proveedor.
+var wrapAD = []byte("prac-master-key-v1")
+
+// kcvMessage es el mensaje cuyo MAC identifica la clave del proveedor.
+var kcvMessage = []byte("prac-key-check-value")
+
+// ErrWrongProvider indica que el fichero fue envuelto con otra clave.
+var ErrWrongProvider = errors.New("la clave del proveedor no es la que envolvió la clave maestra")
+
+// wrappedFile es el contenido (JSON) del fichero con la clave maestra envuelta.
+type wrappedFile struct {
+	Version  int    `json:"version"`
+	Provider string `json:"provider"`
+	Check    []byte `json:"check"` // Sign(kcvMessage): detecta un token o clave equivocados
+	Key      []byte `json:"key"`   // Wrap(clave maestra, wrapAD)
+}
+
+// CreateWrappedKey envuelve 'master' con 'p' y lo guarda en 'path' (0600).
+// Falla si el fichero ya existe.
+func CreateWrappedKey(path string, p Provider, master []byte) error {
+	if len(master) != crypto.KeySize {
+		return errors.New("clave maestra no válida")
+	}
+	check, err := p.Sign(kcvMessage)
+	if err != nil {
+		return fmt.Errorf("error firmando con el proveedor: %v", err)
+	}
+	wrapped, err := p.Wrap(master, wrapAD)
+	if err != nil {
+		return fmt.Errorf("error envolviendo la clave maestra: %v", err)
+	}
+	raw, err := json.MarshalIndent(wrappedFile{
+		Version:  wrappedFileVersion,
+		Provider: p.Name(),
+		Check:    check,
+		Key:      wrapped,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creando el directorio de la clave: %v", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creando %s: %v", path, err)
+	}
+	if _, err = f.Write(raw); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// OpenWrappedKey lee 'path' y desenvuelve la clave maestra con 'p'.
+func OpenWrappedKey(path string, p Provider) ([]byte, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var wf wrappedFile
+	if err := json.Unmarshal(raw, &wf); err != nil {
+		return nil, fmt.Errorf("fichero de clave envuelta no válido: %v", err)
+	}
+	if wf.Version != wrappedFileVersion {
+		return nil, fmt.Errorf("versión de clave envuelta no soportada: %d", wf.Version)
+	}
+	check, err := p.Sign(kcvMessage)
+	if err != nil {
+		return nil, fmt.Errorf("error firmando con el proveedor: %v", err)
+	}
+	if !crypto.ConstantTimeEqual(check, wf.Check) {
+		return nil, fmt.Errorf("%w (fichero de %s, proveedor %s)", ErrWrongProvider, wf.Provider, p.Name())
+	}
+	master, err := p.Unwrap(wf.Key, wrapAD)
+	if err != nil {
+		return nil, err
+	}
+	if len(master) != crypto.KeySize {
+		return nil, ErrUnwrap
+	}
+	return master, nil
+}
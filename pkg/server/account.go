@@ -0,0 +1,179 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"prac/pkg/api"
+	"prac/pkg/store"
+)
+
+// deleteAccount da de baja al usuario de la sesión y borra todo lo suyo
+// (ver purgeUser). Como en changePassword, no basta con el token: en
+// cuentas clásicas hay que volver a enviar Password y en cuentas SRP, la
+// prueba M1 de un srpBegin previo. Las cuentas OPAQUE no pueden
+// demostrarlo sin otro login y no se dan de baja así.
+func (s *server) deleteAccount(ctx context.Context, req api.Request) api.Response {
+	key := s.userKey(req.Username)
+	hashed, err := s.db.Exists(ctx, "auth", key)
+	srp := false
+	if err == nil && !hashed {
+		srp, err = s.db.Exists(ctx, "srp", key)
+	}
+	if err != nil {
+		s.logf(ctx, "error consultando las credenciales de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al eliminar la cuenta"}
+	}
+	switch {
+	case hashed:
+		if req.Password == "" {
+			return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Falta la contraseña"}
+		}
+		if res, ok := s.recheckPassword(ctx, req.Username, req.Password); !ok {
+			return res
+		}
+	case srp:
+		if res, ok := s.checkSRPProof(req); !ok {
+			return res
+		}
+	default:
+		return api.Response{Success: false, Code: api.ErrNotSupported, Message: "El método de autenticación de la cuenta no permite eliminarla"}
+	}
+
+	if err := s.purgeUser(ctx, req.Username); err != nil {
+		s.logf(ctx, "error eliminando la cuenta de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al eliminar la cuenta"}
+	}
+	return api.Response{Success: true, Message: "Cuenta eliminada"}
+}
+
+// checkSRPProof comprueba la prueba M1 de 'req' contra el reto SRP en
+// curso del usuario. Si falla, devuelve también la respuesta que debe
+// enviarse.
+func (s *server) checkSRPProof(req api.Request) (api.Response, bool) {
+	if req.SRP == nil || req.SRP.M1 == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan parámetros SRP"}, false
+	}
+	m1, err := base64.StdEncoding.DecodeString(req.SRP.M1)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Parámetros SRP no válidos"}, false
+	}
+	p, ok := s.takeSRPPending(req.Username)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "No hay un login SRP en curso o ha caducado"}, false
+	}
+	if _, _, ok := p.srv.VerifyClient(m1); !ok {
+		return api.Response{Success: false, Code: api.ErrInvalidCredentials, Message: "Credenciales inválidas"}, false
+	}
+	return api.Response{}, true
+}
+
+// purgeUser borra en una sola transacción todos los registros de
+// 'username': los de userNamespaces (credenciales, datos...), sus sesiones
+// (sus canales de avisos se cierran con EventLogout), el historial de sus
+// datos y el de sus inicios de sesión, sus ceremonias WebAuthn en curso,
+// los mensajes de su buzón, sus ficheros, su pertenencia a grupos (los
+// suyos se borran; ver leaveGroupsTx) y lo que ha compartido o le han
+// compartido (ver dropSharesTx). Si algo falla, no se borra nada y la
+// cuenta sigue como estaba.
+// De los ficheros, en la transacción sólo se borran sus registros: los
+// trozos, que pueden no caber en ella, ya no son de nadie y se borran
+// después con sus namespaces. Si eso falla, se devuelve el error, pero la
+// cuenta ya no existe.
+//
+// No se tocan el registro de auditoría, que tiene que seguir encadenado,
+// las instantáneas de adminBackup ni los mensajes que haya enviado a otros,
+// que son ya de sus buzones.
+func (s *server) purgeUser(ctx context.Context, username string) error {
+	key := s.userKey(username)
+	logins, err := s.db.KeysByPrefix(ctx, loginsNS, s.loginPrefix(username))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	ceremonies, err := s.db.KeysByPrefix(ctx, webauthnSessionsNS, s.ceremonyPrefix(username))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	inbox := s.inboxNamespace(username)
+	messages, err := s.db.ListKeys(ctx, inbox)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	groups, err := s.memberGroups(ctx, username)
+	if err != nil {
+		return err
+	}
+	owned, err := s.ownedFiles(ctx, username)
+	if err != nil {
+		return err
+	}
+	received, err := s.sharedWith(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	// Con s.sessionsMu tomado no se puede abrir ni renovar ninguna sesión
+	// entre que se listan y se borran
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sessions, err := s.db.KeysByPrefix(ctx, sessionsNS, s.sessionPrefix(username))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	files := s.filesNamespace(username)
+	err = s.db.Batch(ctx, func(tx store.Tx) error {
+		if err := store.DeleteVersionedTx(tx, "userdata", key); err != nil {
+			return err
+		}
+		if err := s.leaveGroupsTx(tx, username, groups); err != nil {
+			return err
+		}
+		if err := s.dropSharesTx(tx, username, owned, received); err != nil {
+			return err
+		}
+		if err := s.users.records.Delete(tx, key); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		for _, ns := range userNamespaces {
+			if err := tx.Delete(ns, key); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		}
+		for _, rec := range owned {
+			if err := tx.Delete(files, s.fileKey(rec.Name)); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		}
+		deletes := []struct {
+			ns   string
+			keys [][]byte
+		}{
+			{sessionsNS, sessions},
+			{loginsNS, logins},
+			{webauthnSessionsNS, ceremonies},
+			{inbox, messages},
+		}
+		for _, d := range deletes {
+			for _, k := range d.keys {
+				if err := tx.Delete(d.ns, k); err != nil && !errors.Is(err, store.ErrNotFound) {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Ya sólo quedan los trozos de los ficheros y namespaces vacíos
+	var errs []error
+	for _, ns := range []string{files, inbox, s.sharesNamespace(username)} {
+		if err := s.db.DeleteNamespace(ctx, ns); err != nil && !errors.Is(err, store.ErrNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %w", ns, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,309 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/audit"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// snapshotPrefix y snapshotSuffix delimitan el nombre de las instantáneas
+// de adminBackup; adminRestore no acepta otros ficheros.
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".db"
+)
+
+// VerifyAudit abre la base de datos indicada en 'cfg' y comprueba la
+// integridad de la cadena de auditoría, en sólo lectura. Pensado para
+// ejecutarse desde la línea de comandos con el servidor parado (bbolt
+// bloquea el fichero).
+func VerifyAudit(cfg Config) (audit.Report, error) {
+	ctx := context.Background()
+	db, err := openStoreReadOnly(cfg)
+	if err != nil {
+		return audit.Report{}, err
+	}
+	defer db.Close()
+
+	l, err := audit.Open(ctx, db, crypto.DeriveKey(cfg.MasterKey, "audit"))
+	if err != nil {
+		return audit.Report{}, err
+	}
+	return l.Verify(ctx)
+}
+
+// DatabaseReport es el resultado de VerifyDatabase.
+type DatabaseReport struct {
+	Namespaces int
+	Records    int
+	Plaintext  int // registros anteriores al cifrado del store
+	Stale      int // registros con una versión anterior de la clave (ver ReencryptDatabase)
+	Unchecked  int // registros sin suma de comprobación (anteriores a store.ChecksumStore)
+	Problems   []store.BadRecord
+}
+
+// OK indica si no se ha encontrado ningún registro corrupto o manipulado.
+func (r DatabaseReport) OK() bool { return len(r.Problems) == 0 }
+
+// VerifyDatabase abre la base de datos indicada en 'cfg' y recorre todos los
+// namespaces comprobando la suma de comprobación y la etiqueta de
+// autenticación de cada registro y, además, el encadenamiento HMAC de la
+// auditoría. Como VerifyAudit, abre la base de datos en sólo lectura y hay
+// que ejecutarlo con el servidor parado.
+func VerifyDatabase(cfg Config) (DatabaseReport, error) {
+	ctx := context.Background()
+	var rep DatabaseReport
+	raw, err := store.OpenReadOnly(cfg.DBEngine, cfg.DBPath)
+	if err != nil {
+		return rep, fmt.Errorf("error abriendo base de datos: %v", err)
+	}
+	sums := store.NewChecksumStore(raw, nil)
+	db, err := encryptStore(cfg, sums)
+	if err != nil {
+		return rep, err
+	}
+	defer db.Close()
+
+	names, err := db.Namespaces(ctx)
+	if err != nil {
+		return rep, fmt.Errorf("error listando los namespaces: %v", err)
+	}
+	for _, ns := range names {
+		sr, err := sums.Verify(ctx, ns)
+		if err != nil {
+			return rep, fmt.Errorf("error verificando %s: %v", ns, err)
+		}
+		rep.Unchecked += sr.Unchecked
+		if len(sr.Problems) > 0 {
+			// Check se pararía en el primer registro dañado
+			rep.Namespaces++
+			rep.Records += sr.Records
+			rep.Problems = append(rep.Problems, sr.Problems...)
+			continue
+		}
+		r, err := db.Check(ctx, ns)
+		if err != nil {
+			return rep, fmt.Errorf("error verificando %s: %v", ns, err)
+		}
+		rep.Namespaces++
+		rep.Records += r.Records
+		rep.Plaintext += r.Plaintext
+		rep.Stale += r.Stale
+		rep.Problems = append(rep.Problems, r.Problems...)
+	}
+
+	l, err := audit.Open(ctx, db, crypto.DeriveKey(cfg.MasterKey, "audit"))
+	if err != nil {
+		return rep, err
+	}
+	ar, err := l.Verify(ctx)
+	if err != nil {
+		return rep, err
+	}
+	for _, p := range ar.Problems {
+		rep.Problems = append(rep.Problems, store.BadRecord{Namespace: audit.Namespace, Key: p.Key, Reason: p.Reason})
+	}
+	return rep, nil
+}
+
+// ReencryptDatabase pasa a la versión actual de su clave (cfg.KeyVersions)
+// los registros de 'namespaces' cifrados con una anterior y devuelve
+// cuántos ha reescrito. Los demás namespaces no se tocan. Hay que
+// ejecutarlo con el servidor parado.
+func ReencryptDatabase(cfg Config, namespaces []string) (int, error) {
+	ctx := context.Background()
+	db, err := openStore(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	total := 0
+	for _, ns := range namespaces {
+		n, err := db.Reencrypt(ctx, ns)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("error recifrando %s: %v", ns, err)
+		}
+	}
+	return total, nil
+}
+
+// sensitiveNamespaces son los namespaces con credenciales, secretos o
+// claves: DumpDatabase no muestra sus valores, aunque estén cifrados.
+// También usersNS, para que el volcado no diga quién tiene cuenta (ver
+// userKey).
+var sensitiveNamespaces = []string{
+	"auth", "srp", "opaque", "sessions", "totp", "recovery",
+	"webauthn", webauthnSessionsNS, "datakeys", usersNS,
+}
+
+// DumpDatabase escribe en 'w' el contenido de la base de datos de 'cfg' (de
+// todos los namespaces o sólo de 'namespaces') para depuración, ocultando
+// los valores de sensitiveNamespaces. Como VerifyAudit, abre la base de
+// datos en sólo lectura y hay que ejecutarlo con el servidor parado.
+func DumpDatabase(cfg Config, w io.Writer, namespaces []string) error {
+	ctx := context.Background()
+	db, err := store.OpenReadOnly(cfg.DBEngine, cfg.DBPath)
+	if err != nil {
+		return fmt.Errorf("error abriendo base de datos: %v", err)
+	}
+	defer db.Close()
+	return db.Dump(ctx, w, store.DumpOptions{Namespaces: namespaces, Redact: sensitiveNamespaces})
+}
+
+// CompactDatabase compacta la base de datos de 'cfg' (ver store.Compacter)
+// y devuelve su tamaño antes y después. Es el equivalente a adminCompact
+// con el servidor parado.
+func CompactDatabase(cfg Config) (before, after int64, err error) {
+	db, err := newStore(cfg)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error abriendo base de datos: %v", err)
+	}
+	defer db.Close()
+	c, ok := db.(store.Compacter)
+	if !ok {
+		return 0, 0, fmt.Errorf("el motor %s no necesita compactarse", cfg.DBEngine)
+	}
+	return c.Compact()
+}
+
+// DatabaseStats devuelve lo que ocupa cada namespace de la base de datos de
+// 'cfg' (ver store.Stats). Es el equivalente a adminStats con el servidor
+// parado; no descifra nada, así que no necesita la clave maestra.
+func DatabaseStats(cfg Config) (*api.DBStats, error) {
+	db, err := store.OpenReadOnly(cfg.DBEngine, cfg.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo base de datos: %v", err)
+	}
+	defer db.Close()
+	st, err := store.Stats(context.Background(), db)
+	if err != nil {
+		return nil, err
+	}
+	return dbStats(st), nil
+}
+
+// dbStats pasa 'st' al formato de la API.
+func dbStats(st store.StoreStats) *api.DBStats {
+	out := &api.DBStats{Keys: st.Keys, Bytes: st.Bytes, FileSize: st.FileSize}
+	if b := st.Bbolt; b != nil {
+		out.PageSize = b.PageSize
+		out.FreePages = b.FreePages + b.PendingPages
+		out.FreeBytes = b.FreeBytes
+	}
+	for _, ns := range st.Namespaces {
+		n := api.NamespaceStats{Namespace: ns.Namespace, Keys: ns.Keys, Bytes: ns.Bytes}
+		if p := ns.Pages; p != nil {
+			n.Pages = p.BranchPages + p.LeafPages + p.OverflowPages
+			n.Alloc = p.Alloc
+			n.Inuse = p.Inuse
+		}
+		out.Namespaces = append(out.Namespaces, n)
+	}
+	return out
+}
+
+// adminBackup guarda en s.snapDir una instantánea de la base de datos
+// tomada en caliente (Store.Backup) y devuelve su nombre en Data. Es una
+// copia del motor tal cual: los valores van cifrados con la clave maestra,
+// pero para sacarla de la máquina es mejor -backup, que la cifra con age.
+func (s *server) adminBackup(ctx context.Context, req api.Request) api.Response {
+	if err := os.MkdirAll(s.snapDir, 0o700); err != nil {
+		s.logf(ctx, "error creando el directorio de instantáneas: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al crear la instantánea"}
+	}
+	name := snapshotPrefix + time.Now().UTC().Format("20060102T150405.000000000Z") + snapshotSuffix
+	path := filepath.Join(s.snapDir, name)
+	tmp := path + ".tmp"
+	err := s.writeSnapshot(ctx, tmp)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		s.logf(ctx, "error creando la instantánea %s: %v", name, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al crear la instantánea"}
+	}
+	return api.Response{Success: true, Message: "Instantánea creada", Data: name}
+}
+
+// writeSnapshot escribe la copia de s.db en el fichero nuevo 'path'.
+func (s *server) writeSnapshot(ctx context.Context, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	err = s.db.Backup(ctx, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// adminRestore sustituye la base de datos por la instantánea de s.snapDir
+// que indica Data, sin parar el servidor (sólo con los motores que lo
+// permiten, ver store.Restorer). Las sesiones abiertas pasan a ser las de
+// la instantánea, y la auditoría sigue desde la última entrada de ésta.
+func (s *server) adminRestore(ctx context.Context, req api.Request) api.Response {
+	name := req.Data
+	if name != filepath.Base(name) || !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Nombre de instantánea no válido"}
+	}
+	rs, ok := s.db.(store.Restorer)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrNotSupported, Message: "El motor de la base de datos no permite restaurar en caliente"}
+	}
+	f, err := os.Open(filepath.Join(s.snapDir, name))
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "Instantánea no encontrada"}
+	}
+	defer f.Close()
+	if err := rs.Restore(f); err != nil {
+		s.logf(ctx, "error restaurando la instantánea %s: %v", name, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al restaurar la instantánea"}
+	}
+	if err := s.audit.Reload(ctx); err != nil {
+		s.logf(ctx, "error releyendo la auditoría tras restaurar %s: %v", name, err)
+	}
+	s.logf(ctx, "Base de datos restaurada desde %s por %s", name, req.Username)
+	return api.Response{Success: true, Message: "Instantánea restaurada"}
+}
+
+// adminCompact compacta la base de datos sin parar el servidor. Las
+// peticiones que lleguen mientras tanto esperan a que termine.
+func (s *server) adminCompact(ctx context.Context, req api.Request) api.Response {
+	c, ok := s.db.(store.Compacter)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrNotSupported, Message: "El motor de la base de datos no necesita compactarse"}
+	}
+	before, after, err := c.Compact()
+	if err != nil {
+		s.logf(ctx, "error compactando la base de datos: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al compactar la base de datos"}
+	}
+	s.logf(ctx, "Base de datos compactada por %s: %d -> %d bytes", req.Username, before, after)
+	return api.Response{Success: true, Message: fmt.Sprintf("Base de datos compactada: %d -> %d bytes", before, after)}
+}
+
+// adminStats devuelve en Stats lo que ocupa cada namespace de la base de
+// datos, para ver qué está haciendo crecer el fichero.
+func (s *server) adminStats(ctx context.Context, req api.Request) api.Response {
+	st, err := store.Stats(ctx, s.db)
+	if err != nil {
+		s.logf(ctx, "error calculando la ocupación de la base de datos: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al calcular la ocupación de la base de datos"}
+	}
+	return api.Response{Success: true, Message: fmt.Sprintf("Base de datos: %d entradas, %d bytes", st.Keys, st.Bytes), Stats: dbStats(st)}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"prac/pkg/api"
+)
+
+// negotiateVersion elige la versión del protocolo con la que se atiende una
+// petición que pide 'asked' (ver api.CurrentAPIVersion): sin versión, la 1;
+// si es más nueva que las que conocemos, la más alta que conocemos, para
+// que un cliente más nuevo que el servidor siga funcionando. Falla si es
+// más antigua que api.MinAPIVersion.
+func negotiateVersion(asked int) (int, bool) {
+	switch {
+	case asked == 0:
+		return api.APIVersion1, true
+	case asked < api.MinAPIVersion:
+		return 0, false
+	case asked > api.CurrentAPIVersion:
+		return api.CurrentAPIVersion, true
+	}
+	return asked, true
+}
+
+// dispatchVersion negocia la versión de 'req' y la atiende con el despacho
+// de esa versión. La respuesta dice con cuál se ha atendido.
+func (s *server) dispatchVersion(ctx context.Context, req api.Request) api.Response {
+	version, ok := negotiateVersion(req.APIVersion)
+	if !ok {
+		return api.Response{
+			APIVersion: api.MinAPIVersion,
+			Success:    false,
+			Code:       api.ErrUnsupportedVersion,
+			Message:    fmt.Sprintf("Versión del protocolo no soportada: %d (se aceptan de la %d a la %d)", req.APIVersion, api.MinAPIVersion, api.CurrentAPIVersion),
+		}
+	}
+	req.APIVersion = version
+	var res api.Response
+	switch version {
+	case api.APIVersion1:
+		res = s.dispatch(ctx, req)
+	case api.APIVersion2:
+		res = s.dispatchV2(ctx, req)
+	}
+	res.APIVersion = version
+	return res
+}
+
+// dispatchV2 atiende una petición de la versión 2: de ella sólo cuenta la
+// envoltura y el Payload (sin Payload, la acción va sin él, como "{}"), y
+// la respuesta lleva siempre Payload.
+func (s *server) dispatchV2(ctx context.Context, req api.Request) api.Response {
+	req = req.Envelope()
+	if len(req.Payload) == 0 {
+		req.Payload = json.RawMessage("{}")
+	}
+	return s.dispatch(ctx, req)
+}
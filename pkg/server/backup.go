@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// BackupDatabase escribe en 'path' una copia de la base de datos cifrada en
+// formato age, para los destinatarios de cfg.BackupRecipients o, si no hay,
+// con cfg.BackupPassphrase. La copia se puede descifrar con el CLI estándar de age
+// y restaurar con RestoreDatabase. Pensado para ejecutarse desde la línea de
+// comandos con el servidor parado (bbolt bloquea el fichero); la base de
+// datos se abre en sólo lectura. La copia no incluye la clave maestra: sin
+// ella los datos cifrados no se pueden leer.
+func BackupDatabase(cfg Config, path string) error {
+	ctx := context.Background()
+	recipients, err := crypto.ParseAgeRecipients(cfg.BackupRecipients)
+	if err != nil {
+		return err
+	}
+
+	db, err := store.OpenReadOnly(cfg.DBEngine, cfg.DBPath)
+	if err != nil {
+		return fmt.Errorf("error abriendo base de datos: %v", err)
+	}
+	defer db.Close()
+
+	// Escritura atómica: nunca dejamos una copia a medias con el nombre final
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creando el directorio de la copia: %v", err)
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creando la copia: %v", err)
+	}
+	err = writeBackup(ctx, f, db, recipients, cfg.BackupPassphrase)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("error escribiendo la copia: %v", err)
+	}
+	return nil
+}
+
+// writeBackup cifra la instantánea de 'db' en 'f'.
+func writeBackup(ctx context.Context, f *os.File, db store.Store, recipients []crypto.AgeRecipient, passphrase []byte) error {
+	w, err := crypto.NewAgeEncryptWriter(f, recipients, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := db.Backup(ctx, w); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// RestoreDatabase descifra la copia 'backupPath' en 'dst', que no debe
+// existir: nunca se sobrescribe una base de datos. Las claves privadas se
+// leen de 'identityFile' o, si está vacío, se usa 'passphrase'. Antes de
+// darla por buena se comprueba que el resultado se abre con el motor 'engine'.
+func RestoreDatabase(engine, backupPath, dst, identityFile string, passphrase []byte) error {
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%s ya existe; muévelo o elige otro destino", dst)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	src, err := os.Open(backupPath)
+	if err != nil {
+		return fmt.Errorf("error abriendo la copia: %v", err)
+	}
+	defer src.Close()
+
+	var ids io.Reader
+	if identityFile != "" {
+		idf, err := os.Open(identityFile)
+		if err != nil {
+			return fmt.Errorf("error abriendo el fichero de identidad: %v", err)
+		}
+		defer idf.Close()
+		ids = idf
+	}
+	plain, err := crypto.NewAgeDecryptReader(src, ids, passphrase)
+	if err != nil {
+		return err
+	}
+
+	// Redis no es un fichero: se carga directamente (y falla si ya tiene datos)
+	if engine == "redis" {
+		if err := store.Restore(engine, plain, dst); err != nil {
+			return fmt.Errorf("error restaurando la copia: %v", err)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o700); err != nil {
+		return fmt.Errorf("error creando el directorio de destino: %v", err)
+	}
+	tmp := dst + ".tmp"
+	os.RemoveAll(tmp) // restos de una restauración interrumpida
+	err = store.Restore(engine, plain, tmp)
+	if err == nil {
+		err = checkDatabase(engine, tmp)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("error restaurando la copia: %v", err)
+	}
+	return nil
+}
+
+// checkDatabase comprueba que 'path' es una base de datos válida para 'engine'.
+func checkDatabase(engine, path string) error {
+	db, err := store.NewStore(engine, path)
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
+
+// ExportDatabase escribe en 'path' todo el contenido de la base de datos en
+// JSON (ver store.ExportJSON) y devuelve cuántas entradas ha exportado. Los
+// valores salen como están guardados, cifrados con la clave maestra; sirve
+// para pasar los datos a otro motor con ImportDatabase. La base de datos se
+// abre en sólo lectura y, como con BackupDatabase, con el servidor parado.
+func ExportDatabase(cfg Config, path string) (int, error) {
+	ctx := context.Background()
+	db, err := store.OpenReadOnly(cfg.DBEngine, cfg.DBPath)
+	if err != nil {
+		return 0, fmt.Errorf("error abriendo base de datos: %v", err)
+	}
+	defer db.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return 0, fmt.Errorf("error creando el directorio de la exportación: %v", err)
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("error creando la exportación: %v", err)
+	}
+	n, err := store.ExportJSON(ctx, db, f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, fmt.Errorf("error escribiendo la exportación: %v", err)
+	}
+	return n, nil
+}
+
+// ImportDatabase carga en la base de datos de 'cfg' (con su motor, que
+// puede ser otro que el de la exportación) el fichero 'path' de
+// ExportDatabase y devuelve cuántas entradas ha importado. Para no mezclar
+// datos, la base de datos de destino tiene que estar vacía.
+func ImportDatabase(cfg Config, path string) (int, error) {
+	ctx := context.Background()
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("error abriendo la exportación: %v", err)
+	}
+	defer src.Close()
+
+	db, err := newStore(cfg)
+	if err != nil {
+		return 0, fmt.Errorf("error abriendo base de datos: %v", err)
+	}
+	defer db.Close()
+
+	names, err := db.Namespaces(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listando los namespaces: %v", err)
+	}
+	if len(names) > 0 {
+		return 0, fmt.Errorf("la base de datos %s no está vacía", cfg.DBPath)
+	}
+	n, err := store.ImportJSON(ctx, db, src)
+	if err != nil {
+		return n, fmt.Errorf("error importando %s: %v", path, err)
+	}
+	return n, nil
+}
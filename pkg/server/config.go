@@ -0,0 +1,481 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"prac/pkg/crypto"
+	"prac/pkg/keyprovider"
+	"prac/pkg/store"
+)
+
+// Variables de entorno que configuran el servidor.
+const (
+	envPepper        = "PRAC_PEPPER"            // pepper en claro (útil en desarrollo)
+	envPepperFile    = "PRAC_PEPPER_FILE"       // ruta a un fichero con el pepper
+	envKeyFile       = "PRAC_KEYFILE"           // ruta al fichero de clave maestra
+	envKeyPassphrase = "PRAC_KEY_PASSPHRASE"    // frase de paso (modo no interactivo)
+	envEnableOPAQUE  = "PRAC_ENABLE_OPAQUE"     // "1" o "true" activa el login OPAQUE
+	envEnableMetrics = "PRAC_ENABLE_METRICS"    // "1" o "true" publica /metrics (formato Prometheus)
+	envEnableCSRF    = "PRAC_ENABLE_CSRF"       // "1" o "true" exige el token CSRF (clientes de navegador)
+	envSealFile      = "PRAC_SEALFILE"          // ruta al fichero de sellado (Shamir)
+	envUnsealShares  = "PRAC_UNSEAL_SHARES"     // fragmentos separados por comas (modo no interactivo)
+	envBackupTo      = "PRAC_BACKUP_RECIPIENTS" // destinatarios age de las copias, separados por comas
+	envBackupPass    = "PRAC_BACKUP_PASSPHRASE" // frase de paso de las copias (modo no interactivo)
+	envPKCS11Module  = "PRAC_PKCS11_MODULE"     // biblioteca PKCS#11: si se define, la clave maestra se envuelve en el HSM
+	envPKCS11Token   = "PRAC_PKCS11_TOKEN"      // etiqueta del token
+	envPKCS11PIN     = "PRAC_PKCS11_PIN"        // PIN de usuario (modo no interactivo)
+	envPKCS11Key     = "PRAC_PKCS11_KEY"        // etiqueta de la clave AES en el token
+	envWrappedKey    = "PRAC_WRAPPED_KEYFILE"   // ruta de la clave maestra envuelta por el HSM
+	envVaultAddr     = "PRAC_VAULT_ADDR"        // dirección de Vault: si se define, la clave maestra la custodia transit
+	envVaultToken    = "PRAC_VAULT_TOKEN"       // token de Vault (si no, VAULT_TOKEN)
+	envVaultNS       = "PRAC_VAULT_NAMESPACE"   // namespace de Vault (si no, VAULT_NAMESPACE)
+	envVaultMount    = "PRAC_VAULT_MOUNT"       // punto de montaje de transit
+	envVaultKey      = "PRAC_VAULT_KEY"         // nombre de la clave en transit
+	envVaultCACert   = "PRAC_VAULT_CACERT"      // CA de Vault (si no, VAULT_CACERT)
+	envKMSKeyFile    = "PRAC_KMS_KEYFILE"       // ruta de la clave maestra cifrada por el KMS
+	envCiphers       = "PRAC_CIPHERS"           // algoritmo por namespace del store: "ns=aes-gcm-siv,..."
+	envKeyVersions   = "PRAC_KEY_VERSIONS"      // versión de la clave por namespace del store: "ns=2,..." (ver -reencrypt)
+	envMaxPwAge      = "PRAC_MAX_PASSWORD_AGE"  // días de validez de una contraseña (0 o vacío: no caducan)
+	envArgon2File    = "PRAC_ARGON2_FILE"       // parámetros Argon2 calibrados (ver -calibrate)
+	envDBEngine      = "PRAC_DB_ENGINE"         // motor de la base de datos: "bbolt" (por defecto), "sqlite", "badger", "leveldb", "redis", "s3" o "json"
+	envDBPath        = "PRAC_DB_PATH"           // fichero o directorio de la base de datos (con redis, su URL)
+	envBboltNoSync   = "PRAC_BBOLT_NOSYNC"      // "1" o "true": bbolt no espera al disco en cada escritura (sólo pruebas)
+	envBboltTimeout  = "PRAC_BBOLT_TIMEOUT"     // espera máxima al bloqueo del fichero bbolt (p. ej. "10s"; negativa: sin límite)
+	envMirrorEngine  = "PRAC_DB_MIRROR_ENGINE"  // motor de una réplica de la base de datos (vacío: sin réplica)
+	envMirrorPath    = "PRAC_DB_MIRROR_PATH"    // fichero, directorio o URL de la réplica
+	envJWTAlg        = "PRAC_JWT_ALG"           // firma de los tokens de sesión: "HS256" (por defecto) o "RS256"
+	envJWTKeyFile    = "PRAC_JWT_KEYFILE"       // clave privada RSA para RS256 (la pública, en el mismo nombre + ".pub")
+	envSessionTTL    = "PRAC_SESSION_TTL"       // validez de los tokens de sesión (p. ej. "5m", "30m")
+	envRefreshTTL    = "PRAC_REFRESH_TTL"       // cuánto dura una sesión sin usar su token de refresco (p. ej. "24h", "720h")
+	envAdmins        = "PRAC_ADMINS"            // usuarios administradores, separados por comas
+	envSnapshotDir   = "PRAC_SNAPSHOT_DIR"      // directorio de las instantáneas de adminBackup
+	envCompressMin   = "PRAC_COMPRESS_MIN"      // bytes a partir de los que se comprimen los valores del store (0 o vacío: nunca)
+	envTrashDays     = "PRAC_TRASH_RETENTION"   // días que se guarda lo borrado con store.DeleteSoft antes de eliminarlo
+	envGRPCAddr      = "PRAC_GRPC_ADDR"         // dirección de escucha del servicio gRPC (vacío: no se sirve)
+	envTLSCert       = "PRAC_TLS_CERT"          // certificado TLS del servidor (PEM); con PRAC_TLS_KEY, se sirve HTTPS
+	envTLSKey        = "PRAC_TLS_KEY"           // clave privada del certificado TLS (PEM)
+	envTLSDir        = "PRAC_TLS_DIR"           // sin PRAC_TLS_CERT: directorio donde se genera la PKI del proyecto para servir HTTPS
+	envMTLS          = "PRAC_MTLS"              // certificados de cliente: "optional" (login con certificado) o "required" (además, obligatorios)
+	envTLSClientCA   = "PRAC_TLS_CLIENT_CA"     // CA de los certificados de cliente (por defecto, la de PRAC_TLS_DIR)
+	envGzipMin       = "PRAC_GZIP_MIN"          // bytes a partir de los que se comprimen con gzip las respuestas HTTP (0: nunca)
+	envRateLimit     = "PRAC_RATE_LIMIT"        // peticiones por segundo de cada IP (0: sin límite)
+	envLoginLimit    = "PRAC_LOGIN_RATE_LIMIT"  // intentos de inicio de sesión por minuto de cada IP y usuario (0: sin límite)
+)
+
+// Config agrupa la configuración del servidor que no vive en la base de datos.
+type Config struct {
+	DBPath        string   // fichero de la base de datos (directorio con badger, leveldb o json, URL con redis o s3)
+	DBEngine      string   // motor de la base de datos (ver store.NewStore)
+	MirrorEngine  string   // motor de la réplica (ver store.MirrorStore; vacío: ninguna)
+	MirrorPath    string   // fichero, directorio o URL de la réplica
+	Addr          string   // dirección de escucha HTTP
+	GRPCAddr      string   // dirección de escucha gRPC (vacío: sin gRPC)
+	TLSCert       string   // certificado TLS del servidor (vacío: sin TLS, salvo con TLSDir)
+	TLSKey        string   // clave privada de TLSCert
+	TLSDir        string   // directorio de la PKI generada (tlsutil.EnsureCertificates) si no hay TLSCert
+	MTLS          string   // certificados de cliente: MTLSOptional, MTLSRequired o vacío (no se piden)
+	TLSClientCA   string   // CA de los certificados de cliente (vacío: la de TLSDir)
+	Pepper        []byte   // pepper global para los hashes de contraseña (opcional)
+	KeyFile       string   // fichero con la clave maestra protegida por frase de paso
+	KeyPassphrase []byte   // frase de paso del fichero de clave (si no, se pregunta)
+	EnableOPAQUE  bool     // acepta las acciones de registro/login OPAQUE
+	EnableMetrics bool     // publica las cifras del store en /metrics
+	EnableCSRF    bool     // exige el token CSRF en las peticiones que cambian algo (ver withCSRF)
+	SealFile      string   // si existe, la clave maestra se reconstruye con fragmentos
+	UnsealShares  []string // fragmentos en hexadecimal (si no, se preguntan)
+
+	Bbolt store.BboltOptions // apertura del fichero con el motor bbolt (permisos, espera al bloqueo, NoSync)
+
+	BackupRecipients []string // claves "age1..." o ficheros de destinatarios para las copias
+	BackupPassphrase []byte   // frase de paso de las copias si no hay destinatarios
+
+	PKCS11         keyprovider.PKCS11Config // HSM que envuelve la clave maestra (si Module no está vacío)
+	WrappedKeyFile string                   // clave maestra envuelta por el HSM
+
+	Vault      keyprovider.VaultConfig // KMS que custodia la clave maestra (si Addr no está vacío)
+	KMSKeyFile string                  // clave maestra cifrada por el KMS
+
+	Ciphers        crypto.CipherPolicy // algoritmo con el que se cifra cada namespace del store
+	KeyVersions    map[string]int      // versión de la clave de cada namespace del store (por defecto, 1)
+	CompressMin    int                 // tamaño mínimo de los valores que se comprimen antes de cifrar (0: ninguno)
+	GzipMin        int                 // tamaño mínimo de las respuestas HTTP que se comprimen con gzip (0: ninguna)
+	RateLimit      int                 // peticiones por segundo de cada IP, con ráfagas del doble (0: sin límite; ver withRateLimit)
+	LoginRateLimit int                 // intentos de inicio de sesión por minuto de cada IP y usuario (0: sin límite)
+	MaxPasswordAge time.Duration       // pasado este tiempo, el login pide cambiar la contraseña
+	TrashRetention time.Duration       // cuánto se puede recuperar lo borrado con store.DeleteSoft
+
+	Argon2     crypto.Argon2Params // coste de los hashes de contraseña nuevos
+	Argon2File string              // de dónde se leen los parámetros calibrados
+
+	JWTAlg     string        // algoritmo de los tokens de sesión (crypto.JWTHS256 o crypto.JWTRS256)
+	JWTKeyFile string        // clave RSA de los tokens con RS256
+	SessionTTL time.Duration // validez de un token de sesión (de acceso)
+	RefreshTTL time.Duration // validez de un token de refresco: la sesión se cierra si no se renueva antes
+
+	Admins      []string // usuarios con rol de administrador (acciones admin*)
+	SnapshotDir string   // dónde guardan y buscan las instantáneas adminBackup y adminRestore
+
+	// MasterKey es la clave maestra ya descifrada (ver UnlockMasterKey).
+	MasterKey []byte
+}
+
+// DefaultConfig devuelve la configuración por defecto.
+func DefaultConfig() Config {
+	return Config{
+		DBPath:   "data/server.db",
+		DBEngine: "bbolt",
+		Addr:     ":8080",
+		KeyFile:  "data/master.key",
+		SealFile: "data/master.seal",
+
+		PKCS11:         keyprovider.PKCS11Config{KeyLabel: "prac-master"},
+		WrappedKeyFile: "data/master.wrapped",
+
+		Vault:      keyprovider.VaultConfig{Mount: "transit", Key: "prac-master"},
+		KMSKeyFile: "data/master.kms",
+
+		Argon2:     crypto.DefaultArgon2Params,
+		Argon2File: "data/argon2.json",
+
+		JWTAlg:     crypto.JWTHS256,
+		JWTKeyFile: "data/jwt.key",
+		SessionTTL: 15 * time.Minute,
+		RefreshTTL: 7 * 24 * time.Hour,
+
+		GzipMin: 1024,
+
+		RateLimit:      20,
+		LoginRateLimit: 10,
+
+		SnapshotDir: "data/snapshots",
+
+		TrashRetention: 30 * 24 * time.Hour,
+	}
+}
+
+// LoadConfig parte de DefaultConfig y aplica las variables de entorno.
+// El pepper se lee de PRAC_PEPPER_FILE o de PRAC_PEPPER (no ambos), de
+// forma que nunca se almacene en el mismo sitio que la base de datos.
+func LoadConfig() (Config, error) {
+	cfg := DefaultConfig()
+
+	pepper, pepperFile := os.Getenv(envPepper), os.Getenv(envPepperFile)
+	switch {
+	case pepper != "" && pepperFile != "":
+		return cfg, fmt.Errorf("definir sólo una de %s o %s", envPepper, envPepperFile)
+	case pepperFile != "":
+		raw, err := os.ReadFile(pepperFile)
+		if err != nil {
+			return cfg, fmt.Errorf("error leyendo el pepper: %v", err)
+		}
+		cfg.Pepper = []byte(strings.TrimSpace(string(raw)))
+		if len(cfg.Pepper) == 0 {
+			return cfg, fmt.Errorf("el fichero de pepper %s está vacío", pepperFile)
+		}
+	case pepper != "":
+		cfg.Pepper = []byte(pepper)
+	}
+
+	if path := os.Getenv(envKeyFile); path != "" {
+		cfg.KeyFile = path
+	}
+	if pass := os.Getenv(envKeyPassphrase); pass != "" {
+		cfg.KeyPassphrase = []byte(pass)
+	}
+	if path := os.Getenv(envSealFile); path != "" {
+		cfg.SealFile = path
+	}
+	if shares := os.Getenv(envUnsealShares); shares != "" {
+		cfg.UnsealShares = strings.Split(shares, ",")
+	}
+	if to := os.Getenv(envBackupTo); to != "" {
+		cfg.BackupRecipients = strings.Split(to, ",")
+	}
+	if pass := os.Getenv(envBackupPass); pass != "" {
+		cfg.BackupPassphrase = []byte(pass)
+	}
+	cfg.PKCS11.Module = os.Getenv(envPKCS11Module)
+	cfg.PKCS11.Token = os.Getenv(envPKCS11Token)
+	cfg.PKCS11.PIN = os.Getenv(envPKCS11PIN)
+	if label := os.Getenv(envPKCS11Key); label != "" {
+		cfg.PKCS11.KeyLabel = label
+	}
+	if path := os.Getenv(envWrappedKey); path != "" {
+		cfg.WrappedKeyFile = path
+	}
+	cfg.Vault.Addr = os.Getenv(envVaultAddr)
+	cfg.Vault.Token = envOr(envVaultToken, "VAULT_TOKEN")
+	cfg.Vault.Namespace = envOr(envVaultNS, "VAULT_NAMESPACE")
+	cfg.Vault.CACert = envOr(envVaultCACert, "VAULT_CACERT")
+	if mount := os.Getenv(envVaultMount); mount != "" {
+		cfg.Vault.Mount = mount
+	}
+	if key := os.Getenv(envVaultKey); key != "" {
+		cfg.Vault.Key = key
+	}
+	if path := os.Getenv(envKMSKeyFile); path != "" {
+		cfg.KMSKeyFile = path
+	}
+	if spec := os.Getenv(envCiphers); spec != "" {
+		policy, err := crypto.ParseCipherPolicy(spec)
+		if err != nil {
+			return cfg, fmt.Errorf("valor no válido para %s: %v", envCiphers, err)
+		}
+		cfg.Ciphers = policy
+	}
+	if spec := os.Getenv(envKeyVersions); spec != "" {
+		versions, err := parseKeyVersions(spec)
+		if err != nil {
+			return cfg, fmt.Errorf("valor no válido para %s: %v", envKeyVersions, err)
+		}
+		cfg.KeyVersions = versions
+	}
+	if cfg.Vault.Addr != "" && cfg.PKCS11.Module != "" {
+		return cfg, fmt.Errorf("definir sólo uno de %s o %s", envVaultAddr, envPKCS11Module)
+	}
+	if path := os.Getenv(envArgon2File); path != "" {
+		cfg.Argon2File = path
+	}
+	argon2Params, err := crypto.LoadArgon2Params(cfg.Argon2File)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Argon2 = argon2Params
+	if v := os.Getenv(envMaxPwAge); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			return cfg, fmt.Errorf("valor no válido para %s: %q (número de días)", envMaxPwAge, v)
+		}
+		cfg.MaxPasswordAge = time.Duration(days) * 24 * time.Hour
+	}
+	if v := os.Getenv(envTrashDays); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 {
+			return cfg, fmt.Errorf("valor no válido para %s: %q (número de días)", envTrashDays, v)
+		}
+		cfg.TrashRetention = time.Duration(days) * 24 * time.Hour
+	}
+	if v := os.Getenv(envCompressMin); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("valor no válido para %s: %q (bytes)", envCompressMin, v)
+		}
+		cfg.CompressMin = n
+	}
+	if v := os.Getenv(envGzipMin); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("valor no válido para %s: %q (bytes)", envGzipMin, v)
+		}
+		cfg.GzipMin = n
+	}
+	if v := os.Getenv(envRateLimit); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("valor no válido para %s: %q (peticiones por segundo)", envRateLimit, v)
+		}
+		cfg.RateLimit = n
+	}
+	if v := os.Getenv(envLoginLimit); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, fmt.Errorf("valor no válido para %s: %q (intentos por minuto)", envLoginLimit, v)
+		}
+		cfg.LoginRateLimit = n
+	}
+	if engine := os.Getenv(envDBEngine); engine != "" {
+		cfg.DBEngine = engine
+	}
+	if path := os.Getenv(envDBPath); path != "" {
+		cfg.DBPath = path
+	}
+	if v := os.Getenv(envBboltNoSync); v != "" {
+		noSync, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("valor no válido para %s: %q", envBboltNoSync, v)
+		}
+		cfg.Bbolt.NoSync = noSync
+	}
+	if v := os.Getenv(envBboltTimeout); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("valor no válido para %s: %q", envBboltTimeout, v)
+		}
+		cfg.Bbolt.Timeout = timeout
+	}
+	if engine := os.Getenv(envMirrorEngine); engine != "" {
+		cfg.MirrorEngine = engine
+		cfg.MirrorPath = os.Getenv(envMirrorPath)
+		if cfg.MirrorPath == "" {
+			return cfg, fmt.Errorf("falta %s para la réplica de %s", envMirrorPath, envMirrorEngine)
+		}
+	}
+	if alg := os.Getenv(envJWTAlg); alg != "" {
+		if alg != crypto.JWTHS256 && alg != crypto.JWTRS256 {
+			return cfg, fmt.Errorf("valor no válido para %s: %q (HS256 o RS256)", envJWTAlg, alg)
+		}
+		cfg.JWTAlg = alg
+	}
+	if path := os.Getenv(envJWTKeyFile); path != "" {
+		cfg.JWTKeyFile = path
+	}
+	if v := os.Getenv(envSessionTTL); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return cfg, fmt.Errorf("valor no válido para %s: %q", envSessionTTL, v)
+		}
+		cfg.SessionTTL = ttl
+	}
+	if v := os.Getenv(envRefreshTTL); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			return cfg, fmt.Errorf("valor no válido para %s: %q", envRefreshTTL, v)
+		}
+		cfg.RefreshTTL = ttl
+	}
+	if cfg.RefreshTTL < cfg.SessionTTL {
+		return cfg, fmt.Errorf("%s no puede ser menor que %s", envRefreshTTL, envSessionTTL)
+	}
+	if admins := os.Getenv(envAdmins); admins != "" {
+		cfg.Admins = strings.Split(admins, ",")
+	}
+	if dir := os.Getenv(envSnapshotDir); dir != "" {
+		cfg.SnapshotDir = dir
+	}
+	cfg.GRPCAddr = os.Getenv(envGRPCAddr)
+	cfg.TLSCert, cfg.TLSKey, cfg.TLSDir = os.Getenv(envTLSCert), os.Getenv(envTLSKey), os.Getenv(envTLSDir)
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return cfg, fmt.Errorf("hay que definir a la vez %s y %s", envTLSCert, envTLSKey)
+	}
+	cfg.TLSClientCA = os.Getenv(envTLSClientCA)
+	if mode := os.Getenv(envMTLS); mode != "" {
+		if mode != MTLSOptional && mode != MTLSRequired {
+			return cfg, fmt.Errorf("valor no válido para %s: %q (%s o %s)", envMTLS, mode, MTLSOptional, MTLSRequired)
+		}
+		if cfg.TLSCert == "" && cfg.TLSDir == "" {
+			return cfg, fmt.Errorf("%s necesita TLS (%s o %s)", envMTLS, envTLSCert, envTLSDir)
+		}
+		if cfg.TLSClientCA == "" && cfg.TLSDir == "" {
+			return cfg, fmt.Errorf("%s necesita la CA de los clientes (%s o %s)", envMTLS, envTLSClientCA, envTLSDir)
+		}
+		cfg.MTLS = mode
+	}
+	if v := os.Getenv(envEnableMetrics); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("valor no válido para %s: %q", envEnableMetrics, v)
+		}
+		cfg.EnableMetrics = enabled
+	}
+	if v := os.Getenv(envEnableCSRF); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("valor no válido para %s: %q", envEnableCSRF, v)
+		}
+		cfg.EnableCSRF = enabled
+	}
+	if v := os.Getenv(envEnableOPAQUE); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("valor no válido para %s: %q", envEnableOPAQUE, v)
+		}
+		cfg.EnableOPAQUE = enabled
+	}
+	return cfg, nil
+}
+
+// envOr devuelve la variable 'name' o, si está vacía, la estándar 'fallback'
+// (p. ej. VAULT_TOKEN), para reutilizar la configuración del CLI de Vault.
+func envOr(name, fallback string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return os.Getenv(fallback)
+}
+
+// UnlockMasterKey abre el fichero de clave (o lo crea en el primer arranque)
+// y deja la clave maestra en cfg.MasterKey. La frase de paso se toma de
+// cfg.KeyPassphrase o, si está vacía, se pide mediante 'prompt'; si 'prompt'
+// es nil (ejecución no interactiva) y no hay frase de paso, devuelve error.
+//
+// Si existe el fichero de sellado (ver SplitMasterKey), la clave no se toma
+// del fichero de clave sino que se reconstruye a partir de los fragmentos.
+// Si se ha configurado un HSM (PRAC_PKCS11_MODULE) o Vault (PRAC_VAULT_ADDR),
+// la clave se obtiene de ellos (ver unlockWithHSM y unlockWithKMS).
+func (cfg *Config) UnlockMasterKey(prompt func(string) []byte) error {
+	sf, err := readSealFile(cfg.SealFile)
+	if err != nil {
+		return err
+	}
+	if sf != nil {
+		return cfg.unseal(sf, prompt)
+	}
+	if cfg.PKCS11.Module != "" {
+		return cfg.unlockWithHSM(prompt)
+	}
+	if cfg.Vault.Addr != "" {
+		return cfg.unlockWithKMS(prompt)
+	}
+	return cfg.unlockKeyFile(prompt)
+}
+
+// unlockKeyFile abre (o crea) el fichero de clave protegido por frase de paso.
+func (cfg *Config) unlockKeyFile(prompt func(string) []byte) error {
+	_, err := os.Stat(cfg.KeyFile)
+	firstRun := errors.Is(err, os.ErrNotExist)
+	if err != nil && !firstRun {
+		return fmt.Errorf("error accediendo al fichero de clave: %v", err)
+	}
+
+	pass := cfg.KeyPassphrase
+	if len(pass) == 0 {
+		defer func() { crypto.Wipe(pass) }() // la frase pedida es nuestra
+		if prompt == nil {
+			return fmt.Errorf("se necesita la frase de paso del fichero de clave (%s)", envKeyPassphrase)
+		}
+		if firstRun {
+			pass = prompt("Nueva frase de paso para la clave maestra")
+			again := prompt("Repite la frase de paso")
+			defer crypto.Wipe(again)
+			if !bytes.Equal(pass, again) {
+				return errors.New("las frases de paso no coinciden")
+			}
+		} else {
+			pass = prompt("Frase de paso de la clave maestra")
+		}
+	}
+
+	if firstRun {
+		cfg.MasterKey, err = crypto.CreateKeyFile(cfg.KeyFile, pass)
+	} else {
+		cfg.MasterKey, err = crypto.OpenKeyFile(cfg.KeyFile, pass)
+	}
+	return err
+}
+
+// parseKeyVersions interpreta una lista "ns=versión,ns=versión".
+func parseKeyVersions(spec string) (map[string]int, error) {
+	versions := make(map[string]int)
+	for _, item := range strings.Split(spec, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		ns, v, ok := strings.Cut(item, "=")
+		ns = strings.TrimSpace(ns)
+		if !ok || ns == "" {
+			return nil, fmt.Errorf("entrada no válida: %q", item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("versión de clave no válida para %s: %q", ns, v)
+		}
+		versions[ns] = n
+	}
+	return versions, nil
+}
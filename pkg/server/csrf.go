@@ -0,0 +1,55 @@
+package server
+
+import (
+	"net/http"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+)
+
+// withCSRF protege de CSRF a los clientes de navegador con el doble envío
+// de api.CSRFCookie: a quien no trae la cookie se le da una con un token
+// nuevo, y las peticiones que cambian algo (las que no son csrfSafe) sólo
+// pasan si repiten su valor en api.CSRFHeader. Sin 'enabled' no hace nada:
+// el cliente de línea de comandos no usa cookies, así que no le hace falta.
+func withCSRF(enabled bool, next http.Handler) http.Handler {
+	if !enabled {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := ""
+		if c, err := r.Cookie(api.CSRFCookie); err == nil {
+			token = c.Value
+		}
+		if token == "" {
+			fresh, err := crypto.GenerateToken()
+			if err != nil {
+				writeResponse(w, r, http.StatusInternalServerError, api.Response{Success: false, Code: api.ErrInternal, Message: "Error al generar el token CSRF"})
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     api.CSRFCookie,
+				Value:    fresh,
+				Path:     "/",
+				Secure:   r.TLS != nil,
+				HttpOnly: false, // el JavaScript de la web tiene que leerla para la cabecera
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		if !csrfSafe(r.Method) && (token == "" || !crypto.TokensEqual(r.Header.Get(api.CSRFHeader), token)) {
+			writeResponse(w, r, http.StatusForbidden, api.Response{Success: false, Code: api.ErrCSRF, Message: "Falta el token CSRF o no coincide con la cookie"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfSafe indica si 'method' es de los que no cambian nada y no necesitan
+// el token CSRF. El canal de avisos (api.EventsPath) es un GET.
+func csrfSafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"prac/pkg/api"
+)
+
+// actionEvents es la acción con la que la apertura del canal de avisos
+// queda en la auditoría.
+const actionEvents = "events"
+
+const (
+	pushBuffer       = 16               // avisos pendientes por conexión; los que no caben se pierden
+	pushPing         = 30 * time.Second // cada cuánto se comprueba que la conexión sigue viva
+	pushWriteTimeout = 10 * time.Second // espera máxima al enviar un aviso o un ping
+)
+
+// pushUpgrader abre los WebSocket de api.EventsPath. Con la comprobación
+// de origen por defecto, un navegador no puede abrirlo desde otra web.
+var pushUpgrader = websocket.Upgrader{}
+
+// pushHub reparte los avisos (api.Event) entre las conexiones abiertas en
+// api.EventsPath de cada usuario. Sólo vive en memoria: quien no está
+// conectado cuando se publica un aviso no lo recibe.
+type pushHub struct {
+	mu   sync.Mutex
+	subs map[string]map[*pushSub]struct{} // por usuario
+}
+
+// pushSub es una conexión suscrita a los avisos de su usuario.
+type pushSub struct {
+	session string // identificador de la sesión (jti del token)
+	ch      chan api.Event
+}
+
+func newPushHub() *pushHub {
+	return &pushHub{subs: make(map[string]map[*pushSub]struct{})}
+}
+
+// subscribe suscribe la sesión 'session' de 'username' a sus avisos y
+// devuelve la suscripción y la función que la termina.
+func (h *pushHub) subscribe(username, session string) (*pushSub, func()) {
+	sub := &pushSub{session: session, ch: make(chan api.Event, pushBuffer)}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[username] == nil {
+		h.subs[username] = make(map[*pushSub]struct{})
+	}
+	h.subs[username][sub] = struct{}{}
+	return sub, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[username], sub)
+		if len(h.subs[username]) == 0 {
+			delete(h.subs, username)
+		}
+	}
+}
+
+// publish envía 'ev' a las conexiones de 'username', salvo a las de la
+// sesión 'from' (la que ha provocado el aviso; vacío: a todas). No espera a
+// nadie: si una conexión tiene pushBuffer avisos sin enviar, éste se pierde.
+func (h *pushHub) publish(username, from string, ev api.Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs[username] {
+		if from != "" && sub.session == from {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+}
+
+// sessionID devuelve el identificador de la sesión de 'token', o "" si el
+// token no es válido.
+func (s *server) sessionID(token string) string {
+	claims, err := s.jwt.Verify(token, time.Now())
+	if err != nil {
+		return ""
+	}
+	return claims.ID
+}
+
+// eventsHandler sirve api.EventsPath: abre el WebSocket de una sesión
+// válida y le envía sus avisos hasta que el cliente lo cierra. Además de
+// los que publican los handlers (s.push), vigila la entrada de la sesión en
+// sessionsNS: si cambia y la sesión se ha cerrado (logout, logoutAll), o si
+// caduca sin renovarse, envía EventLogout y cierra. Que caduque el token no
+// basta: con refresh, la sesión sigue con otro.
+func (s *server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var req api.Request
+	if !s.bearerSession(ctx, r, &req) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeResponse(w, r, http.StatusUnauthorized, api.Response{Success: false, Code: api.ErrTokenExpired, Message: "Token inválido o sesión expirada"})
+		return
+	}
+	claims, err := s.jwt.Verify(req.Token, time.Now())
+	if err != nil {
+		writeResponse(w, r, http.StatusUnauthorized, api.Response{Success: false, Code: api.ErrTokenExpired, Message: "Token inválido o sesión expirada"})
+		return
+	}
+	conn, err := pushUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade ya ha respondido con el error
+	}
+	defer conn.Close()
+	req.Action = actionEvents
+	s.record(ctx, req, api.Response{Success: true, Message: "Canal de avisos abierto"})
+
+	sub, unsubscribe := s.push.subscribe(req.Username, claims.ID)
+	defer unsubscribe()
+	key := s.sessionEntry(req.Username, claims.ID)
+	sessions, cancelWatch := s.watch.Watch(sessionsNS, key)
+	defer func() { cancelWatch() }()
+	expiry := time.NewTimer(time.Until(time.Unix(claims.Expiry, 0)))
+	defer expiry.Stop()
+	ping := time.NewTicker(pushPing)
+	defer ping.Stop()
+
+	// El canal va en un solo sentido: leemos sólo para enterarnos de que
+	// el cliente se ha ido (y para que se atiendan sus pings y su cierre)
+	gone := make(chan struct{})
+	go func() {
+		defer close(gone)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(ev api.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(pushWriteTimeout))
+		return conn.WriteJSON(ev)
+	}
+	logout := func(msg string) {
+		if send(api.Event{Type: api.EventLogout, Time: time.Now(), Message: msg}) == nil {
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(pushWriteTimeout))
+		}
+	}
+	for {
+		select {
+		case ev := <-sub.ch:
+			if send(ev) != nil {
+				return
+			}
+		case _, ok := <-sessions:
+			if !ok {
+				// Se han perdido cambios: volvemos a suscribirnos y
+				// comprobamos la sesión igualmente
+				cancelWatch()
+				sessions, cancelWatch = s.watch.Watch(sessionsNS, key)
+			}
+			if !s.certAllows(ctx, req.Username) || !s.sessionOpen(ctx, req.Username, claims.ID) {
+				logout("La sesión se ha cerrado")
+				return
+			}
+		case <-expiry.C:
+			// Las sesiones que caducan no avisan a Watch
+			if !s.sessionOpen(ctx, req.Username, claims.ID) {
+				logout("La sesión ha caducado")
+				return
+			}
+			expiry.Reset(s.tokenTTL)
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pushWriteTimeout)) != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
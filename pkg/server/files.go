@@ -0,0 +1,345 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/store"
+)
+
+// filesNS es el namespace padre de los ficheros: el de cada usuario cuelga
+// de él con su userKey (ver filesNamespace) y guarda un fileRecord por
+// fichero, con clave fileKey(nombre). Los trozos de cada fichero van en su
+// propio namespace, anidado bajo el "chunks" del usuario (ver
+// chunksNamespace; no puede llamarse como la clave del fichero, porque en
+// bbolt un namespace anidado ocupa una clave del padre), con el número de
+// trozo (4 bytes big endian) como clave. Así DeleteNamespace se lleva un
+// fichero o todos los del usuario de una vez.
+const filesNS = "files"
+
+const (
+	maxChunkSize   = 1 << 20  // bytes de un trozo, ya decodificado
+	maxFileSize    = 64 << 20 // bytes de un fichero entero
+	maxFileChunks  = 4096     // trozos de un fichero
+	maxFileName    = 255      // longitud máxima del nombre de un fichero
+	maxFilesByUser = 100      // ficheros que puede tener un usuario
+)
+
+// fileRecord es lo que se guarda de cada fichero: lo que declaró el
+// cliente en el trozo 0 y cuánto ha llegado hasta ahora.
+type fileRecord struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Hash     string    `json:"hash"`
+	Chunks   int       `json:"chunks"`
+	Received int       `json:"received"` // trozos recibidos (siempre los primeros)
+	Bytes    int64     `json:"bytes"`    // bytes recibidos
+	Complete bool      `json:"complete,omitempty"`
+	Created  time.Time `json:"created"`
+
+	SharedWith []string `json:"sharedWith,omitempty"` // usuarios que pueden descargarlo (ver shareData)
+}
+
+func (f fileRecord) info() *api.FileInfo {
+	return &api.FileInfo{Name: f.Name, Size: f.Size, Hash: f.Hash, Chunks: f.Chunks, Complete: f.Complete}
+}
+
+// filesNamespace devuelve el namespace de los ficheros de 'username'.
+func (s *server) filesNamespace(username string) string {
+	return filesNS + store.NamespaceSep + string(s.userKey(username))
+}
+
+// chunksNamespace devuelve el namespace de los trozos del fichero 'name' de
+// 'username'.
+func (s *server) chunksNamespace(username, name string) string {
+	return s.filesNamespace(username) + store.NamespaceSep + "chunks" + store.NamespaceSep + string(s.fileKey(name))
+}
+
+// fileKey devuelve la clave de un fichero. Como las de los usuarios, es un
+// HMAC del nombre, que así no queda a la vista en los namespaces.
+func (s *server) fileKey(name string) []byte {
+	return hashUsername(s.userMAC, name)
+}
+
+// getFile lee (a través de 'tx') el fichero 'name' de 'username'. Si no
+// existe, el error es store.ErrNotFound.
+func (s *server) getFile(tx store.Tx, username, name string) (fileRecord, error) {
+	var rec fileRecord
+	raw, err := tx.Get(s.filesNamespace(username), s.fileKey(name))
+	if err != nil {
+		return rec, err
+	}
+	err = json.Unmarshal(raw, &rec)
+	return rec, err
+}
+
+// putFile guarda (a través de 'tx') el fichero 'rec' de 'username'.
+func (s *server) putFile(tx store.Tx, username string, rec fileRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return tx.Put(s.filesNamespace(username), s.fileKey(rec.Name), raw)
+}
+
+// ownedFiles devuelve los ficheros de 'username', completos o no.
+func (s *server) ownedFiles(ctx context.Context, username string) ([]fileRecord, error) {
+	var files []fileRecord
+	err := s.db.ForEach(ctx, s.filesNamespace(username), func(key, value []byte) error {
+		var rec fileRecord
+		if err := json.Unmarshal(value, &rec); err != nil {
+			s.logf(ctx, "fichero ilegible %s: %v", key, err)
+			return nil
+		}
+		files = append(files, rec)
+		return nil
+	})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	return files, nil
+}
+
+func chunkKey(i int) []byte {
+	return binary.BigEndian.AppendUint32(nil, uint32(i))
+}
+
+// checkFileInfo comprueba que lo que declara el cliente de un fichero
+// cabe en los límites y tiene sentido.
+func checkFileInfo(f *api.FileInfo) (api.Response, bool) {
+	if f == nil || f.Name == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Falta el nombre del fichero"}, false
+	}
+	if len(f.Name) > maxFileName {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: fmt.Sprintf("El nombre del fichero supera los %d caracteres", maxFileName)}, false
+	}
+	if h, err := hex.DecodeString(f.Hash); err != nil || len(h) != sha256.Size {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "El hash del fichero no es un SHA-256 en hexadecimal"}, false
+	}
+	if f.Size < 0 || f.Chunks < 1 {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Tamaño o número de trozos no válidos"}, false
+	}
+	if f.Size > maxFileSize || f.Chunks > maxFileChunks {
+		return api.Response{Success: false, Code: api.ErrQuotaExceeded, Message: fmt.Sprintf("El fichero supera el tamaño máximo (%d bytes en %d trozos)", maxFileSize, maxFileChunks)}, false
+	}
+	return api.Response{}, true
+}
+
+// uploadFileChunk guarda el trozo Chunk del fichero File. El trozo 0 crea
+// el fichero, o lo empieza de nuevo si ya existía (sin dejar de estar
+// compartido con quien lo estuviera); los siguientes tienen
+// que llegar en orden y con el mismo File. Reenviar uno ya recibido (por
+// ejemplo, porque no llegó la respuesta) no cambia nada. Con el último, se
+// comprueba que el fichero entero tiene el tamaño y el hash declarados: si
+// no, se borra.
+func (s *server) uploadFileChunk(ctx context.Context, req api.Request) api.Response {
+	if res, ok := checkFileInfo(req.File); !ok {
+		return res
+	}
+	f := req.File
+	if req.Chunk < 0 || req.Chunk >= f.Chunks {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Número de trozo fuera del fichero"}
+	}
+	chunk, err := base64.StdEncoding.DecodeString(req.Data)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "El trozo no está en base64"}
+	}
+	if len(chunk) > maxChunkSize {
+		return api.Response{Success: false, Code: api.ErrQuotaExceeded, Message: fmt.Sprintf("El trozo supera el tamaño máximo (%d bytes)", maxChunkSize)}
+	}
+
+	// Sin la clave de datos del usuario en el servidor, en su siguiente
+	// login el cliente generaría otra y el fichero ya no se podría descifrar
+	if req.Chunk == 0 {
+		ok, err := s.db.Exists(ctx, "datakeys", s.userKey(req.Username))
+		if err != nil {
+			s.logf(ctx, "error comprobando la clave de datos de %s: %v", req.Username, err)
+			return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar el trozo"}
+		}
+		if !ok {
+			return api.Response{Success: false, Code: api.ErrForbidden, Message: "Guarda antes tus datos para que el servidor tenga tu clave de datos"}
+		}
+	}
+
+	ns := s.filesNamespace(req.Username)
+	key := s.fileKey(f.Name)
+	chunks := s.chunksNamespace(req.Username, f.Name)
+	if req.Chunk == 0 {
+		exists, err := s.db.Exists(ctx, ns, key)
+		if err == nil && !exists {
+			var n int
+			n, err = s.db.CountKeys(ctx, ns)
+			if errors.Is(err, store.ErrNotFound) {
+				n, err = 0, nil
+			}
+			if err == nil && n >= maxFilesByUser {
+				return api.Response{Success: false, Code: api.ErrQuotaExceeded, Message: fmt.Sprintf("No puedes tener más de %d ficheros", maxFilesByUser)}
+			}
+		}
+		// Los trozos de una subida anterior podrían ser más que los de esta
+		if err == nil && exists {
+			err = s.db.DeleteNamespace(ctx, chunks)
+			if errors.Is(err, store.ErrNotFound) {
+				err = nil
+			}
+		}
+		if err != nil {
+			s.logf(ctx, "error preparando el fichero %q: %v", f.Name, err)
+			return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar el trozo"}
+		}
+	}
+
+	var rec fileRecord
+	var errRes *api.Response
+	err = s.db.Batch(ctx, func(tx store.Tx) error {
+		errRes = nil
+		old, err := s.getFile(tx, req.Username, f.Name)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		if req.Chunk == 0 {
+			rec = fileRecord{Name: f.Name, Size: f.Size, Hash: f.Hash, Chunks: f.Chunks, Created: time.Now().UTC(), SharedWith: old.SharedWith}
+		} else {
+			if err != nil {
+				errRes = &api.Response{Success: false, Code: api.ErrNotFound, Message: "No hay una subida en curso de ese fichero; empieza por el trozo 0"}
+				return nil
+			}
+			rec = old
+			if rec.Size != f.Size || rec.Hash != f.Hash || rec.Chunks != f.Chunks {
+				errRes = &api.Response{Success: false, Code: api.ErrConflict, Message: "El fichero no coincide con el de la subida en curso; empieza por el trozo 0"}
+				return nil
+			}
+			if req.Chunk < rec.Received {
+				return nil
+			}
+			if req.Chunk > rec.Received {
+				errRes = &api.Response{Success: false, Code: api.ErrConflict, Message: fmt.Sprintf("Falta el trozo %d", rec.Received)}
+				return nil
+			}
+		}
+		if rec.Bytes+int64(len(chunk)) > rec.Size {
+			errRes = &api.Response{Success: false, Code: api.ErrBadRequest, Message: "Los trozos superan el tamaño declarado del fichero"}
+			return nil
+		}
+		rec.Received++
+		rec.Bytes += int64(len(chunk))
+		if err := tx.Put(chunks, chunkKey(req.Chunk), chunk); err != nil {
+			return err
+		}
+		return s.putFile(tx, req.Username, rec)
+	})
+	if err != nil {
+		s.logf(ctx, "error guardando el trozo %d de %q: %v", req.Chunk, f.Name, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar el trozo"}
+	}
+	if errRes != nil {
+		return *errRes
+	}
+	if rec.Received < rec.Chunks || rec.Complete {
+		return api.Response{Success: true, Message: fmt.Sprintf("Trozo %d de %d guardado", rec.Received, rec.Chunks), File: rec.info()}
+	}
+	return s.completeFile(ctx, req.Username, rec)
+}
+
+// completeFile comprueba el fichero 'rec', con todos sus trozos ya
+// guardados, contra el tamaño y el hash declarados y, si coincide, lo marca
+// como completo. Si no, lo borra.
+func (s *server) completeFile(ctx context.Context, username string, rec fileRecord) api.Response {
+	chunks := s.chunksNamespace(username, rec.Name)
+	h := sha256.New()
+	var size int64
+	for i := range rec.Chunks {
+		chunk, err := s.db.Get(ctx, chunks, chunkKey(i))
+		if err != nil {
+			s.logf(ctx, "error leyendo el trozo %d de %q: %v", i, rec.Name, err)
+			return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al comprobar el fichero"}
+		}
+		h.Write(chunk)
+		size += int64(len(chunk))
+	}
+	if size != rec.Size || hex.EncodeToString(h.Sum(nil)) != rec.Hash {
+		if err := s.deleteFile(ctx, username, rec); err != nil {
+			s.logf(ctx, "error borrando el fichero %q: %v", rec.Name, err)
+		}
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "El fichero recibido no coincide con su tamaño o su hash; se ha descartado"}
+	}
+
+	rec.Complete = true
+	if err := s.putFile(store.AsTx(ctx, s.db), username, rec); err != nil {
+		s.logf(ctx, "error guardando el fichero %q: %v", rec.Name, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar el fichero"}
+	}
+	return api.Response{Success: true, Message: "Fichero guardado", File: rec.info()}
+}
+
+// deleteFile borra el fichero 'rec' de 'username' con todos sus trozos y
+// lo saca del índice de aquellos con quienes lo compartía.
+func (s *server) deleteFile(ctx context.Context, username string, rec fileRecord) error {
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		if err := s.dropSharesTx(tx, username, []fileRecord{rec}, nil); err != nil {
+			return err
+		}
+		err := tx.Delete(s.filesNamespace(username), s.fileKey(rec.Name))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = s.db.DeleteNamespace(ctx, s.chunksNamespace(username, rec.Name))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// downloadFileChunk devuelve en Data (en base64) el trozo Chunk del fichero
+// File.Name, y en File lo que se sabe de él para que el cliente compruebe
+// el fichero entero al acabar. Sólo se pueden descargar ficheros completos,
+// del usuario o, con Owner, de otro que lo haya compartido con él.
+func (s *server) downloadFileChunk(ctx context.Context, req api.Request) api.Response {
+	if req.File == nil || req.File.Name == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Falta el nombre del fichero"}
+	}
+	owner := req.Username
+	if req.Owner != "" {
+		owner = req.Owner
+	}
+	rec, err := s.getFile(store.AsTx(ctx, s.db), owner, req.File.Name)
+	// A quien no lo tiene compartido, como si no existiera
+	if err == nil && owner != req.Username && !slices.Contains(rec.SharedWith, req.Username) {
+		err = store.ErrNotFound
+	}
+	if errors.Is(err, store.ErrNotFound) || (err == nil && !rec.Complete) {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "Fichero no encontrado"}
+	}
+	if err != nil {
+		s.logf(ctx, "error leyendo el fichero %q: %v", req.File.Name, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener el fichero"}
+	}
+	if req.Chunk < 0 || req.Chunk >= rec.Chunks {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Número de trozo fuera del fichero"}
+	}
+	chunk, err := s.db.Get(ctx, s.chunksNamespace(owner, rec.Name), chunkKey(req.Chunk))
+	if err != nil {
+		s.logf(ctx, "error leyendo el trozo %d de %q: %v", req.Chunk, rec.Name, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener el fichero"}
+	}
+	return api.Response{
+		Success: true,
+		Message: fmt.Sprintf("Trozo %d de %d", req.Chunk+1, rec.Chunks),
+		Data:    base64.StdEncoding.EncodeToString(chunk),
+		File:    rec.info(),
+	}
+}
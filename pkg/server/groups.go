@@ -0,0 +1,321 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"prac/pkg/api"
+	"prac/pkg/store"
+)
+
+// groupsNS guarda los grupos (groupRecord en JSON) y groupDataNS, sus
+// datos. Las claves de ambos son groupKey(nombre): como con los usuarios,
+// un volcado no dice qué grupos hay.
+const (
+	groupsNS    = "groups"
+	groupDataNS = "groupdata"
+)
+
+const (
+	maxGroupName    = 64      // longitud máxima del nombre de un grupo
+	maxGroupMembers = 100     // miembros de un grupo, contando al dueño
+	maxGroupData    = 1 << 20 // tamaño máximo de los datos de un grupo
+)
+
+// groupRecord es el valor de groupsNS: el nombre (la clave no lo dice),
+// el dueño y los miembros, dueño incluido.
+type groupRecord struct {
+	Name    string    `json:"name"`
+	Owner   string    `json:"owner"`
+	Members []string  `json:"members"`
+	Created time.Time `json:"created"`
+}
+
+// groupKey devuelve la clave del store del grupo 'name', calculada como
+// userKey: que coincida con la de un usuario del mismo nombre no importa,
+// porque los grupos tienen sus propios namespaces.
+func (s *server) groupKey(name string) []byte {
+	return hashUsername(s.userMAC, name)
+}
+
+// getGroup lee (a través de 'tx') el grupo 'name'. Si no existe, el error
+// es store.ErrNotFound.
+func (s *server) getGroup(tx store.Tx, name string) (groupRecord, error) {
+	var g groupRecord
+	raw, err := tx.Get(groupsNS, s.groupKey(name))
+	if err != nil {
+		return g, err
+	}
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return g, fmt.Errorf("grupo %s ilegible: %v", name, err)
+	}
+	return g, nil
+}
+
+// putGroup guarda (a través de 'tx') el grupo 'g'.
+func (s *server) putGroup(tx store.Tx, g groupRecord) error {
+	raw, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	return tx.Put(groupsNS, s.groupKey(g.Name), raw)
+}
+
+// api devuelve la descripción de 'g' para la respuesta.
+func (g groupRecord) api() api.Group {
+	return api.Group{Name: g.Name, Owner: g.Owner, Members: g.Members}
+}
+
+// groupError devuelve la respuesta de error de una acción de grupos
+// cuando falla el acceso al store: el grupo no existe, o el fallo interno
+// con el mensaje 'msg'.
+func (s *server) groupError(ctx context.Context, req api.Request, err error, msg string) api.Response {
+	if errors.Is(err, store.ErrNotFound) {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "Grupo no encontrado"}
+	}
+	s.logf(ctx, "error en el grupo %s: %v", req.Group, err)
+	return api.Response{Success: false, Code: api.ErrInternal, Message: msg}
+}
+
+// createGroup crea el grupo Group con el usuario como dueño y único miembro.
+func (s *server) createGroup(ctx context.Context, req api.Request) api.Response {
+	if req.Group == "" || len(req.Group) > maxGroupName || !utf8.ValidString(req.Group) {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: fmt.Sprintf("Nombre de grupo no válido (de 1 a %d bytes)", maxGroupName)}
+	}
+	exists := false
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		_, err := s.getGroup(tx, req.Group)
+		if err == nil {
+			exists = true
+			return nil
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		return s.putGroup(tx, groupRecord{Name: req.Group, Owner: req.Username, Members: []string{req.Username}, Created: time.Now().UTC()})
+	})
+	if err != nil {
+		return s.groupError(ctx, req, err, "Error al crear el grupo")
+	}
+	if exists {
+		return api.Response{Success: false, Code: api.ErrConflict, Message: "Ya existe un grupo con ese nombre"}
+	}
+	return api.Response{Success: true, Message: "Grupo creado"}
+}
+
+// addGroupMember añade Member al grupo Group. Sólo puede hacerlo el dueño.
+func (s *server) addGroupMember(ctx context.Context, req api.Request) api.Response {
+	if req.Group == "" || req.Member == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan el grupo o el miembro"}
+	}
+	exists, err := s.userExists(ctx, req.Member)
+	if err != nil {
+		return s.groupError(ctx, req, err, "Error al añadir el miembro")
+	}
+	if !exists {
+		return api.Response{Success: false, Code: api.ErrUserNotFound, Message: "Usuario no encontrado"}
+	}
+	var denied api.Response
+	err = s.db.Batch(ctx, func(tx store.Tx) error {
+		denied = api.Response{}
+		g, err := s.getGroup(tx, req.Group)
+		if err != nil {
+			return err
+		}
+		switch {
+		case !slices.Contains(g.Members, req.Username):
+			// A quien no es miembro no se le dice ni que el grupo existe
+			return store.ErrNotFound
+		case g.Owner != req.Username:
+			denied = api.Response{Success: false, Code: api.ErrForbidden, Message: "Sólo el dueño del grupo puede añadir miembros"}
+		case slices.Contains(g.Members, req.Member):
+			denied = api.Response{Success: false, Code: api.ErrConflict, Message: "Ya es miembro del grupo"}
+		case len(g.Members) >= maxGroupMembers:
+			denied = api.Response{Success: false, Code: api.ErrQuotaExceeded, Message: fmt.Sprintf("El grupo ya tiene el máximo de miembros (%d)", maxGroupMembers)}
+		default:
+			g.Members = append(g.Members, req.Member)
+			return s.putGroup(tx, g)
+		}
+		return nil
+	})
+	if err != nil {
+		return s.groupError(ctx, req, err, "Error al añadir el miembro")
+	}
+	if denied.Code != "" {
+		return denied
+	}
+	s.push.publish(req.Member, "", api.Event{Type: api.EventGroup, Message: req.Username + " te ha añadido al grupo " + req.Group})
+	return api.Response{Success: true, Message: "Miembro añadido"}
+}
+
+// removeGroupMember quita Member del grupo Group. El dueño puede quitar a
+// cualquiera salvo a sí mismo; los demás, sólo a sí mismos (salir del grupo).
+func (s *server) removeGroupMember(ctx context.Context, req api.Request) api.Response {
+	if req.Group == "" || req.Member == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan el grupo o el miembro"}
+	}
+	var denied api.Response
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		denied = api.Response{}
+		g, err := s.getGroup(tx, req.Group)
+		if err != nil {
+			return err
+		}
+		i := slices.Index(g.Members, req.Member)
+		switch {
+		case !slices.Contains(g.Members, req.Username):
+			return store.ErrNotFound
+		case g.Owner != req.Username && req.Member != req.Username:
+			denied = api.Response{Success: false, Code: api.ErrForbidden, Message: "Sólo el dueño del grupo puede quitar a otros miembros"}
+		case req.Member == g.Owner:
+			denied = api.Response{Success: false, Code: api.ErrBadRequest, Message: "El dueño no puede salir del grupo"}
+		case i < 0:
+			denied = api.Response{Success: false, Code: api.ErrNotFound, Message: "No es miembro del grupo"}
+		default:
+			g.Members = slices.Delete(g.Members, i, i+1)
+			return s.putGroup(tx, g)
+		}
+		return nil
+	})
+	if err != nil {
+		return s.groupError(ctx, req, err, "Error al quitar el miembro")
+	}
+	if denied.Code != "" {
+		return denied
+	}
+	if req.Member != req.Username {
+		s.push.publish(req.Member, "", api.Event{Type: api.EventGroup, Message: req.Username + " te ha quitado del grupo " + req.Group})
+	}
+	return api.Response{Success: true, Message: "Miembro quitado"}
+}
+
+// memberGroups devuelve los grupos de los que es miembro 'username', por
+// orden de nombre.
+func (s *server) memberGroups(ctx context.Context, username string) ([]groupRecord, error) {
+	var groups []groupRecord
+	err := s.db.ForEach(ctx, groupsNS, func(key, value []byte) error {
+		var g groupRecord
+		if err := json.Unmarshal(value, &g); err != nil {
+			s.logf(ctx, "grupo ilegible %s: %v", key, err)
+			return nil
+		}
+		if slices.Contains(g.Members, username) {
+			groups = append(groups, g)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	// Las claves son HMAC: su orden no es el de los nombres
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// listGroups devuelve en Groups los grupos del usuario, por orden de
+// nombre y por páginas (ver paginate).
+func (s *server) listGroups(ctx context.Context, req api.Request) api.Response {
+	groups, err := s.memberGroups(ctx, req.Username)
+	if err != nil {
+		s.logf(ctx, "error leyendo los grupos: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener los grupos"}
+	}
+	groups, next, errRes, ok := paginate(req, groups, maxPageSize, false, func(g groupRecord) string {
+		return g.Name
+	})
+	if !ok {
+		return errRes
+	}
+	res := api.Response{Success: true, Message: fmt.Sprintf("Grupos: %d", len(groups)), NextCursor: next}
+	for _, g := range groups {
+		res.Groups = append(res.Groups, g.api())
+	}
+	return res
+}
+
+// fetchGroupData devuelve en Data los datos del grupo Group, si el usuario
+// es miembro. Un grupo sin datos los devuelve vacíos.
+func (s *server) fetchGroupData(ctx context.Context, req api.Request) api.Response {
+	g, err := s.getGroup(store.AsTx(ctx, s.db), req.Group)
+	if err == nil && !slices.Contains(g.Members, req.Username) {
+		err = store.ErrNotFound
+	}
+	var data []byte
+	if err == nil {
+		data, err = s.db.Get(ctx, groupDataNS, s.groupKey(req.Group))
+		if errors.Is(err, store.ErrNotFound) {
+			data, err = nil, nil
+		}
+	}
+	if err != nil {
+		return s.groupError(ctx, req, err, "Error al obtener los datos del grupo")
+	}
+	return api.Response{Success: true, Message: "Datos del grupo " + req.Group, Data: string(data)}
+}
+
+// updateGroupData cambia los datos del grupo Group por Data, si el usuario
+// es miembro, y avisa a los demás miembros. La pertenencia se comprueba en
+// la misma transacción que la escritura.
+func (s *server) updateGroupData(ctx context.Context, req api.Request) api.Response {
+	if len(req.Data) > maxGroupData {
+		return api.Response{Success: false, Code: api.ErrQuotaExceeded, Message: fmt.Sprintf("Los datos superan el tamaño máximo (%d bytes)", maxGroupData)}
+	}
+	var g groupRecord
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		var err error
+		if g, err = s.getGroup(tx, req.Group); err != nil {
+			return err
+		}
+		if !slices.Contains(g.Members, req.Username) {
+			return store.ErrNotFound
+		}
+		return tx.Put(groupDataNS, s.groupKey(req.Group), []byte(req.Data))
+	})
+	if err != nil {
+		return s.groupError(ctx, req, err, "Error al actualizar los datos del grupo")
+	}
+	for _, m := range g.Members {
+		if m != req.Username {
+			s.push.publish(m, "", api.Event{Type: api.EventGroup, Message: req.Username + " ha cambiado los datos del grupo " + req.Group})
+		}
+	}
+	return api.Response{Success: true, Message: "Datos del grupo actualizados"}
+}
+
+// leaveGroupsTx saca (a través de 'tx') a 'username' de 'groups' (ver
+// memberGroups), que vuelve a leer dentro de la transacción. Los que son
+// suyos se borran, con sus datos.
+func (s *server) leaveGroupsTx(tx store.Tx, username string, groups []groupRecord) error {
+	for _, old := range groups {
+		g, err := s.getGroup(tx, old.Name)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if g.Owner == username {
+			key := s.groupKey(g.Name)
+			if err := tx.Delete(groupsNS, key); err != nil {
+				return err
+			}
+			if err := tx.Delete(groupDataNS, key); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+			continue
+		}
+		if i := slices.Index(g.Members, username); i >= 0 {
+			g.Members = slices.Delete(g.Members, i, i+1)
+			if err := s.putGroup(tx, g); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
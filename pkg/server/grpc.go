@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // los clientes pueden mandar los mensajes grandes comprimidos
+	"google.golang.org/grpc/status"
+
+	"prac/pkg/api"
+	"prac/pkg/api/apipb"
+)
+
+// actionWatchData es la acción con la que WatchData queda en la auditoría.
+const actionWatchData = "grpcWatchData"
+
+// grpcService sirve apipb.PracServer con las mismas acciones que /api.
+type grpcService struct {
+	apipb.UnimplementedPracServer
+	s *server
+}
+
+// serveGRPC escucha en 'addr' y sirve el servicio gRPC en segundo plano,
+// con TLS si 'tlsCfg' no es nil. Para pararlo, hay que llamar a la función
+// devuelta.
+func (s *server) serveGRPC(addr string, tlsCfg *tls.Config) (stop func(), err error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	var opts []grpc.ServerOption
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	gs := grpc.NewServer(opts...)
+	apipb.RegisterPracServer(gs, grpcService{s: s})
+	go func() {
+		if err := gs.Serve(lis); err != nil {
+			s.log.Printf("error del servicio gRPC: %v", err)
+		}
+	}()
+	return gs.Stop, nil
+}
+
+// Call ejecuta la acción de 'req' como apiHandler. Los errores de la acción
+// van en la Response, como en JSON; el error de gRPC queda para los del
+// transporte.
+func (g grpcService) Call(ctx context.Context, req *apipb.Request) (*apipb.Response, error) {
+	ctx = grpcRequestID(ctx)
+	r := req.API()
+	res := g.s.dispatchVersion(ctx, r)
+	g.s.record(context.WithoutCancel(ctx), r, res)
+	res.RequestID = requestID(ctx)
+	return apipb.FromResponse(res), nil
+}
+
+// WatchData envía un aviso cada vez que cambian los datos del usuario, como
+// waitData pero sin cortar la conexión entre uno y otro. Termina cuando el
+// cliente la cancela o cuando, al llegar un cambio, su sesión se ha cerrado
+// (que el token caduque no importa: la sesión sigue con refresh).
+func (g grpcService) WatchData(req *apipb.Request, stream apipb.Prac_WatchDataServer) error {
+	ctx := grpcRequestID(stream.Context())
+	r := req.API()
+	r.Action = actionWatchData
+	if !g.s.isTokenValid(ctx, r.Username, r.Token) {
+		g.s.record(ctx, r, api.Response{Success: false, Code: api.ErrTokenExpired, Message: "Token inválido o sesión expirada"})
+		return status.Error(codes.Unauthenticated, "Token inválido o sesión expirada")
+	}
+	g.s.record(ctx, r, api.Response{Success: true, Message: "Suscrito a los cambios de los datos"})
+
+	sid := g.s.sessionID(r.Token)
+	key := g.s.userKey(r.Username)
+	changes, cancel := g.s.watch.Watch("userdata", key)
+	defer func() { cancel() }()
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				// Se han perdido avisos: volvemos a suscribirnos, y el aviso
+				// que sigue vale por todos ellos
+				cancel()
+				changes, cancel = g.s.watch.Watch("userdata", key)
+			}
+			if !g.s.certAllows(ctx, r.Username) || !g.s.sessionOpen(ctx, r.Username, sid) {
+				return status.Error(codes.Unauthenticated, "Token inválido o sesión expirada")
+			}
+			res := api.Response{Success: true, Message: "Datos actualizados"}
+			if err := stream.Send(apipb.FromResponse(res)); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"prac/pkg/crypto"
+	"prac/pkg/keyprovider"
+)
+
+// unlockWithHSM desenvuelve la clave maestra de cfg.WrappedKeyFile con la
+// clave del token PKCS#11. La primera vez (sin fichero envuelto) genera la
+// clave en el token y envuelve la clave maestra: la del fichero de clave
+// por frase de paso si existe, para no perder los datos, o una nueva.
+// Tras migrar conviene borrar cfg.KeyFile, que sigue abriendo la clave.
+func (cfg *Config) unlockWithHSM(prompt func(string) []byte) error {
+	_, err := os.Stat(cfg.WrappedKeyFile)
+	firstRun := errors.Is(err, os.ErrNotExist)
+	if err != nil && !firstRun {
+		return fmt.Errorf("error accediendo a la clave envuelta: %v", err)
+	}
+
+	pc := cfg.PKCS11
+	if pc.PIN == "" {
+		if prompt == nil {
+			return fmt.Errorf("se necesita el PIN del token PKCS#11 (%s)", envPKCS11PIN)
+		}
+		pin := prompt("PIN del token PKCS#11")
+		pc.PIN = string(pin)
+		crypto.Wipe(pin)
+	}
+	// Sólo se crea la clave en el token al configurarlo: después, una
+	// etiqueta equivocada debe fallar en lugar de generar otra clave.
+	pc.Create = firstRun
+	hsm, err := keyprovider.OpenPKCS11(pc)
+	if err != nil {
+		return err
+	}
+	defer hsm.Close()
+
+	if !firstRun {
+		cfg.MasterKey, err = keyprovider.OpenWrappedKey(cfg.WrappedKeyFile, hsm)
+		return err
+	}
+
+	var master []byte
+	if _, err := os.Stat(cfg.KeyFile); err == nil {
+		if err := cfg.unlockKeyFile(prompt); err != nil {
+			return err
+		}
+		master = cfg.MasterKey
+	} else if master, err = crypto.RandomBytes(crypto.KeySize); err != nil {
+		return err
+	}
+	if err := keyprovider.CreateWrappedKey(cfg.WrappedKeyFile, hsm, master); err != nil {
+		return err
+	}
+	cfg.MasterKey = master
+	return nil
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"runtime/debug"
+	"sort"
+	"time"
+
+	"prac/pkg/api"
+)
+
+// Version es la versión del servidor que da serverInfo. Se fija al
+// compilar:
+//
+//	go build -ldflags "-X prac/pkg/server.Version=1.4.0"
+//
+// Sin ella, se usa la revisión de git de la compilación, si consta.
+var Version = ""
+
+// serverVersion es Version o, si no se ha fijado, la revisión de git con
+// la que se compiló ("-dirty" si había cambios sin confirmar).
+func serverVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	revision, dirty := "", false
+	for _, st := range info.Settings {
+		switch st.Key {
+		case "vcs.revision":
+			revision = st.Value
+		case "vcs.modified":
+			dirty = st.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if dirty {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// serverFeatures son las funciones (api.Feature*) que ofrece un servidor
+// con 'cfg', con TLS o sin él.
+func serverFeatures(cfg Config, tls bool) []string {
+	features := []string{api.Feature2FA, api.FeatureE2E, api.FeatureSRP, api.FeatureWebAuthn}
+	if tls {
+		features = append(features, api.FeatureTLS)
+	}
+	if tls && cfg.MTLS != "" {
+		features = append(features, api.FeatureMTLS)
+	}
+	if cfg.EnableCSRF {
+		features = append(features, api.FeatureCSRF)
+	}
+	if cfg.EnableOPAQUE {
+		features = append(features, api.FeatureOPAQUE)
+	}
+	if cfg.GRPCAddr != "" {
+		features = append(features, api.FeatureGRPC)
+	}
+	sort.Strings(features)
+	return features
+}
+
+// serverInfo devuelve en Server la información del servidor. No necesita
+// sesión. Antes lee la versión del esquema, para comprobar que la base de
+// datos responde: si no, el servidor no está en condiciones de atender.
+func (s *server) serverInfo(ctx context.Context, req api.Request) api.Response {
+	if _, err := readSchemaVersion(ctx, s.db); err != nil {
+		s.logf(ctx, "comprobación de salud: la base de datos no responde: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "La base de datos no responde"}
+	}
+	return api.Response{Success: true, Message: "Servidor en marcha", Server: &api.ServerInfo{
+		Version:       serverVersion(),
+		Started:       s.started,
+		Uptime:        int64(time.Since(s.started) / time.Second),
+		MinAPIVersion: api.MinAPIVersion,
+		MaxAPIVersion: api.CurrentAPIVersion,
+		Features:      s.features,
+	}}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+
+	"prac/pkg/crypto"
+)
+
+// jwtIssuer es el "iss" de los tokens de sesión.
+const jwtIssuer = "prac"
+
+// Roles que van en el claim "role" para que otros servicios puedan
+// autorizar con él: roleUser es el de las cuentas normales y roleAdmin, el
+// de las de cfg.Admins, que además pueden usar las acciones admin*.
+const (
+	roleUser  = "user"
+	roleAdmin = "admin"
+)
+
+// newJWTSigner crea el firmador de los tokens de sesión según cfg.JWTAlg:
+// HS256 con una clave derivada de la maestra o RS256 con la clave RSA de
+// cfg.JWTKeyFile (que se genera en el primer arranque, junto con la
+// pública en cfg.JWTKeyFile+".pub").
+func newJWTSigner(cfg Config) (*crypto.JWTSigner, error) {
+	switch cfg.JWTAlg {
+	case crypto.JWTHS256:
+		key := crypto.DeriveKey(cfg.MasterKey, "jwt-hs256")
+		defer crypto.Wipe(key)
+		return crypto.NewHS256Signer(key)
+	case crypto.JWTRS256:
+		priv, err := crypto.LoadOrCreateRSAKey(cfg.JWTKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error con la clave de firma de los tokens: %v", err)
+		}
+		return crypto.NewRS256Signer(priv)
+	default:
+		return nil, fmt.Errorf("algoritmo de tokens no soportado: %q", cfg.JWTAlg)
+	}
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// Directorio de claves públicas (publishKey, getKey). No tiene namespaces
+// propios: la clave de firma es la de 'signkeys' y la de cifrado, la de
+// compartición de shareKeysNS.
+
+// encryptionKey es la entrada de un usuario en shareKeysNS. Las que guarda
+// setShareKey son un api.ShareKey, sin Updated.
+type encryptionKey struct {
+	Key       string    `json:"key"`
+	Signature string    `json:"signature"`
+	Updated   time.Time `json:"updated,omitempty"`
+}
+
+// publishKey publica las claves del usuario. La de cifrado tiene que venir
+// firmada con la de firma, y la de firma tiene que ser la de la cuenta: si
+// la cuenta aún no tiene (se registró sin ella), pasa a ser esa. Para
+// cambiarla hay que dar de baja la cuenta; así quien robe una sesión no
+// puede sustituirla.
+func (s *server) publishKey(ctx context.Context, req api.Request) api.Response {
+	if req.Keys == nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan las claves"}
+	}
+	signPub, err1 := base64.StdEncoding.DecodeString(req.Keys.Signing)
+	encPub, err2 := base64.StdEncoding.DecodeString(req.Keys.Encryption)
+	sig, err3 := base64.StdEncoding.DecodeString(req.Keys.Signature)
+	if errors.Join(err1, err2, err3) != nil || len(signPub) != ed25519.PublicKeySize || len(encPub) != 32 {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Claves no válidas"}
+	}
+	if !crypto.VerifyShareKey(signPub, req.Username, encPub, sig) {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "La firma de la clave de cifrado no es válida"}
+	}
+	raw, err := json.Marshal(encryptionKey{Key: req.Keys.Encryption, Signature: req.Keys.Signature, Updated: time.Now().UTC()})
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar las claves"}
+	}
+
+	key := s.userKey(req.Username)
+	var errRes *api.Response
+	err = s.db.Batch(ctx, func(tx store.Tx) error {
+		errRes = nil
+		current, err := tx.Get("signkeys", key)
+		switch {
+		case errors.Is(err, store.ErrNotFound) || (err == nil && len(current) == 0):
+			if err := tx.Put("signkeys", key, signPub); err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		case !bytes.Equal(current, signPub):
+			errRes = &api.Response{Success: false, Code: api.ErrConflict, Message: "La clave de firma no es la de la cuenta"}
+			return nil
+		}
+		return tx.Put(shareKeysNS, key, raw)
+	})
+	if err != nil {
+		s.logf(ctx, "error guardando las claves de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar las claves"}
+	}
+	if errRes != nil {
+		return *errRes
+	}
+	return api.Response{Success: true, Message: "Claves publicadas. Huella: " + crypto.KeyFingerprint(req.Username, signPub)}
+}
+
+// getKey devuelve en Keys las claves públicas de To (o las del usuario, sin
+// To) y la huella de su clave de firma. Si no ha publicado clave de
+// cifrado, sólo va la de firma.
+func (s *server) getKey(ctx context.Context, req api.Request) api.Response {
+	user := req.To
+	if user == "" {
+		user = req.Username
+	}
+	signPub, ok := s.signingKey(ctx, user)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "El usuario no existe o no tiene claves publicadas"}
+	}
+	keys := &api.PublicKeys{
+		Signing:     base64.StdEncoding.EncodeToString(signPub),
+		Fingerprint: crypto.KeyFingerprint(user, signPub),
+	}
+	raw, err := s.db.Get(ctx, shareKeysNS, s.userKey(user))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		s.logf(ctx, "error leyendo las claves de %s: %v", user, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener las claves"}
+	}
+	if err == nil {
+		var enc encryptionKey
+		if err := json.Unmarshal(raw, &enc); err != nil {
+			s.logf(ctx, "clave de cifrado de %s ilegible: %v", user, err)
+			return api.Response{Success: false, Code: api.ErrCorrupted, Message: "Error al obtener las claves"}
+		}
+		keys.Encryption, keys.Signature, keys.Updated = enc.Key, enc.Signature, enc.Updated
+	}
+	return api.Response{Success: true, Message: "Claves públicas de " + user, Keys: keys}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"prac/pkg/keyprovider"
+)
+
+// unlockWithKMS descifra la clave maestra de cfg.KMSKeyFile con Vault. La
+// primera vez pide a Vault una clave de datos nueva o, si existe el fichero
+// de clave por frase de paso, cifra con Vault esa misma clave maestra para
+// no perder los datos. Tras migrar conviene borrar cfg.KeyFile.
+func (cfg *Config) unlockWithKMS(prompt func(string) []byte) error {
+	km, err := keyprovider.NewVault(cfg.Vault)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stat(cfg.KMSKeyFile)
+	if err == nil {
+		cfg.MasterKey, err = keyprovider.OpenKMSKey(cfg.KMSKeyFile, km)
+		return err
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error accediendo a la clave del KMS: %v", err)
+	}
+
+	if _, err := os.Stat(cfg.KeyFile); err == nil {
+		if err := cfg.unlockKeyFile(prompt); err != nil {
+			return err
+		}
+		return keyprovider.ImportKMSKey(cfg.KMSKeyFile, km, cfg.MasterKey)
+	}
+	cfg.MasterKey, err = keyprovider.CreateKMSKey(cfg.KMSKeyFile, km)
+	return err
+}
+
+// RotateKMSKey rota la clave de Vault que protege la clave maestra y
+// recifra cfg.KMSKeyFile con la nueva versión. La clave maestra no cambia.
+func RotateKMSKey(cfg Config) error {
+	if cfg.Vault.Addr == "" {
+		return fmt.Errorf("no hay KMS configurado (%s)", envVaultAddr)
+	}
+	km, err := keyprovider.NewVault(cfg.Vault)
+	if err != nil {
+		return err
+	}
+	return keyprovider.RotateKMSKey(cfg.KMSKeyFile, km)
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/store"
+)
+
+// loginsNS guarda el historial de inicios de sesión. Las claves son
+// userKey || "/" || hora (UnixNano en decimal, con ceros delante para que
+// el orden de las claves sea el cronológico), así que los de un usuario
+// van seguidos y store.LastN da los más recientes sin leer los demás.
+const loginsNS = "logins"
+
+// loginHistoryTTL es cuánto se guarda cada inicio de sesión.
+const loginHistoryTTL = 90 * 24 * time.Hour
+
+// loginsShown es cuántos devuelve listLogins por página si no se le pide
+// otra cosa.
+const loginsShown = 10
+
+// loginsListed es cuántos, de los más recientes, se pueden recorrer con
+// las páginas de listLogins.
+const loginsListed = 1000
+
+// loginPrefix es el prefijo de las claves de los inicios de sesión de 'username'.
+func (s *server) loginPrefix(username string) []byte {
+	return append(s.userKey(username), '/')
+}
+
+// recordLogin anota en el historial que 'username' ha abierto una sesión
+// con la acción 'method'. Si falla, sólo se registra el error: el login
+// ya se ha hecho.
+func (s *server) recordLogin(ctx context.Context, username, method string) {
+	now := time.Now().UTC()
+	raw, err := json.Marshal(api.LoginRecord{Time: now, Method: method})
+	if err == nil {
+		key := fmt.Appendf(s.loginPrefix(username), "%020d", now.UnixNano())
+		err = s.db.PutWithTTL(ctx, loginsNS, key, raw, loginHistoryTTL)
+	}
+	if err != nil {
+		s.logf(ctx, "error guardando el inicio de sesión de %s: %v", username, err)
+	}
+}
+
+// listLogins devuelve en Logins los últimos inicios de sesión del usuario,
+// del más reciente al más antiguo, por páginas (ver paginate). El cursor
+// es la hora de la clave, no la clave entera, que lleva el userKey.
+func (s *server) listLogins(ctx context.Context, req api.Request) api.Response {
+	prefix := s.loginPrefix(req.Username)
+	entries, err := s.db.LastN(ctx, loginsNS, prefix, loginsListed)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		s.logf(ctx, "error leyendo los inicios de sesión: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener los inicios de sesión"}
+	}
+	entries, next, errRes, ok := paginate(req, entries, loginsShown, true, func(e store.Entry) string {
+		return string(e.Key[len(prefix):])
+	})
+	if !ok {
+		return errRes
+	}
+	res := api.Response{Success: true, Message: fmt.Sprintf("Últimos inicios de sesión: %d", len(entries)), NextCursor: next}
+	for _, e := range entries {
+		var rec api.LoginRecord
+		if err := json.Unmarshal(e.Value, &rec); err != nil {
+			s.logf(ctx, "inicio de sesión ilegible %s: %v", e.Key, err)
+			continue
+		}
+		res.Logins = append(res.Logins, rec)
+	}
+	return res
+}
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/store"
+)
+
+// inboxNS es el namespace padre de los buzones: el de cada usuario cuelga
+// de él con su userKey (ver inboxNamespace), así que DeleteNamespace se
+// lleva uno entero sin tocar los demás. Las claves son los identificadores
+// de los mensajes y los valores, storedMessage en JSON.
+const inboxNS = "inbox"
+
+// inboxCountNS guarda, por usuario (userKey), cuántos mensajes tiene su
+// buzón, en decimal. Se actualiza en la misma transacción que el buzón:
+// Tx no sabe contar claves, y contarlas fuera dejaría a dos remitentes a
+// la vez pasar de maxInboxSize.
+const inboxCountNS = "inbox_count"
+
+const (
+	maxMessageSize = 64 << 10 // tamaño máximo del cuerpo de un mensaje
+	maxInboxSize   = 1000     // mensajes que caben en un buzón sin leer ni borrar
+	messagesShown  = 50       // mensajes por página de fetchMessages si no se pide otra cosa
+)
+
+// storedMessage es un mensaje tal como se guarda en el buzón.
+type storedMessage struct {
+	From string    `json:"from"`
+	Time time.Time `json:"time"`
+	Body string    `json:"body"`
+}
+
+// inboxNamespace devuelve el namespace del buzón de 'username'.
+func (s *server) inboxNamespace(username string) string {
+	return inboxNS + store.NamespaceSep + string(s.userKey(username))
+}
+
+// newMessageID devuelve un identificador de mensaje: la hora (UnixNano con
+// ceros delante, para que el orden de los identificadores sea el de
+// llegada) y 8 bytes aleatorios en hexadecimal, para que dos mensajes del
+// mismo instante no se pisen.
+func newMessageID(at time.Time) (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%020d-%s", at.UnixNano(), hex.EncodeToString(b[:])), nil
+}
+
+// sendMessage deja Data en el buzón de To y avisa a sus sesiones abiertas
+// (api.EventMessage). El cuerpo se guarda tal cual: si va cifrado de
+// extremo a extremo, el servidor no puede leerlo.
+func (s *server) sendMessage(ctx context.Context, req api.Request) api.Response {
+	if req.To == "" || req.Data == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan el destinatario o el mensaje"}
+	}
+	if len(req.Data) > maxMessageSize {
+		return api.Response{Success: false, Code: api.ErrQuotaExceeded, Message: fmt.Sprintf("El mensaje supera el tamaño máximo (%d bytes)", maxMessageSize)}
+	}
+	exists, err := s.userExists(ctx, req.To)
+	if err != nil {
+		s.logf(ctx, "error comprobando el usuario %s: %v", req.To, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al enviar el mensaje"}
+	}
+	if !exists {
+		return api.Response{Success: false, Code: api.ErrUserNotFound, Message: "Usuario no encontrado"}
+	}
+
+	now := time.Now().UTC()
+	id, err := newMessageID(now)
+	if err != nil {
+		s.logf(ctx, "error generando el identificador del mensaje: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al enviar el mensaje"}
+	}
+	raw, err := json.Marshal(storedMessage{From: req.Username, Time: now, Body: req.Data})
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al enviar el mensaje"}
+	}
+	inbox, key := s.inboxNamespace(req.To), s.userKey(req.To)
+	full := false
+	err = s.db.Batch(ctx, func(tx store.Tx) error {
+		n, err := inboxCount(tx, key)
+		if err != nil {
+			return err
+		}
+		if full = n >= maxInboxSize; full {
+			return nil
+		}
+		if err := tx.Put(inbox, []byte(id), raw); err != nil {
+			return err
+		}
+		return putInboxCount(tx, key, n+1)
+	})
+	if err != nil {
+		s.logf(ctx, "error guardando el mensaje para %s: %v", req.To, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al enviar el mensaje"}
+	}
+	if full {
+		return api.Response{Success: false, Code: api.ErrQuotaExceeded, Message: "El buzón del destinatario está lleno"}
+	}
+
+	s.push.publish(req.To, "", api.Event{Type: api.EventMessage, Message: "Mensaje nuevo de " + req.Username})
+	return api.Response{Success: true, Message: "Mensaje enviado"}
+}
+
+// fetchMessages devuelve en Messages los mensajes del buzón del usuario,
+// del más antiguo al más reciente y por páginas (ver paginate). No los
+// borra: para eso está deleteMessage.
+func (s *server) fetchMessages(ctx context.Context, req api.Request) api.Response {
+	var msgs []api.Message
+	err := s.db.ForEach(ctx, s.inboxNamespace(req.Username), func(key, value []byte) error {
+		var m storedMessage
+		if err := json.Unmarshal(value, &m); err != nil {
+			s.logf(ctx, "mensaje ilegible %s: %v", key, err)
+			return nil
+		}
+		msgs = append(msgs, api.Message{ID: string(key), From: m.From, Time: m.Time, Body: m.Body})
+		return nil
+	})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		s.logf(ctx, "error leyendo el buzón: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener los mensajes"}
+	}
+	// Con las claves cifradas (EncryptedStore) no salen en orden
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+
+	msgs, next, errRes, ok := paginate(req, msgs, messagesShown, false, func(m api.Message) string {
+		return m.ID
+	})
+	if !ok {
+		return errRes
+	}
+	return api.Response{Success: true, Message: fmt.Sprintf("Mensajes: %d", len(msgs)), Messages: msgs, NextCursor: next}
+}
+
+// deleteMessage borra del buzón del usuario el mensaje de identificador Data.
+func (s *server) deleteMessage(ctx context.Context, req api.Request) api.Response {
+	if req.Data == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Falta el identificador del mensaje"}
+	}
+	inbox, key := s.inboxNamespace(req.Username), s.userKey(req.Username)
+	ok := false
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		_, err := tx.Get(inbox, []byte(req.Data))
+		if ok = err == nil; !ok {
+			if errors.Is(err, store.ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		if err := tx.Delete(inbox, []byte(req.Data)); err != nil {
+			return err
+		}
+		n, err := inboxCount(tx, key)
+		if err != nil {
+			return err
+		}
+		return putInboxCount(tx, key, max(n-1, 0))
+	})
+	if err != nil {
+		s.logf(ctx, "error borrando el mensaje %s: %v", req.Data, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al borrar el mensaje"}
+	}
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "Mensaje no encontrado"}
+	}
+	return api.Response{Success: true, Message: "Mensaje borrado"}
+}
+
+// inboxCount lee (a través de 'tx') cuántos mensajes hay en el buzón del
+// usuario de clave 'key' (ver inboxCountNS).
+func inboxCount(tx store.Tx, key []byte) (int, error) {
+	raw, err := tx.Get(inboxCountNS, key)
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(string(raw))
+	if err != nil {
+		return 0, fmt.Errorf("contador del buzón no válido: %q", raw)
+	}
+	return n, nil
+}
+
+// putInboxCount guarda (a través de 'tx') 'n' como el número de mensajes
+// del buzón del usuario de clave 'key'.
+func putInboxCount(tx store.Tx, key []byte, n int) error {
+	return tx.Put(inboxCountNS, key, []byte(strconv.Itoa(n)))
+}
+
+// countInboxes pone en inboxCountNS cuántos mensajes tiene cada buzón: los
+// de antes de que existiera no tienen contador.
+func countInboxes(ctx context.Context, db *store.EncryptedStore, _ Config) (int, error) {
+	names, err := db.NamespacesUnder(ctx, inboxNS)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return 0, err
+	}
+	total := 0
+	for _, ns := range names {
+		n, err := db.CountKeys(ctx, ns)
+		if err != nil {
+			return total, fmt.Errorf("%s: %v", ns, err)
+		}
+		key := strings.TrimPrefix(ns, inboxNS+store.NamespaceSep)
+		if err := putInboxCount(store.AsTx(ctx, db), []byte(key), n); err != nil {
+			return total, err
+		}
+		total++
+	}
+	return total, nil
+}
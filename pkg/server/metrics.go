@@ -0,0 +1,56 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"prac/pkg/store"
+)
+
+// metricsHandler publica las cifras del store (store.InstrumentedStore) en
+// el formato de texto de Prometheus: un contador de operaciones y otro de
+// errores por operación, y el histograma de latencias. Sólo se registra
+// con cfg.EnableMetrics.
+func (s *server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+		return
+	}
+	stats := s.metrics.Stats()
+	ops := make([]string, 0, len(stats))
+	for op := range stats {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	fmt.Fprintln(out, "# HELP prac_store_operations_total Operaciones del store por tipo.")
+	fmt.Fprintln(out, "# TYPE prac_store_operations_total counter")
+	for _, op := range ops {
+		fmt.Fprintf(out, "prac_store_operations_total{op=%q} %d\n", op, stats[op].Count)
+	}
+	fmt.Fprintln(out, "# HELP prac_store_errors_total Operaciones del store que han fallado.")
+	fmt.Fprintln(out, "# TYPE prac_store_errors_total counter")
+	for _, op := range ops {
+		fmt.Fprintf(out, "prac_store_errors_total{op=%q} %d\n", op, stats[op].Errors)
+	}
+	fmt.Fprintln(out, "# HELP prac_store_operation_duration_seconds Latencia de las operaciones del store.")
+	fmt.Fprintln(out, "# TYPE prac_store_operation_duration_seconds histogram")
+	for _, op := range ops {
+		st := stats[op]
+		// Prometheus quiere los intervalos acumulados
+		var cum uint64
+		for i, le := range store.LatencyBuckets {
+			cum += st.Buckets[i]
+			fmt.Fprintf(out, "prac_store_operation_duration_seconds_bucket{op=%q,le=\"%g\"} %d\n", op, le.Seconds(), cum)
+		}
+		fmt.Fprintf(out, "prac_store_operation_duration_seconds_bucket{op=%q,le=\"+Inf\"} %d\n", op, st.Count)
+		fmt.Fprintf(out, "prac_store_operation_duration_seconds_sum{op=%q} %g\n", op, st.Total.Seconds())
+		fmt.Fprintf(out, "prac_store_operation_duration_seconds_count{op=%q} %d\n", op, st.Count)
+	}
+}
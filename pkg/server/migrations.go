@@ -0,0 +1,130 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+/*
+	Migraciones del formato de los datos: la versión del esquema se guarda
+	en la propia base de datos y, al arrancar, se aplican en orden las
+	migraciones que le faltan
+*/
+
+// Namespace y clave donde se guarda la versión del esquema (en decimal).
+const (
+	metaNS           = "meta"
+	schemaVersionKey = "schema_version"
+)
+
+// migration es un cambio del formato de los datos. 'run' debe poder
+// repetirse sin efecto sobre lo ya migrado: si se interrumpe, la versión no
+// avanza y se vuelve a ejecutar entera en el siguiente arranque. Devuelve
+// cuántos registros ha cambiado.
+type migration struct {
+	version int
+	name    string
+	run     func(ctx context.Context, db *store.EncryptedStore, cfg Config) (int, error)
+}
+
+// migrations son las migraciones conocidas, por orden de versión. Las
+// nuevas se añaden al final con la versión siguiente; nunca se renumeran.
+var migrations = []migration{
+	{1, "claves de usuario con HMAC", func(ctx context.Context, db *store.EncryptedStore, cfg Config) (int, error) {
+		return migrateUserKeys(ctx, db, crypto.DeriveKey(cfg.MasterKey, userKeyInfo))
+	}},
+	{2, "cifrado de los registros en claro", sealPlaintext},
+	{3, "contadores de los buzones", countInboxes},
+	{4, "índice de los nombres de usuario", rebuildUserIndex},
+}
+
+// schemaVersion es la versión del esquema que espera este servidor.
+func schemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// readSchemaVersion devuelve la versión del esquema guardada en 'db' (0 si
+// aún no hay ninguna: base de datos nueva o de antes de las migraciones).
+func readSchemaVersion(ctx context.Context, db store.Store) (int, error) {
+	raw, err := db.Get(ctx, metaNS, []byte(schemaVersionKey))
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.Atoi(string(raw))
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("versión del esquema no válida: %q", raw)
+	}
+	return v, nil
+}
+
+// writeSchemaVersion guarda 'v' como la versión del esquema de 'db'.
+func writeSchemaVersion(ctx context.Context, db store.Store, v int) error {
+	if err := db.Put(ctx, metaNS, []byte(schemaVersionKey), []byte(strconv.Itoa(v))); err != nil {
+		return fmt.Errorf("error guardando la versión del esquema: %v", err)
+	}
+	return nil
+}
+
+// runMigrations aplica a 'db' las migraciones posteriores a su versión
+// del esquema y la va actualizando tras cada una. Si la base de datos es
+// de un esquema más nuevo que el de este servidor, no arranca: podría
+// escribir registros en un formato que la otra versión ya no entiende.
+func runMigrations(ctx context.Context, db *store.EncryptedStore, cfg Config, logf func(format string, args ...any)) error {
+	cur, err := readSchemaVersion(ctx, db)
+	if err != nil {
+		return fmt.Errorf("error leyendo la versión del esquema: %v", err)
+	}
+	if cur > schemaVersion() {
+		return fmt.Errorf("la base de datos tiene la versión %d del esquema y este servidor sólo conoce hasta la %d", cur, schemaVersion())
+	}
+	if cur == 0 {
+		// Una base de datos vacía ya nace con el formato actual
+		names, err := db.Namespaces(ctx)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return writeSchemaVersion(ctx, db, schemaVersion())
+		}
+	}
+	for _, m := range migrations {
+		if m.version <= cur {
+			continue
+		}
+		n, err := m.run(ctx, db, cfg)
+		if err != nil {
+			return fmt.Errorf("error en la migración %d (%s): %v", m.version, m.name, err)
+		}
+		if err := writeSchemaVersion(ctx, db, m.version); err != nil {
+			return err
+		}
+		logf("Migración %d (%s) aplicada: %d registros", m.version, m.name, n)
+	}
+	return nil
+}
+
+// sealPlaintext cifra los registros que siguen en claro en todos los
+// namespaces (ver store.EncryptedStore.SealPlaintext).
+func sealPlaintext(ctx context.Context, db *store.EncryptedStore, _ Config) (int, error) {
+	names, err := db.Namespaces(ctx)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, ns := range names {
+		n, err := db.SealPlaintext(ctx, ns)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("%s: %v", ns, err)
+		}
+	}
+	return total, nil
+}
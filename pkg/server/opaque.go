@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+)
+
+// opaqueTimeout es el tiempo máximo entre KE2 y KE3 en un login OPAQUE.
+const opaqueTimeout = 2 * time.Minute
+
+// opaquePending es el estado de un login OPAQUE entre las dos rondas.
+type opaquePending struct {
+	session *crypto.OPAQUEServerSession
+	expires time.Time
+}
+
+// opaqueDisabled es la respuesta a cualquier acción OPAQUE si la
+// funcionalidad no está activada en la configuración.
+var opaqueDisabled = api.Response{Success: false, Code: api.ErrNotSupported, Message: "OPAQUE no está habilitado en el servidor"}
+
+// opaqueRegisterInit evalúa el OPRF sobre la contraseña cegada del cliente
+// (Data = JSON de OPAQUERegistrationRequest). No guarda ningún estado.
+func (s *server) opaqueRegisterInit(ctx context.Context, req api.Request) api.Response {
+	if s.opaque == nil {
+		return opaqueDisabled
+	}
+	if req.Username == "" || req.Data == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+	if isHashedKey([]byte(req.Username)) {
+		return reservedUsername
+	}
+	var msg crypto.OPAQUERegistrationRequest
+	if err := json.Unmarshal([]byte(req.Data), &msg); err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Mensaje OPAQUE no válido"}
+	}
+
+	exists, err := s.usernameTaken(ctx, req.Username)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al verificar usuario"}
+	}
+	if exists {
+		return api.Response{Success: false, Code: api.ErrUserExists, Message: "El usuario ya existe"}
+	}
+
+	resp, err := s.opaque.RegistrationResponse(req.Username, &msg)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Mensaje OPAQUE no válido"}
+	}
+	return opaqueReply("Respuesta de registro OPAQUE generada", resp)
+}
+
+// opaqueRegisterFinish guarda el registro OPAQUE del cliente
+// (Data = JSON de OPAQUERecord) y da de alta al usuario.
+func (s *server) opaqueRegisterFinish(ctx context.Context, req api.Request) api.Response {
+	if s.opaque == nil {
+		return opaqueDisabled
+	}
+	if req.Username == "" || req.Data == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+	if isHashedKey([]byte(req.Username)) {
+		return reservedUsername
+	}
+	var rec crypto.OPAQUERecord
+	if err := json.Unmarshal([]byte(req.Data), &rec); err != nil || len(rec.ClientPublicKey) == 0 || len(rec.MaskingKey) == 0 || len(rec.Envelope) == 0 {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Mensaje OPAQUE no válido"}
+	}
+	pubKey, err := decodePublicKey(req.PublicKey)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Clave pública no válida"}
+	}
+
+	exists, err := s.usernameTaken(ctx, req.Username)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al verificar usuario"}
+	}
+	if exists {
+		return api.Response{Success: false, Code: api.ErrUserExists, Message: "El usuario ya existe"}
+	}
+
+	return s.initUserRecords(ctx, req.Username, "opaque", []byte(req.Data), pubKey)
+}
+
+// opaqueLoginInit procesa KE1 y devuelve KE2 en Data.
+func (s *server) opaqueLoginInit(ctx context.Context, req api.Request) api.Response {
+	if s.opaque == nil {
+		return opaqueDisabled
+	}
+	if req.Username == "" || req.Data == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+	var ke1 crypto.OPAQUEKE1
+	if err := json.Unmarshal([]byte(req.Data), &ke1); err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Mensaje OPAQUE no válido"}
+	}
+
+	raw, err := s.db.Get(ctx, "opaque", s.userKey(req.Username))
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrUserNotFound, Message: "Usuario no encontrado"}
+	}
+	var rec crypto.OPAQUERecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		s.logf(ctx, "registro OPAQUE corrupto para %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar el login OPAQUE"}
+	}
+
+	ke2, session, err := s.opaque.LoginStart(req.Username, &rec, &ke1)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Mensaje OPAQUE no válido"}
+	}
+
+	s.opaqueMu.Lock()
+	s.opaquePending[req.Username] = opaquePending{session: session, expires: time.Now().Add(opaqueTimeout)}
+	s.opaqueMu.Unlock()
+
+	res := opaqueReply("Reto OPAQUE generado", ke2)
+	_, res.TwoFactorRequired = s.totpSecret(ctx, req.Username)
+	return res
+}
+
+// opaqueLoginFinish comprueba KE3. Si es correcto, crea la sesión y envía
+// el token cifrado con la clave de sesión OPAQUE (en Data), de modo que
+// sólo el cliente que ha completado el intercambio puede usarlo. La clave
+// de sesión de datos y el token de refresco viajan cifrados de la misma
+// forma.
+func (s *server) opaqueLoginFinish(ctx context.Context, req api.Request) api.Response {
+	if s.opaque == nil {
+		return opaqueDisabled
+	}
+	if req.Username == "" || req.Data == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+	var ke3 crypto.OPAQUEKE3
+	if err := json.Unmarshal([]byte(req.Data), &ke3); err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Mensaje OPAQUE no válido"}
+	}
+
+	// Cada reto sólo se puede usar una vez
+	s.opaqueMu.Lock()
+	p, ok := s.opaquePending[req.Username]
+	delete(s.opaquePending, req.Username)
+	s.opaqueMu.Unlock()
+	if !ok || time.Now().After(p.expires) {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "No hay un login OPAQUE en curso o ha caducado"}
+	}
+
+	sessionKey, err := p.session.Finish(&ke3)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInvalidCredentials, Message: "Credenciales inválidas"}
+	}
+
+	if secret, enabled := s.totpSecret(ctx, req.Username); enabled {
+		if !crypto.VerifyTOTP(secret, req.Code, time.Now()) {
+			return api.Response{Success: false, Code: api.ErrInvalidTwoFactor, Message: "Código 2FA incorrecto o ausente", TwoFactorRequired: true}
+		}
+	}
+
+	res := s.createSession(ctx, req, "Login OPAQUE exitoso")
+	if !res.Success {
+		return res
+	}
+	tokenKey, dataKey := crypto.OPAQUETokenKey(sessionKey), s.sessionKey(res.Token)
+	defer crypto.Wipe(sessionKey, tokenKey, dataKey)
+	sealed, err1 := crypto.Seal(tokenKey, []byte(res.Token), []byte(req.Username))
+	sealedKey, err2 := crypto.Seal(tokenKey, dataKey, []byte(req.Username+"\x00sessionKey"))
+	sealedRefresh, err3 := crypto.Seal(tokenKey, []byte(res.RefreshToken), []byte(req.Username+"\x00refreshToken"))
+	if err1 != nil || err2 != nil || err3 != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al crear la sesión"}
+	}
+	res.Token = ""
+	res.Data = base64.StdEncoding.EncodeToString(sealed)
+	res.SessionKey = base64.StdEncoding.EncodeToString(sealedKey)
+	res.RefreshToken = base64.StdEncoding.EncodeToString(sealedRefresh)
+	return res
+}
+
+// opaqueReply serializa un mensaje OPAQUE en el campo Data de la respuesta.
+func opaqueReply(message string, msg any) api.Response {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al serializar el mensaje OPAQUE"}
+	}
+	return api.Response{Success: true, Message: message, Data: string(raw)}
+}
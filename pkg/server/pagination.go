@@ -0,0 +1,52 @@
+package server
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"prac/pkg/api"
+)
+
+// maxPageSize es el tamaño máximo de una página de un listado, pida lo
+// que pida Request.Limit.
+const maxPageSize = 200
+
+// paginate devuelve la página de 'items' que pide 'req' (ver
+// api.Request.Limit y Cursor) y el cursor de la siguiente, o "" si no hay
+// más. 'items' viene en el orden del listado, que es el de 'key' (de mayor
+// a menor si 'desc'); el cursor es la clave del último de la página, así
+// que las páginas no se descuadran si entre tanto aparecen o caducan
+// elementos. Sin Limit, la página es de 'def' elementos. Si el cursor o el
+// límite no son válidos, devuelve la respuesta de error y false.
+func paginate[T any](req api.Request, items []T, def int, desc bool, key func(T) string) ([]T, string, api.Response, bool) {
+	limit := def
+	switch {
+	case req.Limit < 0:
+		return nil, "", api.Response{Success: false, Code: api.ErrBadRequest, Message: fmt.Sprintf("Límite no válido: %d", req.Limit)}, false
+	case req.Limit > maxPageSize:
+		limit = maxPageSize
+	case req.Limit > 0:
+		limit = req.Limit
+	}
+	start := 0
+	if req.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(req.Cursor)
+		if err != nil {
+			return nil, "", api.Response{Success: false, Code: api.ErrBadRequest, Message: "Cursor no válido"}, false
+		}
+		cursor := string(raw)
+		for start < len(items) {
+			k := key(items[start])
+			if (!desc && k > cursor) || (desc && k < cursor) {
+				break
+			}
+			start++
+		}
+	}
+	items = items[start:]
+	if len(items) <= limit {
+		return items, "", api.Response{}, true
+	}
+	page := items[:limit]
+	return page, base64.RawURLEncoding.EncodeToString([]byte(key(page[limit-1]))), api.Response{}, true
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// passwordChangedNS guarda, por usuario, cuándo cambió la contraseña por
+// última vez (segundos Unix en decimal).
+const passwordChangedNS = "pwchanged"
+
+// touchPassword anota (a través de 'tx') que la contraseña de 'username'
+// acaba de cambiar.
+func (s *server) touchPassword(tx store.Tx, username string) error {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	return tx.Put(passwordChangedNS, s.userKey(username), []byte(now))
+}
+
+// passwordExpired indica si la contraseña de 'username' tiene más de
+// s.maxPwAge. Las cuentas sin fecha (anteriores a la caducidad) empiezan a
+// contar desde su primer login, en vez de caducar todas de golpe.
+func (s *server) passwordExpired(ctx context.Context, username string) bool {
+	if s.maxPwAge <= 0 {
+		return false
+	}
+	raw, err := s.db.Get(ctx, passwordChangedNS, s.userKey(username))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		// Sin poder leer la fecha no se obliga a nadie a cambiarla
+		s.logf(ctx, "error leyendo la fecha de contraseña de %s: %v", username, err)
+		return false
+	}
+	if err != nil {
+		if err := s.touchPassword(store.AsTx(ctx, s.db), username); err != nil {
+			s.logf(ctx, "error guardando la fecha de contraseña de %s: %v", username, err)
+		}
+		return false
+	}
+	return s.pastMaxAge(ctx, username, raw)
+}
+
+// pastMaxAge indica si la fecha de contraseña 'raw' (de passwordChangedNS)
+// de 'username' tiene más de s.maxPwAge.
+func (s *server) pastMaxAge(ctx context.Context, username string, raw []byte) bool {
+	secs, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		// Un registro ilegible no debe librar a nadie de cambiarla
+		s.logf(ctx, "fecha de contraseña corrupta para %s: %v", username, err)
+		return true
+	}
+	return time.Since(time.Unix(secs, 0)) > s.maxPwAge
+}
+
+// changePassword cambia la contraseña de un usuario con la sesión abierta.
+// Además del token se vuelve a pedir la contraseña actual, para que un token
+// robado no baste para quedarse con la cuenta: en cuentas clásicas se
+// comprueba Password; en cuentas SRP, la prueba M1 de un srpBegin previo.
+// La sesión se renueva (ver passwordChanged), así que cualquier otra copia
+// del token deja de valer.
+func (s *server) changePassword(ctx context.Context, req api.Request) api.Response {
+	key := s.userKey(req.Username)
+	hashed, err := s.db.Exists(ctx, "auth", key)
+	srp := false
+	if err == nil && !hashed {
+		srp, err = s.db.Exists(ctx, "srp", key)
+	}
+	if err != nil {
+		s.logf(ctx, "error consultando las credenciales de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al cambiar la contraseña"}
+	}
+	if hashed {
+		return s.changeHashedPassword(ctx, req)
+	}
+	if srp {
+		return s.changeSRPVerifier(ctx, req)
+	}
+	return api.Response{Success: false, Code: api.ErrNotSupported, Message: "El método de autenticación de la cuenta no permite cambiar la contraseña"}
+}
+
+// changeHashedPassword cambia el hash de 'auth' por el de NewPassword,
+// calculado con los parámetros Argon2 actuales (los de s.hasher).
+func (s *server) changeHashedPassword(ctx context.Context, req api.Request) api.Response {
+	if req.Password == "" || req.NewPassword == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan la contraseña actual o la nueva"}
+	}
+	if res, ok := s.recheckPassword(ctx, req.Username, req.Password); !ok {
+		return res
+	}
+	if crypto.ConstantTimeEqualString(req.Password, req.NewPassword) {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "La contraseña nueva debe ser distinta de la actual"}
+	}
+	if st := crypto.EstimatePasswordStrength(req.NewPassword, req.Username); !st.Acceptable() {
+		return api.Response{Success: false, Code: api.ErrWeakPassword, Message: weakPasswordMessage(st)}
+	}
+
+	hash, err := s.hasher.Hash(req.NewPassword)
+	if err != nil {
+		s.logf(ctx, "error derivando hash: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar credenciales"}
+	}
+	return s.passwordChanged(ctx, req, "auth", []byte(hash), api.Response{})
+}
+
+// changeSRPVerifier comprueba M1 contra el reto SRP en curso y guarda la
+// nueva sal y verificador. Como en el registro SRP, la robustez de la
+// contraseña nueva sólo puede comprobarla el cliente.
+func (s *server) changeSRPVerifier(ctx context.Context, req api.Request) api.Response {
+	if req.SRP == nil || req.SRP.M1 == "" || req.SRP.Salt == "" || req.SRP.Verifier == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan parámetros SRP"}
+	}
+	m1, err1 := base64.StdEncoding.DecodeString(req.SRP.M1)
+	salt, err2 := base64.StdEncoding.DecodeString(req.SRP.Salt)
+	verifier, err3 := base64.StdEncoding.DecodeString(req.SRP.Verifier)
+	if err1 != nil || err2 != nil || err3 != nil || len(salt) < crypto.SRPSaltSize || len(verifier) == 0 {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Parámetros SRP no válidos"}
+	}
+
+	p, ok := s.takeSRPPending(req.Username)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "No hay un login SRP en curso o ha caducado"}
+	}
+	m2, _, ok := p.srv.VerifyClient(m1)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrInvalidCredentials, Message: "Credenciales inválidas"}
+	}
+
+	raw, err := json.Marshal(srpRecord{Salt: salt, Verifier: verifier})
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar credenciales"}
+	}
+	return s.passwordChanged(ctx, req, "srp", raw, api.Response{
+		SRP: &api.SRPParams{M2: base64.StdEncoding.EncodeToString(m2)},
+	})
+}
+
+// passwordChanged guarda en una sola transacción la credencial nueva (en
+// 'credNS'), la fecha del cambio y la clave de datos envuelta con la
+// contraseña nueva (si viene), y completa la respuesta de éxito. Así no
+// puede quedar la contraseña cambiada con la clave de datos de la anterior.
+//
+// Después renueva la sesión (ver rotateSession): la respuesta lleva el
+// token, el token de refresco y la clave de sesión nuevos, y el resto de
+// sesiones que tuviera abiertas el usuario (con el token de antes, quizá
+// robado) se cierran. Si no se puede renovar, se cierra también la de la
+// petición.
+func (s *server) passwordChanged(ctx context.Context, req api.Request, credNS string, cred []byte, res api.Response) api.Response {
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		if err := tx.Put(credNS, s.userKey(req.Username), cred); err != nil {
+			return err
+		}
+		if err := s.touchPassword(tx, req.Username); err != nil {
+			return err
+		}
+		if req.DataKey != "" {
+			return tx.Put("datakeys", s.userKey(req.Username), []byte(req.DataKey))
+		}
+		return nil
+	})
+	if err != nil {
+		s.logf(ctx, "error guardando la contraseña nueva de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar credenciales"}
+	}
+	res.Success = true
+	res.Message = "Contraseña cambiada"
+
+	token, refresh, err := s.rotateSession(ctx, req.Username)
+	if err != nil {
+		s.logf(ctx, "error renovando la sesión de %s: %v", req.Username, err)
+		if err := s.closeSessions(ctx, req.Username); err != nil {
+			s.logf(ctx, "error cerrando la sesión de %s: %v", req.Username, err)
+		}
+		res.Message = "Contraseña cambiada; vuelve a iniciar sesión"
+		return res
+	}
+	key := s.sessionKey(token)
+	defer crypto.Wipe(key)
+	res.Token = token
+	res.SessionKey = base64.StdEncoding.EncodeToString(key)
+	res.RefreshToken = refresh
+	return res
+}
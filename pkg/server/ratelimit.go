@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"prac/pkg/api"
+)
+
+// maxBuckets es a partir de cuántos clientes vigilados a la vez se
+// olvidan los que ya han recuperado todo su margen.
+const maxBuckets = 10000
+
+// loginActions son los inicios de sesión que cuentan para
+// Config.LoginRateLimit: en los de varios pasos, sólo el primero.
+var loginActions = map[string]bool{
+	api.ActionLogin:              true,
+	api.ActionLoginRecovery:      true,
+	api.ActionCertLogin:          true,
+	api.ActionSRPBegin:           true,
+	api.ActionOPAQUELoginInit:    true,
+	api.ActionWebAuthnLoginBegin: true,
+}
+
+// rateLimiter limita las peticiones de cada cliente con un cubo de fichas:
+// cada petición gasta una, y se recuperan a 'rate' por segundo hasta
+// 'burst'. Un rateLimiter nil no limita nada.
+type rateLimiter struct {
+	rate  float64 // fichas por segundo
+	burst float64 // fichas como mucho (y al empezar)
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket son las fichas de un cliente la última vez que pidió algo.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter crea un rateLimiter de 'rate' fichas por segundo y
+// ráfagas de 'burst', o nil si 'rate' no es positivo.
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: rate, burst: float64(max(burst, 1)), buckets: make(map[string]*tokenBucket)}
+}
+
+// allow gasta una ficha de 'key'. Si no le quedan, devuelve false y cuánto
+// falta para la siguiente.
+func (l *rateLimiter) allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxBuckets {
+			l.forgetFull(now)
+		}
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// wait dice cuánto falta para que 'key' tenga una ficha (0 si ya la
+// tiene), sin gastarla.
+func (l *rateLimiter) wait(key string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+	tokens := b.tokens + time.Since(b.last).Seconds()*l.rate
+	if tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - tokens) / l.rate * float64(time.Second))
+}
+
+// exhausted dice si a alguno de los cubos de 'match' no le quedan fichas
+// ahora mismo.
+func (l *rateLimiter) exhausted(match func(key string) bool) bool {
+	if l == nil {
+		return false
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key, b := range l.buckets {
+		if match(key) && b.tokens+now.Sub(b.last).Seconds()*l.rate < 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetFull borra los cubos que a estas alturas ya estarían llenos: da
+// igual olvidarlos que no. Hay que llamarla con l.mu tomado.
+func (l *rateLimiter) forgetFull(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// withRateLimit es el middleware que frena a los clientes que piden
+// demasiado: como mucho Config.RateLimit peticiones por segundo de cada IP
+// y, en los inicios de sesión (loginActions), Config.LoginRateLimit por
+// minuto de cada IP y usuario, para que adivinar contraseñas salga caro.
+// Al que se pasa le responde ErrRateLimited con RetryAfter, sin atender la
+// petición.
+func (s *server) withRateLimit(next func(context.Context, api.Request) api.Response) func(context.Context, api.Request) api.Response {
+	return func(ctx context.Context, req api.Request) api.Response {
+		ip, _ := requestClient(ctx)
+		ok, wait := s.limiter.allow(ip)
+		if ok && loginActions[req.Action] {
+			ok, wait = s.loginLimiter.allow(ip + "\x00" + req.Username)
+		}
+		if !ok {
+			res := rateLimited(wait)
+			s.logf(ctx, "demasiadas peticiones de %s (%s): se le pide esperar %d s", ip, req.Action, res.RetryAfter)
+			return res
+		}
+		return next(ctx, req)
+	}
+}
+
+// rateLimited es la respuesta ErrRateLimited para quien debe esperar 'wait'.
+func rateLimited(wait time.Duration) api.Response {
+	retry := int(math.Ceil(wait.Seconds()))
+	return api.Response{
+		Success:    false,
+		Code:       api.ErrRateLimited,
+		Message:    fmt.Sprintf("Demasiadas peticiones; vuelve a intentarlo dentro de %d s", retry),
+		RetryAfter: retry,
+	}
+}
+
+// recheckPassword es checkPassword para las acciones que, con la sesión ya
+// abierta, piden otra vez la contraseña (cambiarla, borrar la cuenta,
+// reactivar 2FA). No son loginActions, pero quien tenga un token robado
+// podría usarlas para adivinar la contraseña, así que cada fallo gasta una
+// ficha de Config.LoginRateLimit de la misma IP y usuario, y con el cubo
+// vacío se rechazan sin comprobarla.
+func (s *server) recheckPassword(ctx context.Context, username, password string) (api.Response, bool) {
+	ip, _ := requestClient(ctx)
+	key := ip + "\x00" + username
+	if wait := s.loginLimiter.wait(key); wait > 0 {
+		s.logf(ctx, "demasiados fallos de contraseña de %s (%s)", username, ip)
+		return rateLimited(wait), false
+	}
+	res, ok := s.checkPassword(ctx, username, password)
+	if !ok && res.Code == api.ErrInvalidCredentials {
+		s.loginLimiter.allow(key)
+	}
+	return res, ok
+}
+
+// loginLocked dice si ahora mismo se rechazan, desde alguna IP, los
+// inicios de sesión de 'username' por haber agotado Config.LoginRateLimit.
+func (s *server) loginLocked(username string) bool {
+	return s.loginLimiter.exhausted(func(key string) bool {
+		_, user, _ := strings.Cut(key, "\x00")
+		return user == username
+	})
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// Un token de refresco es identificador de la sesión || "." || secreto
+// aleatorio. La sesión (ver sessionRecord) sólo guarda su hash (SHA-256),
+// así un volcado de la base de datos no permite renovar sesiones ajenas.
+
+// newRefreshToken genera un token de refresco para la sesión 'sid' y
+// devuelve también el hash con el que se guarda.
+func newRefreshToken(sid string) (token, hash string, err error) {
+	secret, err := crypto.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	token = sid + "." + secret
+	return token, hashRefresh(token), nil
+}
+
+// hashRefresh es el hash con el que se guarda un token de refresco.
+func hashRefresh(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshSession cambia un token de refresco por un token de sesión nuevo
+// (de la misma sesión) y otro token de refresco: cada uno sirve una sola
+// vez. Si llega uno ya usado, alguien más lo tiene (robado, o una copia
+// del cliente), así que se cierra la sesión para los dos. Como en login,
+// la respuesta lleva la clave de sesión del token nuevo. No necesita un
+// token de sesión válido: para eso sirve, para cuando ha caducado.
+func (s *server) refreshSession(ctx context.Context, req api.Request) api.Response {
+	expired := api.Response{Success: false, Code: api.ErrTokenExpired, Message: "Token de refresco inválido o sesión expirada"}
+	if req.Username == "" || req.RefreshToken == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+	if !s.certAllows(ctx, req.Username) {
+		return api.Response{Success: false, Code: api.ErrForbidden, Message: "El certificado de cliente no corresponde al usuario"}
+	}
+	sid, _, ok := strings.Cut(req.RefreshToken, ".")
+	if !ok || sid == "" {
+		return expired
+	}
+
+	// Dos renovaciones a la vez con el mismo token no pueden salir bien
+	// las dos, ni una renovación puede volver a abrir una sesión cerrada
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+
+	rec, err := s.getSession(ctx, req.Username, sid)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			s.logf(ctx, "error leyendo la sesión de %s: %v", req.Username, err)
+		}
+		return expired
+	}
+	presented := hashRefresh(req.RefreshToken)
+	if rec.Prev != "" && crypto.TokensEqual(presented, rec.Prev) {
+		s.logf(ctx, "token de refresco de %s reutilizado: se cierra la sesión", req.Username)
+		if err := s.db.Delete(ctx, sessionsNS, s.sessionEntry(req.Username, sid)); err != nil {
+			s.logf(ctx, "error cerrando la sesión de %s: %v", req.Username, err)
+		}
+		return expired
+	}
+	if !crypto.TokensEqual(presented, rec.Refresh) {
+		return expired
+	}
+
+	token, err := s.generateToken(req.Username, sid)
+	if err != nil {
+		s.logf(ctx, "error renovando la sesión de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al renovar la sesión"}
+	}
+	refresh, hash, err := newRefreshToken(sid)
+	if err != nil {
+		s.logf(ctx, "error renovando la sesión de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al renovar la sesión"}
+	}
+	// La sesión sigue abierta mientras se renueve antes de refrTTL
+	rec.Prev, rec.Refresh = rec.Refresh, hash
+	rec.LastSeen = time.Now().UTC()
+	if err := s.putSession(ctx, req.Username, sid, rec); err != nil {
+		s.logf(ctx, "error renovando la sesión de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al renovar la sesión"}
+	}
+
+	key := s.sessionKey(token)
+	defer crypto.Wipe(key)
+	return api.Response{
+		Success:      true,
+		Message:      "Sesión renovada",
+		Token:        token,
+		SessionKey:   base64.StdEncoding.EncodeToString(key),
+		RefreshToken: refresh,
+	}
+}
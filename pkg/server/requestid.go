@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"prac/pkg/api"
+)
+
+const (
+	maxRequestID      = 128 // longitud máxima de un identificador recibido
+	requestIDAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.:"
+	grpcRequestIDKey  = "x-request-id" // api.RequestIDHeader en los metadatos gRPC
+	traceparentHeader = "traceparent"  // cabecera de W3C Trace Context
+)
+
+// requestIDKey es la clave del contexto con el identificador de la
+// petición (ver api.RequestIDHeader).
+type requestIDKey struct{}
+
+// requestID devuelve el identificador de la petición de 'ctx', o "" si no
+// tiene.
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// newRequestID genera un identificador de petición: 128 bits aleatorios en
+// hexadecimal, como un trace-id de W3C.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// incomingRequestID elige el identificador de una petición a partir de lo
+// que manda el cliente: su 'id' (api.RequestIDHeader) si es válido; si
+// no, el trace-id de su 'traceparent', para que la petición quede en la
+// misma traza que el resto de la operación; y si tampoco, uno nuevo. Sólo
+// se aceptan caracteres que no pueden falsear el log.
+func incomingRequestID(id, traceparent string) string {
+	if len(id) > 0 && len(id) <= maxRequestID && strings.Trim(id, requestIDAlphabet) == "" {
+		return id
+	}
+	if trace := traceID(traceparent); trace != "" {
+		return trace
+	}
+	return newRequestID()
+}
+
+// traceID devuelve el trace-id de la cabecera 'traceparent'
+// ("00-<trace-id>-<parent-id>-<flags>"), o "" si no es válida.
+func traceID(traceparent string) string {
+	parts := strings.Split(traceparent, "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return ""
+	}
+	trace := parts[1]
+	if strings.Trim(trace, "0123456789abcdef") != "" || strings.Trim(trace, "0") == "" {
+		return ""
+	}
+	return trace
+}
+
+// withRequestID da a cada petición HTTP su identificador: lo pasa al
+// contexto y lo devuelve en la cabecera api.RequestIDHeader (y, con
+// writeResponse, en Response.RequestID).
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := incomingRequestID(r.Header.Get(api.RequestIDHeader), r.Header.Get(traceparentHeader))
+		w.Header().Set(api.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// grpcRequestID es withRequestID para las llamadas gRPC: el identificador
+// va y vuelve en los metadatos.
+func grpcRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	id := incomingRequestID(first(grpcRequestIDKey), first(traceparentHeader))
+	grpc.SetHeader(ctx, metadata.Pairs(grpcRequestIDKey, id))
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// logf escribe en el log como s.log.Printf, con el identificador de la
+// petición de 'ctx' delante si lo tiene.
+func (s *server) logf(ctx context.Context, format string, args ...any) {
+	if id := requestID(ctx); id != "" {
+		format, args = "[%s] "+format, append([]any{id}, args...)
+	}
+	s.log.Printf(format, args...)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"prac/pkg/api"
+)
+
+// restAction es lo que hace falta para servir una acción por su ruta REST
+// (api.Routes).
+type restAction struct {
+	handler func(context.Context, api.Request) api.Response
+	session bool // necesita el token de sesión en Authorization
+	ok      int  // estado HTTP si sale bien
+	fail    int  // estado HTTP si la petición no es válida
+}
+
+// restActions son las acciones de api.Routes.
+func (s *server) restActions() map[string]restAction {
+	return map[string]restAction{
+		api.ActionRegister:   {handler: s.registerUser, ok: http.StatusCreated, fail: http.StatusBadRequest},
+		api.ActionLogin:      {handler: s.loginUser, ok: http.StatusOK, fail: http.StatusUnauthorized},
+		api.ActionFetchData:  {handler: s.fetchData, session: true, ok: http.StatusOK, fail: http.StatusBadRequest},
+		api.ActionUpdateData: {handler: s.updateData, session: true, ok: http.StatusOK, fail: http.StatusBadRequest},
+		api.ActionLogout:     {handler: s.logoutUser, session: true, ok: http.StatusOK, fail: http.StatusBadRequest},
+		api.ActionRefresh:    {handler: s.refreshSession, ok: http.StatusOK, fail: http.StatusUnauthorized},
+		api.ActionServerInfo: {handler: s.serverInfo, ok: http.StatusOK, fail: http.StatusInternalServerError},
+	}
+}
+
+// restRoutes registra en 'mux' las rutas de api.Routes. Con los patrones
+// "MÉTODO /ruta", el mux ya responde 405 a los demás métodos.
+func (s *server) restRoutes(mux *http.ServeMux) {
+	for action, a := range s.restActions() {
+		rt := api.Routes[action]
+		mux.Handle(rt.Method+" "+rt.Path, s.restHandler(action, a))
+	}
+}
+
+// restHandler sirve 'action' por su ruta REST: monta la api.Request con el
+// cuerpo (o la query) y el token de Authorization, la pasa al mismo
+// manejador que /api y responde con la api.Response y un estado acorde.
+func (s *server) restHandler(action string, a restAction) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Sin cuerpo (logout, por ejemplo), la petición va vacía
+		var req api.Request
+		if r.Method == http.MethodGet {
+			q := r.URL.Query()
+			req.Sealed, _ = strconv.ParseBool(q.Get("sealed"))
+			req.Format = q.Get("format")
+			if typed, _ := strconv.ParseBool(q.Get("payload")); typed {
+				req.Payload = json.RawMessage("{}")
+			}
+		} else if err := decodeBody(r, &req); err != nil && !errors.Is(err, io.EOF) {
+			writeResponse(w, r, http.StatusBadRequest, api.Response{Success: false, Code: api.ErrBadRequest, Message: "Error en el formato " + bodyFormat(r)})
+			return
+		}
+		req.Action = action
+
+		ctx := r.Context()
+		var res api.Response
+		var status int
+		if a.session && !s.bearerSession(ctx, r, &req) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			res, status = api.Response{Success: false, Code: api.ErrTokenExpired, Message: "Token inválido o sesión expirada"}, http.StatusUnauthorized
+		} else {
+			res = s.withRateLimit(s.withPayload(a.handler))(ctx, req)
+			status = restStatus(res, a)
+		}
+
+		// Como en /api, la auditoría no depende de que el cliente siga ahí
+		s.record(context.WithoutCancel(ctx), req, res)
+		writeResponse(w, r, status, res)
+	})
+}
+
+// restCodeStatus es el estado HTTP de los errores (api.ErrorCode) que, por
+// ruta REST, no se responden con el estado de fallo de la acción.
+var restCodeStatus = map[api.ErrorCode]int{
+	api.ErrUserExists:  http.StatusConflict,
+	api.ErrConflict:    http.StatusConflict,
+	api.ErrInternal:    http.StatusInternalServerError,
+	api.ErrCorrupted:   http.StatusInternalServerError,
+	api.ErrRateLimited: http.StatusTooManyRequests,
+}
+
+// restStatus elige el estado HTTP de 'res' según su Code.
+func restStatus(res api.Response, a restAction) int {
+	if res.Success {
+		return a.ok
+	}
+	if status, ok := restCodeStatus[res.Code]; ok {
+		return status
+	}
+	return a.fail
+}
+
+// bearerSession pone en 'req' el token de Authorization y su usuario, y
+// comprueba como withSession que la sesión sigue abierta.
+func (s *server) bearerSession(ctx context.Context, r *http.Request, req *api.Request) bool {
+	req.Username, req.Token = "", bearerToken(r)
+	if req.Token == "" {
+		return false
+	}
+	claims, err := s.jwt.Verify(req.Token, time.Now())
+	if err != nil {
+		return false
+	}
+	req.Username = claims.Subject
+	return s.isTokenValid(ctx, req.Username, req.Token)
+}
+
+// bearerToken devuelve el token de "Authorization: Bearer <token>", o ""
+// si no lo hay.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"prac/pkg/crypto"
+)
+
+// sealFileVersion es la versión del formato del fichero de sellado.
+const sealFileVersion = 1
+
+// sealFile describe cómo se repartió la clave maestra. No contiene ningún
+// fragmento: sólo lo necesario para pedirlos y comprobar el resultado.
+type sealFile struct {
+	Version   int    `json:"version"`
+	Shares    int    `json:"shares"`
+	Threshold int    `json:"threshold"`
+	Check     []byte `json:"check"` // DeriveKey(clave maestra, "seal-check")
+}
+
+// SplitMasterKey reparte la clave maestra ya desbloqueada en 'shares'
+// fragmentos con umbral 'threshold' y guarda el fichero de sellado. A partir
+// de entonces el servidor arranca pidiendo fragmentos (ver UnlockMasterKey).
+// Devuelve los fragmentos en hexadecimal: se muestran una única vez y deben
+// entregarse cada uno a una persona distinta.
+func SplitMasterKey(cfg Config, shares, threshold int) ([]string, error) {
+	if len(cfg.MasterKey) != crypto.KeySize {
+		return nil, errors.New("clave maestra no disponible")
+	}
+	parts, err := crypto.SplitSecret(cfg.MasterKey, shares, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.MarshalIndent(sealFile{
+		Version:   sealFileVersion,
+		Shares:    shares,
+		Threshold: threshold,
+		Check:     crypto.DeriveKey(cfg.MasterKey, "seal-check"),
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	// Escritura atómica: un fichero de sellado a medias impediría arrancar
+	tmp := cfg.SealFile + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(cfg.SealFile), 0o700); err != nil {
+		return nil, fmt.Errorf("error creando el directorio del sellado: %v", err)
+	}
+	if err := os.WriteFile(tmp, raw, 0o600); err != nil {
+		return nil, fmt.Errorf("error escribiendo el fichero de sellado: %v", err)
+	}
+	if err := os.Rename(tmp, cfg.SealFile); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("error escribiendo el fichero de sellado: %v", err)
+	}
+
+	out := make([]string, len(parts))
+	for i, p := range parts {
+		out[i] = hex.EncodeToString(p)
+	}
+	return out, nil
+}
+
+// readSealFile carga el fichero de sellado. Devuelve nil, nil si no existe.
+func readSealFile(path string) (*sealFile, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo el fichero de sellado: %v", err)
+	}
+	var sf sealFile
+	if err := json.Unmarshal(raw, &sf); err != nil {
+		return nil, fmt.Errorf("fichero de sellado corrupto: %v", err)
+	}
+	if sf.Version != sealFileVersion || sf.Threshold < 2 || len(sf.Check) == 0 {
+		return nil, errors.New("fichero de sellado no soportado")
+	}
+	return &sf, nil
+}
+
+// unseal reconstruye la clave maestra a partir de los fragmentos de
+// cfg.UnsealShares o, si no hay, pidiéndolos uno a uno con 'prompt' hasta
+// alcanzar el umbral (como el "unseal" de Vault).
+func (cfg *Config) unseal(sf *sealFile, prompt func(string) []byte) error {
+	encoded := cfg.UnsealShares
+	if len(encoded) == 0 {
+		if prompt == nil {
+			return fmt.Errorf("el servidor está sellado: se necesitan %d fragmentos (%s)", sf.Threshold, envUnsealShares)
+		}
+		fmt.Printf("Servidor sellado: introduce %d de los %d fragmentos de la clave maestra.\n", sf.Threshold, sf.Shares)
+		for i := 1; i <= sf.Threshold; i++ {
+			encoded = append(encoded, string(prompt(fmt.Sprintf("Fragmento %d/%d", i, sf.Threshold))))
+		}
+	}
+	if len(encoded) < sf.Threshold {
+		return fmt.Errorf("se necesitan al menos %d fragmentos, hay %d", sf.Threshold, len(encoded))
+	}
+
+	shares := make([][]byte, len(encoded))
+	for i, e := range encoded {
+		sh, err := hex.DecodeString(strings.TrimSpace(e))
+		if err != nil {
+			return fmt.Errorf("el fragmento %d no es hexadecimal válido", i+1)
+		}
+		shares[i] = sh
+	}
+	key, err := crypto.CombineShares(shares)
+	crypto.Wipe(shares...)
+	if err != nil {
+		return err
+	}
+	if len(key) != crypto.KeySize || !crypto.ConstantTimeEqual(crypto.DeriveKey(key, "seal-check"), sf.Check) {
+		crypto.Wipe(key)
+		return errors.New("los fragmentos no reconstruyen la clave maestra")
+	}
+	cfg.MasterKey = key
+	return nil
+}
@@ -3,54 +3,300 @@
 package server
 
 import (
-	"encoding/json"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
-	"sync/atomic"
+	"sync"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
 
 	"prac/pkg/api"
+	"prac/pkg/audit"
+	"prac/pkg/crypto"
 	"prac/pkg/store"
 )
 
+// sweepInterval es cada cuánto se borran las entradas caducadas del store.
+const sweepInterval = time.Minute
+
+// purgeInterval es cada cuánto se eliminan las lápidas de store.DeleteSoft
+// que han pasado cfg.TrashRetention.
+const purgeInterval = time.Hour
+
 // server encapsula el estado de nuestro servidor
 type server struct {
-	db           store.Store // base de datos
-	log          *log.Logger // logger para mensajes de error e información
-	tokenCounter int64       // contador para generar tokens
+	db       store.Store              // base de datos
+	log      *log.Logger              // logger para mensajes de error e información
+	webauthn *webauthn.WebAuthn       // relying party para passkeys / FIDO2
+	hasher   *crypto.PasswordHasher   // hash de contraseñas (Argon2id + pepper)
+	key      []byte                   // clave maestra del servidor
+	userMAC  []byte                   // clave HMAC para las claves de usuario del store
+	users    *userIndex               // índice de los nombres de usersNS (ver usernameTaken)
+	sessKey  []byte                   // secreto para derivar las claves de sesión
+	audit    *audit.Log               // registro de auditoría encadenado
+	maxPwAge time.Duration            // caducidad de las contraseñas (0 = no caducan)
+	jwt      *crypto.JWTSigner        // firma y verifica los tokens de sesión
+	tokenTTL time.Duration            // validez de un token de sesión
+	refrTTL  time.Duration            // validez de un token de refresco (y de la sesión sin renovar)
+	metrics  *store.InstrumentedStore // cifras de las operaciones del motor
+	watch    *store.WatchStore        // avisos de cambios (el mismo Store que db)
+	admins   map[string]bool          // usuarios con rol de administrador
+	snapDir  string                   // directorio de las instantáneas (adminBackup)
+	push     *pushHub                 // avisos de las conexiones de api.EventsPath
+	mtls     string                   // modo de los certificados de cliente (Config.MTLS)
+	started  time.Time                // cuándo arrancó (ver serverInfo)
+	features []string                 // funciones activas (api.Feature*)
+
+	limiter      *rateLimiter // peticiones de cada IP (Config.RateLimit; nil: sin límite)
+	loginLimiter *rateLimiter // inicios de sesión de cada IP y usuario (Config.LoginRateLimit)
+
+	sessionsMu sync.Mutex // serializa los cambios de las sesiones (ver sessionsNS)
+	ceremonyMu sync.Mutex // serializa el alta de ceremonias WebAuthn (ver pruneCeremonies)
+
+	srpMu      sync.Mutex            // protege srpPending
+	srpPending map[string]srpPending // logins SRP a medias (sólo en memoria)
+
+	opaque        *crypto.OPAQUEServer     // nil si OPAQUE está deshabilitado
+	opaqueMu      sync.Mutex               // protege opaquePending
+	opaquePending map[string]opaquePending // logins OPAQUE a medias (sólo en memoria)
 }
 
 // Run inicia la base de datos y arranca el servidor HTTP.
-func Run() error {
-	// Abrimos la base de datos usando el motor bbolt
-	db, err := store.NewStore("bbolt", "data/server.db")
+// La configuración debe traer ya la clave maestra desbloqueada.
+func Run(cfg Config) error {
+	// El arranque no depende de ninguna petición que lo pueda cancelar
+	ctx := context.Background()
+
+	// No arrancamos con primitivas criptográficas que no dan los resultados esperados
+	if err := crypto.SelfTest(); err != nil {
+		return err
+	}
+	if len(cfg.MasterKey) != crypto.KeySize {
+		return fmt.Errorf("clave maestra no disponible (¿falta UnlockMasterKey?)")
+	}
+
+	// Abrimos la base de datos con el motor configurado (con los valores
+	// cifrados), midiendo las operaciones del motor para /metrics
+	logger := log.New(os.Stdout, "[srv] ", log.LstdFlags)
+	raw, err := newStore(cfg)
 	if err != nil {
 		return fmt.Errorf("error abriendo base de datos: %v", err)
 	}
+	if cfg.MirrorEngine != "" {
+		// Cada escritura se repite, ya cifrada, en la réplica
+		mirror, err := store.NewStore(cfg.MirrorEngine, cfg.MirrorPath)
+		if err != nil {
+			raw.Close()
+			return fmt.Errorf("error abriendo la réplica de la base de datos: %v", err)
+		}
+		raw = store.NewMirrorStore(raw, mirror, logger.Printf)
+	}
+	// Por debajo del cifrado, cada valor lleva su suma de comprobación: un
+	// valor dañado en disco se anota en el log como tal (store.ErrCorrupted)
+	metrics := store.NewInstrumentedStore(raw)
+	db, err := encryptStore(cfg, store.NewChecksumStore(metrics, logger.Printf))
+	if err != nil {
+		return err
+	}
+
+	// Ponemos los datos al día con el formato que espera esta versión
+	if err := runMigrations(ctx, db, cfg, logger.Printf); err != nil {
+		return err
+	}
+
+	// Abrimos el registro de auditoría (clave HMAC derivada de la maestra).
+	// Sus entradas sólo se pueden añadir por él: los handlers no pueden
+	// cambiarlas ni borrarlas
+	guarded := store.NewAppendOnlyStore(db, audit.Namespace)
+	events, err := guarded.Log(ctx, audit.Namespace)
+	if err != nil {
+		return fmt.Errorf("error abriendo registro de auditoría: %v", err)
+	}
+	auditLog, err := audit.New(ctx, events, crypto.DeriveKey(cfg.MasterKey, "audit"))
+	if err != nil {
+		return fmt.Errorf("error abriendo registro de auditoría: %v", err)
+	}
+
+	// TLS, si está configurado (cfg.TLSCert o cfg.TLSDir), para HTTP y gRPC
+	tlsCfg, pin, err := serverTLS(cfg)
+	if err != nil {
+		return fmt.Errorf("error configurando TLS: %v", err)
+	}
+
+	// Configuramos el relying party WebAuthn
+	wa, err := newWebAuthn(cfg.Addr, tlsCfg != nil)
+	if err != nil {
+		return fmt.Errorf("error configurando WebAuthn: %v", err)
+	}
+
+	// Firmador de los tokens de sesión (HS256 con clave derivada o RS256)
+	signer, err := newJWTSigner(cfg)
+	if err != nil {
+		return err
+	}
 
 	// Creamos nuestro servidor con su logger con prefijo 'srv'
+	// Los cambios que hacen los handlers se avisan a waitData (Watch)
+	watch := store.NewWatchStore(guarded)
+
+	users, err := newUserIndex(watch, cfg.MasterKey)
+	if err != nil {
+		return fmt.Errorf("error creando el índice de usuarios: %v", err)
+	}
+
 	srv := &server{
-		db:  db,
-		log: log.New(os.Stdout, "[srv] ", log.LstdFlags),
+		db:       watch,
+		watch:    watch,
+		log:      logger,
+		webauthn: wa,
+		hasher:   crypto.NewPasswordHasher(cfg.Argon2, cfg.Pepper),
+		key:      cfg.MasterKey,
+		userMAC:  crypto.DeriveKey(cfg.MasterKey, userKeyInfo),
+		users:    users,
+		sessKey:  crypto.DeriveKey(cfg.MasterKey, "session-data"),
+		audit:    auditLog,
+		maxPwAge: cfg.MaxPasswordAge,
+		jwt:      signer,
+		tokenTTL: cfg.SessionTTL,
+		refrTTL:  cfg.RefreshTTL,
+		metrics:  metrics,
+		admins:   make(map[string]bool),
+		snapDir:  cfg.SnapshotDir,
+		push:     newPushHub(),
+		mtls:     cfg.MTLS,
+		started:  time.Now().UTC(),
+		features: serverFeatures(cfg, tlsCfg != nil),
+
+		limiter:      newRateLimiter(float64(cfg.RateLimit), 2*cfg.RateLimit),
+		loginLimiter: newRateLimiter(float64(cfg.LoginRateLimit)/60, cfg.LoginRateLimit),
+
+		srpPending:    make(map[string]srpPending),
+		opaquePending: make(map[string]opaquePending),
+	}
+	for _, name := range cfg.Admins {
+		srv.admins[name] = true
+	}
+	if cfg.EnableOPAQUE {
+		srv.opaque = crypto.NewOPAQUEServer(cfg.MasterKey)
+	}
+	if len(cfg.Pepper) == 0 {
+		srv.log.Println("Aviso: sin pepper configurado; los hashes dependen sólo de la base de datos")
 	}
 
 	// Al terminar, cerramos la base de datos
 	defer srv.db.Close()
 
-	// Construimos un mux y asociamos /api a nuestro apiHandler,
+	if n, err := srv.userCount(ctx); err != nil {
+		srv.log.Printf("Aviso: no se han podido contar los usuarios: %v", err)
+	} else {
+		srv.log.Printf("Usuarios registrados: %d", n)
+	}
+
+	// Las sesiones y ceremonias caducadas se borran solas, y lo borrado
+	// con store.DeleteSoft se elimina pasada su retención (los barridos se
+	// paran antes de cerrar la base de datos)
+	stopSweeper := store.StartSweeper(db, sweepInterval, srv.log.Printf)
+	defer stopSweeper()
+	stopPurger := store.StartPurger(db, cfg.TrashRetention, purgeInterval, srv.log.Printf)
+	defer stopPurger()
+
+	// Construimos un mux y asociamos /api y /api/v2 a nuestro apiHandler,
+	// y las rutas REST (api.Routes) a las mismas acciones; el canal de
+	// avisos va aparte
 	mux := http.NewServeMux()
 	mux.Handle("/api", http.HandlerFunc(srv.apiHandler))
+	mux.Handle(api.APIPathV2, http.HandlerFunc(srv.apiHandler))
+	srv.restRoutes(mux)
+	mux.Handle("GET "+api.EventsPath, http.HandlerFunc(srv.eventsHandler))
+	if cfg.EnableMetrics {
+		mux.Handle("/metrics", http.HandlerFunc(srv.metricsHandler))
+	}
 
-	// Iniciamos el servidor HTTP.
-	err = http.ListenAndServe(":8080", mux)
+	// El servicio gRPC, si está configurado, escucha aparte
+	if cfg.GRPCAddr != "" {
+		stopGRPC, err := srv.serveGRPC(cfg.GRPCAddr, tlsCfg)
+		if err != nil {
+			return fmt.Errorf("error iniciando el servicio gRPC: %v", err)
+		}
+		defer stopGRPC()
+		srv.log.Printf("Servicio gRPC en %s", cfg.GRPCAddr)
+	}
 
-	return err
+	// Iniciamos el servidor HTTP, o HTTPS con TLS
+	httpSrv := &http.Server{Addr: cfg.Addr, Handler: withClientCert(withClientInfo(withRequestID(withCSRF(cfg.EnableCSRF, withGzip(cfg.GzipMin, mux))))), TLSConfig: tlsCfg}
+	if tlsCfg == nil {
+		return httpSrv.ListenAndServe()
+	}
+	srv.log.Printf("TLS activado; pin del certificado (PRAC_CLIENT_PIN): %s", pin)
+	if cfg.MTLS != "" {
+		srv.log.Printf("Certificados de cliente: %s", cfg.MTLS)
+	}
+	return httpSrv.ListenAndServeTLS("", "")
 }
 
-// apiHandler descodifica la solicitud JSON, la despacha
-// a la función correspondiente y devuelve la respuesta JSON.
+// newStore abre la base de datos de cfg.DBPath con el motor de
+// cfg.DBEngine (con bbolt, con las opciones de cfg.Bbolt).
+func newStore(cfg Config) (store.Store, error) {
+	if cfg.DBEngine == "bbolt" {
+		return store.NewBboltStoreWithOptions(cfg.DBPath, cfg.Bbolt)
+	}
+	return store.NewStore(cfg.DBEngine, cfg.DBPath)
+}
+
+// openStore abre la base de datos de cfg.DBPath envuelta en un
+// store.EncryptedStore, con una clave derivada de la maestra, la política
+// de algoritmos de cfg.Ciphers y las versiones de cfg.KeyVersions. Los registros anteriores al cifrado se
+// siguen leyendo y se cifran al reescribirse. Por debajo, como en Run,
+// los valores llevan su suma de comprobación (store.ChecksumStore).
+func openStore(cfg Config) (*store.EncryptedStore, error) {
+	db, err := newStore(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo base de datos: %v", err)
+	}
+	return encryptStore(cfg, store.NewChecksumStore(db, nil))
+}
+
+// openStoreReadOnly es openStore con la base de datos abierta en sólo
+// lectura (store.OpenReadOnly), para las herramientas de verificación e
+// inspección: cualquier escritura falla con store.ErrReadOnly.
+func openStoreReadOnly(cfg Config) (*store.EncryptedStore, error) {
+	db, err := store.OpenReadOnly(cfg.DBEngine, cfg.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo base de datos: %v", err)
+	}
+	return encryptStore(cfg, store.NewChecksumStore(db, nil))
+}
+
+// encryptStore envuelve 'db' como openStore; si falla, lo cierra.
+func encryptStore(cfg Config, db store.Store) (*store.EncryptedStore, error) {
+	key := crypto.DeriveKey(cfg.MasterKey, "store")
+	defer crypto.Wipe(key)
+	enc, err := store.NewEncryptedStore(db, key, store.EncryptedOptions{
+		Ciphers:        cfg.Ciphers,
+		KeyVersions:    cfg.KeyVersions,
+		AllowPlaintext: true,
+		CompressMin:    cfg.CompressMin,
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return enc, nil
+}
+
+// apiHandler descodifica la solicitud JSON (o CBOR, ver decodeBody), la
+// despacha a la función correspondiente y devuelve la respuesta en el
+// mismo formato (ver writeResponse). Es el endpoint
+// de siempre, con todas las acciones: las de api.Routes tienen además su
+// ruta REST (ver restHandler), y éste se mantiene mientras los clientes
+// antiguos lo sigan usando. En api.APIPathV2 es lo mismo, pero las
+// peticiones sin APIVersion son de la versión 2.
 func (s *server) apiHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
@@ -59,179 +305,701 @@ func (s *server) apiHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Decodificamos la solicitud en una estructura api.Request
 	var req api.Request
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Error en el formato JSON", http.StatusBadRequest)
+	if err := decodeBody(r, &req); err != nil {
+		http.Error(w, "Error en el formato "+bodyFormat(r), http.StatusBadRequest)
 		return
 	}
+	if req.APIVersion == 0 && r.URL.Path == api.APIPathV2 {
+		req.APIVersion = api.APIVersion2
+	}
+
+	// Despacho según la acción solicitada. El contexto de la petición se
+	// cancela si el cliente se desconecta, y con él las operaciones del store
+	ctx := r.Context()
+	res := s.dispatchVersion(ctx, req)
+
+	// Dejamos constancia de la acción y su resultado en la auditoría,
+	// aunque el cliente ya se haya desconectado
+	s.record(context.WithoutCancel(ctx), req, res)
 
-	// Despacho según la acción solicitada
+	// Enviamos la respuesta en el formato que pide el cliente
+	writeResponse(w, r, http.StatusOK, res)
+}
+
+// dispatch ejecuta la acción de 'req' con su manejador. Es el despacho de
+// la versión 1 del protocolo; dispatchVersion, que lo usa, es el de /api,
+// que comparten las demás vías de entrada (gRPC).
+func (s *server) dispatch(ctx context.Context, req api.Request) api.Response {
+	return s.withRateLimit(s.withPayload(s.handle))(ctx, req)
+}
+
+// handle llama al manejador de la acción de 'req', que ya viene con los
+// campos sueltos (ver withPayload).
+func (s *server) handle(ctx context.Context, req api.Request) api.Response {
 	var res api.Response
 	switch req.Action {
 	case api.ActionRegister:
-		res = s.registerUser(req)
+		res = s.registerUser(ctx, req)
 	case api.ActionLogin:
-		res = s.loginUser(req)
+		res = s.loginUser(ctx, req)
 	case api.ActionFetchData:
-		res = s.fetchData(req)
+		res = s.withSession(s.fetchData)(ctx, req)
 	case api.ActionUpdateData:
-		res = s.updateData(req)
+		res = s.withSession(s.updateData)(ctx, req)
+	case api.ActionListDataVersions:
+		res = s.withSession(s.listDataVersions)(ctx, req)
+	case api.ActionFetchDataVersion:
+		res = s.withSession(s.fetchDataVersion)(ctx, req)
+	case api.ActionListLogins:
+		res = s.withSession(s.listLogins)(ctx, req)
+	case api.ActionServerInfo:
+		res = s.serverInfo(ctx, req)
+	case api.ActionSendMessage:
+		res = s.withSession(s.sendMessage)(ctx, req)
+	case api.ActionFetchMessages:
+		res = s.withSession(s.fetchMessages)(ctx, req)
+	case api.ActionDeleteMessage:
+		res = s.withSession(s.deleteMessage)(ctx, req)
+	case api.ActionCreateGroup:
+		res = s.withSession(s.createGroup)(ctx, req)
+	case api.ActionAddGroupMember:
+		res = s.withSession(s.addGroupMember)(ctx, req)
+	case api.ActionRemoveGroupMember:
+		res = s.withSession(s.removeGroupMember)(ctx, req)
+	case api.ActionListGroups:
+		res = s.withSession(s.listGroups)(ctx, req)
+	case api.ActionFetchGroupData:
+		res = s.withSession(s.fetchGroupData)(ctx, req)
+	case api.ActionUpdateGroupData:
+		res = s.withSession(s.updateGroupData)(ctx, req)
+	case api.ActionUploadFileChunk:
+		res = s.withSession(s.uploadFileChunk)(ctx, req)
+	case api.ActionDownloadFileChunk:
+		res = s.withSession(s.downloadFileChunk)(ctx, req)
+	case api.ActionSetShareKey:
+		res = s.withSession(s.setShareKey)(ctx, req)
+	case api.ActionGetShareKey:
+		res = s.withSession(s.getShareKey)(ctx, req)
+	case api.ActionPublishKey:
+		res = s.withSession(s.publishKey)(ctx, req)
+	case api.ActionGetKey:
+		res = s.withSession(s.getKey)(ctx, req)
+	case api.ActionShareData:
+		res = s.withSession(s.shareData)(ctx, req)
+	case api.ActionUnshareData:
+		res = s.withSession(s.unshareData)(ctx, req)
+	case api.ActionListShared:
+		res = s.withSession(s.listShared)(ctx, req)
 	case api.ActionLogout:
-		res = s.logoutUser(req)
+		res = s.withSession(s.logoutUser)(ctx, req)
+	case api.ActionRefresh:
+		res = s.refreshSession(ctx, req)
+	case api.ActionListSessions:
+		res = s.withSession(s.listSessions)(ctx, req)
+	case api.ActionLogoutAll:
+		res = s.withSession(s.logoutAll)(ctx, req)
+	case api.ActionChangePassword:
+		res = s.withSession(s.changePassword)(ctx, req)
+	case api.ActionDeleteAccount:
+		res = s.withSession(s.deleteAccount)(ctx, req)
+	case api.ActionEnable2FA:
+		res = s.withSession(s.enable2FA)(ctx, req)
+	case api.ActionLoginRecovery:
+		res = s.loginRecovery(ctx, req)
+	case api.ActionCertLogin:
+		res = s.certLogin(ctx, req)
+	case api.ActionWebAuthnRegisterBegin:
+		res = s.withSession(s.webauthnRegisterBegin)(ctx, req)
+	case api.ActionWebAuthnRegisterFinish:
+		res = s.withSession(s.webauthnRegisterFinish)(ctx, req)
+	case api.ActionWebAuthnLoginBegin:
+		res = s.webauthnLoginBegin(ctx, req)
+	case api.ActionWebAuthnLoginFinish:
+		res = s.webauthnLoginFinish(ctx, req)
+	case api.ActionSRPRegister:
+		res = s.srpRegister(ctx, req)
+	case api.ActionSRPBegin:
+		res = s.srpBegin(ctx, req)
+	case api.ActionSRPVerify:
+		res = s.srpVerify(ctx, req)
+	case api.ActionOPAQUERegisterInit:
+		res = s.opaqueRegisterInit(ctx, req)
+	case api.ActionOPAQUERegisterFinish:
+		res = s.opaqueRegisterFinish(ctx, req)
+	case api.ActionOPAQUELoginInit:
+		res = s.opaqueLoginInit(ctx, req)
+	case api.ActionOPAQUELoginFinish:
+		res = s.opaqueLoginFinish(ctx, req)
+	case api.ActionWaitData:
+		res = s.withSession(s.waitData)(ctx, req)
+	case api.ActionAdminBackup:
+		res = s.withAdmin(s.adminBackup)(ctx, req)
+	case api.ActionAdminRestore:
+		res = s.withAdmin(s.adminRestore)(ctx, req)
+	case api.ActionAdminCompact:
+		res = s.withAdmin(s.adminCompact)(ctx, req)
+	case api.ActionAdminStats:
+		res = s.withAdmin(s.adminStats)(ctx, req)
+	case api.ActionListUsers:
+		res = s.withAdmin(s.listUsers)(ctx, req)
 	default:
-		res = api.Response{Success: false, Message: "Acción desconocida"}
+		res = api.Response{Success: false, Code: api.ErrUnknownAction, Message: "Acción desconocida"}
 	}
+	return res
+}
 
-	// Enviamos la respuesta en formato JSON
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(res)
+// withPayload es el middleware que pasa a los campos sueltos de la
+// petición su Payload, si lo trae, para que los manejadores no tengan que
+// distinguir, y devuelve entonces la respuesta también con Payload (ver
+// api.Request.PackPayload).
+func (s *server) withPayload(next func(context.Context, api.Request) api.Response) func(context.Context, api.Request) api.Response {
+	return func(ctx context.Context, req api.Request) api.Response {
+		if len(req.Payload) == 0 {
+			return next(ctx, req)
+		}
+		req, err := req.UnpackPayload()
+		if err != nil {
+			return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Payload no válido: " + err.Error()}
+		}
+		res := next(ctx, req)
+		if !res.Success {
+			return res
+		}
+		packed, err := res.PackPayload(req.Action)
+		if err != nil {
+			s.logf(ctx, "error preparando la respuesta a %s: %v", req.Action, err)
+			return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al preparar la respuesta"}
+		}
+		return packed
+	}
+}
+
+// withSession es el middleware de las acciones que necesitan sesión: sólo
+// llama a 'next' si la petición trae un token JWT válido para su usuario.
+func (s *server) withSession(next func(context.Context, api.Request) api.Response) func(context.Context, api.Request) api.Response {
+	return func(ctx context.Context, req api.Request) api.Response {
+		if req.Username == "" || req.Token == "" {
+			return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+		}
+		sid, rec, ok := s.tokenSession(ctx, req.Username, req.Token)
+		if !ok {
+			return api.Response{Success: false, Code: api.ErrTokenExpired, Message: "Token inválido o sesión expirada"}
+		}
+		if time.Since(rec.LastSeen) >= sessionTouch {
+			s.touchSession(ctx, req.Username, sid)
+		}
+		return next(ctx, req)
+	}
+}
+
+// withAdmin es como withSession, pero además sólo deja pasar a los
+// usuarios de cfg.Admins.
+func (s *server) withAdmin(next func(context.Context, api.Request) api.Response) func(context.Context, api.Request) api.Response {
+	return s.withSession(func(ctx context.Context, req api.Request) api.Response {
+		if !s.admins[req.Username] {
+			return api.Response{Success: false, Code: api.ErrForbidden, Message: "Acción reservada a los administradores"}
+		}
+		return next(ctx, req)
+	})
+}
+
+// record añade al registro de auditoría la acción y su resultado. No
+// apunta serverInfo, que no es de ningún usuario ni cambia nada: con las
+// comprobaciones de salud periódicas, llenaría el registro. Tampoco las
+// peticiones frenadas por withRateLimit, que ya van al log: quien insiste
+// llenaría el registro igual.
+func (s *server) record(ctx context.Context, req api.Request, res api.Response) {
+	if req.Action == api.ActionServerInfo || res.Code == api.ErrRateLimited {
+		return
+	}
+	result := "ok"
+	if !res.Success {
+		result = "error"
+	}
+	if err := s.audit.Append(ctx, req.Username, req.Action, result+": "+res.Message); err != nil {
+		s.logf(ctx, "error de auditoría: %v", err)
+	}
 }
 
-// generateToken crea un token único incrementando un contador interno (inseguro)
-func (s *server) generateToken() string {
-	id := atomic.AddInt64(&s.tokenCounter, 1) // atomic es necesario al haber paralelismo en las peticiones HTTP.
-	return fmt.Sprintf("token_%d", id)
+// generateToken firma un token de sesión JWT para 'username' con el
+// identificador de su sesión, 'id' (ver sessionsNS). Caduca
+// pasado tokenTTL; mientras la sesión siga abierta, refresh da otro.
+func (s *server) generateToken(username, id string) (string, error) {
+	role := roleUser
+	if s.admins[username] {
+		role = roleAdmin
+	}
+	now := time.Now()
+	return s.jwt.Sign(crypto.JWTClaims{
+		Issuer:   jwtIssuer,
+		Subject:  username,
+		Role:     role,
+		IssuedAt: now.Unix(),
+		Expiry:   now.Add(s.tokenTTL).Unix(),
+		ID:       id,
+	})
 }
 
 // registerUser registra un nuevo usuario, si no existe.
-// - Guardamos la contraseña en el namespace 'auth'
+// - Guardamos el hash Argon2id de la contraseña en el namespace 'auth'
+// - Guardamos su clave pública de firma (si la envía) en 'signkeys'
 // - Creamos entrada vacía en 'userdata' para el usuario
-func (s *server) registerUser(req api.Request) api.Response {
+func (s *server) registerUser(ctx context.Context, req api.Request) api.Response {
 	// Validación básica
 	if req.Username == "" || req.Password == "" {
-		return api.Response{Success: false, Message: "Faltan credenciales"}
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+	if isHashedKey([]byte(req.Username)) {
+		return reservedUsername
+	}
+
+	// Rechazamos contraseñas débiles (estimación tipo zxcvbn)
+	if st := crypto.EstimatePasswordStrength(req.Password, req.Username); !st.Acceptable() {
+		return api.Response{Success: false, Code: api.ErrWeakPassword, Message: weakPasswordMessage(st)}
 	}
 
-	// Verificamos si ya existe el usuario en 'auth'
-	exists, err := s.userExists(req.Username)
+	// La clave pública es opcional, pero si viene debe ser válida
+	pubKey, err := decodePublicKey(req.PublicKey)
 	if err != nil {
-		return api.Response{Success: false, Message: "Error al verificar usuario"}
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Clave pública no válida"}
+	}
+
+	// Verificamos si ya existe el usuario
+	exists, err := s.usernameTaken(ctx, req.Username)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al verificar usuario"}
 	}
 	if exists {
-		return api.Response{Success: false, Message: "El usuario ya existe"}
+		return api.Response{Success: false, Code: api.ErrUserExists, Message: "El usuario ya existe"}
 	}
 
-	// Almacenamos la contraseña en el namespace 'auth' (clave=nombre, valor=contraseña)
-	if err := s.db.Put("auth", []byte(req.Username), []byte(req.Password)); err != nil {
-		return api.Response{Success: false, Message: "Error al guardar credenciales"}
+	// Derivamos el hash de la contraseña; nunca se guarda en claro
+	hash, err := s.hasher.Hash(req.Password)
+	if err != nil {
+		s.logf(ctx, "error derivando hash: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar credenciales"}
 	}
 
-	// Creamos una entrada vacía para los datos en 'userdata'
-	if err := s.db.Put("userdata", []byte(req.Username), []byte("")); err != nil {
-		return api.Response{Success: false, Message: "Error al inicializar datos de usuario"}
+	// Almacenamos el hash en el namespace 'auth' (clave=nombre, valor=hash)
+	return s.initUserRecords(ctx, req.Username, "auth", []byte(hash), pubKey)
+}
+
+// initUserRecords da de alta a 'username' con la credencial 'cred' (en el
+// namespace de su método de autenticación) y crea el resto de sus
+// registros, todo en una transacción: si algo falla no queda un usuario a
+// medias que ya no se pueda volver a registrar.
+func (s *server) initUserRecords(ctx context.Context, username, credNS string, cred, pubKey []byte) api.Response {
+	msg := "Error al guardar credenciales"
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		if err := tx.Put(credNS, s.userKey(username), cred); err != nil {
+			return err
+		}
+		if pubKey != nil {
+			if err := tx.Put("signkeys", s.userKey(username), pubKey); err != nil {
+				msg = "Error al guardar la clave pública"
+				return err
+			}
+		}
+		if err := s.touchPassword(tx, username); err != nil {
+			return err
+		}
+		if err := s.putUserRecord(tx, username, time.Now().UTC()); err != nil {
+			return err
+		}
+		// Creamos una entrada vacía para los datos en 'userdata'
+		if err := tx.Put("userdata", s.userKey(username), []byte("")); err != nil {
+			msg = "Error al inicializar datos de usuario"
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		s.logf(ctx, "error dando de alta a %s: %v", username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: msg}
 	}
 
 	return api.Response{Success: true, Message: "Usuario registrado"}
 }
 
-// loginUser valida credenciales en el namespace 'auth' y genera un token en 'sessions'.
-func (s *server) loginUser(req api.Request) api.Response {
-	if req.Username == "" || req.Password == "" {
-		return api.Response{Success: false, Message: "Faltan credenciales"}
+// decodePublicKey decodifica (si viene) una clave pública Ed25519 en base64.
+func decodePublicKey(b64 string) ([]byte, error) {
+	if b64 == "" {
+		return nil, nil
 	}
-
-	// Recogemos la contraseña guardada en 'auth'
-	storedPass, err := s.db.Get("auth", []byte(req.Username))
+	raw, err := base64.StdEncoding.DecodeString(b64)
 	if err != nil {
-		return api.Response{Success: false, Message: "Usuario no encontrado"}
+		return nil, err
+	}
+	if _, err := crypto.ParsePublicKey(raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// weakPasswordMessage describe por qué se rechaza una contraseña.
+func weakPasswordMessage(st crypto.PasswordStrength) string {
+	msg := fmt.Sprintf("Contraseña demasiado débil (%s, %d/4; se necesita %d)",
+		st.Label(), st.Score, crypto.MinPasswordScore)
+	if len(st.Hints) > 0 {
+		msg += ": " + strings.Join(st.Hints, "; ")
+	}
+	return msg
+}
+
+// loginUser valida credenciales en el namespace 'auth' y abre una sesión (ver createSession).
+// Si el usuario tiene 2FA activado, exige además un código TOTP válido.
+func (s *server) loginUser(ctx context.Context, req api.Request) api.Response {
+	if req.Username == "" || req.Password == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
 	}
 
-	// Comparamos
-	if string(storedPass) != req.Password {
-		return api.Response{Success: false, Message: "Credenciales inválidas"}
+	if res, ok := s.checkPassword(ctx, req.Username, req.Password); !ok {
+		return res
 	}
 
-	// Generamos un nuevo token, lo guardamos en 'sessions'
-	token := s.generateToken()
-	if err := s.db.Put("sessions", []byte(req.Username), []byte(token)); err != nil {
-		return api.Response{Success: false, Message: "Error al crear sesión"}
+	if res, ok := s.checkSecondFactor(ctx, req.Username, req.Code); !ok {
+		return res
 	}
 
-	return api.Response{Success: true, Message: "Login exitoso", Token: token}
+	res := s.createSession(ctx, req, "Login exitoso")
+	res.MustChangePassword = res.Success && s.passwordExpired(ctx, req.Username)
+	return res
 }
 
-// fetchData verifica el token y retorna el contenido del namespace 'userdata'.
-func (s *server) fetchData(req api.Request) api.Response {
-	// Chequeo de credenciales
-	if req.Username == "" || req.Token == "" {
-		return api.Response{Success: false, Message: "Faltan credenciales"}
+// checkSecondFactor comprueba el código 2FA 'code' si el usuario lo tiene
+// activado. Si falla, devuelve también la respuesta que debe enviarse.
+func (s *server) checkSecondFactor(ctx context.Context, username, code string) (api.Response, bool) {
+	secret, enabled := s.totpSecret(ctx, username)
+	if !enabled {
+		return api.Response{}, true
+	}
+	if code == "" {
+		return api.Response{Success: false, Code: api.ErrTwoFactorRequired, Message: "Se requiere el código 2FA", TwoFactorRequired: true}, false
 	}
-	if !s.isTokenValid(req.Username, req.Token) {
-		return api.Response{Success: false, Message: "Token inválido o sesión expirada"}
+	if !crypto.VerifyTOTP(secret, code, time.Now()) {
+		return api.Response{Success: false, Code: api.ErrInvalidTwoFactor, Message: "Código 2FA incorrecto", TwoFactorRequired: true}, false
 	}
+	return api.Response{}, true
+}
 
-	// Obtenemos los datos asociados al usuario desde 'userdata'
-	rawData, err := s.db.Get("userdata", []byte(req.Username))
+// checkPassword comprueba la contraseña contra el hash guardado en 'auth'.
+// Si falla, devuelve también la respuesta que debe enviarse al cliente.
+// Fuera de los inicios de sesión, ver recheckPassword.
+func (s *server) checkPassword(ctx context.Context, username, password string) (api.Response, bool) {
+	// Recogemos el hash guardado en 'auth'
+	storedHash, err := s.db.Get(ctx, "auth", s.userKey(username))
+	if errors.Is(err, store.ErrNotFound) {
+		return api.Response{Success: false, Code: api.ErrUserNotFound, Message: "Usuario no encontrado"}, false
+	}
 	if err != nil {
-		return api.Response{Success: false, Message: "Error al obtener datos del usuario"}
+		s.logf(ctx, "error leyendo el hash de %s: %v", username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al verificar credenciales"}, false
 	}
 
-	return api.Response{
-		Success: true,
-		Message: "Datos privados de " + req.Username,
-		Data:    string(rawData),
+	// Comparamos (en tiempo constante) el hash recalculado con el almacenado
+	ok, err := s.hasher.Verify(password, string(storedHash))
+	if err != nil {
+		s.logf(ctx, "error verificando hash de %s: %v", username, err)
 	}
+	if err != nil || !ok {
+		return api.Response{Success: false, Code: api.ErrInvalidCredentials, Message: "Credenciales inválidas"}, false
+	}
+
+	// Aprovechamos la contraseña en claro para poner el hash al día si se
+	// han cambiado los parámetros de Argon2 (ver -calibrate) o el pepper
+	if s.hasher.NeedsRehash(string(storedHash)) {
+		if hash, err := s.hasher.Hash(password); err != nil {
+			s.logf(ctx, "error regenerando hash de %s: %v", username, err)
+		} else if err := s.db.Put(ctx, "auth", s.userKey(username), []byte(hash)); err != nil {
+			s.logf(ctx, "error guardando hash regenerado de %s: %v", username, err)
+		}
+	}
+	return api.Response{}, true
 }
 
-// updateData cambia el contenido de 'userdata' (los "datos" del usuario)
-// después de validar el token.
-func (s *server) updateData(req api.Request) api.Response {
-	// Chequeo de credenciales
-	if req.Username == "" || req.Token == "" {
-		return api.Response{Success: false, Message: "Faltan credenciales"}
+// createSession abre una sesión nueva (ver openSession): las que tuviera
+// abiertas el usuario en otros equipos siguen como estaban. La
+// respuesta incluye la clave de sesión derivada del token, con la que el
+// cliente puede cifrar Data mientras dure la sesión. El acceso queda en
+// el historial de listLogins con la acción de 'req' como método. Con
+// MTLSRequired, sólo se abre con el certificado de cliente del usuario.
+func (s *server) createSession(ctx context.Context, req api.Request, message string) api.Response {
+	username := req.Username
+	if !s.certAllows(ctx, username) {
+		return api.Response{Success: false, Code: api.ErrForbidden, Message: "El certificado de cliente no corresponde al usuario"}
 	}
-	if !s.isTokenValid(req.Username, req.Token) {
-		return api.Response{Success: false, Message: "Token inválido o sesión expirada"}
+	token, refresh, err := s.openSession(ctx, username)
+	if err != nil {
+		s.logf(ctx, "error creando la sesión de %s: %v", username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al crear sesión"}
 	}
 
-	// Escribimos el nuevo dato en 'userdata'
-	if err := s.db.Put("userdata", []byte(req.Username), []byte(req.Data)); err != nil {
-		return api.Response{Success: false, Message: "Error al actualizar datos del usuario"}
+	s.recordLogin(ctx, username, req.Action)
+	s.ensureUserRecord(ctx, username)
+
+	key := s.sessionKey(token)
+	defer crypto.Wipe(key)
+	res := api.Response{
+		Success:      true,
+		Message:      message,
+		Token:        token,
+		SessionKey:   base64.StdEncoding.EncodeToString(key),
+		RefreshToken: refresh,
 	}
+	// La clave de datos envuelta (si el usuario ya tiene) para que el
+	// cliente pueda descifrar sus datos; sin la contraseña no sirve de nada
+	if wrapped, err := s.db.Get(ctx, "datakeys", s.userKey(username)); err == nil {
+		res.DataKey = string(wrapped)
+	}
+	return res
+}
 
-	return api.Response{Success: true, Message: "Datos de usuario actualizados"}
+// sessionKey devuelve la clave de la sesión identificada por 'token'. No se
+// guarda: se recalcula en cada petición a partir del secreto del servidor,
+// y el llamante la borra con crypto.Wipe en cuanto deja de usarla.
+func (s *server) sessionKey(token string) []byte {
+	return crypto.SessionKey(s.sessKey, token)
 }
 
-// logoutUser borra la sesión en 'sessions', invalidando el token.
-func (s *server) logoutUser(req api.Request) api.Response {
-	// Chequeo de credenciales
-	if req.Username == "" || req.Token == "" {
-		return api.Response{Success: false, Message: "Faltan credenciales"}
+// waitDataTimeout es cuánto espera waitData antes de responder "Sin cambios".
+const waitDataTimeout = 25 * time.Second
+
+// waitData espera a que cambien los datos del usuario (un updateData desde
+// otra sesión, por ejemplo) sin consultar la base de datos: se suscribe a
+// su clave de 'userdata' con Watch. Sólo ve los cambios posteriores a la
+// llamada, así que el cliente la repite en cuanto vuelve.
+func (s *server) waitData(ctx context.Context, req api.Request) api.Response {
+	changes, cancel := s.watch.Watch("userdata", s.userKey(req.Username))
+	defer cancel()
+	timeout := time.NewTimer(waitDataTimeout)
+	defer timeout.Stop()
+	select {
+	case <-changes:
+		// También si el canal se ha cerrado: puede haberse perdido un cambio
+		return api.Response{Success: true, Message: "Datos actualizados"}
+	case <-timeout.C:
+		return api.Response{Success: false, Code: api.ErrNoChanges, Message: "Sin cambios"}
+	case <-ctx.Done():
+		return api.Response{Success: false, Code: api.ErrCanceled, Message: "Petición cancelada"}
 	}
-	if !s.isTokenValid(req.Username, req.Token) {
-		return api.Response{Success: false, Message: "Token inválido o sesión expirada"}
+}
+
+// fetchData retorna el contenido del namespace 'userdata',
+// junto con la firma y la clave pública del autor para que el cliente pueda
+// comprobar su autoría.
+func (s *server) fetchData(ctx context.Context, req api.Request) api.Response {
+	// Leemos de una vez los datos, la clave pública y la firma, para que
+	// las tres sean de la misma versión
+	key := s.userKey(req.Username)
+	values, err := store.GetMulti(ctx, s.db,
+		store.KeyRef{Namespace: "userdata", Key: key},
+		store.KeyRef{Namespace: "signkeys", Key: key},
+		store.KeyRef{Namespace: "signatures", Key: key},
+	)
+	if errors.Is(err, store.ErrCorrupted) {
+		// No es un fallo de la petición: los datos guardados están dañados
+		// (ya anotado por el ChecksumStore)
+		return api.Response{Success: false, Code: api.ErrCorrupted, Message: "Datos dañados en el servidor"}
 	}
+	if err != nil || values[0] == nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener datos del usuario"}
+	}
+	rawData, pub, sig := values[0], values[1], values[2]
 
-	// Borramos la entrada en 'sessions'
-	if err := s.db.Delete("sessions", []byte(req.Username)); err != nil {
-		return api.Response{Success: false, Message: "Error al cerrar sesión"}
+	res, ok := s.dataResponse(req, "Datos privados de "+req.Username, rawData)
+	if !ok {
+		return res
 	}
+	if len(pub) > 0 {
+		res.PublicKey = base64.StdEncoding.EncodeToString(pub)
+		if len(sig) > 0 {
+			res.Signature = base64.StdEncoding.EncodeToString(sig)
+		}
+	}
+	return res
+}
 
-	return api.Response{Success: true, Message: "Sesión cerrada correctamente"}
+// dataResponse devuelve la respuesta con 'rawData' en Data y, si el cliente
+// lo pide, cifrada con la clave de sesión. 'ok' es false si la respuesta es
+// de error.
+func (s *server) dataResponse(req api.Request, msg string, rawData []byte) (res api.Response, ok bool) {
+	res = api.Response{Success: true, Message: msg, Data: string(rawData)}
+	if req.Sealed {
+		key := s.sessionKey(req.Token)
+		sealed, err := crypto.SealSessionAs(req.Format, key, crypto.ToClient, req.Username, req.Action, rawData)
+		crypto.Wipe(key)
+		if errors.Is(err, crypto.ErrSessionFormat) {
+			return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Formato de datos cifrados no soportado"}, false
+		}
+		if err != nil {
+			return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al cifrar los datos"}, false
+		}
+		res.Data, res.Sealed, res.Format = sealed, true, req.Format
+	}
+	return res, true
 }
 
-// userExists comprueba si existe un usuario con la clave 'username'
-// en 'auth'. Si no se encuentra, retorna false.
-func (s *server) userExists(username string) (bool, error) {
-	_, err := s.db.Get("auth", []byte(username))
+// updateData cambia el contenido de 'userdata' (los "datos" del usuario) y
+// guarda cada versión en su historial (ver listDataVersions).
+// Si el usuario tiene clave de firma, exige una firma Ed25519 válida sobre
+// los datos y la guarda en 'signatures'.
+// Los datos tienen que llegar cifrados por el cliente (crypto.SealUserData):
+// el servidor sólo guarda texto cifrado y la firma se hace sobre él. La
+// primera vez, la petición trae también la clave de datos envuelta.
+// Con Expected, sólo escribe si los datos guardados siguen siendo esos.
+func (s *server) updateData(ctx context.Context, req api.Request) api.Response {
+	// Datos cifrados con la clave de sesión: sólo valen en esta sesión
+	data := []byte(req.Data)
+	if req.Sealed {
+		key := s.sessionKey(req.Token)
+		plain, err := crypto.OpenSessionAs(req.Format, key, crypto.ToServer, req.Username, req.Action, req.Data)
+		crypto.Wipe(key)
+		if errors.Is(err, crypto.ErrSessionFormat) {
+			return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Formato de datos cifrados no soportado"}
+		}
+		if err != nil {
+			return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Datos cifrados inválidos para esta sesión"}
+		}
+		data = plain
+	}
+	if len(data) > 0 && !crypto.IsSealedUserData(string(data)) {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Los datos deben llegar cifrados por el cliente"}
+	}
+
+	// Verificamos la firma (no repudio) antes de aceptar los datos
+	var sig []byte
+	if pub, ok := s.signingKey(ctx, req.Username); ok {
+		raw, err := base64.StdEncoding.DecodeString(req.Signature)
+		if err != nil || !crypto.VerifyUserData(pub, req.Username, data, raw) {
+			return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Firma de los datos ausente o inválida"}
+		}
+		sig = raw
+	}
+
+	// La clave de datos, los datos y su firma se guardan juntos: nunca debe
+	// quedar un dato con la firma (o la clave) de otro
+	code, msg := api.ErrInternal, "Error al actualizar datos del usuario"
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		// La clave de datos sólo se acepta si aún no hay ninguna: para
+		// sustituirla hay que volver a demostrar la contraseña (changePassword)
+		if req.DataKey != "" {
+			if _, err := tx.Get("datakeys", s.userKey(req.Username)); err == nil {
+				code, msg = api.ErrConflict, "El usuario ya tiene clave de datos; vuelve a iniciar sesión"
+				return errors.New("clave de datos ya guardada")
+			} else if !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+			if err := tx.Put("datakeys", s.userKey(req.Username), []byte(req.DataKey)); err != nil {
+				msg = "Error al guardar la clave de datos"
+				return err
+			}
+		}
+
+		// Si el cliente dice qué datos tenía, sólo escribimos si siguen
+		// siendo esos (concurrencia optimista)
+		if req.Expected != nil {
+			if err := store.CheckValue(tx, "userdata", s.userKey(req.Username), []byte(*req.Expected)); err != nil {
+				if errors.Is(err, store.ErrConflict) {
+					code, msg = api.ErrConflict, "Los datos han cambiado desde que los leíste; vuelve a consultarlos"
+				}
+				return err
+			}
+		}
+
+		// Escribimos el nuevo dato en 'userdata', guardando la versión en
+		// su historial
+		if _, err := store.PutVersionedTx(tx, "userdata", s.userKey(req.Username), data); err != nil {
+			return err
+		}
+		if sig != nil {
+			if err := tx.Put("signatures", s.userKey(req.Username), sig); err != nil {
+				msg = "Error al guardar la firma"
+				return err
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		// Si no existe namespace o la clave:
-		if strings.Contains(err.Error(), "bucket no encontrado: auth") {
-			return false, nil
+		return api.Response{Success: false, Code: code, Message: msg}
+	}
+
+	// Las demás sesiones del usuario que estén escuchando se enteran
+	s.push.publish(req.Username, s.sessionID(req.Token), api.Event{Type: api.EventDataChanged, Message: "Los datos se han cambiado desde otra sesión"})
+
+	return api.Response{Success: true, Message: "Datos de usuario actualizados"}
+}
+
+// logoutUser cierra la sesión de la petición (ver closeSession), invalidando
+// el token y el token de refresco. Las demás del usuario siguen abiertas.
+func (s *server) logoutUser(ctx context.Context, req api.Request) api.Response {
+	if err := s.closeSession(ctx, req.Username, s.sessionID(req.Token)); err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al cerrar sesión"}
+	}
+
+	return api.Response{Success: true, Message: "Sesión cerrada correctamente"}
+}
+
+// credNamespaces son los namespaces con las credenciales de los usuarios:
+// 'auth' (contraseña), 'srp' (verificador SRP) y 'opaque' (registro OPAQUE).
+// Cada usuario está en uno de ellos.
+var credNamespaces = []string{"auth", "srp", "opaque"}
+
+// userExists comprueba si existe un usuario con la clave 'username' en
+// alguno de los credNamespaces. Si no se encuentra, retorna false.
+func (s *server) userExists(ctx context.Context, username string) (bool, error) {
+	for _, ns := range credNamespaces {
+		if ok, err := s.db.Exists(ctx, ns, s.userKey(username)); ok || err != nil {
+			return ok, err
 		}
-		if err.Error() == "clave no encontrada: "+username {
-			return false, nil
+	}
+	return false, nil
+}
+
+// userCount devuelve cuántos usuarios hay registrados, contando las claves
+// de los credNamespaces sin leerlas.
+func (s *server) userCount(ctx context.Context) (int, error) {
+	total := 0
+	for _, ns := range credNamespaces {
+		n, err := s.db.CountKeys(ctx, ns)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return 0, err
 		}
-		return false, err
+		total += n
+	}
+	return total, nil
+}
+
+// signingKey devuelve la clave pública de firma del usuario, si la tiene.
+func (s *server) signingKey(ctx context.Context, username string) ([]byte, bool) {
+	pub, err := s.db.Get(ctx, "signkeys", s.userKey(username))
+	if err != nil || len(pub) == 0 {
+		return nil, false
 	}
-	return true, nil
+	return pub, true
+}
+
+// isTokenValid comprueba la firma y la caducidad del token, que sea de
+// 'username' y que su sesión siga abierta (su identificador es el de una
+// entrada de sessionsNS). Con MTLSRequired, la conexión tiene que traer
+// además el certificado de cliente de 'username' (ver certAllows).
+func (s *server) isTokenValid(ctx context.Context, username, token string) bool {
+	_, _, ok := s.tokenSession(ctx, username, token)
+	return ok
 }
 
-// isTokenValid comprueba que el token almacenado en 'sessions'
-// coincida con el token proporcionado.
-func (s *server) isTokenValid(username, token string) bool {
-	storedToken, err := s.db.Get("sessions", []byte(username))
+// tokenSession es isTokenValid, pero devuelve además el identificador y la
+// entrada de la sesión del token.
+func (s *server) tokenSession(ctx context.Context, username, token string) (string, sessionRecord, bool) {
+	if !s.certAllows(ctx, username) {
+		return "", sessionRecord{}, false
+	}
+	claims, err := s.jwt.Verify(token, time.Now())
+	if err != nil || claims.Subject != username {
+		return "", sessionRecord{}, false
+	}
+	rec, err := s.getSession(ctx, username, claims.ID)
 	if err != nil {
-		return false
+		return "", sessionRecord{}, false
 	}
-	return string(storedToken) == token
+	return claims.ID, rec, true
 }
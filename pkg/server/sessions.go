@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// sessionsNS guarda las sesiones abiertas. Las claves son userKey || "/" ||
+// identificador de la sesión (el ID de sus tokens), como en loginsNS: las
+// de un usuario van seguidas y se leen o se borran por su prefijo. Cada
+// entrada caduca si no se renueva antes de refrTTL.
+const sessionsNS = "sessions"
+
+const (
+	maxSessionsByUser = 10          // al abrir otra, se cierra la que lleve más tiempo sin usarse
+	sessionTouch      = time.Minute // cada cuánto, como mucho, se apunta la última actividad
+	maxDeviceLabel    = 128         // caracteres del User-Agent que se guardan
+)
+
+// sessionRecord es la entrada de una sesión en sessionsNS.
+type sessionRecord struct {
+	Device   string    // User-Agent del cliente que la abrió
+	IP       string    // desde la que se abrió
+	Created  time.Time // cuándo se abrió
+	LastSeen time.Time // última petición con ella (ver sessionTouch)
+	Refresh  string    // hash del token de refresco vigente (ver hashRefresh)
+	Prev     string    // hash del anterior, para detectar que se reutiliza
+}
+
+// sessionPrefix es el prefijo de las claves de las sesiones de 'username'.
+func (s *server) sessionPrefix(username string) []byte {
+	return append(s.userKey(username), '/')
+}
+
+// sessionEntry es la clave de la sesión 'sid' de 'username'.
+func (s *server) sessionEntry(username, sid string) []byte {
+	return append(s.sessionPrefix(username), sid...)
+}
+
+// getSession lee la sesión 'sid' de 'username'.
+func (s *server) getSession(ctx context.Context, username, sid string) (sessionRecord, error) {
+	var rec sessionRecord
+	raw, err := s.db.Get(ctx, sessionsNS, s.sessionEntry(username, sid))
+	if err != nil {
+		return rec, err
+	}
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		return rec, fmt.Errorf("sesión ilegible: %w", err)
+	}
+	return rec, nil
+}
+
+// putSession guarda la sesión 'sid' de 'username' hasta dentro de refrTTL.
+// Hay que llamarla con s.sessionsMu tomado (ver touchSession).
+func (s *server) putSession(ctx context.Context, username, sid string, rec sessionRecord) error {
+	raw, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return s.db.PutWithTTL(ctx, sessionsNS, s.sessionEntry(username, sid), raw, s.refrTTL)
+}
+
+// userSessions devuelve las sesiones abiertas de 'username' por su
+// identificador.
+func (s *server) userSessions(ctx context.Context, username string) (map[string]sessionRecord, error) {
+	prefix := s.sessionPrefix(username)
+	keys, err := s.db.KeysByPrefix(ctx, sessionsNS, prefix)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	sessions := make(map[string]sessionRecord, len(keys))
+	for _, k := range keys {
+		sid := string(k[len(prefix):])
+		rec, err := s.getSession(ctx, username, sid)
+		if errors.Is(err, store.ErrNotFound) {
+			continue // acaba de cerrarse
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions[sid] = rec
+	}
+	return sessions, nil
+}
+
+// openSession abre una sesión nueva de 'username' (sin tocar las demás) y
+// devuelve su token y su token de refresco. Si ya tiene maxSessionsByUser,
+// cierra antes la que lleve más tiempo sin usarse.
+func (s *server) openSession(ctx context.Context, username string) (token, refresh string, err error) {
+	sid, err := crypto.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+	if token, err = s.generateToken(username, sid); err != nil {
+		return "", "", err
+	}
+	refresh, hash, err := newRefreshToken(sid)
+	if err != nil {
+		return "", "", err
+	}
+	ip, device := requestClient(ctx)
+	now := time.Now().UTC()
+	rec := sessionRecord{Device: device, IP: ip, Created: now, LastSeen: now, Refresh: hash}
+
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	sessions, err := s.userSessions(ctx, username)
+	if err != nil {
+		return "", "", err
+	}
+	for len(sessions) >= maxSessionsByUser {
+		oldest := ""
+		for id, other := range sessions {
+			if oldest == "" || other.LastSeen.Before(sessions[oldest].LastSeen) {
+				oldest = id
+			}
+		}
+		if err := s.db.Delete(ctx, sessionsNS, s.sessionEntry(username, oldest)); err != nil && !errors.Is(err, store.ErrNotFound) {
+			return "", "", err
+		}
+		delete(sessions, oldest)
+	}
+	if err := s.putSession(ctx, username, sid, rec); err != nil {
+		return "", "", err
+	}
+	return token, refresh, nil
+}
+
+// rotateSession cierra todas las sesiones de 'username' y abre una nueva:
+// los tokens anteriores, en manos de quien estén, dejan de valer (y sus
+// canales de avisos se cierran con EventLogout).
+func (s *server) rotateSession(ctx context.Context, username string) (token, refresh string, err error) {
+	if err := s.closeSessions(ctx, username); err != nil {
+		return "", "", err
+	}
+	return s.openSession(ctx, username)
+}
+
+// sessionOpen indica si la sesión 'sid' de 'username' sigue abierta.
+func (s *server) sessionOpen(ctx context.Context, username, sid string) bool {
+	if sid == "" {
+		return false
+	}
+	ok, err := s.db.Exists(ctx, sessionsNS, s.sessionEntry(username, sid))
+	return err == nil && ok
+}
+
+// touchSession apunta en la sesión 'sid' de 'username' que se acaba de
+// usar, si no se ha hecho en el último sessionTouch. Si la sesión se ha
+// cerrado entretanto, no la vuelve a abrir.
+func (s *server) touchSession(ctx context.Context, username, sid string) {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	rec, err := s.getSession(ctx, username, sid)
+	if err != nil || time.Since(rec.LastSeen) < sessionTouch {
+		return
+	}
+	rec.LastSeen = time.Now().UTC()
+	if err := s.putSession(ctx, username, sid, rec); err != nil {
+		s.logf(ctx, "error apuntando la actividad de la sesión de %s: %v", username, err)
+	}
+}
+
+// closeSession cierra la sesión 'sid' de 'username': su token y su token
+// de refresco dejan de valer.
+func (s *server) closeSession(ctx context.Context, username, sid string) error {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	err := s.db.Delete(ctx, sessionsNS, s.sessionEntry(username, sid))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// closeSessions cierra todas las sesiones de 'username'.
+func (s *server) closeSessions(ctx context.Context, username string) error {
+	s.sessionsMu.Lock()
+	defer s.sessionsMu.Unlock()
+	_, err := s.db.DeleteByPrefix(ctx, sessionsNS, s.sessionPrefix(username))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// listSessions devuelve en Sessions las sesiones abiertas del usuario, de
+// la usada más recientemente a la que más tiempo lleva sin usarse, con la
+// de la petición marcada como Current.
+func (s *server) listSessions(ctx context.Context, req api.Request) api.Response {
+	sessions, err := s.userSessions(ctx, req.Username)
+	if err != nil {
+		s.logf(ctx, "error leyendo las sesiones de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener las sesiones"}
+	}
+	current := s.sessionID(req.Token)
+	res := api.Response{Success: true, Message: fmt.Sprintf("Sesiones abiertas: %d", len(sessions))}
+	for sid, rec := range sessions {
+		res.Sessions = append(res.Sessions, api.SessionInfo{
+			Device:   rec.Device,
+			IP:       rec.IP,
+			Created:  rec.Created,
+			LastSeen: rec.LastSeen,
+			Current:  sid == current,
+		})
+	}
+	sort.Slice(res.Sessions, func(i, j int) bool {
+		return res.Sessions[i].LastSeen.After(res.Sessions[j].LastSeen)
+	})
+	return res
+}
+
+// logoutAll cierra todas las sesiones del usuario, también la de la
+// petición. Sus canales de avisos se cierran con EventLogout.
+func (s *server) logoutAll(ctx context.Context, req api.Request) api.Response {
+	if err := s.closeSessions(ctx, req.Username); err != nil {
+		s.logf(ctx, "error cerrando las sesiones de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al cerrar las sesiones"}
+	}
+	return api.Response{Success: true, Message: "Se han cerrado todas las sesiones"}
+}
+
+// clientInfoKey es la clave del contexto con la IP y el User-Agent del
+// cliente (ver withClientInfo).
+type clientInfoKey struct{}
+
+// clientInfo es lo que se guarda de quien abre una sesión.
+type clientInfo struct {
+	IP     string
+	Device string
+}
+
+// withClientInfo pasa al contexto de cada petición HTTP la IP y el
+// User-Agent de su cliente. La IP es la de la conexión: el servidor no va
+// detrás de un proxy, así que no se mira X-Forwarded-For, que cualquiera
+// puede falsear.
+func withClientInfo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := clientInfo{IP: hostOnly(r.RemoteAddr), Device: r.UserAgent()}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientInfoKey{}, info)))
+	})
+}
+
+// requestClient devuelve la IP y el equipo (User-Agent, ya saneado) del
+// cliente de 'ctx', por HTTP (withClientInfo) o por gRPC.
+func requestClient(ctx context.Context) (ip, device string) {
+	info, ok := ctx.Value(clientInfoKey{}).(clientInfo)
+	if !ok {
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			info.IP = hostOnly(p.Addr.String())
+		}
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if ua := md.Get("user-agent"); len(ua) > 0 {
+				info.Device = ua[0]
+			}
+		}
+	}
+	return info.IP, deviceLabel(info.Device)
+}
+
+// hostOnly quita el puerto de 'addr', si lo tiene.
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// deviceLabel deja en 'ua' sólo caracteres imprimibles, hasta
+// maxDeviceLabel: lo manda el cliente y acaba en la pantalla de otro.
+func deviceLabel(ua string) string {
+	ua = strings.Map(func(r rune) rune {
+		if !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, ua)
+	if r := []rune(ua); len(r) > maxDeviceLabel {
+		ua = string(r[:maxDeviceLabel])
+	}
+	if ua == "" {
+		return "desconocido"
+	}
+	return ua
+}
@@ -0,0 +1,289 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// shareKeysNS guarda, por usuario, su clave de compartición (api.ShareKey
+// en JSON) tal como la publicó con setShareKey.
+const shareKeysNS = "sharekeys"
+
+// sharesNS es el namespace padre de lo compartido con cada usuario: el suyo
+// cuelga de él con su userKey (ver sharesNamespace) y guarda un
+// api.SharedItem por fichero, con clave shareEntryKey(dueño, fichero).
+// Quién puede leer un fichero lo dice su fileRecord (SharedWith); esto es
+// sólo el índice del destinatario, con la clave envuelta para él.
+const sharesNS = "shares"
+
+const (
+	maxFileShares  = 50  // usuarios con los que se puede compartir un fichero
+	maxWrappedKey  = 256 // bytes de una clave envuelta, ya decodificada
+	sharedItemsLen = 50  // ficheros por página de listShared si no se pide otra cosa
+)
+
+// sharesNamespace devuelve el namespace de lo compartido con 'username'.
+func (s *server) sharesNamespace(username string) string {
+	return sharesNS + store.NamespaceSep + string(s.userKey(username))
+}
+
+// shareEntryKey devuelve la clave, en el namespace del destinatario, del
+// fichero 'name' de 'owner'. Las dos partes son HMAC de longitud fija, así
+// que no hay ambigüedad.
+func (s *server) shareEntryKey(owner, name string) []byte {
+	return append(s.userKey(owner), s.fileKey(name)...)
+}
+
+// setShareKey publica la clave de compartición del usuario. Tiene que venir
+// firmada con su clave de firma, que el servidor ya conoce: así nadie puede
+// publicar otra en su nombre aunque le robe la sesión.
+func (s *server) setShareKey(ctx context.Context, req api.Request) api.Response {
+	if req.ShareKey == nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Falta la clave de compartición"}
+	}
+	key, err1 := base64.StdEncoding.DecodeString(req.ShareKey.Key)
+	sig, err2 := base64.StdEncoding.DecodeString(req.ShareKey.Signature)
+	if err1 != nil || err2 != nil || len(key) != 32 {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Clave de compartición no válida"}
+	}
+	signPub, ok := s.signingKey(ctx, req.Username)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrNotSupported, Message: "La cuenta no tiene clave de firma"}
+	}
+	if !crypto.VerifyShareKey(signPub, req.Username, key, sig) {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "La firma de la clave de compartición no es válida"}
+	}
+
+	raw, err := json.Marshal(req.ShareKey)
+	if err == nil {
+		err = s.db.Put(ctx, shareKeysNS, s.userKey(req.Username), raw)
+	}
+	if err != nil {
+		s.logf(ctx, "error guardando la clave de compartición de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar la clave de compartición"}
+	}
+	return api.Response{Success: true, Message: "Clave de compartición publicada"}
+}
+
+// getShareKey devuelve la clave de compartición de To y, en PublicKey, su
+// clave de firma, para que el cliente compruebe la firma antes de envolver
+// nada para ella.
+func (s *server) getShareKey(ctx context.Context, req api.Request) api.Response {
+	if req.To == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Falta el usuario"}
+	}
+	raw, err := s.db.Get(ctx, shareKeysNS, s.userKey(req.To))
+	var key api.ShareKey
+	if err == nil {
+		err = json.Unmarshal(raw, &key)
+	}
+	if errors.Is(err, store.ErrNotFound) {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "El usuario no existe o no ha publicado su clave de compartición"}
+	}
+	if err != nil {
+		s.logf(ctx, "error leyendo la clave de compartición de %s: %v", req.To, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener la clave de compartición"}
+	}
+	signPub, ok := s.signingKey(ctx, req.To)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "El usuario no tiene clave de firma"}
+	}
+	return api.Response{
+		Success:   true,
+		Message:   "Clave de compartición de " + req.To,
+		ShareKey:  &key,
+		PublicKey: base64.StdEncoding.EncodeToString(signPub),
+	}
+}
+
+// shareData da a To acceso de lectura al fichero File.Name del usuario y
+// le deja en su índice la clave del fichero envuelta para él (Data). Si ya
+// lo tenía, sólo se cambia la clave envuelta.
+func (s *server) shareData(ctx context.Context, req api.Request) api.Response {
+	if req.To == "" || req.File == nil || req.File.Name == "" || req.Data == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan el destinatario, el fichero o la clave envuelta"}
+	}
+	if req.To == req.Username {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "No puedes compartir un fichero contigo mismo"}
+	}
+	if wrapped, err := base64.StdEncoding.DecodeString(req.Data); err != nil || len(wrapped) > maxWrappedKey {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Clave envuelta no válida"}
+	}
+	exists, err := s.userExists(ctx, req.To)
+	if err != nil {
+		s.logf(ctx, "error comprobando el usuario %s: %v", req.To, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al compartir el fichero"}
+	}
+	if !exists {
+		return api.Response{Success: false, Code: api.ErrUserNotFound, Message: "Usuario no encontrado"}
+	}
+
+	name := req.File.Name
+	var errRes *api.Response
+	err = s.db.Batch(ctx, func(tx store.Tx) error {
+		errRes = nil
+		rec, err := s.getFile(tx, req.Username, name)
+		if errors.Is(err, store.ErrNotFound) || (err == nil && !rec.Complete) {
+			errRes = &api.Response{Success: false, Code: api.ErrNotFound, Message: "Fichero no encontrado"}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(rec.SharedWith, req.To) {
+			if len(rec.SharedWith) >= maxFileShares {
+				errRes = &api.Response{Success: false, Code: api.ErrQuotaExceeded, Message: fmt.Sprintf("Un fichero no se puede compartir con más de %d usuarios", maxFileShares)}
+				return nil
+			}
+			rec.SharedWith = append(rec.SharedWith, req.To)
+			if err := s.putFile(tx, req.Username, rec); err != nil {
+				return err
+			}
+		}
+		raw, err := json.Marshal(api.SharedItem{Owner: req.Username, File: name, Key: req.Data, Time: time.Now().UTC()})
+		if err != nil {
+			return err
+		}
+		return tx.Put(s.sharesNamespace(req.To), s.shareEntryKey(req.Username, name), raw)
+	})
+	if err != nil {
+		s.logf(ctx, "error compartiendo %q con %s: %v", name, req.To, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al compartir el fichero"}
+	}
+	if errRes != nil {
+		return *errRes
+	}
+	s.push.publish(req.To, "", api.Event{Type: api.EventShared, Message: fmt.Sprintf("%s ha compartido contigo el fichero %q", req.Username, name)})
+	return api.Response{Success: true, Message: "Fichero compartido con " + req.To}
+}
+
+// unshareData quita a To el acceso al fichero File.Name del usuario. La
+// clave envuelta desaparece de su índice, pero si ya la abrió, puede
+// haberla guardado: para que deje de servir hay que volver a subir el
+// fichero con otra clave.
+func (s *server) unshareData(ctx context.Context, req api.Request) api.Response {
+	if req.To == "" || req.File == nil || req.File.Name == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan el destinatario o el fichero"}
+	}
+	name := req.File.Name
+	var errRes *api.Response
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		errRes = nil
+		rec, err := s.getFile(tx, req.Username, name)
+		if err == nil && !slices.Contains(rec.SharedWith, req.To) {
+			err = store.ErrNotFound
+		}
+		if errors.Is(err, store.ErrNotFound) {
+			errRes = &api.Response{Success: false, Code: api.ErrNotFound, Message: "El fichero no está compartido con ese usuario"}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return s.unshareTx(tx, req.Username, rec, req.To)
+	})
+	if err != nil {
+		s.logf(ctx, "error dejando de compartir %q con %s: %v", name, req.To, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al dejar de compartir el fichero"}
+	}
+	if errRes != nil {
+		return *errRes
+	}
+	return api.Response{Success: true, Message: "Ya no compartes el fichero con " + req.To}
+}
+
+// unshareTx quita (a través de 'tx') a 'recipient' del fichero 'rec' de
+// 'owner' y su entrada del índice de 'recipient'.
+func (s *server) unshareTx(tx store.Tx, owner string, rec fileRecord, recipient string) error {
+	rec.SharedWith = slices.DeleteFunc(rec.SharedWith, func(u string) bool { return u == recipient })
+	if err := s.putFile(tx, owner, rec); err != nil {
+		return err
+	}
+	err := tx.Delete(s.sharesNamespace(recipient), s.shareEntryKey(owner, rec.Name))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// listShared devuelve en Shared los ficheros que otros usuarios han
+// compartido con el de la sesión, por dueño y nombre y por páginas (ver
+// paginate).
+func (s *server) listShared(ctx context.Context, req api.Request) api.Response {
+	items, err := s.sharedWith(ctx, req.Username)
+	if err != nil {
+		s.logf(ctx, "error leyendo los ficheros compartidos: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener los ficheros compartidos"}
+	}
+	items, next, errRes, ok := paginate(req, items, sharedItemsLen, false, func(it api.SharedItem) string {
+		return it.Owner + "\x00" + it.File
+	})
+	if !ok {
+		return errRes
+	}
+	return api.Response{Success: true, Message: fmt.Sprintf("Ficheros compartidos: %d", len(items)), Shared: items, NextCursor: next}
+}
+
+// sharedWith devuelve lo compartido con 'username', por dueño y nombre.
+func (s *server) sharedWith(ctx context.Context, username string) ([]api.SharedItem, error) {
+	var items []api.SharedItem
+	err := s.db.ForEach(ctx, s.sharesNamespace(username), func(key, value []byte) error {
+		var it api.SharedItem
+		if err := json.Unmarshal(value, &it); err != nil {
+			s.logf(ctx, "fichero compartido ilegible %s: %v", key, err)
+			return nil
+		}
+		items = append(items, it)
+		return nil
+	})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+	// Las claves son HMAC: su orden no es el de los nombres
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Owner != items[j].Owner {
+			return items[i].Owner < items[j].Owner
+		}
+		return items[i].File < items[j].File
+	})
+	return items, nil
+}
+
+// dropSharesTx deshace (a través de 'tx') todo lo compartido por y con
+// 'username' antes de borrar su cuenta: sus ficheros ('owned') salen del
+// índice de sus destinatarios y él, del SharedWith de los ficheros que
+// otros le compartieron ('received'). Así, si alguien se registra luego
+// con el mismo nombre, no hereda nada.
+func (s *server) dropSharesTx(tx store.Tx, username string, owned []fileRecord, received []api.SharedItem) error {
+	for _, rec := range owned {
+		for _, u := range rec.SharedWith {
+			err := tx.Delete(s.sharesNamespace(u), s.shareEntryKey(username, rec.Name))
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		}
+	}
+	for _, it := range received {
+		rec, err := s.getFile(tx, it.Owner, it.File)
+		if errors.Is(err, store.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.unshareTx(tx, it.Owner, rec, username); err != nil {
+			return err
+		}
+	}
+	return nil
+}
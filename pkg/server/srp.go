@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+)
+
+// srpTimeout es el tiempo máximo entre las dos rondas de un login SRP.
+const srpTimeout = 2 * time.Minute
+
+// srpRecord es lo que guardamos en el namespace 'srp' en lugar de un hash.
+type srpRecord struct {
+	Salt     []byte `json:"salt"`
+	Verifier []byte `json:"verifier"`
+}
+
+// srpPending es el estado de un login SRP entre la primera y la segunda
+// ronda. Contiene el secreto efímero b, así que nunca se persiste.
+type srpPending struct {
+	srv     *crypto.SRPServer
+	expires time.Time
+}
+
+// srpRegister da de alta un usuario a partir de su sal y verificador SRP.
+// El servidor nunca ve la contraseña, por lo que la robustez sólo puede
+// comprobarla el cliente.
+func (s *server) srpRegister(ctx context.Context, req api.Request) api.Response {
+	if req.Username == "" || req.SRP == nil || req.SRP.Salt == "" || req.SRP.Verifier == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+	if isHashedKey([]byte(req.Username)) {
+		return reservedUsername
+	}
+	salt, err1 := base64.StdEncoding.DecodeString(req.SRP.Salt)
+	verifier, err2 := base64.StdEncoding.DecodeString(req.SRP.Verifier)
+	if err1 != nil || err2 != nil || len(salt) < crypto.SRPSaltSize || len(verifier) == 0 {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Parámetros SRP no válidos"}
+	}
+	pubKey, err := decodePublicKey(req.PublicKey)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Clave pública no válida"}
+	}
+
+	exists, err := s.usernameTaken(ctx, req.Username)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al verificar usuario"}
+	}
+	if exists {
+		return api.Response{Success: false, Code: api.ErrUserExists, Message: "El usuario ya existe"}
+	}
+
+	raw, err := json.Marshal(srpRecord{Salt: salt, Verifier: verifier})
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar credenciales"}
+	}
+	return s.initUserRecords(ctx, req.Username, "srp", raw, pubKey)
+}
+
+// srpBegin procesa la primera ronda: recibe A y devuelve la sal y B.
+func (s *server) srpBegin(ctx context.Context, req api.Request) api.Response {
+	if req.Username == "" || req.SRP == nil || req.SRP.A == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+	A, err := base64.StdEncoding.DecodeString(req.SRP.A)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Parámetros SRP no válidos"}
+	}
+
+	raw, err := s.db.Get(ctx, "srp", s.userKey(req.Username))
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrUserNotFound, Message: "Usuario no encontrado"}
+	}
+	var rec srpRecord
+	if err := json.Unmarshal(raw, &rec); err != nil {
+		s.logf(ctx, "registro SRP corrupto para %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar el login SRP"}
+	}
+
+	srv, err := crypto.NewSRPServer(req.Username, rec.Salt, rec.Verifier, A)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Parámetros SRP no válidos"}
+	}
+
+	s.srpMu.Lock()
+	s.srpPending[req.Username] = srpPending{srv: srv, expires: time.Now().Add(srpTimeout)}
+	s.srpMu.Unlock()
+
+	// Avisamos ya del 2FA para que el cliente envíe el código en srpVerify
+	_, twoFactor := s.totpSecret(ctx, req.Username)
+	return api.Response{
+		Success:           true,
+		Message:           "Reto SRP generado",
+		TwoFactorRequired: twoFactor,
+		SRP: &api.SRPParams{
+			Salt: base64.StdEncoding.EncodeToString(rec.Salt),
+			B:    base64.StdEncoding.EncodeToString(srv.B()),
+		},
+	}
+}
+
+// srpVerify procesa la segunda ronda: comprueba M1 y, si es correcta,
+// devuelve M2 (para que el cliente autentique al servidor) y un token.
+func (s *server) srpVerify(ctx context.Context, req api.Request) api.Response {
+	if req.Username == "" || req.SRP == nil || req.SRP.M1 == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+	m1, err := base64.StdEncoding.DecodeString(req.SRP.M1)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Parámetros SRP no válidos"}
+	}
+
+	p, ok := s.takeSRPPending(req.Username)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "No hay un login SRP en curso o ha caducado"}
+	}
+
+	m2, _, ok := p.srv.VerifyClient(m1)
+	if !ok {
+		return api.Response{Success: false, Code: api.ErrInvalidCredentials, Message: "Credenciales inválidas"}
+	}
+
+	// Segundo factor (si está activado), igual que en el login clásico
+	if secret, enabled := s.totpSecret(ctx, req.Username); enabled {
+		if !crypto.VerifyTOTP(secret, req.Code, time.Now()) {
+			return api.Response{Success: false, Code: api.ErrInvalidTwoFactor, Message: "Código 2FA incorrecto o ausente", TwoFactorRequired: true}
+		}
+	}
+
+	res := s.createSession(ctx, req, "Login SRP exitoso")
+	if res.Success {
+		res.SRP = &api.SRPParams{M2: base64.StdEncoding.EncodeToString(m2)}
+		res.MustChangePassword = s.passwordExpired(ctx, req.Username)
+	}
+	return res
+}
+
+// takeSRPPending saca el reto SRP en curso de 'username', si no ha
+// caducado. Cada reto sólo se puede usar una vez.
+func (s *server) takeSRPPending(username string) (srpPending, bool) {
+	s.srpMu.Lock()
+	p, ok := s.srpPending[username]
+	delete(s.srpPending, username)
+	s.srpMu.Unlock()
+	return p, ok && time.Now().Before(p.expires)
+}
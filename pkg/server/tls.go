@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"prac/pkg/api"
+	"prac/pkg/tlsutil"
+)
+
+// Modos de Config.MTLS. Con los dos, un certificado de cliente de la CA
+// del proyecto identifica a su usuario por el CN y sirve para certLogin en
+// lugar de la contraseña; con MTLSRequired, además, sin certificado no hay
+// conexión, y las sesiones de un usuario sólo valen con el suyo.
+const (
+	MTLSOptional = "optional"
+	MTLSRequired = "required"
+)
+
+// tlsHosts son los nombres del certificado que se genera con cfg.TLSDir:
+// el servidor de prácticas se usa en la propia máquina.
+var tlsHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// tlsFiles devuelve el certificado y la clave TLS de 'cfg'. Con cfg.TLSDir
+// y sin certificado propio, genera en ese directorio la PKI del proyecto
+// la primera vez. Si el servidor va sin TLS, los dos están vacíos.
+func tlsFiles(cfg Config) (cert, key string, err error) {
+	if cfg.TLSCert != "" || cfg.TLSDir == "" {
+		return cfg.TLSCert, cfg.TLSKey, nil
+	}
+	p, err := tlsutil.EnsureCertificates(cfg.TLSDir, tlsHosts)
+	if err != nil {
+		return "", "", err
+	}
+	return p.ServerCert, p.ServerKey, nil
+}
+
+// serverTLS devuelve la configuración TLS del servidor (ver
+// tlsutil.ServerConfig) y el pin de su certificado, o nil si va sin TLS.
+func serverTLS(cfg Config) (*tls.Config, string, error) {
+	cert, key, err := tlsFiles(cfg)
+	if err != nil || cert == "" {
+		return nil, "", err
+	}
+	tlsCfg, err := tlsutil.ServerConfig(cert, key)
+	if err != nil {
+		return nil, "", err
+	}
+	if cfg.MTLS != "" {
+		ca := cfg.TLSClientCA
+		if ca == "" {
+			ca = tlsutil.PathsIn(cfg.TLSDir).CACert
+		}
+		if err := tlsutil.VerifyClients(tlsCfg, ca, cfg.MTLS == MTLSRequired); err != nil {
+			return nil, "", err
+		}
+	}
+	pin, err := tlsutil.CertificatePin(cert)
+	return tlsCfg, pin, err
+}
+
+// TLSPin devuelve el pin (tlsutil.SPKIPin) del certificado TLS del
+// servidor, para configurar con él los clientes (PRAC_CLIENT_PIN). Con
+// cfg.TLSDir, genera la PKI si aún no existe.
+func TLSPin(cfg Config) (string, error) {
+	_, pin, err := serverTLS(cfg)
+	if err == nil && pin == "" {
+		return "", fmt.Errorf("el servidor no tiene TLS (ver %s y %s)", envTLSCert, envTLSDir)
+	}
+	return pin, err
+}
+
+// IssueClientCertificate firma con la CA de cfg.TLSDir (la genera si aún
+// no existe) un certificado de cliente para 'username', para los clientes
+// de un servidor con mTLS (PRAC_CLIENT_CERT y PRAC_CLIENT_KEY).
+func IssueClientCertificate(cfg Config, username string) (cert, key string, err error) {
+	if cfg.TLSDir == "" {
+		return "", "", fmt.Errorf("hace falta la PKI del proyecto (%s)", envTLSDir)
+	}
+	if _, err := tlsutil.EnsureCertificates(cfg.TLSDir, tlsHosts); err != nil {
+		return "", "", err
+	}
+	return tlsutil.IssueClientCertificate(cfg.TLSDir, username)
+}
+
+// certUserKey es la clave del contexto con el usuario del certificado de
+// cliente (ver withClientCert).
+type certUserKey struct{}
+
+// withClientCert pasa al contexto de cada petición HTTP el usuario del
+// certificado de cliente verificado de su conexión, si lo hay.
+func withClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			if user := verifiedCN(*r.TLS); user != "" {
+				r = r.WithContext(context.WithValue(r.Context(), certUserKey{}, user))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// certUser devuelve el usuario del certificado de cliente de la conexión de
+// 'ctx', por HTTP (withClientCert) o por gRPC, o "" si no hay.
+func certUser(ctx context.Context) string {
+	if user, ok := ctx.Value(certUserKey{}).(string); ok {
+		return user
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			return verifiedCN(info.State)
+		}
+	}
+	return ""
+}
+
+// verifiedCN devuelve el CN del certificado de cliente de 'cs' si se ha
+// verificado contra la CA (tlsutil.VerifyClients), o "" si no.
+func verifiedCN(cs tls.ConnectionState) string {
+	if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return cs.VerifiedChains[0][0].Subject.CommonName
+}
+
+// certAllows indica si la conexión de 'ctx' puede actuar como 'username':
+// siempre, salvo con MTLSRequired, que pide el certificado de ese usuario.
+func (s *server) certAllows(ctx context.Context, username string) bool {
+	return s.mtls != MTLSRequired || certUser(ctx) == username
+}
+
+// certLogin abre una sesión para el usuario del certificado de cliente,
+// sin contraseña. Si la petición trae Username, tiene que ser ese. El
+// certificado sustituye a la contraseña, no al segundo factor.
+func (s *server) certLogin(ctx context.Context, req api.Request) api.Response {
+	user := certUser(ctx)
+	if user == "" {
+		return api.Response{Success: false, Code: api.ErrForbidden, Message: "Se requiere un certificado de cliente"}
+	}
+	if req.Username != "" && req.Username != user {
+		return api.Response{Success: false, Code: api.ErrForbidden, Message: "El certificado de cliente no corresponde al usuario"}
+	}
+	req.Username = user
+	exists, err := s.userExists(ctx, user)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al verificar usuario"}
+	}
+	if !exists {
+		return api.Response{Success: false, Code: api.ErrUserNotFound, Message: "Usuario no encontrado"}
+	}
+	if res, ok := s.checkSecondFactor(ctx, user, req.Code); !ok {
+		return res
+	}
+	res := s.createSession(ctx, req, "Login con certificado exitoso")
+	res.MustChangePassword = res.Success && s.passwordExpired(ctx, user)
+	return res
+}
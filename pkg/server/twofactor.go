@@ -0,0 +1,161 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// totpIssuer es el nombre con el que aparece la cuenta en la app de autenticación.
+const totpIssuer = "prac"
+
+// enable2FA activa el doble factor para el usuario autenticado:
+// - Guarda el secreto TOTP en el namespace 'totp'
+// - Guarda los hashes de los códigos de recuperación en 'recovery'
+// Los dos en la misma transacción, para que no quede uno sin el otro. Los
+// códigos en claro sólo se devuelven en esta respuesta. Si ya tenía 2FA,
+// volver a activarlo cambia el secreto y los códigos, así que no basta la
+// sesión (podría ser robada): hay que confirmarlo con la contraseña
+// (Password) o con un código TOTP actual (Code).
+func (s *server) enable2FA(ctx context.Context, req api.Request) api.Response {
+	if current, enabled := s.totpSecret(ctx, req.Username); enabled {
+		switch {
+		case req.Password != "":
+			if res, ok := s.recheckPassword(ctx, req.Username, req.Password); !ok {
+				return res
+			}
+		case req.Code != "":
+			if !crypto.VerifyTOTP(current, req.Code, time.Now()) {
+				return api.Response{Success: false, Code: api.ErrInvalidTwoFactor, Message: "Código 2FA incorrecto", TwoFactorRequired: true}
+			}
+		default:
+			return api.Response{Success: false, Code: api.ErrTwoFactorRequired, Message: "2FA ya está activado: confírmalo con la contraseña o un código 2FA", TwoFactorRequired: true}
+		}
+	}
+
+	secret, err := crypto.GenerateTOTPSecret()
+	if err != nil {
+		s.logf(ctx, "error generando secreto TOTP: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al activar 2FA"}
+	}
+	codes, err := crypto.GenerateRecoveryCodes(crypto.RecoveryCodeCount)
+	if err != nil {
+		s.logf(ctx, "error generando códigos de recuperación: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al activar 2FA"}
+	}
+
+	hashes := make([]string, len(codes))
+	for i, c := range codes {
+		hashes[i] = crypto.HashRecoveryCode(c)
+	}
+	raw, err := json.Marshal(hashes)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al activar 2FA"}
+	}
+	key := s.userKey(req.Username)
+	err = s.db.Batch(ctx, func(tx store.Tx) error {
+		if err := tx.Put("recovery", key, raw); err != nil {
+			return err
+		}
+		return tx.Put("totp", key, []byte(secret))
+	})
+	if err != nil {
+		s.logf(ctx, "error guardando el 2FA de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al activar 2FA"}
+	}
+
+	return api.Response{
+		Success:       true,
+		Message:       "2FA activado. Guarda los códigos de recuperación: no se volverán a mostrar",
+		Data:          crypto.TOTPURI(totpIssuer, req.Username, secret),
+		RecoveryCodes: codes,
+	}
+}
+
+// loginRecovery permite iniciar sesión con contraseña y un código de
+// recuperación en lugar del código TOTP. El código usado queda invalidado:
+// se busca y se quita en la misma transacción, así que dos logins a la vez
+// con el mismo código no pueden salir bien los dos.
+func (s *server) loginRecovery(ctx context.Context, req api.Request) api.Response {
+	if req.Username == "" || req.Password == "" || req.Code == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+
+	if res, ok := s.checkPassword(ctx, req.Username, req.Password); !ok {
+		return res
+	}
+
+	key := s.userKey(req.Username)
+	target := crypto.HashRecoveryCode(req.Code)
+	var errRes *api.Response
+	left := 0
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		errRes = nil
+		hashes, err := loadRecoveryHashes(tx, key)
+		if err != nil {
+			errRes = &api.Response{Success: false, Code: api.ErrNotFound, Message: "El usuario no tiene códigos de recuperación"}
+			return nil
+		}
+
+		// Buscamos el código recorriendo siempre la lista completa
+		found := -1
+		for i, h := range hashes {
+			if crypto.ConstantTimeEqualString(h, target) {
+				found = i
+			}
+		}
+		if found < 0 {
+			errRes = &api.Response{Success: false, Code: api.ErrInvalidCredentials, Message: "Código de recuperación inválido"}
+			return nil
+		}
+
+		// Invalidamos el código antes de crear la sesión
+		hashes = append(hashes[:found], hashes[found+1:]...)
+		left = len(hashes)
+		raw, err := json.Marshal(hashes)
+		if err != nil {
+			return err
+		}
+		return tx.Put("recovery", key, raw)
+	})
+	if err != nil {
+		s.logf(ctx, "error actualizando códigos de recuperación: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al invalidar el código de recuperación"}
+	}
+	if errRes != nil {
+		return *errRes
+	}
+
+	res := s.createSession(ctx, req,
+		fmt.Sprintf("Login con código de recuperación (quedan %d)", left))
+	res.MustChangePassword = res.Success && s.passwordExpired(ctx, req.Username)
+	return res
+}
+
+// totpSecret devuelve el secreto TOTP del usuario y si tiene 2FA activado.
+func (s *server) totpSecret(ctx context.Context, username string) (string, bool) {
+	secret, err := s.db.Get(ctx, "totp", s.userKey(username))
+	if err != nil || len(secret) == 0 {
+		return "", false
+	}
+	return string(secret), true
+}
+
+// loadRecoveryHashes lee la lista de hashes de códigos de recuperación
+// guardada con la clave 'key' (ver userKey).
+func loadRecoveryHashes(tx store.Tx, key []byte) ([]string, error) {
+	raw, err := tx.Get("recovery", key)
+	if err != nil {
+		return nil, err
+	}
+	var hashes []string
+	if err := json.Unmarshal(raw, &hashes); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
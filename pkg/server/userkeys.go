@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// userKeyInfo es el propósito HKDF de la clave con la que se calculan las
+// claves de usuario en el store.
+const userKeyInfo = "user-keys"
+
+// migratePageSize es cuántas claves lee MigrateUserKeys de cada vez.
+const migratePageSize = 500
+
+// userNamespaces son los namespaces cuyas claves son nombres de usuario.
+var userNamespaces = []string{
+	"auth", "srp", "opaque", "userdata", "signkeys", "signatures",
+	"totp", "recovery", "webauthn", passwordChangedNS,
+	"datakeys", usersNS, shareKeysNS, inboxCountNS,
+}
+
+// userKey devuelve la clave del store para 'username': HMAC-SHA256 con una
+// clave derivada de la maestra, en hexadecimal. Así un volcado de la base de
+// datos no revela qué usuarios tienen cuenta (sin la clave maestra tampoco
+// se puede comprobar si un nombre concreto está registrado). El registro de
+// auditoría, en cambio, sigue guardando el nombre: su función es identificar
+// quién hizo cada acción.
+func (s *server) userKey(username string) []byte {
+	return hashUsername(s.userMAC, username)
+}
+
+func hashUsername(macKey []byte, username string) []byte {
+	m := hmac.New(sha256.New, macKey)
+	m.Write([]byte(username))
+	return []byte(hex.EncodeToString(m.Sum(nil)))
+}
+
+// reservedUsername es la respuesta al registro de un nombre con el formato
+// de userKey (ver isHashedKey).
+var reservedUsername = api.Response{Success: false, Code: api.ErrBadRequest, Message: "Ese nombre de usuario no está permitido"}
+
+// isHashedKey indica si 'key' tiene ya el formato de userKey (64 caracteres
+// hexadecimales en minúscula). Un nombre de usuario así se confundiría con
+// uno ya migrado y se quedaría en claro, así que el registro no los admite
+// (reservedUsername).
+func isHashedKey(key []byte) bool {
+	if len(key) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range key {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// MigrateUserKeys reescribe las claves en claro de los namespaces de usuario
+// con su HMAC (ver userKey). Las claves ya migradas se dejan como están, de
+// modo que se puede ejecutar varias veces. Devuelve cuántas ha movido.
+// Pensado para ejecutarse desde la línea de comandos con el servidor parado.
+// bbolt no sobrescribe las páginas liberadas, así que los nombres antiguos
+// pueden seguir en el fichero hasta que se reutilicen o se compacte.
+func MigrateUserKeys(cfg Config) (int, error) {
+	ctx := context.Background()
+	db, err := openStore(cfg)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+	return migrateUserKeys(ctx, db, crypto.DeriveKey(cfg.MasterKey, userKeyInfo))
+}
+
+// migrateUserKeys es MigrateUserKeys sobre una base de datos ya abierta.
+func migrateUserKeys(ctx context.Context, db store.Store, macKey []byte) (int, error) {
+	moved := 0
+	for _, ns := range userNamespaces {
+		// Por páginas, para no cargar todas las claves de golpe. Las claves
+		// nuevas que aparecen detrás del cursor ya están en hex y se saltan.
+		var cursor []byte
+		for {
+			keys, next, err := db.ListKeysPage(ctx, ns, cursor, migratePageSize)
+			if err != nil {
+				if errors.Is(err, store.ErrNotFound) {
+					break
+				}
+				return moved, err
+			}
+			for _, k := range keys {
+				if isHashedKey(k) {
+					continue
+				}
+				value, err := db.Get(ctx, ns, k)
+				if err != nil {
+					return moved, err
+				}
+				// Primero escribimos la nueva clave: si se interrumpe, la
+				// siguiente ejecución sólo repite el borrado
+				if err := db.Put(ctx, ns, hashUsername(macKey, string(k)), value); err != nil {
+					return moved, err
+				}
+				if err := db.Delete(ctx, ns, k); err != nil {
+					return moved, err
+				}
+				moved++
+			}
+			if next == nil {
+				break
+			}
+			cursor = next
+		}
+	}
+	return moved, nil
+}
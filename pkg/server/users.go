@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// usersNS guarda, por usuario (userKey), su nombre y la fecha de alta
+// (userRecord): las claves de los demás namespaces son HMAC del nombre y no
+// dicen de quién son, así que sin él listUsers no sabría qué mostrar. Los
+// valores, como todos, van cifrados en el store.
+const usersNS = "users"
+
+// usersShown es cuántos devuelve listUsers por página si no se le pide
+// otra cosa.
+const usersShown = 50
+
+// usersByNameNS es el índice ciego de los nombres de usersNS (ver
+// userIndex): permite saber si ya hay una cuenta con un nombre equivalente
+// sin descifrar todos los registros.
+const usersByNameNS = "users_by_name"
+
+// userRecord es el valor de usersNS.
+type userRecord struct {
+	Username string    `json:"username"`
+	Created  time.Time `json:"created,omitempty"` // cero en las cuentas de antes de usersNS
+}
+
+// userIndex agrupa el índice de los nombres de usuario y el Indexer que lo
+// mantiene al escribir en usersNS.
+type userIndex struct {
+	names   *crypto.BlindIndex
+	byName  *store.FieldIndex
+	records *store.Indexer
+}
+
+// newUserIndex crea el índice de los nombres de usersNS sobre 'db'. Los
+// nombres se normalizan (crypto.NormalizeField), así que "Ana" y " ana "
+// comparten entrada.
+func newUserIndex(db store.Store, master []byte) (*userIndex, error) {
+	names, err := crypto.NewBlindIndex(master, "username", crypto.DefaultBlindIndexBits)
+	if err != nil {
+		return nil, err
+	}
+	byName := store.NewFieldIndex(db, usersByNameNS, names.Compute)
+	records := store.NewIndexer(usersNS).Index(byName, func(record []byte) (string, bool) {
+		var rec userRecord
+		if err := json.Unmarshal(record, &rec); err != nil || rec.Username == "" {
+			return "", false
+		}
+		return rec.Username, true
+	})
+	return &userIndex{names: names, byName: byName, records: records}, nil
+}
+
+// rebuildUserIndex indexa las cuentas que ya había en usersNS antes de
+// usersByNameNS.
+func rebuildUserIndex(ctx context.Context, db *store.EncryptedStore, cfg Config) (int, error) {
+	ix, err := newUserIndex(db, cfg.MasterKey)
+	if err != nil {
+		return 0, err
+	}
+	return ix.records.Rebuild(ctx, db)
+}
+
+// putUserRecord anota (a través de 'tx') el alta de 'username' en 'at', con
+// su entrada en usersByNameNS.
+func (s *server) putUserRecord(tx store.Tx, username string, at time.Time) error {
+	raw, err := json.Marshal(userRecord{Username: username, Created: at})
+	if err != nil {
+		return err
+	}
+	return s.users.records.Put(tx, s.userKey(username), raw)
+}
+
+// usernameTaken indica si 'username' ya está registrado (userExists) o si
+// hay otra cuenta cuyo nombre sólo se diferencia en mayúsculas o espacios,
+// que se buscan en usersByNameNS. Los candidatos se descifran para
+// descartar las colisiones del índice.
+func (s *server) usernameTaken(ctx context.Context, username string) (bool, error) {
+	if ok, err := s.userExists(ctx, username); ok || err != nil {
+		return ok, err
+	}
+	matches, err := s.users.byName.Lookup(ctx, username, func(key []byte) (bool, error) {
+		raw, err := s.db.Get(ctx, usersNS, key)
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil // entrada de una cuenta ya borrada
+		}
+		if err != nil {
+			return false, err
+		}
+		var rec userRecord
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return false, nil
+		}
+		return s.users.names.Matches(rec.Username, username), nil
+	})
+	return len(matches) > 0, err
+}
+
+// ensureUserRecord anota en usersNS, sin fecha de alta, a los usuarios
+// registrados antes de que existiera, para que aparezcan en listUsers desde
+// su primer login. Si falla, sólo se registra el error.
+func (s *server) ensureUserRecord(ctx context.Context, username string) {
+	ok, err := s.db.Exists(ctx, usersNS, s.userKey(username))
+	if err == nil && !ok {
+		err = s.putUserRecord(store.AsTx(ctx, s.db), username, time.Time{})
+	}
+	if err != nil {
+		s.logf(ctx, "error anotando a %s en %s: %v", username, usersNS, err)
+	}
+}
+
+// listUsers devuelve en Users las cuentas registradas cuyo nombre empieza
+// por Prefix, por orden de nombre y por páginas (ver paginate). Sólo se
+// completa la información de las de la página.
+func (s *server) listUsers(ctx context.Context, req api.Request) api.Response {
+	var records []userRecord
+	err := s.db.ForEach(ctx, usersNS, func(key, value []byte) error {
+		var rec userRecord
+		if err := json.Unmarshal(value, &rec); err != nil {
+			s.logf(ctx, "usuario ilegible %s: %v", key, err)
+			return nil
+		}
+		if strings.HasPrefix(rec.Username, req.Prefix) {
+			records = append(records, rec)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		s.logf(ctx, "error leyendo los usuarios: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener los usuarios"}
+	}
+	// Las claves son HMAC: su orden no es el de los nombres
+	sort.Slice(records, func(i, j int) bool { return records[i].Username < records[j].Username })
+
+	records, next, errRes, ok := paginate(req, records, usersShown, false, func(r userRecord) string {
+		return r.Username
+	})
+	if !ok {
+		return errRes
+	}
+	res := api.Response{Success: true, Message: fmt.Sprintf("Usuarios: %d", len(records)), NextCursor: next}
+	for _, rec := range records {
+		info, err := s.userInfo(ctx, rec)
+		if err != nil {
+			s.logf(ctx, "error leyendo los datos de %s: %v", rec.Username, err)
+			return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener los usuarios"}
+		}
+		res.Users = append(res.Users, info)
+	}
+	return res
+}
+
+// credMethods es el método de autenticación de cada uno de los
+// credNamespaces, tal como aparece en api.UserInfo.
+var credMethods = map[string]string{"auth": "password", "srp": "srp", "opaque": "opaque"}
+
+// userInfo completa la api.UserInfo de 'rec' con su credencial, su último
+// inicio de sesión, si la contraseña ha caducado y si está bloqueada
+// (loginLocked). No escribe nada: a diferencia de passwordExpired, una
+// cuenta sin fecha de contraseña se da por no caducada sin empezar a
+// contar.
+func (s *server) userInfo(ctx context.Context, rec userRecord) (api.UserInfo, error) {
+	info := api.UserInfo{Username: rec.Username, Created: rec.Created, Locked: s.loginLocked(rec.Username)}
+	key := s.userKey(rec.Username)
+	for _, ns := range credNamespaces {
+		ok, err := s.db.Exists(ctx, ns, key)
+		if err != nil {
+			return info, err
+		}
+		if ok {
+			info.Method = credMethods[ns]
+			break
+		}
+	}
+
+	last, err := s.db.LastN(ctx, loginsNS, s.loginPrefix(rec.Username), 1)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return info, err
+	}
+	if len(last) > 0 {
+		var login api.LoginRecord
+		if err := json.Unmarshal(last[0].Value, &login); err == nil {
+			info.LastLogin = login.Time
+		}
+	}
+
+	if s.maxPwAge > 0 {
+		raw, err := s.db.Get(ctx, passwordChangedNS, key)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			return info, err
+		}
+		if err == nil {
+			info.PasswordExpired = s.pastMaxAge(ctx, rec.Username, raw)
+		}
+	}
+	return info, nil
+}
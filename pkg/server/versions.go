@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"prac/pkg/api"
+	"prac/pkg/store"
+)
+
+// listDataVersions devuelve en Versions las versiones guardadas de los
+// datos del usuario (store.PutVersioned), de la más antigua a la actual,
+// por páginas (ver paginate; sin Limit, todas las que caben en una).
+func (s *server) listDataVersions(ctx context.Context, req api.Request) api.Response {
+	versions, err := store.ListVersions(ctx, s.db, "userdata", s.userKey(req.Username))
+	if err != nil {
+		s.logf(ctx, "error listando las versiones de los datos: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener el historial de datos"}
+	}
+	versions, next, errRes, ok := paginate(req, versions, maxPageSize, false, func(v store.Version) string {
+		return fmt.Sprintf("%020d", v.Number)
+	})
+	if !ok {
+		return errRes
+	}
+	res := api.Response{Success: true, Message: fmt.Sprintf("Versiones guardadas: %d", len(versions)), NextCursor: next}
+	for _, v := range versions {
+		res.Versions = append(res.Versions, api.DataVersion{Version: v.Number, Time: v.Time, Size: v.Size})
+	}
+	return res
+}
+
+// fetchDataVersion devuelve la versión req.Version de los datos del usuario,
+// como fetchData. No lleva firma: 'signatures' sólo guarda la de la versión
+// actual, y el cifrado con la clave de datos ya protege su integridad.
+func (s *server) fetchDataVersion(ctx context.Context, req api.Request) api.Response {
+	rawData, _, err := store.GetVersion(ctx, s.db, "userdata", s.userKey(req.Username), req.Version)
+	if errors.Is(err, store.ErrNotFound) {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "Versión no encontrada"}
+	}
+	if errors.Is(err, store.ErrCorrupted) {
+		return api.Response{Success: false, Code: api.ErrCorrupted, Message: "Datos dañados en el servidor"}
+	}
+	if err != nil {
+		s.logf(ctx, "error leyendo una versión de los datos: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al obtener datos del usuario"}
+	}
+	res, _ := s.dataResponse(req, fmt.Sprintf("Versión %d de los datos de %s", req.Version, req.Username), rawData)
+	return res
+}
@@ -0,0 +1,353 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+
+	"prac/pkg/api"
+	"prac/pkg/crypto"
+	"prac/pkg/store"
+)
+
+// Parámetros del "relying party" WebAuthn. El origen (ver webauthnOrigin)
+// sale de la dirección de escucha.
+const (
+	webauthnRPName      = "prac"
+	webauthnUserIDBytes = 32
+
+	// webauthnSessionsNS guarda el estado de las ceremonias en curso, por
+	// usuario y reto (ceremonyKey).
+	webauthnSessionsNS = "webauthn_sessions"
+
+	// webauthnCeremonyTTL es cuánto se guarda el estado de una ceremonia
+	// (lo mismo que la librería da por defecto al navegador para completarla).
+	webauthnCeremonyTTL = 5 * time.Minute
+
+	// webauthnMaxCeremonies es cuántas ceremonias puede tener en curso un
+	// usuario: webauthnLoginBegin no pide sesión, así que sin tope
+	// cualquiera podría llenarle webauthnSessionsNS.
+	webauthnMaxCeremonies = 5
+)
+
+// webauthnUser es el registro que guardamos en el namespace 'webauthn'
+// e implementa la interfaz webauthn.User de la librería.
+type webauthnUser struct {
+	Name        string                `json:"name"`
+	ID          []byte                `json:"id"` // user handle aleatorio (no revela el nombre)
+	Credentials []webauthn.Credential `json:"credentials"`
+}
+
+func (u *webauthnUser) WebAuthnID() []byte                         { return u.ID }
+func (u *webauthnUser) WebAuthnName() string                       { return u.Name }
+func (u *webauthnUser) WebAuthnDisplayName() string                { return u.Name }
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential { return u.Credentials }
+
+// newWebAuthn crea la configuración del relying party para un servidor
+// que escucha en 'addr', con el origen https si usa TLS.
+func newWebAuthn(addr string, useTLS bool) (*webauthn.WebAuthn, error) {
+	rpID, origin, err := webauthnOrigin(addr, useTLS)
+	if err != nil {
+		return nil, err
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: webauthnRPName,
+		RPOrigins:     []string{origin},
+	})
+}
+
+// webauthnOrigin devuelve el RP ID y el origen que verá el navegador de
+// un servidor que escucha en 'addr' (Config.Addr). El RP ID tiene que ser
+// un nombre de dominio: si 'addr' no lo trae (":8080") o es una IP, se
+// usa "localhost". El puerto sólo va en el origen si no es el del esquema.
+func webauthnOrigin(addr string, useTLS bool) (rpID, origin string, err error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", fmt.Errorf("dirección de escucha no válida %q: %v", addr, err)
+	}
+	if host == "" || net.ParseIP(host) != nil {
+		host = "localhost"
+	}
+	scheme, defPort := "http", "80"
+	if useTLS {
+		scheme, defPort = "https", "443"
+	}
+	origin = scheme + "://" + host
+	if port != defPort {
+		origin += ":" + port
+	}
+	return host, origin, nil
+}
+
+// webauthnRegisterBegin inicia la ceremonia de registro de una credencial
+// para el usuario autenticado. Devuelve en Data las opciones (JSON) que el
+// navegador debe pasar a navigator.credentials.create().
+func (s *server) webauthnRegisterBegin(ctx context.Context, req api.Request) api.Response {
+	user, err := s.loadWebAuthnUser(ctx, req.Username, true)
+	if err != nil {
+		s.logf(ctx, "error cargando usuario webauthn: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar el registro WebAuthn"}
+	}
+
+	// Excluimos las credenciales ya registradas para no duplicarlas
+	excl := make([]protocol.CredentialDescriptor, len(user.Credentials))
+	for i, c := range user.Credentials {
+		excl[i] = c.Descriptor()
+	}
+	options, session, err := s.webauthn.BeginRegistration(user, webauthn.WithExclusions(excl))
+	if err != nil {
+		s.logf(ctx, "error en BeginRegistration: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar el registro WebAuthn"}
+	}
+
+	// Guardamos el usuario (por si es nuevo) y el estado de la ceremonia
+	if err := s.saveWebAuthnUser(ctx, user); err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar el registro WebAuthn"}
+	}
+	return s.beginCeremony(ctx, req.Username, options, session)
+}
+
+// webauthnRegisterFinish valida la respuesta del autenticador
+// (Data = JSON de PublicKeyCredential) y guarda la nueva credencial.
+func (s *server) webauthnRegisterFinish(ctx context.Context, req api.Request) api.Response {
+	if req.Data == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+
+	user, err := s.loadWebAuthnUser(ctx, req.Username, false)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "No hay un registro WebAuthn en curso"}
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(strings.NewReader(req.Data))
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Respuesta WebAuthn mal formada"}
+	}
+	session, err := s.takeCeremony(ctx, req.Username, parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "No hay un registro WebAuthn en curso"}
+	}
+	cred, err := s.webauthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		s.logf(ctx, "error validando registro webauthn de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInvalidCredentials, Message: "Credencial WebAuthn rechazada"}
+	}
+
+	user.Credentials = append(user.Credentials, *cred)
+	if err := s.saveWebAuthnUser(ctx, user); err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al guardar la credencial WebAuthn"}
+	}
+	return api.Response{Success: true, Message: "Credencial WebAuthn registrada"}
+}
+
+// webauthnLoginBegin inicia un login sin contraseña. Devuelve en Data las
+// opciones para navigator.credentials.get().
+func (s *server) webauthnLoginBegin(ctx context.Context, req api.Request) api.Response {
+	if req.Username == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+
+	user, err := s.loadWebAuthnUser(ctx, req.Username, false)
+	if err != nil || len(user.Credentials) == 0 {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "El usuario no tiene credenciales WebAuthn"}
+	}
+
+	options, session, err := s.webauthn.BeginLogin(user)
+	if err != nil {
+		s.logf(ctx, "error en BeginLogin: %v", err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar el login WebAuthn"}
+	}
+	return s.beginCeremony(ctx, req.Username, options, session)
+}
+
+// webauthnLoginFinish verifica la aserción firmada por el autenticador
+// y, si es válida, crea una sesión igual que el login con contraseña.
+func (s *server) webauthnLoginFinish(ctx context.Context, req api.Request) api.Response {
+	if req.Username == "" || req.Data == "" {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Faltan credenciales"}
+	}
+
+	user, err := s.loadWebAuthnUser(ctx, req.Username, false)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "El usuario no tiene credenciales WebAuthn"}
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(strings.NewReader(req.Data))
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrBadRequest, Message: "Respuesta WebAuthn mal formada"}
+	}
+	session, err := s.takeCeremony(ctx, req.Username, parsed.Response.CollectedClientData.Challenge)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrNotFound, Message: "No hay un login WebAuthn en curso"}
+	}
+	cred, err := s.webauthn.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		s.logf(ctx, "error validando login webauthn de %s: %v", req.Username, err)
+		return api.Response{Success: false, Code: api.ErrInvalidCredentials, Message: "Credenciales inválidas"}
+	}
+
+	// Actualizamos el contador de firmas para detectar autenticadores clonados
+	for i := range user.Credentials {
+		if crypto.ConstantTimeEqual(user.Credentials[i].ID, cred.ID) {
+			user.Credentials[i].Authenticator = cred.Authenticator
+		}
+	}
+	if err := s.saveWebAuthnUser(ctx, user); err != nil {
+		s.logf(ctx, "error actualizando credencial webauthn: %v", err)
+	}
+
+	return s.createSession(ctx, req, "Login WebAuthn exitoso")
+}
+
+// ceremonyPrefix es el prefijo de las claves de las ceremonias de
+// 'username' en webauthnSessionsNS.
+func (s *server) ceremonyPrefix(username string) []byte {
+	return append(s.userKey(username), '/')
+}
+
+// ceremonyKey es la clave de la ceremonia de 'username' con el reto
+// 'challenge'. Va por reto, y no sólo por usuario, para que quien empiece
+// otra (webauthnLoginBegin no pide sesión) no pueda pisar la que está en
+// curso: el navegador devuelve el reto dentro de la respuesta firmada, así
+// que no hace falta ningún campo más.
+func (s *server) ceremonyKey(username, challenge string) []byte {
+	return append(s.ceremonyPrefix(username), challenge...)
+}
+
+// beginCeremony guarda el estado de la ceremonia en webauthnSessionsNS y
+// devuelve las opciones serializadas para el cliente.
+func (s *server) beginCeremony(ctx context.Context, username string, options any, session *webauthn.SessionData) api.Response {
+	// La librería sólo pone Expires si se le pide que lo haga cumplir; con
+	// él, además, pruneCeremonies sabe cuáles son las más antiguas
+	if session.Expires.IsZero() {
+		session.Expires = time.Now().Add(webauthnCeremonyTTL)
+	}
+	rawSession, err := json.Marshal(session)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar la ceremonia WebAuthn"}
+	}
+	s.ceremonyMu.Lock()
+	defer s.ceremonyMu.Unlock()
+	if err := s.pruneCeremonies(ctx, username); err != nil {
+		s.logf(ctx, "error limpiando las ceremonias WebAuthn de %s: %v", username, err)
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar la ceremonia WebAuthn"}
+	}
+	if err := s.db.PutWithTTL(ctx, webauthnSessionsNS, s.ceremonyKey(username, session.Challenge), rawSession, webauthnCeremonyTTL); err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar la ceremonia WebAuthn"}
+	}
+	rawOptions, err := json.Marshal(options)
+	if err != nil {
+		return api.Response{Success: false, Code: api.ErrInternal, Message: "Error al iniciar la ceremonia WebAuthn"}
+	}
+	return api.Response{Success: true, Message: "Ceremonia WebAuthn iniciada", Data: string(rawOptions)}
+}
+
+// pruneCeremonies hace sitio para una ceremonia más de 'username': borra
+// las que ya han caducado y, si aun así quedan webauthnMaxCeremonies, las
+// que caducan antes. Hay que llamarla con s.ceremonyMu tomado.
+func (s *server) pruneCeremonies(ctx context.Context, username string) error {
+	keys, err := s.db.KeysByPrefix(ctx, webauthnSessionsNS, s.ceremonyPrefix(username))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+	type pending struct {
+		key     []byte
+		expires time.Time
+	}
+	var stale [][]byte
+	var live []pending
+	for _, key := range keys {
+		raw, err := s.db.Get(ctx, webauthnSessionsNS, key)
+		if errors.Is(err, store.ErrNotFound) {
+			// Caducada, pero aún sin barrer (ver store.Store.PutWithTTL)
+			stale = append(stale, key)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var session webauthn.SessionData
+		if err := json.Unmarshal(raw, &session); err != nil {
+			stale = append(stale, key)
+			continue
+		}
+		live = append(live, pending{key, session.Expires})
+	}
+	if extra := len(live) - webauthnMaxCeremonies + 1; extra > 0 {
+		sort.Slice(live, func(i, j int) bool { return live[i].expires.Before(live[j].expires) })
+		for _, p := range live[:extra] {
+			stale = append(stale, p.key)
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return s.db.Batch(ctx, func(tx store.Tx) error {
+		for _, key := range stale {
+			if err := tx.Delete(webauthnSessionsNS, key); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// takeCeremony recupera y borra, en una sola transacción para que dos
+// respuestas con el mismo reto no lo usen las dos, el estado de la
+// ceremonia de 'username' con el reto 'challenge'.
+func (s *server) takeCeremony(ctx context.Context, username, challenge string) (*webauthn.SessionData, error) {
+	key := s.ceremonyKey(username, challenge)
+	var raw []byte
+	err := s.db.Batch(ctx, func(tx store.Tx) error {
+		var err error
+		if raw, err = tx.Get(webauthnSessionsNS, key); err != nil {
+			return err
+		}
+		return tx.Delete(webauthnSessionsNS, key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	var session webauthn.SessionData
+	if err := json.Unmarshal(raw, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// loadWebAuthnUser lee el registro WebAuthn del usuario. Si no existe y
+// 'create' es true, devuelve uno nuevo con un user handle aleatorio.
+func (s *server) loadWebAuthnUser(ctx context.Context, username string, create bool) (*webauthnUser, error) {
+	raw, err := s.db.Get(ctx, "webauthn", s.userKey(username))
+	if err != nil {
+		if !create {
+			return nil, err
+		}
+		id, err := crypto.RandomBytes(webauthnUserIDBytes)
+		if err != nil {
+			return nil, err
+		}
+		return &webauthnUser{Name: username, ID: id}, nil
+	}
+	var user webauthnUser
+	if err := json.Unmarshal(raw, &user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// saveWebAuthnUser guarda el registro WebAuthn del usuario.
+func (s *server) saveWebAuthnUser(ctx context.Context, user *webauthnUser) error {
+	raw, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	return s.db.Put(ctx, "webauthn", s.userKey(user.Name), raw)
+}
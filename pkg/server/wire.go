@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"prac/pkg/api"
+)
+
+// maxGzipBody es lo más que puede ocupar descomprimido un cuerpo con gzip,
+// para que uno pequeño no se convierta en gigas al descomprimirlo.
+const maxGzipBody = 64 << 20
+
+// gzipLevel es el nivel de compresión gzip. Lo que abulta son datos
+// cifrados en base64, sin nada que se repita: sólo Huffman los deja en 3/4
+// (lo que ocupaban antes del base64), deprisa, mientras que con el nivel
+// por defecto ni se comprimen.
+const gzipLevel = gzip.HuffmanOnly
+
+// gzipMinKey es la clave del contexto con el tamaño a partir del cual se
+// comprimen las respuestas (ver withGzip).
+type gzipMinKey struct{}
+
+// withGzip descomprime los cuerpos que llegan con "Content-Encoding: gzip"
+// y hace que writeResponse comprima las respuestas de al menos 'min' bytes
+// a los clientes que aceptan gzip (0: ninguna). Así las peticiones
+// pequeñas, como un login, no pagan la compresión.
+func withGzip(min int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "Cuerpo gzip no válido", http.StatusBadRequest)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, zr, maxGzipBody)
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), gzipMinKey{}, min)))
+	})
+}
+
+// acceptsGzip indica si el Accept-Encoding de 'r' admite gzip.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") && strings.ReplaceAll(params, " ", "") != "q=0" {
+			return true
+		}
+	}
+	return false
+}
+
+// isCBOR indica si el tipo de contenido 'contentType' es CBOR.
+func isCBOR(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	return mt == api.ContentTypeCBOR
+}
+
+// bodyFormat es el nombre del formato del cuerpo de 'r', para los errores.
+func bodyFormat(r *http.Request) string {
+	if isCBOR(r.Header.Get("Content-Type")) {
+		return "CBOR"
+	}
+	return "JSON"
+}
+
+// decodeBody descodifica el cuerpo de 'r' en 'v': en CBOR si su
+// Content-Type es api.ContentTypeCBOR y, si no, en JSON, como siempre. Sin
+// cuerpo, devuelve io.EOF.
+func decodeBody(r *http.Request, v any) error {
+	if !isCBOR(r.Header.Get("Content-Type")) {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if len(data) == 0 {
+		return io.EOF
+	}
+	return api.UnmarshalCBOR(data, v)
+}
+
+// wantsCBOR indica si hay que responder a 'r' en CBOR: si su Accept
+// incluye api.ContentTypeCBOR o, sin Accept, si la petición venía en CBOR.
+func wantsCBOR(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return isCBOR(r.Header.Get("Content-Type"))
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mt == api.ContentTypeCBOR && params["q"] != "0" {
+			return true
+		}
+	}
+	return false
+}
+
+// writeResponse envía 'res' con el estado 'status', en el formato que pide
+// 'r' (ver wantsCBOR), comprimida si procede (ver withGzip) y con el
+// identificador de la petición (ver withRequestID). Con RetryAfter, lo
+// repite en la cabecera Retry-After.
+func writeResponse(w http.ResponseWriter, r *http.Request, status int, res api.Response) {
+	res.RequestID = w.Header().Get(api.RequestIDHeader)
+	if res.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(res.RetryAfter))
+	}
+	w.Header().Add("Vary", "Accept, Accept-Encoding")
+	var body []byte
+	if wantsCBOR(r) {
+		if data, err := api.MarshalCBOR(res); err == nil {
+			w.Header().Set("Content-Type", api.ContentTypeCBOR)
+			body = data
+		}
+	}
+	if body == nil {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(res)
+		w.Header().Set("Content-Type", api.ContentTypeJSON)
+		body = buf.Bytes()
+	}
+	if min, _ := r.Context().Value(gzipMinKey{}).(int); min > 0 && len(body) >= min && acceptsGzip(r) {
+		var buf bytes.Buffer
+		zw, _ := gzip.NewWriterLevel(&buf, gzipLevel)
+		zw.Write(body)
+		if zw.Close() == nil {
+			w.Header().Set("Content-Encoding", "gzip")
+			body = buf.Bytes()
+		}
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
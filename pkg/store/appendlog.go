@@ -0,0 +1,393 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	Registros de sólo adición (como la auditoría): namespaces donde sólo se
+	añaden entradas al final, con claves de secuencia, y nada se cambia ni
+	se borra
+*/
+
+// ErrAppendOnly es el error de las escrituras y borrados que un
+// AppendOnlyStore rechaza por ir a un namespace de sólo adición.
+var ErrAppendOnly = errors.New("namespace de sólo adición: sólo admite entradas nuevas por su AppendLog")
+
+// LogEntry es una entrada de un AppendLog.
+type LogEntry struct {
+	Seq   uint64
+	Value []byte
+}
+
+// AppendLog es un registro de sólo adición sobre un namespace: cada Append
+// guarda la entrada con la secuencia siguiente a la última (desde 1), y no
+// hay forma de cambiarla ni de borrarla a través de él. Para que tampoco
+// se pueda con Put o Delete, el namespace tiene que estar protegido por un
+// AppendOnlyStore (ver AppendOnlyStore.Log).
+type AppendLog struct {
+	mu        sync.Mutex
+	db        Store
+	namespace string
+	last      uint64
+}
+
+// NewAppendLog abre el registro de 'namespace' en 'db' y localiza su última
+// entrada. Sobre un Store sin proteger sirve para leerlo (por ejemplo, en
+// sólo lectura); para escribir, mejor AppendOnlyStore.Log.
+func NewAppendLog(ctx context.Context, db Store, namespace string) (*AppendLog, error) {
+	l := &AppendLog{db: db, namespace: namespace}
+	if err := l.findEnd(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// logSeqKey codifica la secuencia con ceros a la izquierda para que el
+// orden de las claves coincida con el numérico.
+func logSeqKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("%020d", seq))
+}
+
+// parseLogSeqKey es la inversa de logSeqKey.
+func parseLogSeqKey(key []byte) (uint64, error) {
+	seq, err := strconv.ParseUint(string(key), 10, 64)
+	if err != nil || string(logSeqKey(seq)) != string(key) {
+		return 0, fmt.Errorf("clave de secuencia no válida: %q", key)
+	}
+	return seq, nil
+}
+
+// findEnd coloca l.last en la secuencia de la última entrada guardada.
+func (l *AppendLog) findEnd(ctx context.Context) error {
+	l.last = 0
+	list, err := l.db.LastN(ctx, l.namespace, nil, 1)
+	if errors.Is(err, ErrNotFound) || len(list) == 0 {
+		return nil // registro vacío (el namespace aún no existe)
+	}
+	if err != nil {
+		return err
+	}
+	if l.last, err = parseLogSeqKey(list[0].Key); err != nil {
+		return fmt.Errorf("error leyendo la última entrada de %s: %v", l.namespace, err)
+	}
+	return nil
+}
+
+// Reload vuelve a localizar la última entrada, por ejemplo después de
+// restaurar la base de datos.
+func (l *AppendLog) Reload(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.findEnd(ctx)
+}
+
+// Last devuelve la secuencia de la última entrada (0 si no hay ninguna).
+func (l *AppendLog) Last() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.last
+}
+
+// Append añade 'value' al final del registro y devuelve su secuencia. Si
+// la secuencia ya está ocupada (otro proceso ha escrito en el mismo motor,
+// o se ha restaurado sin Reload), no la sobrescribe y devuelve error.
+func (l *AppendLog) Append(ctx context.Context, value []byte) (uint64, error) {
+	return l.AppendFunc(ctx, func(uint64) ([]byte, error) { return value, nil })
+}
+
+// AppendFunc es como Append, pero el valor lo construye 'build' a partir de
+// la secuencia que le va a tocar (para entradas que la llevan dentro, como
+// las de auditoría). Si 'build' devuelve error, no se añade nada.
+func (l *AppendLog) AppendFunc(ctx context.Context, build func(seq uint64) ([]byte, error)) (uint64, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	seq := l.last + 1
+	value, err := build(seq)
+	if err != nil {
+		return 0, err
+	}
+	key := logSeqKey(seq)
+	err = l.db.Batch(ctx, func(tx Tx) error {
+		_, err := tx.Get(l.namespace, key)
+		if err == nil {
+			return fmt.Errorf("la entrada %d de %s ya existe", seq, l.namespace)
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		return tx.Put(l.namespace, key, value)
+	})
+	if err != nil {
+		return 0, err
+	}
+	l.last = seq
+	return seq, nil
+}
+
+// Range devuelve, en orden, hasta 'limit' entradas con secuencia entre
+// 'from' y 'to' (ambas incluidas; 'to' 0 para llegar a la última).
+func (l *AppendLog) Range(ctx context.Context, from, to uint64, limit int) ([]LogEntry, error) {
+	var end []byte
+	if to > 0 {
+		end = logSeqKey(to + 1)
+	}
+	list, err := l.db.GetRange(ctx, l.namespace, logSeqKey(from), end, limit)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil // registro vacío
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]LogEntry, 0, len(list))
+	for _, e := range list {
+		seq, err := parseLogSeqKey(e.Key)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, LogEntry{Seq: seq, Value: e.Value})
+	}
+	return entries, nil
+}
+
+// ForEach llama a 'fn' con cada entrada del registro, en orden, como
+// Store.ForEach ('value' sólo es válido durante la llamada). Un registro
+// vacío no es un error.
+func (l *AppendLog) ForEach(ctx context.Context, fn func(seq uint64, value []byte) error) error {
+	err := l.db.ForEach(ctx, l.namespace, func(key, value []byte) error {
+		seq, err := parseLogSeqKey(key)
+		if err != nil {
+			return err
+		}
+		return fn(seq, value)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// AppendOnlyStore envuelve un Store y rechaza con ErrAppendOnly las
+// escrituras y borrados en sus namespaces de sólo adición (y en los
+// anidados bajo ellos), también dentro de Batch, y que DeleteNamespace se
+// los lleve por delante. Sólo el AppendLog de Log puede añadirles entradas.
+// Restore sigue pudiendo sustituir la base de datos entera.
+type AppendOnlyStore struct {
+	inner      Store
+	namespaces []string
+}
+
+// NewAppendOnlyStore crea el decorador sobre 'inner', protegiendo
+// 'namespaces'.
+func NewAppendOnlyStore(inner Store, namespaces ...string) *AppendOnlyStore {
+	return &AppendOnlyStore{inner: inner, namespaces: namespaces}
+}
+
+// Log abre el AppendLog de 'namespace', que tiene que ser uno de los
+// protegidos. Escribe directamente en el Store envuelto.
+func (s *AppendOnlyStore) Log(ctx context.Context, namespace string) (*AppendLog, error) {
+	for _, ns := range s.namespaces {
+		if ns == namespace {
+			return NewAppendLog(ctx, s.inner, namespace)
+		}
+	}
+	return nil, fmt.Errorf("%s no es un namespace de sólo adición", namespace)
+}
+
+// guard devuelve ErrAppendOnly si 'namespace' está protegido.
+func (s *AppendOnlyStore) guard(namespace string) error {
+	if inNamespaces(namespace, s.namespaces) {
+		return ErrAppendOnly
+	}
+	return nil
+}
+
+// Put escribe en el Store envuelto si 'namespace' no está protegido.
+func (s *AppendOnlyStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	if err := s.guard(namespace); err != nil {
+		return err
+	}
+	return s.inner.Put(ctx, namespace, key, value)
+}
+
+// PutWithTTL escribe en el Store envuelto si 'namespace' no está protegido.
+func (s *AppendOnlyStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	if err := s.guard(namespace); err != nil {
+		return err
+	}
+	return s.inner.PutWithTTL(ctx, namespace, key, value, ttl)
+}
+
+// Get lee del Store envuelto.
+func (s *AppendOnlyStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	return s.inner.Get(ctx, namespace, key)
+}
+
+// Exists consulta el Store envuelto.
+func (s *AppendOnlyStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return s.inner.Exists(ctx, namespace, key)
+}
+
+// Delete borra del Store envuelto si 'namespace' no está protegido.
+func (s *AppendOnlyStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	if err := s.guard(namespace); err != nil {
+		return err
+	}
+	return s.inner.Delete(ctx, namespace, key)
+}
+
+// DeleteNamespace borra 'namespace' si ni él ni ninguno de los anidados
+// bajo él está protegido.
+func (s *AppendOnlyStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	if err := s.guard(namespace); err != nil {
+		return err
+	}
+	for _, ns := range s.namespaces {
+		if inNamespaces(ns, []string{namespace}) {
+			return ErrAppendOnly
+		}
+	}
+	return s.inner.DeleteNamespace(ctx, namespace)
+}
+
+// DeleteByPrefix borra del Store envuelto si 'namespace' no está protegido.
+func (s *AppendOnlyStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	if err := s.guard(namespace); err != nil {
+		return 0, err
+	}
+	return s.inner.DeleteByPrefix(ctx, namespace, prefix)
+}
+
+// appendOnlyTx es la vista de una transacción del Store envuelto con las
+// mismas comprobaciones que el AppendOnlyStore.
+type appendOnlyTx struct {
+	s  *AppendOnlyStore
+	tx Tx
+}
+
+func (t appendOnlyTx) Put(namespace string, key, value []byte) error {
+	if err := t.s.guard(namespace); err != nil {
+		return err
+	}
+	return t.tx.Put(namespace, key, value)
+}
+
+func (t appendOnlyTx) Get(namespace string, key []byte) ([]byte, error) {
+	return t.tx.Get(namespace, key)
+}
+
+func (t appendOnlyTx) Delete(namespace string, key []byte) error {
+	if err := t.s.guard(namespace); err != nil {
+		return err
+	}
+	return t.tx.Delete(namespace, key)
+}
+
+// Batch ejecuta 'fn' en una transacción del Store envuelto en la que los
+// namespaces protegidos siguen siéndolo.
+func (s *AppendOnlyStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	return s.inner.Batch(ctx, func(tx Tx) error {
+		return fn(appendOnlyTx{s: s, tx: tx})
+	})
+}
+
+// ListKeys lista las claves del Store envuelto.
+func (s *AppendOnlyStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.inner.ListKeys(ctx, namespace)
+}
+
+// CountKeys cuenta las claves del Store envuelto.
+func (s *AppendOnlyStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	return s.inner.CountKeys(ctx, namespace)
+}
+
+// KeysByPrefix busca claves en el Store envuelto.
+func (s *AppendOnlyStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	return s.inner.KeysByPrefix(ctx, namespace, prefix)
+}
+
+// ListKeysPage pagina las claves del Store envuelto.
+func (s *AppendOnlyStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.inner.ListKeysPage(ctx, namespace, after, limit)
+}
+
+// KeysByPrefixPage pagina las claves del Store envuelto.
+func (s *AppendOnlyStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.inner.KeysByPrefixPage(ctx, namespace, prefix, after, limit)
+}
+
+// GetRange lee un rango del Store envuelto.
+func (s *AppendOnlyStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	return s.inner.GetRange(ctx, namespace, start, end, limit)
+}
+
+// LastN lee las últimas entradas del Store envuelto.
+func (s *AppendOnlyStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	return s.inner.LastN(ctx, namespace, prefix, n)
+}
+
+// ForEach recorre el Store envuelto.
+func (s *AppendOnlyStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.inner.ForEach(ctx, namespace, fn)
+}
+
+// Namespaces lista los namespaces del Store envuelto.
+func (s *AppendOnlyStore) Namespaces(ctx context.Context) ([]string, error) {
+	return s.inner.Namespaces(ctx)
+}
+
+// NamespacesUnder lista los namespaces anidados del Store envuelto.
+func (s *AppendOnlyStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	return s.inner.NamespacesUnder(ctx, parent)
+}
+
+// Backup copia el Store envuelto.
+func (s *AppendOnlyStore) Backup(ctx context.Context, w io.Writer) error {
+	return s.inner.Backup(ctx, w)
+}
+
+// Restore restaura en caliente el Store envuelto, si éste lo permite (ver
+// Restorer). Los AppendLog abiertos tienen que hacer Reload después.
+func (s *AppendOnlyStore) Restore(r io.Reader) error {
+	rs, ok := s.inner.(Restorer)
+	if !ok {
+		return errors.New("el motor de almacenamiento no permite restaurar en caliente")
+	}
+	return rs.Restore(r)
+}
+
+// Compact compacta el Store envuelto, si éste lo permite (ver Compacter).
+func (s *AppendOnlyStore) Compact() (before, after int64, err error) {
+	c, ok := s.inner.(Compacter)
+	if !ok {
+		return 0, 0, errors.New("el motor de almacenamiento no necesita compactarse")
+	}
+	return c.Compact()
+}
+
+// Snapshot fija una vista del Store envuelto (ver Snapshotter).
+func (s *AppendOnlyStore) Snapshot() (Snapshot, error) {
+	return snapshotOf(s.inner)
+}
+
+// stats da la ocupación del Store envuelto (ver Stats).
+func (s *AppendOnlyStore) stats(ctx context.Context) (StoreStats, error) {
+	return Stats(ctx, s.inner)
+}
+
+// Close cierra el Store envuelto.
+func (s *AppendOnlyStore) Close() error {
+	return s.inner.Close()
+}
+
+// Dump vuelca el Store envuelto.
+func (s *AppendOnlyStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return s.inner.Dump(ctx, w, opts)
+}
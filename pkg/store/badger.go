@@ -0,0 +1,628 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+/*
+	Implementación de la interfaz Store mediante Badger (LSM con registro
+	de valores), pensada para cargas con muchas escrituras concurrentes
+*/
+
+// Badger no tiene buckets: todo vive en un único espacio de claves con
+// prefijos. Los datos van bajo 'd' || namespace || 0x00 || clave (ningún
+// namespace contiene 0x00) y cada namespace creado deja una marca
+// 'n' || namespace, para que siga existiendo aunque se vacíe.
+const (
+	badgerDataPrefix = 'd'
+	badgerNSPrefix   = 'n'
+)
+
+// badgerGCInterval es cada cuánto se intenta compactar el registro de valores.
+const badgerGCInterval = 5 * time.Minute
+
+// badgerGCRatio es la fracción de basura a partir de la cual se reescribe
+// un fichero del registro de valores.
+const badgerGCRatio = 0.5
+
+// badgerConflictRetries es cuántas veces se reintenta una transacción en
+// conflicto con otra concurrente (Badger usa control optimista).
+const badgerConflictRetries = 10
+
+// BadgerStore contiene la instancia de Badger y el estado del GC.
+type BadgerStore struct {
+	db   *badger.DB
+	stop chan struct{}
+	done chan struct{}
+
+	mu    sync.RWMutex
+	known map[string]bool // namespaces con marca ya escrita
+}
+
+// NewBadgerStore abre (o crea) la base de datos Badger del directorio
+// 'path' y arranca el bucle de recolección del registro de valores.
+func NewBadgerStore(path string) (*BadgerStore, error) {
+	opts := badger.DefaultOptions(path).
+		WithLoggingLevel(badger.WARNING).
+		WithDir(path).
+		WithValueDir(path)
+	return openBadger(opts)
+}
+
+// openBadger abre Badger con 'opts'. En sólo lectura no arranca el GC del
+// registro de valores, que reescribe ficheros.
+func openBadger(opts badger.Options) (*BadgerStore, error) {
+	db, err := badger.Open(opts)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir base de datos badger: %v", err)
+	}
+	s := &BadgerStore{
+		db:    db,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+		known: make(map[string]bool),
+	}
+	names, err := s.Namespaces(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error al abrir base de datos badger: %v", err)
+	}
+	for _, ns := range names {
+		s.known[ns] = true
+	}
+	if opts.ReadOnly {
+		close(s.done)
+	} else {
+		go s.gcLoop()
+	}
+	return s, nil
+}
+
+// gcLoop compacta periódicamente el registro de valores hasta que Close lo
+// pare. RunValueLogGC reescribe un fichero por llamada, así que se repite
+// mientras quede alguno que merezca la pena.
+func (s *BadgerStore) gcLoop() {
+	defer close(s.done)
+	t := time.NewTicker(badgerGCInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-t.C:
+			for s.db.RunValueLogGC(badgerGCRatio) == nil {
+			}
+		}
+	}
+}
+
+// dataKey construye la clave de Badger de (namespace, key).
+func dataKey(namespace string, key []byte) []byte {
+	k := make([]byte, 0, 2+len(namespace)+len(key))
+	k = append(k, badgerDataPrefix)
+	k = append(k, namespace...)
+	k = append(k, 0)
+	return append(k, key...)
+}
+
+// nsKey construye la marca de existencia de 'namespace'.
+func nsKey(namespace string) []byte {
+	return append([]byte{badgerNSPrefix}, namespace...)
+}
+
+// hasNamespace indica si 'namespace' existe.
+func (s *BadgerStore) hasNamespace(namespace string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.known[namespace]
+}
+
+// update ejecuta 'fn' en una transacción de escritura, reintentando si
+// entra en conflicto con otra. Si 'ctx' se cancela antes de confirmarla,
+// se descarta.
+func (s *BadgerStore) update(ctx context.Context, fn func(txn *badger.Txn) error) error {
+	var err error
+	for i := 0; i < badgerConflictRetries; i++ {
+		err = s.db.Update(func(txn *badger.Txn) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := fn(txn); err != nil {
+				return err
+			}
+			return ctx.Err()
+		})
+		if !errors.Is(err, badger.ErrConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+// badgerTx implementa Tx sobre una transacción de Badger. 'created' son los
+// namespaces cuya marca se escribe en esta transacción: sólo pasan a
+// s.known cuando se confirma.
+type badgerTx struct {
+	s       *BadgerStore
+	txn     *badger.Txn
+	created map[string]bool
+}
+
+// hasNamespace indica si 'namespace' existe, contando los creados en la
+// propia transacción.
+func (t *badgerTx) hasNamespace(namespace string) bool {
+	return t.created[namespace] || t.s.hasNamespace(namespace)
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace'. Las marcas
+// del namespace y de sus antecesores sólo se escriben la primera vez.
+func (t *badgerTx) Put(namespace string, key, value []byte) error {
+	chain, err := namespaceChain(namespace)
+	if err != nil {
+		return err
+	}
+	for _, ns := range chain {
+		if t.hasNamespace(ns) {
+			continue
+		}
+		if err := t.txn.Set(nsKey(ns), nil); err != nil {
+			return fmt.Errorf("error al crear/abrir namespace '%s': %v", namespace, err)
+		}
+		t.created[ns] = true
+	}
+	return t.txn.Set(dataKey(namespace, key), bytes.Clone(value))
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (t *badgerTx) Get(namespace string, key []byte) ([]byte, error) {
+	if !t.hasNamespace(namespace) {
+		return nil, errNoNamespace(namespace)
+	}
+	item, err := t.txn.Get(dataKey(namespace, key))
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, errNoKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	val, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+	return liveValue(key, nonNil(val))
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (t *badgerTx) Delete(namespace string, key []byte) error {
+	if !t.hasNamespace(namespace) {
+		return errNoNamespace(namespace)
+	}
+	return t.txn.Delete(dataKey(namespace, key))
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace'.
+func (s *BadgerStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return tx.Put(namespace, key, value)
+	})
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (s *BadgerStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	var val []byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		var err error
+		val, err = (&badgerTx{s: s, txn: txn}).Get(namespace, key)
+		return err
+	})
+	return val, err
+}
+
+// Exists indica si 'key' está en 'namespace' (y no ha caducado).
+func (s *BadgerStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return exists(ctx, s, namespace, key)
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (s *BadgerStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return tx.Delete(namespace, key)
+	})
+}
+
+// DeleteNamespace borra 'namespace' y los anidados con DropPrefix, que no
+// tiene el límite de tamaño de una transacción. Primero caen los datos y
+// después las marcas: si se interrumpe, queda el namespace vacío.
+func (s *BadgerStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	if !s.hasNamespace(namespace) {
+		return errNoNamespace(namespace)
+	}
+	children := namespace + NamespaceSep
+	err := s.db.DropPrefix(
+		dataKey(namespace, nil),
+		append([]byte{badgerDataPrefix}, children...),
+		nsKey(children),
+	)
+	if err == nil {
+		err = s.update(ctx, func(txn *badger.Txn) error {
+			return txn.Delete(nsKey(namespace))
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("error borrando el namespace '%s': %v", namespace, err)
+	}
+	s.mu.Lock()
+	for ns := range s.known {
+		if ns == namespace || strings.HasPrefix(ns, children) {
+			delete(s.known, ns)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// DeleteByPrefix borra en una transacción las claves de 'namespace' que
+// empiezan por 'prefix'. A diferencia de DeleteNamespace, no usa DropPrefix
+// (que para las escrituras de toda la base de datos), así que está sujeta
+// al límite de tamaño de las transacciones de Badger.
+func (s *BadgerStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	if !s.hasNamespace(namespace) {
+		return 0, errNoNamespace(namespace)
+	}
+	n := 0
+	err := s.update(ctx, func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = dataKey(namespace, prefix)
+		it := txn.NewIterator(opts)
+		var keys [][]byte
+		steps := ctxSteps{ctx: ctx}
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			keys = append(keys, it.Item().KeyCopy(nil))
+		}
+		it.Close()
+		for _, k := range keys {
+			if err := txn.Delete(k); err != nil {
+				return err
+			}
+		}
+		n = len(keys)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// PutWithTTL guarda (key, value) en 'namespace' hasta dentro de 'ttl'.
+func (s *BadgerStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return putWithTTL(tx, namespace, key, value, ttl)
+	})
+}
+
+// Batch ejecuta 'fn' en una transacción de Badger. Si choca con otra
+// concurrente, se descarta y 'fn' se vuelve a ejecutar desde el principio.
+func (s *BadgerStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	var created map[string]bool
+	err := s.update(ctx, func(txn *badger.Txn) error {
+		t := &badgerTx{s: s, txn: txn, created: make(map[string]bool)}
+		created = t.created
+		return fn(t)
+	})
+	if err == nil && len(created) > 0 {
+		s.mu.Lock()
+		for ns := range created {
+			s.known[ns] = true
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// ListKeys devuelve todas las claves de 'namespace', en orden.
+func (s *BadgerStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.KeysByPrefix(ctx, namespace, nil)
+}
+
+// CountKeys cuenta las claves de 'namespace' con un iterador que no lee
+// los valores.
+func (s *BadgerStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	if !s.hasNamespace(namespace) {
+		return 0, errNoNamespace(namespace)
+	}
+	n := 0
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = dataKey(namespace, nil)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		steps := ctxSteps{ctx: ctx}
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// KeysByPrefix devuelve, en orden, las claves de 'namespace' que empiecen
+// con 'prefix' (sin leer los valores del registro).
+func (s *BadgerStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	if !s.hasNamespace(namespace) {
+		return nil, errNoNamespace(namespace)
+	}
+	base := len(dataKey(namespace, nil))
+	var keys [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = dataKey(namespace, prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		steps := ctxSteps{ctx: ctx}
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			keys = append(keys, bytes.Clone(it.Item().Key()[base:]))
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// ListKeysPage devuelve una página de las claves de 'namespace'.
+func (s *BadgerStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.KeysByPrefixPage(ctx, namespace, nil, after, limit)
+}
+
+// KeysByPrefixPage devuelve una página de las claves que empiezan por
+// 'prefix', empezando el iterador en el cursor.
+func (s *BadgerStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	if !s.hasNamespace(namespace) {
+		return nil, nil, errNoNamespace(namespace)
+	}
+	base := len(dataKey(namespace, nil))
+	start, skip := pageStart(prefix, after)
+	var keys [][]byte
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = dataKey(namespace, prefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		steps := ctxSteps{ctx: ctx}
+		for it.Seek(dataKey(namespace, start)); it.Valid() && len(keys) <= limit; it.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			k := it.Item().Key()[base:]
+			if skip && bytes.Equal(k, start) {
+				continue
+			}
+			keys = append(keys, bytes.Clone(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, next := cutPage(keys, limit)
+	return keys, next, nil
+}
+
+// GetRange lee las entradas de [start, end) con un iterador de Badger
+// colocado en 'start'.
+func (s *BadgerStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	if !s.hasNamespace(namespace) {
+		return nil, errNoNamespace(namespace)
+	}
+	base := len(dataKey(namespace, nil))
+	r := newRangeEntries(namespace, end, limit)
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = min(limit, opts.PrefetchSize)
+		opts.Prefix = dataKey(namespace, nil)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		steps := ctxSteps{ctx: ctx}
+		for it.Seek(dataKey(namespace, start)); it.Valid(); it.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			k := it.Item().Key()[base:]
+			if r.past(k) {
+				break
+			}
+			more := true
+			err := it.Item().Value(func(v []byte) error {
+				more = r.add(k, v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if !more {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.list, nil
+}
+
+// LastN recorre hacia atrás con un iterador inverso de Badger, que se
+// coloca en la mayor clave que no pasa de la búsqueda.
+func (s *BadgerStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	if err := checkLimit(n); err != nil {
+		return nil, err
+	}
+	if !s.hasNamespace(namespace) {
+		return nil, errNoNamespace(namespace)
+	}
+	base := len(dataKey(namespace, nil))
+	full := dataKey(namespace, prefix)
+	seek := prefixEnd(full) // nunca nil: dataKey lleva un 0 en medio
+	r := newRangeEntries(namespace, nil, n)
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchSize = min(n, opts.PrefetchSize)
+		opts.Reverse = true
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		it.Seek(seek)
+		if it.Valid() && bytes.Equal(it.Item().Key(), seek) {
+			it.Next() // la propia clave de la búsqueda ya no tiene el prefijo
+		}
+		steps := ctxSteps{ctx: ctx}
+		for ; it.ValidForPrefix(full); it.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			k := it.Item().Key()[base:]
+			more := true
+			err := it.Item().Value(func(v []byte) error {
+				more = r.add(k, v)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if !more {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.list, nil
+}
+
+// ForEach recorre 'namespace' con scan, sin las entradas caducadas.
+func (s *BadgerStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.scan(ctx, namespace, liveEntries(fn))
+}
+
+// scan recorre 'namespace' con un iterador de Badger que va leyendo los
+// valores por adelantado, tal cual están guardados (ver rawScanner).
+func (s *BadgerStore) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	if !s.hasNamespace(namespace) {
+		return errNoNamespace(namespace)
+	}
+	return s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = dataKey(namespace, nil)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		steps := ctxSteps{ctx: ctx}
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			item := it.Item()
+			k := item.Key()[len(opts.Prefix):]
+			if err := item.Value(func(v []byte) error { return fn(k, nonNil(v)) }); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Namespaces devuelve los nombres de todos los namespaces.
+func (s *BadgerStore) Namespaces(ctx context.Context) ([]string, error) {
+	var names []string
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Prefix = []byte{badgerNSPrefix}
+		it := txn.NewIterator(opts)
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			names = append(names, string(it.Item().Key()[1:]))
+		}
+		return nil
+	})
+	return names, err
+}
+
+// NamespacesUnder devuelve los namespaces cuyo nombre empieza por 'parent/'.
+func (s *BadgerStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return namespacesUnder(names, parent)
+}
+
+// Backup escribe en 'w' una copia completa en el formato de copias de
+// Badger, que se recupera con Restore (la base de datos es un directorio,
+// no un fichero que se pueda copiar tal cual).
+func (s *BadgerStore) Backup(ctx context.Context, w io.Writer) error {
+	_, err := s.db.Backup(ctxWriter{ctx, w}, 0)
+	return err
+}
+
+// stats calcula Stats recorriendo los namespaces (ver scanStats), con el
+// tamaño de los ficheros del LSM y del registro de valores según Badger.
+func (s *BadgerStore) stats(ctx context.Context) (StoreStats, error) {
+	st, err := scanStats(ctx, s)
+	lsm, vlog := s.db.Size()
+	st.FileSize = lsm + vlog
+	return st, err
+}
+
+// loadBadger crea en 'path' una base Badger con la copia de 'r'.
+func loadBadger(r io.Reader, path string) error {
+	s, err := NewBadgerStore(path)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Load(r, 256); err != nil {
+		s.Close()
+		return fmt.Errorf("error cargando la copia badger: %v", err)
+	}
+	return s.Close()
+}
+
+// Close para el GC y cierra la base de datos Badger.
+func (s *BadgerStore) Close() error {
+	close(s.stop)
+	<-s.done
+	return s.db.Close()
+}
+
+// Dump escribe en 'w' el contenido de la base de datos para depuración
+// (ver DumpOptions), con los valores tal cual están guardados.
+func (s *BadgerStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return dump(ctx, s, s.scan, w, opts)
+}
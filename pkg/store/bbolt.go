@@ -2,7 +2,14 @@ package store
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
 
 	"go.etcd.io/bbolt"
 )
@@ -13,68 +20,321 @@ import (
 
 // BboltStore contiene la instancia de la base de datos bbolt.
 type BboltStore struct {
+	path string
+	// mode y opts son los de la apertura, para volver a abrir el fichero
+	// igual tras Restore o Compact.
+	mode os.FileMode
+	opts *bbolt.Options
+	// mu protege 'db', que Restore sustituye: las transacciones lo toman
+	// en lectura y Restore, en escritura, cuando ya no queda ninguna.
+	mu sync.RWMutex
 	db *bbolt.DB
 }
 
-// NewBboltStore abre la base de datos bbolt en la ruta especificada.
+// bboltDefaultTimeout es cuánto espera por defecto NewBboltStore a que otro
+// proceso suelte el bloqueo del fichero.
+const bboltDefaultTimeout = 5 * time.Second
+
+// BboltOptions configura NewBboltStoreWithOptions. Los valores cero son
+// los de NewBboltStore.
+type BboltOptions struct {
+	// FileMode son los permisos del fichero si hay que crearlo (0600 si
+	// es 0).
+	FileMode os.FileMode
+
+	// Timeout es cuánto esperar al bloqueo del fichero, que bbolt sólo
+	// deja abrir para escribir a un proceso (bboltDefaultTimeout si es 0;
+	// negativo para esperar sin límite).
+	Timeout time.Duration
+
+	// NoSync no espera a que cada transacción llegue al disco: es mucho
+	// más rápido, pero un corte de luz puede perder las últimas escrituras
+	// o corromper el fichero. Sólo para pruebas o importaciones que se
+	// pueden repetir.
+	NoSync bool
+
+	// ReadOnly abre el fichero en sólo lectura (debe existir), con un
+	// bloqueo compartido con otros lectores. Las escrituras fallan.
+	ReadOnly bool
+
+	// Buckets son los namespaces que se crean al abrir si no existen.
+	Buckets []string
+
+	// InitialMmapSize es el tamaño en bytes con el que se proyecta el
+	// fichero en memoria (0: el que elija bbolt). Cuando el fichero ya no
+	// cabe, bbolt tiene que volver a proyectarlo y la escritura que lo
+	// provoca espera a que se cierren todas las lecturas, también las
+	// instantáneas (ver Snapshot): reservar de más lo evita.
+	InitialMmapSize int
+}
+
+// NewBboltStore abre la base de datos bbolt en la ruta especificada, con
+// las opciones por defecto.
 func NewBboltStore(path string) (*BboltStore, error) {
-	db, err := bbolt.Open(path, 0600, nil)
+	return NewBboltStoreWithOptions(path, BboltOptions{})
+}
+
+// NewBboltStoreWithOptions abre la base de datos bbolt de 'path' con 'opts'.
+func NewBboltStoreWithOptions(path string, opts BboltOptions) (*BboltStore, error) {
+	mode := opts.FileMode
+	if mode == 0 {
+		mode = 0600
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = bboltDefaultTimeout
+	} else if timeout < 0 {
+		timeout = 0 // bbolt: sin límite
+	}
+	if opts.ReadOnly && len(opts.Buckets) > 0 {
+		return nil, errors.New("error al abrir base de datos bbolt: no se pueden crear buckets en sólo lectura")
+	}
+	bopts := &bbolt.Options{
+		Timeout:         timeout,
+		NoSync:          opts.NoSync,
+		ReadOnly:        opts.ReadOnly,
+		InitialMmapSize: opts.InitialMmapSize,
+	}
+	db, err := bbolt.Open(path, mode, bopts)
+	if errors.Is(err, bbolt.ErrTimeout) {
+		return nil, fmt.Errorf("error al abrir base de datos bbolt: el fichero está bloqueado por otro proceso (¿está el servidor en marcha?)")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error al abrir base de datos bbolt: %v", err)
 	}
-	return &BboltStore{db: db}, nil
+	s := &BboltStore{path: path, mode: mode, opts: bopts, db: db}
+	if len(opts.Buckets) > 0 {
+		err := s.update(context.Background(), func(tx *bbolt.Tx) error {
+			for _, ns := range opts.Buckets {
+				if _, err := (bboltTx{tx}).createBucket(ns); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
-// Put almacena o actualiza (key, value) dentro de un bucket = namespace.
-// No se soportan sub-buckets.
-func (s *BboltStore) Put(namespace string, key, value []byte) error {
+// view ejecuta 'fn' en una transacción de lectura.
+func (s *BboltStore) view(ctx context.Context, fn func(tx *bbolt.Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.db.View(fn)
+}
+
+// update ejecuta 'fn' en una transacción de escritura. Si 'ctx' se cancela
+// mientras tanto, la transacción se descarta en lugar de confirmarse.
+func (s *BboltStore) update(ctx context.Context, fn func(tx *bbolt.Tx) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return s.db.Update(func(tx *bbolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(namespace))
+		if err := fn(tx); err != nil {
+			return err
+		}
+		return ctx.Err()
+	})
+}
+
+// bucket devuelve el bucket de 'namespace' bajando por los anidados, o
+// nil si no existe.
+func bucket(tx *bbolt.Tx, namespace string) *bbolt.Bucket {
+	chain, err := namespaceChain(namespace)
+	if err != nil {
+		return nil
+	}
+	b := tx.Bucket([]byte(chain[0]))
+	for i := 1; i < len(chain) && b != nil; i++ {
+		b = b.Bucket([]byte(chain[i][len(chain[i-1])+1:]))
+	}
+	return b
+}
+
+// bboltTx implementa Tx sobre una transacción de escritura de bbolt.
+type bboltTx struct {
+	tx *bbolt.Tx
+}
+
+// createBucket abre el bucket de 'namespace', creando él y los de encima
+// si hace falta.
+func (t bboltTx) createBucket(namespace string) (*bbolt.Bucket, error) {
+	chain, err := namespaceChain(namespace)
+	if err != nil {
+		return nil, err
+	}
+	b, err := t.tx.CreateBucketIfNotExists([]byte(chain[0]))
+	for i := 1; i < len(chain) && err == nil; i++ {
+		b, err = b.CreateBucketIfNotExists([]byte(chain[i][len(chain[i-1])+1:]))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error al crear/abrir bucket '%s': %v", namespace, err)
+	}
+	return b, nil
+}
+
+// Put almacena o actualiza (key, value) dentro de un bucket = namespace.
+// Un namespace jerárquico ("a/b/c") es una cadena de buckets anidados.
+func (t bboltTx) Put(namespace string, key, value []byte) error {
+	b, err := t.createBucket(namespace)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+// Get recupera el valor de (key) en el bucket = namespace. Se devuelve una
+// copia: la memoria de bbolt sólo es válida durante la transacción.
+func (t bboltTx) Get(namespace string, key []byte) ([]byte, error) {
+	b := bucket(t.tx, namespace)
+	if b == nil {
+		return nil, errNoNamespace(namespace)
+	}
+	val := b.Get(key)
+	if val == nil {
+		// También es nil si 'key' es un bucket anidado
+		return nil, errNoKey(key)
+	}
+	return liveValue(key, bytes.Clone(val))
+}
+
+// Delete elimina la clave 'key' del bucket = namespace.
+func (t bboltTx) Delete(namespace string, key []byte) error {
+	b := bucket(t.tx, namespace)
+	if b == nil {
+		return errNoNamespace(namespace)
+	}
+	return b.Delete(key)
+}
+
+// DeleteNamespace borra el bucket = namespace (bbolt borra con él sus
+// buckets anidados).
+func (s *BboltStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		chain, err := namespaceChain(namespace)
 		if err != nil {
-			return fmt.Errorf("error al crear/abrir bucket '%s': %v", namespace, err)
+			return err
+		}
+		if len(chain) == 1 {
+			err = tx.DeleteBucket([]byte(namespace))
+		} else if parent := bucket(tx, chain[len(chain)-2]); parent != nil {
+			err = parent.DeleteBucket([]byte(namespace[len(chain[len(chain)-2])+1:]))
+		} else {
+			err = bbolt.ErrBucketNotFound
 		}
-		return b.Put(key, value)
+		if errors.Is(err, bbolt.ErrBucketNotFound) {
+			return errNoNamespace(namespace)
+		}
+		return err
+	})
+}
+
+// Put almacena o actualiza (key, value) dentro de un bucket = namespace.
+func (s *BboltStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		return bboltTx{tx}.Put(namespace, key, value)
 	})
 }
 
 // Get recupera el valor de (key) en el bucket = namespace.
-func (s *BboltStore) Get(namespace string, key []byte) ([]byte, error) {
+func (s *BboltStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
 	var val []byte
-	err := s.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(namespace))
-		if b == nil {
-			return fmt.Errorf("bucket no encontrado: %s", namespace)
-		}
-		val = b.Get(key)
-		if val == nil {
-			return fmt.Errorf("clave no encontrada: %s", string(key))
-		}
-		return nil
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		var err error
+		val, err = bboltTx{tx}.Get(namespace, key)
+		return err
 	})
 	return val, err
 }
 
+// Exists indica si 'key' está en 'namespace' (y no ha caducado).
+func (s *BboltStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return exists(ctx, s, namespace, key)
+}
+
 // Delete elimina la clave 'key' del bucket = namespace.
-func (s *BboltStore) Delete(namespace string, key []byte) error {
-	return s.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(namespace))
+func (s *BboltStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		return bboltTx{tx}.Delete(namespace, key)
+	})
+}
+
+// DeleteByPrefix borra en una transacción Update las claves del bucket =
+// namespace que empiezan por 'prefix'. Se recogen antes de borrar: borrar
+// bajo el cursor mientras avanza se salta claves.
+func (s *BboltStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	n := 0
+	err := s.update(ctx, func(tx *bbolt.Tx) error {
+		b := bucket(tx, namespace)
 		if b == nil {
-			return fmt.Errorf("bucket no encontrado: %s", namespace)
+			return errNoNamespace(namespace)
+		}
+		var keys [][]byte
+		steps := ctxSteps{ctx: ctx}
+		c := b.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			if v != nil {
+				keys = append(keys, bytes.Clone(k))
+			}
+		}
+		for _, k := range keys {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
 		}
-		return b.Delete(key)
+		n = len(keys)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// PutWithTTL guarda (key, value) en 'namespace' hasta dentro de 'ttl'.
+func (s *BboltStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return putWithTTL(tx, namespace, key, value, ttl)
+	})
+}
+
+// Batch ejecuta 'fn' dentro de una única transacción Update de bbolt: si
+// devuelve error, no se aplica ninguna de sus escrituras.
+func (s *BboltStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	return s.update(ctx, func(tx *bbolt.Tx) error {
+		return fn(bboltTx{tx})
 	})
 }
 
 // ListKeys devuelve todas las claves del bucket = namespace.
-func (s *BboltStore) ListKeys(namespace string) ([][]byte, error) {
+func (s *BboltStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
 	var keys [][]byte
-	err := s.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(namespace))
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		b := bucket(tx, namespace)
 		if b == nil {
-			return fmt.Errorf("bucket no encontrado: %s", namespace)
+			return errNoNamespace(namespace)
 		}
+		steps := ctxSteps{ctx: ctx}
 		c := b.Cursor()
-		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			if v == nil {
+				continue // bucket anidado
+			}
 			kCopy := make([]byte, len(k))
 			copy(kCopy, k)
 			keys = append(keys, kCopy)
@@ -84,16 +344,42 @@ func (s *BboltStore) ListKeys(namespace string) ([][]byte, error) {
 	return keys, err
 }
 
+// CountKeys cuenta las claves del bucket = namespace con Bucket.Stats, sin
+// recorrerlas. Stats incluye también los buckets anidados (su entrada en el
+// padre y todo su contenido), que se descuentan con sus propias Stats.
+func (s *BboltStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	n := 0
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		b := bucket(tx, namespace)
+		if b == nil {
+			return errNoNamespace(namespace)
+		}
+		n = b.Stats().KeyN
+		return b.ForEachBucket(func(k []byte) error {
+			n -= b.Bucket(k).Stats().KeyN + 1
+			return nil
+		})
+	})
+	return n, err
+}
+
 // KeysByPrefix devuelve las claves que inicien con 'prefix' en el bucket = namespace.
-func (s *BboltStore) KeysByPrefix(namespace string, prefix []byte) ([][]byte, error) {
+func (s *BboltStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
 	var matchedKeys [][]byte
-	err := s.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(namespace))
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		b := bucket(tx, namespace)
 		if b == nil {
-			return fmt.Errorf("bucket no encontrado: %s", namespace)
+			return errNoNamespace(namespace)
 		}
+		steps := ctxSteps{ctx: ctx}
 		c := b.Cursor()
-		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			if v == nil {
+				continue
+			}
 			kCopy := make([]byte, len(k))
 			copy(kCopy, k)
 			matchedKeys = append(matchedKeys, kCopy)
@@ -103,24 +389,483 @@ func (s *BboltStore) KeysByPrefix(namespace string, prefix []byte) ([][]byte, er
 	return matchedKeys, err
 }
 
+// ListKeysPage devuelve una página de las claves del bucket = namespace.
+func (s *BboltStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.KeysByPrefixPage(ctx, namespace, nil, after, limit)
+}
+
+// KeysByPrefixPage devuelve una página de las claves que empiezan por
+// 'prefix'. El cursor es la última clave devuelta: Seek lleva directamente
+// a ella sin recorrer las anteriores.
+func (s *BboltStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	var keys [][]byte
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		b := bucket(tx, namespace)
+		if b == nil {
+			return errNoNamespace(namespace)
+		}
+		start, skip := pageStart(prefix, after)
+		steps := ctxSteps{ctx: ctx}
+		c := b.Cursor()
+		k, v := c.Seek(start)
+		if skip && bytes.Equal(k, start) {
+			k, v = c.Next()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix) && len(keys) <= limit; k, v = c.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			if v != nil {
+				keys = append(keys, bytes.Clone(k))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, next := cutPage(keys, limit)
+	return keys, next, nil
+}
+
+// GetRange lee las entradas de [start, end) con un cursor de bbolt: Seek
+// lleva directamente a 'start' sin recorrer las anteriores.
+func (s *BboltStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	r := newRangeEntries(namespace, end, limit)
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		b := bucket(tx, namespace)
+		if b == nil {
+			return errNoNamespace(namespace)
+		}
+		steps := ctxSteps{ctx: ctx}
+		c := b.Cursor()
+		for k, v := c.Seek(start); k != nil; k, v = c.Next() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			if v == nil {
+				continue // bucket anidado
+			}
+			if !r.add(k, v) {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.list, nil
+}
+
+// LastN recorre hacia atrás con un cursor de bbolt desde la última clave
+// con 'prefix'.
+func (s *BboltStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	if err := checkLimit(n); err != nil {
+		return nil, err
+	}
+	r := newRangeEntries(namespace, nil, n)
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		b := bucket(tx, namespace)
+		if b == nil {
+			return errNoNamespace(namespace)
+		}
+		steps := ctxSteps{ctx: ctx}
+		c := b.Cursor()
+		var k, v []byte
+		if end := prefixEnd(prefix); end == nil {
+			k, v = c.Last()
+		} else if k, _ = c.Seek(end); k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+		for ; k != nil && bytes.HasPrefix(k, prefix); k, v = c.Prev() {
+			if err := steps.step(); err != nil {
+				return err
+			}
+			if v == nil {
+				continue // bucket anidado
+			}
+			if !r.add(k, v) {
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.list, nil
+}
+
+// ForEach recorre 'namespace' con scan, sin las entradas caducadas.
+func (s *BboltStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.scan(ctx, namespace, liveEntries(fn))
+}
+
+// scan recorre el bucket = namespace en una transacción de lectura, con
+// los valores tal cual están guardados (ver rawScanner).
+func (s *BboltStore) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.view(ctx, func(tx *bbolt.Tx) error {
+		return scanBucket(tx, namespace, withContext(ctx, fn))
+	})
+}
+
+// scanBucket recorre el bucket = namespace de 'tx' sin los anidados.
+func scanBucket(tx *bbolt.Tx, namespace string, fn func(key, value []byte) error) error {
+	b := bucket(tx, namespace)
+	if b == nil {
+		return errNoNamespace(namespace)
+	}
+	return b.ForEach(func(k, v []byte) error {
+		if v == nil {
+			return nil // bucket anidado
+		}
+		return fn(k, v)
+	})
+}
+
+// walkBuckets llama a 'fn' con cada bucket anidado bajo 'b' (a cualquier
+// profundidad), con su ruta completa a partir de 'path'.
+func walkBuckets(b *bbolt.Bucket, path string, fn func(path string, b *bbolt.Bucket) error) error {
+	return b.ForEach(func(k, v []byte) error {
+		if v != nil {
+			return nil
+		}
+		child := b.Bucket(k)
+		p := path + NamespaceSep + string(k)
+		if err := fn(p, child); err != nil {
+			return err
+		}
+		return walkBuckets(child, p, fn)
+	})
+}
+
+// Namespaces devuelve los nombres de todos los buckets, también los anidados.
+func (s *BboltStore) Namespaces(ctx context.Context) ([]string, error) {
+	var names []string
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		var err error
+		names, err = bucketNames(tx)
+		return err
+	})
+	return names, err
+}
+
+// bucketNames devuelve los nombres de todos los buckets de 'tx'.
+func bucketNames(tx *bbolt.Tx) ([]string, error) {
+	var names []string
+	err := tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+		names = append(names, string(name))
+		return walkBuckets(b, string(name), func(path string, _ *bbolt.Bucket) error {
+			names = append(names, path)
+			return nil
+		})
+	})
+	// Mismo orden que los demás motores ("a-x" va antes que "a/b")
+	sort.Strings(names)
+	return names, err
+}
+
+// NamespacesUnder recorre los buckets anidados bajo el de 'parent'.
+func (s *BboltStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	var names []string
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		b := bucket(tx, parent)
+		if b == nil {
+			return errNoNamespace(parent)
+		}
+		return walkBuckets(b, parent, func(path string, _ *bbolt.Bucket) error {
+			names = append(names, path)
+			return nil
+		})
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+// Snapshot abre una transacción de lectura de bbolt que dura hasta
+// Release. Mientras tanto, s.mu sigue tomado en lectura (ver Snapshot). Si
+// una escritura tiene que agrandar el fichero, bbolt la hace esperar a que
+// se cierren las transacciones de lectura (ver
+// BboltOptions.InitialMmapSize): una instantánea no debe quedarse abierta
+// más de lo que dure la exportación o el informe, y la goroutine que la
+// tiene no debe escribir en el Store, o puede quedarse esperándose a sí
+// misma.
+func (s *BboltStore) Snapshot() (Snapshot, error) {
+	s.mu.RLock()
+	tx, err := s.db.Begin(false)
+	if err != nil {
+		s.mu.RUnlock()
+		return nil, fmt.Errorf("error abriendo la instantánea: %v", err)
+	}
+	return &bboltSnapshot{s: s, tx: tx}, nil
+}
+
+// bboltSnapshot es una Snapshot sobre una transacción de lectura de bbolt.
+// Una transacción de bbolt no se puede usar desde varias goroutines a la
+// vez, así que 'mu' serializa las lecturas.
+type bboltSnapshot struct {
+	s  *BboltStore
+	mu sync.Mutex
+	tx *bbolt.Tx // nil una vez liberada
+}
+
+// read ejecuta 'fn' con la transacción, si la instantánea sigue abierta.
+func (p *bboltSnapshot) read(fn func(tx *bbolt.Tx) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tx == nil {
+		return ErrSnapshotReleased
+	}
+	return fn(p.tx)
+}
+
+// Get lee 'key' de la instantánea.
+func (p *bboltSnapshot) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	var val []byte
+	err := p.read(func(tx *bbolt.Tx) error {
+		var err error
+		val, err = bboltTx{tx}.Get(namespace, key)
+		return err
+	})
+	return val, err
+}
+
+// ForEach recorre 'namespace' en la instantánea, sin lo caducado.
+func (p *bboltSnapshot) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return p.scan(ctx, namespace, liveEntries(fn))
+}
+
+// scan recorre 'namespace' en la instantánea con los valores tal cual
+// están guardados (ver rawScanner).
+func (p *bboltSnapshot) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return p.read(func(tx *bbolt.Tx) error {
+		return scanBucket(tx, namespace, withContext(ctx, fn))
+	})
+}
+
+// Namespaces devuelve los buckets de la instantánea.
+func (p *bboltSnapshot) Namespaces(ctx context.Context) ([]string, error) {
+	var names []string
+	err := p.read(func(tx *bbolt.Tx) error {
+		var err error
+		names, err = bucketNames(tx)
+		return err
+	})
+	return names, err
+}
+
+// Release cierra la transacción y suelta s.mu.
+func (p *bboltSnapshot) Release() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tx == nil {
+		return nil
+	}
+	err := p.tx.Rollback()
+	p.tx = nil
+	p.s.mu.RUnlock()
+	return err
+}
+
+// Backup escribe el fichero bbolt completo en 'w' desde una transacción de
+// lectura, de modo que la copia es consistente aunque haya escrituras.
+func (s *BboltStore) Backup(ctx context.Context, w io.Writer) error {
+	return s.view(ctx, func(tx *bbolt.Tx) error {
+		_, err := tx.WriteTo(ctxWriter{ctx, w})
+		return err
+	})
+}
+
+// Restore sustituye en caliente el contenido de la base de datos por la
+// copia de 'r' (escrita por Backup). La copia se escribe y se comprueba
+// junto al fichero antes de tocar nada; después se espera a que terminen
+// las transacciones en curso, se cambia el fichero y se vuelve a abrir. Si
+// la copia no vale, la base de datos sigue como estaba.
+func (s *BboltStore) Restore(r io.Reader) error {
+	tmp := s.path + ".restore"
+	if err := writeSnapshot(tmp, r); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	defer os.Remove(tmp)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.replaceWith(tmp)
+}
+
+// compactTxSize es cuántos bytes copia Compact en cada transacción.
+const compactTxSize = 1 << 20
+
+// Compact reescribe la base de datos en un fichero nuevo sin el espacio
+// libre que bbolt nunca devuelve al sistema, lo cambia por el actual y
+// devuelve el tamaño de antes y el de después. Mientras dura, el resto de
+// operaciones esperan: así no se pierde ninguna escritura.
+func (s *BboltStore) Compact() (before, after int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tmp := s.path + ".compact"
+	os.Remove(tmp) // restos de una compactación interrumpida
+	dst, err := bbolt.Open(tmp, s.mode, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("error creando la base de datos compactada: %v", err)
+	}
+	err = bbolt.Compact(dst, s.db, compactTxSize)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, 0, fmt.Errorf("error compactando la base de datos: %v", err)
+	}
+	before, after = fileSize(s.path), fileSize(tmp)
+	if err := s.replaceWith(tmp); err != nil {
+		os.Remove(tmp)
+		return 0, 0, err
+	}
+	return before, after, nil
+}
+
+// stats calcula Stats en una transacción de lectura, con las páginas de
+// cada bucket y el espacio libre del fichero (ver statsReporter).
+func (s *BboltStore) stats(ctx context.Context) (StoreStats, error) {
+	var st StoreStats
+	err := s.view(ctx, func(tx *bbolt.Tx) error {
+		names, err := bucketNames(tx)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			ns := NamespaceStats{Namespace: name}
+			err := scanBucket(tx, name, withContext(ctx, func(key, value []byte) error {
+				ns.Keys++
+				ns.Bytes += int64(len(key) + len(value))
+				return nil
+			}))
+			if err != nil {
+				return err
+			}
+			bs := bucket(tx, name).Stats()
+			ns.Pages = &BboltPageStats{
+				BranchPages:   bs.BranchPageN,
+				LeafPages:     bs.LeafPageN,
+				OverflowPages: bs.BranchOverflowN + bs.LeafOverflowN,
+				Alloc:         bs.BranchAlloc + bs.LeafAlloc,
+				Inuse:         bs.BranchInuse + bs.LeafInuse + bs.InlineBucketInuse,
+			}
+			st.add(ns)
+		}
+		ds := s.db.Stats()
+		st.Bbolt = &BboltFileStats{
+			PageSize:     s.db.Info().PageSize,
+			FreePages:    ds.FreePageN,
+			PendingPages: ds.PendingPageN,
+			FreeBytes:    ds.FreeAlloc,
+		}
+		st.FileSize = tx.Size()
+		return nil
+	})
+	return st, err
+}
+
+// fileSize devuelve el tamaño de 'path', o 0 si no se puede leer.
+func fileSize(path string) int64 {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// replaceWith cambia, con s.mu ya tomado, el fichero de la base de datos
+// por 'tmp' y lo vuelve a abrir. Si algo falla, deja el fichero anterior.
+func (s *BboltStore) replaceWith(tmp string) error {
+	if err := s.db.Close(); err != nil {
+		return fmt.Errorf("error cerrando la base de datos: %v", err)
+	}
+	old := s.path + ".old"
+	if err := os.Rename(s.path, old); err != nil {
+		return s.reopen(fmt.Errorf("error apartando la base de datos: %v", err))
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Rename(old, s.path)
+		return s.reopen(fmt.Errorf("error colocando el fichero nuevo: %v", err))
+	}
+	if err := s.reopen(nil); err != nil {
+		// Volvemos a la base de datos anterior antes de rendirnos
+		os.Rename(old, s.path)
+		return s.reopen(err)
+	}
+	return os.Remove(old)
+}
+
+// writeSnapshot copia 'r' en el fichero nuevo 'path' y comprueba que es una
+// base de datos bbolt sin errores de estructura.
+func writeSnapshot(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creando la copia: %v", err)
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error escribiendo la copia: %v", err)
+	}
+
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("la copia no es una base de datos bbolt: %v", err)
+	}
+	defer db.Close()
+	return db.View(func(tx *bbolt.Tx) error {
+		for err := range tx.Check() {
+			return fmt.Errorf("la copia está dañada: %v", err)
+		}
+		return nil
+	})
+}
+
+// reopen vuelve a abrir s.path con s.mu ya tomado y devuelve 'cause' (o el
+// error de apertura, si no hay otro).
+func (s *BboltStore) reopen(cause error) error {
+	db, err := bbolt.Open(s.path, s.mode, s.opts)
+	if err != nil {
+		return fmt.Errorf("error al abrir base de datos bbolt: %v", err)
+	}
+	s.db = db
+	return cause
+}
+
 // Close cierra la base de datos bbolt.
 func (s *BboltStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.db.Close()
 }
 
-// Dump imprime todo el contenido de la base de datos bbolt para propósitos de depuración.
-func (s *BboltStore) Dump() error {
-	err := s.db.View(func(tx *bbolt.Tx) error {
-		return tx.ForEach(func(bucketName []byte, b *bbolt.Bucket) error {
-			fmt.Printf("Bucket: %s\n", string(bucketName))
-			return b.ForEach(func(k, v []byte) error {
-				fmt.Printf("  Key: %s, Value: %s\n", string(k), string(v))
-				return nil
-			})
-		})
-	})
+// Dump escribe en 'w' el contenido de la base de datos para depuración
+// (ver DumpOptions), con los valores tal cual están guardados y todos los
+// namespaces desde una misma instantánea.
+func (s *BboltStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	snap, err := s.Snapshot()
 	if err != nil {
-		return fmt.Errorf("error al hacer el volcado de depuración: %v", err)
+		return err
 	}
-	return nil
+	defer snap.Release()
+	p := snap.(*bboltSnapshot)
+	return dump(ctx, p, p.scan, w, opts)
 }
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+)
+
+/*
+	Escritura condicional (compare-and-swap), común a todos los motores,
+	para la concurrencia optimista
+*/
+
+// ErrConflict es el error de PutIf y CheckValue cuando el valor guardado ya
+// no es el esperado: otro lo ha cambiado entre tanto.
+var ErrConflict = errors.New("el valor ha cambiado desde que se leyó")
+
+// CheckValue comprueba a través de 'tx' que 'key' vale 'expected' en
+// 'namespace' y, si no, devuelve ErrConflict. Con 'expected' nil la clave no
+// debe existir; un valor vacío pero no nil exige que exista y esté vacía.
+// Dentro de un Batch, las escrituras que le sigan sólo se aplican si el
+// valor no ha cambiado.
+func CheckValue(tx Tx, namespace string, key, expected []byte) error {
+	cur, err := tx.Get(namespace, key)
+	if errors.Is(err, ErrNotFound) {
+		if expected == nil {
+			return nil
+		}
+		return ErrConflict
+	}
+	if err != nil {
+		return err
+	}
+	if expected == nil || !bytes.Equal(cur, expected) {
+		return ErrConflict
+	}
+	return nil
+}
+
+// PutIf escribe 'value' en 'key' sólo si su valor actual es 'expectedOld'
+// (ver CheckValue); si no, no escribe nada y devuelve ErrConflict. La
+// comprobación y la escritura van en el mismo Batch, así que entre dos
+// PutIf con el mismo 'expectedOld' sólo el primero se aplica.
+func PutIf(ctx context.Context, s Store, namespace string, key, value, expectedOld []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		if err := CheckValue(tx, namespace, key, expectedOld); err != nil {
+			return err
+		}
+		return tx.Put(namespace, key, value)
+	})
+}
@@ -0,0 +1,345 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+/*
+	Decorador de Store que guarda junto a cada valor su suma de comprobación
+	y la verifica al leerlo, para distinguir los datos dañados en disco de
+	los fallos de la aplicación
+*/
+
+// sumHeader marca los valores con suma de comprobación, que se guardan como
+// sumHeader || CRC-32C del valor (4 bytes big-endian) || valor. Como
+// ttlHeader, empieza por 0x00 para no confundirse con los valores normales.
+var sumHeader = []byte("\x00prac-sum\x00")
+
+// sumTable es la tabla de CRC-32C (Castagnoli), que detecta mejor los
+// errores en ráfaga que la IEEE y tiene instrucción propia en x86 y ARM.
+var sumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupted es la causa de los errores de un ChecksumStore cuando un
+// valor no coincide con su suma de comprobación: el dato se ha dañado por
+// debajo de la aplicación (disco, copia, edición a mano). Se distingue de
+// los demás fallos con errors.Is(err, store.ErrCorrupted).
+var ErrCorrupted = errors.New("valor corrupto")
+
+// corruptedError es el error de un valor que no supera su suma.
+type corruptedError struct {
+	msg string
+}
+
+func (e corruptedError) Error() string { return e.msg }
+func (e corruptedError) Unwrap() error { return ErrCorrupted }
+
+// sealSum añade a 'value' su cabecera y su suma de comprobación.
+func sealSum(value []byte) []byte {
+	out := make([]byte, 0, len(sumHeader)+4+len(value))
+	out = append(out, sumHeader...)
+	out = binary.BigEndian.AppendUint32(out, crc32.Checksum(value, sumTable))
+	return append(out, value...)
+}
+
+// openSum comprueba la suma de 'raw' y devuelve el valor sin ella. Los
+// valores sin cabecera (anteriores al ChecksumStore) se devuelven tal cual
+// y 'checked' es false.
+func openSum(raw []byte) (value []byte, checked bool, err error) {
+	if !bytes.HasPrefix(raw, sumHeader) {
+		return raw, false, nil
+	}
+	if len(raw) < len(sumHeader)+4 {
+		return nil, true, errors.New("suma de comprobación truncada")
+	}
+	sum := binary.BigEndian.Uint32(raw[len(sumHeader):])
+	value = raw[len(sumHeader)+4:]
+	if crc32.Checksum(value, sumTable) != sum {
+		return nil, true, errors.New("la suma de comprobación no coincide")
+	}
+	return value, true, nil
+}
+
+// ChecksumStore envuelve un Store y guarda cada valor con su CRC-32C, que
+// comprueba en cada lectura (Get, ForEach, GetRange, LastN, Tx.Get y las
+// Snapshot). Un valor dañado da un error con ErrCorrupted; los escritos
+// antes de envolver el Store no tienen suma y se leen sin comprobar hasta
+// que se reescriben. Va por debajo de EncryptedStore, de modo que un valor
+// dañado no se confunde con uno manipulado o con una clave equivocada.
+type ChecksumStore struct {
+	inner Store
+	logf  func(format string, args ...any)
+}
+
+// NewChecksumStore crea el decorador sobre 'inner'. Si 'logf' no es nil,
+// cada valor corrupto que se encuentre se anota también con él.
+func NewChecksumStore(inner Store, logf func(format string, args ...any)) *ChecksumStore {
+	return &ChecksumStore{inner: inner, logf: logf}
+}
+
+// open es openSum de 'key' en 'namespace', con el error de ErrCorrupted.
+func (s *ChecksumStore) open(namespace string, key, raw []byte) ([]byte, error) {
+	value, _, err := openSum(raw)
+	if err != nil {
+		err = corruptedError{fmt.Sprintf("valor corrupto en %s/%s: %v", namespace, string(key), err)}
+		if s.logf != nil {
+			s.logf("%v", err)
+		}
+		return nil, err
+	}
+	return value, nil
+}
+
+// openEntries comprueba, sobre el propio slice, los valores de 'entries'.
+func (s *ChecksumStore) openEntries(entries []Entry) ([]Entry, error) {
+	for i := range entries {
+		value, err := s.open(entries[i].Namespace, entries[i].Key, entries[i].Value)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Value = value
+	}
+	return entries, nil
+}
+
+// Put guarda 'value' con su suma en el Store envuelto.
+func (s *ChecksumStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	return s.inner.Put(ctx, namespace, key, sealSum(value))
+}
+
+// PutWithTTL guarda 'value' con su suma y su caducidad en el Store envuelto.
+func (s *ChecksumStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.inner.PutWithTTL(ctx, namespace, key, sealSum(value), ttl)
+}
+
+// Get lee del Store envuelto y comprueba la suma del valor.
+func (s *ChecksumStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	raw, err := s.inner.Get(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	return s.open(namespace, key, raw)
+}
+
+// Exists consulta el Store envuelto (sin comprobar el valor).
+func (s *ChecksumStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return s.inner.Exists(ctx, namespace, key)
+}
+
+// Delete borra del Store envuelto.
+func (s *ChecksumStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	return s.inner.Delete(ctx, namespace, key)
+}
+
+// DeleteNamespace borra 'namespace' del Store envuelto.
+func (s *ChecksumStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	return s.inner.DeleteNamespace(ctx, namespace)
+}
+
+// DeleteByPrefix borra claves del Store envuelto.
+func (s *ChecksumStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	return s.inner.DeleteByPrefix(ctx, namespace, prefix)
+}
+
+// checksumTx añade y comprueba las sumas dentro de un Batch.
+type checksumTx struct {
+	Tx
+	s *ChecksumStore
+}
+
+func (t checksumTx) Put(namespace string, key, value []byte) error {
+	return t.Tx.Put(namespace, key, sealSum(value))
+}
+
+func (t checksumTx) Get(namespace string, key []byte) ([]byte, error) {
+	raw, err := t.Tx.Get(namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	return t.s.open(namespace, key, raw)
+}
+
+// Batch ejecuta 'fn' en una transacción del Store envuelto.
+func (s *ChecksumStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	return s.inner.Batch(ctx, func(tx Tx) error {
+		return fn(checksumTx{tx, s})
+	})
+}
+
+// ListKeys lista las claves del Store envuelto.
+func (s *ChecksumStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.inner.ListKeys(ctx, namespace)
+}
+
+// CountKeys cuenta las claves del Store envuelto.
+func (s *ChecksumStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	return s.inner.CountKeys(ctx, namespace)
+}
+
+// KeysByPrefix busca claves en el Store envuelto.
+func (s *ChecksumStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	return s.inner.KeysByPrefix(ctx, namespace, prefix)
+}
+
+// ListKeysPage pagina las claves del Store envuelto.
+func (s *ChecksumStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.inner.ListKeysPage(ctx, namespace, after, limit)
+}
+
+// KeysByPrefixPage pagina las claves del Store envuelto.
+func (s *ChecksumStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.inner.KeysByPrefixPage(ctx, namespace, prefix, after, limit)
+}
+
+// GetRange lee un rango del Store envuelto y comprueba sus valores.
+func (s *ChecksumStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	entries, err := s.inner.GetRange(ctx, namespace, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	return s.openEntries(entries)
+}
+
+// LastN lee las últimas entradas del Store envuelto y comprueba sus valores.
+func (s *ChecksumStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	entries, err := s.inner.LastN(ctx, namespace, prefix, n)
+	if err != nil {
+		return nil, err
+	}
+	return s.openEntries(entries)
+}
+
+// ForEach recorre el Store envuelto comprobando cada valor: el primero
+// corrupto detiene el recorrido (ver Verify para revisarlos todos).
+func (s *ChecksumStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.forEach(ctx, s.inner.ForEach, namespace, fn)
+}
+
+// forEach es ForEach sobre el recorrido 'scan' (del Store envuelto o de
+// una Snapshot suya).
+func (s *ChecksumStore) forEach(ctx context.Context, scan func(ctx context.Context, namespace string, fn func(key, value []byte) error) error, namespace string, fn func(key, value []byte) error) error {
+	return scan(ctx, namespace, func(key, raw []byte) error {
+		value, err := s.open(namespace, key, raw)
+		if err != nil {
+			return err
+		}
+		return fn(key, value)
+	})
+}
+
+// SumReport es el resultado de Verify sobre un namespace.
+type SumReport struct {
+	Records   int         // registros revisados
+	Unchecked int         // registros sin suma (anteriores al ChecksumStore)
+	Problems  []BadRecord // registros corruptos
+}
+
+// Verify comprueba la suma de todos los registros de 'namespace' sin
+// detenerse en los corruptos, que devuelve en el informe.
+func (s *ChecksumStore) Verify(ctx context.Context, namespace string) (SumReport, error) {
+	var rep SumReport
+	err := s.inner.ForEach(ctx, namespace, func(key, raw []byte) error {
+		rep.Records++
+		_, checked, err := openSum(raw)
+		if err != nil {
+			rep.Problems = append(rep.Problems, BadRecord{namespace, string(key), err.Error()})
+		} else if !checked {
+			rep.Unchecked++
+		}
+		return nil
+	})
+	return rep, err
+}
+
+// Namespaces lista los namespaces del Store envuelto.
+func (s *ChecksumStore) Namespaces(ctx context.Context) ([]string, error) {
+	return s.inner.Namespaces(ctx)
+}
+
+// NamespacesUnder lista los namespaces anidados del Store envuelto.
+func (s *ChecksumStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	return s.inner.NamespacesUnder(ctx, parent)
+}
+
+// Backup copia el Store envuelto (con las sumas).
+func (s *ChecksumStore) Backup(ctx context.Context, w io.Writer) error {
+	return s.inner.Backup(ctx, w)
+}
+
+// Restore restaura en caliente el Store envuelto, si éste lo permite (ver
+// Restorer).
+func (s *ChecksumStore) Restore(r io.Reader) error {
+	rs, ok := s.inner.(Restorer)
+	if !ok {
+		return errors.New("el motor de almacenamiento no permite restaurar en caliente")
+	}
+	return rs.Restore(r)
+}
+
+// Compact compacta el Store envuelto, si éste lo permite (ver Compacter).
+func (s *ChecksumStore) Compact() (before, after int64, err error) {
+	c, ok := s.inner.(Compacter)
+	if !ok {
+		return 0, 0, errors.New("el motor de almacenamiento no necesita compactarse")
+	}
+	return c.Compact()
+}
+
+// Snapshot fija una vista del Store envuelto (ver Snapshotter) que
+// comprueba las sumas igual que el ChecksumStore.
+func (s *ChecksumStore) Snapshot() (Snapshot, error) {
+	snap, err := snapshotOf(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return checksumSnapshot{s: s, snap: snap}, nil
+}
+
+// stats da la ocupación del Store envuelto (ver Stats), con las sumas
+// incluidas.
+func (s *ChecksumStore) stats(ctx context.Context) (StoreStats, error) {
+	return Stats(ctx, s.inner)
+}
+
+// checksumSnapshot es la vista con sumas de una Snapshot del Store envuelto.
+type checksumSnapshot struct {
+	s    *ChecksumStore
+	snap Snapshot
+}
+
+func (p checksumSnapshot) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	raw, err := p.snap.Get(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	return p.s.open(namespace, key, raw)
+}
+
+func (p checksumSnapshot) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return p.s.forEach(ctx, p.snap.ForEach, namespace, fn)
+}
+
+func (p checksumSnapshot) Namespaces(ctx context.Context) ([]string, error) {
+	return p.snap.Namespaces(ctx)
+}
+
+func (p checksumSnapshot) Release() error {
+	return p.snap.Release()
+}
+
+// Close cierra el Store envuelto.
+func (s *ChecksumStore) Close() error {
+	return s.inner.Close()
+}
+
+// Dump vuelca el Store envuelto, con los valores tal cual están guardados
+// (con su suma).
+func (s *ChecksumStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return s.inner.Dump(ctx, w, opts)
+}
@@ -0,0 +1,58 @@
+package store
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+/*
+	Compresión de los valores grandes antes de cifrarlos (ver
+	EncryptedOptions.CompressMin)
+*/
+
+// compressHeader marca los valores comprimidos, que se guardan (dentro del
+// sobre cifrado) como compressHeader || DEFLATE(valor). Como ttlHeader,
+// empieza por 0x00 para no confundirse con los valores normales.
+var compressHeader = []byte("\x00prac-z\x00")
+
+// compressValue comprime 'value' si ocupa al menos 'min' bytes (min > 0) y
+// así gana espacio; si no, lo devuelve tal cual.
+func compressValue(value []byte, min int) ([]byte, error) {
+	if min <= 0 || len(value) < min {
+		return value, nil
+	}
+	var buf bytes.Buffer
+	buf.Write(compressHeader)
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(value) {
+		return value, nil // ya comprimido o cifrado (como los datos de usuario)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressValue deshace compressValue. Los valores sin la cabecera se
+// devuelven tal cual, así que se leen igual con la compresión activada o
+// no.
+func decompressValue(raw []byte) ([]byte, error) {
+	if !bytes.HasPrefix(raw, compressHeader) {
+		return raw, nil
+	}
+	r := flate.NewReader(bytes.NewReader(raw[len(compressHeader):]))
+	defer r.Close()
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("valor comprimido no válido: %v", err)
+	}
+	return value, nil
+}
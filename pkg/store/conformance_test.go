@@ -0,0 +1,69 @@
+package store_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"prac/pkg/store"
+	"prac/pkg/store/storetest"
+)
+
+// testKey es la clave de los EncryptedStore de las pruebas.
+var testKey = make([]byte, 32)
+
+// engine crea, en un directorio temporal de la prueba, un Store vacío del
+// motor 'name' (ver store.NewStore).
+func engine(name string) storetest.Factory {
+	return func(t *testing.T) store.Store {
+		s, err := store.NewStore(name, filepath.Join(t.TempDir(), "db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+}
+
+// encrypted envuelve un Store de 'inner' en un EncryptedStore con 'opts'.
+func encrypted(inner storetest.Factory, opts store.EncryptedOptions) storetest.Factory {
+	return func(t *testing.T) store.Store {
+		s, err := store.NewEncryptedStore(inner(t), testKey, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+}
+
+// Redis y S3 no se prueban aquí: necesitan un servidor.
+func TestEngines(t *testing.T) {
+	for _, name := range []string{"bbolt", "sqlite", "badger", "leveldb", "json"} {
+		t.Run(name, func(t *testing.T) { storetest.RunConformanceTests(t, engine(name)) })
+	}
+}
+
+func TestDecorators(t *testing.T) {
+	bbolt := engine("bbolt")
+	decorators := []struct {
+		name    string
+		factory storetest.Factory
+	}{
+		{"Encrypted", encrypted(bbolt, store.EncryptedOptions{})},
+		{"EncryptedCompressed", encrypted(bbolt, store.EncryptedOptions{CompressMin: 1})},
+		{"EncryptedChecksum", encrypted(func(t *testing.T) store.Store { return store.NewChecksumStore(bbolt(t), nil) }, store.EncryptedOptions{})},
+		{"Checksum", func(t *testing.T) store.Store { return store.NewChecksumStore(bbolt(t), nil) }},
+		{"Instrumented", func(t *testing.T) store.Store { return store.NewInstrumentedStore(bbolt(t)) }},
+		{"Watch", func(t *testing.T) store.Store { return store.NewWatchStore(bbolt(t)) }},
+		{"Mirror", func(t *testing.T) store.Store { return store.NewMirrorStore(bbolt(t), engine("sqlite")(t), nil) }},
+		{"AppendOnly", func(t *testing.T) store.Store { return store.NewAppendOnlyStore(bbolt(t), "audit") }},
+	}
+	for _, d := range decorators {
+		t.Run(d.name, func(t *testing.T) { storetest.RunConformanceTests(t, d.factory) })
+	}
+}
+
+// Con EncryptKeys, los listados de esos namespaces salen sin orden (ver
+// storetest.Options).
+func TestEncryptedKeys(t *testing.T) {
+	opts := store.EncryptedOptions{EncryptKeys: []string{"ns", "a", "a/b", "a/b/c"}}
+	storetest.RunConformanceTestsWith(t, encrypted(engine("bbolt"), opts), storetest.Options{Unordered: true})
+}
@@ -0,0 +1,850 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"prac/pkg/crypto"
+)
+
+/*
+	Decorador de Store que cifra los valores (y, si se pide, las claves)
+	antes de pasarlos al motor subyacente.
+*/
+
+// encryptedKeyID identifica en la cabecera del sobre la versión de las
+// claves por namespace: "ns-v1", "ns-v2"... (ver EncryptedOptions.KeyVersions).
+const encryptedKeyID = "ns-v%d"
+
+// EncryptedOptions configura un EncryptedStore.
+type EncryptedOptions struct {
+	// Ciphers elige el algoritmo de cada namespace (por defecto, AES-GCM).
+	// Cambiarlo no afecta a los registros ya escritos: el sobre lleva el suyo.
+	Ciphers crypto.CipherPolicy
+
+	// EncryptKeys son los namespaces cuyas claves también se cifran (con
+	// AES-SIV, que es determinista y permite seguir buscando por clave).
+	// Se pierde el orden de las claves y KeysByPrefix tiene que recorrer el
+	// namespace entero, así que no vale para namespaces que dependen de ese
+	// orden (como la auditoría). Las claves escritas antes en claro dejan
+	// de encontrarse.
+	EncryptKeys []string
+
+	// AllowPlaintext hace que Get devuelva tal cual los valores que no son
+	// un sobre (registros de antes de activar el cifrado). Se reescriben
+	// cifrados en el siguiente Put.
+	AllowPlaintext bool
+
+	// CompressMin activa la compresión (DEFLATE, antes de cifrar) de los
+	// valores de al menos ese tamaño en bytes; 0 la desactiva. Sólo se
+	// queda comprimido lo que gana espacio, así que los valores ya cifrados
+	// (como los datos de usuario) se guardan igual. Los valores comprimidos
+	// se leen siempre, aunque después se desactive. Comprimir antes de
+	// cifrar deja ver por el tamaño cuánto se repite un valor: no conviene
+	// en namespaces que mezclen secretos con datos que pueda elegir otro.
+	CompressMin int
+
+	// KeyVersions es la versión de la clave de los valores de cada
+	// namespace (por defecto, 1). Cada versión es una clave distinta
+	// derivada de la maestra: subirla en un namespace cifra lo que se
+	// escribe a partir de entonces con la nueva, sin tocar los demás. Los
+	// registros con versiones anteriores se siguen leyendo y Reencrypt los
+	// pasa a la actual. Las claves de EncryptKeys no cambian de versión.
+	KeyVersions map[string]int
+}
+
+// EncryptedStore implementa Store sobre otro Store cifrando cada valor con
+// una clave propia de su namespace. El valor se autentica junto con su
+// namespace y su clave, así que no se puede mover un registro a otra clave
+// (por ejemplo, de un usuario a otro) sin que falle el descifrado.
+type EncryptedStore struct {
+	inner       Store
+	master      []byte
+	opts        EncryptedOptions
+	encryptKeys map[string]bool
+}
+
+// NewEncryptedStore envuelve 'inner'. Las claves de cada namespace se
+// derivan de 'key', que debe tener crypto.KeySize bytes.
+func NewEncryptedStore(inner Store, key []byte, opts EncryptedOptions) (*EncryptedStore, error) {
+	if len(key) != crypto.KeySize {
+		return nil, fmt.Errorf("clave de cifrado del store no válida: %d bytes", len(key))
+	}
+	for ns, v := range opts.KeyVersions {
+		if v < 1 {
+			return nil, fmt.Errorf("versión de clave no válida para %s: %d", ns, v)
+		}
+	}
+	s := &EncryptedStore{
+		inner:       inner,
+		master:      bytes.Clone(key),
+		opts:        opts,
+		encryptKeys: make(map[string]bool),
+	}
+	for _, ns := range opts.EncryptKeys {
+		s.encryptKeys[ns] = true
+	}
+	return s, nil
+}
+
+// keyVersion devuelve la versión actual de la clave de 'namespace'.
+func (s *EncryptedStore) keyVersion(namespace string) int {
+	if v, ok := s.opts.KeyVersions[namespace]; ok {
+		return v
+	}
+	return 1
+}
+
+// valueKey deriva la versión 'v' de la clave con la que se cifran los
+// valores de 'namespace'. La 1 es la de antes de que hubiera versiones.
+func (s *EncryptedStore) valueKey(namespace string, v int) []byte {
+	if v == 1 {
+		return crypto.DeriveKey(s.master, "store-values:"+namespace)
+	}
+	return crypto.DeriveKey(s.master, fmt.Sprintf("store-values:%s:v%d", namespace, v))
+}
+
+// valueKeys devuelve las claves de los valores de 'namespace' por keyID,
+// desde la versión 1 hasta la actual, derivadas según se van pidiendo.
+// Hay que llamar a 'wipe' al terminar para borrarlas de memoria.
+func (s *EncryptedStore) valueKeys(namespace string) (keys crypto.KeyLookup, wipe func()) {
+	cur := s.keyVersion(namespace)
+	derived := make(map[int][]byte)
+	keys = func(keyID string) ([]byte, error) {
+		var v int
+		if _, err := fmt.Sscanf(keyID, encryptedKeyID, &v); err != nil || v < 1 || v > cur || keyID != fmt.Sprintf(encryptedKeyID, v) {
+			return nil, fmt.Errorf("%w: %q", crypto.ErrUnknownKey, keyID)
+		}
+		if k, ok := derived[v]; ok {
+			return k, nil
+		}
+		k := s.valueKey(namespace, v)
+		derived[v] = k
+		return k, nil
+	}
+	wipe = func() {
+		for _, k := range derived {
+			crypto.Wipe(k)
+		}
+	}
+	return keys, wipe
+}
+
+// keyCipher devuelve el cifrador determinista de las claves de 'namespace'.
+func (s *EncryptedStore) keyCipher(namespace string) (*crypto.DeterministicCipher, error) {
+	k := crypto.DeriveKey(s.master, "store-keys:"+namespace)
+	defer crypto.Wipe(k)
+	return crypto.NewDeterministicCipher(k)
+}
+
+// storedKey traduce la clave del llamante a la que se guarda en el motor.
+func (s *EncryptedStore) storedKey(namespace string, key []byte) ([]byte, error) {
+	if !s.encryptKeys[namespace] {
+		return key, nil
+	}
+	dc, err := s.keyCipher(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return dc.Seal(key, []byte(namespace)), nil
+}
+
+// valueAD es el dato asociado de un valor: su namespace y su clave (en claro).
+func valueAD(namespace string, key []byte) []byte {
+	ad := make([]byte, 0, len(namespace)+1+len(key))
+	ad = append(ad, namespace...)
+	ad = append(ad, 0)
+	return append(ad, key...)
+}
+
+// Put cifra 'value' y lo guarda bajo 'key' en 'namespace'.
+func (s *EncryptedStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	return s.put(AsTx(ctx, s.inner), namespace, key, value)
+}
+
+// put cifra 'value' y lo guarda a través de 't' (el motor o una
+// transacción suya).
+func (s *EncryptedStore) put(t Tx, namespace string, key, value []byte) error {
+	value, err := compressValue(value, s.opts.CompressMin)
+	if err != nil {
+		return err
+	}
+	v := s.keyVersion(namespace)
+	vk := s.valueKey(namespace, v)
+	defer crypto.Wipe(vk)
+	sealed, err := crypto.SealEnvelope(s.opts.Ciphers.For(namespace), fmt.Sprintf(encryptedKeyID, v), vk, value, valueAD(namespace, key))
+	if err != nil {
+		return err
+	}
+	sk, err := s.storedKey(namespace, key)
+	if err != nil {
+		return err
+	}
+	return t.Put(namespace, sk, sealed)
+}
+
+// Get recupera y descifra el valor de 'key' en 'namespace'.
+func (s *EncryptedStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	return s.get(AsTx(ctx, s.inner), namespace, key)
+}
+
+// getter es de donde lee get: el motor (con AsTx), una transacción o una
+// Snapshot (con snapshotGetter).
+type getter interface {
+	Get(namespace string, key []byte) ([]byte, error)
+}
+
+// snapshotGetter presenta una Snapshot como getter con el contexto 'ctx'.
+type snapshotGetter struct {
+	ctx  context.Context
+	snap Snapshot
+}
+
+func (g snapshotGetter) Get(namespace string, key []byte) ([]byte, error) {
+	return g.snap.Get(g.ctx, namespace, key)
+}
+
+// get lee a través de 't' el valor de 'key' y lo descifra.
+func (s *EncryptedStore) get(t getter, namespace string, key []byte) ([]byte, error) {
+	sk, err := s.storedKey(namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := t.Get(namespace, sk)
+	if err != nil {
+		// Que el error no muestre la clave cifrada sino la del llamante
+		if s.encryptKeys[namespace] && err.Error() == errNoKey(sk).Error() {
+			return nil, errNoKey(key)
+		}
+		return nil, err
+	}
+	if s.opts.AllowPlaintext && !crypto.IsEnvelope(sealed) {
+		return sealed, nil
+	}
+	keys, wipe := s.valueKeys(namespace)
+	defer wipe()
+	value, err := s.open(keys, namespace, key, sealed)
+	if err != nil {
+		return nil, err
+	}
+	// La caducidad va cifrada (y comprimida) dentro del valor
+	return liveValue(key, value)
+}
+
+// Exists indica si 'key' está en 'namespace'. Hay que descifrar el valor
+// para ver si ha caducado.
+func (s *EncryptedStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return exists(ctx, s, namespace, key)
+}
+
+// Delete elimina 'key' de 'namespace'.
+func (s *EncryptedStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	return s.del(AsTx(ctx, s.inner), namespace, key)
+}
+
+// del elimina 'key' a través de 't'.
+func (s *EncryptedStore) del(t Tx, namespace string, key []byte) error {
+	sk, err := s.storedKey(namespace, key)
+	if err != nil {
+		return err
+	}
+	return t.Delete(namespace, sk)
+}
+
+// DeleteNamespace borra 'namespace' en el motor subyacente.
+func (s *EncryptedStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	return s.inner.DeleteNamespace(ctx, namespace)
+}
+
+// DeleteByPrefix borra las claves de 'namespace' que empiezan por 'prefix'.
+// Con las claves cifradas no hay prefijo que pasar al motor: se descifran
+// todas para elegir las que caen y se borran en un Batch, así que una
+// clave con el prefijo escrita mientras tanto puede quedarse.
+func (s *EncryptedStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	if !s.encryptKeys[namespace] {
+		return s.inner.DeleteByPrefix(ctx, namespace, prefix)
+	}
+	stored, err := s.inner.ListKeys(ctx, namespace)
+	if err != nil {
+		return 0, err
+	}
+	dc, err := s.keyCipher(namespace)
+	if err != nil {
+		return 0, err
+	}
+	var doomed [][]byte
+	for _, sk := range stored {
+		k, err := dc.Open(sk, []byte(namespace))
+		if err != nil {
+			return 0, fmt.Errorf("clave cifrada no válida en %s: %v", namespace, err)
+		}
+		if bytes.HasPrefix(k, prefix) {
+			doomed = append(doomed, sk)
+		}
+	}
+	if len(doomed) == 0 {
+		return 0, nil
+	}
+	err = s.inner.Batch(ctx, func(tx Tx) error {
+		for _, sk := range doomed {
+			if err := tx.Delete(namespace, sk); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(doomed), nil
+}
+
+// encryptedTx es la vista cifrada de una transacción del motor subyacente.
+type encryptedTx struct {
+	s  *EncryptedStore
+	tx Tx
+}
+
+func (t encryptedTx) Put(namespace string, key, value []byte) error {
+	return t.s.put(t.tx, namespace, key, value)
+}
+
+func (t encryptedTx) Get(namespace string, key []byte) ([]byte, error) {
+	return t.s.get(t.tx, namespace, key)
+}
+
+func (t encryptedTx) Delete(namespace string, key []byte) error {
+	return t.s.del(t.tx, namespace, key)
+}
+
+// PutWithTTL cifra 'value' junto con su caducidad, de modo que no se puede
+// alargar sin la clave.
+func (s *EncryptedStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return putWithTTL(tx, namespace, key, value, ttl)
+	})
+}
+
+// Batch ejecuta 'fn' en una transacción del motor subyacente, cifrando y
+// descifrando igual que fuera de ella.
+func (s *EncryptedStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	return s.inner.Batch(ctx, func(tx Tx) error {
+		return fn(encryptedTx{s: s, tx: tx})
+	})
+}
+
+// ListKeys devuelve las claves de 'namespace' (descifradas si hace falta).
+func (s *EncryptedStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	keys, err := s.inner.ListKeys(ctx, namespace)
+	if err != nil || !s.encryptKeys[namespace] {
+		return keys, err
+	}
+	dc, err := s.keyCipher(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for i, sk := range keys {
+		k, err := dc.Open(sk, []byte(namespace))
+		if err != nil {
+			return nil, fmt.Errorf("clave cifrada no válida en %s: %v", namespace, err)
+		}
+		keys[i] = k
+	}
+	return keys, nil
+}
+
+// CountKeys cuenta las claves de 'namespace' en el motor subyacente (cifrar
+// las claves no cambia cuántas hay).
+func (s *EncryptedStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	return s.inner.CountKeys(ctx, namespace)
+}
+
+// KeysByPrefix devuelve las claves de 'namespace' que empiezan por 'prefix'.
+// Con las claves cifradas no hay orden que aprovechar y se recorren todas.
+func (s *EncryptedStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	if !s.encryptKeys[namespace] {
+		return s.inner.KeysByPrefix(ctx, namespace, prefix)
+	}
+	keys, err := s.ListKeys(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var matched [][]byte
+	for _, k := range keys {
+		if bytes.HasPrefix(k, prefix) {
+			matched = append(matched, k)
+		}
+	}
+	return matched, nil
+}
+
+// Namespaces devuelve los namespaces del motor subyacente.
+func (s *EncryptedStore) Namespaces(ctx context.Context) ([]string, error) {
+	return s.inner.Namespaces(ctx)
+}
+
+// NamespacesUnder devuelve los namespaces anidados del motor subyacente.
+func (s *EncryptedStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	return s.inner.NamespacesUnder(ctx, parent)
+}
+
+// BadRecord es un registro que no supera Check.
+type BadRecord struct {
+	Namespace string
+	Key       string
+	Reason    string
+}
+
+// CheckReport es el resultado de Check sobre un namespace.
+type CheckReport struct {
+	Records   int         // registros revisados
+	Plaintext int         // registros anteriores al cifrado (sin sobre)
+	Stale     int         // registros cifrados con una versión anterior de la clave
+	Problems  []BadRecord // registros corruptos o manipulados
+}
+
+// ListKeysPage devuelve una página de las claves de 'namespace'.
+func (s *EncryptedStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.KeysByPrefixPage(ctx, namespace, nil, after, limit)
+}
+
+// KeysByPrefixPage devuelve una página de las claves que empiezan por
+// 'prefix'. Con las claves cifradas se pagina sobre las claves guardadas
+// (el cursor es la clave cifrada de la última devuelta) y se van
+// descartando las que no tienen el prefijo, así que puede leer varias
+// páginas del motor para llenar una.
+func (s *EncryptedStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	if !s.encryptKeys[namespace] {
+		return s.inner.KeysByPrefixPage(ctx, namespace, prefix, after, limit)
+	}
+	if err := checkLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	dc, err := s.keyCipher(namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	var keys, stored [][]byte
+	cursor := after
+	for {
+		page, next, err := s.inner.ListKeysPage(ctx, namespace, cursor, limit+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, sk := range page {
+			k, err := dc.Open(sk, []byte(namespace))
+			if err != nil {
+				return nil, nil, fmt.Errorf("clave cifrada no válida en %s: %v", namespace, err)
+			}
+			if !bytes.HasPrefix(k, prefix) {
+				continue
+			}
+			keys, stored = append(keys, k), append(stored, sk)
+			if len(keys) > limit {
+				return keys[:limit], bytes.Clone(stored[limit-1]), nil
+			}
+		}
+		if next == nil {
+			return keys, nil, nil
+		}
+		cursor = next
+	}
+}
+
+// GetRange descifra las entradas de [start, end) del motor subyacente; si
+// alguna ha caducado, vuelve a pedir más a partir de la última. Con las
+// claves cifradas no hay orden que aprovechar: se recorre el namespace
+// entero con ForEach y se ordenan las que caen en el rango.
+func (s *EncryptedStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	if s.encryptKeys[namespace] {
+		r := newRangeEntries(namespace, end, math.MaxInt)
+		err := s.ForEach(ctx, namespace, func(key, value []byte) error {
+			if bytes.Compare(key, start) >= 0 {
+				r.add(key, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(r.list, func(i, j int) bool { return bytes.Compare(r.list[i].Key, r.list[j].Key) < 0 })
+		return r.list[:min(limit, len(r.list))], nil
+	}
+
+	keys, wipe := s.valueKeys(namespace)
+	defer wipe()
+	r := newRangeEntries(namespace, end, limit)
+	for {
+		want := limit - len(r.list)
+		page, err := s.inner.GetRange(ctx, namespace, start, end, want)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range page {
+			value := e.Value
+			if !s.opts.AllowPlaintext || crypto.IsEnvelope(value) {
+				if value, err = s.open(keys, namespace, e.Key, value); err != nil {
+					return nil, err
+				}
+			}
+			r.add(e.Key, value)
+		}
+		if len(page) < want || len(r.list) == limit {
+			return r.list, nil
+		}
+		start = append(page[len(page)-1].Key, 0)
+	}
+}
+
+// LastN descifra las últimas entradas del motor subyacente; si alguna ha
+// caducado, vuelve a pedir el doble. Con las claves cifradas no hay orden
+// que aprovechar: se recorre el namespace entero con ForEach.
+func (s *EncryptedStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	if err := checkLimit(n); err != nil {
+		return nil, err
+	}
+	if s.encryptKeys[namespace] {
+		r := newRangeEntries(namespace, nil, math.MaxInt)
+		err := s.ForEach(ctx, namespace, func(key, value []byte) error {
+			if bytes.HasPrefix(key, prefix) {
+				r.add(key, value)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(r.list, func(i, j int) bool { return bytes.Compare(r.list[i].Key, r.list[j].Key) > 0 })
+		return r.list[:min(n, len(r.list))], nil
+	}
+
+	keys, wipe := s.valueKeys(namespace)
+	defer wipe()
+	for want := n; ; want *= 2 {
+		page, err := s.inner.LastN(ctx, namespace, prefix, want)
+		if err != nil {
+			return nil, err
+		}
+		r := newRangeEntries(namespace, nil, n)
+		for _, e := range page {
+			value := e.Value
+			if !s.opts.AllowPlaintext || crypto.IsEnvelope(value) {
+				if value, err = s.open(keys, namespace, e.Key, value); err != nil {
+					return nil, err
+				}
+			}
+			if !r.add(e.Key, value) {
+				break
+			}
+		}
+		if len(page) < want || len(r.list) == n {
+			return r.list, nil
+		}
+	}
+}
+
+// open descifra y descomprime un valor de 'namespace' leído del motor
+// subyacente. La caducidad, si la tiene, sigue delante del valor.
+func (s *EncryptedStore) open(keys crypto.KeyLookup, namespace string, key, sealed []byte) ([]byte, error) {
+	value, err := crypto.OpenEnvelope(keys, sealed, valueAD(namespace, key))
+	if err != nil {
+		return nil, fmt.Errorf("error descifrando %s/%s: %v", namespace, string(key), err)
+	}
+	if value, err = decompressValue(value); err != nil {
+		return nil, fmt.Errorf("error descifrando %s/%s: %v", namespace, string(key), err)
+	}
+	return value, nil
+}
+
+// ForEach recorre 'namespace' en el motor subyacente descifrando cada
+// registro. Con las claves cifradas, el orden es el de las claves tal y
+// como están guardadas, no el de las claves en claro.
+func (s *EncryptedStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.forEach(ctx, s.inner.ForEach, namespace, fn)
+}
+
+// forEach es ForEach sobre el recorrido 'scan' (del motor o de una
+// Snapshot suya).
+func (s *EncryptedStore) forEach(ctx context.Context, scan func(ctx context.Context, namespace string, fn func(key, value []byte) error) error, namespace string, fn func(key, value []byte) error) error {
+	var dc *crypto.DeterministicCipher
+	if s.encryptKeys[namespace] {
+		var err error
+		if dc, err = s.keyCipher(namespace); err != nil {
+			return err
+		}
+	}
+	keys, wipe := s.valueKeys(namespace)
+	defer wipe()
+
+	fn = liveEntries(fn)
+	return scan(ctx, namespace, func(sk, sealed []byte) error {
+		key := sk
+		if dc != nil {
+			var err error
+			if key, err = dc.Open(sk, []byte(namespace)); err != nil {
+				return fmt.Errorf("clave cifrada no válida en %s: %v", namespace, err)
+			}
+		}
+		if s.opts.AllowPlaintext && !crypto.IsEnvelope(sealed) {
+			return fn(key, sealed)
+		}
+		value, err := crypto.OpenEnvelope(keys, sealed, valueAD(namespace, key))
+		if err != nil {
+			return fmt.Errorf("error descifrando %s/%s: %v", namespace, string(key), err)
+		}
+		defer crypto.Wipe(value)
+		plain, err := decompressValue(value)
+		if err != nil {
+			return fmt.Errorf("error descifrando %s/%s: %v", namespace, string(key), err)
+		}
+		defer crypto.Wipe(plain)
+		return fn(key, plain)
+	})
+}
+
+// Check comprueba la etiqueta de autenticación de todos los registros de
+// 'namespace' (y, si sus claves van cifradas, también la de cada clave),
+// sin devolver su contenido. Un registro en claro sólo es un problema si no
+// está activado AllowPlaintext.
+func (s *EncryptedStore) Check(ctx context.Context, namespace string) (CheckReport, error) {
+	var rep CheckReport
+	var dc *crypto.DeterministicCipher
+	if s.encryptKeys[namespace] {
+		var err error
+		if dc, err = s.keyCipher(namespace); err != nil {
+			return rep, err
+		}
+	}
+	keys, wipe := s.valueKeys(namespace)
+	defer wipe()
+	current := fmt.Sprintf(encryptedKeyID, s.keyVersion(namespace))
+
+	err := s.inner.ForEach(ctx, namespace, func(sk, sealed []byte) error {
+		rep.Records++
+		key := sk
+		if dc != nil {
+			var err error
+			if key, err = dc.Open(sk, []byte(namespace)); err != nil {
+				rep.Problems = append(rep.Problems, BadRecord{namespace, fmt.Sprintf("%x", sk), "clave cifrada no válida"})
+				return nil
+			}
+		}
+		if !crypto.IsEnvelope(sealed) {
+			if s.opts.AllowPlaintext {
+				rep.Plaintext++
+			} else {
+				rep.Problems = append(rep.Problems, BadRecord{namespace, string(key), "valor sin cifrar"})
+			}
+			return nil
+		}
+		value, err := crypto.OpenEnvelope(keys, sealed, valueAD(namespace, key))
+		if err != nil {
+			rep.Problems = append(rep.Problems, BadRecord{namespace, string(key), err.Error()})
+			return nil
+		}
+		crypto.Wipe(value)
+		if h, _, _ := crypto.ParseEnvelopeHeader(sealed); h.KeyID != current {
+			rep.Stale++
+		}
+		return nil
+	})
+	return rep, err
+}
+
+// SealPlaintext reescribe cifrados los registros de 'namespace' que siguen
+// en claro (de antes de activar el cifrado, ver AllowPlaintext) y devuelve
+// cuántos ha cifrado. Se guardan tal cual estaban, con su caducidad si la
+// tenían. Un registro que se reescribe entre tanto ya no está en claro y se
+// deja como está.
+func (s *EncryptedStore) SealPlaintext(ctx context.Context, namespace string) (int, error) {
+	if s.encryptKeys[namespace] {
+		return 0, nil // sus claves sólo las escribe el cifrado
+	}
+	var plain [][]byte
+	err := s.inner.ForEach(ctx, namespace, func(key, raw []byte) error {
+		if !crypto.IsEnvelope(raw) {
+			plain = append(plain, bytes.Clone(key))
+		}
+		return nil
+	})
+	if err != nil || len(plain) == 0 {
+		return 0, err
+	}
+	sealed := 0
+	err = s.inner.Batch(ctx, func(tx Tx) error {
+		for _, key := range plain {
+			raw, err := tx.Get(namespace, key)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if crypto.IsEnvelope(raw) {
+				continue
+			}
+			if err := s.put(tx, namespace, key, raw); err != nil {
+				return err
+			}
+			sealed++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return sealed, nil
+}
+
+// Reencrypt reescribe con la versión actual de la clave (ver
+// EncryptedOptions.KeyVersions) los registros de 'namespace' cifrados con
+// una anterior y devuelve cuántos ha reescrito. Como SealPlaintext, se
+// guardan tal cual estaban, con su caducidad si la tenían, y un registro que
+// se reescribe entre tanto ya lleva la clave nueva y se deja como está. Los
+// registros en claro no se tocan.
+func (s *EncryptedStore) Reencrypt(ctx context.Context, namespace string) (int, error) {
+	current := fmt.Sprintf(encryptedKeyID, s.keyVersion(namespace))
+	stale := func(raw []byte) bool {
+		h, _, err := crypto.ParseEnvelopeHeader(raw)
+		return err == nil && h.KeyID != current
+	}
+	var old [][]byte
+	err := s.inner.ForEach(ctx, namespace, func(sk, raw []byte) error {
+		if stale(raw) {
+			old = append(old, bytes.Clone(sk))
+		}
+		return nil
+	})
+	if err != nil || len(old) == 0 {
+		return 0, err
+	}
+
+	var dc *crypto.DeterministicCipher
+	if s.encryptKeys[namespace] {
+		if dc, err = s.keyCipher(namespace); err != nil {
+			return 0, err
+		}
+	}
+	keys, wipe := s.valueKeys(namespace)
+	defer wipe()
+	rewritten := 0
+	err = s.inner.Batch(ctx, func(tx Tx) error {
+		for _, sk := range old {
+			raw, err := tx.Get(namespace, sk)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !stale(raw) {
+				continue
+			}
+			key := sk
+			if dc != nil {
+				if key, err = dc.Open(sk, []byte(namespace)); err != nil {
+					return fmt.Errorf("clave cifrada no válida en %s: %v", namespace, err)
+				}
+			}
+			value, err := s.open(keys, namespace, key, raw)
+			if err != nil {
+				return err
+			}
+			err = s.put(tx, namespace, key, value)
+			crypto.Wipe(value)
+			if err != nil {
+				return err
+			}
+			rewritten++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rewritten, nil
+}
+
+// Backup copia la base de datos subyacente tal cual (con los valores cifrados).
+func (s *EncryptedStore) Backup(ctx context.Context, w io.Writer) error {
+	return s.inner.Backup(ctx, w)
+}
+
+// Restore restaura en caliente la copia 'r' en el motor subyacente, si
+// éste lo permite (ver Restorer). Los valores de la copia siguen cifrados
+// con las claves de este EncryptedStore.
+func (s *EncryptedStore) Restore(r io.Reader) error {
+	rs, ok := s.inner.(Restorer)
+	if !ok {
+		return fmt.Errorf("el motor de almacenamiento no permite restaurar en caliente")
+	}
+	return rs.Restore(r)
+}
+
+// Compact compacta el motor subyacente, si éste lo permite (ver Compacter).
+func (s *EncryptedStore) Compact() (before, after int64, err error) {
+	c, ok := s.inner.(Compacter)
+	if !ok {
+		return 0, 0, fmt.Errorf("el motor de almacenamiento no necesita compactarse")
+	}
+	return c.Compact()
+}
+
+// Snapshot fija una vista del motor subyacente (ver Snapshotter) que
+// descifra igual que el EncryptedStore.
+func (s *EncryptedStore) Snapshot() (Snapshot, error) {
+	snap, err := snapshotOf(s.inner)
+	if err != nil {
+		return nil, err
+	}
+	return encryptedSnapshot{s: s, snap: snap}, nil
+}
+
+// stats da la ocupación del motor subyacente (ver Stats), que es la de
+// los valores ya cifrados.
+func (s *EncryptedStore) stats(ctx context.Context) (StoreStats, error) {
+	return Stats(ctx, s.inner)
+}
+
+// encryptedSnapshot es la vista cifrada de una Snapshot del motor.
+type encryptedSnapshot struct {
+	s    *EncryptedStore
+	snap Snapshot
+}
+
+func (p encryptedSnapshot) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	return p.s.get(snapshotGetter{ctx, p.snap}, namespace, key)
+}
+
+func (p encryptedSnapshot) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return p.s.forEach(ctx, p.snap.ForEach, namespace, fn)
+}
+
+func (p encryptedSnapshot) Namespaces(ctx context.Context) ([]string, error) {
+	return p.snap.Namespaces(ctx)
+}
+
+func (p encryptedSnapshot) Release() error {
+	return p.snap.Release()
+}
+
+// Close borra la clave de memoria y cierra el motor subyacente.
+func (s *EncryptedStore) Close() error {
+	crypto.Wipe(s.master)
+	return s.inner.Close()
+}
+
+// Dump vuelca el motor subyacente, es decir, los datos tal y como están en
+// disco (cifrados).
+func (s *EncryptedStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return s.inner.Dump(ctx, w, opts)
+}
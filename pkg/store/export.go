@@ -0,0 +1,208 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+	Exportación e importación de todo el Store en JSON, para pasar los datos
+	de un motor a otro (por ejemplo, de bbolt a SQLite) o preparar datos de
+	prueba
+*/
+
+// exportFormat y exportVersion identifican los ficheros de ExportJSON.
+const (
+	exportFormat  = "prac-store"
+	exportVersion = 1
+)
+
+// importBatchSize es cuántas entradas escribe ImportJSON en cada Batch.
+const importBatchSize = 500
+
+// rawScanner lo cumplen los motores: scan es como ForEach, pero sin quitar
+// la cabecera de caducidad ni saltarse lo caducado, para que la copia
+// conserve las caducidades (y el índice de SweepExpired siga valiendo).
+type rawScanner interface {
+	scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error
+}
+
+// exportEntry es una entrada del fichero. encoding/json codifica los []byte
+// en base64, así que claves y valores binarios pasan sin cambios.
+type exportEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// exportNamespace es un namespace del fichero, con todas sus entradas.
+type exportNamespace struct {
+	Name    string        `json:"name"`
+	Entries []exportEntry `json:"entries"`
+}
+
+// ExportJSON escribe en 'w' todos los namespaces de 's' con sus claves y
+// valores, y devuelve cuántas entradas ha escrito. El fichero es un objeto
+// {"format", "version", "namespaces": [{"name", "entries": [{"key",
+// "value"}]}]} con claves y valores en base64, que se escribe por partes
+// sin cargar la base de datos en memoria.
+//
+// Con un motor, los valores salen tal cual están guardados (cifrados, si
+// se escribieron a través de un EncryptedStore). Con un EncryptedStore
+// salen descifrados y sin las entradas caducadas: sirve para preparar
+// datos de prueba, pero la copia contiene los datos en claro. Si 's'
+// permite instantáneas (ver Snapshotter), todo sale de una misma, así que
+// la copia es consistente aunque se siga escribiendo.
+func ExportJSON(ctx context.Context, s Store, w io.Writer) (int, error) {
+	snap, err := snapshotOf(s)
+	if errors.Is(err, errNoSnapshots) {
+		return exportJSON(ctx, s, w)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer snap.Release()
+	return exportJSON(ctx, snap, w)
+}
+
+// exportJSON es ExportJSON sobre un Store o una Snapshot.
+func exportJSON(ctx context.Context, s namespaceReader, w io.Writer) (int, error) {
+	scan := s.ForEach
+	if rs, ok := s.(rawScanner); ok {
+		scan = rs.scan
+	}
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error listando los namespaces: %v", err)
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "{\"format\":%q,\"version\":%d,\"namespaces\":[", exportFormat, exportVersion)
+	n := 0
+	for i, ns := range names {
+		name, _ := json.Marshal(ns)
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		fmt.Fprintf(bw, "\n{\"name\":%s,\"entries\":[", name)
+		first := true
+		err := scan(ctx, ns, func(key, value []byte) error {
+			raw, err := json.Marshal(exportEntry{key, value})
+			if err != nil {
+				return err
+			}
+			if !first {
+				bw.WriteString(",")
+			}
+			first = false
+			bw.WriteString("\n")
+			bw.Write(raw)
+			n++
+			return nil
+		})
+		if err != nil {
+			return n, fmt.Errorf("error exportando %s: %v", ns, err)
+		}
+		bw.WriteString("]}")
+	}
+	bw.WriteString("\n]}\n")
+	return n, bw.Flush()
+}
+
+// ImportJSON escribe en 's' las entradas de un fichero de ExportJSON y
+// devuelve cuántas ha escrito. Las claves que ya existan se sobrescriben;
+// los namespaces vacíos del fichero no se crean (salvo como antecesores de
+// otros). Las escrituras van en Batch de importBatchSize entradas: si falla
+// a medias, lo ya importado se queda.
+func ImportJSON(ctx context.Context, s Store, r io.Reader) (int, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+	n := 0
+	checked := false
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return n, fmt.Errorf("fichero de exportación no válido: %v", err)
+		}
+		switch tok {
+		case "format":
+			var format string
+			if err := dec.Decode(&format); err != nil || format != exportFormat {
+				return n, fmt.Errorf("no es un fichero de exportación de prac")
+			}
+		case "version":
+			var version int
+			if err := dec.Decode(&version); err != nil || version != exportVersion {
+				return n, fmt.Errorf("versión de exportación no soportada")
+			}
+			checked = true
+		case "namespaces":
+			if !checked {
+				return n, fmt.Errorf("fichero de exportación sin formato ni versión")
+			}
+			if err := expectDelim(dec, '['); err != nil {
+				return n, err
+			}
+			// Un namespace cada vez: el fichero entero no tiene por qué caber en memoria
+			for dec.More() {
+				var ns exportNamespace
+				if err := dec.Decode(&ns); err != nil {
+					return n, fmt.Errorf("fichero de exportación no válido: %v", err)
+				}
+				written, err := importNamespace(ctx, s, ns)
+				n += written
+				if err != nil {
+					return n, fmt.Errorf("error importando %s: %v", ns.Name, err)
+				}
+			}
+			if err := expectDelim(dec, ']'); err != nil {
+				return n, err
+			}
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return n, fmt.Errorf("fichero de exportación no válido: %v", err)
+			}
+		}
+	}
+	return n, expectDelim(dec, '}')
+}
+
+// importNamespace escribe las entradas de 'ns' por lotes.
+func importNamespace(ctx context.Context, s Store, ns exportNamespace) (int, error) {
+	n := 0
+	for len(ns.Entries) > 0 {
+		batch := ns.Entries[:min(len(ns.Entries), importBatchSize)]
+		err := s.Batch(ctx, func(tx Tx) error {
+			for _, e := range batch {
+				if err := tx.Put(ns.Name, e.Key, e.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+		n += len(batch)
+		ns.Entries = ns.Entries[len(batch):]
+	}
+	return n, nil
+}
+
+// expectDelim lee el siguiente token de 'dec' y comprueba que es 'want'.
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("fichero de exportación no válido: %v", err)
+	}
+	if tok != want {
+		return fmt.Errorf("fichero de exportación no válido: se esperaba %q", want)
+	}
+	return nil
+}
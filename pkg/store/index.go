@@ -0,0 +1,227 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+)
+
+// FieldIndex mantiene en un namespace propio un índice secundario
+// valor -> clave de registro. Las entradas se guardan como
+// índice || '/' || clave, de modo que varios registros pueden compartir
+// índice: es lo normal con índices ciegos truncados (crypto.BlindIndex),
+// donde dos valores distintos pueden colisionar. Indexer lo mantiene en
+// la misma transacción que los registros.
+type FieldIndex struct {
+	db        Store
+	namespace string
+	index     func(value string) []byte
+}
+
+// NewFieldIndex crea un índice en 'namespace' que calcula la entrada de
+// cada valor con 'index' (por ejemplo, crypto.BlindIndex.Compute).
+func NewFieldIndex(db Store, namespace string, index func(value string) []byte) *FieldIndex {
+	return &FieldIndex{db: db, namespace: namespace, index: index}
+}
+
+// entryPrefix devuelve el prefijo común a todas las entradas de 'value'.
+func (ix *FieldIndex) entryPrefix(value string) []byte {
+	return append(ix.index(value), '/')
+}
+
+// Add asocia 'value' al registro 'recordKey'.
+func (ix *FieldIndex) Add(ctx context.Context, value string, recordKey []byte) error {
+	return ix.AddTx(AsTx(ctx, ix.db), value, recordKey)
+}
+
+// AddTx es Add a través de 'tx', para hacerlo en el mismo Batch que la
+// escritura del registro.
+func (ix *FieldIndex) AddTx(tx Tx, value string, recordKey []byte) error {
+	return tx.Put(ix.namespace, append(ix.entryPrefix(value), recordKey...), nil)
+}
+
+// Remove elimina la asociación entre 'value' y 'recordKey'.
+func (ix *FieldIndex) Remove(ctx context.Context, value string, recordKey []byte) error {
+	return ix.RemoveTx(AsTx(ctx, ix.db), value, recordKey)
+}
+
+// RemoveTx es Remove a través de 'tx'. Quitar una asociación que no existe
+// no es un error.
+func (ix *FieldIndex) RemoveTx(tx Tx, value string, recordKey []byte) error {
+	err := tx.Delete(ix.namespace, append(ix.entryPrefix(value), recordKey...))
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	return err
+}
+
+// Lookup devuelve las claves de los registros cuyo valor es 'value'. Cada
+// candidato se pasa a 'verify' (que normalmente descifra el registro y
+// compara el campo) para descartar las colisiones del índice; si 'verify'
+// es nil se devuelven todos los candidatos.
+func (ix *FieldIndex) Lookup(ctx context.Context, value string, verify func(recordKey []byte) (bool, error)) ([][]byte, error) {
+	prefix := ix.entryPrefix(value)
+	entries, err := ix.db.KeysByPrefix(ctx, ix.namespace, prefix)
+	if err != nil {
+		// Un índice que aún no tiene entradas no es un error
+		if errors.Is(err, ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var matches [][]byte
+	for _, e := range entries {
+		recordKey := bytes.Clone(e[len(prefix):])
+		if verify != nil {
+			ok, err := verify(recordKey)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+		}
+		matches = append(matches, recordKey)
+	}
+	return matches, nil
+}
+
+// FieldFunc extrae de un registro el valor de un campo indexado; 'ok' es
+// false si el registro no lo tiene (y entonces no se indexa).
+type FieldFunc func(record []byte) (value string, ok bool)
+
+// indexedField es un índice de un Indexer con la función de su campo.
+type indexedField struct {
+	ix    *FieldIndex
+	field FieldFunc
+}
+
+// Indexer mantiene los FieldIndex de los registros de un namespace a la
+// vez que los registros: Put y Delete escriben el registro y ajustan sus
+// entradas en todos los índices dentro de la misma Tx, de modo que un
+// índice nunca apunta a un valor que el registro ya no tiene (salvo las
+// colisiones propias de los índices ciegos).
+type Indexer struct {
+	namespace string
+	fields    []indexedField
+}
+
+// NewIndexer crea un Indexer, aún sin índices, para los registros de
+// 'namespace'.
+func NewIndexer(namespace string) *Indexer {
+	return &Indexer{namespace: namespace}
+}
+
+// Index añade el índice 'ix' del campo que extrae 'field'.
+func (x *Indexer) Index(ix *FieldIndex, field FieldFunc) *Indexer {
+	x.fields = append(x.fields, indexedField{ix, field})
+	return x
+}
+
+// Put escribe 'record' en 'key' a través de 'tx' y actualiza los índices:
+// retira las entradas de los campos del registro anterior que han cambiado
+// y añade las de los nuevos. Debe llamarse dentro de un Batch para que
+// registro e índices cambien juntos.
+func (x *Indexer) Put(tx Tx, key, record []byte) error {
+	old, err := tx.Get(x.namespace, key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	hadOld := err == nil
+	for _, f := range x.fields {
+		newValue, hasNew := f.field(record)
+		var oldValue string
+		var hasOld bool
+		if hadOld {
+			oldValue, hasOld = f.field(old)
+		}
+		if hasOld && hasNew && oldValue == newValue {
+			continue
+		}
+		if hasOld {
+			if err := f.ix.RemoveTx(tx, oldValue, key); err != nil {
+				return err
+			}
+		}
+		if hasNew {
+			if err := f.ix.AddTx(tx, newValue, key); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Put(x.namespace, key, record)
+}
+
+// Delete borra el registro 'key' a través de 'tx' con sus entradas en los
+// índices.
+func (x *Indexer) Delete(tx Tx, key []byte) error {
+	old, err := tx.Get(x.namespace, key)
+	if err != nil {
+		return err
+	}
+	for _, f := range x.fields {
+		if value, ok := f.field(old); ok {
+			if err := f.ix.RemoveTx(tx, value, key); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Delete(x.namespace, key)
+}
+
+// rebuildPageSize es cuántos registros indexa Rebuild en cada Batch.
+const rebuildPageSize = 256
+
+// Rebuild añade a los índices las entradas de todos los registros que ya
+// hay en 's' (por ejemplo, al crear un índice nuevo sobre datos antiguos) y
+// devuelve cuántos registros ha indexado. Las entradas que sobren de antes
+// no se quitan. Va por páginas, cada una en su Batch: no se escribe
+// mientras se recorre el namespace.
+func (x *Indexer) Rebuild(ctx context.Context, s Store) (int, error) {
+	n := 0
+	var cursor []byte
+	for {
+		keys, next, err := s.ListKeysPage(ctx, x.namespace, cursor, rebuildPageSize)
+		if errors.Is(err, ErrNotFound) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		indexed := 0
+		err = s.Batch(ctx, func(tx Tx) error {
+			indexed = 0
+			for _, key := range keys {
+				record, err := tx.Get(x.namespace, key)
+				if errors.Is(err, ErrNotFound) {
+					continue // borrado o caducado mientras tanto
+				}
+				if err != nil {
+					return err
+				}
+				has := false
+				for _, f := range x.fields {
+					if value, ok := f.field(record); ok {
+						if err := f.ix.AddTx(tx, value, key); err != nil {
+							return err
+						}
+						has = true
+					}
+				}
+				if has {
+					indexed++
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return n, err
+		}
+		n += indexed
+		if next == nil {
+			return n, nil
+		}
+		cursor = next
+	}
+}
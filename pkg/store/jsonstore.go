@@ -0,0 +1,564 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+/*
+	Implementación de la interfaz Store con un fichero JSON por namespace,
+	pensada para depurar y para clase: se abre con cualquier editor de texto
+*/
+
+// jsonExt es la extensión de los ficheros de namespace.
+const jsonExt = ".json"
+
+// jsonEntry es un registro en el fichero de su namespace. Las claves y
+// valores que son texto se guardan tal cual; los binarios, en base64 en
+// el campo *_base64 correspondiente.
+type jsonEntry struct {
+	Key         *string `json:"key,omitempty"`
+	KeyBase64   []byte  `json:"key_base64,omitempty"`
+	Value       *string `json:"value,omitempty"`
+	ValueBase64 []byte  `json:"value_base64,omitempty"`
+}
+
+// JSONStore guarda cada namespace en <dir>/<namespace>.json. Todo el
+// contenido vive también en memoria y cada escritura reescribe el fichero
+// entero: no sirve para bases de datos grandes.
+type JSONStore struct {
+	dir string
+
+	mu   sync.RWMutex
+	data map[string]map[string][]byte
+}
+
+// NewJSONStore abre (o crea) el directorio 'dir' y carga sus namespaces.
+func NewJSONStore(dir string) (*JSONStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error al abrir el directorio json: %v", err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"+jsonExt))
+	if err != nil {
+		return nil, err
+	}
+	s := &JSONStore{dir: dir, data: make(map[string]map[string][]byte)}
+	for _, f := range files {
+		ns, err := url.PathUnescape(strings.TrimSuffix(filepath.Base(f), jsonExt))
+		if err != nil {
+			return nil, fmt.Errorf("nombre de fichero no válido: %s", f)
+		}
+		raw, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo %s: %v", f, err)
+		}
+		var entries []jsonEntry
+		if err := json.Unmarshal(raw, &entries); err != nil {
+			return nil, fmt.Errorf("%s mal formado: %v", f, err)
+		}
+		m := make(map[string][]byte, len(entries))
+		for _, e := range entries {
+			k, v := e.KeyBase64, e.ValueBase64
+			if e.Key != nil {
+				k = []byte(*e.Key)
+			}
+			if e.Value != nil {
+				v = []byte(*e.Value)
+			}
+			m[string(k)] = nonNil(v)
+		}
+		s.data[ns] = m
+	}
+	return s, nil
+}
+
+// path devuelve el fichero de 'namespace' (con el nombre escapado para que
+// no pueda salir del directorio).
+func (s *JSONStore) path(namespace string) string {
+	return filepath.Join(s.dir, url.PathEscape(namespace)+jsonExt)
+}
+
+// sortedKeys devuelve las claves de 'm' en orden.
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// textOrBase64 coloca 'b' como texto o, si no es UTF-8 imprimible, en base64.
+func textOrBase64(b []byte, text **string, b64 *[]byte) {
+	if utf8.Valid(b) && !bytes.ContainsAny(b, "\x00") {
+		str := string(b)
+		*text = &str
+		return
+	}
+	*b64 = b
+}
+
+// encodeNamespace serializa un namespace ordenado por clave.
+func encodeNamespace(m map[string][]byte) ([]byte, error) {
+	entries := make([]jsonEntry, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		var e jsonEntry
+		textOrBase64([]byte(k), &e.Key, &e.KeyBase64)
+		textOrBase64(m[k], &e.Value, &e.ValueBase64)
+		entries = append(entries, e)
+	}
+	return json.MarshalIndent(entries, "", "  ")
+}
+
+// flush reescribe el fichero de 'namespace' de forma atómica. Se llama con
+// s.mu tomado para escritura.
+func (s *JSONStore) flush(namespace string) error {
+	raw, err := encodeNamespace(s.data[namespace])
+	if err != nil {
+		return err
+	}
+	path := s.path(namespace)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(raw, '\n'), 0600); err != nil {
+		return fmt.Errorf("error escribiendo %s: %v", path, err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace'. Si hay que
+// crear el namespace o alguno de sus antecesores, se escriben también sus
+// ficheros (vacíos).
+func (s *JSONStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return tx.Put(namespace, key, value)
+	})
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (s *JSONStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.data[namespace]
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+	v, ok := m[string(key)]
+	if !ok {
+		return nil, errNoKey(key)
+	}
+	return liveValue(key, bytes.Clone(v))
+}
+
+// Exists indica si 'key' está en 'namespace' (y no ha caducado).
+func (s *JSONStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return exists(ctx, s, namespace, key)
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (s *JSONStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.data[namespace]
+	if !ok {
+		return errNoNamespace(namespace)
+	}
+	old, existed := m[string(key)]
+	if !existed {
+		return nil
+	}
+	delete(m, string(key))
+	if err := s.flush(namespace); err != nil {
+		m[string(key)] = old
+		return err
+	}
+	return nil
+}
+
+// jsonTx implementa Tx para JSONStore. Los namespaces que toca se copian
+// en 'work' la primera vez y Batch sólo los publica al final.
+type jsonTx struct {
+	s    *JSONStore
+	work map[string]map[string][]byte
+}
+
+// namespace devuelve el namespace a usar dentro del Batch. Con 'create',
+// lo copia (o lo crea) para poder modificarlo.
+func (t *jsonTx) namespace(namespace string, create bool) (map[string][]byte, bool) {
+	if m, ok := t.work[namespace]; ok {
+		return m, true
+	}
+	m, ok := t.s.data[namespace]
+	if !create {
+		return m, ok
+	}
+	if !ok {
+		m = make(map[string][]byte)
+	}
+	m = maps.Clone(m)
+	t.work[namespace] = m
+	return m, true
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace'.
+func (t *jsonTx) Put(namespace string, key, value []byte) error {
+	chain, err := namespaceChain(namespace)
+	if err != nil {
+		return err
+	}
+	for _, ns := range chain[:len(chain)-1] {
+		if _, ok := t.namespace(ns, false); !ok {
+			t.namespace(ns, true)
+		}
+	}
+	m, _ := t.namespace(namespace, true)
+	m[string(key)] = bytes.Clone(nonNil(value))
+	return nil
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (t *jsonTx) Get(namespace string, key []byte) ([]byte, error) {
+	m, ok := t.namespace(namespace, false)
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+	v, ok := m[string(key)]
+	if !ok {
+		return nil, errNoKey(key)
+	}
+	return liveValue(key, bytes.Clone(v))
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (t *jsonTx) Delete(namespace string, key []byte) error {
+	if _, ok := t.namespace(namespace, false); !ok {
+		return errNoNamespace(namespace)
+	}
+	m, _ := t.namespace(namespace, true)
+	delete(m, string(key))
+	return nil
+}
+
+// PutWithTTL guarda (key, value) en 'namespace' hasta dentro de 'ttl'.
+func (s *JSONStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return putWithTTL(tx, namespace, key, value, ttl)
+	})
+}
+
+// Batch ejecuta 'fn' con el store bloqueado y después reescribe los
+// ficheros de los namespaces que ha cambiado. Si falla la escritura de
+// alguno, se vuelven a escribir los anteriores como estaban. La atomicidad
+// es la de este proceso: un corte a mitad puede dejar en disco sólo parte
+// de los ficheros (cada uno, eso sí, entero).
+func (s *JSONStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &jsonTx{s: s, work: make(map[string]map[string][]byte)}
+	if err := fn(t); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	old := make(map[string]map[string][]byte, len(t.work))
+	var flushed []string
+	for ns, m := range t.work {
+		old[ns] = s.data[ns]
+		s.data[ns] = m
+		if err := s.flush(ns); err != nil {
+			for ns, m := range old {
+				if m == nil {
+					delete(s.data, ns)
+				} else {
+					s.data[ns] = m
+				}
+			}
+			for _, ns := range flushed {
+				if old[ns] == nil {
+					os.Remove(s.path(ns))
+				} else {
+					s.flush(ns)
+				}
+			}
+			return err
+		}
+		flushed = append(flushed, ns)
+	}
+	return nil
+}
+
+// DeleteNamespace borra los ficheros de 'namespace' y de los anidados.
+func (s *JSONStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[namespace]; !ok {
+		return errNoNamespace(namespace)
+	}
+	for ns := range s.data {
+		if ns != namespace && !strings.HasPrefix(ns, namespace+NamespaceSep) {
+			continue
+		}
+		if err := os.Remove(s.path(ns)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error borrando %s: %v", s.path(ns), err)
+		}
+		delete(s.data, ns)
+	}
+	return nil
+}
+
+// DeleteByPrefix borra de memoria las claves de 'namespace' que empiezan
+// por 'prefix' y reescribe su fichero una sola vez. Si no se puede
+// escribir, las claves vuelven a su sitio.
+func (s *JSONStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.data[namespace]
+	if !ok {
+		return 0, errNoNamespace(namespace)
+	}
+	removed := make(map[string][]byte)
+	for k, v := range m {
+		if strings.HasPrefix(k, string(prefix)) {
+			removed[k] = v
+			delete(m, k)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+	if err := s.flush(namespace); err != nil {
+		for k, v := range removed {
+			m[k] = v
+		}
+		return 0, err
+	}
+	return len(removed), nil
+}
+
+// ListKeys devuelve todas las claves de 'namespace', en orden.
+func (s *JSONStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.KeysByPrefix(ctx, namespace, nil)
+}
+
+// CountKeys devuelve cuántas claves tiene 'namespace' en memoria.
+func (s *JSONStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.data[namespace]
+	if !ok {
+		return 0, errNoNamespace(namespace)
+	}
+	return len(m), nil
+}
+
+// KeysByPrefix devuelve, en orden, las claves de 'namespace' que empiecen
+// con 'prefix'.
+func (s *JSONStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.data[namespace]
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+	var keys [][]byte
+	for _, k := range sortedKeys(m) {
+		if strings.HasPrefix(k, string(prefix)) {
+			keys = append(keys, []byte(k))
+		}
+	}
+	return keys, nil
+}
+
+// ListKeysPage devuelve una página de las claves de 'namespace'.
+func (s *JSONStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.KeysByPrefixPage(ctx, namespace, nil, after, limit)
+}
+
+// KeysByPrefixPage devuelve una página de las claves que empiezan por
+// 'prefix'. Los datos ya están en memoria: sólo se ahorra copiar las claves
+// que no entran en la página.
+func (s *JSONStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.data[namespace]
+	if !ok {
+		return nil, nil, errNoNamespace(namespace)
+	}
+	start, skip := pageStart(prefix, after)
+	sorted := sortedKeys(m)
+	i := sort.SearchStrings(sorted, string(start))
+	if skip && i < len(sorted) && sorted[i] == string(start) {
+		i++
+	}
+	var keys [][]byte
+	for ; i < len(sorted) && strings.HasPrefix(sorted[i], string(prefix)) && len(keys) <= limit; i++ {
+		keys = append(keys, []byte(sorted[i]))
+	}
+	keys, next := cutPage(keys, limit)
+	return keys, next, nil
+}
+
+// GetRange lee las entradas de [start, end) con una búsqueda binaria de
+// 'start' en las claves ordenadas.
+func (s *JSONStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.data[namespace]
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+	sorted := sortedKeys(m)
+	r := newRangeEntries(namespace, end, limit)
+	for i := sort.SearchStrings(sorted, string(start)); i < len(sorted); i++ {
+		if !r.add([]byte(sorted[i]), m[sorted[i]]) {
+			break
+		}
+	}
+	return r.list, nil
+}
+
+// LastN recorre hacia atrás las claves ordenadas desde la última con
+// 'prefix'.
+func (s *JSONStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	if err := checkLimit(n); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.data[namespace]
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+	sorted := sortedKeys(m)
+	i := len(sorted)
+	if end := prefixEnd(prefix); end != nil {
+		i = sort.SearchStrings(sorted, string(end))
+	}
+	r := newRangeEntries(namespace, nil, n)
+	for i--; i >= 0 && strings.HasPrefix(sorted[i], string(prefix)); i-- {
+		if !r.add([]byte(sorted[i]), m[sorted[i]]) {
+			break
+		}
+	}
+	return r.list, nil
+}
+
+// ForEach recorre 'namespace' con scan, sin las entradas caducadas.
+func (s *JSONStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.scan(ctx, namespace, liveEntries(fn))
+}
+
+// scan recorre 'namespace' en orden con el store bloqueado para lectura,
+// con los valores tal cual están guardados (ver rawScanner).
+func (s *JSONStore) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.data[namespace]
+	if !ok {
+		return errNoNamespace(namespace)
+	}
+	fn = withContext(ctx, fn)
+	for _, k := range sortedKeys(m) {
+		if err := fn([]byte(k), m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Namespaces devuelve los nombres de todos los namespaces, en orden.
+func (s *JSONStore) Namespaces(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	names := make([]string, 0, len(s.data))
+	for ns := range s.data {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// NamespacesUnder devuelve los namespaces cuyo nombre empieza por 'parent/'.
+func (s *JSONStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return namespacesUnder(names, parent)
+}
+
+// Backup escribe en 'w' un único objeto JSON con todos los namespaces
+// (nombre -> registros, como en sus ficheros), que Restore vuelve a
+// repartir en un directorio.
+func (s *JSONStore) Backup(ctx context.Context, w io.Writer) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := make(map[string]json.RawMessage, len(s.data))
+	for ns, m := range s.data {
+		raw, err := encodeNamespace(m)
+		if err != nil {
+			return err
+		}
+		all[ns] = raw
+	}
+	return json.NewEncoder(w).Encode(all)
+}
+
+// loadJSON crea en 'dir' (que no debe existir) los ficheros de la copia de 'r'.
+func loadJSON(r io.Reader, dir string) error {
+	var all map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&all); err != nil {
+		return fmt.Errorf("copia json mal formada: %v", err)
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return fmt.Errorf("%s ya existe", dir)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	s, err := NewJSONStore(dir)
+	if err != nil {
+		return err
+	}
+	for ns, raw := range all {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, raw, "", "  "); err != nil {
+			return fmt.Errorf("copia json mal formada: %v", err)
+		}
+		buf.WriteByte('\n')
+		if err := os.WriteFile(s.path(ns), buf.Bytes(), 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close no tiene nada que cerrar: cada escritura ya está en disco.
+func (s *JSONStore) Close() error {
+	return nil
+}
+
+// Dump escribe en 'w' el contenido de la base de datos para depuración
+// (ver DumpOptions), con los valores tal cual están guardados.
+func (s *JSONStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return dump(ctx, s, s.scan, w, opts)
+}
@@ -0,0 +1,656 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+/*
+	Implementación de la interfaz Store mediante goleveldb (LSM en Go puro),
+	para comparar su rendimiento con el de los demás motores
+*/
+
+// LevelDB tampoco tiene buckets: usa la misma disposición de claves que
+// Badger (ver dataKey y nsKey), con los datos bajo 'd' || namespace ||
+// 0x00 || clave y una marca 'n' || namespace por cada namespace creado.
+
+// levelDBLoadBatch es cuántos registros de una copia escribe loadLevelDB en
+// cada lote.
+const levelDBLoadBatch = 1000
+
+// LevelDBStore contiene la instancia de goleveldb y los namespaces conocidos.
+type LevelDBStore struct {
+	db *leveldb.DB
+
+	mu    sync.RWMutex
+	known map[string]bool // namespaces con marca ya escrita
+}
+
+// NewLevelDBStore abre (o crea) la base de datos LevelDB del directorio
+// 'path'.
+func NewLevelDBStore(path string) (*LevelDBStore, error) {
+	return openLevelDB(path, nil)
+}
+
+// openLevelDB abre LevelDB con 'opts' y carga los namespaces existentes.
+func openLevelDB(path string, opts *opt.Options) (*LevelDBStore, error) {
+	db, err := leveldb.OpenFile(path, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir base de datos leveldb: %v", err)
+	}
+	s := &LevelDBStore{db: db, known: make(map[string]bool)}
+	names, err := s.Namespaces(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error al abrir base de datos leveldb: %v", err)
+	}
+	for _, ns := range names {
+		s.known[ns] = true
+	}
+	return s, nil
+}
+
+// hasNamespace indica si 'namespace' existe.
+func (s *LevelDBStore) hasNamespace(namespace string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.known[namespace]
+}
+
+// levelDBTx implementa Tx sobre una transacción de goleveldb. 'created' son
+// los namespaces cuya marca se escribe en esta transacción: sólo pasan a
+// s.known cuando se confirma.
+type levelDBTx struct {
+	s       *LevelDBStore
+	tr      *leveldb.Transaction
+	created map[string]bool
+}
+
+// hasNamespace indica si 'namespace' existe, contando los creados en la
+// propia transacción.
+func (t *levelDBTx) hasNamespace(namespace string) bool {
+	return t.created[namespace] || t.s.hasNamespace(namespace)
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace'. Las marcas
+// del namespace y de sus antecesores sólo se escriben la primera vez.
+func (t *levelDBTx) Put(namespace string, key, value []byte) error {
+	chain, err := namespaceChain(namespace)
+	if err != nil {
+		return err
+	}
+	for _, ns := range chain {
+		if t.hasNamespace(ns) {
+			continue
+		}
+		if err := t.tr.Put(nsKey(ns), nil, nil); err != nil {
+			return fmt.Errorf("error al crear/abrir namespace '%s': %v", namespace, err)
+		}
+		t.created[ns] = true
+	}
+	return t.tr.Put(dataKey(namespace, key), value, nil)
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (t *levelDBTx) Get(namespace string, key []byte) ([]byte, error) {
+	if !t.hasNamespace(namespace) {
+		return nil, errNoNamespace(namespace)
+	}
+	return levelDBGet(t.tr, namespace, key)
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (t *levelDBTx) Delete(namespace string, key []byte) error {
+	if !t.hasNamespace(namespace) {
+		return errNoNamespace(namespace)
+	}
+	return t.tr.Delete(dataKey(namespace, key), nil)
+}
+
+// levelDBReader lo cumplen la base de datos, sus transacciones y sus
+// instantáneas.
+type levelDBReader interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+}
+
+// levelDBGet lee de 'r' el valor de 'key' en 'namespace' (cuya existencia
+// ya se ha comprobado). Get de goleveldb devuelve una copia.
+func levelDBGet(r levelDBReader, namespace string, key []byte) ([]byte, error) {
+	val, err := r.Get(dataKey(namespace, key), nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, errNoKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return liveValue(key, nonNil(val))
+}
+
+// levelDBScan recorre en 'r' las entradas de 'namespace', tal cual están
+// guardadas.
+func levelDBScan(r levelDBReader, namespace string, fn func(key, value []byte) error) error {
+	prefix := dataKey(namespace, nil)
+	it := r.NewIterator(util.BytesPrefix(prefix), nil)
+	defer it.Release()
+	for it.Next() {
+		if err := fn(it.Key()[len(prefix):], nonNil(it.Value())); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// levelDBNamespaces lista las marcas de namespace de 'r', en orden.
+func levelDBNamespaces(r levelDBReader) ([]string, error) {
+	var names []string
+	it := r.NewIterator(util.BytesPrefix([]byte{badgerNSPrefix}), nil)
+	defer it.Release()
+	for it.Next() {
+		names = append(names, string(it.Key()[1:]))
+	}
+	return names, it.Error()
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace'.
+func (s *LevelDBStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return tx.Put(namespace, key, value)
+	})
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (s *LevelDBStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	if !s.hasNamespace(namespace) {
+		return nil, errNoNamespace(namespace)
+	}
+	return levelDBGet(s.db, namespace, key)
+}
+
+// Exists indica si 'key' está en 'namespace' (y no ha caducado).
+func (s *LevelDBStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return exists(ctx, s, namespace, key)
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (s *LevelDBStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return tx.Delete(namespace, key)
+	})
+}
+
+// DeleteNamespace borra 'namespace' y los anidados en una transacción:
+// LevelDB no tiene un equivalente al DropPrefix de Badger, así que se
+// recorren y borran sus datos y sus marcas.
+func (s *LevelDBStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	if !s.hasNamespace(namespace) {
+		return errNoNamespace(namespace)
+	}
+	children := namespace + NamespaceSep
+	err := s.update(ctx, func(tr *leveldb.Transaction) error {
+		if err := tr.Delete(nsKey(namespace), nil); err != nil {
+			return err
+		}
+		for _, prefix := range [][]byte{
+			dataKey(namespace, nil),
+			append([]byte{badgerDataPrefix}, children...),
+			nsKey(children),
+		} {
+			if _, err := levelDBDeletePrefix(tr, prefix); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error borrando el namespace '%s': %v", namespace, err)
+	}
+	s.mu.Lock()
+	for ns := range s.known {
+		if ns == namespace || strings.HasPrefix(ns, children) {
+			delete(s.known, ns)
+		}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// levelDBDeletePrefix borra en 'tr' todas las claves que empiezan por
+// 'prefix' y devuelve cuántas eran.
+func levelDBDeletePrefix(tr *leveldb.Transaction, prefix []byte) (int, error) {
+	var keys [][]byte
+	it := tr.NewIterator(util.BytesPrefix(prefix), nil)
+	for it.Next() {
+		keys = append(keys, bytes.Clone(it.Key()))
+	}
+	it.Release()
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	for _, k := range keys {
+		if err := tr.Delete(k, nil); err != nil {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// DeleteByPrefix borra en una transacción las claves de 'namespace' que
+// empiezan por 'prefix'.
+func (s *LevelDBStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	if !s.hasNamespace(namespace) {
+		return 0, errNoNamespace(namespace)
+	}
+	n := 0
+	err := s.update(ctx, func(tr *leveldb.Transaction) error {
+		var err error
+		n, err = levelDBDeletePrefix(tr, dataKey(namespace, prefix))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// PutWithTTL guarda (key, value) en 'namespace' hasta dentro de 'ttl'.
+func (s *LevelDBStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return putWithTTL(tx, namespace, key, value, ttl)
+	})
+}
+
+// update ejecuta 'fn' en una transacción de goleveldb y la confirma si no
+// devuelve error ni se ha cancelado 'ctx'. Las transacciones son
+// exclusivas: mientras una está abierta, las demás escrituras esperan.
+func (s *LevelDBStore) update(ctx context.Context, fn func(tr *leveldb.Transaction) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tr, err := s.db.OpenTransaction()
+	if err != nil {
+		return err
+	}
+	if err := fn(tr); err != nil {
+		tr.Discard()
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		tr.Discard()
+		return err
+	}
+	return tr.Commit()
+}
+
+// Batch ejecuta 'fn' en una transacción de goleveldb: si 'fn' devuelve un
+// error, se descartan todas sus escrituras.
+func (s *LevelDBStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	var created map[string]bool
+	err := s.update(ctx, func(tr *leveldb.Transaction) error {
+		t := &levelDBTx{s: s, tr: tr, created: make(map[string]bool)}
+		created = t.created
+		return fn(t)
+	})
+	if err == nil && len(created) > 0 {
+		s.mu.Lock()
+		for ns := range created {
+			s.known[ns] = true
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// ListKeys devuelve todas las claves de 'namespace', en orden.
+func (s *LevelDBStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.KeysByPrefix(ctx, namespace, nil)
+}
+
+// CountKeys cuenta las claves de 'namespace' recorriéndolas con un iterador.
+func (s *LevelDBStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	if !s.hasNamespace(namespace) {
+		return 0, errNoNamespace(namespace)
+	}
+	n := 0
+	it := s.db.NewIterator(util.BytesPrefix(dataKey(namespace, nil)), nil)
+	defer it.Release()
+	steps := ctxSteps{ctx: ctx}
+	for it.Next() {
+		if err := steps.step(); err != nil {
+			return 0, err
+		}
+		n++
+	}
+	return n, it.Error()
+}
+
+// KeysByPrefix devuelve, en orden, las claves de 'namespace' que empiecen
+// con 'prefix'.
+func (s *LevelDBStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	if !s.hasNamespace(namespace) {
+		return nil, errNoNamespace(namespace)
+	}
+	base := len(dataKey(namespace, nil))
+	var keys [][]byte
+	it := s.db.NewIterator(util.BytesPrefix(dataKey(namespace, prefix)), nil)
+	defer it.Release()
+	steps := ctxSteps{ctx: ctx}
+	for it.Next() {
+		if err := steps.step(); err != nil {
+			return nil, err
+		}
+		keys = append(keys, bytes.Clone(it.Key()[base:]))
+	}
+	return keys, it.Error()
+}
+
+// ListKeysPage devuelve una página de las claves de 'namespace'.
+func (s *LevelDBStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.KeysByPrefixPage(ctx, namespace, nil, after, limit)
+}
+
+// KeysByPrefixPage devuelve una página de las claves que empiezan por
+// 'prefix', empezando el iterador en el cursor.
+func (s *LevelDBStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	if !s.hasNamespace(namespace) {
+		return nil, nil, errNoNamespace(namespace)
+	}
+	base := len(dataKey(namespace, nil))
+	start, skip := pageStart(prefix, after)
+	var keys [][]byte
+	it := s.db.NewIterator(util.BytesPrefix(dataKey(namespace, prefix)), nil)
+	defer it.Release()
+	steps := ctxSteps{ctx: ctx}
+	for ok := it.Seek(dataKey(namespace, start)); ok && len(keys) <= limit; ok = it.Next() {
+		if err := steps.step(); err != nil {
+			return nil, nil, err
+		}
+		k := it.Key()[base:]
+		if skip && bytes.Equal(k, start) {
+			continue
+		}
+		keys = append(keys, bytes.Clone(k))
+	}
+	if err := it.Error(); err != nil {
+		return nil, nil, err
+	}
+	keys, next := cutPage(keys, limit)
+	return keys, next, nil
+}
+
+// GetRange lee las entradas de [start, end) con un iterador colocado en
+// 'start'.
+func (s *LevelDBStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	if !s.hasNamespace(namespace) {
+		return nil, errNoNamespace(namespace)
+	}
+	base := len(dataKey(namespace, nil))
+	r := newRangeEntries(namespace, end, limit)
+	it := s.db.NewIterator(util.BytesPrefix(dataKey(namespace, nil)), nil)
+	defer it.Release()
+	steps := ctxSteps{ctx: ctx}
+	for ok := it.Seek(dataKey(namespace, start)); ok; ok = it.Next() {
+		if err := steps.step(); err != nil {
+			return nil, err
+		}
+		k := it.Key()[base:]
+		if r.past(k) || !r.add(k, it.Value()) {
+			break
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return r.list, nil
+}
+
+// LastN recorre hacia atrás, desde la última, las claves de 'namespace'
+// que empiezan por 'prefix'.
+func (s *LevelDBStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	if err := checkLimit(n); err != nil {
+		return nil, err
+	}
+	if !s.hasNamespace(namespace) {
+		return nil, errNoNamespace(namespace)
+	}
+	base := len(dataKey(namespace, nil))
+	r := newRangeEntries(namespace, nil, n)
+	it := s.db.NewIterator(util.BytesPrefix(dataKey(namespace, prefix)), nil)
+	defer it.Release()
+	steps := ctxSteps{ctx: ctx}
+	for ok := it.Last(); ok; ok = it.Prev() {
+		if err := steps.step(); err != nil {
+			return nil, err
+		}
+		if !r.add(it.Key()[base:], it.Value()) {
+			break
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return r.list, nil
+}
+
+// ForEach recorre 'namespace' con scan, sin las entradas caducadas.
+func (s *LevelDBStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.scan(ctx, namespace, liveEntries(fn))
+}
+
+// scan recorre 'namespace' con un iterador, con los valores tal cual están
+// guardados (ver rawScanner).
+func (s *LevelDBStore) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	if !s.hasNamespace(namespace) {
+		return errNoNamespace(namespace)
+	}
+	return levelDBScan(s.db, namespace, withContext(ctx, fn))
+}
+
+// Namespaces devuelve los nombres de todos los namespaces.
+func (s *LevelDBStore) Namespaces(ctx context.Context) ([]string, error) {
+	return levelDBNamespaces(s.db)
+}
+
+// NamespacesUnder devuelve los namespaces cuyo nombre empieza por 'parent/'.
+func (s *LevelDBStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return namespacesUnder(names, parent)
+}
+
+// Snapshot fija una instantánea de goleveldb (ver Snapshotter). A
+// diferencia de bbolt, mantenerla abierta no bloquea las escrituras.
+func (s *LevelDBStore) Snapshot() (Snapshot, error) {
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &levelDBSnapshot{snap: snap}, nil
+}
+
+// levelDBSnapshot implementa Snapshot sobre una instantánea de goleveldb.
+// Los namespaces se leen de sus marcas, no de s.known, que puede haber
+// cambiado desde que se tomó.
+type levelDBSnapshot struct {
+	mu   sync.Mutex
+	snap *leveldb.Snapshot
+}
+
+// read ejecuta 'fn' con la instantánea, o falla si ya se liberó.
+func (v *levelDBSnapshot) read(fn func(snap *leveldb.Snapshot) error) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.snap == nil {
+		return ErrSnapshotReleased
+	}
+	return fn(v.snap)
+}
+
+// hasLevelDBNamespace indica si 'namespace' tiene marca en 'snap'.
+func hasLevelDBNamespace(snap *leveldb.Snapshot, namespace string) (bool, error) {
+	return snap.Has(nsKey(namespace), nil)
+}
+
+// Get recupera el valor de 'key' en 'namespace' tal como estaba.
+func (v *levelDBSnapshot) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	var val []byte
+	err := v.read(func(snap *leveldb.Snapshot) error {
+		ok, err := hasLevelDBNamespace(snap, namespace)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errNoNamespace(namespace)
+		}
+		val, err = levelDBGet(snap, namespace, key)
+		return err
+	})
+	return val, err
+}
+
+// ForEach recorre 'namespace' tal como estaba, sin las entradas caducadas.
+func (v *levelDBSnapshot) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return v.scan(ctx, namespace, liveEntries(fn))
+}
+
+// scan recorre 'namespace' con los valores tal cual están guardados (ver
+// rawScanner).
+func (v *levelDBSnapshot) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return v.read(func(snap *leveldb.Snapshot) error {
+		ok, err := hasLevelDBNamespace(snap, namespace)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errNoNamespace(namespace)
+		}
+		return levelDBScan(snap, namespace, withContext(ctx, fn))
+	})
+}
+
+// Namespaces devuelve los namespaces que había.
+func (v *levelDBSnapshot) Namespaces(ctx context.Context) ([]string, error) {
+	var names []string
+	err := v.read(func(snap *leveldb.Snapshot) error {
+		var err error
+		names, err = levelDBNamespaces(snap)
+		return err
+	})
+	return names, err
+}
+
+// Release libera la instantánea de goleveldb.
+func (v *levelDBSnapshot) Release() error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.snap != nil {
+		v.snap.Release()
+		v.snap = nil
+	}
+	return nil
+}
+
+// levelDBRecord es una línea de las copias de LevelDBStore: una clave de
+// LevelDB (de datos o marca de namespace) con su valor.
+type levelDBRecord struct {
+	Key   []byte `json:"k"`
+	Value []byte `json:"v,omitempty"`
+}
+
+// Backup escribe en 'w', una por línea en JSON, todas las claves de una
+// instantánea, que se recuperan con Restore (la base de datos es un
+// directorio, no un fichero que se pueda copiar tal cual).
+func (s *LevelDBStore) Backup(ctx context.Context, w io.Writer) error {
+	snap, err := s.db.GetSnapshot()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+	bw := bufio.NewWriter(ctxWriter{ctx, w})
+	enc := json.NewEncoder(bw)
+	it := snap.NewIterator(nil, nil)
+	defer it.Release()
+	for it.Next() {
+		if err := enc.Encode(levelDBRecord{it.Key(), it.Value()}); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// loadLevelDB crea en 'path', que no debe existir, una base LevelDB con la
+// copia de 'r'.
+func loadLevelDB(r io.Reader, path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s ya existe", path)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	db, err := leveldb.OpenFile(path, &opt.Options{ErrorIfExist: true})
+	if err != nil {
+		return fmt.Errorf("error al abrir base de datos leveldb: %v", err)
+	}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+	batch := new(leveldb.Batch)
+	for sc.Scan() {
+		var rec levelDBRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			db.Close()
+			return fmt.Errorf("copia de leveldb mal formada: %v", err)
+		}
+		batch.Put(rec.Key, rec.Value)
+		if batch.Len() >= levelDBLoadBatch {
+			if err := db.Write(batch, nil); err != nil {
+				db.Close()
+				return fmt.Errorf("error cargando la copia leveldb: %v", err)
+			}
+			batch.Reset()
+		}
+	}
+	err = sc.Err()
+	if err == nil {
+		err = db.Write(batch, nil)
+	}
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("error cargando la copia leveldb: %v", err)
+	}
+	return db.Close()
+}
+
+// Close cierra la base de datos LevelDB.
+func (s *LevelDBStore) Close() error {
+	return s.db.Close()
+}
+
+// Dump escribe en 'w' el contenido de la base de datos para depuración
+// (ver DumpOptions), con los valores tal cual están guardados.
+func (s *LevelDBStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return dump(ctx, s, s.scan, w, opts)
+}
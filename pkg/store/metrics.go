@@ -0,0 +1,247 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	Decorador de Store que cuenta las operaciones y mide cuánto tardan, para
+	ver si el motor es el cuello de botella
+*/
+
+// LatencyBuckets son los límites superiores de los intervalos del
+// histograma de latencias de OpStats.
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// OpStats son las cifras de un tipo de operación.
+type OpStats struct {
+	Count  uint64        // llamadas
+	Errors uint64        // llamadas que han fallado (ErrNotFound no cuenta)
+	Total  time.Duration // tiempo acumulado de todas las llamadas
+	// Buckets[i] cuenta las llamadas que han tardado hasta LatencyBuckets[i]
+	// (y más que LatencyBuckets[i-1]); el último, las que han tardado más.
+	Buckets []uint64
+}
+
+// InstrumentedStore envuelve un Store y lleva, por operación ("get",
+// "put", "batch"...), las cifras que devuelve Stats. En ForEach y Batch,
+// el tiempo incluye el de la función del llamante.
+type InstrumentedStore struct {
+	inner Store
+	mu    sync.Mutex
+	ops   map[string]*OpStats
+}
+
+// NewInstrumentedStore crea el decorador sobre 'inner'.
+func NewInstrumentedStore(inner Store) *InstrumentedStore {
+	return &InstrumentedStore{inner: inner, ops: make(map[string]*OpStats)}
+}
+
+// observe anota una llamada a 'op' que empezó en 'start' y acabó con 'err'.
+func (s *InstrumentedStore) observe(op string, start time.Time, err error) {
+	d := time.Since(start)
+	i := sort.Search(len(LatencyBuckets), func(i int) bool { return d <= LatencyBuckets[i] })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.ops[op]
+	if !ok {
+		st = &OpStats{Buckets: make([]uint64, len(LatencyBuckets)+1)}
+		s.ops[op] = st
+	}
+	st.Count++
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		st.Errors++
+	}
+	st.Total += d
+	st.Buckets[i]++
+}
+
+// Stats devuelve una copia de las cifras de cada operación usada hasta ahora.
+func (s *InstrumentedStore) Stats() map[string]OpStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]OpStats, len(s.ops))
+	for op, st := range s.ops {
+		c := *st
+		c.Buckets = append([]uint64(nil), st.Buckets...)
+		out[op] = c
+	}
+	return out
+}
+
+// Put mide Put del Store envuelto.
+func (s *InstrumentedStore) Put(ctx context.Context, namespace string, key, value []byte) (err error) {
+	defer func(start time.Time) { s.observe("put", start, err) }(time.Now())
+	return s.inner.Put(ctx, namespace, key, value)
+}
+
+// PutWithTTL mide PutWithTTL del Store envuelto.
+func (s *InstrumentedStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) (err error) {
+	defer func(start time.Time) { s.observe("putWithTTL", start, err) }(time.Now())
+	return s.inner.PutWithTTL(ctx, namespace, key, value, ttl)
+}
+
+// Get mide Get del Store envuelto.
+func (s *InstrumentedStore) Get(ctx context.Context, namespace string, key []byte) (value []byte, err error) {
+	defer func(start time.Time) { s.observe("get", start, err) }(time.Now())
+	return s.inner.Get(ctx, namespace, key)
+}
+
+// Exists mide Exists del Store envuelto.
+func (s *InstrumentedStore) Exists(ctx context.Context, namespace string, key []byte) (ok bool, err error) {
+	defer func(start time.Time) { s.observe("exists", start, err) }(time.Now())
+	return s.inner.Exists(ctx, namespace, key)
+}
+
+// Delete mide Delete del Store envuelto.
+func (s *InstrumentedStore) Delete(ctx context.Context, namespace string, key []byte) (err error) {
+	defer func(start time.Time) { s.observe("delete", start, err) }(time.Now())
+	return s.inner.Delete(ctx, namespace, key)
+}
+
+// DeleteNamespace mide DeleteNamespace del Store envuelto.
+func (s *InstrumentedStore) DeleteNamespace(ctx context.Context, namespace string) (err error) {
+	defer func(start time.Time) { s.observe("deleteNamespace", start, err) }(time.Now())
+	return s.inner.DeleteNamespace(ctx, namespace)
+}
+
+// DeleteByPrefix mide DeleteByPrefix del Store envuelto.
+func (s *InstrumentedStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (n int, err error) {
+	defer func(start time.Time) { s.observe("deleteByPrefix", start, err) }(time.Now())
+	return s.inner.DeleteByPrefix(ctx, namespace, prefix)
+}
+
+// ListKeys mide ListKeys del Store envuelto.
+func (s *InstrumentedStore) ListKeys(ctx context.Context, namespace string) (keys [][]byte, err error) {
+	defer func(start time.Time) { s.observe("listKeys", start, err) }(time.Now())
+	return s.inner.ListKeys(ctx, namespace)
+}
+
+// CountKeys mide CountKeys del Store envuelto.
+func (s *InstrumentedStore) CountKeys(ctx context.Context, namespace string) (n int, err error) {
+	defer func(start time.Time) { s.observe("countKeys", start, err) }(time.Now())
+	return s.inner.CountKeys(ctx, namespace)
+}
+
+// KeysByPrefix mide KeysByPrefix del Store envuelto.
+func (s *InstrumentedStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) (keys [][]byte, err error) {
+	defer func(start time.Time) { s.observe("keysByPrefix", start, err) }(time.Now())
+	return s.inner.KeysByPrefix(ctx, namespace, prefix)
+}
+
+// ListKeysPage mide ListKeysPage del Store envuelto.
+func (s *InstrumentedStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) (keys [][]byte, next []byte, err error) {
+	defer func(start time.Time) { s.observe("listKeysPage", start, err) }(time.Now())
+	return s.inner.ListKeysPage(ctx, namespace, after, limit)
+}
+
+// KeysByPrefixPage mide KeysByPrefixPage del Store envuelto.
+func (s *InstrumentedStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) (keys [][]byte, next []byte, err error) {
+	defer func(start time.Time) { s.observe("keysByPrefixPage", start, err) }(time.Now())
+	return s.inner.KeysByPrefixPage(ctx, namespace, prefix, after, limit)
+}
+
+// GetRange mide GetRange del Store envuelto.
+func (s *InstrumentedStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) (entries []Entry, err error) {
+	defer func(t time.Time) { s.observe("getRange", t, err) }(time.Now())
+	return s.inner.GetRange(ctx, namespace, start, end, limit)
+}
+
+// LastN mide LastN del Store envuelto.
+func (s *InstrumentedStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) (entries []Entry, err error) {
+	defer func(t time.Time) { s.observe("lastN", t, err) }(time.Now())
+	return s.inner.LastN(ctx, namespace, prefix, n)
+}
+
+// ForEach mide ForEach del Store envuelto.
+func (s *InstrumentedStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) (err error) {
+	defer func(start time.Time) { s.observe("forEach", start, err) }(time.Now())
+	return s.inner.ForEach(ctx, namespace, fn)
+}
+
+// Namespaces mide Namespaces del Store envuelto.
+func (s *InstrumentedStore) Namespaces(ctx context.Context) (names []string, err error) {
+	defer func(start time.Time) { s.observe("namespaces", start, err) }(time.Now())
+	return s.inner.Namespaces(ctx)
+}
+
+// NamespacesUnder mide NamespacesUnder del Store envuelto.
+func (s *InstrumentedStore) NamespacesUnder(ctx context.Context, parent string) (names []string, err error) {
+	defer func(start time.Time) { s.observe("namespacesUnder", start, err) }(time.Now())
+	return s.inner.NamespacesUnder(ctx, parent)
+}
+
+// Batch mide Batch del Store envuelto (las operaciones de 'tx' no se
+// cuentan aparte).
+func (s *InstrumentedStore) Batch(ctx context.Context, fn func(tx Tx) error) (err error) {
+	defer func(start time.Time) { s.observe("batch", start, err) }(time.Now())
+	return s.inner.Batch(ctx, fn)
+}
+
+// Backup mide Backup del Store envuelto.
+func (s *InstrumentedStore) Backup(ctx context.Context, w io.Writer) (err error) {
+	defer func(start time.Time) { s.observe("backup", start, err) }(time.Now())
+	return s.inner.Backup(ctx, w)
+}
+
+// Restore restaura en caliente el Store envuelto, si éste lo permite (ver
+// Restorer).
+func (s *InstrumentedStore) Restore(r io.Reader) (err error) {
+	rs, ok := s.inner.(Restorer)
+	if !ok {
+		return errors.New("el motor de almacenamiento no permite restaurar en caliente")
+	}
+	defer func(start time.Time) { s.observe("restore", start, err) }(time.Now())
+	return rs.Restore(r)
+}
+
+// Compact compacta el Store envuelto, si éste lo permite (ver Compacter).
+func (s *InstrumentedStore) Compact() (before, after int64, err error) {
+	c, ok := s.inner.(Compacter)
+	if !ok {
+		return 0, 0, errors.New("el motor de almacenamiento no necesita compactarse")
+	}
+	defer func(start time.Time) { s.observe("compact", start, err) }(time.Now())
+	return c.Compact()
+}
+
+// Snapshot fija una vista del Store envuelto (ver Snapshotter). Las
+// lecturas de la vista no se miden.
+func (s *InstrumentedStore) Snapshot() (Snapshot, error) {
+	return snapshotOf(s.inner)
+}
+
+// stats da la ocupación del Store envuelto (ver Stats). No se mide.
+func (s *InstrumentedStore) stats(ctx context.Context) (StoreStats, error) {
+	return Stats(ctx, s.inner)
+}
+
+// Close cierra el Store envuelto.
+func (s *InstrumentedStore) Close() error {
+	return s.inner.Close()
+}
+
+// Dump vuelca el Store envuelto.
+func (s *InstrumentedStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return s.inner.Dump(ctx, w, opts)
+}
@@ -0,0 +1,330 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+/*
+	Decorador de Store que escribe en dos motores a la vez (replicación de
+	andar por casa, o para comparar un motor nuevo con bbolt)
+*/
+
+// MirrorStore escribe en un Store principal y repite cada escritura que se
+// aplica en un secundario; las lecturas sólo van al principal. Un fallo del
+// secundario no hace fallar la operación (el principal ya la ha aplicado):
+// se pasa a 'onError', y las dos copias difieren hasta que Compare lo
+// detecte. No permite Restore ni Compact: hay que hacerlos en cada motor.
+type MirrorStore struct {
+	primary   Store
+	secondary Store
+	onError   func(format string, args ...any)
+}
+
+// NewMirrorStore crea el decorador. Los errores del secundario se pasan a
+// 'onError' (por ejemplo, log.Printf); si es nil, se descartan.
+func NewMirrorStore(primary, secondary Store, onError func(format string, args ...any)) *MirrorStore {
+	if onError == nil {
+		onError = func(string, ...any) {}
+	}
+	return &MirrorStore{primary: primary, secondary: secondary, onError: onError}
+}
+
+// mirror apunta el error 'err' de la operación 'op' en el secundario.
+func (s *MirrorStore) mirror(op, namespace string, err error) {
+	if err != nil {
+		s.onError("error replicando %s en %s: %v", op, namespace, err)
+	}
+}
+
+// Put escribe en los dos motores.
+func (s *MirrorStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	if err := s.primary.Put(ctx, namespace, key, value); err != nil {
+		return err
+	}
+	s.mirror("put", namespace, s.secondary.Put(ctx, namespace, key, value))
+	return nil
+}
+
+// PutWithTTL escribe en los dos motores con un mismo Batch, para que la
+// caducidad (y su entrada en el índice de SweepExpired) sea idéntica.
+func (s *MirrorStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return putWithTTL(tx, namespace, key, value, ttl)
+	})
+}
+
+// Get lee del principal.
+func (s *MirrorStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	return s.primary.Get(ctx, namespace, key)
+}
+
+// Exists consulta el principal.
+func (s *MirrorStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return s.primary.Exists(ctx, namespace, key)
+}
+
+// Delete borra de los dos motores.
+func (s *MirrorStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	if err := s.primary.Delete(ctx, namespace, key); err != nil {
+		return err
+	}
+	s.mirror("delete", namespace, s.secondary.Delete(ctx, namespace, key))
+	return nil
+}
+
+// DeleteNamespace borra 'namespace' de los dos motores.
+func (s *MirrorStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	if err := s.primary.DeleteNamespace(ctx, namespace); err != nil {
+		return err
+	}
+	s.mirror("deleteNamespace", namespace, s.secondary.DeleteNamespace(ctx, namespace))
+	return nil
+}
+
+// DeleteByPrefix borra de los dos motores y devuelve cuántas claves ha
+// borrado el principal.
+func (s *MirrorStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	n, err := s.primary.DeleteByPrefix(ctx, namespace, prefix)
+	if err != nil {
+		return n, err
+	}
+	_, err = s.secondary.DeleteByPrefix(ctx, namespace, prefix)
+	if n == 0 && errors.Is(err, ErrNotFound) {
+		err = nil // tampoco había nada en el principal
+	}
+	s.mirror("deleteByPrefix", namespace, err)
+	return n, nil
+}
+
+// mirrorOp es una escritura hecha dentro de un Batch (value nil: Delete).
+type mirrorOp struct {
+	namespace  string
+	key, value []byte
+}
+
+// mirrorTx apunta las escrituras que se aplican dentro de un Batch del
+// principal para repetirlas después en el secundario.
+type mirrorTx struct {
+	Tx
+	ops *[]mirrorOp
+}
+
+func (t mirrorTx) Put(namespace string, key, value []byte) error {
+	if err := t.Tx.Put(namespace, key, value); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	*t.ops = append(*t.ops, mirrorOp{namespace, bytes.Clone(key), bytes.Clone(value)})
+	return nil
+}
+
+func (t mirrorTx) Delete(namespace string, key []byte) error {
+	if err := t.Tx.Delete(namespace, key); err != nil {
+		return err
+	}
+	*t.ops = append(*t.ops, mirrorOp{namespace, bytes.Clone(key), nil})
+	return nil
+}
+
+// Batch ejecuta 'fn' en el principal y, si se aplica, repite sus escrituras
+// en el mismo orden en un único Batch del secundario.
+func (s *MirrorStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	var ops []mirrorOp
+	err := s.primary.Batch(ctx, func(tx Tx) error {
+		ops = ops[:0] // el motor puede reintentar 'fn'
+		return fn(mirrorTx{tx, &ops})
+	})
+	if err != nil || len(ops) == 0 {
+		return err
+	}
+	err = s.secondary.Batch(ctx, func(tx Tx) error {
+		for _, op := range ops {
+			var err error
+			if op.value == nil {
+				err = tx.Delete(op.namespace, op.key)
+			} else {
+				err = tx.Put(op.namespace, op.key, op.value)
+			}
+			if err != nil && !(op.value == nil && errors.Is(err, ErrNotFound)) {
+				return err
+			}
+		}
+		return nil
+	})
+	s.mirror("batch", ops[0].namespace, err)
+	return nil
+}
+
+// ListKeys lista las claves del principal.
+func (s *MirrorStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.primary.ListKeys(ctx, namespace)
+}
+
+// CountKeys cuenta las claves del principal.
+func (s *MirrorStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	return s.primary.CountKeys(ctx, namespace)
+}
+
+// KeysByPrefix busca claves en el principal.
+func (s *MirrorStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	return s.primary.KeysByPrefix(ctx, namespace, prefix)
+}
+
+// ListKeysPage pagina las claves del principal.
+func (s *MirrorStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.primary.ListKeysPage(ctx, namespace, after, limit)
+}
+
+// KeysByPrefixPage pagina las claves del principal.
+func (s *MirrorStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.primary.KeysByPrefixPage(ctx, namespace, prefix, after, limit)
+}
+
+// GetRange lee un rango del principal.
+func (s *MirrorStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	return s.primary.GetRange(ctx, namespace, start, end, limit)
+}
+
+// LastN lee las últimas entradas del principal.
+func (s *MirrorStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	return s.primary.LastN(ctx, namespace, prefix, n)
+}
+
+// ForEach recorre el principal.
+func (s *MirrorStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.primary.ForEach(ctx, namespace, fn)
+}
+
+// scan recorre el principal sin filtrar lo caducado (ver rawScanner).
+func (s *MirrorStore) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return scanRaw(ctx, s.primary, namespace, fn)
+}
+
+// scanRaw recorre 'namespace' de 's' con su scan si lo tiene y, si no, con
+// ForEach.
+func scanRaw(ctx context.Context, s Store, namespace string, fn func(key, value []byte) error) error {
+	if rs, ok := s.(rawScanner); ok {
+		return rs.scan(ctx, namespace, fn)
+	}
+	return s.ForEach(ctx, namespace, fn)
+}
+
+// Namespaces lista los namespaces del principal.
+func (s *MirrorStore) Namespaces(ctx context.Context) ([]string, error) {
+	return s.primary.Namespaces(ctx)
+}
+
+// NamespacesUnder lista los namespaces anidados del principal.
+func (s *MirrorStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	return s.primary.NamespacesUnder(ctx, parent)
+}
+
+// Backup copia el principal.
+func (s *MirrorStore) Backup(ctx context.Context, w io.Writer) error {
+	return s.primary.Backup(ctx, w)
+}
+
+// Snapshot fija una vista del principal (ver Snapshotter).
+func (s *MirrorStore) Snapshot() (Snapshot, error) {
+	return snapshotOf(s.primary)
+}
+
+// stats da la ocupación del principal (ver Stats); la del secundario se
+// puede pedir aparte.
+func (s *MirrorStore) stats(ctx context.Context) (StoreStats, error) {
+	return Stats(ctx, s.primary)
+}
+
+// Close cierra los dos motores.
+func (s *MirrorStore) Close() error {
+	err := s.primary.Close()
+	if err2 := s.secondary.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Dump vuelca el principal.
+func (s *MirrorStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return s.primary.Dump(ctx, w, opts)
+}
+
+// Compare recorre los dos motores y devuelve los registros en que difieren
+// (valores tal cual están guardados, con su caducidad). Carga cada
+// namespace entero en memoria, así que está pensado para validar un motor
+// con una base de datos de prueba, no para la de producción. Lo que se
+// escriba mientras tanto puede salir como diferencia.
+func (s *MirrorStore) Compare(ctx context.Context) ([]BadRecord, error) {
+	names := make(map[string]bool)
+	for _, st := range []Store{s.primary, s.secondary} {
+		list, err := st.Namespaces(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range list {
+			names[ns] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for ns := range names {
+		sorted = append(sorted, ns)
+	}
+	sort.Strings(sorted)
+
+	var diffs []BadRecord
+	for _, ns := range sorted {
+		a, err := loadNamespace(ctx, s.primary, ns)
+		if err != nil {
+			return nil, err
+		}
+		b, err := loadNamespace(ctx, s.secondary, ns)
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]string, 0, len(a)+len(b))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		for k := range b {
+			if _, ok := a[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			va, inA := a[k]
+			vb, inB := b[k]
+			switch {
+			case !inB:
+				diffs = append(diffs, BadRecord{ns, k, "falta en el secundario"})
+			case !inA:
+				diffs = append(diffs, BadRecord{ns, k, "sólo está en el secundario"})
+			case !bytes.Equal(va, vb):
+				diffs = append(diffs, BadRecord{ns, k, fmt.Sprintf("valor distinto (%d/%d bytes)", len(va), len(vb))})
+			}
+		}
+	}
+	return diffs, nil
+}
+
+// loadNamespace copia en memoria el contenido de 'namespace' (vacío si no
+// existe).
+func loadNamespace(ctx context.Context, s Store, namespace string) (map[string][]byte, error) {
+	m := make(map[string][]byte)
+	err := scanRaw(ctx, s, namespace, func(key, value []byte) error {
+		m[string(key)] = bytes.Clone(value)
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	return m, err
+}
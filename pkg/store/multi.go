@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+/*
+	Lecturas y escrituras de varias claves a la vez (GetMulti, PutMulti),
+	comunes a todos los motores
+*/
+
+// KeyRef identifica una clave de un namespace.
+type KeyRef struct {
+	Namespace string
+	Key       []byte
+}
+
+// Entry es una clave de un namespace con su valor.
+type Entry struct {
+	Namespace string
+	Key       []byte
+	Value     []byte
+}
+
+// GetMulti lee las claves de 'refs' en un mismo Batch, así que ve todas
+// en el mismo estado aunque otro escriba mientras tanto. values[i] es el
+// valor de refs[i], o nil si no existe (un valor vacío existente es un
+// slice vacío, no nil).
+func GetMulti(ctx context.Context, s Store, refs ...KeyRef) ([][]byte, error) {
+	values := make([][]byte, len(refs))
+	err := s.Batch(ctx, func(tx Tx) error {
+		for i, r := range refs {
+			v, err := tx.Get(r.Namespace, r.Key)
+			if errors.Is(err, ErrNotFound) {
+				values[i] = nil // el motor puede reintentar 'fn'
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if v == nil {
+				v = []byte{}
+			}
+			values[i] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// PutMulti escribe 'entries' en un mismo Batch: se aplican todas o, si
+// falla alguna, ninguna.
+func PutMulti(ctx context.Context, s Store, entries ...Entry) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		for _, e := range entries {
+			if err := tx.Put(e.Namespace, e.Key, e.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,238 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+/*
+	Apertura en sólo lectura, para las herramientas de auditoría e
+	inspección: lo que hagan no puede modificar la base de datos
+*/
+
+// ErrReadOnly es el error de cualquier escritura en un Store abierto con
+// OpenReadOnly.
+var ErrReadOnly = errors.New("base de datos abierta en sólo lectura")
+
+// OpenReadOnly abre la base de datos existente de 'path' sin permiso para
+// escribir. En bbolt y SQLite el propio motor abre el fichero en sólo
+// lectura (y no lo crea si no existe); en los demás son las comprobaciones
+// de ReadOnlyStore las que impiden escribir. bbolt sigue bloqueando el
+// fichero mientras el servidor lo tenga abierto.
+func OpenReadOnly(engine, path string) (Store, error) {
+	var (
+		s   Store
+		err error
+	)
+	switch engine {
+	case "bbolt":
+		s, err = openBboltReadOnly(path)
+	case "sqlite":
+		s, err = openSQLiteReadOnly(path)
+	case "badger":
+		s, err = openBadgerReadOnly(path)
+	case "leveldb":
+		s, err = openLevelDBReadOnly(path)
+	case "json":
+		// NewJSONStore crearía el directorio
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("error al abrir el directorio json: %v", err)
+		}
+		s, err = NewJSONStore(path)
+	default:
+		s, err = NewStore(engine, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewReadOnlyStore(s), nil
+}
+
+// openBboltReadOnly abre el fichero bbolt de 'path' con BboltOptions.ReadOnly.
+// Restore y Compact no deben llamarse sobre él: reabren el fichero para
+// escribir (ReadOnlyStore no los ofrece).
+func openBboltReadOnly(path string) (*BboltStore, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("error al abrir base de datos bbolt: %v", err)
+	}
+	return NewBboltStoreWithOptions(path, BboltOptions{ReadOnly: true, Timeout: time.Second})
+}
+
+// openSQLiteReadOnly abre el fichero SQLite de 'path' con mode=ro, sin
+// tocar el esquema ni el modo del diario.
+func openSQLiteReadOnly(path string) (*SQLiteStore, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("error al abrir base de datos sqlite: %v", err)
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir base de datos sqlite: %v", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error al abrir base de datos sqlite: %v", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// openBadgerReadOnly abre el directorio Badger de 'path' con
+// Options.ReadOnly, sin el GC del registro de valores.
+func openBadgerReadOnly(path string) (*BadgerStore, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("error al abrir base de datos badger: %v", err)
+	}
+	return openBadger(badger.DefaultOptions(path).
+		WithLoggingLevel(badger.WARNING).
+		WithReadOnly(true))
+}
+
+// openLevelDBReadOnly abre el directorio LevelDB de 'path' con
+// Options.ReadOnly (y sin crearlo si no existe).
+func openLevelDBReadOnly(path string) (*LevelDBStore, error) {
+	return openLevelDB(path, &opt.Options{ReadOnly: true, ErrorIfMissing: true})
+}
+
+// ReadOnlyStore envuelve un Store y rechaza con ErrReadOnly todas las
+// escrituras, y los Batch, antes de que lleguen al motor.
+type ReadOnlyStore struct {
+	inner Store
+}
+
+// NewReadOnlyStore crea el decorador sobre 'inner'.
+func NewReadOnlyStore(inner Store) *ReadOnlyStore {
+	return &ReadOnlyStore{inner: inner}
+}
+
+// Put rechaza la escritura.
+func (s *ReadOnlyStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	return ErrReadOnly
+}
+
+// PutWithTTL rechaza la escritura.
+func (s *ReadOnlyStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return ErrReadOnly
+}
+
+// Get lee del Store envuelto.
+func (s *ReadOnlyStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	return s.inner.Get(ctx, namespace, key)
+}
+
+// Exists consulta el Store envuelto.
+func (s *ReadOnlyStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return s.inner.Exists(ctx, namespace, key)
+}
+
+// Delete rechaza el borrado.
+func (s *ReadOnlyStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	return ErrReadOnly
+}
+
+// DeleteNamespace rechaza el borrado.
+func (s *ReadOnlyStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	return ErrReadOnly
+}
+
+// DeleteByPrefix rechaza el borrado.
+func (s *ReadOnlyStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	return 0, ErrReadOnly
+}
+
+// Batch rechaza el lote sin ejecutar 'fn': los motores abren para él una
+// transacción de escritura, que bbolt en sólo lectura no permite.
+func (s *ReadOnlyStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	return ErrReadOnly
+}
+
+// ListKeys lista las claves del Store envuelto.
+func (s *ReadOnlyStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.inner.ListKeys(ctx, namespace)
+}
+
+// CountKeys cuenta las claves del Store envuelto.
+func (s *ReadOnlyStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	return s.inner.CountKeys(ctx, namespace)
+}
+
+// KeysByPrefix busca claves en el Store envuelto.
+func (s *ReadOnlyStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	return s.inner.KeysByPrefix(ctx, namespace, prefix)
+}
+
+// ListKeysPage pagina las claves del Store envuelto.
+func (s *ReadOnlyStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.inner.ListKeysPage(ctx, namespace, after, limit)
+}
+
+// KeysByPrefixPage pagina las claves del Store envuelto.
+func (s *ReadOnlyStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.inner.KeysByPrefixPage(ctx, namespace, prefix, after, limit)
+}
+
+// GetRange lee un rango del Store envuelto.
+func (s *ReadOnlyStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	return s.inner.GetRange(ctx, namespace, start, end, limit)
+}
+
+// LastN lee las últimas entradas del Store envuelto.
+func (s *ReadOnlyStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	return s.inner.LastN(ctx, namespace, prefix, n)
+}
+
+// ForEach recorre el Store envuelto.
+func (s *ReadOnlyStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.inner.ForEach(ctx, namespace, fn)
+}
+
+// scan pasa al Store envuelto, si es un motor, para que ExportJSON
+// conserve las caducidades.
+func (s *ReadOnlyStore) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	if rs, ok := s.inner.(rawScanner); ok {
+		return rs.scan(ctx, namespace, fn)
+	}
+	return s.inner.ForEach(ctx, namespace, fn)
+}
+
+// Namespaces lista los namespaces del Store envuelto.
+func (s *ReadOnlyStore) Namespaces(ctx context.Context) ([]string, error) {
+	return s.inner.Namespaces(ctx)
+}
+
+// NamespacesUnder lista los namespaces anidados del Store envuelto.
+func (s *ReadOnlyStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	return s.inner.NamespacesUnder(ctx, parent)
+}
+
+// Backup copia el Store envuelto (leer no lo modifica).
+func (s *ReadOnlyStore) Backup(ctx context.Context, w io.Writer) error {
+	return s.inner.Backup(ctx, w)
+}
+
+// Snapshot fija una vista del Store envuelto (ver Snapshotter), que ya es
+// de sólo lectura.
+func (s *ReadOnlyStore) Snapshot() (Snapshot, error) {
+	return snapshotOf(s.inner)
+}
+
+// stats da la ocupación del Store envuelto (ver Stats).
+func (s *ReadOnlyStore) stats(ctx context.Context) (StoreStats, error) {
+	return Stats(ctx, s.inner)
+}
+
+// Close cierra el Store envuelto.
+func (s *ReadOnlyStore) Close() error {
+	return s.inner.Close()
+}
+
+// Dump vuelca el Store envuelto.
+func (s *ReadOnlyStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return s.inner.Dump(ctx, w, opts)
+}
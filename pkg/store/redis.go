@@ -0,0 +1,680 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+	Implementación de la interfaz Store mediante Redis, para que varias
+	instancias del servidor compartan los datos
+*/
+
+// Cada namespace ocupa dos claves de Redis: un hash <prefijo>:v:<ns> con los
+// valores y un conjunto ordenado <prefijo>:k:<ns> con las claves (todas con
+// puntuación 0, así que Redis las ordena byte a byte y ZRANGEBYLEX resuelve
+// las búsquedas por prefijo, como un cursor de bbolt). El conjunto
+// <prefijo>:namespaces guarda los namespaces creados.
+//
+// Lo que el servidor guarda sólo en memoria (logins SRP y OPAQUE a medias)
+// no se comparte: con varias instancias, el balanceador debe mandar las dos
+// rondas de un mismo login a la misma.
+
+// redisDefaultPrefix es el prefijo de las claves si la URL no trae "prefix".
+const redisDefaultPrefix = "prac"
+
+// RedisStore contiene el cliente de Redis y el prefijo de las claves.
+type RedisStore struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// NewRedisStore se conecta a la URL 'rawURL' ("redis://[:clave@]host:puerto/db"
+// o "rediss://" con TLS). El parámetro opcional "prefix" de la URL separa
+// los datos de varias instalaciones en el mismo Redis.
+func NewRedisStore(rawURL string) (*RedisStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("URL de redis no válida: %v", err)
+	}
+	q := u.Query()
+	prefix := q.Get("prefix")
+	if prefix == "" {
+		prefix = redisDefaultPrefix
+	}
+	q.Del("prefix")
+	u.RawQuery = q.Encode()
+
+	opts, err := redis.ParseURL(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("URL de redis no válida: %v", err)
+	}
+	rdb := redis.NewClient(opts)
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("error al conectar con redis: %v", err)
+	}
+	return &RedisStore{rdb: rdb, prefix: prefix}, nil
+}
+
+func (s *RedisStore) nsSet() string                  { return s.prefix + ":namespaces" }
+func (s *RedisStore) keySet(namespace string) string { return s.prefix + ":k:" + namespace }
+func (s *RedisStore) values(namespace string) string { return s.prefix + ":v:" + namespace }
+
+// hasNamespace indica si 'namespace' existe.
+func (s *RedisStore) hasNamespace(ctx context.Context, namespace string) (bool, error) {
+	return s.rdb.SIsMember(ctx, s.nsSet(), namespace).Result()
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace' en una
+// transacción MULTI/EXEC (que también da de alta a sus antecesores).
+func (s *RedisStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	chain, err := namespaceChain(namespace)
+	if err != nil {
+		return err
+	}
+	_, err = s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.SAdd(ctx, s.nsSet(), toAny(chain)...)
+		p.ZAdd(ctx, s.keySet(namespace), redis.Z{Member: string(key)})
+		p.HSet(ctx, s.values(namespace), string(key), value)
+		return nil
+	})
+	return err
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (s *RedisStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	val, err := s.rdb.HGet(ctx, s.values(namespace), string(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		ok, err := s.hasNamespace(ctx, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errNoNamespace(namespace)
+		}
+		return nil, errNoKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return liveValue(key, val)
+}
+
+// Exists indica si 'key' está en 'namespace' (y no ha caducado).
+func (s *RedisStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return exists(ctx, s, namespace, key)
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (s *RedisStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	ok, err := s.hasNamespace(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNoNamespace(namespace)
+	}
+	_, err = s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZRem(ctx, s.keySet(namespace), string(key))
+		p.HDel(ctx, s.values(namespace), string(key))
+		return nil
+	})
+	return err
+}
+
+// redisConflictRetries es cuántas veces se reintenta un Batch si otra
+// instancia modifica lo que ha leído antes de confirmarlo.
+const redisConflictRetries = 10
+
+// redisPending es una escritura de un Batch aún sin confirmar (value nil
+// es un borrado).
+type redisPending struct {
+	value []byte
+}
+
+// redisTx implementa Tx con WATCH/MULTI/EXEC: cada lectura vigila el hash
+// del namespace y las escrituras se acumulan (visibles para las lecturas
+// del propio Batch) hasta mandarlas juntas en un MULTI.
+type redisTx struct {
+	s       *RedisStore
+	ctx     context.Context
+	tx      *redis.Tx
+	ops     []func(p redis.Pipeliner)
+	pending map[string]redisPending // namespace 0x00 clave
+	created map[string]bool
+}
+
+// pendingKey es la clave de 'pending' para (namespace, key).
+func pendingKey(namespace string, key []byte) string {
+	return namespace + "\x00" + string(key)
+}
+
+// hasNamespace indica si 'namespace' existe, contando los creados en el Batch.
+func (t *redisTx) hasNamespace(namespace string) (bool, error) {
+	if t.created[namespace] {
+		return true, nil
+	}
+	return t.tx.SIsMember(t.ctx, t.s.nsSet(), namespace).Result()
+}
+
+// Put deja pendiente la escritura de (key, value) en 'namespace'.
+func (t *redisTx) Put(namespace string, key, value []byte) error {
+	chain, err := namespaceChain(namespace)
+	if err != nil {
+		return err
+	}
+	value = bytes.Clone(nonNil(value))
+	t.pending[pendingKey(namespace, key)] = redisPending{value: value}
+	for _, ns := range chain {
+		t.created[ns] = true
+	}
+	t.ops = append(t.ops, func(p redis.Pipeliner) {
+		p.SAdd(t.ctx, t.s.nsSet(), toAny(chain)...)
+		p.ZAdd(t.ctx, t.s.keySet(namespace), redis.Z{Member: string(key)})
+		p.HSet(t.ctx, t.s.values(namespace), string(key), value)
+	})
+	return nil
+}
+
+// Get recupera el valor de 'key' en 'namespace' y vigila el namespace hasta
+// el final del Batch.
+func (t *redisTx) Get(namespace string, key []byte) ([]byte, error) {
+	if w, ok := t.pending[pendingKey(namespace, key)]; ok {
+		if w.value == nil {
+			return nil, errNoKey(key)
+		}
+		return liveValue(key, bytes.Clone(w.value))
+	}
+	if err := t.tx.Watch(t.ctx, t.s.values(namespace)).Err(); err != nil {
+		return nil, err
+	}
+	val, err := t.tx.HGet(t.ctx, t.s.values(namespace), string(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		ok, err := t.hasNamespace(namespace)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errNoNamespace(namespace)
+		}
+		return nil, errNoKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return liveValue(key, val)
+}
+
+// Delete deja pendiente el borrado de 'key' en 'namespace'.
+func (t *redisTx) Delete(namespace string, key []byte) error {
+	ok, err := t.hasNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNoNamespace(namespace)
+	}
+	t.pending[pendingKey(namespace, key)] = redisPending{}
+	t.ops = append(t.ops, func(p redis.Pipeliner) {
+		p.ZRem(t.ctx, t.s.keySet(namespace), string(key))
+		p.HDel(t.ctx, t.s.values(namespace), string(key))
+	})
+	return nil
+}
+
+// PutWithTTL guarda (key, value) en 'namespace' hasta dentro de 'ttl'.
+func (s *RedisStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return putWithTTL(tx, namespace, key, value, ttl)
+	})
+}
+
+// Batch ejecuta 'fn' y manda sus escrituras en un único MULTI/EXEC, que
+// Redis descarta si otro cliente ha cambiado entre tanto un namespace leído
+// (o la lista de namespaces). En ese caso 'fn' se repite desde el principio,
+// tras una pequeña espera.
+func (s *RedisStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	var err error
+	for i := 0; i < redisConflictRetries; i++ {
+		err = s.rdb.Watch(ctx, func(rtx *redis.Tx) error {
+			t := &redisTx{
+				s:       s,
+				ctx:     ctx,
+				tx:      rtx,
+				pending: make(map[string]redisPending),
+				created: make(map[string]bool),
+			}
+			if err := fn(t); err != nil {
+				return err
+			}
+			if len(t.ops) == 0 {
+				return nil
+			}
+			_, err := rtx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+				for _, op := range t.ops {
+					op(p)
+				}
+				return nil
+			})
+			return err
+		}, s.nsSet())
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+		// Una espera aleatoria para no volver a chocar con los mismos
+		time.Sleep(time.Duration(rand.Int64N(int64(i+1) * int64(time.Millisecond))))
+	}
+	return err
+}
+
+// DeleteNamespace borra 'namespace' y los anidados en un MULTI/EXEC.
+func (s *RedisStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	under, err := s.NamespacesUnder(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	names := append([]string{namespace}, under...)
+	_, err = s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, ns := range names {
+			p.Del(ctx, s.keySet(ns), s.values(ns))
+		}
+		p.SRem(ctx, s.nsSet(), toAny(names)...)
+		return nil
+	})
+	return err
+}
+
+// DeleteByPrefix borra las claves de 'namespace' que empiezan por 'prefix'
+// con ZRANGEBYLEX y un MULTI/EXEC, vigilando el conjunto de claves para
+// repetirlo si otro cliente lo cambia entre tanto (como Batch).
+func (s *RedisStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	ok, err := s.hasNamespace(ctx, namespace)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errNoNamespace(namespace)
+	}
+	rng := &redis.ZRangeBy{Min: "-", Max: "+"}
+	if len(prefix) > 0 {
+		rng.Min = "[" + string(prefix)
+	}
+	if end := prefixEnd(prefix); end != nil {
+		rng.Max = "(" + string(end)
+	}
+	var n int
+	for i := 0; i < redisConflictRetries; i++ {
+		err = s.rdb.Watch(ctx, func(rtx *redis.Tx) error {
+			members, err := rtx.ZRangeByLex(ctx, s.keySet(namespace), rng).Result()
+			if err != nil {
+				return err
+			}
+			n = len(members)
+			if n == 0 {
+				return nil
+			}
+			_, err = rtx.TxPipelined(ctx, func(p redis.Pipeliner) error {
+				p.ZRemRangeByLex(ctx, s.keySet(namespace), rng.Min, rng.Max)
+				p.HDel(ctx, s.values(namespace), members...)
+				return nil
+			})
+			return err
+		}, s.keySet(namespace))
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+		time.Sleep(time.Duration(rand.Int64N(int64(i+1) * int64(time.Millisecond))))
+	}
+	if err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// ListKeys devuelve todas las claves de 'namespace', en orden.
+func (s *RedisStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.KeysByPrefix(ctx, namespace, nil)
+}
+
+// CountKeys devuelve el tamaño (ZCARD) del conjunto de claves de 'namespace'.
+func (s *RedisStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	ok, err := s.hasNamespace(ctx, namespace)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errNoNamespace(namespace)
+	}
+	n, err := s.rdb.ZCard(ctx, s.keySet(namespace)).Result()
+	return int(n), err
+}
+
+// KeysByPrefix devuelve, en orden, las claves de 'namespace' que empiecen
+// con 'prefix'.
+func (s *RedisStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	ok, err := s.hasNamespace(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+	rng := &redis.ZRangeBy{Min: "-", Max: "+"}
+	if len(prefix) > 0 {
+		rng.Min = "[" + string(prefix)
+	}
+	if end := prefixEnd(prefix); end != nil {
+		rng.Max = "(" + string(end)
+	}
+	members, err := s.rdb.ZRangeByLex(ctx, s.keySet(namespace), rng).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([][]byte, len(members))
+	for i, m := range members {
+		keys[i] = []byte(m)
+	}
+	return keys, nil
+}
+
+// ListKeysPage devuelve una página de las claves de 'namespace'.
+func (s *RedisStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.KeysByPrefixPage(ctx, namespace, nil, after, limit)
+}
+
+// KeysByPrefixPage devuelve una página de las claves que empiezan por
+// 'prefix', con el cursor como cota exclusiva de ZRANGEBYLEX y LIMIT.
+func (s *RedisStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	ok, err := s.hasNamespace(ctx, namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, errNoNamespace(namespace)
+	}
+	rng := &redis.ZRangeBy{Min: "-", Max: "+", Count: int64(limit) + 1}
+	if start, skip := pageStart(prefix, after); skip {
+		rng.Min = "(" + string(start)
+	} else if len(start) > 0 {
+		rng.Min = "[" + string(start)
+	}
+	if end := prefixEnd(prefix); end != nil {
+		rng.Max = "(" + string(end)
+	}
+	members, err := s.rdb.ZRangeByLex(ctx, s.keySet(namespace), rng).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := make([][]byte, len(members))
+	for i, m := range members {
+		keys[i] = []byte(m)
+	}
+	keys, next := cutPage(keys, limit)
+	return keys, next, nil
+}
+
+// GetRange lee las entradas de [start, end) por lotes: las claves con
+// ZRANGEBYLEX y sus valores con HMGET, hasta completar 'limit' (lo
+// caducado no cuenta). Como scan, no es una instantánea.
+func (s *RedisStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	ok, err := s.hasNamespace(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+	rng := &redis.ZRangeBy{Min: "-", Max: "+", Count: int64(min(limit, redisScanBatch))}
+	if len(start) > 0 {
+		rng.Min = "[" + string(start)
+	}
+	if end != nil {
+		rng.Max = "(" + string(end)
+	}
+	r := newRangeEntries(namespace, end, limit)
+	for {
+		members, err := s.rdb.ZRangeByLex(ctx, s.keySet(namespace), rng).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(members) == 0 {
+			return r.list, nil
+		}
+		vals, err := s.rdb.HMGet(ctx, s.values(namespace), members...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range vals {
+			str, ok := v.(string)
+			if !ok {
+				continue // borrada después de listar las claves
+			}
+			if !r.add([]byte(members[i]), []byte(str)) {
+				return r.list, nil
+			}
+		}
+		if int64(len(members)) < rng.Count {
+			return r.list, nil
+		}
+		rng.Min = "(" + members[len(members)-1]
+	}
+}
+
+// LastN lee hacia atrás por lotes: las claves con ZREVRANGEBYLEX y sus
+// valores con HMGET, hasta tener 'n' vivas. Como scan, no es una
+// instantánea.
+func (s *RedisStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	if err := checkLimit(n); err != nil {
+		return nil, err
+	}
+	ok, err := s.hasNamespace(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+	rng := &redis.ZRangeBy{Min: "-", Max: "+", Count: int64(min(n, redisScanBatch))}
+	if len(prefix) > 0 {
+		rng.Min = "[" + string(prefix)
+	}
+	if end := prefixEnd(prefix); end != nil {
+		rng.Max = "(" + string(end)
+	}
+	r := newRangeEntries(namespace, nil, n)
+	for {
+		members, err := s.rdb.ZRevRangeByLex(ctx, s.keySet(namespace), rng).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(members) == 0 {
+			return r.list, nil
+		}
+		vals, err := s.rdb.HMGet(ctx, s.values(namespace), members...).Result()
+		if err != nil {
+			return nil, err
+		}
+		for i, v := range vals {
+			str, ok := v.(string)
+			if !ok {
+				continue // borrada después de listar las claves
+			}
+			if !r.add([]byte(members[i]), []byte(str)) {
+				return r.list, nil
+			}
+		}
+		if int64(len(members)) < rng.Count {
+			return r.list, nil
+		}
+		rng.Max = "(" + members[len(members)-1]
+	}
+}
+
+// redisScanBatch es cuántos valores pide ForEach en cada HMGET.
+const redisScanBatch = 256
+
+// ForEach recorre 'namespace' con scan, sin las entradas caducadas.
+func (s *RedisStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.scan(ctx, namespace, liveEntries(fn))
+}
+
+// scan recorre 'namespace' en orden pidiendo los valores por lotes, tal
+// cual están guardados (ver rawScanner). Como Backup, no es una
+// instantánea: lo que otra instancia escriba durante el recorrido puede
+// verse o no.
+func (s *RedisStore) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	keys, err := s.ListKeys(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	for len(keys) > 0 {
+		n := min(len(keys), redisScanBatch)
+		fields := make([]string, n)
+		for i, k := range keys[:n] {
+			fields[i] = string(k)
+		}
+		vals, err := s.rdb.HMGet(ctx, s.values(namespace), fields...).Result()
+		if err != nil {
+			return err
+		}
+		for i, v := range vals {
+			str, ok := v.(string)
+			if !ok {
+				continue // borrada después de listar las claves
+			}
+			if err := fn(keys[i], []byte(str)); err != nil {
+				return err
+			}
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// Namespaces devuelve los nombres de todos los namespaces, en orden.
+func (s *RedisStore) Namespaces(ctx context.Context) ([]string, error) {
+	names, err := s.rdb.SMembers(ctx, s.nsSet()).Result()
+	sort.Strings(names)
+	return names, err
+}
+
+// NamespacesUnder devuelve los namespaces cuyo nombre empieza por 'parent/'.
+func (s *RedisStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return namespacesUnder(names, parent)
+}
+
+// toAny convierte la lista de nombres en argumentos de SADD.
+func toAny(names []string) []any {
+	args := make([]any, len(names))
+	for i, n := range names {
+		args[i] = n
+	}
+	return args
+}
+
+// redisRecord es una línea de las copias de RedisStore. Un registro sin
+// clave sólo declara el namespace (para conservar los vacíos).
+type redisRecord struct {
+	Namespace string `json:"ns"`
+	Key       []byte `json:"k"` // null en las declaraciones
+	Value     []byte `json:"v,omitempty"`
+}
+
+// Backup escribe en 'w' todos los registros, uno por línea en JSON. Redis
+// no ofrece una instantánea desde el cliente: como con los demás comandos
+// de administración, la copia es consistente con el servidor parado.
+func (s *RedisStore) Backup(ctx context.Context, w io.Writer) error {
+	enc := json.NewEncoder(w)
+	return s.forEach(ctx, func(rec redisRecord) error { return enc.Encode(rec) })
+}
+
+// forEach llama a 'fn' con la declaración de cada namespace y con cada uno
+// de sus registros.
+func (s *RedisStore) forEach(ctx context.Context, fn func(redisRecord) error) error {
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return err
+	}
+	for _, ns := range names {
+		if err := fn(redisRecord{Namespace: ns}); err != nil {
+			return err
+		}
+		err := s.ForEach(ctx, ns, func(k, v []byte) error {
+			return fn(redisRecord{Namespace: ns, Key: k, Value: v})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadRedis carga en el Redis de 'rawURL' una copia escrita por Backup.
+// Como con los ficheros, no se mezcla con datos existentes: si el prefijo
+// ya tiene algún namespace, falla.
+func loadRedis(r io.Reader, rawURL string) error {
+	s, err := NewRedisStore(rawURL)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	ctx := context.Background()
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("el prefijo %q de redis ya tiene datos", s.prefix)
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var rec redisRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("copia de redis mal formada: %v", err)
+		}
+		if rec.Key == nil {
+			err = s.rdb.SAdd(ctx, s.nsSet(), rec.Namespace).Err()
+		} else {
+			err = s.Put(ctx, rec.Namespace, rec.Key, rec.Value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// Close cierra la conexión con Redis.
+func (s *RedisStore) Close() error {
+	return s.rdb.Close()
+}
+
+// Dump escribe en 'w' el contenido de la base de datos para depuración
+// (ver DumpOptions), con los valores tal cual están guardados.
+func (s *RedisStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return dump(ctx, s, s.scan, w, opts)
+}
@@ -0,0 +1,711 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+/*
+	Implementación de la interfaz Store sobre un bucket compatible con S3
+	(MinIO para las pruebas locales), para que el servidor pueda ejecutarse
+	sin estado y con la persistencia en remoto
+*/
+
+// Cada namespace deja una marca vacía <prefijo>/ns/<ns> y cada entrada es
+// un objeto <prefijo>/data/<ns>/k<clave en hex>. El nombre del namespace va
+// con url.PathEscape (su "/" pasa a "%2F", así que los anidados no se
+// mezclan con los datos del padre) y la clave en hexadecimal, que conserva
+// el orden byte a byte en el que S3 lista los objetos y admite claves
+// binarias. S3 limita los nombres a 1024 bytes: una clave no puede pasar de
+// unos 500.
+
+// s3DefaultPrefix es el prefijo de los objetos si la URL no trae "prefix".
+const s3DefaultPrefix = "prac"
+
+// s3ListBatch es cuántos objetos pide cada ListObjects.
+const s3ListBatch = 1000
+
+// S3Store contiene el cliente de S3, el bucket y el prefijo de los objetos.
+type S3Store struct {
+	client *minio.Client
+	bucket string
+	prefix string // con la "/" final
+
+	// mu ordena los Batch de esta instancia entre sí (ver Batch)
+	mu sync.Mutex
+}
+
+// NewS3Store se conecta a la URL 'rawURL'
+// ("s3://[clave:secreto@]host[:puerto]/bucket"), que usa HTTPS salvo con
+// el parámetro "tls=false" (el MinIO de las pruebas). Sin credenciales en
+// la URL se usan las de AWS_ACCESS_KEY_ID y AWS_SECRET_ACCESS_KEY. Los
+// parámetros opcionales "region" y "prefix" fijan la región y separan los
+// datos de varias instalaciones en el mismo bucket, que se crea si no
+// existe.
+func NewS3Store(rawURL string) (*S3Store, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("URL de s3 no válida: %v", err)
+	}
+	bucket := strings.Trim(u.Path, "/")
+	if u.Scheme != "s3" || u.Host == "" || bucket == "" || strings.Contains(bucket, "/") {
+		return nil, fmt.Errorf("URL de s3 no válida: se esperaba s3://host/bucket")
+	}
+	q := u.Query()
+	secure := true
+	if v := q.Get("tls"); v != "" {
+		if secure, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("URL de s3 no válida: tls=%q", v)
+		}
+	}
+	prefix := q.Get("prefix")
+	if prefix == "" {
+		prefix = s3DefaultPrefix
+	}
+	creds := credentials.NewEnvAWS()
+	if u.User != nil {
+		secret, _ := u.User.Password()
+		creds = credentials.NewStaticV4(u.User.Username(), secret, "")
+	}
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  creds,
+		Secure: secure,
+		Region: q.Get("region"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error al conectar con s3: %v", err)
+	}
+	ctx := context.Background()
+	ok, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("error al conectar con s3: %v", err)
+	}
+	if !ok {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: q.Get("region")}); err != nil {
+			return nil, fmt.Errorf("error creando el bucket %s: %v", bucket, err)
+		}
+	}
+	return &S3Store{client: client, bucket: bucket, prefix: strings.TrimSuffix(prefix, "/") + "/"}, nil
+}
+
+func (s *S3Store) nsDir() string                    { return s.prefix + "ns/" }
+func (s *S3Store) nsObject(namespace string) string { return s.nsDir() + url.PathEscape(namespace) }
+func (s *S3Store) dataDir(namespace string) string {
+	return s.prefix + "data/" + url.PathEscape(namespace) + "/"
+}
+
+// dataObject es el nombre del objeto de (namespace, key). Con un prefijo de
+// clave en lugar de 'key', es el prefijo de los objetos de las claves que
+// empiezan por él.
+func (s *S3Store) dataObject(namespace string, key []byte) string {
+	return s.dataDir(namespace) + "k" + hex.EncodeToString(key)
+}
+
+// objectKey recupera la clave de un objeto de datos de 'namespace'.
+func (s *S3Store) objectKey(namespace, name string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(name, s.dataDir(namespace)+"k"))
+	if err != nil {
+		return nil, fmt.Errorf("objeto de s3 no válido %q: %v", name, err)
+	}
+	return key, nil
+}
+
+// isNoSuchKey indica si 'err' es la respuesta de S3 a un objeto que no existe.
+func isNoSuchKey(err error) bool {
+	return minio.ToErrorResponse(err).Code == "NoSuchKey"
+}
+
+// hasNamespace indica si 'namespace' existe.
+func (s *S3Store) hasNamespace(ctx context.Context, namespace string) (bool, error) {
+	_, err := s.client.StatObject(ctx, s.bucket, s.nsObject(namespace), minio.StatObjectOptions{})
+	if isNoSuchKey(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// checkNamespace devuelve errNoNamespace si 'namespace' no existe.
+func (s *S3Store) checkNamespace(ctx context.Context, namespace string) error {
+	ok, err := s.hasNamespace(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNoNamespace(namespace)
+	}
+	return nil
+}
+
+// getObject lee el valor de 'key' en 'namespace', tal cual está guardado.
+func (s *S3Store) getObject(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.dataObject(namespace, key), minio.GetObjectOptions{})
+	if err == nil {
+		defer obj.Close()
+		var val []byte
+		if val, err = io.ReadAll(obj); err == nil {
+			return nonNil(val), nil
+		}
+	}
+	if isNoSuchKey(err) {
+		if err := s.checkNamespace(ctx, namespace); err != nil {
+			return nil, err
+		}
+		return nil, errNoKey(key)
+	}
+	return nil, err
+}
+
+// putObject escribe 'data' en el objeto 'name'. El cuerpo no se firma: sin
+// TLS, minio-go lo mandaría en trozos firmados (aws-chunked), que algunos
+// servidores compatibles con S3 no aceptan, y los valores ya llevan su
+// propia autenticación si se escriben a través de un EncryptedStore.
+func (s *S3Store) putObject(ctx context.Context, name string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, name, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/octet-stream", DisableContentSha256: true})
+	return err
+}
+
+// listObjects llama a 'fn' con el nombre de cada objeto que empieza por
+// 'prefix' y va detrás de 'after', en orden, hasta que 'fn' devuelve false.
+func (s *S3Store) listObjects(ctx context.Context, prefix, after string, fn func(name string) bool) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // para el listado si 'fn' corta antes
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: after,
+		Recursive:  true,
+		MaxKeys:    s3ListBatch,
+	}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if !fn(obj.Key) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// listKeys llama a 'fn' con las claves de 'namespace' que empiezan por
+// 'prefix' desde 'from' (incluida), en orden, hasta que devuelve false.
+// StartAfter de S3 es exclusivo: se pide desde el nombre de 'from' sin su
+// último carácter y se descartan las pocas claves anteriores a 'from'.
+func (s *S3Store) listKeys(ctx context.Context, namespace string, prefix, from []byte, fn func(key []byte) bool) error {
+	var after string
+	if len(from) > 0 {
+		name := s.dataObject(namespace, from)
+		after = name[:len(name)-1]
+	}
+	var kerr error
+	err := s.listObjects(ctx, s.dataObject(namespace, prefix), after, func(name string) bool {
+		key, err := s.objectKey(namespace, name)
+		if err != nil {
+			kerr = err
+			return false
+		}
+		if bytes.Compare(key, from) < 0 {
+			return true
+		}
+		return fn(key)
+	})
+	if err == nil {
+		err = kerr
+	}
+	return err
+}
+
+// removeObjects borra los objetos 'names' con borrados múltiples.
+func (s *S3Store) removeObjects(ctx context.Context, names []string) error {
+	ch := make(chan minio.ObjectInfo, len(names))
+	for _, name := range names {
+		ch <- minio.ObjectInfo{Key: name}
+	}
+	close(ch)
+	for rerr := range s.client.RemoveObjects(ctx, s.bucket, ch, minio.RemoveObjectsOptions{}) {
+		if rerr.Err != nil {
+			return fmt.Errorf("error borrando %s: %v", rerr.ObjectName, rerr.Err)
+		}
+	}
+	return nil
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace'.
+func (s *S3Store) Put(ctx context.Context, namespace string, key, value []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return tx.Put(namespace, key, value)
+	})
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (s *S3Store) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	val, err := s.getObject(ctx, namespace, key)
+	if err != nil {
+		return nil, err
+	}
+	return liveValue(key, val)
+}
+
+// Exists indica si 'key' está en 'namespace' (y no ha caducado).
+func (s *S3Store) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return exists(ctx, s, namespace, key)
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (s *S3Store) Delete(ctx context.Context, namespace string, key []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return tx.Delete(namespace, key)
+	})
+}
+
+// s3Tx implementa Tx acumulando las escrituras (visibles para las lecturas
+// del propio Batch) hasta que 'fn' termina, como redisTx, pero sin WATCH:
+// S3 no tiene transacciones.
+type s3Tx struct {
+	s       *S3Store
+	ctx     context.Context
+	ops     []s3Op
+	pending map[string]redisPending // namespace 0x00 clave
+	created map[string]bool
+}
+
+// s3Op es una escritura pendiente de un Batch (value nil es un borrado).
+type s3Op struct {
+	namespace string
+	key       []byte
+	value     []byte
+}
+
+// hasNamespace indica si 'namespace' existe, contando los creados en el Batch.
+func (t *s3Tx) hasNamespace(namespace string) (bool, error) {
+	if t.created[namespace] {
+		return true, nil
+	}
+	return t.s.hasNamespace(t.ctx, namespace)
+}
+
+// Put deja pendiente la escritura de (key, value) en 'namespace'.
+func (t *s3Tx) Put(namespace string, key, value []byte) error {
+	chain, err := namespaceChain(namespace)
+	if err != nil {
+		return err
+	}
+	value = bytes.Clone(nonNil(value))
+	t.pending[pendingKey(namespace, key)] = redisPending{value: value}
+	for _, ns := range chain {
+		t.created[ns] = true
+	}
+	t.ops = append(t.ops, s3Op{namespace, bytes.Clone(key), value})
+	return nil
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (t *s3Tx) Get(namespace string, key []byte) ([]byte, error) {
+	if w, ok := t.pending[pendingKey(namespace, key)]; ok {
+		if w.value == nil {
+			return nil, errNoKey(key)
+		}
+		return liveValue(key, bytes.Clone(w.value))
+	}
+	val, err := t.s.getObject(t.ctx, namespace, key)
+	if errors.Is(err, ErrNotFound) && t.created[namespace] {
+		return nil, errNoKey(key) // el namespace lo crea este Batch
+	}
+	if err != nil {
+		return nil, err
+	}
+	return liveValue(key, val)
+}
+
+// Delete deja pendiente el borrado de 'key' en 'namespace'.
+func (t *s3Tx) Delete(namespace string, key []byte) error {
+	ok, err := t.hasNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNoNamespace(namespace)
+	}
+	t.pending[pendingKey(namespace, key)] = redisPending{}
+	t.ops = append(t.ops, s3Op{namespace: namespace, key: bytes.Clone(key)})
+	return nil
+}
+
+// commit escribe las marcas de los namespaces usados y después las
+// escrituras, en orden.
+func (t *s3Tx) commit() error {
+	names := make([]string, 0, len(t.created))
+	for ns := range t.created {
+		names = append(names, ns)
+	}
+	sort.Strings(names) // los antecesores primero
+	for _, ns := range names {
+		if err := t.s.putObject(t.ctx, t.s.nsObject(ns), nil); err != nil {
+			return fmt.Errorf("error al crear/abrir namespace '%s': %v", ns, err)
+		}
+	}
+	for _, op := range t.ops {
+		name := t.s.dataObject(op.namespace, op.key)
+		var err error
+		if op.value == nil {
+			err = t.s.client.RemoveObject(t.ctx, t.s.bucket, name, minio.RemoveObjectOptions{})
+		} else {
+			err = t.s.putObject(t.ctx, name, op.value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PutWithTTL guarda (key, value) en 'namespace' hasta dentro de 'ttl'.
+func (s *S3Store) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return putWithTTL(tx, namespace, key, value, ttl)
+	})
+}
+
+// Batch ejecuta 'fn' y después manda sus escrituras una a una. Si 'fn'
+// falla no se escribe nada, pero S3 no tiene transacciones: si falla una
+// escritura, las anteriores se quedan, y los Batch de otras instancias
+// sobre las mismas claves no se aíslan entre sí (gana la última escritura).
+// Los de esta instancia sí se ejecutan de uno en uno.
+func (s *S3Store) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := &s3Tx{
+		s:       s,
+		ctx:     ctx,
+		pending: make(map[string]redisPending),
+		created: make(map[string]bool),
+	}
+	if err := fn(t); err != nil {
+		return err
+	}
+	return t.commit()
+}
+
+// DeleteNamespace borra 'namespace' y los anidados: primero los datos y
+// después las marcas, así que si se interrumpe quedan namespaces vacíos.
+func (s *S3Store) DeleteNamespace(ctx context.Context, namespace string) error {
+	under, err := s.NamespacesUnder(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	names := append([]string{namespace}, under...)
+	var objects []string
+	for _, ns := range names {
+		err := s.listObjects(ctx, s.dataDir(ns), "", func(name string) bool {
+			objects = append(objects, name)
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		objects = append(objects, s.nsObject(names[i]))
+	}
+	if err := s.removeObjects(ctx, objects); err != nil {
+		return fmt.Errorf("error borrando el namespace '%s': %v", namespace, err)
+	}
+	return nil
+}
+
+// DeleteByPrefix borra las claves de 'namespace' que empiezan por 'prefix'
+// con borrados múltiples. Como Batch, no es atómico.
+func (s *S3Store) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	if err := s.checkNamespace(ctx, namespace); err != nil {
+		return 0, err
+	}
+	var objects []string
+	err := s.listObjects(ctx, s.dataObject(namespace, prefix), "", func(name string) bool {
+		objects = append(objects, name)
+		return true
+	})
+	if err == nil {
+		err = s.removeObjects(ctx, objects)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(objects), nil
+}
+
+// ListKeys devuelve todas las claves de 'namespace', en orden.
+func (s *S3Store) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.KeysByPrefix(ctx, namespace, nil)
+}
+
+// CountKeys cuenta las claves de 'namespace' listando sus objetos (S3 no
+// lleva la cuenta).
+func (s *S3Store) CountKeys(ctx context.Context, namespace string) (int, error) {
+	if err := s.checkNamespace(ctx, namespace); err != nil {
+		return 0, err
+	}
+	n := 0
+	err := s.listObjects(ctx, s.dataDir(namespace), "", func(string) bool {
+		n++
+		return true
+	})
+	return n, err
+}
+
+// KeysByPrefix devuelve, en orden, las claves de 'namespace' que empiecen
+// con 'prefix' (sin leer los objetos).
+func (s *S3Store) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	if err := s.checkNamespace(ctx, namespace); err != nil {
+		return nil, err
+	}
+	var keys [][]byte
+	err := s.listKeys(ctx, namespace, prefix, nil, func(key []byte) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// ListKeysPage devuelve una página de las claves de 'namespace'.
+func (s *S3Store) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.KeysByPrefixPage(ctx, namespace, nil, after, limit)
+}
+
+// KeysByPrefixPage devuelve una página de las claves que empiezan por
+// 'prefix', con el cursor como StartAfter del listado.
+func (s *S3Store) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	if err := s.checkNamespace(ctx, namespace); err != nil {
+		return nil, nil, err
+	}
+	start, skip := pageStart(prefix, after)
+	var keys [][]byte
+	err := s.listKeys(ctx, namespace, prefix, start, func(key []byte) bool {
+		if !skip || !bytes.Equal(key, start) {
+			keys = append(keys, key)
+		}
+		return len(keys) <= limit
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	keys, next := cutPage(keys, limit)
+	return keys, next, nil
+}
+
+// GetRange lee las entradas de [start, end), listando desde 'start' y
+// leyendo los objetos uno a uno hasta completar 'limit'. Como scan, no es
+// una instantánea.
+func (s *S3Store) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	if err := s.checkNamespace(ctx, namespace); err != nil {
+		return nil, err
+	}
+	r := newRangeEntries(namespace, end, limit)
+	var gerr error
+	err := s.listKeys(ctx, namespace, nil, start, func(key []byte) bool {
+		if r.past(key) {
+			return false
+		}
+		val, err := s.getObject(ctx, namespace, key)
+		if errors.Is(err, ErrNotFound) {
+			return true // borrada después de listarla
+		}
+		if err != nil {
+			gerr = err
+			return false
+		}
+		return r.add(key, val)
+	})
+	if err == nil {
+		err = gerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return r.list, nil
+}
+
+// LastN lista las claves de 'namespace' que empiezan por 'prefix' (S3 sólo
+// lista hacia delante) y lee los objetos desde la última hasta tener 'n'
+// vivas.
+func (s *S3Store) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	if err := checkLimit(n); err != nil {
+		return nil, err
+	}
+	keys, err := s.KeysByPrefix(ctx, namespace, prefix)
+	if err != nil {
+		return nil, err
+	}
+	r := newRangeEntries(namespace, nil, n)
+	for i := len(keys) - 1; i >= 0; i-- {
+		val, err := s.getObject(ctx, namespace, keys[i])
+		if errors.Is(err, ErrNotFound) {
+			continue // borrada después de listarla
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !r.add(keys[i], val) {
+			break
+		}
+	}
+	return r.list, nil
+}
+
+// ForEach recorre 'namespace' con scan, sin las entradas caducadas.
+func (s *S3Store) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.scan(ctx, namespace, liveEntries(fn))
+}
+
+// scan recorre 'namespace' en orden leyendo los objetos uno a uno, tal cual
+// están guardados (ver rawScanner). Como con Redis, no es una instantánea:
+// lo que otra instancia escriba durante el recorrido puede verse o no.
+func (s *S3Store) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	keys, err := s.ListKeys(ctx, namespace)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		val, err := s.getObject(ctx, namespace, key)
+		if errors.Is(err, ErrNotFound) {
+			continue // borrada después de listarla
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Namespaces devuelve los nombres de todos los namespaces, en orden.
+func (s *S3Store) Namespaces(ctx context.Context) ([]string, error) {
+	var (
+		names []string
+		nerr  error
+	)
+	err := s.listObjects(ctx, s.nsDir(), "", func(name string) bool {
+		ns, err := url.PathUnescape(strings.TrimPrefix(name, s.nsDir()))
+		if err != nil {
+			nerr = fmt.Errorf("objeto de s3 no válido %q: %v", name, err)
+			return false
+		}
+		names = append(names, ns)
+		return true
+	})
+	if err == nil {
+		err = nerr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names) // el escape de "/" cambia el orden
+	return names, nil
+}
+
+// NamespacesUnder devuelve los namespaces cuyo nombre empieza por 'parent/'.
+func (s *S3Store) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return namespacesUnder(names, parent)
+}
+
+// Backup escribe en 'w' todos los registros, uno por línea en JSON, en el
+// formato de las copias de RedisStore. Tampoco es una instantánea: la copia
+// es consistente con el servidor parado.
+func (s *S3Store) Backup(ctx context.Context, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return err
+	}
+	for _, ns := range names {
+		if err := enc.Encode(redisRecord{Namespace: ns}); err != nil {
+			return err
+		}
+		err := s.scan(ctx, ns, func(k, v []byte) error {
+			return enc.Encode(redisRecord{Namespace: ns, Key: k, Value: v})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// loadS3 carga en el bucket de 'rawURL' una copia escrita por Backup. Como
+// con los ficheros, no se mezcla con datos existentes: si el prefijo ya
+// tiene algún namespace, falla.
+func loadS3(r io.Reader, rawURL string) error {
+	s, err := NewS3Store(rawURL)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	ctx := context.Background()
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		return fmt.Errorf("el prefijo %q del bucket %s ya tiene datos", s.prefix, s.bucket)
+	}
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var rec redisRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fmt.Errorf("copia de s3 mal formada: %v", err)
+		}
+		if rec.Key == nil {
+			err = s.putObject(ctx, s.nsObject(rec.Namespace), nil)
+		} else {
+			err = s.putObject(ctx, s.dataObject(rec.Namespace, rec.Key), nonNil(rec.Value))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// Close no hace nada: el cliente de S3 no mantiene conexiones que cerrar
+// más allá de las de net/http.
+func (s *S3Store) Close() error {
+	return nil
+}
+
+// Dump escribe en 'w' el contenido del bucket para depuración (ver
+// DumpOptions), con los valores tal cual están guardados.
+func (s *S3Store) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return dump(ctx, s, s.scan, w, opts)
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+/*
+	Borrado recuperable (DeleteSoft), común a todos los motores: lo borrado
+	se guarda como lápida durante un tiempo por si hay que recuperarlo
+*/
+
+// trashSuffix es el último nivel del namespace de las lápidas de cada
+// namespace: el de "userdata" es "userdata/_trash". Como el historial,
+// DeleteNamespace se lo lleva con el namespace.
+const trashSuffix = "_trash"
+
+// Las lápidas se guardan con la misma clave que tenía la entrada, y su
+// valor es la hora del borrado (UnixNano, 8 bytes big-endian) || valor.
+
+// Deleted describe una entrada borrada con DeleteSoft que aún se puede
+// recuperar.
+type Deleted struct {
+	Key  []byte
+	Time time.Time // cuándo se borró
+	Size int
+}
+
+// trashNamespace devuelve el namespace de las lápidas de 'namespace'.
+func trashNamespace(namespace string) string {
+	return namespace + NamespaceSep + trashSuffix
+}
+
+// parseTombstone separa la hora del borrado y el valor de una lápida.
+func parseTombstone(raw []byte) (time.Time, []byte, error) {
+	if len(raw) < 8 {
+		return time.Time{}, nil, errors.New("lápida mal formada")
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(raw))), raw[8:], nil
+}
+
+// DeleteSoft borra 'key' de 'namespace' guardando antes su valor como
+// lápida, en el mismo Batch, para poder recuperarlo con RestoreDeleted
+// hasta que PurgeTombstones lo elimine. Si la clave no existe, el error es
+// ErrNotFound. Una entrada con caducidad se recupera sin ella.
+func DeleteSoft(ctx context.Context, s Store, namespace string, key []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		value, err := tx.Get(namespace, key)
+		if err != nil {
+			return err
+		}
+		raw := make([]byte, 0, 8+len(value))
+		raw = binary.BigEndian.AppendUint64(raw, uint64(time.Now().UnixNano()))
+		raw = append(raw, value...)
+		if err := tx.Put(trashNamespace(namespace), key, raw); err != nil {
+			return err
+		}
+		return tx.Delete(namespace, key)
+	})
+}
+
+// RestoreDeleted vuelve a poner en 'key' el valor que tenía cuando se
+// borró con DeleteSoft y retira su lápida. Si no hay lápida, el error es
+// ErrNotFound; si la clave se ha vuelto a escribir desde entonces, no la
+// sobrescribe y devuelve ErrConflict.
+func RestoreDeleted(ctx context.Context, s Store, namespace string, key []byte) error {
+	trash := trashNamespace(namespace)
+	return s.Batch(ctx, func(tx Tx) error {
+		raw, err := tx.Get(trash, key)
+		if errors.Is(err, ErrNotFound) {
+			return notFoundError{fmt.Sprintf("no hay nada borrado en %s/%s", namespace, string(key))}
+		}
+		if err != nil {
+			return err
+		}
+		_, value, err := parseTombstone(raw)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Get(namespace, key); err == nil {
+			return fmt.Errorf("%s/%s se ha vuelto a escribir: %w", namespace, string(key), ErrConflict)
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		if err := tx.Put(namespace, key, value); err != nil {
+			return err
+		}
+		return tx.Delete(trash, key)
+	})
+}
+
+// ListDeleted devuelve las entradas de 'namespace' borradas con DeleteSoft
+// que aún se pueden recuperar, de la más reciente a la más antigua.
+func ListDeleted(ctx context.Context, s Store, namespace string) ([]Deleted, error) {
+	var list []Deleted
+	err := s.ForEach(ctx, trashNamespace(namespace), func(key, raw []byte) error {
+		at, value, err := parseTombstone(raw)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %v", namespace, string(key), err)
+		}
+		list = append(list, Deleted{Key: append([]byte(nil), key...), Time: at, Size: len(value)})
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Time.After(list[j].Time) })
+	return list, nil
+}
+
+// PurgeTombstones elimina definitivamente, de todos los namespaces, las
+// lápidas de lo borrado antes de 'before' y devuelve cuántas ha eliminado.
+func PurgeTombstones(ctx context.Context, s Store, before time.Time) (int, error) {
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, trash := range names {
+		if !strings.HasSuffix(trash, NamespaceSep+trashSuffix) {
+			continue
+		}
+		var old [][]byte
+		err := s.ForEach(ctx, trash, func(key, raw []byte) error {
+			if at, _, err := parseTombstone(raw); err != nil || at.Before(before) {
+				old = append(old, append([]byte(nil), key...))
+			}
+			return nil
+		})
+		if errors.Is(err, ErrNotFound) {
+			continue // borrado mientras tanto
+		}
+		if err != nil {
+			return purged, err
+		}
+		for _, key := range old {
+			if err := s.Delete(ctx, trash, key); err != nil && !errors.Is(err, ErrNotFound) {
+				return purged, fmt.Errorf("error eliminando la lápida %s/%s: %v", trash, string(key), err)
+			}
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// StartPurger lanza una goroutine que cada 'every' llama a PurgeTombstones
+// sobre 's' con lo borrado hace más de 'retention'. Los errores se pasan a
+// 'logf'. Como con StartSweeper, hay que llamar a la función devuelta
+// antes de cerrar 's'.
+func StartPurger(s Store, retention, every time.Duration, logf func(format string, args ...any)) (stop func()) {
+	return startEvery(every, func(ctx context.Context, now time.Time) {
+		if _, err := PurgeTombstones(ctx, s, now.Add(-retention)); err != nil && ctx.Err() == nil {
+			logf("error eliminando lápidas antiguas: %v", err)
+		}
+	})
+}
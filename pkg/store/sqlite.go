@@ -0,0 +1,598 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite" // driver "sqlite" en Go puro (sin cgo)
+)
+
+/*
+	Implementación de la interfaz Store mediante SQLite
+*/
+
+// sqliteSchema crea las tablas si no existen. Los valores viven en 'kv',
+// cuya clave primaria (namespace, key) es a la vez el índice de las
+// búsquedas por clave y de los recorridos por prefijo (SQLite compara los
+// BLOB byte a byte, como bbolt). 'namespaces' guarda los namespaces creados
+// para que, como los buckets de bbolt, sigan existiendo aunque se vacíen.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS namespaces (
+	name TEXT PRIMARY KEY
+) WITHOUT ROWID;
+CREATE TABLE IF NOT EXISTS kv (
+	namespace TEXT NOT NULL REFERENCES namespaces(name),
+	key       BLOB NOT NULL,
+	value     BLOB NOT NULL,
+	PRIMARY KEY (namespace, key)
+) WITHOUT ROWID;
+`
+
+// SQLiteStore contiene la conexión con la base de datos SQLite.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore abre (o crea) la base de datos SQLite de 'path'. Se puede
+// inspeccionar con las herramientas habituales ("sqlite3 fichero.db").
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	// Si el fichero es nuevo, que nazca sólo legible por nosotros
+	if f, err := os.OpenFile(path, os.O_RDONLY|os.O_CREATE, 0600); err == nil {
+		f.Close()
+	}
+	// _txlock=immediate: las transacciones de escritura toman el cerrojo al
+	// empezar, para que dos Batch que leen antes de escribir esperen su
+	// turno (busy_timeout) en vez de fallar al intentar subir de lectura a
+	// escritura.
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("error al abrir base de datos sqlite: %v", err)
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error al abrir base de datos sqlite: %v", err)
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// sqlRunner es lo que *sql.DB y *sql.Tx tienen en común.
+type sqlRunner interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqliteTx implementa Tx sobre una conexión o una transacción de SQLite,
+// con el contexto de la operación.
+type sqliteTx struct {
+	ctx context.Context
+	q   sqlRunner
+}
+
+// hasNamespace indica si 'namespace' existe (el equivalente a que exista
+// su bucket en bbolt).
+func (t sqliteTx) hasNamespace(namespace string) (bool, error) {
+	var n int
+	err := t.q.QueryRowContext(t.ctx, `SELECT 1 FROM namespaces WHERE name = ?`, namespace).Scan(&n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace' (creándolo,
+// con sus antecesores, si no existe). Son varias sentencias: hay que
+// llamarlo dentro de una transacción.
+func (t sqliteTx) Put(namespace string, key, value []byte) error {
+	chain, err := namespaceChain(namespace)
+	if err != nil {
+		return err
+	}
+	for _, ns := range chain {
+		if _, err := t.q.ExecContext(t.ctx, `INSERT OR IGNORE INTO namespaces (name) VALUES (?)`, ns); err != nil {
+			return fmt.Errorf("error al crear/abrir namespace '%s': %v", namespace, err)
+		}
+	}
+	_, err = t.q.ExecContext(t.ctx, `INSERT INTO kv (namespace, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (namespace, key) DO UPDATE SET value = excluded.value`, namespace, key, nonNil(value))
+	return err
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (t sqliteTx) Get(namespace string, key []byte) ([]byte, error) {
+	var val []byte
+	err := t.q.QueryRowContext(t.ctx, `SELECT value FROM kv WHERE namespace = ? AND key = ?`, namespace, key).Scan(&val)
+	if errors.Is(err, sql.ErrNoRows) {
+		ok, err := t.hasNamespace(namespace)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errNoNamespace(namespace)
+		}
+		return nil, errNoKey(key)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return liveValue(key, nonNil(val))
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (t sqliteTx) Delete(namespace string, key []byte) error {
+	ok, err := t.hasNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNoNamespace(namespace)
+	}
+	_, err = t.q.ExecContext(t.ctx, `DELETE FROM kv WHERE namespace = ? AND key = ?`, namespace, key)
+	return err
+}
+
+// Put almacena o actualiza (key, value) dentro de 'namespace'.
+func (s *SQLiteStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return tx.Put(namespace, key, value)
+	})
+}
+
+// Get recupera el valor de 'key' en 'namespace'.
+func (s *SQLiteStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	return sqliteTx{ctx, s.db}.Get(namespace, key)
+}
+
+// Exists indica si 'key' está en 'namespace' (y no ha caducado).
+func (s *SQLiteStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return exists(ctx, s, namespace, key)
+}
+
+// Delete elimina la clave 'key' de 'namespace'.
+func (s *SQLiteStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	return sqliteTx{ctx, s.db}.Delete(namespace, key)
+}
+
+// PutWithTTL guarda (key, value) en 'namespace' hasta dentro de 'ttl'.
+func (s *SQLiteStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	return s.Batch(ctx, func(tx Tx) error {
+		return putWithTTL(tx, namespace, key, value, ttl)
+	})
+}
+
+// DeleteNamespace borra 'namespace' y los que cuelgan de él en una
+// transacción. Los anidados son los nombres en ['namespace/', 'namespace0'):
+// '0' es el carácter siguiente a '/'.
+func (s *SQLiteStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	ok, err := sqliteTx{ctx, tx}.hasNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNoNamespace(namespace)
+	}
+	lo, hi := namespace+NamespaceSep, namespace+"0"
+	if _, err := tx.ExecContext(ctx, `DELETE FROM kv WHERE namespace = ? OR (namespace >= ? AND namespace < ?)`, namespace, lo, hi); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM namespaces WHERE name = ? OR (name >= ? AND name < ?)`, namespace, lo, hi); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteByPrefix borra con un único DELETE por rango las claves de
+// 'namespace' que empiezan por 'prefix'.
+func (s *SQLiteStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	ok, err := sqliteTx{ctx, tx}.hasNamespace(namespace)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errNoNamespace(namespace)
+	}
+	query, args := `DELETE FROM kv WHERE namespace = ? AND key >= ?`, []any{namespace, nonNil(prefix)}
+	if end := prefixEnd(prefix); end != nil {
+		query, args = query+` AND key < ?`, append(args, end)
+	}
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+// Batch ejecuta 'fn' en una transacción de SQLite, que se confirma sólo si
+// 'fn' no devuelve error.
+func (s *SQLiteStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := fn(sqliteTx{ctx, tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListKeys devuelve todas las claves de 'namespace', en orden.
+func (s *SQLiteStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.KeysByPrefix(ctx, namespace, nil)
+}
+
+// CountKeys cuenta las claves de 'namespace' con COUNT(*) sobre el índice.
+func (s *SQLiteStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	ok, err := sqliteTx{ctx, tx}.hasNamespace(namespace)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errNoNamespace(namespace)
+	}
+	var n int
+	err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM kv WHERE namespace = ?`, namespace).Scan(&n)
+	return n, err
+}
+
+// KeysByPrefix devuelve, en orden, las claves de 'namespace' que empiecen
+// con 'prefix'. Se traduce a un rango [prefix, siguiente prefijo) para que
+// lo resuelva el índice de la clave primaria.
+func (s *SQLiteStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	// Sólo lectura: no hace falta el cerrojo de escritura de _txlock
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	ok, err := sqliteTx{ctx, tx}.hasNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+
+	query, args := `SELECT key FROM kv WHERE namespace = ? AND key >= ?`, []any{namespace, nonNil(prefix)}
+	if end := prefixEnd(prefix); end != nil {
+		query, args = query+` AND key < ?`, append(args, end)
+	}
+	rows, err := tx.QueryContext(ctx, query+` ORDER BY key`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys [][]byte
+	for rows.Next() {
+		var k []byte
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, bytes.Clone(k))
+	}
+	return keys, rows.Err()
+}
+
+// ListKeysPage devuelve una página de las claves de 'namespace'.
+func (s *SQLiteStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.KeysByPrefixPage(ctx, namespace, nil, after, limit)
+}
+
+// KeysByPrefixPage devuelve una página de las claves que empiezan por
+// 'prefix', con el cursor como cota inferior de la consulta (key > ?) y
+// LIMIT para no leer más de la cuenta.
+func (s *SQLiteStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	ok, err := sqliteTx{ctx, tx}.hasNamespace(namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, errNoNamespace(namespace)
+	}
+
+	start, skip := pageStart(prefix, after)
+	op := ">="
+	if skip {
+		op = ">"
+	}
+	query, args := `SELECT key FROM kv WHERE namespace = ? AND key `+op+` ?`, []any{namespace, nonNil(start)}
+	if end := prefixEnd(prefix); end != nil {
+		query, args = query+` AND key < ?`, append(args, end)
+	}
+	rows, err := tx.QueryContext(ctx, query+` ORDER BY key LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var keys [][]byte
+	for rows.Next() {
+		var k []byte
+		if err := rows.Scan(&k); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, bytes.Clone(k))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	keys, next := cutPage(keys, limit)
+	return keys, next, nil
+}
+
+// ForEach recorre 'namespace' con scan, sin las entradas caducadas.
+func (s *SQLiteStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.scan(ctx, namespace, liveEntries(fn))
+}
+
+// scan recorre 'namespace' con una única consulta, dentro de una
+// transacción de lectura, con los valores tal cual están guardados (ver
+// rawScanner).
+func (s *SQLiteStore) scan(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	ok, err := sqliteTx{ctx, tx}.hasNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errNoNamespace(namespace)
+	}
+	rows, err := tx.QueryContext(ctx, `SELECT key, value FROM kv WHERE namespace = ? ORDER BY key`, namespace)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	fn = withContext(ctx, fn)
+	for rows.Next() {
+		var k, v sql.RawBytes
+		if err := rows.Scan(&k, &v); err != nil {
+			return err
+		}
+		if err := fn(nonNil(k), nonNil(v)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// GetRange lee las entradas de [start, end) con una consulta por rango de
+// la clave primaria. El LIMIT no sirve (lo caducado no cuenta), así que se
+// leen las filas hasta completar la lista y se descarta el resto.
+func (s *SQLiteStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	if err := checkLimit(limit); err != nil {
+		return nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	ok, err := sqliteTx{ctx, tx}.hasNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+
+	query, args := `SELECT key, value FROM kv WHERE namespace = ? AND key >= ?`, []any{namespace, nonNil(start)}
+	if end != nil {
+		query, args = query+` AND key < ?`, append(args, end)
+	}
+	rows, err := tx.QueryContext(ctx, query+` ORDER BY key`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := newRangeEntries(namespace, end, limit)
+	for rows.Next() {
+		var k, v sql.RawBytes
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		if !r.add(nonNil(k), nonNil(v)) {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return r.list, nil
+}
+
+// LastN lee las claves con 'prefix' en orden descendente de la clave
+// primaria, hasta tener 'n' vivas.
+func (s *SQLiteStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	if err := checkLimit(n); err != nil {
+		return nil, err
+	}
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	ok, err := sqliteTx{ctx, tx}.hasNamespace(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errNoNamespace(namespace)
+	}
+
+	query, args := `SELECT key, value FROM kv WHERE namespace = ? AND key >= ?`, []any{namespace, nonNil(prefix)}
+	if end := prefixEnd(prefix); end != nil {
+		query, args = query+` AND key < ?`, append(args, end)
+	}
+	rows, err := tx.QueryContext(ctx, query+` ORDER BY key DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := newRangeEntries(namespace, nil, n)
+	for rows.Next() {
+		var k, v sql.RawBytes
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		if !r.add(nonNil(k), nonNil(v)) {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return r.list, nil
+}
+
+// nonNil evita que un prefijo nil llegue a SQLite como NULL.
+func nonNil(b []byte) []byte {
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+// prefixEnd devuelve la menor clave mayor que todas las que empiezan por
+// 'prefix', o nil si no hay (prefijo vacío o sólo de bytes 0xff).
+func prefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return nil
+}
+
+// Namespaces devuelve los nombres de todos los namespaces.
+func (s *SQLiteStore) Namespaces(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM namespaces ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// NamespacesUnder devuelve los namespaces cuyo nombre empieza por 'parent/'.
+func (s *SQLiteStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return namespacesUnder(names, parent)
+}
+
+// stats calcula Stats con una sola consulta, y el tamaño del fichero con
+// page_count * page_size (ver statsReporter).
+func (s *SQLiteStore) stats(ctx context.Context) (StoreStats, error) {
+	var st StoreStats
+	rows, err := s.db.QueryContext(ctx, `
+SELECT n.name, COUNT(kv.key), COALESCE(SUM(LENGTH(kv.key) + LENGTH(kv.value)), 0)
+FROM namespaces n LEFT JOIN kv ON kv.namespace = n.name
+GROUP BY n.name ORDER BY n.name`)
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ns NamespaceStats
+		if err := rows.Scan(&ns.Namespace, &ns.Keys, &ns.Bytes); err != nil {
+			return st, err
+		}
+		st.add(ns)
+	}
+	if err := rows.Err(); err != nil {
+		return st, err
+	}
+	var pages, pageSize int64
+	if err := s.db.QueryRowContext(ctx, `PRAGMA page_count`).Scan(&pages); err != nil {
+		return st, err
+	}
+	if err := s.db.QueryRowContext(ctx, `PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return st, err
+	}
+	st.FileSize = pages * pageSize
+	return st, nil
+}
+
+// Backup escribe en 'w' una copia consistente de la base de datos, hecha
+// con VACUUM INTO en un fichero temporal (SQLite no sabe escribir en un
+// io.Writer). El resultado es una base SQLite normal.
+func (s *SQLiteStore) Backup(ctx context.Context, w io.Writer) error {
+	dir, err := os.MkdirTemp("", "prac-sqlite-backup")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	tmp := dir + "/backup.db"
+	if _, err := s.db.ExecContext(ctx, `VACUUM INTO ?`, tmp); err != nil {
+		return fmt.Errorf("error copiando la base de datos sqlite: %w", err)
+	}
+	f, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(ctxWriter{ctx, w}, f)
+	return err
+}
+
+// Close cierra la base de datos SQLite.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Dump escribe en 'w' el contenido de la base de datos para depuración
+// (ver DumpOptions), con los valores tal cual están guardados.
+func (s *SQLiteStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return dump(ctx, s, s.scan, w, opts)
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+/*
+	Estadísticas de ocupación (Stats), para ver qué está llenando la base de
+	datos
+*/
+
+// NamespaceStats es la ocupación de un namespace, sin sus anidados.
+type NamespaceStats struct {
+	Namespace string
+	Keys      int64 // entradas, también las caducadas que aún no se han barrido
+	Bytes     int64 // suma de claves y valores tal cual están guardados
+
+	Pages *BboltPageStats // sólo con bbolt
+}
+
+// BboltPageStats son las páginas que ocupa un bucket de bbolt. A
+// diferencia de Keys y Bytes, incluyen las de sus buckets anidados.
+type BboltPageStats struct {
+	BranchPages   int
+	LeafPages     int
+	OverflowPages int
+	Alloc         int // bytes reservados en esas páginas
+	Inuse         int // bytes usados de verdad
+}
+
+// BboltFileStats es el espacio libre del fichero de bbolt, que sólo se
+// recupera compactando (ver Compacter).
+type BboltFileStats struct {
+	PageSize     int
+	FreePages    int // libres, se reutilizan en las próximas escrituras
+	PendingPages int // liberadas por transacciones que aún se están leyendo
+	FreeBytes    int
+}
+
+// StoreStats es la ocupación de toda la base de datos.
+type StoreStats struct {
+	Namespaces []NamespaceStats
+	Keys       int64
+	Bytes      int64
+	FileSize   int64 // tamaño en disco, 0 si el motor no lo sabe
+
+	Bbolt *BboltFileStats // sólo con bbolt
+}
+
+// statsReporter lo cumplen los motores que saben dar más detalle que
+// scanStats (páginas, tamaño del fichero), y los decoradores, que pasan la
+// llamada a su 'inner'.
+type statsReporter interface {
+	stats(ctx context.Context) (StoreStats, error)
+}
+
+// Stats devuelve cuántas entradas y bytes tiene cada namespace de 's'. Con
+// los motores que no lo calculan ellos mismos, recorre todos los
+// namespaces, así que en una base de datos grande tarda.
+func Stats(ctx context.Context, s Store) (StoreStats, error) {
+	if r, ok := s.(statsReporter); ok {
+		return r.stats(ctx)
+	}
+	return scanStats(ctx, s)
+}
+
+// scanStats calcula Stats recorriendo cada namespace con scan, o con
+// ForEach si el motor no lo tiene (y entonces no cuenta lo caducado).
+func scanStats(ctx context.Context, s Store) (StoreStats, error) {
+	var st StoreStats
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return st, err
+	}
+	each := s.ForEach
+	if rs, ok := s.(rawScanner); ok {
+		each = rs.scan
+	}
+	for _, name := range names {
+		ns := NamespaceStats{Namespace: name}
+		err := each(ctx, name, func(key, value []byte) error {
+			ns.Keys++
+			ns.Bytes += int64(len(key) + len(value))
+			return nil
+		})
+		if errors.Is(err, ErrNotFound) {
+			continue // borrado mientras tanto
+		}
+		if err != nil {
+			return st, err
+		}
+		st.add(ns)
+	}
+	return st, nil
+}
+
+// add añade 'ns' a la lista y a los totales.
+func (st *StoreStats) add(ns NamespaceStats) {
+	st.Namespaces = append(st.Namespaces, ns)
+	st.Keys += ns.Keys
+	st.Bytes += ns.Bytes
+}
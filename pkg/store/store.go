@@ -1,45 +1,507 @@
 // El paquete store provee una interfaz genérica de almacenamiento.
-// Cada motor (en nuestro caso bbolt) se implementa en un archivo separado
+// Cada motor (bbolt, SQLite, Badger, LevelDB, Redis, S3 o ficheros JSON) se implementa en un archivo separado
 // que debe cumplir la interfaz Store.
 package store
 
-import "fmt"
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
 
 // Store define los métodos comunes que deben implementar
 // los diferentes motores de almacenamiento.
+//
+// Todos los métodos con datos reciben un contexto: si se cancela (porque
+// el cliente se ha desconectado o la petición ha superado su plazo), la
+// operación se abandona y devuelve ctx.Err(). Una escritura cancelada no
+// se confirma; los recorridos largos miran el contexto entre entradas.
 type Store interface {
 	// Put almacena (o actualiza) el valor 'value' bajo la clave 'key'
 	// dentro del 'namespace' indicado.
-	Put(namespace string, key, value []byte) error
+	Put(ctx context.Context, namespace string, key, value []byte) error
+
+	// PutWithTTL es como Put, pero la entrada caduca pasado 'ttl': desde
+	// entonces Get y ForEach no la devuelven, y el siguiente SweepExpired
+	// la borra (hasta ese momento, ListKeys y similares aún la listan).
+	// Un Put posterior de la misma clave la deja sin caducidad.
+	PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error
 
 	// Get recupera el valor asociado a la clave 'key'
 	// dentro del 'namespace' especificado.
-	Get(namespace string, key []byte) ([]byte, error)
+	Get(ctx context.Context, namespace string, key []byte) ([]byte, error)
+
+	// Exists indica si 'key' está en 'namespace'. Que no esté (o que no
+	// exista el namespace) no es un error: sólo se devuelve error si no se
+	// ha podido comprobar.
+	Exists(ctx context.Context, namespace string, key []byte) (bool, error)
 
 	// Delete elimina la clave 'key' dentro del 'namespace' especificado.
-	Delete(namespace string, key []byte) error
+	Delete(ctx context.Context, namespace string, key []byte) error
+
+	// DeleteNamespace elimina de una vez 'namespace', todas sus claves y
+	// los namespaces anidados bajo él. Sus antecesores no se tocan.
+	DeleteNamespace(ctx context.Context, namespace string) error
+
+	// DeleteByPrefix elimina en una sola transacción todas las claves de
+	// 'namespace' que empiezan por 'prefix' (no los namespaces anidados) y
+	// devuelve cuántas ha borrado.
+	DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error)
 
 	// ListKeys devuelve todas las claves existentes en el namespace.
-	ListKeys(namespace string) ([][]byte, error)
+	ListKeys(ctx context.Context, namespace string) ([][]byte, error)
+
+	// CountKeys devuelve cuántas claves hay en 'namespace' (las mismas que
+	// listaría ListKeys, sin contar los namespaces anidados) sin tener que
+	// leerlas todas.
+	CountKeys(ctx context.Context, namespace string) (int, error)
 
 	// KeysByPrefix devuelve las claves que empiecen con 'prefix' dentro
 	// del namespace especificado.
-	KeysByPrefix(namespace string, prefix []byte) ([][]byte, error)
+	KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error)
+
+	// ListKeysPage devuelve, en orden, hasta 'limit' claves de 'namespace'
+	// posteriores al cursor 'after' (nil para empezar) y el cursor de la
+	// página siguiente, que es nil cuando no quedan más. Los motores usan
+	// como cursor la última clave devuelta, pero hay que tratarlo como
+	// opaco (EncryptedStore, con claves cifradas, devuelve otra cosa).
+	ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) (keys [][]byte, next []byte, err error)
+
+	// KeysByPrefixPage es la versión paginada de KeysByPrefix, con el mismo
+	// cursor que ListKeysPage.
+	KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) (keys [][]byte, next []byte, err error)
+
+	// GetRange devuelve, en orden de clave y con sus valores, hasta 'limit'
+	// entradas de 'namespace' desde 'start' (incluida; nil para empezar por
+	// la primera) hasta 'end' (sin incluir; nil para llegar a la última).
+	// Lo caducado no se devuelve ni cuenta para 'limit'. Para seguir por
+	// donde se quedó, se vuelve a llamar con la última clave más un 0x00.
+	GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error)
+
+	// LastN devuelve, de la última hacia atrás en orden de clave, hasta 'n'
+	// entradas de 'namespace' cuyas claves empiezan por 'prefix' (con
+	// claves con la fecha delante, las 'n' más recientes). Recorre el
+	// namespace al revés, sin leer las anteriores. Lo caducado no cuenta.
+	LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error)
+
+	// ForEach llama a 'fn' con cada clave y valor de 'namespace', en orden
+	// de clave, leyéndolos de una vez (sin un Get por clave). Si 'fn'
+	// devuelve error, el recorrido para y ForEach lo devuelve. 'key' y
+	// 'value' sólo son válidos durante la llamada, y 'fn' no debe escribir
+	// en el Store (algunos motores recorren dentro de una transacción).
+	ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error
+
+	// Namespaces devuelve los nombres de todos los namespaces existentes,
+	// incluidos los anidados (con su ruta completa).
+	Namespaces(ctx context.Context) ([]string, error)
+
+	// NamespacesUnder devuelve, en orden y con su ruta completa, todos los
+	// namespaces que cuelgan (a cualquier profundidad) de 'parent'.
+	NamespacesUnder(ctx context.Context, parent string) ([]string, error)
+
+	// Batch ejecuta 'fn' en una transacción: o se aplican todas las
+	// escrituras que haga a través de 'tx', o (si devuelve error) ninguna.
+	// Algunos motores reintentan 'fn' si choca con otra transacción, así
+	// que no debe tener más efectos que los que pasan por 'tx'.
+	Batch(ctx context.Context, fn func(tx Tx) error) error
+
+	// Backup escribe en 'w' una copia consistente de toda la base de datos,
+	// que se puede abrir después con el mismo motor.
+	Backup(ctx context.Context, w io.Writer) error
 
 	// Close cierra cualquier recurso abierto (por ej. cerrar la base de datos).
 	Close() error
 
-	// Dump imprime todo el contenido de la base de datos para depuración de errores.
-	Dump() error
+	// Dump escribe en 'w' el contenido de la base de datos para depuración
+	// de errores, con los namespaces y valores que indique 'opts'.
+	Dump(ctx context.Context, w io.Writer, opts DumpOptions) error
+}
+
+// ErrNotFound es la causa de los errores de todos los motores cuando no
+// existe el namespace o la clave pedidos: se distinguen de los demás fallos
+// con errors.Is(err, store.ErrNotFound). El mensaje de cada error sigue
+// diciendo qué es lo que falta.
+var ErrNotFound = errors.New("no encontrado")
+
+// notFoundError es un error de namespace o clave inexistente.
+type notFoundError struct {
+	msg string
+}
+
+func (e notFoundError) Error() string { return e.msg }
+func (e notFoundError) Unwrap() error { return ErrNotFound }
+
+// errNoNamespace es el error de un namespace que no existe.
+func errNoNamespace(namespace string) error {
+	return notFoundError{"bucket no encontrado: " + namespace}
+}
+
+// errNoKey es el error de una clave que no existe (o ya ha caducado).
+func errNoKey(key []byte) error {
+	return notFoundError{"clave no encontrada: " + string(key)}
+}
+
+// exists implementa Exists con un Get: los motores no guardan aparte la
+// caducidad de las entradas (ni EncryptedStore puede verla sin descifrar),
+// así que hay que leer el valor para saber si sigue vivo.
+func exists(ctx context.Context, s Store, namespace string, key []byte) (bool, error) {
+	_, err := s.Get(ctx, namespace, key)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Restorer lo cumplen los Store que pueden sustituir su contenido por una
+// copia de Backup sin cerrarse (por ahora, sólo BboltStore). Los demás se
+// restauran parados, con Restore.
+type Restorer interface {
+	Restore(r io.Reader) error
+}
+
+// Snapshotter lo cumplen los Store que pueden fijar una vista de lectura
+// consistente de toda la base de datos (por ahora, sólo BboltStore; los
+// decoradores la piden al Store envuelto).
+type Snapshotter interface {
+	Snapshot() (Snapshot, error)
+}
+
+// Snapshot es una vista de sólo lectura del Store tal y como estaba al
+// crearla: lo que se escriba después no se ve, así que una exportación o un
+// informe que lea varios namespaces los ve todos del mismo momento. Mientras
+// no se libere con Release, el motor no puede reutilizar las páginas que
+// ella ve (el fichero crece), y Restore, Compact y Close esperan a que
+// termine; con bbolt, también las escrituras que tengan que agrandar el
+// fichero, así que quien tiene una abierta no debe escribir en el Store.
+// Una vez liberada, sus métodos devuelven ErrSnapshotReleased.
+type Snapshot interface {
+	// Get es como Store.Get sobre la vista.
+	Get(ctx context.Context, namespace string, key []byte) ([]byte, error)
+
+	// ForEach es como Store.ForEach sobre la vista.
+	ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error
+
+	// Namespaces es como Store.Namespaces sobre la vista.
+	Namespaces(ctx context.Context) ([]string, error)
+
+	// Release libera la vista. Se puede llamar más de una vez.
+	Release() error
+}
+
+// ErrSnapshotReleased es el error de usar una Snapshot ya liberada.
+var ErrSnapshotReleased = errors.New("la instantánea ya se ha liberado")
+
+// errNoSnapshots es el error de Snapshot en los decoradores cuando el motor
+// envuelto no las permite.
+var errNoSnapshots = errors.New("el motor de almacenamiento no permite instantáneas")
+
+// snapshotOf pide una Snapshot a 's', si la permite (para los decoradores).
+func snapshotOf(s Store) (Snapshot, error) {
+	ss, ok := s.(Snapshotter)
+	if !ok {
+		return nil, errNoSnapshots
+	}
+	return ss.Snapshot()
+}
+
+// namespaceReader es lo que tienen en común un Store y una Snapshot para
+// recorrer la base de datos entera.
+type namespaceReader interface {
+	Namespaces(ctx context.Context) ([]string, error)
+	ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error
+}
+
+// DumpOptions elige qué muestra Dump. En las dos listas, un namespace
+// incluye también los anidados bajo él.
+type DumpOptions struct {
+	// Namespaces limita el volcado a estos namespaces (vacío: todos).
+	Namespaces []string
+	// Redact son los namespaces con datos sensibles (credenciales,
+	// sesiones...): de sus valores sólo se muestra el tamaño.
+	Redact []string
+}
+
+// dump implementa Dump para todos los motores: 'scan' es el recorrido
+// del motor (ForEach, o su versión sin filtrar lo caducado).
+func dump(ctx context.Context, s namespaceReader, scan func(ctx context.Context, namespace string, fn func(key, value []byte) error) error, w io.Writer, opts DumpOptions) error {
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		return fmt.Errorf("error al hacer el volcado de depuración: %v", err)
+	}
+	for _, ns := range names {
+		if len(opts.Namespaces) > 0 && !inNamespaces(ns, opts.Namespaces) {
+			continue
+		}
+		redact := inNamespaces(ns, opts.Redact)
+		fmt.Fprintf(w, "Bucket: %s\n", ns)
+		err := scan(ctx, ns, func(k, v []byte) error {
+			if redact {
+				_, err := fmt.Fprintf(w, "  Key: %s, Value: [oculto, %d bytes]\n", string(k), len(v))
+				return err
+			}
+			_, err := fmt.Fprintf(w, "  Key: %s, Value: %s\n", string(k), string(v))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error al hacer el volcado de depuración: %v", err)
+		}
+	}
+	return nil
+}
+
+// inNamespaces indica si 'namespace' es uno de 'list' o cuelga de alguno.
+func inNamespaces(namespace string, list []string) bool {
+	for _, ns := range list {
+		if namespace == ns || strings.HasPrefix(namespace, ns+NamespaceSep) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compacter lo cumplen los Store cuyo fichero no encoge al borrar (por
+// ahora, sólo BboltStore): Compact lo reescribe sin el espacio libre y
+// devuelve el tamaño de antes y el de después.
+type Compacter interface {
+	Compact() (before, after int64, err error)
+}
+
+// NamespaceSep separa los niveles de un namespace jerárquico, como en
+// "users/esther/messages". Escribir en un namespace crea también los de
+// encima ("users" y "users/esther"), que pueden tener sus propias claves.
+// En bbolt cada nivel es un bucket anidado; en los demás motores, un
+// namespace más cuyo nombre lleva la ruta.
+const NamespaceSep = "/"
+
+// namespaceChain devuelve 'namespace' precedido de sus antecesores ("a",
+// "a/b", "a/b/c"), o un error si algún nivel está vacío.
+func namespaceChain(namespace string) ([]string, error) {
+	parts := strings.Split(namespace, NamespaceSep)
+	chain := make([]string, len(parts))
+	for i, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("namespace no válido: %q", namespace)
+		}
+		chain[i] = strings.Join(parts[:i+1], NamespaceSep)
+	}
+	return chain, nil
+}
+
+// namespacesUnder resuelve NamespacesUnder sobre la lista de todos los
+// namespaces, para los motores sin anidamiento real.
+func namespacesUnder(names []string, parent string) ([]string, error) {
+	found := false
+	var under []string
+	for _, ns := range names {
+		if ns == parent {
+			found = true
+		} else if strings.HasPrefix(ns, parent+NamespaceSep) {
+			under = append(under, ns)
+		}
+	}
+	if !found {
+		return nil, errNoNamespace(parent)
+	}
+	sort.Strings(under)
+	return under, nil
+}
+
+// Tx es la vista de un Store dentro de Batch. Sus métodos se comportan
+// como los del Store (mismos errores), pero las escrituras no son visibles
+// fuera hasta que Batch termina bien, y usan el contexto de Batch. Con
+// AsTx, una función que reciba un Tx sirve también fuera de una
+// transacción.
+type Tx interface {
+	Put(namespace string, key, value []byte) error
+	Get(namespace string, key []byte) ([]byte, error)
+	Delete(namespace string, key []byte) error
+}
+
+// AsTx presenta 's' como un Tx cuyas operaciones van directamente al Store
+// con el contexto 'ctx' (cada una por separado, sin transacción).
+func AsTx(ctx context.Context, s Store) Tx {
+	return storeTx{ctx, s}
+}
+
+// storeTx es el Tx de AsTx.
+type storeTx struct {
+	ctx context.Context
+	s   Store
+}
+
+func (t storeTx) Put(namespace string, key, value []byte) error {
+	return t.s.Put(t.ctx, namespace, key, value)
+}
+
+func (t storeTx) Get(namespace string, key []byte) ([]byte, error) {
+	return t.s.Get(t.ctx, namespace, key)
+}
+
+func (t storeTx) Delete(namespace string, key []byte) error {
+	return t.s.Delete(t.ctx, namespace, key)
+}
+
+// scanCheckEvery es cada cuántas entradas miran los recorridos si se ha
+// cancelado su contexto (mirarlo en cada una cuesta más que leerla).
+const scanCheckEvery = 256
+
+// ctxSteps cuenta los pasos de un recorrido para mirar su contexto cada
+// scanCheckEvery.
+type ctxSteps struct {
+	ctx context.Context
+	n   int
+}
+
+// step devuelve el error del contexto si toca mirarlo y se ha cancelado.
+func (c *ctxSteps) step() error {
+	c.n++
+	if c.n%scanCheckEvery != 0 {
+		return nil
+	}
+	return c.ctx.Err()
+}
+
+// withContext envuelve la función de un recorrido para que pare con el
+// error de 'ctx' si se cancela a medias.
+func withContext(ctx context.Context, fn func(key, value []byte) error) func(key, value []byte) error {
+	steps := ctxSteps{ctx: ctx}
+	return func(key, value []byte) error {
+		if err := steps.step(); err != nil {
+			return err
+		}
+		return fn(key, value)
+	}
+}
+
+// ctxWriter corta con el error de 'ctx' las copias que escriben en 'w' en
+// cuanto se cancela.
+type ctxWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (c ctxWriter) Write(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.w.Write(p)
+}
+
+// checkLimit rechaza tamaños de página que no tienen sentido.
+func checkLimit(limit int) error {
+	if limit <= 0 {
+		return fmt.Errorf("tamaño de página no válido: %d", limit)
+	}
+	return nil
+}
+
+// cutPage recibe hasta limit+1 claves (pedir una de más es la forma barata
+// de saber si hay otra página) y devuelve las de la página y el cursor.
+func cutPage(keys [][]byte, limit int) ([][]byte, []byte) {
+	if len(keys) <= limit {
+		return keys, nil
+	}
+	keys = keys[:limit]
+	return keys, bytes.Clone(keys[limit-1])
+}
+
+// rangeEntries acumula las entradas de un GetRange.
+type rangeEntries struct {
+	namespace string
+	end       []byte
+	limit     int
+	now       time.Time
+	list      []Entry
+}
+
+func newRangeEntries(namespace string, end []byte, limit int) *rangeEntries {
+	return &rangeEntries{namespace: namespace, end: end, limit: limit, now: time.Now()}
+}
+
+// past indica si 'key' ya queda fuera del rango por arriba.
+func (r *rangeEntries) past(key []byte) bool {
+	return r.end != nil && bytes.Compare(key, r.end) >= 0
+}
+
+// add añade 'key' con su valor (sin la cabecera de caducidad; si ha
+// caducado, no lo añade) y devuelve false cuando hay que parar: 'key' ya
+// está fuera del rango o la lista está completa.
+func (r *rangeEntries) add(key, raw []byte) bool {
+	if r.past(key) {
+		return false
+	}
+	if value, live := unwrapTTL(raw, r.now); live {
+		r.list = append(r.list, Entry{r.namespace, bytes.Clone(key), bytes.Clone(value)})
+	}
+	return len(r.list) < r.limit
+}
+
+// pageStart es la primera clave que puede entrar en una página: la mayor
+// entre 'prefix' y 'after', y si es 'after', hay que saltársela.
+func pageStart(prefix, after []byte) (start []byte, skip bool) {
+	if after != nil && bytes.Compare(after, prefix) >= 0 {
+		return after, true
+	}
+	return prefix, false
 }
 
 // NewStore permite instanciar diferentes tipos de Store
-// dependiendo del motor solicitado (sólo se soporta "bbolt").
+// dependiendo del motor solicitado ("bbolt", "sqlite", "badger", "leveldb",
+// "redis", "s3" o "json"). Con Badger, LevelDB y JSON, 'path' es un
+// directorio; con Redis y S3, una URL (ver NewRedisStore y NewS3Store).
 func NewStore(engine, path string) (Store, error) {
 	switch engine {
 	case "bbolt":
 		return NewBboltStore(path)
+	case "sqlite":
+		return NewSQLiteStore(path)
+	case "badger":
+		return NewBadgerStore(path)
+	case "leveldb":
+		return NewLevelDBStore(path)
+	case "redis":
+		return NewRedisStore(path)
+	case "s3":
+		return NewS3Store(path)
+	case "json":
+		return NewJSONStore(path)
 	default:
 		return nil, fmt.Errorf("motor de almacenamiento desconocido: %s", engine)
 	}
 }
+
+// Restore crea en 'path', que no debe existir, la base de datos de la copia
+// que 'r' trae (escrita por Backup con el mismo motor). En bbolt y SQLite la
+// copia es el propio fichero; en los demás hay que cargarla.
+func Restore(engine string, r io.Reader, path string) error {
+	switch engine {
+	case "badger":
+		return loadBadger(r, path)
+	case "leveldb":
+		return loadLevelDB(r, path)
+	case "redis":
+		return loadRedis(r, path)
+	case "s3":
+		return loadS3(r, path)
+	case "json":
+		return loadJSON(r, path)
+	}
+	out, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return fmt.Errorf("error creando %s: %v", path, err)
+	}
+	_, err = io.Copy(out, r)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,542 @@
+// El paquete storetest comprueba que una implementación de store.Store se
+// comporta como dice la interfaz: lo que cualquier código que la use puede
+// dar por hecho, sea cual sea el motor. Un motor nuevo (o un decorador)
+// demuestra que cumple llamando a RunConformanceTests desde sus pruebas:
+//
+//	func TestConformance(t *testing.T) {
+//		storetest.RunConformanceTests(t, func(t *testing.T) store.Store {
+//			s, err := store.NewBboltStore(filepath.Join(t.TempDir(), "db"))
+//			if err != nil {
+//				t.Fatal(err)
+//			}
+//			return s
+//		})
+//	}
+//
+// Un EncryptedStore con claves cifradas (EncryptedOptions.EncryptKeys)
+// renuncia a propósito al orden de los listados: se prueba con
+// RunConformanceTestsWith y Options.Unordered.
+package storetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"prac/pkg/store"
+)
+
+// Factory crea un Store vacío para una prueba. RunConformanceTests lo
+// cierra al terminar; si hace falta borrar algo más (un directorio, una
+// base de datos de Redis), se registra con t.Cleanup.
+type Factory func(t *testing.T) store.Store
+
+// Options ajusta las comprobaciones a un Store que no cumple toda la
+// interfaz a propósito.
+type Options struct {
+	// Unordered: ListKeys, KeysByPrefix, sus versiones paginadas y ForEach
+	// devuelven las claves en cualquier orden (EncryptKeys). Se comprueba
+	// que sean las que tocan, pero no su orden. GetRange y LastN, que sí
+	// lo prometen siempre, se siguen comprobando en orden.
+	Unordered bool
+}
+
+// RunConformanceTests ejecuta, cada una como subprueba y con un Store
+// nuevo de 'factory', las comprobaciones de la semántica de Put, Get,
+// Delete, prefijos, paginación, rangos, namespaces anidados, Batch y
+// caducidad.
+func RunConformanceTests(t *testing.T, factory Factory) {
+	RunConformanceTestsWith(t, factory, Options{})
+}
+
+// RunConformanceTestsWith es RunConformanceTests con las excepciones de
+// 'opts'.
+func RunConformanceTestsWith(t *testing.T, factory Factory, opts Options) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s store.Store, o Options)
+	}{
+		{"PutGet", testPutGet},
+		{"NotFound", testNotFound},
+		{"Delete", testDelete},
+		{"ListKeys", testListKeys},
+		{"KeysByPrefix", testKeysByPrefix},
+		{"DeleteByPrefix", testDeleteByPrefix},
+		{"Pagination", testPagination},
+		{"GetRange", testGetRange},
+		{"LastN", testLastN},
+		{"ForEach", testForEach},
+		{"Namespaces", testNamespaces},
+		{"Batch", testBatch},
+		{"TTL", testTTL},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := factory(t)
+			t.Cleanup(func() {
+				if err := s.Close(); err != nil {
+					t.Errorf("Close: %v", err)
+				}
+			})
+			tc.fn(t, s, opts)
+		})
+	}
+}
+
+// key genera claves "k000", "k001"... que se ordenan igual que 'i'.
+func key(prefix string, i int) []byte {
+	return []byte(fmt.Sprintf("%s%03d", prefix, i))
+}
+
+// mustPut escribe o hace fallar la prueba.
+func mustPut(t *testing.T, s store.Store, namespace string, k, v []byte) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.Put(ctx, namespace, k, v); err != nil {
+		t.Fatalf("Put(%q, %q): %v", namespace, k, err)
+	}
+}
+
+// fill escribe en 'namespace' las claves key(prefix, 0..n-1), con su
+// propia clave como valor.
+func fill(t *testing.T, s store.Store, namespace, prefix string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		mustPut(t, s, namespace, key(prefix, i), key(prefix, i))
+	}
+}
+
+// wantKeys compara una lista de claves con la esperada.
+func wantKeys(t *testing.T, what string, got, want [][]byte) {
+	t.Helper()
+	if !slices.EqualFunc(got, want, bytes.Equal) {
+		t.Errorf("%s = %q, se esperaba %q", what, got, want)
+	}
+}
+
+// wantList es wantKeys para los listados que Options.Unordered deja sin
+// orden.
+func (o Options) wantList(t *testing.T, what string, got, want [][]byte) {
+	t.Helper()
+	if o.Unordered {
+		got = slices.SortedFunc(slices.Values(got), bytes.Compare)
+		want = slices.SortedFunc(slices.Values(want), bytes.Compare)
+	}
+	wantKeys(t, what, got, want)
+}
+
+// keyRange devuelve key(prefix, from..to-1).
+func keyRange(prefix string, from, to int) [][]byte {
+	var keys [][]byte
+	for i := from; i < to; i++ {
+		keys = append(keys, key(prefix, i))
+	}
+	return keys
+}
+
+// entryKeys devuelve las claves de 'entries', comprobando que cada valor
+// es el que escribe fill.
+func entryKeys(t *testing.T, entries []store.Entry) [][]byte {
+	t.Helper()
+	var keys [][]byte
+	for _, e := range entries {
+		if !bytes.Equal(e.Key, e.Value) {
+			t.Errorf("entrada %q con valor %q", e.Key, e.Value)
+		}
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+func testPutGet(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	mustPut(t, s, "ns", []byte("a"), []byte("uno"))
+	got, err := s.Get(ctx, "ns", []byte("a"))
+	if err != nil || string(got) != "uno" {
+		t.Fatalf("Get = %q, %v; se esperaba \"uno\"", got, err)
+	}
+
+	// Sobrescribir, y que lo devuelto no quede ligado al motor
+	mustPut(t, s, "ns", []byte("a"), []byte("dos"))
+	got, _ = s.Get(ctx, "ns", []byte("a"))
+	if string(got) != "dos" {
+		t.Fatalf("Get tras sobrescribir = %q, se esperaba \"dos\"", got)
+	}
+	got[0] = 'X'
+	if again, _ := s.Get(ctx, "ns", []byte("a")); string(again) != "dos" {
+		t.Errorf("modificar lo devuelto por Get cambia el valor guardado: %q", again)
+	}
+
+	// Un valor vacío existe y es distinto de no tener valor
+	mustPut(t, s, "ns", []byte("vacío"), []byte{})
+	if got, err := s.Get(ctx, "ns", []byte("vacío")); err != nil || len(got) != 0 {
+		t.Errorf("Get de un valor vacío = %q, %v", got, err)
+	}
+	if ok, err := s.Exists(ctx, "ns", []byte("vacío")); err != nil || !ok {
+		t.Errorf("Exists de un valor vacío = %v, %v", ok, err)
+	}
+
+	// Claves y valores binarios pasan sin cambios
+	bin := []byte{0, 1, 0xff, '/', 0}
+	mustPut(t, s, "ns", bin, bin)
+	if got, err := s.Get(ctx, "ns", bin); err != nil || !bytes.Equal(got, bin) {
+		t.Errorf("Get de una clave binaria = %x, %v", got, err)
+	}
+}
+
+func testNotFound(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	if _, err := s.Get(ctx, "nada", []byte("a")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get en un namespace que no existe: %v, se esperaba ErrNotFound", err)
+	}
+	if ok, err := s.Exists(ctx, "nada", []byte("a")); err != nil || ok {
+		t.Errorf("Exists en un namespace que no existe = %v, %v", ok, err)
+	}
+	if _, err := s.ListKeys(ctx, "nada"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("ListKeys de un namespace que no existe: %v, se esperaba ErrNotFound", err)
+	}
+
+	mustPut(t, s, "ns", []byte("a"), []byte("1"))
+	if _, err := s.Get(ctx, "ns", []byte("b")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get de una clave que no existe: %v, se esperaba ErrNotFound", err)
+	}
+	if ok, err := s.Exists(ctx, "ns", []byte("b")); err != nil || ok {
+		t.Errorf("Exists de una clave que no existe = %v, %v", ok, err)
+	}
+}
+
+func testDelete(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	mustPut(t, s, "ns", []byte("a"), []byte("1"))
+	mustPut(t, s, "ns", []byte("b"), []byte("2"))
+	if err := s.Delete(ctx, "ns", []byte("a")); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, "ns", []byte("a")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get tras Delete: %v, se esperaba ErrNotFound", err)
+	}
+	if ok, _ := s.Exists(ctx, "ns", []byte("a")); ok {
+		t.Error("Exists tras Delete = true")
+	}
+	if got, err := s.Get(ctx, "ns", []byte("b")); err != nil || string(got) != "2" {
+		t.Errorf("Delete ha tocado otra clave: %q, %v", got, err)
+	}
+	if err := s.Delete(ctx, "nada", []byte("a")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Delete en un namespace que no existe: %v, se esperaba ErrNotFound", err)
+	}
+}
+
+func testListKeys(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	// Se escriben desordenadas: se listan en orden de bytes
+	for _, i := range []int{3, 0, 4, 1, 2} {
+		mustPut(t, s, "ns", key("k", i), []byte("v"))
+	}
+	mustPut(t, s, "ns/hijo", []byte("h"), []byte("v"))
+
+	keys, err := s.ListKeys(ctx, "ns")
+	if err != nil {
+		t.Fatalf("ListKeys: %v", err)
+	}
+	o.wantList(t, "ListKeys", keys, keyRange("k", 0, 5))
+	if n, err := s.CountKeys(ctx, "ns"); err != nil || n != 5 {
+		t.Errorf("CountKeys = %d, %v; se esperaba 5 (sin los namespaces anidados)", n, err)
+	}
+}
+
+func testKeysByPrefix(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	fill(t, s, "ns", "a", 3)
+	fill(t, s, "ns", "b", 4)
+	mustPut(t, s, "ns", []byte("c"), []byte("v"))
+
+	keys, err := s.KeysByPrefix(ctx, "ns", []byte("b"))
+	if err != nil {
+		t.Fatalf("KeysByPrefix: %v", err)
+	}
+	o.wantList(t, "KeysByPrefix(b)", keys, keyRange("b", 0, 4))
+	if keys, err := s.KeysByPrefix(ctx, "ns", []byte("z")); err != nil || len(keys) != 0 {
+		t.Errorf("KeysByPrefix sin coincidencias = %q, %v", keys, err)
+	}
+	if keys, _ := s.KeysByPrefix(ctx, "ns", nil); len(keys) != 8 {
+		t.Errorf("KeysByPrefix(nil) = %d claves, se esperaban 8", len(keys))
+	}
+}
+
+func testDeleteByPrefix(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	fill(t, s, "ns", "a", 3)
+	fill(t, s, "ns", "b", 4)
+	n, err := s.DeleteByPrefix(ctx, "ns", []byte("a"))
+	if err != nil || n != 3 {
+		t.Fatalf("DeleteByPrefix = %d, %v; se esperaba 3", n, err)
+	}
+	keys, _ := s.ListKeys(ctx, "ns")
+	o.wantList(t, "ListKeys tras DeleteByPrefix", keys, keyRange("b", 0, 4))
+	if n, err := s.DeleteByPrefix(ctx, "ns", []byte("a")); err != nil || n != 0 {
+		t.Errorf("DeleteByPrefix sin coincidencias = %d, %v", n, err)
+	}
+}
+
+func testPagination(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	fill(t, s, "ns", "k", 25)
+	fill(t, s, "ns", "p", 7)
+
+	// Todas las claves, de 10 en 10: la última página trae next == nil
+	var all [][]byte
+	var cursor []byte
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("ListKeysPage no termina")
+		}
+		keys, next, err := s.ListKeysPage(ctx, "ns", cursor, 10)
+		if err != nil {
+			t.Fatalf("ListKeysPage: %v", err)
+		}
+		if len(keys) > 10 {
+			t.Fatalf("ListKeysPage devuelve %d claves con limit 10", len(keys))
+		}
+		all = append(all, keys...)
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	o.wantList(t, "ListKeysPage", all, append(keyRange("k", 0, 25), keyRange("p", 0, 7)...))
+
+	// Con prefijo, en páginas exactas: la última no deja cursor colgando
+	all, cursor = nil, nil
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatal("KeysByPrefixPage no termina")
+		}
+		keys, next, err := s.KeysByPrefixPage(ctx, "ns", []byte("k"), cursor, 5)
+		if err != nil {
+			t.Fatalf("KeysByPrefixPage: %v", err)
+		}
+		all = append(all, keys...)
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	o.wantList(t, "KeysByPrefixPage", all, keyRange("k", 0, 25))
+
+	if _, _, err := s.ListKeysPage(ctx, "ns", nil, 0); err == nil {
+		t.Error("ListKeysPage con limit 0 no devuelve error")
+	}
+}
+
+func testGetRange(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	fill(t, s, "ns", "k", 10)
+
+	got, err := s.GetRange(ctx, "ns", key("k", 2), key("k", 6), 100)
+	if err != nil {
+		t.Fatalf("GetRange: %v", err)
+	}
+	wantKeys(t, "GetRange [2, 6)", entryKeys(t, got), keyRange("k", 2, 6))
+
+	got, _ = s.GetRange(ctx, "ns", nil, nil, 3)
+	wantKeys(t, "GetRange con limit 3", entryKeys(t, got), keyRange("k", 0, 3))
+
+	// Seguir por donde se quedó: la última clave más un 0x00
+	next := append(bytes.Clone(got[len(got)-1].Key), 0)
+	got, _ = s.GetRange(ctx, "ns", next, nil, 100)
+	wantKeys(t, "GetRange desde la última + 0x00", entryKeys(t, got), keyRange("k", 3, 10))
+
+	if got, err := s.GetRange(ctx, "ns", []byte("z"), nil, 10); err != nil || len(got) != 0 {
+		t.Errorf("GetRange vacío = %d entradas, %v", len(got), err)
+	}
+}
+
+func testLastN(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	fill(t, s, "ns", "a", 5)
+	fill(t, s, "ns", "b", 5)
+
+	got, err := s.LastN(ctx, "ns", []byte("a"), 3)
+	if err != nil {
+		t.Fatalf("LastN: %v", err)
+	}
+	wantKeys(t, "LastN(a, 3)", entryKeys(t, got), [][]byte{key("a", 4), key("a", 3), key("a", 2)})
+
+	got, _ = s.LastN(ctx, "ns", nil, 2)
+	wantKeys(t, "LastN(nil, 2)", entryKeys(t, got), [][]byte{key("b", 4), key("b", 3)})
+
+	got, _ = s.LastN(ctx, "ns", []byte("b"), 100)
+	if len(got) != 5 {
+		t.Errorf("LastN con n mayor que el namespace = %d entradas, se esperaban 5", len(got))
+	}
+}
+
+func testForEach(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	fill(t, s, "ns", "k", 5)
+	mustPut(t, s, "ns/hijo", []byte("h"), []byte("v"))
+
+	var keys [][]byte
+	err := s.ForEach(ctx, "ns", func(k, v []byte) error {
+		if !bytes.Equal(k, v) {
+			t.Errorf("ForEach: %q con valor %q", k, v)
+		}
+		keys = append(keys, bytes.Clone(k))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEach: %v", err)
+	}
+	o.wantList(t, "ForEach", keys, keyRange("k", 0, 5))
+
+	// El error de 'fn' para el recorrido y es el que se devuelve
+	stop := errors.New("basta")
+	calls := 0
+	err = s.ForEach(ctx, "ns", func(k, v []byte) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("ForEach con error = %v tras %d llamadas; se esperaba el de fn tras 1", err, calls)
+	}
+}
+
+func testNamespaces(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	mustPut(t, s, "a/b/c", []byte("k"), []byte("v"))
+	mustPut(t, s, "a", []byte("k"), []byte("v"))
+	mustPut(t, s, "a-x", []byte("k"), []byte("v"))
+
+	names, err := s.Namespaces(ctx)
+	if err != nil {
+		t.Fatalf("Namespaces: %v", err)
+	}
+	for _, want := range []string{"a", "a-x", "a/b", "a/b/c"} {
+		if !slices.Contains(names, want) {
+			t.Errorf("Namespaces = %q, falta %q", names, want)
+		}
+	}
+	if !slices.IsSorted(names) {
+		t.Errorf("Namespaces = %q, no están en orden", names)
+	}
+
+	under, err := s.NamespacesUnder(ctx, "a")
+	if err != nil {
+		t.Fatalf("NamespacesUnder: %v", err)
+	}
+	if !slices.Equal(under, []string{"a/b", "a/b/c"}) {
+		t.Errorf("NamespacesUnder(a) = %q, se esperaba [a/b a/b/c]", under)
+	}
+
+	// Borrar un namespace se lleva los anidados, no los de encima
+	if err := s.DeleteNamespace(ctx, "a/b"); err != nil {
+		t.Fatalf("DeleteNamespace: %v", err)
+	}
+	if _, err := s.Get(ctx, "a/b/c", []byte("k")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get en un namespace anidado borrado: %v, se esperaba ErrNotFound", err)
+	}
+	if _, err := s.Get(ctx, "a", []byte("k")); err != nil {
+		t.Errorf("DeleteNamespace ha borrado el namespace de encima: %v", err)
+	}
+	if err := s.DeleteNamespace(ctx, "nada"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("DeleteNamespace de un namespace que no existe: %v, se esperaba ErrNotFound", err)
+	}
+}
+
+func testBatch(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	mustPut(t, s, "ns", []byte("a"), []byte("1"))
+
+	// Si 'fn' falla, no se aplica ninguna escritura
+	fail := errors.New("fallo")
+	err := s.Batch(ctx, func(tx store.Tx) error {
+		if err := tx.Put("ns", []byte("b"), []byte("2")); err != nil {
+			return err
+		}
+		if err := tx.Delete("ns", []byte("a")); err != nil {
+			return err
+		}
+		return fail
+	})
+	if !errors.Is(err, fail) {
+		t.Errorf("Batch devuelve %v, se esperaba el error de fn", err)
+	}
+	if ok, _ := s.Exists(ctx, "ns", []byte("b")); ok {
+		t.Error("un Batch fallido ha aplicado un Put")
+	}
+	if ok, _ := s.Exists(ctx, "ns", []byte("a")); !ok {
+		t.Error("un Batch fallido ha aplicado un Delete")
+	}
+
+	// Si termina bien se aplica todo, y dentro se ven las propias escrituras
+	err = s.Batch(ctx, func(tx store.Tx) error {
+		if err := tx.Put("ns", []byte("b"), []byte("2")); err != nil {
+			return err
+		}
+		got, err := tx.Get("ns", []byte("b"))
+		if err != nil || string(got) != "2" {
+			return fmt.Errorf("Get dentro del Batch = %q, %v", got, err)
+		}
+		return tx.Delete("ns", []byte("a"))
+	})
+	if err != nil {
+		t.Fatalf("Batch: %v", err)
+	}
+	if got, err := s.Get(ctx, "ns", []byte("b")); err != nil || string(got) != "2" {
+		t.Errorf("Get tras Batch = %q, %v", got, err)
+	}
+	if ok, _ := s.Exists(ctx, "ns", []byte("a")); ok {
+		t.Error("Batch no ha aplicado el Delete")
+	}
+}
+
+func testTTL(t *testing.T, s store.Store, o Options) {
+	ctx := context.Background()
+	if err := s.PutWithTTL(ctx, "ns", []byte("corta"), []byte("v"), 50*time.Millisecond); err != nil {
+		t.Fatalf("PutWithTTL: %v", err)
+	}
+	if err := s.PutWithTTL(ctx, "ns", []byte("larga"), []byte("v"), time.Hour); err != nil {
+		t.Fatalf("PutWithTTL: %v", err)
+	}
+	if err := s.PutWithTTL(ctx, "ns", []byte("renovada"), []byte("v"), 50*time.Millisecond); err != nil {
+		t.Fatalf("PutWithTTL: %v", err)
+	}
+	mustPut(t, s, "ns", []byte("renovada"), []byte("sin caducidad"))
+
+	if got, err := s.Get(ctx, "ns", []byte("corta")); err != nil || string(got) != "v" {
+		t.Fatalf("Get antes de caducar = %q, %v", got, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := s.Get(ctx, "ns", []byte("corta")); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Get de una entrada caducada: %v, se esperaba ErrNotFound", err)
+	}
+	if ok, _ := s.Exists(ctx, "ns", []byte("corta")); ok {
+		t.Error("Exists de una entrada caducada = true")
+	}
+	if got, err := s.Get(ctx, "ns", []byte("larga")); err != nil || string(got) != "v" {
+		t.Errorf("Get de una entrada sin caducar = %q, %v", got, err)
+	}
+	if got, err := s.Get(ctx, "ns", []byte("renovada")); err != nil || string(got) != "sin caducidad" {
+		t.Errorf("un Put no quita la caducidad anterior: %q, %v", got, err)
+	}
+	var seen [][]byte
+	s.ForEach(ctx, "ns", func(k, v []byte) error {
+		seen = append(seen, bytes.Clone(k))
+		return nil
+	})
+	o.wantList(t, "ForEach sin lo caducado", seen, [][]byte{[]byte("larga"), []byte("renovada")})
+
+	// Cuenta las entradas del índice (también la de la renovada), pero sólo
+	// borra la caducada
+	n, err := store.SweepExpired(ctx, s, time.Now())
+	if err != nil || n != 2 {
+		t.Errorf("SweepExpired = %d, %v; se esperaba 2", n, err)
+	}
+	keys, _ := s.ListKeys(ctx, "ns")
+	o.wantList(t, "ListKeys tras SweepExpired", keys, [][]byte{[]byte("larga"), []byte("renovada")})
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+/*
+	Caducidad de entradas (PutWithTTL) y barrido de las caducadas, común a
+	todos los motores
+*/
+
+// ttlHeader marca los valores con caducidad, que se guardan como
+// ttlHeader || caducidad (UnixNano, 8 bytes big-endian) || valor. Empieza
+// por 0x00 para no confundirse con los valores normales (JSON, texto o
+// sobres cifrados).
+var ttlHeader = []byte("\x00prac-ttl\x00")
+
+// ttlNamespace es el índice de caducidades: una clave vacía por entrada,
+// caducidad (8 bytes) || namespace || 0x00 || clave. Como las claves se
+// ordenan por caducidad, el barrido sólo lee las que ya han vencido.
+const ttlNamespace = "_ttl"
+
+// sweepPageSize es cuántas entradas del índice lee SweepExpired de cada vez.
+const sweepPageSize = 256
+
+// wrapTTL añade a 'value' la cabecera de caducidad 'exp'.
+func wrapTTL(value []byte, exp time.Time) []byte {
+	out := make([]byte, 0, len(ttlHeader)+8+len(value))
+	out = append(out, ttlHeader...)
+	out = binary.BigEndian.AppendUint64(out, uint64(exp.UnixNano()))
+	return append(out, value...)
+}
+
+// unwrapTTL quita la cabecera de caducidad de 'raw', si la tiene. 'live' es
+// false si ya ha caducado en 'now'.
+func unwrapTTL(raw []byte, now time.Time) (value []byte, live bool) {
+	if !bytes.HasPrefix(raw, ttlHeader) || len(raw) < len(ttlHeader)+8 {
+		return raw, true
+	}
+	exp := int64(binary.BigEndian.Uint64(raw[len(ttlHeader):]))
+	return raw[len(ttlHeader)+8:], now.UnixNano() < exp
+}
+
+// liveValue es la última parte de un Get: devuelve 'raw' sin la cabecera de
+// caducidad, o el error de clave no encontrada si ya ha caducado (aunque el
+// barrido aún no la haya borrado).
+func liveValue(key, raw []byte) ([]byte, error) {
+	value, live := unwrapTTL(raw, time.Now())
+	if !live {
+		return nil, errNoKey(key)
+	}
+	return value, nil
+}
+
+// liveEntries adapta la función de un ForEach para que se salte las
+// entradas caducadas y no vea la cabecera de las demás.
+func liveEntries(fn func(key, value []byte) error) func(key, value []byte) error {
+	now := time.Now()
+	return func(key, raw []byte) error {
+		value, live := unwrapTTL(raw, now)
+		if !live {
+			return nil
+		}
+		return fn(key, value)
+	}
+}
+
+// ttlIndexKey construye la clave del índice de caducidades.
+func ttlIndexKey(exp time.Time, namespace string, key []byte) []byte {
+	k := make([]byte, 0, 8+len(namespace)+1+len(key))
+	k = binary.BigEndian.AppendUint64(k, uint64(exp.UnixNano()))
+	k = append(k, namespace...)
+	k = append(k, 0)
+	return append(k, key...)
+}
+
+// parseTTLIndexKey es la inversa de ttlIndexKey.
+func parseTTLIndexKey(k []byte) (exp time.Time, namespace string, key []byte, ok bool) {
+	if len(k) < 9 {
+		return time.Time{}, "", nil, false
+	}
+	i := bytes.IndexByte(k[8:], 0)
+	if i < 0 {
+		return time.Time{}, "", nil, false
+	}
+	exp = time.Unix(0, int64(binary.BigEndian.Uint64(k)))
+	return exp, string(k[8 : 8+i]), k[8+i+1:], true
+}
+
+// putWithTTL guarda a través de 'tx' el valor con su cabecera y su entrada
+// en el índice. Es la implementación de PutWithTTL de todos los motores.
+func putWithTTL(tx Tx, namespace string, key, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("caducidad no válida: %v", ttl)
+	}
+	exp := time.Now().Add(ttl)
+	if err := tx.Put(namespace, key, wrapTTL(value, exp)); err != nil {
+		return err
+	}
+	return tx.Put(ttlNamespace, ttlIndexKey(exp, namespace, key), nil)
+}
+
+// SweepExpired borra de 's' las entradas que han caducado antes de 'now' y
+// devuelve cuántas entradas del índice ha retirado. Una clave que se haya
+// vuelto a escribir después (con Put o con otra caducidad) no se borra:
+// sólo se retira su entrada antigua del índice.
+func SweepExpired(ctx context.Context, s Store, now time.Time) (int, error) {
+	swept := 0
+	for {
+		// Siempre desde el principio: las ya tratadas se han borrado
+		keys, next, err := s.ListKeysPage(ctx, ttlNamespace, nil, sweepPageSize)
+		if errors.Is(err, ErrNotFound) {
+			return swept, nil
+		}
+		if err != nil {
+			return swept, err
+		}
+		for _, idx := range keys {
+			exp, ns, key, ok := parseTTLIndexKey(idx)
+			if ok && exp.After(now) {
+				return swept, nil
+			}
+			err := s.Batch(ctx, func(tx Tx) error {
+				if ok {
+					// Get ya no devuelve lo caducado: si lo encuentra es
+					// que se ha reescrito y hay que conservarlo
+					_, err := tx.Get(ns, key)
+					if errors.Is(err, ErrNotFound) {
+						if err := tx.Delete(ns, key); err != nil && !errors.Is(err, ErrNotFound) {
+							return err
+						}
+					} else if err != nil {
+						return err
+					}
+				}
+				return tx.Delete(ttlNamespace, idx)
+			})
+			if err != nil {
+				return swept, fmt.Errorf("error borrando la entrada caducada %s/%s: %v", ns, string(key), err)
+			}
+			swept++
+		}
+		if next == nil {
+			return swept, nil
+		}
+	}
+}
+
+// StartSweeper lanza una goroutine que llama a SweepExpired sobre 's' cada
+// 'every'. Los errores se pasan a 'logf'. La función devuelta la para
+// (cancelando el barrido en curso) y espera a que termine, así que hay que
+// llamarla antes de cerrar 's'.
+func StartSweeper(s Store, every time.Duration, logf func(format string, args ...any)) (stop func()) {
+	return startEvery(every, func(ctx context.Context, now time.Time) {
+		if _, err := SweepExpired(ctx, s, now); err != nil && ctx.Err() == nil {
+			logf("error barriendo entradas caducadas: %v", err)
+		}
+	})
+}
+
+// startEvery lanza una goroutine que llama a 'task' cada 'every' hasta que
+// se llame a la función devuelta, que cancela el contexto de 'task' y
+// espera a que termine.
+func startEvery(every time.Duration, task func(ctx context.Context, now time.Time)) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-t.C:
+				task(ctx, now)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			cancel()
+			<-done
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+/*
+	Valores con historial de versiones (PutVersioned), común a todos los
+	motores, para poder consultar y recuperar las revisiones anteriores
+*/
+
+// historySuffix es el último nivel del namespace del historial de cada
+// namespace: el de "userdata" es "userdata/_history". Al estar anidado,
+// DeleteNamespace se lleva también el historial.
+const historySuffix = "_history"
+
+// historyLimit es cuántas versiones se guardan de cada clave, contando la
+// actual; al escribir una más se borra la más antigua.
+const historyLimit = 20
+
+// Las claves del historial son uvarint(len(clave)) || clave || subclave.
+// La longitud delante evita que las versiones de una clave se confundan
+// con las de otra que empiece igual. La subclave es el número de versión
+// (8 bytes big-endian) en las versiones y vacía en el contador, que guarda
+// la última versión escrita. El valor de cada versión es la hora en que se
+// escribió (UnixNano, 8 bytes big-endian; 0 si no se sabe) || valor.
+
+// Version describe una versión guardada por PutVersioned.
+type Version struct {
+	Number uint64
+	Time   time.Time // cero si el valor ya estaba antes de versionarse
+	Size   int
+}
+
+// historyNamespace devuelve el namespace del historial de 'namespace'.
+func historyNamespace(namespace string) string {
+	return namespace + NamespaceSep + historySuffix
+}
+
+// historyPrefix es el prefijo común a las claves del historial de 'key'
+// (y la clave de su contador).
+func historyPrefix(key []byte) []byte {
+	p := binary.AppendUvarint(nil, uint64(len(key)))
+	return append(p, key...)
+}
+
+// historyKey es la clave de la versión 'n' de 'key'.
+func historyKey(key []byte, n uint64) []byte {
+	return binary.BigEndian.AppendUint64(historyPrefix(key), n)
+}
+
+// putHistory guarda 'value' como la versión 'n' de 'key'.
+func putHistory(tx Tx, hist string, key []byte, n uint64, at time.Time, value []byte) error {
+	var ns int64
+	if !at.IsZero() {
+		ns = at.UnixNano()
+	}
+	raw := make([]byte, 0, 8+len(value))
+	raw = binary.BigEndian.AppendUint64(raw, uint64(ns))
+	raw = append(raw, value...)
+	return tx.Put(hist, historyKey(key, n), raw)
+}
+
+// parseHistory separa la hora y el valor de una versión.
+func parseHistory(raw []byte) (time.Time, []byte, error) {
+	if len(raw) < 8 {
+		return time.Time{}, nil, errors.New("versión mal formada")
+	}
+	var at time.Time
+	if ns := int64(binary.BigEndian.Uint64(raw)); ns != 0 {
+		at = time.Unix(0, ns)
+	}
+	return at, raw[8:], nil
+}
+
+// PutVersioned escribe 'value' en 'key' como Put y lo guarda como una
+// versión nueva en el historial, en el mismo Batch. Devuelve el número de
+// la versión.
+func PutVersioned(ctx context.Context, s Store, namespace string, key, value []byte) (uint64, error) {
+	var n uint64
+	err := s.Batch(ctx, func(tx Tx) error {
+		var err error
+		n, err = PutVersionedTx(tx, namespace, key, value)
+		return err
+	})
+	return n, err
+}
+
+// PutVersionedTx es PutVersioned dentro de un Batch del llamante. La
+// primera vez que se versiona una clave que ya existía, su valor se guarda
+// antes como versión 1 (sin hora), para que también se pueda recuperar.
+func PutVersionedTx(tx Tx, namespace string, key, value []byte) (uint64, error) {
+	hist := historyNamespace(namespace)
+	head := historyPrefix(key)
+	var last uint64
+	if raw, err := tx.Get(hist, head); err == nil {
+		if len(raw) != 8 {
+			return 0, fmt.Errorf("contador de versiones mal formado en %s", hist)
+		}
+		last = binary.BigEndian.Uint64(raw)
+	} else if !errors.Is(err, ErrNotFound) {
+		return 0, err
+	} else if prev, err := tx.Get(namespace, key); err == nil {
+		last = 1
+		if err := putHistory(tx, hist, key, last, time.Time{}, prev); err != nil {
+			return 0, err
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+
+	n := last + 1
+	if err := tx.Put(namespace, key, value); err != nil {
+		return 0, err
+	}
+	if err := putHistory(tx, hist, key, n, time.Now(), value); err != nil {
+		return 0, err
+	}
+	if err := tx.Put(hist, head, binary.BigEndian.AppendUint64(nil, n)); err != nil {
+		return 0, err
+	}
+	if n > historyLimit {
+		if err := tx.Delete(hist, historyKey(key, n-historyLimit)); err != nil && !errors.Is(err, ErrNotFound) {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+// DeleteVersionedTx borra, dentro de un Batch del llamante, 'key' de
+// 'namespace' con todo su historial: las versiones guardadas y el contador.
+// Que no exista (o que nunca se haya versionado) no es un error.
+func DeleteVersionedTx(tx Tx, namespace string, key []byte) error {
+	hist := historyNamespace(namespace)
+	head := historyPrefix(key)
+	raw, err := tx.Get(hist, head)
+	if err == nil {
+		if len(raw) != 8 {
+			return fmt.Errorf("contador de versiones mal formado en %s", hist)
+		}
+		last := binary.BigEndian.Uint64(raw)
+		first := uint64(1)
+		if last > historyLimit {
+			first = last - historyLimit + 1
+		}
+		for n := first; n <= last; n++ {
+			if err := tx.Delete(hist, historyKey(key, n)); err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+		if err := tx.Delete(hist, head); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err := tx.Delete(namespace, key); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+// GetVersion devuelve el valor de la versión 'n' de 'key' y la hora en que
+// se escribió. Si la versión no existe (o ya se ha descartado por
+// historyLimit), el error es ErrNotFound.
+func GetVersion(ctx context.Context, s Store, namespace string, key []byte, n uint64) ([]byte, time.Time, error) {
+	raw, err := s.Get(ctx, historyNamespace(namespace), historyKey(key, n))
+	if errors.Is(err, ErrNotFound) {
+		return nil, time.Time{}, notFoundError{fmt.Sprintf("versión no encontrada: %s@%d", key, n)}
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	at, value, err := parseHistory(raw)
+	return value, at, err
+}
+
+// ListVersions devuelve las versiones guardadas de 'key', de la más antigua
+// a la actual (la última). Una clave que nunca se ha escrito con
+// PutVersioned no tiene versiones.
+func ListVersions(ctx context.Context, s Store, namespace string, key []byte) ([]Version, error) {
+	hist := historyNamespace(namespace)
+	head := historyPrefix(key)
+	keys, err := s.KeysByPrefix(ctx, hist, head)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var versions []Version
+	for _, k := range keys {
+		if len(k) != len(head)+8 {
+			continue // el contador
+		}
+		raw, err := s.Get(ctx, hist, k)
+		if errors.Is(err, ErrNotFound) {
+			continue // descartada mientras tanto
+		}
+		if err != nil {
+			return nil, err
+		}
+		at, value, err := parseHistory(raw)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, Version{Number: binary.BigEndian.Uint64(k[len(head):]), Time: at, Size: len(value)})
+	}
+	// Con las claves cifradas (EncryptedStore) no salen en orden
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Number < versions[j].Number })
+	return versions, nil
+}
@@ -0,0 +1,312 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+	Decorador de Store que avisa de los cambios a quien los esté esperando
+	(Watch), para no tener que consultar la base de datos cada poco
+*/
+
+// watchBuffer es cuántos eventos pueden quedar pendientes de leer en el
+// canal de un Watch antes de darlo por perdido.
+const watchBuffer = 64
+
+// ChangeKind es el tipo de un ChangeEvent.
+type ChangeKind int
+
+const (
+	ChangePut             ChangeKind = iota // Put o PutWithTTL de Key
+	ChangeDelete                            // Delete de Key
+	ChangeDeleteNamespace                   // DeleteNamespace de Namespace (o de uno de encima)
+	ChangeDeletePrefix                      // DeleteByPrefix de las claves de Namespace que empiezan por Key
+)
+
+// ChangeEvent es un cambio hecho a través de un WatchStore.
+type ChangeEvent struct {
+	Kind      ChangeKind
+	Namespace string
+	Key       []byte // nil en ChangeDeleteNamespace; el prefijo en ChangeDeletePrefix
+	Value     []byte // sólo en ChangePut
+}
+
+// watcher es una suscripción de Watch.
+type watcher struct {
+	namespace string
+	prefix    []byte
+	ch        chan ChangeEvent
+}
+
+// matches indica si 'e' le interesa a 'w'.
+func (w *watcher) matches(e ChangeEvent) bool {
+	switch e.Kind {
+	case ChangeDeleteNamespace:
+		return inNamespaces(w.namespace, []string{e.Namespace})
+	case ChangeDeletePrefix:
+		// Basta con que alguna clave pueda tener los dos prefijos
+		return e.Namespace == w.namespace && (bytes.HasPrefix(e.Key, w.prefix) || bytes.HasPrefix(w.prefix, e.Key))
+	}
+	return e.Namespace == w.namespace && bytes.HasPrefix(e.Key, w.prefix)
+}
+
+// WatchStore envuelve un Store y avisa por Watch de las escrituras que
+// pasan por él. Sólo ve las de este proceso: lo que otra instancia escriba
+// en el mismo motor (por ejemplo, en Redis) no genera eventos.
+type WatchStore struct {
+	inner    Store
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+// NewWatchStore crea el decorador sobre 'inner'.
+func NewWatchStore(inner Store) *WatchStore {
+	return &WatchStore{inner: inner, watchers: make(map[*watcher]struct{})}
+}
+
+// Watch devuelve un canal con los cambios de las claves de 'namespace' que
+// empiezan por 'prefix' (nil para todas), en el orden en que se hacen, y
+// la función que termina la suscripción y cierra el canal. Los eventos no
+// esperan al lector: si deja que se acumulen watchBuffer, el canal se
+// cierra sin más, y el lector debe volver a leer lo que le interese y
+// llamar otra vez a Watch.
+func (s *WatchStore) Watch(namespace string, prefix []byte) (<-chan ChangeEvent, func()) {
+	w := &watcher{namespace: namespace, prefix: bytes.Clone(prefix), ch: make(chan ChangeEvent, watchBuffer)}
+	s.mu.Lock()
+	s.watchers[w] = struct{}{}
+	s.mu.Unlock()
+	return w.ch, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.drop(w)
+	}
+}
+
+// drop quita 'w' (si sigue suscrito) y cierra su canal. Hay que llamarla
+// con s.mu tomado.
+func (s *WatchStore) drop(w *watcher) {
+	if _, ok := s.watchers[w]; ok {
+		delete(s.watchers, w)
+		close(w.ch)
+	}
+}
+
+// publish entrega 'events' a los watchers interesados.
+func (s *WatchStore) publish(events ...ChangeEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		for w := range s.watchers {
+			if !w.matches(e) {
+				continue
+			}
+			select {
+			case w.ch <- e:
+			default:
+				s.drop(w) // lector demasiado lento: ha perdido eventos
+			}
+		}
+	}
+}
+
+// Put escribe en el Store envuelto y avisa del cambio.
+func (s *WatchStore) Put(ctx context.Context, namespace string, key, value []byte) error {
+	if err := s.inner.Put(ctx, namespace, key, value); err != nil {
+		return err
+	}
+	s.publish(ChangeEvent{ChangePut, namespace, bytes.Clone(key), bytes.Clone(value)})
+	return nil
+}
+
+// PutWithTTL escribe en el Store envuelto y avisa del cambio (no de la
+// caducidad: el barrido borra por debajo del decorador).
+func (s *WatchStore) PutWithTTL(ctx context.Context, namespace string, key, value []byte, ttl time.Duration) error {
+	if err := s.inner.PutWithTTL(ctx, namespace, key, value, ttl); err != nil {
+		return err
+	}
+	s.publish(ChangeEvent{ChangePut, namespace, bytes.Clone(key), bytes.Clone(value)})
+	return nil
+}
+
+// Get lee del Store envuelto.
+func (s *WatchStore) Get(ctx context.Context, namespace string, key []byte) ([]byte, error) {
+	return s.inner.Get(ctx, namespace, key)
+}
+
+// Exists consulta el Store envuelto.
+func (s *WatchStore) Exists(ctx context.Context, namespace string, key []byte) (bool, error) {
+	return s.inner.Exists(ctx, namespace, key)
+}
+
+// Delete borra del Store envuelto y avisa del cambio.
+func (s *WatchStore) Delete(ctx context.Context, namespace string, key []byte) error {
+	if err := s.inner.Delete(ctx, namespace, key); err != nil {
+		return err
+	}
+	s.publish(ChangeEvent{ChangeDelete, namespace, bytes.Clone(key), nil})
+	return nil
+}
+
+// DeleteNamespace borra del Store envuelto y avisa a los watchers de
+// 'namespace' y de los anidados bajo él.
+func (s *WatchStore) DeleteNamespace(ctx context.Context, namespace string) error {
+	if err := s.inner.DeleteNamespace(ctx, namespace); err != nil {
+		return err
+	}
+	s.publish(ChangeEvent{ChangeDeleteNamespace, namespace, nil, nil})
+	return nil
+}
+
+// DeleteByPrefix borra del Store envuelto y, si ha borrado algo, avisa con
+// un único ChangeDeletePrefix (no sabe qué claves eran).
+func (s *WatchStore) DeleteByPrefix(ctx context.Context, namespace string, prefix []byte) (int, error) {
+	n, err := s.inner.DeleteByPrefix(ctx, namespace, prefix)
+	if err != nil {
+		return n, err
+	}
+	if n > 0 {
+		s.publish(ChangeEvent{ChangeDeletePrefix, namespace, bytes.Clone(prefix), nil})
+	}
+	return n, nil
+}
+
+// watchTx apunta los cambios hechos dentro de un Batch.
+type watchTx struct {
+	Tx
+	events *[]ChangeEvent
+}
+
+func (t watchTx) Put(namespace string, key, value []byte) error {
+	if err := t.Tx.Put(namespace, key, value); err != nil {
+		return err
+	}
+	*t.events = append(*t.events, ChangeEvent{ChangePut, namespace, bytes.Clone(key), bytes.Clone(value)})
+	return nil
+}
+
+func (t watchTx) Delete(namespace string, key []byte) error {
+	if err := t.Tx.Delete(namespace, key); err != nil {
+		return err
+	}
+	*t.events = append(*t.events, ChangeEvent{ChangeDelete, namespace, bytes.Clone(key), nil})
+	return nil
+}
+
+// Batch ejecuta 'fn' en el Store envuelto y, sólo si se aplica, avisa de
+// todos sus cambios juntos.
+func (s *WatchStore) Batch(ctx context.Context, fn func(tx Tx) error) error {
+	var events []ChangeEvent
+	err := s.inner.Batch(ctx, func(tx Tx) error {
+		events = events[:0] // el motor puede reintentar 'fn'
+		return fn(watchTx{tx, &events})
+	})
+	if err != nil {
+		return err
+	}
+	s.publish(events...)
+	return nil
+}
+
+// ListKeys lista las claves del Store envuelto.
+func (s *WatchStore) ListKeys(ctx context.Context, namespace string) ([][]byte, error) {
+	return s.inner.ListKeys(ctx, namespace)
+}
+
+// CountKeys cuenta las claves del Store envuelto.
+func (s *WatchStore) CountKeys(ctx context.Context, namespace string) (int, error) {
+	return s.inner.CountKeys(ctx, namespace)
+}
+
+// KeysByPrefix busca claves en el Store envuelto.
+func (s *WatchStore) KeysByPrefix(ctx context.Context, namespace string, prefix []byte) ([][]byte, error) {
+	return s.inner.KeysByPrefix(ctx, namespace, prefix)
+}
+
+// ListKeysPage pagina las claves del Store envuelto.
+func (s *WatchStore) ListKeysPage(ctx context.Context, namespace string, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.inner.ListKeysPage(ctx, namespace, after, limit)
+}
+
+// KeysByPrefixPage pagina las claves del Store envuelto.
+func (s *WatchStore) KeysByPrefixPage(ctx context.Context, namespace string, prefix, after []byte, limit int) ([][]byte, []byte, error) {
+	return s.inner.KeysByPrefixPage(ctx, namespace, prefix, after, limit)
+}
+
+// GetRange lee un rango del Store envuelto.
+func (s *WatchStore) GetRange(ctx context.Context, namespace string, start, end []byte, limit int) ([]Entry, error) {
+	return s.inner.GetRange(ctx, namespace, start, end, limit)
+}
+
+// LastN lee las últimas entradas del Store envuelto.
+func (s *WatchStore) LastN(ctx context.Context, namespace string, prefix []byte, n int) ([]Entry, error) {
+	return s.inner.LastN(ctx, namespace, prefix, n)
+}
+
+// ForEach recorre el Store envuelto.
+func (s *WatchStore) ForEach(ctx context.Context, namespace string, fn func(key, value []byte) error) error {
+	return s.inner.ForEach(ctx, namespace, fn)
+}
+
+// Namespaces lista los namespaces del Store envuelto.
+func (s *WatchStore) Namespaces(ctx context.Context) ([]string, error) {
+	return s.inner.Namespaces(ctx)
+}
+
+// NamespacesUnder lista los namespaces anidados del Store envuelto.
+func (s *WatchStore) NamespacesUnder(ctx context.Context, parent string) ([]string, error) {
+	return s.inner.NamespacesUnder(ctx, parent)
+}
+
+// Backup copia el Store envuelto.
+func (s *WatchStore) Backup(ctx context.Context, w io.Writer) error {
+	return s.inner.Backup(ctx, w)
+}
+
+// Restore restaura en caliente el Store envuelto, si éste lo permite (ver
+// Restorer). No genera eventos: quien necesite saberlo debe releer.
+func (s *WatchStore) Restore(r io.Reader) error {
+	rs, ok := s.inner.(Restorer)
+	if !ok {
+		return errors.New("el motor de almacenamiento no permite restaurar en caliente")
+	}
+	return rs.Restore(r)
+}
+
+// Compact compacta el Store envuelto, si éste lo permite (ver Compacter).
+func (s *WatchStore) Compact() (before, after int64, err error) {
+	c, ok := s.inner.(Compacter)
+	if !ok {
+		return 0, 0, errors.New("el motor de almacenamiento no necesita compactarse")
+	}
+	return c.Compact()
+}
+
+// Snapshot fija una vista del Store envuelto (ver Snapshotter).
+func (s *WatchStore) Snapshot() (Snapshot, error) {
+	return snapshotOf(s.inner)
+}
+
+// stats da la ocupación del Store envuelto (ver Stats).
+func (s *WatchStore) stats(ctx context.Context) (StoreStats, error) {
+	return Stats(ctx, s.inner)
+}
+
+// Close cierra las suscripciones y el Store envuelto.
+func (s *WatchStore) Close() error {
+	s.mu.Lock()
+	for w := range s.watchers {
+		s.drop(w)
+	}
+	s.mu.Unlock()
+	return s.inner.Close()
+}
+
+// Dump vuelca el Store envuelto.
+func (s *WatchStore) Dump(ctx context.Context, w io.Writer, opts DumpOptions) error {
+	return s.inner.Dump(ctx, w, opts)
+}
@@ -0,0 +1,150 @@
+package tlsutil
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// cipherSuites son las suites de TLS 1.2 que se aceptan: sólo ECDHE (secreto
+// hacia delante) con cifrado autenticado. TLS 1.3 elige las suyas, que ya
+// son todas de este tipo.
+var cipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// baseConfig es la configuración común de servidor y cliente: TLS 1.2 como
+// mínimo y cipherSuites.
+func baseConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CipherSuites:     cipherSuites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+	}
+}
+
+// ServerConfig devuelve la configuración TLS del servidor con el
+// certificado y la clave de 'certFile' y 'keyFile' (PEM).
+func ServerConfig(certFile, keyFile string) (*tls.Config, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error cargando el certificado del servidor: %v", err)
+	}
+	cfg := baseConfig()
+	cfg.Certificates = []tls.Certificate{pair}
+	return cfg, nil
+}
+
+// VerifyClients hace que 'cfg' (de ServerConfig) pida certificado a los
+// clientes y sólo acepte los emitidos por la CA de 'caFile' para
+// autenticar clientes. Con 'required', la conexión no se completa sin uno;
+// si no, el certificado es opcional.
+func VerifyClients(cfg *tls.Config, caFile string, required bool) error {
+	pool, err := loadPool(caFile)
+	if err != nil {
+		return err
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	if required {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
+
+// ClientConfig devuelve la configuración TLS del cliente. Si 'caFile' no
+// está vacío, sólo se confía en esa CA (la del proyecto, ver
+// EnsureCertificates) en lugar de en las del sistema. Si 'pin' no está
+// vacío, además el certificado del servidor tiene que tener esa clave
+// pública (ver SPKIPin); con un pin y sin CA, basta con eso, y así se puede
+// usar un certificado autofirmado sin más.
+func ClientConfig(caFile, pin string) (*tls.Config, error) {
+	cfg := baseConfig()
+	if caFile != "" {
+		pool, err := loadPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if pin == "" {
+		return cfg, nil
+	}
+	if raw, err := base64.StdEncoding.DecodeString(pin); err != nil || len(raw) != sha256.Size {
+		return nil, errors.New("el pin debe ser un SHA-256 en base64 (ver SPKIPin)")
+	}
+	// Sin CA, la cadena no se comprueba (el pin ya fija el certificado); con
+	// CA, el pin se mira después de la comprobación normal
+	cfg.InsecureSkipVerify = caFile == ""
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("el servidor no ha enviado certificado")
+		}
+		if got := SPKIPin(cs.PeerCertificates[0]); got != pin {
+			return fmt.Errorf("la clave pública del servidor (%s) no es la fijada", got)
+		}
+		return nil
+	}
+	return cfg, nil
+}
+
+// LoadClientCertificate añade a 'cfg' (de ClientConfig) el certificado de
+// cliente de 'certFile' y 'keyFile' (ver IssueClientCertificate), para los
+// servidores con mTLS.
+func LoadClientCertificate(cfg *tls.Config, certFile, keyFile string) error {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("error cargando el certificado de cliente: %v", err)
+	}
+	cfg.Certificates = []tls.Certificate{pair}
+	return nil
+}
+
+// loadPool lee los certificados PEM de la CA 'caFile'.
+func loadPool(caFile string) (*x509.CertPool, error) {
+	pemData, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo la CA: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, fmt.Errorf("%s no contiene ningún certificado PEM", caFile)
+	}
+	return pool, nil
+}
+
+// SPKIPin devuelve el pin de la clave pública de 'cert': el SHA-256 de su
+// SubjectPublicKeyInfo en base64, como en HPKP. Sobrevive a la renovación
+// del certificado si se mantiene la clave.
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// CertificatePin lee el primer certificado PEM de 'certFile' y devuelve
+// su SPKIPin, para dárselo a los clientes.
+func CertificatePin(certFile string) (string, error) {
+	pemData, err := os.ReadFile(certFile)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("%s no contiene ningún certificado PEM", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("certificado no válido en %s: %v", certFile, err)
+	}
+	return SPKIPin(cert), nil
+}
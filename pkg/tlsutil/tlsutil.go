@@ -0,0 +1,216 @@
+// El paquete tlsutil genera la pequeña PKI del proyecto (una CA propia y el
+// certificado del servidor) para poder activar TLS sin recurrir a openssl.
+package tlsutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Nombres de fichero dentro del directorio de certificados.
+const (
+	CACertFile     = "ca.pem"
+	CAKeyFile      = "ca.key"
+	ServerCertFile = "server.pem"
+	ServerKeyFile  = "server.key"
+)
+
+// Validez de los certificados generados.
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 825 * 24 * time.Hour // máximo aceptado por los navegadores
+)
+
+// Paths agrupa las rutas de los ficheros de la PKI en un directorio.
+type Paths struct {
+	CACert, CAKey, ServerCert, ServerKey string
+}
+
+// PathsIn devuelve las rutas estándar dentro de 'dir'.
+func PathsIn(dir string) Paths {
+	return Paths{
+		CACert:     filepath.Join(dir, CACertFile),
+		CAKey:      filepath.Join(dir, CAKeyFile),
+		ServerCert: filepath.Join(dir, ServerCertFile),
+		ServerKey:  filepath.Join(dir, ServerKeyFile),
+	}
+}
+
+// EnsureCertificates crea en 'dir' una CA y un certificado de servidor para
+// 'hosts' (nombres DNS o IPs) si todavía no existen. Si ya están, no los toca.
+// Devuelve las rutas de los ficheros.
+func EnsureCertificates(dir string, hosts []string) (Paths, error) {
+	p := PathsIn(dir)
+	if fileExists(p.ServerCert) && fileExists(p.ServerKey) {
+		return p, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return p, fmt.Errorf("error creando %s: %v", dir, err)
+	}
+
+	// Reutilizamos la CA si ya existe (p.ej. al regenerar sólo el servidor)
+	var ca *x509.Certificate
+	var caKey crypto.Signer
+	var err error
+	if fileExists(p.CACert) && fileExists(p.CAKey) {
+		ca, caKey, err = LoadCA(p.CACert, p.CAKey)
+	} else {
+		ca, caKey, err = generateCA(p.CACert, p.CAKey)
+	}
+	if err != nil {
+		return p, err
+	}
+
+	tmpl, err := leafTemplate("prac server", leafValidity)
+	if err != nil {
+		return p, err
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	return p, issue(tmpl, ca, caKey, p.ServerCert, p.ServerKey)
+}
+
+// ClientCertPaths devuelve dónde deja IssueClientCertificate, dentro de
+// 'dir', el certificado y la clave de 'commonName'.
+func ClientCertPaths(dir, commonName string) (cert, key string) {
+	name := "client-" + url.PathEscape(commonName)
+	return filepath.Join(dir, name+".pem"), filepath.Join(dir, name+".key")
+}
+
+// IssueClientCertificate firma con la CA de 'dir' (ver EnsureCertificates)
+// un certificado de cliente con 'commonName' como CN, que el servidor con
+// mTLS toma como nombre de usuario. Si ya había uno, lo sustituye (el
+// anterior sigue valiendo hasta que caduca). Devuelve las rutas de
+// ClientCertPaths.
+func IssueClientCertificate(dir, commonName string) (cert, key string, err error) {
+	if commonName == "" {
+		return "", "", errors.New("falta el nombre del certificado de cliente")
+	}
+	p := PathsIn(dir)
+	ca, caKey, err := LoadCA(p.CACert, p.CAKey)
+	if err != nil {
+		return "", "", err
+	}
+	tmpl, err := leafTemplate(commonName, leafValidity)
+	if err != nil {
+		return "", "", err
+	}
+	tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	cert, key = ClientCertPaths(dir, commonName)
+	return cert, key, issue(tmpl, ca, caKey, cert, key)
+}
+
+// LoadCA lee el certificado y la clave privada de la CA en formato PEM.
+func LoadCA(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error cargando la CA: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("certificado de CA no válido: %v", err)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok || !cert.IsCA {
+		return nil, nil, errors.New("el certificado indicado no es una CA válida")
+	}
+	return cert, key, nil
+}
+
+// generateCA crea una CA autofirmada y la escribe en disco.
+func generateCA(certPath, keyPath string) (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error generando clave de CA: %v", err)
+	}
+	tmpl, err := leafTemplate("prac CA", caValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.MaxPathLenZero = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creando certificado de CA: %v", err)
+	}
+	if err := writePEM(certPath, keyPath, der, key); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
+
+// leafTemplate devuelve una plantilla básica con número de serie aleatorio.
+func leafTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generando número de serie: %v", err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"prac"}},
+		NotBefore:    now.Add(-time.Hour), // margen por desfase de relojes
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}, nil
+}
+
+// issue genera una clave nueva, firma 'tmpl' con la CA y lo escribe en disco.
+func issue(tmpl, ca *x509.Certificate, caKey crypto.Signer, certPath, keyPath string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("error generando clave: %v", err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, key.Public(), caKey)
+	if err != nil {
+		return fmt.Errorf("error firmando certificado: %v", err)
+	}
+	return writePEM(certPath, keyPath, der, key)
+}
+
+// writePEM escribe el certificado (0644) y la clave privada PKCS#8 (0600).
+func writePEM(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("error serializando clave: %v", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("error escribiendo %s: %v", keyPath, err)
+	}
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("error escribiendo %s: %v", certPath, err)
+	}
+	return nil
+}
+
+// fileExists indica si 'path' existe.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -4,9 +4,12 @@ package ui
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"strings"
+
+	"golang.org/x/term"
 )
 
 // PrintMenu muestra un menú y solicita al usuario que seleccione una opción.
@@ -118,3 +121,27 @@ func PrintProgressBar(progress, total int, width int) {
 		fmt.Println()
 	}
 }
+
+// IsInteractive indica si la entrada estándar es una terminal
+// (y por tanto tiene sentido pedir datos al usuario).
+func IsInteractive() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// ReadPassword solicita un secreto sin mostrarlo en pantalla y lo devuelve
+// como []byte para que el llamante pueda borrarlo tras usarlo. Si la entrada
+// no es una terminal, lo lee como una línea normal (sin pasar por string).
+func ReadPassword(prompt string) []byte {
+	fmt.Print(prompt + ": ")
+	if !IsInteractive() {
+		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Scan()
+		line := scanner.Bytes()
+		secret := append([]byte(nil), bytes.TrimSpace(line)...)
+		clear(line)
+		return secret
+	}
+	secret, _ := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Println()
+	return secret
+}